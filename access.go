@@ -0,0 +1,272 @@
+package auditlog
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventQuery is recorded whenever the chain is searched with Query,
+// naming the accessor, the range of serial numbers searched, and the
+// filter applied.
+const EventQuery = "query"
+
+// ErrNoAccessor is returned by the read APIs when an accessor identity
+// is required and none was given.
+var ErrNoAccessor = errors.New("auditlog: accessor identity required")
+
+// WithAccessorRequired requires every read of the audit log through
+// Query, CertifyAs, ReportAs, and Backup to name the accessor making
+// it, so that access to the log is itself auditable. Certify, Report,
+// and the EventsBy methods, which don't name an accessor, fail with
+// ErrNoAccessor.
+func WithAccessorRequired() Option {
+	return func(l *Logger) {
+		l.requireAccessor = true
+	}
+}
+
+type accessorKey struct{}
+
+// ContextWithAccessor returns a context naming the accessor on whose
+// behalf a read, such as a Backup, is made.
+func ContextWithAccessor(ctx context.Context, accessor string) context.Context {
+	return context.WithValue(ctx, accessorKey{}, accessor)
+}
+
+// AccessorFromContext returns the accessor attached to ctx with
+// ContextWithAccessor, or the empty string if there is none.
+func AccessorFromContext(ctx context.Context) string {
+	accessor, _ := ctx.Value(accessorKey{}).(string)
+	return accessor
+}
+
+// A Query selects events from the chain. Start and End bound the
+// serial numbers searched, inclusive; if End is zero, the search runs
+// to the end of the chain. The other fields filter the events found,
+// and are ignored when zero: From and Until bound the time an event
+// was logged to [From, Until), and Level, Actor, and Event must match
+// exactly, except that levels are compared without regard to case.
+// MinLevel selects the events at or above a level, such as every
+// ERROR and CRITICAL event for "error", and Attributes the events
+// carrying every attribute given, such as user=alice.
+type Query struct {
+	Start      uint64
+	End        uint64
+	From       time.Time
+	Until      time.Time
+	Level      string
+	MinLevel   string
+	Actor      string
+	Event      string
+	Attributes []Attribute
+}
+
+// String describes the query's filter, as recorded in the chain.
+func (q Query) String() string {
+	var filter []string
+	if !q.From.IsZero() {
+		filter = append(filter, "from="+q.From.UTC().Format(time.RFC3339Nano))
+	}
+	if !q.Until.IsZero() {
+		filter = append(filter, "until="+q.Until.UTC().Format(time.RFC3339Nano))
+	}
+	if q.Level != "" {
+		filter = append(filter, "level="+strings.ToUpper(q.Level))
+	}
+	if q.MinLevel != "" {
+		filter = append(filter, "min_level="+strings.ToUpper(q.MinLevel))
+	}
+	if q.Actor != "" {
+		filter = append(filter, "actor="+q.Actor)
+	}
+	if q.Event != "" {
+		filter = append(filter, "event="+q.Event)
+	}
+	for _, attr := range q.Attributes {
+		filter = append(filter, "attribute="+attr.Name+"="+attr.Value)
+	}
+	return strings.Join(filter, " ")
+}
+
+func (q Query) match(ev *Event) bool {
+	switch {
+	case !q.From.IsZero() && ev.When < q.From.UnixNano():
+		return false
+	case !q.Until.IsZero() && ev.When >= q.Until.UnixNano():
+		return false
+	case q.Level != "" && !strings.EqualFold(ev.Level, q.Level):
+		return false
+	case q.MinLevel != "" && !LevelAtLeast(ev.Level, q.MinLevel):
+		return false
+	case q.Actor != "" && ev.Actor != q.Actor:
+		return false
+	case q.Event != "" && ev.Event != q.Event:
+		return false
+	}
+
+	for _, want := range q.Attributes {
+		found := false
+		for _, attr := range ev.Attributes {
+			if attr == want {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Query returns the events selected by q. Each query is recorded in
+// the chain as a signed "query" event naming the accessor, the range
+// searched, and the filter; it doesn't include itself in its results.
+// Events that have been pruned are skipped.
+func (l *Logger) Query(accessor string, q Query) ([]*Event, error) {
+	if l.requireAccessor && accessor == "" {
+		return nil, ErrNoAccessor
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	start, end, empty, err := l.recordQuery(accessor, q)
+	if err != nil || empty {
+		return nil, err
+	}
+
+	events, err := l.queryEvents(q, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []*Event
+	for _, ev := range events {
+		if q.match(ev) {
+			selected = append(selected, ev)
+		}
+	}
+	return selected, nil
+}
+
+// recordQuery records q in the chain, and returns the range of serial
+// numbers it searches, which is empty if there are no events in it;
+// the caller must hold the logger's lock.
+func (l *Logger) recordQuery(accessor string, q Query) (start, end uint64, empty bool, err error) {
+	if l.closed {
+		return 0, 0, false, errors.New("auditlog: logger has been stopped")
+	}
+
+	first, _, err := l.chainStart()
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	// The range is fixed before the query is recorded, so that the
+	// query event isn't part of its own results.
+	count := l.counter
+	start, end = q.Start, q.End
+	if start < first {
+		start = first
+	}
+
+	if count == 0 {
+		end = 0
+	} else if end == 0 || end >= count {
+		end = count - 1
+	}
+	empty = count <= start || start > end
+
+	err = l.record(&Event{
+		When:  l.now(),
+		Level: levelStrings[levelInfo],
+		Actor: internalActor,
+		Event: EventQuery,
+		Attributes: []Attribute{
+			{"accessor", accessor},
+			{"start", strconv.FormatUint(start, 10)},
+			{"end", strconv.FormatUint(end, 10)},
+			{"filter", q.String()},
+		},
+	})
+	return start, end, empty, err
+}
+
+// queryEvents loads the events in the range [start, end] that q may
+// select: those carrying its first attribute, if it has any and the
+// store is an AttributeSearcher, those recorded by its actor, if it
+// names one and the store is an ActorSearcher, those at its levels,
+// if it has a minimum and the store is a LevelSearcher, or else all
+// of them.
+func (l *Logger) queryEvents(q Query, start, end uint64) ([]*Event, error) {
+	if searcher, ok := l.store.(AttributeSearcher); ok && len(q.Attributes) > 0 {
+		return searcher.EventsByAttribute(q.Attributes[0], start, end)
+	}
+
+	if searcher, ok := l.store.(ActorSearcher); ok && q.Actor != "" {
+		return searcher.EventsByActor(q.Actor, start, end)
+	}
+
+	if searcher, ok := l.store.(LevelSearcher); ok && q.MinLevel != "" {
+		return searcher.EventsByLevel(levelsAtLeast(q.MinLevel), start, end)
+	}
+	return l.store.Events(start, end)
+}
+
+// levelsAtLeast returns the names of the levels at or above min, in
+// ascending order.
+func levelsAtLeast(min string) []string {
+	var levels []string
+	for level := levelFromString(min); level <= levelCritical; level++ {
+		if level != levelUnknown {
+			levels = append(levels, levelStrings[level])
+		}
+	}
+	return levels
+}
+
+// EventsByActor returns the events recorded by actor with serial
+// numbers in the range [start, end]; if end is zero, the search runs
+// to the end of the chain. It is Query with only an actor, and is
+// recorded in the chain in the same way, without an accessor: under
+// WithAccessorRequired, it fails with ErrNoAccessor, and Query must be
+// used instead. The SQL stores find the events through an index on
+// the actor.
+func (l *Logger) EventsByActor(actor string, start, end uint64) ([]*Event, error) {
+	if actor == "" {
+		return nil, errors.New("auditlog: no actor given")
+	}
+	return l.Query("", Query{Start: start, End: end, Actor: actor})
+}
+
+// EventsByLevel returns the events at or above level, such as every
+// ERROR and CRITICAL event for "error", with serial numbers in the
+// range [start, end]; if end is zero, the search runs to the end of
+// the chain. Like EventsByActor, it is a Query recorded without an
+// accessor. The SQL stores find the events through an index on the
+// level.
+func (l *Logger) EventsByLevel(level string, start, end uint64) ([]*Event, error) {
+	if levelFromString(level) == levelUnknown {
+		return nil, errors.New("auditlog: unknown level " + level)
+	}
+	return l.Query("", Query{Start: start, End: end, MinLevel: level})
+}
+
+// EventsByAttribute returns the events carrying the attribute name
+// with value, such as user=alice, with serial numbers in the range
+// [start, end]; if end is zero, the search runs to the end of the
+// chain. Like EventsByActor, it is a Query recorded without an
+// accessor. The SQL stores find the events through an index on the
+// attributes. Encrypted values can't be searched for; see
+// WithEncryption.
+func (l *Logger) EventsByAttribute(name, value string, start, end uint64) ([]*Event, error) {
+	if name == "" {
+		return nil, errors.New("auditlog: no attribute name given")
+	}
+	return l.Query("", Query{Start: start, End: end, Attributes: []Attribute{{name, value}}})
+}
@@ -0,0 +1,190 @@
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	l, _ := newTestLogger(t, WithAccessorRequired())
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("access_test", "login", []Attribute{{"user", "jqp"}})
+	l.WarningSync("access_test", "login", []Attribute{{"user", "root"}})
+	l.InfoSync("access_test", "logout", []Attribute{{"user", "jqp"}})
+
+	if _, err := l.Query("", Query{}); err != ErrNoAccessor {
+		t.Fatalf("expected an anonymous query to be refused, have %v", err)
+	}
+
+	if _, err := l.Certify(0, 0); err != ErrNoAccessor {
+		t.Fatalf("expected an anonymous certification to be refused, have %v", err)
+	}
+
+	if _, err := l.Report(time.Unix(0, 0), time.Now()); err != ErrNoAccessor {
+		t.Fatalf("expected an anonymous report to be refused, have %v", err)
+	}
+
+	if err := l.Backup(context.Background(), &bytes.Buffer{}); err != ErrNoAccessor {
+		t.Fatalf("expected an anonymous backup to be refused, have %v", err)
+	}
+
+	if _, err := l.EventsByActor("access_test", 0, 0); err != ErrNoAccessor {
+		t.Fatalf("expected an anonymous search to be refused, have %v", err)
+	}
+
+	if l.Count() != 3 {
+		t.Fatalf("expected refused reads not to be recorded, have %d events", l.Count())
+	}
+
+	events, err := l.Query("auditor", Query{Event: "login", Level: "info"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(events) != 1 || events[0].Serial != 0 {
+		t.Fatalf("expected event 0 to be selected, have %v", events)
+	}
+
+	ev, err := l.store.Event(3)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	accessor, _ := ev.attr("accessor")
+	filter, _ := ev.attr("filter")
+	end, _ := ev.attr("end")
+	if ev.Event != EventQuery || accessor != "auditor" || filter != "level=INFO event=login" || end != "2" {
+		t.Fatalf("expected the query to be recorded, have %s", ev)
+	}
+
+	err = l.Backup(ContextWithAccessor(context.Background(), "backup"), &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ev, err = l.store.Event(4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if accessor, _ = ev.attr("accessor"); ev.Event != EventBackup || accessor != "backup" {
+		t.Fatalf("expected the backup to be recorded, have %s", ev)
+	}
+}
+
+func TestEventsByActor(t *testing.T) {
+	l, _ := newTestLogger(t)
+	l.Start()
+	defer l.Stop()
+
+	for _, actor := range []string{"alice", "bob", "alice", "bob", "alice"} {
+		l.InfoSync(actor, "config change", nil)
+	}
+
+	events, err := l.EventsByActor("alice", 0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(events) != 3 || events[0].Serial != 0 || events[1].Serial != 2 || events[2].Serial != 4 {
+		t.Fatalf("expected events 0, 2, and 4, have %v", events)
+	}
+
+	events, err = l.EventsByActor("bob", 2, 3)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(events) != 1 || events[0].Serial != 3 {
+		t.Fatalf("expected event 3, have %v", events)
+	}
+
+	// Each search is recorded, as a query is.
+	ev, err := l.store.Event(6)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if filter, _ := ev.attr("filter"); ev.Event != EventQuery || filter != "actor=bob" {
+		t.Fatalf("expected the search to be recorded, have %s", ev)
+	}
+
+	if _, err = l.EventsByActor("", 0, 0); err == nil {
+		t.Fatal("expected a search without an actor to fail")
+	}
+}
+
+func TestEventsByLevel(t *testing.T) {
+	l, _ := newTestLogger(t)
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("access_test", "login", nil)
+	l.ErrorSync("access_test", "denied", nil)
+	l.WarningSync("access_test", "retry", nil)
+	l.CriticalSync("access_test", "breach", nil)
+
+	events, err := l.EventsByLevel("error", 0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(events) != 2 || events[0].Event != "denied" || events[1].Event != "breach" {
+		t.Fatalf("expected the ERROR and CRITICAL events, have %v", events)
+	}
+
+	ev, err := l.store.Event(4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if filter, _ := ev.attr("filter"); ev.Event != EventQuery || filter != "min_level=ERROR" {
+		t.Fatalf("expected the search to be recorded, have %s", ev)
+	}
+
+	if _, err = l.EventsByLevel("loud", 0, 0); err == nil {
+		t.Fatal("expected a search at an unknown level to fail")
+	}
+}
+
+func TestEventsByAttribute(t *testing.T) {
+	l, _ := newTestLogger(t)
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("access_test", "login", []Attribute{{"user", "alice"}, {"ip", "10.0.0.5"}})
+	l.InfoSync("access_test", "login", []Attribute{{"user", "bob"}, {"ip", "10.0.0.5"}})
+	l.InfoSync("access_test", "logout", []Attribute{{"user", "alice"}})
+
+	events, err := l.EventsByAttribute("user", "alice", 0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(events) != 2 || events[0].Serial != 0 || events[1].Serial != 2 {
+		t.Fatalf("expected events 0 and 2, have %v", events)
+	}
+
+	// Every attribute in a query must match.
+	events, err = l.Query("auditor", Query{Attributes: []Attribute{{"ip", "10.0.0.5"}, {"user", "bob"}}})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(events) != 1 || events[0].Serial != 1 {
+		t.Fatalf("expected event 1, have %v", events)
+	}
+
+	ev, err := l.store.Event(4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if filter, _ := ev.attr("filter"); filter != "attribute=ip=10.0.0.5 attribute=user=bob" {
+		t.Fatalf("expected the query to be recorded, have %s", ev)
+	}
+}
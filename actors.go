@@ -0,0 +1,142 @@
+package auditlog
+
+import "regexp"
+
+// An ActorPolicy determines what happens to events from actors that
+// aren't registered with the logger.
+type ActorPolicy int
+
+const (
+	// ActorAllow records events from any actor. This is the
+	// default when no actors are registered.
+	ActorAllow ActorPolicy = iota
+
+	// ActorFlag records events from unknown actors, adding an
+	// "unknown_actor" attribute so they stand out in the chain.
+	ActorFlag
+
+	// ActorReject discards events from unknown actors, recording a
+	// WARNING "unknown actor" event from the audit logger in their
+	// place. This is the default once any actors are registered.
+	ActorReject
+)
+
+// internalActor is the actor used for events generated by the audit
+// logger itself. It is reserved: events logged as it by callers are
+// replaced with a WARNING "reserved actor" event, whatever the actor
+// policy, so that they can't pass for the logger's own records.
+const internalActor = "auditlog"
+
+// EventReservedActor is recorded in place of an event logged as the
+// logger's own actor.
+const EventReservedActor = "reserved actor"
+
+// ReservedActor reports whether actor is reserved for the logger's
+// own events, so that a service accepting events from others can turn
+// them away before they reach the logger.
+func ReservedActor(actor string) bool {
+	return actor == internalActor
+}
+
+// AttrUnknownActor is the attribute added to events from unknown
+// actors under ActorFlag.
+const AttrUnknownActor = "unknown_actor"
+
+// WithActors registers the actors permitted to record events.
+func WithActors(actors ...string) Option {
+	return func(l *Logger) {
+		l.registerActors(actors)
+	}
+}
+
+// WithActorPattern permits any actor whose name matches pattern, in
+// addition to the registered actors.
+func WithActorPattern(pattern *regexp.Regexp) Option {
+	return func(l *Logger) {
+		l.actorPattern = pattern
+		if l.actorPolicy == ActorAllow {
+			l.actorPolicy = ActorReject
+		}
+	}
+}
+
+// WithActorPolicy sets the policy for events from actors that aren't
+// registered. It overrides the default chosen by WithActors and
+// WithActorPattern, and so may appear before or after them.
+func WithActorPolicy(policy ActorPolicy) Option {
+	return func(l *Logger) {
+		l.actorPolicy = policy
+		l.actorPolicySet = true
+	}
+}
+
+func (l *Logger) registerActors(actors []string) {
+	if l.actors == nil {
+		l.actors = map[string]bool{}
+	}
+
+	for _, actor := range actors {
+		l.actors[actor] = true
+	}
+
+	if !l.actorPolicySet && l.actorPolicy == ActorAllow {
+		l.actorPolicy = ActorReject
+	}
+}
+
+// RegisterActor permits an additional actor to record events.
+func (l *Logger) RegisterActor(actor string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.registerActors([]string{actor})
+}
+
+// knownActor reports whether events from actor are permitted; the
+// caller must hold the logger's lock.
+func (l *Logger) knownActor(actor string) bool {
+	if l.actors[actor] {
+		return true
+	}
+
+	return l.actorPattern != nil && l.actorPattern.MatchString(actor)
+}
+
+// checkActor applies the actor policy to an event before it is
+// signed; the caller must hold the logger's lock.
+func (l *Logger) checkActor(ev *Event) {
+	if ev.internal {
+		return
+	}
+
+	if ev.Actor == internalActor {
+		rejectActor(ev, EventReservedActor)
+		return
+	}
+
+	if l.actorPolicy == ActorAllow || l.knownActor(ev.Actor) {
+		return
+	}
+
+	switch l.actorPolicy {
+	case ActorFlag:
+		ev.Attributes = append(ev.Attributes[:len(ev.Attributes):len(ev.Attributes)],
+			Attribute{AttrUnknownActor, "true"})
+	case ActorReject:
+		rejectActor(ev, "unknown actor")
+	}
+}
+
+// rejectActor replaces an event with a WARNING event from the logger
+// recording that its actor was turned away.
+func rejectActor(ev *Event, event string) {
+	ev.Attributes = []Attribute{
+		{"actor", ev.Actor},
+		{"event", ev.Event},
+		{"level", ev.Level},
+	}
+	ev.Level = levelStrings[levelWarning]
+	ev.Actor = internalActor
+	ev.Event = event
+	ev.internal = true
+}
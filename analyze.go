@@ -0,0 +1,218 @@
+package auditlog
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A Finding is an anomaly reported by an Analyzer. It is recorded as
+// an event from the logger itself at Level, which should be
+// "WARNING" or "ERROR", and the alert hook is fired with the
+// recorded event.
+type Finding struct {
+	Level      string
+	Event      string
+	Attributes []Attribute
+}
+
+// An Analyzer examines each event after it has been recorded,
+// reporting any anomalies it finds. Events recorded by the logger
+// itself, including findings, aren't analyzed. Analyze is called with
+// the logger's lock held, and must not log to the logger or keep ev
+// once it returns.
+type Analyzer interface {
+	Analyze(ev *Event) []Finding
+}
+
+// WithAnalyzers feeds recorded events to the analyzers.
+func WithAnalyzers(analyzers ...Analyzer) Option {
+	return func(l *Logger) {
+		l.analyzers = append(l.analyzers, analyzers...)
+	}
+}
+
+// WithAlertHook sets a function called with each finding event after
+// it has been recorded. The hook is called with the logger's lock
+// held, and must not log to the logger.
+func WithAlertHook(hook func(ev *Event)) Option {
+	return func(l *Logger) {
+		l.alertHook = hook
+	}
+}
+
+// analyze runs the analyzers over a recorded event, recording their
+// findings; the caller must hold the logger's lock.
+func (l *Logger) analyze(ev *Event) {
+	if ev.Actor == internalActor {
+		return
+	}
+
+	for _, a := range l.analyzers {
+		for _, f := range a.Analyze(ev) {
+			level := levelFromString(f.Level)
+			if level == levelUnknown {
+				level = levelWarning
+			}
+
+			finding := &Event{
+				When:       l.now(),
+				Level:      levelStrings[level],
+				Actor:      internalActor,
+				Event:      f.Event,
+				Attributes: f.Attributes,
+			}
+
+			if l.record(finding) != nil {
+				continue
+			}
+
+			if l.alertHook != nil {
+				l.alertHook(finding)
+			}
+			l.segmentRecorded(finding)
+		}
+	}
+}
+
+// slidingWindow counts events in a sliding window of time.
+type slidingWindow struct {
+	times []int64
+}
+
+// add records an event at when, discarding events that have fallen
+// out of the window, and returns the number of events in it.
+func (w *slidingWindow) add(when int64, length time.Duration) int {
+	cutoff := when - int64(length)
+	i := 0
+	for i < len(w.times) && w.times[i] <= cutoff {
+		i++
+	}
+	w.times = append(w.times[i:], when)
+	return len(w.times)
+}
+
+// A RateSpikeDetector reports a WARNING "actor rate spike" when an
+// actor records more than Threshold events within Window.
+type RateSpikeDetector struct {
+	lock      sync.Mutex
+	window    time.Duration
+	threshold int
+	actors    map[string]*slidingWindow
+}
+
+// NewRateSpikeDetector returns a detector for per-actor rate spikes.
+func NewRateSpikeDetector(window time.Duration, threshold int) *RateSpikeDetector {
+	return &RateSpikeDetector{
+		window:    window,
+		threshold: threshold,
+		actors:    map[string]*slidingWindow{},
+	}
+}
+
+// Analyze counts the event against its actor.
+func (d *RateSpikeDetector) Analyze(ev *Event) []Finding {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	w, ok := d.actors[ev.Actor]
+	if !ok {
+		w = &slidingWindow{}
+		d.actors[ev.Actor] = w
+	}
+
+	n := w.add(ev.When, d.window)
+	if n <= d.threshold {
+		return nil
+	}
+
+	// Start counting afresh, so a sustained spike is reported
+	// once per threshold's worth of events.
+	w.times = nil
+	return []Finding{{
+		Level: "WARNING",
+		Event: "actor rate spike",
+		Attributes: []Attribute{
+			{"actor", ev.Actor},
+			{"events", strconv.Itoa(n)},
+			{"window", d.window.String()},
+		},
+	}}
+}
+
+// An ErrorBurstDetector reports an ERROR "error burst" when more than
+// Threshold ERROR or CRITICAL events are recorded within Window.
+type ErrorBurstDetector struct {
+	lock      sync.Mutex
+	window    time.Duration
+	threshold int
+	errors    slidingWindow
+}
+
+// NewErrorBurstDetector returns a detector for bursts of errors.
+func NewErrorBurstDetector(window time.Duration, threshold int) *ErrorBurstDetector {
+	return &ErrorBurstDetector{
+		window:    window,
+		threshold: threshold,
+	}
+}
+
+// Analyze counts the event if it is an error.
+func (d *ErrorBurstDetector) Analyze(ev *Event) []Finding {
+	level := levelFromString(ev.Level)
+	if level != levelError && level != levelCritical {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	n := d.errors.add(ev.When, d.window)
+	if n <= d.threshold {
+		return nil
+	}
+
+	d.errors.times = nil
+	return []Finding{{
+		Level: "ERROR",
+		Event: "error burst",
+		Attributes: []Attribute{
+			{"events", strconv.Itoa(n)},
+			{"window", d.window.String()},
+		},
+	}}
+}
+
+// A NewActorDetector reports a WARNING "new actor" the first time an
+// actor it hasn't seen before records an event.
+type NewActorDetector struct {
+	lock  sync.Mutex
+	known map[string]bool
+}
+
+// NewNewActorDetector returns a detector for new actors, which treats
+// the actors listed in known as already seen.
+func NewNewActorDetector(known ...string) *NewActorDetector {
+	d := &NewActorDetector{known: map[string]bool{}}
+	for _, actor := range known {
+		d.known[actor] = true
+	}
+	return d
+}
+
+// Analyze notes the event's actor.
+func (d *NewActorDetector) Analyze(ev *Event) []Finding {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.known[ev.Actor] {
+		return nil
+	}
+
+	d.known[ev.Actor] = true
+	return []Finding{{
+		Level:      "WARNING",
+		Event:      "new actor",
+		Attributes: []Attribute{{"actor", ev.Actor}},
+	}}
+}
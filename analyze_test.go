@@ -0,0 +1,49 @@
+package auditlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAnalyzers(t *testing.T) {
+	var alerts []string
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, _ := newTestLogger(t,
+		WithClock(NewFixedClock(start, time.Second)),
+		WithAnalyzers(
+			NewRateSpikeDetector(time.Minute, 5),
+			NewErrorBurstDetector(time.Minute, 2),
+			NewNewActorDetector("known"),
+		),
+		WithAlertHook(func(ev *Event) {
+			alerts = append(alerts, ev.Level+" "+ev.Event)
+		}))
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("known", "tick", nil)
+	l.InfoSync("stranger", "tick", nil)
+	for i := 0; i < 5; i++ {
+		l.ErrorSync("known", "failure", nil)
+	}
+
+	expected := []string{
+		"WARNING new actor",
+		"ERROR error burst",
+		"WARNING actor rate spike",
+	}
+
+	if len(alerts) != len(expected) {
+		t.Fatalf("expected alerts %v, have %v", expected, alerts)
+	}
+
+	for i := range expected {
+		if alerts[i] != expected[i] {
+			t.Fatalf("expected alerts %v, have %v", expected, alerts)
+		}
+	}
+
+	if err := l.verifyAuditChain(); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
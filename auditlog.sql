@@ -5,7 +5,9 @@ CREATE TABLE events (
     level       TEXT NOT NULL,
     actor       TEXT NOT NULL,
     event       TEXT NOT NULL,
-    signature   BYTEA NOT NULL
+    signature   BYTEA NOT NULL,
+    payload     BYTEA,
+    digest_version INT2 NOT NULL DEFAULT 0
 );
 
 CREATE TABLE attributes (
@@ -40,3 +42,35 @@ CREATE TABLE errors (
     message     TEXT NOT NULL,
     event       INT8
 );
+
+CREATE TABLE pruned (
+    id          INT8 PRIMARY KEY,
+    end_serial  INT8 NOT NULL,
+    signature   BYTEA NOT NULL
+);
+
+CREATE TABLE signing_keys (
+    first_serial INT8 PRIMARY KEY,
+    public_key   BYTEA NOT NULL
+);
+
+CREATE TABLE checkpoints (
+    serial      INT8 PRIMARY KEY,
+    taken       INT8 NOT NULL,
+    head        TEXT NOT NULL,
+    signature   BYTEA NOT NULL
+);
+
+CREATE TABLE cosignatures (
+    serial      INT8 NOT NULL,
+    witness     TEXT NOT NULL,
+    signature   BYTEA NOT NULL,
+    PRIMARY KEY (serial, witness)
+);
+
+CREATE INDEX attributes_event ON attributes (event, position);
+CREATE INDEX error_events_serial ON error_events (serial);
+CREATE INDEX error_attributes_event ON error_attributes (event, position);
+CREATE INDEX attributes_name_value ON attributes (name, substr(value, 1, 200));
+CREATE INDEX events_level ON events (level, id);
+CREATE INDEX events_actor ON events (actor, id);
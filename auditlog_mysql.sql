@@ -0,0 +1,70 @@
+CREATE TABLE events (
+    id          BIGINT PRIMARY KEY,
+    timestamp   BIGINT NOT NULL,
+    received    BIGINT NOT NULL,
+    level       TEXT NOT NULL,
+    actor       TEXT NOT NULL,
+    event       TEXT NOT NULL,
+    signature   BLOB NOT NULL,
+    payload     LONGBLOB,
+    digest_version SMALLINT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE attributes (
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    value       TEXT NOT NULL,
+    event       BIGINT NOT NULL,
+    position    BIGINT NOT NULL
+);
+
+CREATE TABLE error_events (
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    serial      BIGINT NOT NULL,
+    timestamp   BIGINT NOT NULL,
+    received    BIGINT NOT NULL,
+    level       TEXT NOT NULL,
+    actor       TEXT NOT NULL,
+    event       TEXT NOT NULL
+);
+
+CREATE TABLE error_attributes (
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    value       TEXT NOT NULL,
+    event       BIGINT NOT NULL,
+    position    BIGINT NOT NULL
+);
+
+CREATE TABLE errors (
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    timestamp   BIGINT NOT NULL,
+    message     TEXT NOT NULL,
+    event       BIGINT
+);
+
+CREATE TABLE signing_keys (
+    first_serial BIGINT PRIMARY KEY,
+    public_key   BLOB NOT NULL
+);
+
+CREATE TABLE checkpoints (
+    serial      BIGINT PRIMARY KEY,
+    taken       BIGINT NOT NULL,
+    head        VARCHAR(64) NOT NULL,
+    signature   BLOB NOT NULL
+);
+
+CREATE TABLE cosignatures (
+    serial      BIGINT NOT NULL,
+    witness     VARCHAR(255) NOT NULL,
+    signature   BLOB NOT NULL,
+    PRIMARY KEY (serial, witness)
+);
+
+CREATE INDEX attributes_event ON attributes (event, position);
+CREATE INDEX error_events_serial ON error_events (serial);
+CREATE INDEX error_attributes_event ON error_attributes (event, position);
+CREATE INDEX attributes_name_value ON attributes (name(64), value(191));
+CREATE INDEX events_level ON events (level(16), id);
+CREATE INDEX events_actor ON events (actor(191), id);
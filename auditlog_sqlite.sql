@@ -0,0 +1,70 @@
+CREATE TABLE events (
+    id          INTEGER PRIMARY KEY,
+    timestamp   INTEGER NOT NULL,
+    received    INTEGER NOT NULL,
+    level       TEXT NOT NULL,
+    actor       TEXT NOT NULL,
+    event       TEXT NOT NULL,
+    signature   BLOB NOT NULL,
+    payload     BLOB,
+    digest_version INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE attributes (
+    id          INTEGER PRIMARY KEY,
+    name        TEXT NOT NULL,
+    value       TEXT NOT NULL,
+    event       INTEGER NOT NULL,
+    position    INTEGER NOT NULL
+);
+
+CREATE TABLE error_events (
+    id          INTEGER PRIMARY KEY,
+    serial      INTEGER NOT NULL,
+    timestamp   INTEGER NOT NULL,
+    received    INTEGER NOT NULL,
+    level       TEXT NOT NULL,
+    actor       TEXT NOT NULL,
+    event       TEXT NOT NULL
+);
+
+CREATE TABLE error_attributes (
+    id          INTEGER PRIMARY KEY,
+    name        TEXT NOT NULL,
+    value       TEXT NOT NULL,
+    event       INTEGER NOT NULL,
+    position    INTEGER NOT NULL
+);
+
+CREATE TABLE errors (
+    id          INTEGER PRIMARY KEY,
+    timestamp   INTEGER NOT NULL,
+    message     TEXT NOT NULL,
+    event       INTEGER
+);
+
+CREATE TABLE signing_keys (
+    first_serial INTEGER PRIMARY KEY,
+    public_key   BLOB NOT NULL
+);
+
+CREATE TABLE checkpoints (
+    serial      INTEGER PRIMARY KEY,
+    taken       INTEGER NOT NULL,
+    head        TEXT NOT NULL,
+    signature   BLOB NOT NULL
+);
+
+CREATE TABLE cosignatures (
+    serial      INTEGER NOT NULL,
+    witness     TEXT NOT NULL,
+    signature   BLOB NOT NULL,
+    PRIMARY KEY (serial, witness)
+);
+
+CREATE INDEX attributes_event ON attributes (event, position);
+CREATE INDEX error_events_serial ON error_events (serial);
+CREATE INDEX error_attributes_event ON error_attributes (event, position);
+CREATE INDEX attributes_name_value ON attributes (name, substr(value, 1, 200));
+CREATE INDEX events_level ON events (level, id);
+CREATE INDEX events_actor ON events (actor, id);
@@ -0,0 +1,134 @@
+// Package auditlogtest provides an in-memory audit logger and
+// assertion helpers, so that applications can test that they record
+// the audit events they should without setting up a database.
+package auditlogtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/kisom/auditlog"
+)
+
+// Timeout is how long RequireEvent waits for an asynchronously
+// logged event to be recorded.
+var Timeout = 5 * time.Second
+
+// A Logger is an audit logger backed by memory. The embedded
+// *auditlog.Logger can be handed to the code under test.
+type Logger struct {
+	*auditlog.Logger
+	store *auditlog.MemoryStore
+}
+
+// New returns a started logger with a freshly generated signing
+// key, configured with the given options. Events are not echoed
+// unless the options ask for it. The logger is stopped when the test
+// finishes.
+func New(t testing.TB, opts ...auditlog.Option) *Logger {
+	t.Helper()
+
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("auditlogtest: %v", err)
+	}
+
+	store := auditlog.NewMemoryStore()
+	logger, err := auditlog.NewWithStore(store, signer,
+		append([]auditlog.Option{auditlog.WithoutEcho()}, opts...)...)
+	if err != nil {
+		t.Fatalf("auditlogtest: %v", err)
+	}
+
+	err = logger.Start()
+	if err != nil {
+		t.Fatalf("auditlogtest: %v", err)
+	}
+	t.Cleanup(logger.Stop)
+
+	return &Logger{Logger: logger, store: store}
+}
+
+// Events returns every event recorded so far, in chain order.
+func (l *Logger) Events() []*auditlog.Event {
+	count, _ := l.store.Count()
+	if count == 0 {
+		return nil
+	}
+
+	events, _ := l.store.Events(0, count-1)
+	return events
+}
+
+// Errors returns every error event recorded so far.
+func (l *Logger) Errors() []*auditlog.ErrorEvent {
+	errors, _ := l.store.Errors(0, ^uint64(0))
+	return errors
+}
+
+// Find returns the recorded events with the given actor and event
+// that carry all of the listed attributes.
+func (l *Logger) Find(actor, event string, attrs ...auditlog.Attribute) []*auditlog.Event {
+	var found []*auditlog.Event
+	for _, ev := range l.Events() {
+		if ev.Actor == actor && ev.Event == event && hasAttributes(ev, attrs) {
+			found = append(found, ev)
+		}
+	}
+	return found
+}
+
+func hasAttributes(ev *auditlog.Event, attrs []auditlog.Attribute) bool {
+	for _, want := range attrs {
+		found := false
+		for _, attr := range ev.Attributes {
+			if attr == want {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// RequireEvent fails the test unless an event with the given actor
+// and event carrying all of the listed attributes is recorded within
+// Timeout. The first matching event is returned.
+func (l *Logger) RequireEvent(t testing.TB, actor, event string, attrs ...auditlog.Attribute) *auditlog.Event {
+	t.Helper()
+
+	deadline := time.Now().Add(Timeout)
+	for {
+		if found := l.Find(actor, event, attrs...); len(found) > 0 {
+			return found[0]
+		}
+
+		if time.Now().After(deadline) {
+			break
+		}
+		<-time.After(time.Millisecond)
+	}
+
+	t.Fatalf("auditlogtest: no %s:%s event with attributes %v was recorded", actor, event, attrs)
+	return nil
+}
+
+// RequireNoEvent fails the test if an event with the given actor and
+// event carrying all of the listed attributes has been recorded. As
+// asynchronously logged events may still be in flight, this is only
+// meaningful after the code under test has used the Sync variants or
+// otherwise waited for its events to be recorded.
+func (l *Logger) RequireNoEvent(t testing.TB, actor, event string, attrs ...auditlog.Attribute) {
+	t.Helper()
+
+	if found := l.Find(actor, event, attrs...); len(found) > 0 {
+		t.Fatalf("auditlogtest: unexpected event %s", found[0])
+	}
+}
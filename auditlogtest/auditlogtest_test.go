@@ -0,0 +1,180 @@
+package auditlogtest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kisom/auditlog"
+)
+
+func TestRequireEvent(t *testing.T) {
+	l := New(t)
+
+	user := auditlog.Attribute{Name: "user", Value: "alice"}
+	l.Info("auth", "login", []auditlog.Attribute{user, {Name: "ip", Value: "10.0.0.5"}})
+	l.WarningSync("auth", "logout", []auditlog.Attribute{user})
+
+	ev := l.RequireEvent(t, "auth", "login", user)
+	if ev.Level != "INFO" {
+		t.Fatalf("expected an INFO event, have %s", ev.Level)
+	}
+
+	l.RequireEvent(t, "auth", "logout")
+	l.RequireNoEvent(t, "auth", "login", auditlog.Attribute{Name: "user", Value: "bob"})
+
+	if len(l.Events()) != 2 {
+		t.Fatalf("expected 2 events, have %d", len(l.Events()))
+	}
+}
+
+func TestKeys(t *testing.T) {
+	a := ECDSAKey("alice")
+	if !a.Equal(ECDSAKey("alice")) {
+		t.Fatal("ECDSA key derivation isn't stable")
+	}
+
+	if a.Equal(ECDSAKey("bob")) {
+		t.Fatal("different seeds produced the same ECDSA key")
+	}
+
+	if !Ed25519Key("alice").Equal(Ed25519Key("alice")) {
+		t.Fatal("Ed25519 key derivation isn't stable")
+	}
+}
+
+func TestFailingSigner(t *testing.T) {
+	digest := sha256.Sum256([]byte("event"))
+	signer := NewFailingSigner(ECDSAKey("alice"), 1)
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err != ErrSignatureFailed {
+		t.Fatalf("expected the first signature to fail, have %v", err)
+	}
+
+	if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	signer.Fail(-1)
+	for i := 0; i < 2; i++ {
+		if _, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256); err != ErrSignatureFailed {
+			t.Fatalf("expected every signature to fail, have %v", err)
+		}
+	}
+}
+
+func TestStandardEvents(t *testing.T) {
+	l := New(t)
+
+	l.EmitSync(auditlog.LoginFailure("auth", "jqp", "10.0.0.5", "bad password"))
+	l.Emit(auditlog.DataExport("reports", "admin", "users", "s3://exports", 42))
+
+	ev := l.RequireEvent(t, "auth", auditlog.EventLoginFailure,
+		auditlog.Attribute{Name: auditlog.AttrUser, Value: "jqp"},
+		auditlog.Attribute{Name: auditlog.AttrReason, Value: "bad password"})
+	if ev.Level != "WARNING" {
+		t.Fatalf("expected a WARNING event, have %s", ev.Level)
+	}
+
+	l.RequireEvent(t, "reports", auditlog.EventDataExport,
+		auditlog.Attribute{Name: auditlog.AttrRecords, Value: "42"})
+}
+
+func TestActorRegistry(t *testing.T) {
+	l := New(t, auditlog.WithActors("auth"),
+		auditlog.WithActorPattern(regexp.MustCompile(`^worker-[0-9]+$`)))
+
+	l.InfoSync("auth", "login", nil)
+	l.InfoSync("worker-7", "job", nil)
+	l.InfoSync("auht", "login", nil)
+
+	l.RequireEvent(t, "auth", "login")
+	l.RequireEvent(t, "worker-7", "job")
+	l.RequireNoEvent(t, "auht", "login")
+	l.RequireEvent(t, "auditlog", "unknown actor",
+		auditlog.Attribute{Name: "actor", Value: "auht"})
+
+	l.RegisterActor("auht")
+	l.InfoSync("auht", "login", nil)
+	l.RequireEvent(t, "auht", "login")
+
+	flagged := New(t, auditlog.WithActors("auth"),
+		auditlog.WithActorPolicy(auditlog.ActorFlag))
+	flagged.InfoSync("rogue", "login", nil)
+	flagged.RequireEvent(t, "rogue", "login",
+		auditlog.Attribute{Name: auditlog.AttrUnknownActor, Value: "true"})
+}
+
+func TestMinLevel(t *testing.T) {
+	l := New(t, auditlog.WithMinLevel("info"))
+
+	l.Debug("app", "noise", nil)
+	l.InfoSync("app", "signal", nil)
+	l.RequireEvent(t, "app", "signal")
+	l.RequireNoEvent(t, "app", "noise")
+
+	err := l.SetMinLevel("error")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.RequireEvent(t, "auditlog", "minimum level change",
+		auditlog.Attribute{Name: "old", Value: "INFO"},
+		auditlog.Attribute{Name: "new", Value: "ERROR"})
+
+	l.WarningSync("app", "dropped", nil)
+	l.ErrorSync("app", "kept", nil)
+	l.RequireNoEvent(t, "app", "dropped")
+	l.RequireEvent(t, "app", "kept")
+
+	if err = l.SetMinLevel("loud"); err == nil {
+		t.Fatal("expected an unknown level to be rejected")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	l := New(t, auditlog.WithSampling(auditlog.SamplingPolicy{
+		Interval:   time.Hour,
+		First:      2,
+		Thereafter: 5,
+	}))
+
+	for i := 0; i < 12; i++ {
+		l.InfoSync("app", "heartbeat", nil)
+		l.WarningSync("app", "disk", nil)
+	}
+
+	if n := len(l.Find("app", "heartbeat")); n != 4 {
+		t.Fatalf("expected 4 sampled heartbeats, have %d", n)
+	}
+
+	if n := len(l.Find("app", "disk")); n != 12 {
+		t.Fatalf("warnings must not be sampled, but only %d were recorded", n)
+	}
+
+	// The summary is recorded when the interval ends or the
+	// logger is stopped.
+	l.Stop()
+	l.RequireEvent(t, "auditlog", "sampling summary",
+		auditlog.Attribute{Name: "actor", Value: "app"},
+		auditlog.Attribute{Name: "event", Value: "heartbeat"},
+		auditlog.Attribute{Name: "dropped", Value: "8"})
+}
+
+func TestTee(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := New(t, auditlog.WithSlog(slog.New(slog.NewTextHandler(buf, nil))))
+
+	l.WarningSync("auth", "login failure", []auditlog.Attribute{{Name: "user", Value: "jqp"}})
+
+	line := buf.String()
+	if !strings.Contains(line, `level=WARN msg="login failure"`) ||
+		!strings.Contains(line, "actor=auth") ||
+		!strings.Contains(line, "attributes.user=jqp") {
+		t.Fatalf("bad slog output: %s", line)
+	}
+}
@@ -0,0 +1,116 @@
+package auditlogtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/kisom/auditlog"
+)
+
+// GoldenEpoch is the timestamp of the first event in a golden chain.
+var GoldenEpoch = time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+
+// GoldenStep is the interval between consecutive events in a golden
+// chain. Each event is received half a step after it was logged.
+const GoldenStep = time.Second
+
+var goldenLevels = []string{"INFO", "WARNING", "DEBUG", "ERROR", "CRITICAL"}
+
+// GoldenChain builds a chain of n events using a fixed clock and
+// deterministic (RFC 6979) signatures, so that the same signer
+// always produces byte-for-byte identical chains.
+func GoldenChain(signer *ecdsa.PrivateKey, n int) ([]*auditlog.Event, error) {
+	var chain []*auditlog.Event
+	var prev []byte
+
+	for i := 0; i < n; i++ {
+		when := GoldenEpoch.Add(time.Duration(i) * GoldenStep)
+		ev := &auditlog.Event{
+			Serial:   uint64(i),
+			When:     when.UnixNano(),
+			Received: when.Add(GoldenStep / 2).UnixNano(),
+			Level:    goldenLevels[i%len(goldenLevels)],
+			Actor:    fmt.Sprintf("actor%d", i%3),
+			Event:    fmt.Sprintf("event%d", i),
+		}
+
+		for j := 0; j < i%4; j++ {
+			ev.Attributes = append(ev.Attributes, auditlog.Attribute{
+				Name:  fmt.Sprintf("attr%d", j),
+				Value: fmt.Sprintf("value%d", i*j),
+			})
+		}
+
+		err := ev.Sign(signer, prev, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		prev = ev.Signature
+		chain = append(chain, ev)
+	}
+
+	return chain, nil
+}
+
+// GoldenCertification returns a JSON-encoded certification of a
+// golden chain of n events. The certification also carries a single
+// error event recording a signature failure for the serial that
+// would follow the chain.
+func GoldenCertification(signer *ecdsa.PrivateKey, n int) ([]byte, error) {
+	chain, err := GoldenChain(signer, n)
+	if err != nil {
+		return nil, err
+	}
+
+	end := GoldenEpoch.Add(time.Duration(n) * GoldenStep)
+	certification := auditlog.Certification{
+		When:  end.Add(GoldenStep).UnixNano(),
+		Chain: chain,
+		Errors: []*auditlog.ErrorEvent{
+			{
+				When:    end.Add(GoldenStep / 2).UnixNano(),
+				Message: "signature: golden failure",
+				Event: &auditlog.Event{
+					Serial:   uint64(n),
+					When:     end.UnixNano(),
+					Received: end.Add(GoldenStep / 4).UnixNano(),
+					Level:    "INFO",
+					Actor:    "auditlogtest",
+					Event:    "golden failure",
+				},
+			},
+		},
+	}
+
+	return json.Marshal(certification)
+}
+
+// WriteGolden writes a golden certification of n events to
+// certified.json and the signer's public key, in the PEM format
+// expected by the verification tools, to logger.pub in dir.
+func WriteGolden(dir string, signer *ecdsa.PrivateKey, n int) error {
+	cert, err := GoldenCertification(signer, n)
+	if err != nil {
+		return err
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&signer.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	pub = pem.EncodeToMemory(&pem.Block{Type: "EC PUBLIC KEY", Bytes: pub})
+	err = ioutil.WriteFile(filepath.Join(dir, "logger.pub"), pub, 0644)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, "certified.json"), cert, 0644)
+}
@@ -0,0 +1,56 @@
+package auditlogtest
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/kisom/auditlog"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden certification")
+
+const (
+	goldenDir    = "testdata"
+	goldenEvents = 16
+)
+
+func TestGoldenCertification(t *testing.T) {
+	signer, err := auditlog.LoadSigner(filepath.Join(goldenDir, "golden_signer.pem"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if *update {
+		err = WriteGolden(goldenDir, signer, goldenEvents)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(filepath.Join(goldenDir, "certified.json"))
+	if err != nil {
+		t.Fatalf("%v (run go test -update to generate the golden files)", err)
+	}
+
+	cert, err := GoldenCertification(signer, goldenEvents)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !bytes.Equal(cert, expected) {
+		t.Fatal("golden certification has changed")
+	}
+
+	cl, ok := auditlog.VerifyCertification(expected, &signer.PublicKey)
+	if !ok {
+		t.Fatal("failed to verify golden certification")
+	}
+
+	if len(cl.Chain) != goldenEvents || len(cl.Errors) != 1 {
+		t.Fatalf("expected %d events and 1 error, have %d and %d",
+			goldenEvents, len(cl.Chain), len(cl.Errors))
+	}
+}
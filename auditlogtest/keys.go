@@ -0,0 +1,49 @@
+package auditlogtest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"io"
+	"testing"
+
+	"github.com/kisom/auditlog"
+	"github.com/kisom/auditlog/internal/testkeys"
+)
+
+// ECDSAKey derives a P-256 signing key from seed. The same seed
+// always produces the same key, so tests can use stable keys without
+// keeping key files around. These keys must never be used outside of
+// tests.
+func ECDSAKey(seed string) *ecdsa.PrivateKey {
+	return testkeys.ECDSAKey(seed)
+}
+
+// Ed25519Key derives an Ed25519 signing key from seed, in the same
+// manner as ECDSAKey.
+func Ed25519Key(seed string) ed25519.PrivateKey {
+	return testkeys.Ed25519Key(seed)
+}
+
+// A FailingSigner fails the signatures it has been told to fail, and
+// otherwise signs with the signer it wraps. Tests that exercise
+// signature failures give one to auditlog.NewWithSigner.
+type FailingSigner = testkeys.FailingSigner
+
+// ErrSignatureFailed is returned by the signatures a FailingSigner
+// fails.
+var ErrSignatureFailed = testkeys.ErrSignatureFailed
+
+// NewFailingSigner returns a signer that fails the next n signatures,
+// or every signature if n is negative, and otherwise signs with
+// signer.
+func NewFailingSigner(signer crypto.Signer, n int) *FailingSigner {
+	return testkeys.NewFailingSigner(signer, n)
+}
+
+// SwapRand replaces auditlog's source of randomness with r until the
+// test finishes; see auditlog.SetRand for what the source is used for.
+// Tests that call it must not run in parallel.
+func SwapRand(t testing.TB, r io.Reader) {
+	t.Cleanup(auditlog.SetRand(r))
+}
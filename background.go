@@ -0,0 +1,142 @@
+package auditlog
+
+import (
+	"bytes"
+	"log"
+)
+
+// EventVerificationFailure is the CRITICAL event recorded when the
+// chain fails verification in the background; see
+// WithBackgroundVerification.
+const EventVerificationFailure = "verification failure"
+
+// A backgroundVerification is a verification of the chain deferred
+// until the logger is running. The events from next up to end remain
+// to be verified, where prev is the signature of the event preceding
+// next, and head is the signature the logger chained its first event
+// onto, which the last event verified must carry. Only the verifying
+// task uses next and prev; pending is guarded by the logger's lock.
+type backgroundVerification struct {
+	done  func(error)
+	store Store
+	keys  KeyManifest
+
+	next, end  uint64
+	prev, head []byte
+	seals      *sealCheck
+	pending    bool
+}
+
+// WithBackgroundVerification creates the logger without verifying the
+// existing chain, which is verified in the background once the logger
+// is started instead, so that a service with a long chain can log
+// events at once. Verification covers what it would have when the
+// logger was created: the chain from its beginning, or from a trusted
+// head or the latest signed checkpoint.
+//
+// Progress is reported to the function set with WithVerifyProgress.
+// Once the chain has been verified, done, if it isn't nil, is called
+// with nil; if the chain fails verification, or can't be read, a
+// CRITICAL "verification failure" event is recorded and done is called
+// with the error. Events logged in the meantime are chained onto the
+// unverified chain, so a failure taints them too. Stopping the logger
+// pauses verification, which resumes when the logger is started again.
+// Neither done nor the progress function may stop the logger, and the
+// chain can't be rotated until verification has finished.
+func WithBackgroundVerification(done func(err error)) Option {
+	return func(l *Logger) {
+		l.background = &backgroundVerification{done: done}
+		l.addTask(func(l *Logger, stop <-chan struct{}) {
+			l.verifyBackground(stop)
+		})
+	}
+}
+
+// deferVerification records where background verification of the
+// chain starts and ends, in place of verifying it as the logger is
+// created.
+func (l *Logger) deferVerification() error {
+	start, prev, err := l.verifyStart()
+	if err != nil {
+		return err
+	}
+
+	bg := l.background
+	bg.store = l.store
+	bg.keys = l.keys.withHMAC(l.hmacKey)
+	bg.next, bg.end = start, l.counter
+	bg.seals = newSealCheck(start)
+	bg.prev, bg.head = prev, l.lastSignature
+	bg.pending = true
+	return nil
+}
+
+// verifyBackground verifies the chain deferred by
+// WithBackgroundVerification, a batch at a time, until it is done or
+// stop is closed.
+func (l *Logger) verifyBackground(stop <-chan struct{}) {
+	bg := l.background
+
+	l.lock.Lock()
+	pending := bg.pending
+	l.lock.Unlock()
+	if !pending {
+		return
+	}
+
+	var total uint64
+	if bg.next < bg.end {
+		total = bg.end - bg.next
+	}
+	meter := newProgressMeter(l.verifyProgress, total)
+
+	for bg.next < bg.end {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		last := bg.next + backupBatch
+		if last > bg.end {
+			last = bg.end
+		}
+
+		prev, err := l.verifyRange(bg.store, bg.keys, bg.next, last, bg.prev, bg.seals, meter)
+		if err != nil {
+			l.finishBackground(err)
+			return
+		}
+		bg.next, bg.prev = last, prev
+	}
+
+	err := l.checkUnsealed(bg.seals)
+	if err == nil && !bytes.Equal(bg.prev, bg.head) {
+		log.Println("Signature mismatch on event", bg.end-1)
+		err = errAuditFailure
+	}
+	l.finishBackground(err)
+}
+
+// finishBackground reports the outcome of background verification.
+func (l *Logger) finishBackground(err error) {
+	l.lock.Lock()
+	l.background.pending = false
+	l.lock.Unlock()
+
+	if err != nil {
+		l.logInternal(levelCritical, EventVerificationFailure, []Attribute{
+			{"error", err.Error()},
+		})
+	}
+
+	if l.background.done != nil {
+		l.background.done(err)
+	}
+}
+
+// verifying reports whether the chain is still being verified in the
+// background; the caller must hold the logger's lock.
+func (l *Logger) verifying() bool {
+	return l.background != nil && l.background.pending
+}
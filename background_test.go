@@ -0,0 +1,57 @@
+package auditlog
+
+import "testing"
+
+func TestBackgroundVerification(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, store := newTestLogger(t)
+	l.Start()
+	for i := 0; i < 2*backupBatch+1; i++ {
+		l.Info("background_test", "event", nil)
+	}
+	l.InfoSync("background_test", "event", nil)
+	l.Stop()
+
+	// Events can be logged while the chain is verified.
+	done := make(chan error, 1)
+	var verified uint64
+	l, err := NewWithStore(store, signer, WithoutEcho(),
+		WithBackgroundVerification(func(err error) { done <- err }),
+		WithVerifyProgress(func(p VerifyProgress) { verified = p.Verified }))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	count := l.Count()
+
+	l.Start()
+	l.InfoSync("background_test", "started", nil)
+	if err = <-done; err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	if verified != count {
+		t.Fatalf("expected %d events to be verified, have %d", count, verified)
+	}
+
+	// A chain that fails verification doesn't keep the logger from
+	// starting, but the failure is reported and recorded.
+	store.events[1].Actor = "forged"
+	l, err = NewWithStore(store, signer, WithoutEcho(),
+		WithBackgroundVerification(func(err error) { done <- err }))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	l.Start()
+	if err = <-done; err != errAuditFailure {
+		t.Fatalf("expected an audit failure, have %v", err)
+	}
+	l.Stop()
+
+	ev := findEvent(t, store, EventVerificationFailure)
+	if ev.Level != levelStrings[levelCritical] {
+		t.Fatalf("expected a CRITICAL event, have %s", ev.Level)
+	}
+}
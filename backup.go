@@ -0,0 +1,353 @@
+package auditlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Events recording backups of the chain and restores from them.
+const (
+	EventBackup  = "chain backed up"
+	EventRestore = "chain restored"
+)
+
+// ErrInvalidBackup is returned by Restore when a snapshot fails
+// verification.
+var ErrInvalidBackup = errors.New("auditlog: backup failed verification")
+
+// backupVersion is the version of the snapshot format written by
+// Backup.
+const backupVersion = 1
+
+// backupBatch is the number of events read from the store at a time.
+const backupBatch = 1024
+
+// A snapshot is a sequence of JSON records, one per line: a header,
+// the events in serial order, the error events, and a trailer. The
+// trailer carries the SHA-256 digest of every preceding line and the
+// logger's signature on it, so a truncated or spliced snapshot is
+// detected even though each event is signed on its own.
+type backupRecord struct {
+	Header  *backupHeader  `json:"header,omitempty"`
+	Event   *Event         `json:"event,omitempty"`
+	Error   *ErrorEvent    `json:"error,omitempty"`
+	Trailer *backupTrailer `json:"trailer,omitempty"`
+}
+
+// A backupHeader describes the chain in a snapshot: the signer's
+// DER-encoded public key, and the serial numbers of the first event
+// and of the event following the last. Previous is the signature
+// preceding the first event, if the chain has been pruned. Keys is
+// the chain's key history, ending with the signer's key; snapshots
+// written before key histories were kept don't have one.
+type backupHeader struct {
+	Version  int         `json:"version"`
+	When     int64       `json:"when"`
+	Public   []byte      `json:"public"`
+	Start    uint64      `json:"start"`
+	End      uint64      `json:"end"`
+	Previous []byte      `json:"previous,omitempty"`
+	Keys     []KeyRecord `json:"keys,omitempty"`
+}
+
+type backupTrailer struct {
+	Digest    []byte `json:"digest"`
+	Signature []byte `json:"signature"`
+}
+
+// Backup writes a signed snapshot of the chain to w. The snapshot is
+// independent of the store, so a chain kept in one backend may be
+// restored into another. Events logged while the backup is running
+// aren't included, and the chain can't be pruned until it is done. A
+// signed "chain backed up" event carrying the snapshot's digest is
+// recorded once it has been written, naming the accessor attached
+// to ctx with ContextWithAccessor.
+func (l *Logger) Backup(ctx context.Context, w io.Writer) error {
+	accessor := AccessorFromContext(ctx)
+	if l.requireAccessor && accessor == "" {
+		return ErrNoAccessor
+	}
+
+	l.pruneLock.Lock()
+	defer l.pruneLock.Unlock()
+
+	l.lock.Lock()
+	if l.closed {
+		l.lock.Unlock()
+		return errors.New("auditlog: logger has been stopped")
+	}
+
+	// The snapshot is signed with the key that signed its last
+	// event, even if the key is rotated while it is written.
+	store, signer := l.store, l.signer
+	public, err := x509.MarshalPKIXPublicKey(l.public)
+	if err != nil {
+		l.lock.Unlock()
+		return err
+	}
+
+	keys, err := l.keys.records()
+	if err != nil {
+		l.lock.Unlock()
+		return err
+	}
+
+	start, prev, err := l.chainStart()
+	if err != nil {
+		l.lock.Unlock()
+		return err
+	}
+
+	end, err := store.Count()
+	l.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	enc := json.NewEncoder(io.MultiWriter(w, h))
+	err = enc.Encode(backupRecord{Header: &backupHeader{
+		Version:  backupVersion,
+		When:     l.now(),
+		Public:   public,
+		Start:    start,
+		End:      end,
+		Previous: prev,
+		Keys:     keys,
+	}})
+	if err != nil {
+		return err
+	}
+
+	for serial := start; serial < end; serial += backupBatch {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		last := serial + backupBatch - 1
+		if last >= end {
+			last = end - 1
+		}
+
+		events, err := l.backupEvents(store, serial, last)
+		if err != nil {
+			return err
+		}
+
+		for _, ev := range events {
+			if err = enc.Encode(backupRecord{Event: ev}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if end > start {
+		errs, err := store.Errors(start, end-1)
+		if err != nil {
+			return err
+		}
+
+		for _, errEv := range errs {
+			if err = enc.Encode(backupRecord{Error: errEv}); err != nil {
+				return err
+			}
+		}
+	}
+
+	digest := h.Sum(nil)
+	sig, err := signer.Sign(prng, digest, crypto.SHA256)
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(w).Encode(backupRecord{Trailer: &backupTrailer{
+		Digest:    digest,
+		Signature: sig,
+	}})
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.closed {
+		return nil
+	}
+
+	return l.record(&Event{
+		When:  l.now(),
+		Level: levelStrings[levelInfo],
+		Actor: internalActor,
+		Event: EventBackup,
+		Attributes: []Attribute{
+			{"start", strconv.FormatUint(start, 10)},
+			{"end", strconv.FormatUint(end, 10)},
+			{"digest", hex.EncodeToString(digest)},
+			{"accessor", accessor},
+		},
+	})
+}
+
+// backupEvents reads a batch of events for a backup, failing if the
+// chain has been rotated since the backup began.
+func (l *Logger) backupEvents(store Store, start, end uint64) ([]*Event, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.store != store {
+		return nil, errors.New("auditlog: chain rotated during backup")
+	}
+	return store.Events(start, end)
+}
+
+// Restore loads a snapshot written by Backup into the logger's store,
+// which must be empty, verifying it as it is read: the snapshot must
+// have been signed by the logger's key, every event must verify with
+// the key history recorded in the snapshot and follow the one before
+// it, and the trailer must match the rest of the snapshot. The logger must not be running. Snapshots of pruned
+// chains can't be restored, as the store would have to begin partway
+// through the chain.
+//
+// If verification fails part of the way through, the store keeps
+// the verified events read up to that point, and ErrInvalidBackup is
+// returned; the store should be discarded. Once the snapshot has
+// been restored, a signed "chain restored" event carrying its digest
+// is recorded.
+func (l *Logger) Restore(ctx context.Context, r io.Reader) error {
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	if l.running {
+		return errors.New("auditlog: logger is running")
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.closed {
+		return errors.New("auditlog: logger has been stopped")
+	}
+
+	if l.counter != 0 {
+		return errors.New("auditlog: cannot restore into a store that already holds events")
+	}
+
+	public, err := x509.MarshalPKIXPublicKey(l.public)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	in := bufio.NewReader(r)
+	var header *backupHeader
+	keys := singleKey(l.public).withHMAC(l.hmacKey)
+	seals := newSealCheck(0)
+	for {
+		line, err := in.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return ErrInvalidBackup
+		} else if err != nil && err != io.EOF {
+			return err
+		}
+
+		var rec backupRecord
+		if json.Unmarshal(line, &rec) != nil {
+			return ErrInvalidBackup
+		}
+
+		switch {
+		case header == nil:
+			header = rec.Header
+			if header == nil || header.Version != backupVersion || !bytes.Equal(header.Public, public) {
+				return ErrInvalidBackup
+			}
+
+			if header.Start != 0 {
+				return errors.New("auditlog: cannot restore a pruned chain")
+			}
+
+			if len(header.Keys) > 0 {
+				keys, err = manifestFrom(header.Keys)
+				if err != nil || !keys[len(keys)-1].Public.Equal(l.public) {
+					return ErrInvalidBackup
+				}
+				keys = keys.withHMAC(l.hmacKey)
+
+				// A history recorded when the logger was
+				// created only holds the logger's key, and
+				// can't be replaced once the logger starts.
+				if !l.keysPending && len(keys) > 1 {
+					return errors.New("auditlog: the store already records a key history")
+				}
+			}
+		case rec.Event != nil:
+			if l.counter%backupBatch == 0 {
+				if err = ctx.Err(); err != nil {
+					return err
+				}
+			}
+
+			ev := rec.Event
+			if ev.Serial != l.counter || !keys.verify(ev, l.lastSignature) || !seals.add(ev) {
+				return ErrInvalidBackup
+			}
+
+			if err = l.store.StoreEvent(ev); err != nil {
+				return err
+			}
+			l.counter++
+			l.lastSignature = ev.Signature
+			l.lastReceived = ev.Received
+		case rec.Error != nil:
+			if rec.Error.Event == nil {
+				return ErrInvalidBackup
+			}
+
+			if err = l.store.StoreError(rec.Error); err != nil {
+				return err
+			}
+		case rec.Trailer != nil:
+			digest := h.Sum(nil)
+			if !bytes.Equal(digest, rec.Trailer.Digest) || l.counter != header.End ||
+				!ecdsa.VerifyASN1(l.public, digest, rec.Trailer.Signature) ||
+				l.checkUnsealed(seals) != nil {
+				return ErrInvalidBackup
+			}
+
+			l.segmentEvents = l.counter
+			l.keys = keys
+			if err = l.storeKeys(); err != nil {
+				return err
+			}
+
+			if err = l.recoverBatch(); err != nil {
+				return err
+			}
+
+			return l.record(&Event{
+				When:  l.now(),
+				Level: levelStrings[levelInfo],
+				Actor: internalActor,
+				Event: EventRestore,
+				Attributes: []Attribute{
+					{"events", strconv.FormatUint(header.End, 10)},
+					{"digest", hex.EncodeToString(digest)},
+				},
+			})
+		default:
+			return ErrInvalidBackup
+		}
+		h.Write(line)
+	}
+}
@@ -0,0 +1,73 @@
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, _ := newTestLogger(t)
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 5; i++ {
+		l.InfoSync("backup_test", "event", []Attribute{{"user", "jqp"}})
+	}
+
+	var snapshot bytes.Buffer
+	err := l.Backup(context.Background(), &snapshot)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if l.Count() != 6 {
+		t.Fatalf("expected a backup event to be recorded, have %d events", l.Count())
+	}
+
+	restore := func(in []byte, key *ecdsa.PrivateKey) (*Logger, error) {
+		r, err := NewWithStore(NewMemoryStore(), key, WithoutEcho())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return r, r.Restore(context.Background(), bytes.NewReader(in))
+	}
+
+	r, err := restore(snapshot.Bytes(), signer)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// The five events in the snapshot, and the restore event.
+	if r.Count() != 6 {
+		t.Fatalf("expected 6 events, have %d", r.Count())
+	}
+
+	if err = r.verifyAuditChain(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tampered := bytes.Replace(snapshot.Bytes(), []byte("jqp"), []byte("jqq"), 1)
+	if _, err = restore(tampered, signer); err != ErrInvalidBackup {
+		t.Fatalf("expected a tampered snapshot to fail verification, have %v", err)
+	}
+
+	lines := bytes.SplitAfter(snapshot.Bytes(), []byte("\n"))
+	truncated := bytes.Join(lines[:len(lines)-3], nil)
+	if _, err = restore(truncated, signer); err != ErrInvalidBackup {
+		t.Fatalf("expected a truncated snapshot to fail verification, have %v", err)
+	}
+
+	other := testKey(t, "other")
+
+	if _, err = restore(snapshot.Bytes(), other); err != ErrInvalidBackup {
+		t.Fatalf("expected a snapshot signed by another key to be rejected, have %v", err)
+	}
+
+	if err = r.Restore(context.Background(), bytes.NewReader(snapshot.Bytes())); err == nil {
+		t.Fatal("expected restoring into a non-empty store to fail")
+	}
+}
@@ -0,0 +1,292 @@
+package auditlog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"time"
+)
+
+// EventBatchSigned is recorded in batch-signing mode to sign the
+// events recorded since the previous signature. Its attributes name
+// the first and last events in the batch and the hex-encoded Merkle
+// root of their links; if the batch includes events left unsigned
+// when a previous logger stopped without signing them, "recovered"
+// counts them.
+const EventBatchSigned = "batch signed"
+
+// A BatchPolicy controls batch signing: a batch is signed once it
+// holds MaxEvents events, and otherwise every Interval, if events are
+// waiting. A zero field disables that trigger.
+type BatchPolicy struct {
+	MaxEvents int
+	Interval  time.Duration
+}
+
+// WithBatchSigning trades per-event signatures for throughput: events
+// are chained by hash alone, and an ECDSA signature is produced once
+// per batch on a "batch signed" event, which covers the Merkle root
+// of the batch and, through the chain, every event before it. Any
+// batch still open is signed when the logger stops.
+//
+// Until its batch is signed, an event can be verified against the
+// rest of the chain but not authenticated. Verification requires
+// every run of hash-linked events to be closed by the batch signature
+// covering it; a logger refuses to start on a chain ending with an
+// open batch unless it is itself batch signing, in which case it
+// signs the batch with a "recovered" count. An attacker with write
+// access to the store could append hash-linked events of their own
+// while such a logger is stopped, and the count is what reveals them.
+// Certifications are extended to the batch signature covering their
+// last event.
+func WithBatchSigning(policy BatchPolicy) Option {
+	return func(l *Logger) {
+		if policy.MaxEvents <= 0 && policy.Interval <= 0 {
+			return
+		}
+
+		l.batch = &batch{max: policy.MaxEvents}
+		if policy.Interval > 0 {
+			l.addTask(every(policy.Interval, false, func(l *Logger) {
+				l.lock.Lock()
+				defer l.lock.Unlock()
+
+				if !l.closed {
+					l.sealBatch()
+				}
+			}))
+		}
+	}
+}
+
+// A batch holds the links of the events recorded since the last
+// signed event.
+type batch struct {
+	max       int
+	start     uint64
+	leaves    [][]byte
+	recovered int
+}
+
+// add notes that ev has been recorded; a signed event closes the
+// batch.
+func (b *batch) add(ev *Event) {
+	if ev.Signed() {
+		b.leaves, b.recovered = nil, 0
+		return
+	}
+
+	if len(b.leaves) == 0 {
+		b.start = ev.Serial
+	}
+	b.leaves = append(b.leaves, merkleLeaf(ev.Signature))
+}
+
+func (b *batch) full() bool {
+	return b.max > 0 && len(b.leaves) >= b.max
+}
+
+// sealBatch signs the open batch, if there is one; the caller must
+// hold the lock.
+func (l *Logger) sealBatch() {
+	b := l.batch
+	if b == nil || len(b.leaves) == 0 {
+		return
+	}
+
+	attrs := []Attribute{
+		{"start", strconv.FormatUint(b.start, 10)},
+		{"end", strconv.FormatUint(b.start+uint64(len(b.leaves))-1, 10)},
+		{"root", hex.EncodeToString(merkleRoot(b.leaves))},
+	}
+	if b.recovered > 0 {
+		attrs = append(attrs, Attribute{"recovered", strconv.Itoa(b.recovered)})
+	}
+
+	err := l.record(&Event{
+		When:       l.now(),
+		Level:      levelStrings[levelInfo],
+		Actor:      internalActor,
+		Event:      EventBatchSigned,
+		Attributes: attrs,
+		sign:       true,
+	})
+	if err != nil {
+		log.Printf("auditlog: failed to sign batch: %v", err)
+	}
+}
+
+// recoverBatch reopens the batch of hash-linked events at the end of
+// the chain, left by a logger that stopped before signing them, so
+// that the next batch signature covers them. The caller must hold the
+// lock, or be initialising the logger.
+func (l *Logger) recoverBatch() error {
+	if l.batch == nil {
+		return nil
+	}
+	l.batch.leaves, l.batch.recovered = nil, 0
+
+	start, _, err := l.chainStart()
+	if err != nil {
+		return err
+	}
+
+	var tail []*Event
+	for serial := l.counter; serial > start; serial-- {
+		ev, err := l.store.Event(serial - 1)
+		if err != nil {
+			return err
+		}
+
+		if ev.Signed() {
+			break
+		}
+		tail = append(tail, ev)
+	}
+
+	for i := len(tail) - 1; i >= 0; i-- {
+		l.batch.add(tail[i])
+	}
+	l.batch.recovered = len(tail)
+	return nil
+}
+
+// coveringSignature returns the serial number of the first signed
+// event at or after serial, or serial itself if there is none.
+func (l *Logger) coveringSignature(serial uint64) (uint64, error) {
+	for next := serial; next < l.counter; next++ {
+		ev, err := l.store.Event(next)
+		if err != nil {
+			return 0, err
+		}
+
+		if ev.Signed() {
+			return next, nil
+		}
+	}
+	return serial, nil
+}
+
+// VerifyBatch checks that seal is a "batch signed" event whose Merkle
+// root matches events, which must be the events in its batch, in
+// order. The signatures of the events themselves must be verified
+// separately.
+func VerifyBatch(seal *Event, events []*Event) bool {
+	if seal.Actor != internalActor || seal.Event != EventBatchSigned || len(events) == 0 {
+		return false
+	}
+
+	start, _ := seal.attr("start")
+	end, _ := seal.attr("end")
+	last := events[len(events)-1].Serial
+	if start != strconv.FormatUint(events[0].Serial, 10) ||
+		end != strconv.FormatUint(last, 10) || seal.Serial != last+1 {
+		return false
+	}
+
+	leaves := make([][]byte, len(events))
+	for i, ev := range events {
+		if ev.Signed() || (i > 0 && ev.Serial != events[i-1].Serial+1) {
+			return false
+		}
+		leaves[i] = merkleLeaf(ev.Signature)
+	}
+
+	root, _ := seal.attr("root")
+	want, err := hex.DecodeString(root)
+	return err == nil && bytes.Equal(want, merkleRoot(leaves))
+}
+
+// A sealCheck follows the hash-linked events of a chain as it is
+// verified. Each run of them must be closed by the "batch signed"
+// event that covers it: the next event, naming the run and the Merkle
+// root of its links. Only the run at the start of the events checked
+// may have begun before them, in which case its root can't be checked.
+// A run left open at the end of the chain is reported by open; only a
+// logger in batch-signing mode may accept one, as the batch it
+// recovers at startup.
+type sealCheck struct {
+	first  uint64
+	start  uint64
+	leaves [][]byte
+}
+
+// newSealCheck returns a sealCheck for the events from serial first.
+func newSealCheck(first uint64) *sealCheck {
+	return &sealCheck{first: first}
+}
+
+// add checks the next event in the chain, whose signature or link has
+// already been verified, returning false if it breaks a run of
+// hash-linked events or fails to close one.
+func (sc *sealCheck) add(ev *Event) bool {
+	if !ev.Signed() {
+		if len(sc.leaves) == 0 {
+			sc.start = ev.Serial
+		} else if ev.Serial != sc.start+uint64(len(sc.leaves)) {
+			return false
+		}
+		sc.leaves = append(sc.leaves, merkleLeaf(ev.Signature))
+		return true
+	}
+
+	if len(sc.leaves) == 0 {
+		return true
+	}
+
+	ok := sc.seals(ev)
+	sc.leaves = nil
+	return ok
+}
+
+// seals reports whether ev is the batch signature closing the open
+// run.
+func (sc *sealCheck) seals(ev *Event) bool {
+	end := sc.start + uint64(len(sc.leaves)) - 1
+	if ev.Actor != internalActor || ev.Event != EventBatchSigned || ev.Serial != end+1 {
+		return false
+	}
+
+	if attr, _ := ev.attr("end"); attr != strconv.FormatUint(end, 10) {
+		return false
+	}
+
+	attr, _ := ev.attr("start")
+	start, err := strconv.ParseUint(attr, 10, 64)
+	if err != nil || start > sc.start {
+		return false
+	}
+
+	if start < sc.start {
+		// The batch began before the events checked.
+		return sc.start == sc.first
+	}
+
+	root, _ := ev.attr("root")
+	want, err := hex.DecodeString(root)
+	return err == nil && bytes.Equal(want, merkleRoot(sc.leaves))
+}
+
+// open reports whether the events checked end with a run of
+// hash-linked events that no batch signature has closed.
+func (sc *sealCheck) open() bool {
+	return len(sc.leaves) > 0
+}
+
+// sealed reports whether every run of hash-linked events in chain is
+// closed by its batch signature. A run at the end of the chain may be
+// left open only if open is set.
+func sealed(chain []*Event, open bool) bool {
+	if len(chain) == 0 {
+		return true
+	}
+
+	sc := newSealCheck(chain[0].Serial)
+	for _, ev := range chain {
+		if !sc.add(ev) {
+			return false
+		}
+	}
+	return open || !sc.open()
+}
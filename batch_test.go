@@ -0,0 +1,190 @@
+package auditlog
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBatchSigning(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, store := newTestLogger(t,
+		WithBatchSigning(BatchPolicy{MaxEvents: 4}))
+	l.Start()
+
+	for i := 0; i < 10; i++ {
+		l.InfoSync("batch_test", "event", nil)
+	}
+
+	// Events 0-3 and 5-8 are hash-linked, and signed by events 4
+	// and 9; event 10 waits for the next batch.
+	events, err := store.Events(0, 10)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, ev := range events {
+		signed := ev.Serial == 4 || ev.Serial == 9
+		if ev.Signed() != signed {
+			t.Fatalf("event %d: expected signed=%v", ev.Serial, signed)
+		}
+	}
+
+	if !VerifyBatch(events[4], events[0:4]) || !VerifyBatch(events[9], events[5:9]) {
+		t.Fatal("batch roots failed to verify")
+	}
+
+	if VerifyBatch(events[9], events[4:9]) {
+		t.Fatal("a batch verified with the wrong events")
+	}
+
+	// A certification is extended to the batch signature covering
+	// its last event.
+	cert, err := l.Certify(0, 6)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cl, ok := VerifyCertification(cert, &signer.PublicKey)
+	if !ok {
+		t.Fatal("certification failed to verify")
+	}
+
+	if last := cl.Chain[len(cl.Chain)-1]; last.Serial != 9 {
+		t.Fatalf("expected the certification to end at event 9, have %d", last.Serial)
+	}
+
+	// A certification ending in unsigned events is rejected.
+	cl.Chain = cl.Chain[:8]
+	truncated, err := json.Marshal(cl)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, ok = VerifyCertification(truncated, &signer.PublicKey); ok {
+		t.Fatal("a certification ending in unsigned events verified")
+	}
+	l.Stop()
+
+	count, err := store.Count()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	last, err := store.Event(count - 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !last.Signed() || last.Event != EventBatchSigned {
+		t.Fatalf("expected the chain to end with a batch signature, have %s", last)
+	}
+
+	// A chain left with unsigned events, as after a crash, is
+	// picked up by the next logger and the events signed.
+	crashed := NewMemoryStore()
+	events, err = store.Events(0, count-2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, ev := range events {
+		if err = crashed.StoreEvent(ev); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	l, err = NewWithStore(crashed, signer, WithoutEcho(),
+		WithBatchSigning(BatchPolicy{MaxEvents: 4}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	l.Stop()
+
+	last, err = crashed.Event(count - 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if recovered, _ := last.attr("recovered"); !last.Signed() || recovered == "" {
+		t.Fatalf("expected a batch signature over recovered events, have %s", last)
+	}
+
+	d, err := Diagnose(crashed, &signer.PublicKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !d.Healthy() {
+		t.Fatalf("expected a healthy chain, have %+v", d.Problems)
+	}
+}
+
+func TestBatchSigningUnsealed(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, store := newTestLogger(t)
+	l.Start()
+	for i := 0; i < 3; i++ {
+		l.InfoSync("batch_test", "event", nil)
+	}
+	l.Stop()
+
+	last, err := store.Event(2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// A hash-linked event appended to a chain that isn't signed in
+	// batches carries no signature, and mustn't be taken up into it.
+	forged := &Event{
+		Serial: 3,
+		When:   last.When,
+		Level:  "INFO",
+		Actor:  "batch_test",
+		Event:  "forged",
+		Digest: last.Digest,
+	}
+	forged.link(last.Signature)
+
+	if forged.Verify(&signer.PublicKey, last.Signature) {
+		t.Fatal("a hash-linked event verified without a batch signature")
+	}
+
+	if err = store.StoreEvent(forged); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = NewWithStore(store, signer, WithoutEcho()); err == nil {
+		t.Fatal("a chain ending in an unsealed hash-linked event verified")
+	}
+
+	// Nor may a signed event other than its batch signature follow
+	// one.
+	next := &Event{
+		Serial: 4,
+		When:   last.When,
+		Level:  "INFO",
+		Actor:  "batch_test",
+		Event:  "event",
+		Digest: last.Digest,
+	}
+	if err = next.Sign(signer, forged.Signature, nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	events, err := store.Events(0, 3)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cert, err := json.Marshal(&Certification{Chain: append(events, next)})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, ok := VerifyCertification(cert, &signer.PublicKey); ok {
+		t.Fatal("a certification holding an unsealed hash-linked event verified")
+	}
+}
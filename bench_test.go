@@ -0,0 +1,174 @@
+package auditlog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The backend benchmarks run each logging path against every
+// available store and signing curve. The Postgres store is only
+// benchmarked when AUDITLOG_BENCH_POSTGRES is set, using the
+// database described by the AUDITLOG_DB_* variables; see
+// docker-compose.yml. The Postgres tables are emptied before each
+// benchmark.
+
+type benchBackend struct {
+	name string
+	open func(b *testing.B) Store
+}
+
+func benchBackends() []benchBackend {
+	backends := []benchBackend{
+		{"memory", func(b *testing.B) Store { return NewMemoryStore() }},
+	}
+
+	if os.Getenv("AUDITLOG_BENCH_POSTGRES") != "" {
+		backends = append(backends, benchBackend{"postgres", openBenchPostgres})
+	}
+	return backends
+}
+
+func openBenchPostgres(b *testing.B) Store {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	store, err := NewPostgresStore(&cfg.DB)
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	// The migrations are harmless to apply again, so the schema
+	// version goes too, and every benchmark starts from a new database.
+	tables := append([]string{"schema_version"}, auditTables...)
+	_, err = store.(*pgStore).db.Exec("TRUNCATE " + strings.Join(tables, ", "))
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+	return store
+}
+
+var benchCurves = []struct {
+	name  string
+	curve elliptic.Curve
+}{
+	{"P256", elliptic.P256()},
+	{"P384", elliptic.P384()},
+	{"P521", elliptic.P521()},
+}
+
+var benchAttributes = []Attribute{
+	{"user", "jqp"},
+	{"ip", "10.0.0.5"},
+	{"session", "3c6e0b8a9c15224a"},
+}
+
+// forEachBackend runs f for every combination of backend and signing
+// curve, handing it a started logger with echo disabled and the given
+// options.
+func forEachBackend(b *testing.B, f func(b *testing.B, l *Logger), opts ...Option) {
+	for _, backend := range benchBackends() {
+		for _, curve := range benchCurves {
+			backend, curve := backend, curve
+			b.Run(backend.name+"/"+curve.name, func(b *testing.B) {
+				signer, err := ecdsa.GenerateKey(curve.curve, rand.Reader)
+				if err != nil {
+					b.Fatalf("%v", err)
+				}
+
+				l, err := NewWithStore(backend.open(b), signer, append(opts, WithoutEcho())...)
+				if err != nil {
+					b.Fatalf("%v", err)
+				}
+				l.Start()
+				defer l.Stop()
+
+				b.ResetTimer()
+				f(b, l)
+			})
+		}
+	}
+}
+
+// BenchmarkBackendThroughput measures sustained asynchronous logging,
+// reporting the rate at which events are signed and stored.
+func BenchmarkBackendThroughput(b *testing.B) {
+	forEachBackend(b, func(b *testing.B, l *Logger) {
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			l.Info("bench", "throughput", benchAttributes)
+		}
+
+		for l.Count() < uint64(b.N) {
+			<-time.After(time.Millisecond)
+		}
+		b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "events/s")
+	})
+}
+
+// BenchmarkBatchThroughput measures sustained asynchronous logging in
+// batch-signing mode, with one signature per thousand events.
+func BenchmarkBatchThroughput(b *testing.B) {
+	forEachBackend(b, func(b *testing.B, l *Logger) {
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			l.Info("bench", "throughput", benchAttributes)
+		}
+
+		for l.Count() < uint64(b.N) {
+			<-time.After(time.Millisecond)
+		}
+		b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "events/s")
+	}, WithBatchSigning(BatchPolicy{MaxEvents: 1000}))
+}
+
+// BenchmarkBackendSyncLatency measures how long a caller waits for a
+// synchronous event to be committed.
+func BenchmarkBackendSyncLatency(b *testing.B) {
+	forEachBackend(b, func(b *testing.B, l *Logger) {
+		for i := 0; i < b.N; i++ {
+			l.InfoSync("bench", "latency", benchAttributes)
+		}
+	})
+}
+
+// BenchmarkBackendVerify measures how quickly a certification of
+// 1000 events is verified.
+func BenchmarkBackendVerify(b *testing.B) {
+	const events = 1000
+
+	forEachBackend(b, func(b *testing.B, l *Logger) {
+		b.StopTimer()
+		for i := 0; i < events; i++ {
+			l.InfoSync("bench", "verify", benchAttributes)
+		}
+
+		cl, err := l.Certify(0, events-1)
+		if err != nil {
+			b.Fatalf("%v", err)
+		}
+
+		var cert Certification
+		err = json.Unmarshal(cl, &cert)
+		if err != nil {
+			b.Fatalf("%v", err)
+		}
+		b.StartTimer()
+
+		start := time.Now()
+		for i := 0; i < b.N; i++ {
+			_, ok := VerifyCertification(cl, l.public)
+			if !ok {
+				b.Fatal("failed to verify certification")
+			}
+		}
+		b.ReportMetric(float64(b.N*len(cert.Chain))/time.Since(start).Seconds(), "events/s")
+	})
+}
@@ -0,0 +1,129 @@
+package auditlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A CEFExporter renders events as records in ArcSight's Common Event
+// Format, for SIEMs that only ingest CEF. The header's device vendor,
+// product, and version default to "auditlog", "auditlog", and "1".
+// Events are mapped as follows:
+//
+//	Signature ID, Name   the event
+//	Severity             DEBUG 1, INFO 3, WARNING 6, ERROR 8, CRITICAL 10
+//	externalId           the serial number
+//	rt                   the time logged, in milliseconds since the epoch
+//	dproc                the actor
+//	cs1Label, cs1 ...    the names and values of the first six attributes
+//	cs6Label, cs6
+//	msg                  every attribute, as name=value pairs
+//	reason               the error, for the error events of a certification
+//
+// Pipes and backslashes are escaped in the header, and equals signs,
+// backslashes, and line breaks in the extensions.
+type CEFExporter struct {
+	Vendor  string
+	Product string
+	Version string
+}
+
+// cefSeverities maps levels to CEF severities, which run from 0 to 10.
+var cefSeverities = map[string]int{
+	"DEBUG":    1,
+	"INFO":     3,
+	"WARNING":  6,
+	"ERROR":    8,
+	"CRITICAL": 10,
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// header returns the CEF header for ev.
+func (x CEFExporter) header(ev *Event) string {
+	vendor, product, version := x.Vendor, x.Product, x.Version
+	if vendor == "" {
+		vendor = "auditlog"
+	}
+	if product == "" {
+		product = "auditlog"
+	}
+	if version == "" {
+		version = "1"
+	}
+
+	event := cefHeaderEscaper.Replace(ev.Event)
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|", cefHeaderEscaper.Replace(vendor),
+		cefHeaderEscaper.Replace(product), cefHeaderEscaper.Replace(version),
+		event, event, cefSeverities[ev.Level])
+}
+
+// extensions returns the CEF extensions for ev.
+func (x CEFExporter) extensions(ev *Event) []string {
+	ext := []string{
+		"externalId=" + strconv.FormatUint(ev.Serial, 10),
+		"rt=" + strconv.FormatInt(ev.When/int64(time.Millisecond), 10),
+		"dproc=" + cefExtensionEscaper.Replace(ev.Actor),
+	}
+
+	var msg []string
+	for i, attr := range ev.Attributes {
+		if i < 6 {
+			ext = append(ext,
+				fmt.Sprintf("cs%dLabel=%s", i+1, cefExtensionEscaper.Replace(attr.Name)),
+				fmt.Sprintf("cs%d=%s", i+1, cefExtensionEscaper.Replace(attr.Value)))
+		}
+		msg = append(msg, attr.Name+"="+attr.Value)
+	}
+
+	if len(msg) > 0 {
+		ext = append(ext, "msg="+cefExtensionEscaper.Replace(strings.Join(msg, " ")))
+	}
+	return ext
+}
+
+// Format renders an event as a CEF record.
+func (x CEFExporter) Format(ev *Event) string {
+	return x.header(ev) + strings.Join(x.extensions(ev), " ")
+}
+
+// formatError renders an error event as a CEF record, with the error
+// as its reason.
+func (x CEFExporter) formatError(ev *ErrorEvent) string {
+	ext := append(x.extensions(ev.Event), "reason="+cefExtensionEscaper.Replace(ev.Message))
+	return x.header(ev.Event) + strings.Join(ext, " ")
+}
+
+// Export writes events to w as CEF records, one per line.
+func (x CEFExporter) Export(w io.Writer, events []*Event) error {
+	bw := bufio.NewWriter(w)
+	for _, ev := range events {
+		bw.WriteString(x.Format(ev))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// ExportCertification writes the events in a certification to w as
+// CEF records, one per line, followed by its error events. The
+// certification should be verified first; the records can't be.
+func (x CEFExporter) ExportCertification(w io.Writer, cert *Certification) error {
+	bw := bufio.NewWriter(w)
+	for _, ev := range cert.Chain {
+		bw.WriteString(x.Format(ev))
+		bw.WriteByte('\n')
+	}
+
+	for _, ev := range cert.Errors {
+		bw.WriteString(x.formatError(ev))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,37 @@
+package auditlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCEFExportCertification(t *testing.T) {
+	when := time.Date(2014, time.October, 6, 12, 0, 0, 0, time.UTC).UnixNano()
+	cert := &Certification{
+		Chain: []*Event{
+			{Serial: 1, When: when, Level: "INFO", Actor: "auth", Event: "login"},
+			{Serial: 2, When: when, Level: "CRITICAL", Actor: "auth", Event: "lockout"},
+		},
+		Errors: []*ErrorEvent{{
+			Message: "store failed",
+			Event:   &Event{Serial: 3, When: when, Level: "ERROR", Actor: "auth", Event: "logout"},
+		}},
+	}
+
+	var buf bytes.Buffer
+	x := CEFExporter{Vendor: "Example|Corp", Product: "billing", Version: "2.1"}
+	if err := x.ExportCertification(&buf, cert); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := []string{
+		`CEF:0|Example\|Corp|billing|2.1|login|login|3|externalId=1 rt=1412596800000 dproc=auth`,
+		`CEF:0|Example\|Corp|billing|2.1|lockout|lockout|10|externalId=2 rt=1412596800000 dproc=auth`,
+		`CEF:0|Example\|Corp|billing|2.1|logout|logout|8|externalId=3 rt=1412596800000 dproc=auth reason=store failed`,
+	}
+	if have := buf.String(); have != strings.Join(expected, "\n")+"\n" {
+		t.Fatalf("expected\n%s\nhave\n%s", strings.Join(expected, "\n"), have)
+	}
+}
@@ -1,10 +1,14 @@
 package auditlog
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"time"
 )
 
@@ -19,74 +23,331 @@ type Certification struct {
 
 // Certify returns a certification for the requested range of events;
 // start and end are event serial numbers. The certification is
-// returned in JSON.
+// returned in JSON. Its generation is recorded in the chain of
+// custody without naming a custodian; see CertifyAs.
 func (l *Logger) Certify(start, end uint64) ([]byte, error) {
+	return l.CertifyAs("", start, end)
+}
+
+// CertifyAs returns a certification as Certify does, recording a
+// signed "certify" event naming the custodian that requested it along
+// with the certification's digest, so that it appears in the chain of
+// custody returned by CustodyTrail. If an accessor identity is
+// required (see WithAccessorRequired), custodian must not be empty.
+func (l *Logger) CertifyAs(custodian string, start, end uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := l.CertifyTo(&buf, custodian, start, end); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CertifyTo writes a certification as CertifyAs does, streaming the
+// events from the store to w a batch at a time rather than building
+// the certification in memory, so that long ranges can be certified.
+//
+// The end of the range is fixed under the logger's lock, but the
+// certification is written without it, so the logger goes on
+// recording events in the meantime; if the store is a Snapshotter,
+// the certification is read from a snapshot taken as the range is
+// fixed. Events can't be pruned while a certification is written.
+// The "certify" event is recorded once the whole certification has
+// been written.
+func (l *Logger) CertifyTo(w io.Writer, custodian string, start, end uint64) error {
+	if l.requireAccessor && custodian == "" {
+		return ErrNoAccessor
+	}
+
+	l.pruneLock.Lock()
+	defer l.pruneLock.Unlock()
+
+	src, when, end, err := l.certificationSource(end)
+	if err != nil {
+		return err
+	}
+	if snap, ok := src.(Snapshot); ok {
+		defer snap.Close()
+	}
+
+	h := sha256.New()
+	err = writeCertification(io.MultiWriter(w, h), src, when, start, end)
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.closed {
+		return errors.New("auditlog: logger has been stopped")
+	}
+
+	return l.record(&Event{
+		When:  l.now(),
+		Level: levelStrings[levelInfo],
+		Actor: internalActor,
+		Event: EventCertify,
+		Attributes: custodyAttributes(custodian, h.Sum(nil), []Attribute{
+			{"start", fmt.Sprintf("%d", start)},
+			{"end", fmt.Sprintf("%d", end)},
+		}),
+	})
+}
+
+// certificationSource fixes the end of a certification under the
+// lock, returning the source its events are read from: a snapshot of
+// the store, if it is a Snapshotter, or the store itself.
+func (l *Logger) certificationSource(end uint64) (chainReader, int64, uint64, error) {
 	l.lock.Lock()
 	defer l.lock.Unlock()
+
+	if l.closed {
+		return nil, 0, 0, errors.New("auditlog: logger has been stopped")
+	}
+
+	// In batch-signing mode, the certification runs to the batch
+	// signature covering its last event.
+	l.sealBatch()
 	if end <= 0 {
 		end = l.counter - 1
 	}
 
-	attributes := []Attribute{
-		{"start", fmt.Sprintf("%d", start)},
-		{"end", fmt.Sprintf("%d", end)},
-	}
-	l.Info("auditlog", "certify", attributes)
-	var certification Certification
 	var err error
+	if l.batch != nil {
+		end, err = l.coveringSignature(end)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
 
-	tx, err := l.db.Begin()
-	if err != nil {
+	// Nothing lies beyond the end of the chain but error events,
+	// which take the serial number of the event that failed.
+	if end > l.counter {
+		end = l.counter
+	}
+
+	var src chainReader = l.store
+	if sn, ok := l.store.(Snapshotter); ok {
+		src, err = sn.Snapshot()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	return src, l.now(), end, nil
+}
+
+// certification builds a JSON-encoded certification of the events in
+// the range [start, end].
+func (l *Logger) certification(start, end uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCertification(&buf, l.store, l.now(), start, end); err != nil {
 		return nil, err
 	}
+	return buf.Bytes(), nil
+}
+
+// A chainReader reads events and error events from a chain; both
+// stores and snapshots are chainReaders.
+type chainReader interface {
+	Events(start, end uint64) ([]*Event, error)
+	Errors(start, end uint64) ([]*ErrorEvent, error)
+}
+
+// writeCertification writes a JSON-encoded certification of the
+// events in the range [start, end], read from src in batches, to w;
+// when is its timestamp. The encoding is the same as that of a
+// Certification, so that it can be read by VerifyCertification.
+func writeCertification(w io.Writer, src chainReader, when int64, start, end uint64) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `{"when":%d,"chain":`, when)
 
-	defer func() {
-		if err == nil {
-			tx.Commit()
-		} else {
-			tx.Rollback()
+	err := writeCertificationBatches(bw, start, end, func(first, last uint64) ([]interface{}, error) {
+		events, err := src.Events(first, last)
+		items := make([]interface{}, len(events))
+		for i := range events {
+			items[i] = events[i]
 		}
-	}()
-	certification.Chain, err = loadEvents(tx, start, end)
+		return items, err
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	certification.Errors, err = loadErrors(tx, start, end)
+	bw.WriteString(`,"errors":`)
+	err = writeCertificationBatches(bw, start, end, func(first, last uint64) ([]interface{}, error) {
+		errs, err := src.Errors(first, last)
+		items := make([]interface{}, len(errs))
+		for i := range errs {
+			items[i] = errs[i]
+		}
+		return items, err
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	certification.When = time.Now().UnixNano()
+	bw.WriteString("}")
+	return bw.Flush()
+}
+
+// writeCertificationBatches writes the items returned by load for the
+// range [start, end] as a JSON array, loading them in batches. As
+// with a nil slice, no items are written as null.
+func writeCertificationBatches(w *bufio.Writer, start, end uint64, load func(first, last uint64) ([]interface{}, error)) error {
+	var written bool
+	for first := start; first <= end; first += backupBatch {
+		last := first + backupBatch - 1
+		if last > end {
+			last = end
+		}
 
-	return json.Marshal(certification)
+		items, err := load(first, last)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range items {
+			out, err := json.Marshal(item)
+			if err != nil {
+				return err
+			}
+
+			if written {
+				w.WriteByte(',')
+			} else {
+				w.WriteByte('[')
+				written = true
+			}
+			w.Write(out)
+		}
+	}
+
+	if !written {
+		_, err := w.WriteString("null")
+		return err
+	}
+
+	_, err := w.WriteString("]")
+	return err
 }
 
 // VerifyCertification verifies a JSON-encoded certification against
-// the signer's public key.
-func VerifyCertification(in []byte, signer *ecdsa.PublicKey) (*Certification, bool) {
+// the signer's public key. Every run of hash-linked events recorded in
+// batch-signing mode must be closed by the "batch signed" event whose
+// Merkle root matches it, so the chain must end with a signed event. The signatures are checked in parallel unless
+// VerifyWorkers(1) is given; see VerifyProgressFunc to follow a long
+// verification, and VerifyKeys to verify a chain whose signing key has
+// been rotated.
+func VerifyCertification(in []byte, signer *ecdsa.PublicKey, opts ...VerifyOption) (*Certification, bool) {
+	var vc verifyConfig
+	for _, opt := range opts {
+		opt(&vc)
+	}
+
 	var cl Certification
 	err := json.Unmarshal(in, &cl)
 	if err != nil {
 		return nil, false
 	}
 
-	if len(cl.Chain) > 0 && cl.Chain[0].Serial == 0 {
-		if !cl.Chain[0].Verify(signer, nil) {
+	// A certification is attacker-controlled input; null entries
+	// must be rejected before they are dereferenced.
+	for i := range cl.Chain {
+		if cl.Chain[i] == nil {
 			return nil, false
 		}
 	}
 
-	if len(cl.Chain) > 1 {
-		for i := 1; i < len(cl.Chain); i++ {
-			if !cl.Chain[i].Verify(signer, cl.Chain[i-1].Signature) {
+	for i := range cl.Errors {
+		if cl.Errors[i] == nil || cl.Errors[i].Event == nil {
+			return nil, false
+		}
+	}
+
+	// The first event can only be verified if it begins the chain;
+	// otherwise, the signature preceding it isn't known.
+	if len(cl.Chain) > 0 {
+		chain, prev := cl.Chain, []byte(nil)
+		if chain[0].Serial != 0 {
+			chain, prev = chain[1:], chain[0].Signature
+		}
+
+		// Without progress to report, the chain is verified in one
+		// piece; otherwise, a batch at a time.
+		batch := len(chain)
+		if vc.progress != nil {
+			batch = backupBatch
+		}
+
+		keys := vc.manifest(signer)
+		meter := newProgressMeter(vc.progress, uint64(len(chain)))
+		for len(chain) > 0 {
+			n := batch
+			if n > len(chain) {
+				n = len(chain)
+			}
+
+			if verifyEvents(keys, prev, chain[:n], vc.workers) >= 0 {
 				return nil, false
 			}
+			prev = chain[n-1].Signature
+			chain = chain[n:]
+			meter.add(n)
 		}
 	}
+
+	if !sealed(cl.Chain, false) {
+		return nil, false
+	}
 	return &cl, true
 }
 
+// ReceivedRange returns the serial numbers of the first and last
+// events received in the period [from, until), for use with Certify;
+// ok is false if there are none. Received timestamps never go
+// backwards, so the chain is searched by bisection. Pruned events
+// aren't searched.
+func (l *Logger) ReceivedRange(from, until time.Time) (start, end uint64, ok bool, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	first, _, err := l.chainStart()
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	// search returns the first serial whose event was received at
+	// or after t.
+	search := func(t int64) (uint64, error) {
+		lo, hi := first, l.counter
+		for lo < hi {
+			mid := lo + (hi-lo)/2
+			ev, err := l.store.Event(mid)
+			if err != nil {
+				return 0, err
+			}
+
+			if ev.Received < t {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		return lo, nil
+	}
+
+	start, err = search(from.UnixNano())
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	next, err := search(until.UnixNano())
+	if err != nil || next <= start {
+		return 0, 0, false, err
+	}
+	return start, next - 1, true, nil
+}
+
 func publicFingerprint(signer *ecdsa.PublicKey) []byte {
 	h := sha256.New()
 	h.Write(signer.X.Bytes())
@@ -98,18 +359,10 @@ func publicFingerprint(signer *ecdsa.PublicKey) []byte {
 // event with serial = 0). The user can store a copy of this, and use
 // it to ensure the root of the chain has not been tampered with.
 func (l *Logger) RootSignature() ([]byte, error) {
-	tx, err := l.db.Begin()
+	ev, err := l.store.Event(0)
 	if err != nil {
 		return nil, err
 	}
 
-	signature, err := getSignature(tx, 0)
-	if err != nil {
-		tx.Rollback()
-		signature = nil
-	} else {
-		tx.Commit()
-	}
-
-	return signature, err
+	return ev.Signature, nil
 }
@@ -0,0 +1,219 @@
+package auditlog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventCheckpointFailure is the ERROR event recorded when a checkpoint
+// couldn't be published.
+const EventCheckpointFailure = "checkpoint failure"
+
+// ErrCheckpointMismatch is returned by VerifyCheckpoints when the
+// chain contradicts a published checkpoint.
+var ErrCheckpointMismatch = errors.New("auditlog: chain does not match checkpoint")
+
+// A Checkpoint records the head of the chain at a point in time: the
+// serial number of the last event, and the hex-encoded SHA-256 digest
+// of its signature, which covers the entire chain up to it. When is a
+// nanosecond-resolution timestamp of when the checkpoint was taken.
+type Checkpoint struct {
+	Serial uint64
+	When   int64
+	Head   string
+}
+
+// String returns the checkpoint as a single line of text, in the form
+// read by ParseCheckpoint.
+func (cp Checkpoint) String() string {
+	return fmt.Sprintf("auditlog checkpoint serial=%d when=%s head=%s", cp.Serial,
+		time.Unix(0, cp.When).UTC().Format(time.RFC3339Nano), cp.Head)
+}
+
+// ParseCheckpoint parses a checkpoint written by String. Leading text,
+// such as a syslog header, is ignored.
+func ParseCheckpoint(s string) (Checkpoint, error) {
+	var cp Checkpoint
+
+	i := strings.Index(s, "auditlog checkpoint ")
+	if i < 0 {
+		return cp, errors.New("auditlog: not a checkpoint")
+	}
+
+	var when string
+	_, err := fmt.Sscanf(s[i:], "auditlog checkpoint serial=%d when=%s head=%s", &cp.Serial, &when, &cp.Head)
+	if err != nil {
+		return cp, err
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, when)
+	if err != nil {
+		return cp, err
+	}
+	cp.When = t.UnixNano()
+	return cp, nil
+}
+
+// A CheckpointPublisher writes checkpoints to a channel independent of
+// the store. Publishers should be under different control from the
+// database, so that replacing the database wholesale leaves local
+// evidence that contradicts it.
+type CheckpointPublisher interface {
+	PublishCheckpoint(cp Checkpoint) error
+}
+
+// A CheckpointPublisherFunc adapts a function to a CheckpointPublisher.
+type CheckpointPublisherFunc func(cp Checkpoint) error
+
+// PublishCheckpoint calls f(cp).
+func (f CheckpointPublisherFunc) PublishCheckpoint(cp Checkpoint) error {
+	return f(cp)
+}
+
+// A CheckpointFile publishes checkpoints by appending them, one per
+// line, to the named file. The file should be owned by a different
+// user than the database and made append-only (e.g. with chattr +a),
+// so that the logger can add to it but not rewrite it.
+type CheckpointFile string
+
+// PublishCheckpoint appends cp to the file and syncs it to disk.
+func (path CheckpointFile) PublishCheckpoint(cp Checkpoint) error {
+	f, err := os.OpenFile(string(path), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(cp.String() + "\n")
+	if err == nil {
+		err = f.Sync()
+	}
+
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ReadCheckpoints reads the checkpoints from a file, such as one
+// written by a CheckpointFile or a syslog file; lines that don't hold
+// a checkpoint are skipped.
+func ReadCheckpoints(path string) ([]Checkpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cps []Checkpoint
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		cp, err := ParseCheckpoint(scanner.Text())
+		if err != nil {
+			continue
+		}
+		cps = append(cps, cp)
+	}
+	return cps, scanner.Err()
+}
+
+// A CheckpointPolicy publishes a checkpoint to each of Publishers every
+// Interval, if events have been recorded since the last checkpoint,
+// and once more when the logger stops.
+type CheckpointPolicy struct {
+	Interval   time.Duration
+	Publishers []CheckpointPublisher
+}
+
+// WithCheckpoints publishes checkpoints as described by the policy. A
+// checkpoint that can't be published is reported in an ERROR
+// "checkpoint failure" event.
+func WithCheckpoints(policy CheckpointPolicy) Option {
+	return func(l *Logger) {
+		if policy.Interval <= 0 || len(policy.Publishers) == 0 {
+			return
+		}
+
+		var last Checkpoint
+		l.addTask(every(policy.Interval, true, func(l *Logger) {
+			cp, ok := l.Checkpoint()
+			if !ok || cp.Serial == last.Serial && cp.Head == last.Head {
+				return
+			}
+			last = cp
+
+			for _, pub := range policy.Publishers {
+				err := pub.PublishCheckpoint(cp)
+				if err != nil {
+					l.logInternal(levelError, EventCheckpointFailure, []Attribute{
+						{"serial", strconv.FormatUint(cp.Serial, 10)},
+						{"error", err.Error()},
+					})
+				}
+			}
+		}))
+	}
+}
+
+// Checkpoint returns a checkpoint of the current head of the chain;
+// ok is false if the chain is empty.
+func (l *Logger) Checkpoint() (cp Checkpoint, ok bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.checkpoint()
+}
+
+// checkpoint returns a checkpoint of the current head of the chain, as
+// Checkpoint does; the caller must hold the lock.
+func (l *Logger) checkpoint() (cp Checkpoint, ok bool) {
+	if l.counter == 0 || l.lastSignature == nil {
+		return cp, false
+	}
+
+	return Checkpoint{
+		Serial: l.counter - 1,
+		When:   l.now(),
+		Head:   chainLink(&Event{Signature: l.lastSignature}),
+	}, true
+}
+
+// VerifyCheckpoints checks the chain against previously published
+// checkpoints: each checkpointed event must be present, and its
+// signature must match the checkpoint. Checkpoints of events that
+// have since been pruned are skipped. The first contradiction found
+// is returned, wrapping ErrCheckpointMismatch.
+func (l *Logger) VerifyCheckpoints(cps []Checkpoint) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	start, _, err := l.chainStart()
+	if err != nil {
+		return err
+	}
+
+	for _, cp := range cps {
+		if cp.Serial < start {
+			continue
+		}
+
+		if cp.Serial >= l.counter {
+			return fmt.Errorf("%w: event %d is missing", ErrCheckpointMismatch, cp.Serial)
+		}
+
+		ev, err := l.store.Event(cp.Serial)
+		if err != nil {
+			return err
+		}
+
+		if chainLink(ev) != cp.Head {
+			return fmt.Errorf("%w: event %d differs", ErrCheckpointMismatch, cp.Serial)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+//go:build !windows && !plan9
+
+package auditlog
+
+import "log/syslog"
+
+// A SyslogCheckpoints publishes checkpoints to the local syslog
+// daemon, which usually keeps its files under a different user than
+// the database.
+type SyslogCheckpoints struct {
+	w *syslog.Writer
+}
+
+// NewSyslogCheckpoints connects to the local syslog daemon, logging
+// checkpoints with the given tag to the authpriv facility.
+func NewSyslogCheckpoints(tag string) (*SyslogCheckpoints, error) {
+	w, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_NOTICE, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogCheckpoints{w: w}, nil
+}
+
+// PublishCheckpoint logs cp at NOTICE.
+func (s *SyslogCheckpoints) PublishCheckpoint(cp Checkpoint) error {
+	return s.w.Notice(cp.String())
+}
+
+// Close disconnects from the syslog daemon.
+func (s *SyslogCheckpoints) Close() error {
+	return s.w.Close()
+}
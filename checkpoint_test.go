@@ -0,0 +1,59 @@
+package auditlog
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoints")
+	policy := CheckpointPolicy{
+		Interval:   time.Hour,
+		Publishers: []CheckpointPublisher{CheckpointFile(path)},
+	}
+
+	l, _ := newTestLogger(t, WithCheckpoints(policy))
+	l.Start()
+
+	for i := 0; i < 3; i++ {
+		l.InfoSync("checkpoint_test", "event", nil)
+	}
+	l.Stop()
+
+	cps, err := ReadCheckpoints(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(cps) != 1 || cps[0].Serial != 2 {
+		t.Fatalf("expected a checkpoint of event 2, have %+v", cps)
+	}
+
+	cp, err := ParseCheckpoint("Oct 17 12:00:00 host auditd: " + cps[0].String())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if cp != cps[0] {
+		t.Fatalf("checkpoint didn't round trip: %+v != %+v", cp, cps[0])
+	}
+
+	if err = l.VerifyCheckpoints(cps); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// A replacement chain signed with the same key contradicts
+	// the checkpoint.
+	forged, _ := newTestLogger(t)
+	forged.Start()
+	for i := 0; i < 3; i++ {
+		forged.InfoSync("checkpoint_test", "forged", nil)
+	}
+	defer forged.Stop()
+
+	if err = forged.VerifyCheckpoints(cps); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Fatalf("expected a checkpoint mismatch, have %v", err)
+	}
+}
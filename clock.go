@@ -0,0 +1,115 @@
+package auditlog
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock supplies the timestamps recorded in events. Replacing the
+// clock allows tests to produce predictable chains, and allows
+// events to be replayed or imported with their original times.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the default clock, which reads the system time.
+var SystemClock Clock = systemClock{}
+
+// A FixedClock returns a fixed time, advancing by Step each time it
+// is read. It is safe for concurrent use.
+type FixedClock struct {
+	lock sync.Mutex
+	t    time.Time
+
+	// Step is added to the clock's time after each reading.
+	Step time.Duration
+}
+
+// NewFixedClock returns a clock starting at t and advancing by step
+// on each reading.
+func NewFixedClock(t time.Time, step time.Duration) *FixedClock {
+	return &FixedClock{t: t, Step: step}
+}
+
+// Now returns the clock's current time and advances it.
+func (c *FixedClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	t := c.t
+	c.t = c.t.Add(c.Step)
+	return t
+}
+
+// now returns the logger's current time as a nanosecond-resolution
+// timestamp.
+func (l *Logger) now() int64 {
+	if l.clock == nil {
+		return time.Now().UnixNano()
+	}
+	return l.clock.Now().UnixNano()
+}
+
+// EventClockRegression is the WARNING event recorded when the
+// logger's clock is found to have gone backwards.
+const EventClockRegression = "clock regression"
+
+// received returns the timestamp for an event being received; the
+// caller must hold the logger's lock. Received timestamps never go
+// backwards: if the clock has been stepped back, the time elapsed
+// since the last event was received, measured with the monotonic
+// clock where available, is added to that event's timestamp instead,
+// and a "clock regression" event is recorded.
+func (l *Logger) received() int64 {
+	var t time.Time
+	if l.clock == nil {
+		t = time.Now()
+	} else {
+		t = l.clock.Now()
+	}
+
+	wall := t.UnixNano()
+	last, lastTime := l.lastReceived, l.lastReceivedTime
+	l.lastReceivedTime = t
+	if wall > last {
+		l.lastReceived = wall
+		return wall
+	}
+
+	// Without a monotonic reading, Sub measures wall time, which
+	// has gone backwards; the timestamp is then only nudged
+	// forwards.
+	elapsed := int64(1)
+	if !lastTime.IsZero() {
+		if d := int64(t.Sub(lastTime)); d > elapsed {
+			elapsed = d
+		}
+	}
+
+	r := last + elapsed
+	if wall < last {
+		l.lastReceived = r
+		l.record(&Event{
+			When:     wall,
+			Received: r,
+			Level:    levelStrings[levelWarning],
+			Actor:    internalActor,
+			Event:    EventClockRegression,
+			Attributes: []Attribute{
+				{"clock", t.UTC().Format(time.RFC3339Nano)},
+				{"last_received", time.Unix(0, last).UTC().Format(time.RFC3339Nano)},
+				{"regression", time.Duration(last - wall).String()},
+			},
+		})
+		r++
+	}
+
+	l.lastReceived = r
+	return r
+}
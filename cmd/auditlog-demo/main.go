@@ -0,0 +1,118 @@
+// auditlog-demo walks through the life of an audit chain: it
+// generates a signing key, records a handful of events, certifies
+// the chain, and verifies the certification using only the public
+// key, leaving the key, public key, and certification behind in the
+// output directory.
+//
+// By default the chain is kept in memory; with -postgres, the
+// database described by the AUDITLOG_DB_* environment variables is
+// used instead.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/kisom/auditlog"
+)
+
+func checkerr(err error) {
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%v\n", err)
+	os.Exit(1)
+}
+
+func writePEM(path, kind string, der []byte, perm os.FileMode) {
+	out := pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der})
+	err := ioutil.WriteFile(path, out, perm)
+	checkerr(err)
+	fmt.Printf("wrote %s\n", path)
+}
+
+func main() {
+	dir := flag.String("d", ".", "output directory")
+	count := flag.Int("n", 8, "number of events to log")
+	usePostgres := flag.Bool("postgres", false, "use the database from the AUDITLOG_DB_* environment")
+	flag.Parse()
+
+	// 1. Generate a signing key, keeping the private half for the
+	// logger and publishing the public half for verifiers.
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	checkerr(err)
+
+	der, err := x509.MarshalECPrivateKey(signer)
+	checkerr(err)
+	writePEM(filepath.Join(*dir, "signer.pem"), "EC PRIVATE KEY", der, 0600)
+
+	der, err = x509.MarshalPKIXPublicKey(&signer.PublicKey)
+	checkerr(err)
+	pubFile := filepath.Join(*dir, "logger.pub")
+	writePEM(pubFile, "EC PUBLIC KEY", der, 0644)
+
+	// 2. Start a logger and record some events.
+	var store auditlog.Store = auditlog.NewMemoryStore()
+	if *usePostgres {
+		cfg, err := auditlog.ConfigFromEnv()
+		checkerr(err)
+
+		store, err = cfg.Store()
+		checkerr(err)
+	}
+
+	logger, err := auditlog.NewWithStore(store, signer, auditlog.WithoutEcho())
+	checkerr(err)
+
+	err = logger.Start()
+	checkerr(err)
+
+	start := logger.Count()
+	for i := 0; i < *count; i++ {
+		attrs := []auditlog.Attribute{
+			{Name: "user", Value: fmt.Sprintf("user%d", i%3)},
+		}
+
+		if i%4 == 3 {
+			logger.WarningSync("auth", "login failure", attrs)
+		} else {
+			logger.InfoSync("auth", "login", attrs)
+		}
+	}
+
+	// 3. Certify the events that were just recorded.
+	cert, err := logger.Certify(start, logger.Count()-1)
+	checkerr(err)
+	logger.Stop()
+
+	certFile := filepath.Join(*dir, "certified.json")
+	err = ioutil.WriteFile(certFile, cert, 0644)
+	checkerr(err)
+	fmt.Printf("wrote %s\n", certFile)
+
+	// 4. Verify the certification as an auditor would, with only
+	// the public key and the certification in hand.
+	pub, err := auditlog.LoadPublicKey(pubFile)
+	checkerr(err)
+
+	in, err := ioutil.ReadFile(certFile)
+	checkerr(err)
+
+	cl, ok := auditlog.VerifyCertification(in, pub)
+	if !ok {
+		checkerr(fmt.Errorf("failed to verify %s", certFile))
+	}
+
+	fmt.Printf("OK: verified %d events\n", len(cl.Chain))
+	for _, ev := range cl.Chain {
+		fmt.Printf("\t%s\n", ev)
+	}
+}
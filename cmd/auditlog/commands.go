@@ -0,0 +1,794 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kisom/auditlog"
+)
+
+// readCertification reads a certification, decompressing it if it
+// was written with certify -compress.
+func readCertification(path string) []byte {
+	in, err := ioutil.ReadFile(path)
+	checkerr(err)
+
+	if !bytes.HasPrefix(in, []byte{0x1f, 0x8b}) {
+		return in
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(in))
+	checkerr(err)
+
+	in, err = ioutil.ReadAll(zr)
+	checkerr(err)
+	return in
+}
+
+// verify checks certifications against the logger's public key,
+// writing a formatted copy of each verified chain. With no
+// certifications, the chain in the database is verified instead, or,
+// with -file, the chain in a log file written by the file backend.
+func verify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	keyFile := fs.String("k", "logger.pub", "logger's public key")
+	stateFile := fs.String("state", "", "file recording the last verified event")
+	format := fs.String("format", "json", "format of the verified chains: json, jsonl, table, csv, cef, or ocsf")
+	progress := fs.Bool("progress", false, "report progress on standard error")
+	logFile := fs.String("file", "", "log file to verify by streaming it")
+	keysFile := fs.String("keys", "", "key manifest to verify a chain whose key has been rotated")
+	hmacFile := fs.String("hmac", "", "HMAC key to verify a chain recorded with HMAC chaining")
+	df := newDBFlags(fs)
+	fs.Parse(args)
+	checkFormat(*format)
+
+	var opts []auditlog.VerifyOption
+	if *keysFile != "" {
+		keys, err := auditlog.LoadKeyManifest(*keysFile)
+		checkerr(err)
+		opts = append(opts, auditlog.VerifyKeys(keys))
+	}
+
+	if *hmacFile != "" {
+		key, err := auditlog.LoadHMACKey(*hmacFile)
+		checkerr(err)
+		opts = append(opts, auditlog.VerifyHMAC(key))
+	}
+
+	if *logFile != "" {
+		verifyLogFile(*keyFile, *keysFile == "", *logFile, opts)
+		return
+	}
+
+	var report func(auditlog.VerifyProgress)
+	if *progress {
+		report = progressReporter()
+	}
+
+	if fs.NArg() == 0 && *stateFile != "" {
+		verifyIncremental(df, *stateFile, report)
+		return
+	}
+
+	if fs.NArg() == 0 {
+		l := df.open(auditlog.WithVerifyProgress(report))
+		fmt.Printf("OK: verified %d events\n", l.Count())
+		l.Stop()
+		return
+	}
+
+	// With a key manifest, the public key isn't needed.
+	var pub *ecdsa.PublicKey
+	var err error
+	if *keysFile == "" {
+		pub, err = auditlog.LoadPublicKey(*keyFile)
+		checkerr(err)
+	}
+
+	for i, log := range fs.Args() {
+		in := readCertification(log)
+
+		fmt.Printf("Verifying %s\n", log)
+		cl, ok := auditlog.VerifyCertification(in, pub, append(opts, auditlog.VerifyProgressFunc(report))...)
+		if !ok {
+			err = errors.New("failed to verify certification")
+			checkerr(err)
+		}
+
+		// The JSON and CEF formats keep the whole certification,
+		// including its errors; the others only hold the chain.
+		buf := &bytes.Buffer{}
+		if *format == "json" {
+			out, err := json.Marshal(cl)
+			checkerr(err)
+
+			err = json.Indent(buf, out, "", "    ")
+			checkerr(err)
+		} else if *format == "cef" {
+			checkerr(auditlog.CEFExporter{}.ExportCertification(buf, cl))
+		} else {
+			checkerr(writeEvents(buf, *format, cl.Chain))
+		}
+
+		filename := fmt.Sprintf("verified_logs_%d%s", i, outputFormats[*format])
+		fmt.Printf("OK: writing logs to %s\n", filename)
+		err = ioutil.WriteFile(filename, buf.Bytes(), 0644)
+		checkerr(err)
+	}
+}
+
+// verifyLogFile verifies the chain in a log file without opening it
+// as a store, so that the file can be checked on a machine other than
+// the appliance that wrote it.
+func verifyLogFile(keyFile string, needKey bool, path string, opts []auditlog.VerifyOption) {
+	var pub *ecdsa.PublicKey
+	if needKey {
+		var err error
+		pub, err = auditlog.LoadPublicKey(keyFile)
+		checkerr(err)
+	}
+
+	f, err := os.Open(path)
+	checkerr(err)
+	defer f.Close()
+
+	n, err := auditlog.VerifyLogFile(f, pub, opts...)
+	checkerr(err)
+	fmt.Printf("OK: verified %d events\n", n)
+}
+
+// progressReporter returns a function printing the progress of a
+// verification to standard error, at most once a second.
+func progressReporter() func(auditlog.VerifyProgress) {
+	var last time.Time
+	return func(p auditlog.VerifyProgress) {
+		if p.Verified < p.Total && time.Since(last) < time.Second {
+			return
+		}
+		last = time.Now()
+
+		fmt.Fprintf(os.Stderr, "verified %d of %d events (%.0f events/s, %s remaining)\n",
+			p.Verified, p.Total, p.Rate(), p.Remaining().Round(time.Second))
+	}
+}
+
+// verifyIncremental verifies the events recorded since the head in
+// the state file, then records the new head. If the state file
+// doesn't exist, the whole chain is verified. If the recorded head is
+// missing or has changed, the chain has been truncated or replaced,
+// and the state file is left alone.
+func verifyIncremental(df dbFlags, stateFile string, report func(auditlog.VerifyProgress)) {
+	cfg := df.loadConfig()
+	cfg.Verify = auditlog.VerifyNone
+
+	l, err := auditlog.NewFromConfig(cfg, auditlog.WithoutEcho(), auditlog.WithVerifyProgress(report))
+	checkerr(err)
+	defer l.Stop()
+
+	since, err := auditlog.LoadVerifiedHead(stateFile)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	checkerr(err)
+
+	head, err := l.VerifyChain(since)
+	if err == auditlog.ErrHeadMismatch {
+		fmt.Fprintf(os.Stderr, "FAILED: event %d no longer matches %s; the chain may have been truncated\n",
+			since.Serial, stateFile)
+		os.Exit(1)
+	}
+	checkerr(err)
+
+	if head == nil {
+		fmt.Println("OK: the chain is empty")
+		return
+	}
+
+	checkerr(auditlog.SaveVerifiedHead(stateFile, head))
+
+	first := uint64(0)
+	if since != nil {
+		first = since.Serial + 1
+	}
+	if head.Serial < first {
+		fmt.Println("OK: no new events")
+		return
+	}
+	fmt.Printf("OK: verified events %d to %d\n", first, head.Serial)
+}
+
+// compare reports the point at which two certifications produced
+// with the same signing key fork. A fork means the key has signed two
+// different histories, such as when a restored backup has been used
+// to forge events.
+func compare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	keyFile := fs.String("k", "logger.pub", "logger's public key")
+	proofFile := fs.String("proof", "", "consistency proof that b.json extends a.json, from auditlog prove")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: auditlog compare [-k logger.pub] [-proof proof.json] a.json b.json\n")
+		os.Exit(2)
+	}
+
+	pub, err := auditlog.LoadPublicKey(*keyFile)
+	checkerr(err)
+
+	a := readCertification(fs.Arg(0))
+	b := readCertification(fs.Arg(1))
+
+	if *proofFile != "" {
+		proof, err := ioutil.ReadFile(*proofFile)
+		checkerr(err)
+
+		checkerr(auditlog.VerifyConsistency(a, b, proof, pub))
+		fmt.Printf("OK: %s extends %s\n", fs.Arg(1), fs.Arg(0))
+		return
+	}
+
+	fork, err := auditlog.CompareCertifications(a, b, pub)
+	checkerr(err)
+
+	if fork == nil {
+		fmt.Println("OK: the chains are consistent")
+		return
+	}
+
+	fmt.Printf("FORK at event %d:\n", fork.Serial)
+	fmt.Printf("\t%s: %s\n", fs.Arg(0), fork.A)
+	fmt.Printf("\t%s: %s\n", fs.Arg(1), fork.B)
+	os.Exit(1)
+}
+
+// prove writes a consistency proof that the chain certified in
+// new.json extends the one certified in old.json, for compare -proof.
+func prove(args []string) {
+	fs := flag.NewFlagSet("prove", flag.ExitOnError)
+	output := fs.String("o", "", "output file (default: standard output)")
+	df := newDBFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "Usage: auditlog prove [-o proof.json] old.json new.json\n")
+		os.Exit(2)
+	}
+
+	older := readCertification(fs.Arg(0))
+	newer := readCertification(fs.Arg(1))
+
+	l := df.open()
+	proof, err := l.ProveConsistency(older, newer)
+	l.Stop()
+	checkerr(err)
+
+	if *output == "" {
+		os.Stdout.Write(append(proof, '\n'))
+		return
+	}
+	checkerr(ioutil.WriteFile(*output, proof, 0644))
+}
+
+// certify writes a certification of a range of events, chosen by
+// serial number or by the time the events were received. The output
+// may be compressed with gzip, and is written to standard output if
+// the output file is "-".
+func certify(args []string) {
+	fs := flag.NewFlagSet("certify", flag.ExitOnError)
+	start := fs.Uint64("start", 0, "first serial number")
+	end := fs.Uint64("end", 0, "last serial number (default: end of the chain)")
+	since := fs.String("since", "", "certify events received at or after this time, in RFC 3339 format")
+	until := fs.String("until", "", "certify events received before this time, in RFC 3339 format")
+	outFile := fs.String("o", "certified.json", "output file, or - for standard output")
+	compress := fs.Bool("compress", false, "compress the certification with gzip")
+	df := newDBFlags(fs)
+	fs.Parse(args)
+
+	l := df.open()
+	defer l.Stop()
+
+	if *since != "" || *until != "" {
+		to := time.Now()
+		if *until != "" {
+			to = parseTime(*until)
+		}
+
+		first, last, ok, err := l.ReceivedRange(parseTime(*since), to)
+		checkerr(err)
+		if !ok {
+			checkerr(errors.New("no events were received in that period"))
+		}
+		*start, *end = first, last
+	}
+
+	// The certification is streamed to its destination, as it may
+	// be too large to hold in memory.
+	out := os.Stdout
+	if *outFile != "-" {
+		f, err := os.Create(*outFile)
+		checkerr(err)
+		defer f.Close()
+		out = f
+	}
+
+	var w io.Writer = out
+	var zw *gzip.Writer
+	if *compress {
+		zw = gzip.NewWriter(out)
+		w = zw
+	}
+
+	err := l.CertifyTo(w, *df.accessor, *start, *end)
+	if err == nil && zw != nil {
+		err = zw.Close()
+	}
+	if err == nil && out != os.Stdout {
+		err = out.Close()
+	}
+	checkerr(err)
+
+	if out != os.Stdout {
+		fmt.Fprintf(os.Stderr, "wrote %s\n", *outFile)
+	}
+}
+
+func parseTime(s string) time.Time {
+	if s == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	checkerr(err)
+	return t
+}
+
+// query prints the events matching a search of the chain.
+func query(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	start := fs.Uint64("start", 0, "first serial number")
+	end := fs.Uint64("end", 0, "last serial number (default: end of the chain)")
+	from := fs.String("from", "", "earliest time logged, in RFC 3339 format")
+	until := fs.String("until", "", "time logged before, in RFC 3339 format")
+	level := fs.String("level", "", "level to match")
+	minLevel := fs.String("min-level", "", "lowest level to match")
+	actor := fs.String("actor", "", "actor to match")
+	event := fs.String("event", "", "event to match")
+	attr := fs.String("attr", "", "attribute to match, as name=value")
+	format := fs.String("format", "table", "output format: json, jsonl, table, csv, cef, or ocsf")
+	df := newDBFlags(fs)
+	fs.Parse(args)
+	checkFormat(*format)
+
+	var attrs []auditlog.Attribute
+	if *attr != "" {
+		name, value, ok := strings.Cut(*attr, "=")
+		if !ok {
+			checkerr(errors.New("attribute must be given as name=value"))
+		}
+		attrs = append(attrs, auditlog.Attribute{Name: name, Value: value})
+	}
+
+	l := df.open()
+	defer l.Stop()
+
+	events, err := l.Query(*df.accessor, auditlog.Query{
+		Start:      *start,
+		End:        *end,
+		From:       parseTime(*from),
+		Until:      parseTime(*until),
+		Level:      *level,
+		MinLevel:   *minLevel,
+		Actor:      *actor,
+		Event:      *event,
+		Attributes: attrs,
+	})
+	checkerr(err)
+	checkerr(writeEvents(os.Stdout, *format, events))
+}
+
+// export writes a signed backup snapshot of the chain, which can be
+// restored into an empty store with Logger.Restore. Given another
+// format, the events are exported in that format instead; such
+// exports are recorded as queries, and only the JSON formats keep
+// the signatures.
+func export(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	outFile := fs.String("o", "backup.jsonl", "output file")
+	format := fs.String("format", "backup", "output format: backup, json, jsonl, table, csv, cef, or ocsf")
+	df := newDBFlags(fs)
+	fs.Parse(args)
+	if *format != "backup" {
+		checkFormat(*format)
+	}
+
+	l := df.open()
+	defer l.Stop()
+
+	out, err := os.OpenFile(*outFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	checkerr(err)
+
+	if *format == "backup" {
+		ctx := auditlog.ContextWithAccessor(context.Background(), *df.accessor)
+		err = l.Backup(ctx, out)
+	} else {
+		var events []*auditlog.Event
+		events, err = l.Query(*df.accessor, auditlog.Query{})
+		if err == nil {
+			err = writeEvents(out, *format, events)
+		}
+	}
+
+	if err == nil {
+		err = out.Close()
+	}
+	checkerr(err)
+	fmt.Printf("wrote %s\n", *outFile)
+}
+
+// tail prints the last events in the chain matching the filters and,
+// with -follow, keeps printing new events as they are recorded, like
+// tail -f. It reads the database directly rather than through a
+// logger, so polling isn't recorded in the chain; given -url, it reads
+// through the HTTP API instead, where each read is recorded. Events
+// recorded under an encryption policy are labelled as encrypted.
+func tail(args []string) {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	count := fs.Uint64("n", 10, "number of existing events to print")
+	follow := fs.Bool("follow", false, "print new events as they are recorded")
+	interval := fs.Duration("interval", time.Second, "polling interval when following")
+	actor := fs.String("actor", "", "only print events from this actor")
+	level := fs.String("level", "", "only print events at or above this level")
+	format := fs.String("format", "console", "output format: plain, logfmt, json, or console")
+	apiURL := fs.String("url", "", "read the chain through the HTTP API at this URL")
+	tokenFile := fs.String("token-file", "", "file holding the bearer token for the HTTP API")
+	df := newDBFlags(fs)
+	fs.Parse(args)
+
+	formatter, err := auditlog.FormatterByName(*format)
+	checkerr(err)
+
+	var src tailSource
+	if *apiURL != "" {
+		src = newAPISource(*apiURL, *tokenFile)
+	} else {
+		cfg := df.loadConfig()
+		store, err := cfg.Store()
+		checkerr(err)
+		defer store.Close()
+		src = storeSource{store}
+	}
+
+	first, next := src.span()
+	events := lastEvents(src, first, next, *count)
+	for {
+		for _, ev := range events {
+			if *actor != "" && ev.Actor != *actor {
+				continue
+			}
+
+			if *level != "" && !auditlog.LevelAtLeast(ev.Level, *level) {
+				continue
+			}
+			tailEvent(formatter, ev)
+		}
+
+		if !*follow {
+			return
+		}
+		time.Sleep(*interval)
+
+		events = nil
+		if _, end := src.span(); end > next {
+			events = src.events(next, end)
+			next = end
+		}
+	}
+}
+
+func writeKey(path string, out []byte, perm os.FileMode) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	checkerr(err)
+
+	_, err = f.Write(out)
+	if err == nil {
+		err = f.Close()
+	}
+	checkerr(err)
+	fmt.Printf("wrote %s\n", path)
+}
+
+// keygen generates an ECDSA P-256 signing key, writing the private
+// key as PKCS#8, encrypted if a passphrase file is given, and the
+// public key in the format verify reads. Existing keys are never
+// overwritten.
+func keygen(args []string) {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	dir := fs.String("d", ".", "output directory")
+	passFile := fs.String("passphrase-file", "", "file holding a passphrase to encrypt the private key with")
+	withHMAC := fs.Bool("hmac", false, "also generate an HMAC chaining key")
+	fs.Parse(args)
+
+	var passphrase []byte
+	if *passFile != "" {
+		in, err := ioutil.ReadFile(*passFile)
+		checkerr(err)
+
+		passphrase = bytes.TrimRight(in, "\r\n")
+		if len(passphrase) == 0 {
+			checkerr(errors.New("the passphrase is empty"))
+		}
+	}
+
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	checkerr(err)
+
+	priv, err := auditlog.MarshalSigner(signer, passphrase)
+	checkerr(err)
+
+	pub, err := auditlog.MarshalPublicKey(&signer.PublicKey)
+	checkerr(err)
+
+	writeKey(filepath.Join(*dir, "signer.pem"), priv, 0600)
+	writeKey(filepath.Join(*dir, "logger.pub"), pub, 0644)
+
+	if *withHMAC {
+		key := make([]byte, auditlog.MinHMACKeySize)
+		_, err = rand.Read(key)
+		checkerr(err)
+		writeKey(filepath.Join(*dir, "chain.hmac"), auditlog.MarshalHMACKey(key), 0600)
+	}
+}
+
+// keys writes the chain's key history as a manifest that verify -keys
+// reads, so that verifiers can check a chain whose signing key has been
+// rotated.
+func keys(args []string) {
+	fs := flag.NewFlagSet("keys", flag.ExitOnError)
+	output := fs.String("o", "", "output file (default: standard output)")
+	df := newDBFlags(fs)
+	fs.Parse(args)
+
+	l := df.open()
+	history := l.KeyHistory()
+	l.Stop()
+
+	out, err := json.MarshalIndent(history, "", "    ")
+	checkerr(err)
+	out = append(out, '\n')
+
+	if *output == "" {
+		os.Stdout.Write(out)
+		return
+	}
+	checkerr(ioutil.WriteFile(*output, out, 0644))
+}
+
+func printCounts(title string, counts map[string]int) {
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Printf("%s:\n", title)
+	for _, name := range names {
+		fmt.Printf("\t%-20s %d\n", name, counts[name])
+	}
+}
+
+// stats summarises the chain and the events logged in a recent
+// period.
+func stats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	since := fs.Duration("since", 24*time.Hour, "length of the period")
+	df := newDBFlags(fs)
+	fs.Parse(args)
+
+	l := df.open()
+	defer l.Stop()
+
+	now := time.Now()
+	r, _, err := l.ReportAs(*df.accessor, now.Add(-*since), now)
+	checkerr(err)
+
+	fmt.Printf("chain:    %d events\n", l.Count())
+	if head, ok := l.Checkpoint(); ok {
+		fmt.Printf("head:     serial %d, signature %s\n", head.Serial, head.Head)
+	}
+	fmt.Printf("key:      %s\n", r.KeyFingerprint)
+
+	size, ok, err := l.StoreSize()
+	checkerr(err)
+	if ok {
+		fmt.Printf("size:     %s\n", formatSize(size))
+	}
+
+	fmt.Printf("period:   %s to %s\n", now.Add(-*since).Format(time.RFC3339), now.Format(time.RFC3339))
+	fmt.Printf("events:   %d (serials %d to %d)\n", r.Events, r.FirstSerial, r.LastSerial)
+	fmt.Printf("errors:   %d\n", r.Errors)
+	if r.Verified {
+		fmt.Printf("verified: yes\n")
+	} else {
+		fmt.Printf("verified: no (%s)\n", r.VerificationError)
+	}
+	printCounts("levels", r.Levels)
+	printCounts("actors", r.Actors)
+	printCounts("days", r.Days)
+}
+
+// formatSize formats a size in bytes using binary prefixes.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// migrate creates the database schema, if it isn't already present,
+// and applies any migrations it hasn't had. Given -from and -to, it
+// instead copies the chain from one store to another, verifying it as
+// it goes and cross-checking the copy.
+func migrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := fs.String("from", "", "store to copy the chain from")
+	to := fs.String("to", "", "empty store to copy the chain to")
+	keyFile := fs.String("k", "", "logger's public key (default: derived from the configured signing key)")
+	df := newDBFlags(fs)
+	fs.Parse(args)
+
+	if *from != "" || *to != "" {
+		migrateStores(df, *from, *to, *keyFile)
+		return
+	}
+
+	cfg := df.loadConfig()
+	before, after, err := auditlog.MigrateSchema(&cfg.DB)
+	checkerr(err)
+
+	switch {
+	case before == after:
+		fmt.Printf("the audit schema is up to date at version %d\n", after)
+	case before == 0:
+		fmt.Printf("the audit schema is now at version %d\n", after)
+	default:
+		fmt.Printf("migrated the audit schema from version %d to %d\n", before, after)
+	}
+}
+
+func migrateStores(df dbFlags, from, to, keyFile string) {
+	if from == "" || to == "" {
+		checkerr(errors.New("both -from and -to are required"))
+	}
+
+	pub := df.publicKey(keyFile)
+	if pub == nil {
+		checkerr(errors.New("a public key is needed to verify the chain; use -k"))
+	}
+
+	src, err := auditlog.OpenStore(from)
+	checkerr(err)
+	defer src.Close()
+
+	dst, err := auditlog.OpenStore(to)
+	checkerr(err)
+	defer dst.Close()
+
+	// Migrate reports progress as it copies the chain and then as it
+	// cross-verifies the copy.
+	phase := "copied"
+	err = auditlog.Migrate(context.Background(), dst, src, pub, func(done, total uint64) {
+		fmt.Fprintf(os.Stderr, "%s %d/%d events\n", phase, done, total)
+		if done == total {
+			phase = "verified"
+		}
+	})
+	checkerr(err)
+
+	count, err := dst.Count()
+	checkerr(err)
+	fmt.Printf("OK: migrated and verified %d events\n", count)
+}
+
+// diagnose checks the database for problems, without starting a
+// logger on it, and makes the safe repairs if asked. It exits with a
+// non-zero status if any errors are found.
+func diagnose(args []string) {
+	fs := flag.NewFlagSet("diagnose", flag.ExitOnError)
+	keyFile := fs.String("k", "", "logger's public key (default: derived from the configured signing key)")
+	fix := fs.Bool("fix", false, "make the repairs that are safe to make")
+	format := fs.String("format", "text", "report format: text or json")
+	df := newDBFlags(fs)
+	fs.Parse(args)
+
+	if *format != "text" && *format != "json" {
+		checkerr(fmt.Errorf("unknown report format %q", *format))
+	}
+
+	cfg := df.loadConfig()
+	pub := df.publicKey(*keyFile)
+
+	store, err := cfg.Store()
+	checkerr(err)
+	defer store.Close()
+
+	d, err := auditlog.Diagnose(store, pub)
+	checkerr(err)
+
+	var repairs []string
+	if *fix && d.Fixable() {
+		repairs, err = auditlog.Repair(store)
+		checkerr(err)
+	}
+
+	if *format == "json" {
+		out, err := json.MarshalIndent(struct {
+			*auditlog.Diagnosis
+			Repairs []string `json:"repairs,omitempty"`
+		}{d, repairs}, "", "    ")
+		checkerr(err)
+		fmt.Println(string(out))
+	} else {
+		fmt.Printf("chain:   %d events, held from serial %d\n", d.Count, d.Start)
+		fmt.Printf("checked: %s\n", strings.Join(d.Checked, ", "))
+		if pub == nil {
+			fmt.Println("no public key is available; signatures weren't checked")
+		}
+
+		for _, f := range d.Problems {
+			fmt.Printf("%-7s %s: %s", strings.ToLower(f.Level), f.Check, f.Message)
+			if f.Fixable {
+				fmt.Print(" (fixable with -fix)")
+			}
+			fmt.Println()
+
+			if len(f.Serials) > 0 {
+				fmt.Printf("        serials: %s\n", joinSerials(f.Serials))
+			}
+		}
+
+		for _, r := range repairs {
+			fmt.Printf("fixed:  %s\n", r)
+		}
+
+		if d.Healthy() {
+			fmt.Println("OK: no problems found")
+		}
+	}
+
+	for _, f := range d.Problems {
+		if f.Level == "ERROR" {
+			os.Exit(1)
+		}
+	}
+}
+
+func joinSerials(serials []uint64) string {
+	s := make([]string, len(serials))
+	for i, serial := range serials {
+		s[i] = strconv.FormatUint(serial, 10)
+	}
+	return strings.Join(s, " ")
+}
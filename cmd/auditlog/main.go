@@ -0,0 +1,140 @@
+// auditlog manages audit chains without writing Go. Each subcommand
+// is a thin wrapper around the library:
+//
+//	verify   verify certifications, or the chain in the database
+//	compare  find the point at which two certifications fork, or check
+//	         that one extends the other
+//	prove    write a consistency proof between two certifications
+//	certify  write a certification of a range of events
+//	query    search the chain
+//	export   write a signed backup snapshot of the chain
+//	tail     print recent events, and follow new ones
+//	keygen   generate a signing key
+//	keys     write the chain's key history as a key manifest
+//	stats    summarise the chain and the events logged in a recent period
+//	migrate  create the database schema, or move a chain between stores
+//	diagnose check the database for problems, and repair what is safe
+//
+// Commands that use the database read the configuration file named
+// by -c, or the AUDITLOG_* environment variables if none is given.
+// Reads through the logger are recorded in the chain under the name
+// given by -a, which defaults to the current user.
+package main
+
+import (
+	"crypto/ecdsa"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/kisom/auditlog"
+)
+
+type command struct {
+	usage string
+	run   func(args []string)
+}
+
+var commands = map[string]command{
+	"verify":   {"[-k logger.pub | -keys keys.json] [-hmac chain.hmac] [-state file] [-format format] [cert.json...]", verify},
+	"compare":  {"[-k logger.pub] [-proof proof.json] a.json b.json", compare},
+	"prove":    {"[-o proof.json] old.json new.json", prove},
+	"certify":  {"[-start serial] [-end serial] [-since time] [-until time] [-o cert.json] [-compress]", certify},
+	"query":    {"[-start serial] [-end serial] [-from time] [-until time] [-level level] [-min-level level] [-actor actor] [-event event] [-attr name=value] [-format format]", query},
+	"export":   {"[-o backup.jsonl] [-format format]", export},
+	"tail":     {"[-n count] [-follow] [-interval duration] [-actor actor] [-level level] [-format format] [-url url [-token-file file]]", tail},
+	"keygen":   {"[-d dir] [-passphrase-file file] [-hmac]", keygen},
+	"keys":     {"[-o keys.json]", keys},
+	"stats":    {"[-since duration]", stats},
+	"migrate":  {"[-from dsn -to dsn [-k logger.pub]]", migrate},
+	"diagnose": {"[-k logger.pub] [-fix] [-format text|json]", diagnose},
+}
+
+func checkerr(err error) {
+	if err == nil {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%v\n", err)
+	os.Exit(1)
+}
+
+func usage() {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: auditlog command [flags]\n\nCommands:\n")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "\t%s %s\n", name, commands[name].usage)
+	}
+	os.Exit(2)
+}
+
+// dbFlags holds the flags shared by the commands that use the
+// database.
+type dbFlags struct {
+	config   *string
+	accessor *string
+}
+
+func newDBFlags(fs *flag.FlagSet) dbFlags {
+	return dbFlags{
+		config:   fs.String("c", "", "configuration file (default: AUDITLOG_* environment)"),
+		accessor: fs.String("a", os.Getenv("USER"), "accessor recorded for reads"),
+	}
+}
+
+func (df dbFlags) loadConfig() *auditlog.Config {
+	if *df.config == "" {
+		cfg, err := auditlog.ConfigFromEnv()
+		checkerr(err)
+		return cfg
+	}
+
+	cfg, err := auditlog.LoadConfig(*df.config)
+	checkerr(err)
+	return cfg
+}
+
+// open builds a logger from the configuration; the chain is verified
+// as it is opened. Events recorded by the command aren't echoed.
+func (df dbFlags) open(opts ...auditlog.Option) *auditlog.Logger {
+	l, err := auditlog.NewFromConfig(df.loadConfig(), append([]auditlog.Option{auditlog.WithoutEcho()}, opts...)...)
+	checkerr(err)
+	return l
+}
+
+// publicKey loads the logger's public key from keyFile, or derives it
+// from the configured signing key if keyFile is empty. It returns nil
+// if no signing key is configured.
+func (df dbFlags) publicKey(keyFile string) *ecdsa.PublicKey {
+	if keyFile != "" {
+		pub, err := auditlog.LoadPublicKey(keyFile)
+		checkerr(err)
+		return pub
+	}
+
+	cfg := df.loadConfig()
+	if cfg.Key.File == "" {
+		return nil
+	}
+
+	signer, err := cfg.Key.Signer()
+	checkerr(err)
+	return &signer.PublicKey
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	cmd.run(os.Args[2:])
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/kisom/auditlog"
+)
+
+// outputFormats lists the formats events can be written in, with the
+// file extension used for each.
+var outputFormats = map[string]string{
+	"json":  ".json",
+	"jsonl": ".jsonl",
+	"table": ".txt",
+	"csv":   ".csv",
+	"cef":   ".cef",
+	"ocsf":  ".ocsf.jsonl",
+}
+
+func checkFormat(format string) {
+	if _, ok := outputFormats[format]; !ok {
+		checkerr(fmt.Errorf("unknown format %q (json, jsonl, table, csv, cef, or ocsf)", format))
+	}
+}
+
+func attributeList(ev *auditlog.Event) string {
+	var attrs []string
+	for _, attr := range ev.Attributes {
+		attrs = append(attrs, attr.Name+"="+attr.Value)
+	}
+	return strings.Join(attrs, " ")
+}
+
+func eventTime(ns int64) string {
+	return time.Unix(0, ns).UTC().Format(time.RFC3339Nano)
+}
+
+// writeEvents writes events to w in the named format. The JSON
+// formats keep every field of the events, including their signatures,
+// so the output can still be verified; the others are for people,
+// spreadsheets, and SIEMs.
+func writeEvents(w io.Writer, format string, events []*auditlog.Event) error {
+	switch format {
+	case "json":
+		if events == nil {
+			events = []*auditlog.Event{}
+		}
+
+		out, err := json.MarshalIndent(events, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", out)
+		return err
+	case "jsonl":
+		enc := json.NewEncoder(w)
+		for _, ev := range events {
+			if err := enc.Encode(ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "SERIAL\tTIME\tLEVEL\tACTOR\tEVENT\tATTRIBUTES")
+		for _, ev := range events {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", ev.Serial,
+				time.Unix(0, ev.When).UTC().Format(time.RFC3339), ev.Level,
+				ev.Actor, ev.Event, attributeList(ev))
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"serial", "when", "received", "level", "actor", "event", "attributes"})
+		for _, ev := range events {
+			cw.Write([]string{
+				strconv.FormatUint(ev.Serial, 10), eventTime(ev.When), eventTime(ev.Received),
+				ev.Level, ev.Actor, ev.Event, attributeList(ev),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "cef":
+		return auditlog.CEFExporter{}.Export(w, events)
+	case "ocsf":
+		return auditlog.OCSFExporter{}.Export(w, events)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
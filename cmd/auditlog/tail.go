@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kisom/auditlog"
+	"github.com/kisom/auditlog/server"
+)
+
+// A tailSource is the chain tail reads: the database, or a server
+// serving the HTTP API.
+type tailSource interface {
+	// span returns the serial number of the first event that
+	// hasn't been pruned, and the serial number the next event
+	// will take.
+	span() (first, end uint64)
+
+	// events returns the events with serial numbers in the range
+	// [start, end).
+	events(start, end uint64) []*auditlog.Event
+}
+
+// storeSource reads the chain from the database directly, so reads
+// aren't recorded in the chain.
+type storeSource struct {
+	store auditlog.Store
+}
+
+func (s storeSource) span() (first, end uint64) {
+	if pruner, ok := s.store.(auditlog.Pruner); ok {
+		pruned, _, ok, err := pruner.Pruned()
+		checkerr(err)
+		if ok {
+			first = pruned + 1
+		}
+	}
+
+	end, err := s.store.Count()
+	checkerr(err)
+	return first, end
+}
+
+func (s storeSource) events(start, end uint64) []*auditlog.Event {
+	events, err := s.store.Events(start, end-1)
+	checkerr(err)
+	return events
+}
+
+// apiSource reads the chain through the HTTP API served by the server
+// package. Reads through the API are recorded in the chain, so each
+// read adds an event that a later read returns.
+type apiSource struct {
+	url    string
+	token  string
+	client *http.Client
+
+	// read is the end of the span last read, which the query
+	// recorded by that read usually takes.
+	read uint64
+}
+
+func newAPISource(rawURL, tokenFile string) *apiSource {
+	a := &apiSource{
+		url:    strings.TrimSuffix(rawURL, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+
+	if tokenFile != "" {
+		token, err := ioutil.ReadFile(tokenFile)
+		checkerr(err)
+		a.token = string(bytes.TrimSpace(token))
+	}
+	return a
+}
+
+// get fetches a path from the API, decoding the JSON response into v.
+// It returns false if the response has no content.
+func (a *apiSource) get(path string, v interface{}) bool {
+	req, err := http.NewRequest(http.MethodGet, a.url+path, nil)
+	checkerr(err)
+
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+
+	resp, err := a.client.Do(req)
+	checkerr(err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return false
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		checkerr(fmt.Errorf("%s: %s: %s", path, resp.Status, bytes.TrimSpace(msg)))
+	}
+	checkerr(json.NewDecoder(resp.Body).Decode(v))
+	return true
+}
+
+// span returns the span of the chain from its head. The server clamps
+// queries to the events that haven't been pruned, so the chain is
+// taken to start at zero. A head that has only moved past the query
+// recorded by the last read isn't reported as new, so that following
+// the chain doesn't read its own queries forever.
+func (a *apiSource) span() (first, end uint64) {
+	var head auditlog.VerifiedHead
+	if !a.get("/head", &head) {
+		return 0, 0
+	}
+
+	end = head.Serial + 1
+	if a.read != 0 && end == a.read+1 {
+		end = a.read
+	}
+	return 0, end
+}
+
+// events reads the events in [start, end) in requests of at most
+// server.DefaultMaxRange events, the most a server reads by default.
+func (a *apiSource) events(start, end uint64) []*auditlog.Event {
+	if end <= start {
+		return nil
+	}
+
+	var selected []*auditlog.Event
+	for ; start < end; start += server.DefaultMaxRange {
+		last := end - 1
+		if last-start >= server.DefaultMaxRange {
+			last = start + server.DefaultMaxRange - 1
+		}
+
+		query := url.Values{}
+		query.Set("start", strconv.FormatUint(start, 10))
+		query.Set("end", strconv.FormatUint(last, 10))
+
+		var events []*auditlog.Event
+		a.get("/events?"+query.Encode(), &events)
+
+		// The server takes an end of zero as unset, reading
+		// past it, so events past the end are left out.
+		for _, ev := range events {
+			if ev.Serial <= last {
+				selected = append(selected, ev)
+			}
+		}
+	}
+	a.read = end
+	return selected
+}
+
+// lastEvents returns the last n events before serial number end,
+// reading back no further than first. Pruned serial numbers, and
+// those never stored in a chain with gapped serials, hold no events,
+// so the chain is read backwards in widening windows until n events
+// have been found.
+func lastEvents(src tailSource, first, end, n uint64) []*auditlog.Event {
+	var events []*auditlog.Event
+	window := n
+	for hi := end; hi > first && uint64(len(events)) < n; window *= 2 {
+		lo := first
+		if hi-first > window {
+			lo = hi - window
+		}
+
+		events = append(src.events(lo, hi), events...)
+		hi = lo
+	}
+
+	if uint64(len(events)) > n {
+		events = events[uint64(len(events))-n:]
+	}
+	return events
+}
+
+// tailEvent prints an event as tail does. Events recorded under an
+// encryption policy are labelled, as their values can't be read
+// without the key.
+func tailEvent(formatter auditlog.Formatter, ev *auditlog.Event) {
+	if auditlog.Encrypted(ev) {
+		fmt.Printf("%d [encrypted] %s\n", ev.Serial, formatter.Format(ev))
+		return
+	}
+	fmt.Printf("%d %s\n", ev.Serial, formatter.Format(ev))
+}
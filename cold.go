@@ -0,0 +1,235 @@
+package auditlog
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// A ColdStore is long-term storage for archived chain segments, such
+// as an object store with a cold storage class or a tape gateway.
+// Put stores data under name and returns a location from which Get
+// can retrieve it.
+type ColdStore interface {
+	Put(name string, data []byte) (location string, err error)
+	Get(location string) ([]byte, error)
+}
+
+// A DirColdStore keeps archived segments as files in a directory,
+// which may be a mounted tape or storage gateway.
+type DirColdStore string
+
+// Put writes data to a file named name in the directory.
+func (dir DirColdStore) Put(name string, data []byte) (string, error) {
+	return DirArchiver(dir).Archive(name, data)
+}
+
+// Get reads the file at location.
+func (dir DirColdStore) Get(location string) ([]byte, error) {
+	return ioutil.ReadFile(location)
+}
+
+// A Manifest describes an archived chain segment. Root is the
+// hex-encoded root of a Merkle tree whose leaves are the JSON
+// encodings of the segment's events, so that individual events can
+// be checked against the manifest, and Digest is the hex-encoded
+// SHA-256 digest of the segment's certification.
+type Manifest struct {
+	Name   string `json:"name"`
+	Start  uint64 `json:"start"`
+	End    uint64 `json:"end"`
+	Events int    `json:"events"`
+	Root   string `json:"root"`
+	Digest string `json:"digest"`
+}
+
+// newManifest builds the manifest for a certification.
+func newManifest(name string, cert []byte) (*Manifest, error) {
+	var cl Certification
+	err := json.Unmarshal(cert, &cl)
+	if err != nil {
+		return nil, err
+	}
+
+	var leaves [][]byte
+	for _, ev := range cl.Chain {
+		if ev == nil {
+			return nil, errors.New("auditlog: null event in segment")
+		}
+
+		out, err := json.Marshal(ev)
+		if err != nil {
+			return nil, err
+		}
+		leaves = append(leaves, merkleLeaf(out))
+	}
+
+	digest := sha256.Sum256(cert)
+	m := &Manifest{
+		Name:   name,
+		Events: len(cl.Chain),
+		Root:   hex.EncodeToString(merkleRoot(leaves)),
+		Digest: hex.EncodeToString(digest[:]),
+	}
+
+	if len(cl.Chain) > 0 {
+		m.Start = cl.Chain[0].Serial
+		m.End = cl.Chain[len(cl.Chain)-1].Serial
+	}
+	return m, nil
+}
+
+// A ColdArchiver is an Archiver that packages each segment's
+// certification together with its manifest as a tar file, and stores
+// the package in a ColdStore.
+type ColdArchiver struct {
+	Store ColdStore
+}
+
+const (
+	segmentFile  = "segment.json"
+	manifestFile = "manifest.json"
+)
+
+// Archive packages and stores a certification.
+func (ca ColdArchiver) Archive(name string, data []byte) (string, error) {
+	m, err := newManifest(name, data)
+	if err != nil {
+		return "", err
+	}
+
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{segmentFile, data},
+		{manifestFile, manifest},
+	} {
+		err = tw.WriteHeader(&tar.Header{
+			Name:    file.name,
+			Mode:    0444,
+			Size:    int64(len(file.data)),
+			ModTime: time.Unix(0, 0),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		_, err = tw.Write(file.data)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return ca.Store.Put(name+".tar", buf.Bytes())
+}
+
+// unpackSegment reads the certification and manifest from a package
+// written by ColdArchiver.
+func unpackSegment(pkg []byte) (cert []byte, m *Manifest, err error) {
+	var manifest []byte
+	tr := tar.NewReader(bytes.NewReader(pkg))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch hdr.Name {
+		case segmentFile:
+			cert = data
+		case manifestFile:
+			manifest = data
+		}
+	}
+
+	if cert == nil || manifest == nil {
+		return nil, nil, errors.New("auditlog: incomplete segment package")
+	}
+
+	m = &Manifest{}
+	err = json.Unmarshal(manifest, m)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, m, nil
+}
+
+// ErrSegmentMismatch is returned when a restored segment doesn't
+// match its manifest or the chain it was pruned from.
+var ErrSegmentMismatch = errors.New("auditlog: archived segment failed verification")
+
+// RestoreSegment retrieves a segment archived by a ColdArchiver and
+// verifies it: the segment must match its manifest, and must match
+// the "pruned range" event recorded in the chain when it was pruned,
+// as described in VerifyArchive. If the event that followed the
+// segment is still in the chain, it must verify against the
+// segment's last signature. The marker's location attribute is used
+// to retrieve the segment from store.
+func (l *Logger) RestoreSegment(store ColdStore, marker *Event) (*Certification, *Manifest, error) {
+	location, ok := marker.attr("location")
+	if !ok {
+		return nil, nil, ErrSegmentMismatch
+	}
+
+	pkg, err := store.Get(location)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, m, err := unpackSegment(pkg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expected, err := newManifest(m.Name, cert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if *expected != *m {
+		return nil, nil, ErrSegmentMismatch
+	}
+
+	_, public, keys := l.signingKeys()
+	cl, ok := VerifyArchive(marker, cert, public, VerifyKeys(keys))
+	if !ok {
+		return nil, nil, ErrSegmentMismatch
+	}
+
+	last := cl.Chain[len(cl.Chain)-1]
+	next, err := l.store.Event(last.Serial + 1)
+	if err == nil {
+		if !keys.verify(next, last.Signature) {
+			return nil, nil, ErrSegmentMismatch
+		}
+	} else if err != ErrNoEvent {
+		return nil, nil, err
+	}
+	return cl, m, nil
+}
@@ -0,0 +1,72 @@
+package auditlog
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestColdArchiver(t *testing.T) {
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, store := newTestLogger(t,
+		WithClock(NewFixedClock(start, time.Minute)))
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 10; i++ {
+		l.InfoSync("cold_test", "tick", nil)
+	}
+
+	cold := DirColdStore(t.TempDir())
+	err := l.Prune(4, ColdArchiver{cold})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	marker, err := store.Event(10)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cl, m, err := l.RestoreSegment(cold, marker)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(cl.Chain) != 5 || m.Start != 0 || m.End != 4 || m.Events != 5 {
+		t.Fatalf("wrong segment restored: %+v", m)
+	}
+
+	// Corrupt the package.
+	location, _ := marker.attr("location")
+	pkg, err := ioutil.ReadFile(location)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	corrupt := DirColdStore(t.TempDir())
+	pkg[len(pkg)/3] ^= 1
+	path, err := corrupt.Put("corrupt.tar", pkg)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	tampered := copyEvent(marker)
+	for i := range tampered.Attributes {
+		if tampered.Attributes[i].Name == "location" {
+			tampered.Attributes[i].Value = path
+		}
+	}
+
+	if _, _, err = l.RestoreSegment(corrupt, tampered); err == nil {
+		t.Fatal("corrupted segment was restored")
+	}
+}
+
+func TestMerkleRoot(t *testing.T) {
+	a, b, c := merkleLeaf([]byte("a")), merkleLeaf([]byte("b")), merkleLeaf([]byte("c"))
+	expected := merkleNode(merkleNode(a, b), c)
+	if string(merkleRoot([][]byte{a, b, c})) != string(expected) {
+		t.Fatal("wrong Merkle root for three leaves")
+	}
+}
@@ -0,0 +1,132 @@
+package auditlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"time"
+)
+
+// packAttributes compresses an event's attributes for storage. The
+// attributes are encoded losslessly, so an event restored with
+// unpackAttributes has the same signature input as the original.
+func packAttributes(attrs []Attribute) ([]byte, error) {
+	in, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err = zw.Write(in)
+	if err != nil {
+		return nil, err
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unpackAttributes restores attributes compressed by packAttributes.
+func unpackAttributes(packed []byte) ([]Attribute, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	in, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs []Attribute
+	err = json.Unmarshal(in, &attrs)
+	if err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// A CompressionPolicy compresses the attributes of events older than
+// MaxAge. The policy is applied every Interval while the logger is
+// running.
+type CompressionPolicy struct {
+	MaxAge   time.Duration
+	Interval time.Duration
+}
+
+// WithCompression applies a compression policy. The logger's store
+// must implement Compressor.
+func WithCompression(policy CompressionPolicy) Option {
+	return func(l *Logger) {
+		if policy.MaxAge <= 0 || policy.Interval <= 0 {
+			return
+		}
+
+		l.addTask(every(policy.Interval, false, func(l *Logger) {
+			err := l.CompressBefore(time.Unix(0, l.now()).Add(-policy.MaxAge))
+			if err != nil {
+				l.logInternal(levelError, "compression failure", []Attribute{
+					{"error", err.Error()},
+				})
+			}
+		}))
+	}
+}
+
+// ErrNotCompressible is returned when compression is requested on a
+// store that doesn't implement Compressor.
+var ErrNotCompressible = errors.New("auditlog: store does not support compression")
+
+// CompressBefore compresses the attributes of the events logged
+// before cutoff. Compressed events are restored transparently when
+// they are loaded, so their signatures still verify. If any events
+// were compressed, a "payloads compressed" event is recorded.
+func (l *Logger) CompressBefore(cutoff time.Time) error {
+	compressor, ok := l.store.(Compressor)
+	if !ok {
+		return ErrNotCompressible
+	}
+
+	start, _, err := l.chainStart()
+	if err != nil {
+		return err
+	}
+
+	head := l.Count()
+	end := start
+	for ; end < head; end++ {
+		ev, err := l.store.Event(end)
+		if err != nil {
+			return err
+		}
+
+		if ev.When >= cutoff.UnixNano() {
+			break
+		}
+	}
+
+	if end == start {
+		return nil
+	}
+
+	n, err := compressor.Compress(end - 1)
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		l.logInternal(levelInfo, "payloads compressed", []Attribute{
+			{"end", strconv.FormatUint(end-1, 10)},
+			{"events", strconv.Itoa(n)},
+		})
+	}
+	return nil
+}
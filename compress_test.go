@@ -0,0 +1,64 @@
+package auditlog
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCompressBefore(t *testing.T) {
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, store := newTestLogger(t,
+		WithClock(NewFixedClock(start, time.Minute)))
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 10; i++ {
+		l.InfoSync("compress_test", "tick", []Attribute{
+			{"count", fmt.Sprintf("%d", i)},
+		})
+	}
+
+	// As in TestPruneBefore, events 0 through 4 were logged before
+	// the cutoff.
+	err := l.CompressBefore(start.Add(9 * time.Minute))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(store.packed) != 5 {
+		t.Fatalf("expected 5 compressed events, have %d", len(store.packed))
+	}
+
+	ev, err := store.Event(4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if value, _ := ev.attr("count"); value != "4" {
+		t.Fatalf("expected count=4 in restored event, have %q", value)
+	}
+
+	marker, err := store.Event(10)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if marker.Event != "payloads compressed" {
+		t.Fatalf("expected a compression event, have %q", marker.Event)
+	}
+
+	if err = l.verifyAuditChain(); err != nil {
+		t.Fatalf("compressed chain failed to verify: %v", err)
+	}
+
+	// Compressing the same range again is a no-op.
+	err = l.CompressBefore(start.Add(9 * time.Minute))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if l.Count() != 11 {
+		t.Fatalf("expected 11 events, have %d", l.Count())
+	}
+}
@@ -0,0 +1,515 @@
+package auditlog
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Verification modes control how much of an existing audit chain is
+// checked when a logger is created.
+const (
+	// VerifyFull verifies every event in the chain at startup.
+	VerifyFull = "full"
+
+	// VerifyNone skips startup verification entirely. This should
+	// only be used when the chain is verified out of band.
+	VerifyNone = "none"
+
+	// VerifyCheckpoint records signed checkpoints every
+	// DefaultSignedCheckpointInterval, and verifies only the events
+	// after the latest one at startup; see WithSignedCheckpoints.
+	VerifyCheckpoint = "checkpoint"
+
+	// VerifyBackground verifies the chain in the background once
+	// the logger has started; see WithBackgroundVerification.
+	VerifyBackground = "background"
+)
+
+// DefaultSignedCheckpointInterval is the interval between the signed
+// checkpoints recorded under VerifyCheckpoint.
+const DefaultSignedCheckpointInterval = time.Hour
+
+// DefaultQueueSize is the number of events that may be waiting to be
+// recorded before callers block, or events are dropped; see
+// OverflowPolicy.
+const DefaultQueueSize = 16
+
+// KeyConfig describes where the logger's signing key is found.
+type KeyConfig struct {
+	// File is the path to a PEM-encoded ECDSA private key.
+	File string `yaml:"file" toml:"file"`
+
+	// PassphraseFile is the path to a file holding the passphrase
+	// for an encrypted key; see MarshalSigner.
+	PassphraseFile string `yaml:"passphrase_file" toml:"passphrase_file"`
+
+	// HMACFile is the path to an HMAC key, as written by
+	// MarshalHMACKey, with which events are tagged in place of
+	// signatures; see WithHMACChaining.
+	HMACFile string `yaml:"hmac_file" toml:"hmac_file"`
+}
+
+// Signer loads the signing key, decrypting it with the passphrase
+// if one is configured.
+func (kc KeyConfig) Signer() (*ecdsa.PrivateKey, error) {
+	if kc.PassphraseFile == "" {
+		return LoadSigner(kc.File)
+	}
+
+	passphrase, err := loadPassphrase(kc.PassphraseFile)
+	if err != nil {
+		return nil, err
+	}
+	return LoadEncryptedSigner(kc.File, passphrase)
+}
+
+// A SinkConfig describes an additional destination to which
+// recorded events are echoed. Type is one of "stdout", "stderr", or
+// "file"; Path is only used for file sinks. If Levels is empty, every
+// event is echoed to the sink. Format optionally overrides the
+// configuration's format for this sink.
+type SinkConfig struct {
+	Type   string   `yaml:"type" toml:"type"`
+	Path   string   `yaml:"path" toml:"path"`
+	Levels []string `yaml:"levels" toml:"levels"`
+	Format string   `yaml:"format" toml:"format"`
+}
+
+// Config collects the settings needed to build a logger, so that the
+// command line tools and long-running services can share a single
+// configuration file.
+type Config struct {
+	// Backend selects the storage backend: "postgres", the
+	// default, "mysql" for MySQL or MariaDB, "sqlite", or "file"
+	// for an append-only log file; the last two keep the chain in
+	// the file named by DB.Name. It overrides DB.Backend if set.
+	Backend string `yaml:"backend" toml:"backend"`
+
+	// DB contains the database connection parameters.
+	DB DBConnDetails `yaml:"db" toml:"db"`
+
+	// Key locates the signing key.
+	Key KeyConfig `yaml:"key" toml:"key"`
+
+	// QueueSize is the depth of the queue of events waiting to be
+	// recorded. If zero, DefaultQueueSize is used.
+	QueueSize int `yaml:"queue_size" toml:"queue_size"`
+
+	// Overflow is what happens to events that don't wait to be
+	// recorded when the queue is full: "block" (the default),
+	// "drop", or "expand"; see OverflowPolicy.
+	Overflow string `yaml:"overflow" toml:"overflow"`
+
+	// Lease requires the logger to hold the database's lease on
+	// the chain while it runs, so that standby loggers can share
+	// the database; see WithLease.
+	Lease bool `yaml:"lease" toml:"lease"`
+
+	// Durability is the durability of recorded events: "async",
+	// "local", or "full" (the default); see Durability.
+	Durability string `yaml:"durability" toml:"durability"`
+
+	// OnFailure is what the logger does when it can't store an
+	// event: "panic" (the default), "block", or "spill", which
+	// appends the event to SpillFile; see FailureMode.
+	OnFailure string `yaml:"on_failure" toml:"on_failure"`
+
+	// SpillFile is the file events are spilled to when OnFailure
+	// is "spill", and must be given for it. Spilled events aren't
+	// encrypted, so it should be as well protected as the store.
+	SpillFile string `yaml:"spill_file" toml:"spill_file"`
+
+	// LegacyDigests records new events with DigestLegacy rather
+	// than DigestCBOR; see WithLegacyDigests.
+	LegacyDigests bool `yaml:"legacy_digests" toml:"legacy_digests"`
+
+	// Serials is the serial policy: "contiguous" (the default) or
+	// "gapped"; see SerialPolicy.
+	Serials string `yaml:"serials" toml:"serials"`
+
+	// Verify is the startup verification mode, one of VerifyFull,
+	// VerifyCheckpoint, VerifyBackground, or VerifyNone. If empty,
+	// the full chain is verified.
+	Verify string `yaml:"verify" toml:"verify"`
+
+	// TrustedHead is the path to a verified head, as written by
+	// SaveVerifiedHead, after which the chain is verified at
+	// startup; see WithTrustedHead. If the file doesn't exist, the
+	// whole chain is verified.
+	TrustedHead string `yaml:"trusted_head" toml:"trusted_head"`
+
+	// WORM requires the database connection to be write-once; see
+	// WithWORM and SetupWORMRole.
+	WORM bool `yaml:"worm" toml:"worm"`
+
+	// MinLevel is the minimum level of events that are recorded,
+	// e.g. "INFO" to discard DEBUG events. All events are recorded
+	// if it is empty.
+	MinLevel string `yaml:"min_level" toml:"min_level"`
+
+	// Actors lists the actors permitted to record events, and
+	// ActorPattern is a regular expression matching additional
+	// permitted actors. If either is set, events from other actors
+	// are rejected; see WithActors.
+	Actors       []string `yaml:"actors" toml:"actors"`
+	ActorPattern string   `yaml:"actor_pattern" toml:"actor_pattern"`
+
+	// Format names the formatter used to echo events: "plain"
+	// (the default), "logfmt", "json", "console", or "cef".
+	Format string `yaml:"format" toml:"format"`
+
+	// Sinks lists the destinations events are echoed to. If any
+	// sinks are given, they replace the default echo to standard
+	// output and standard error.
+	Sinks []SinkConfig `yaml:"sinks" toml:"sinks"`
+
+	// Rules lists the alerting rules evaluated against recorded
+	// events; see Rule.
+	Rules []RuleConfig `yaml:"rules" toml:"rules"`
+}
+
+// LoadConfig reads a configuration file. The format is chosen by the
+// file's extension: ".yaml" and ".yml" files are parsed as YAML, and
+// ".toml" files as TOML.
+func LoadConfig(path string) (*Config, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(in, &cfg)
+	case ".toml":
+		err = toml.Unmarshal(in, &cfg)
+	default:
+		err = fmt.Errorf("auditlog: unknown configuration format for %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// backend returns the configured storage backend.
+func (cfg *Config) backend() string {
+	if cfg.Backend != "" {
+		return cfg.Backend
+	}
+	return cfg.DB.Backend
+}
+
+// Store opens the configured store.
+func (cfg *Config) Store() (Store, error) {
+	cd := cfg.DB
+	cd.Backend = cfg.backend()
+	return NewStore(&cd)
+}
+
+// Validate checks the configuration for unsupported values.
+func (cfg *Config) Validate() error {
+	switch cfg.backend() {
+	case "", "postgres", "mysql":
+	case "sqlite":
+		if cfg.DB.Name == "" {
+			return errors.New("auditlog: no SQLite database file configured")
+		}
+	case "file":
+		if cfg.DB.Name == "" {
+			return errors.New("auditlog: no log file configured")
+		}
+	default:
+		return fmt.Errorf("auditlog: unsupported backend %q", cfg.backend())
+	}
+
+	switch cfg.Verify {
+	case "", VerifyFull, VerifyCheckpoint, VerifyBackground, VerifyNone:
+	default:
+		return fmt.Errorf("auditlog: unsupported verification mode %q", cfg.Verify)
+	}
+
+	if _, err := FormatterByName(cfg.Format); err != nil {
+		return err
+	}
+
+	if cfg.MinLevel != "" && levelFromString(cfg.MinLevel) == levelUnknown {
+		return fmt.Errorf("auditlog: unknown minimum level %q", cfg.MinLevel)
+	}
+
+	if _, err := regexp.Compile(cfg.ActorPattern); err != nil {
+		return err
+	}
+
+	if cfg.QueueSize < 0 {
+		return errors.New("auditlog: queue size cannot be negative")
+	}
+
+	if _, ok := overflowPolicies[cfg.Overflow]; !ok {
+		return fmt.Errorf("auditlog: unsupported overflow policy %q", cfg.Overflow)
+	}
+
+	if _, ok := durabilities[cfg.Durability]; !ok {
+		return fmt.Errorf("auditlog: unsupported durability %q", cfg.Durability)
+	}
+
+	if _, ok := failureModes[cfg.OnFailure]; !ok {
+		return fmt.Errorf("auditlog: unsupported failure mode %q", cfg.OnFailure)
+	}
+
+	if failureModes[cfg.OnFailure] == FailSpill && cfg.SpillFile == "" {
+		return errors.New("auditlog: spilling events requires a spill file")
+	}
+
+	if _, ok := serialPolicies[cfg.Serials]; !ok {
+		return fmt.Errorf("auditlog: unsupported serial policy %q", cfg.Serials)
+	}
+
+	for i := range cfg.Rules {
+		if _, err := cfg.Rules[i].rule(); err != nil {
+			return err
+		}
+	}
+
+	for _, sink := range cfg.Sinks {
+		switch sink.Type {
+		case "stdout", "stderr":
+		case "file":
+			if sink.Path == "" {
+				return errors.New("auditlog: file sink requires a path")
+			}
+		default:
+			return fmt.Errorf("auditlog: unsupported sink type %q", sink.Type)
+		}
+
+		if _, err := FormatterByName(sink.Format); err != nil {
+			return err
+		}
+
+		for _, level := range sink.Levels {
+			if levelFromString(level) == levelUnknown {
+				return fmt.Errorf("auditlog: unknown level %q in sink", level)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadSigner reads a PEM-encoded ECDSA private key from a file. Keys
+// encrypted with a passphrase must be read with LoadEncryptedSigner.
+func LoadSigner(path string) (*ecdsa.PrivateKey, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, _ := pem.Decode(in)
+	if p == nil {
+		return nil, errors.New("auditlog: no PEM-encoded key found in " + path)
+	}
+
+	switch p.Type {
+	case "ENCRYPTED PRIVATE KEY":
+		return nil, ErrKeyEncrypted
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(p.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(p.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("auditlog: signing key is not an ECDSA key")
+		}
+		return signer, nil
+	default:
+		return nil, errors.New("auditlog: unsupported key type " + p.Type)
+	}
+}
+
+// ParsePublicKey parses a logger's public key, either PEM-encoded as
+// an "EC PUBLIC KEY" or "PUBLIC KEY" block or as raw DER-encoded PKIX
+// (the format returned by Logger.Public).
+func ParsePublicKey(in []byte) (*ecdsa.PublicKey, error) {
+	p, _ := pem.Decode(in)
+	if p != nil {
+		if p.Type != "EC PUBLIC KEY" && p.Type != "PUBLIC KEY" {
+			return nil, errors.New("auditlog: unsupported public key type " + p.Type)
+		}
+		in = p.Bytes
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(in)
+	if err != nil {
+		return nil, err
+	}
+
+	ecpub, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("auditlog: public key is not an ECDSA key")
+	}
+	return ecpub, nil
+}
+
+// LoadPublicKey reads a logger's public key from a file; see
+// ParsePublicKey for the accepted formats.
+func LoadPublicKey(path string) (*ecdsa.PublicKey, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParsePublicKey(in)
+}
+
+// NewFromConfig builds a logger from a configuration, loading the
+// signing key and opening the database it describes. The options are
+// applied after the configuration.
+func NewFromConfig(cfg *Config, opts ...Option) (*Logger, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Key.File == "" {
+		return nil, errors.New("auditlog: no signing key configured")
+	}
+
+	signer, err := cfg.Key.Signer()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Logger{
+		signer:        signer,
+		stdout:        os.Stdout,
+		stderr:        os.Stderr,
+		queueSize:     cfg.QueueSize,
+		overflow:      overflowPolicies[cfg.Overflow],
+		serials:       serialPolicies[cfg.Serials],
+		durability:    durabilities[cfg.Durability],
+		legacyDigests: cfg.LegacyDigests,
+	}
+
+	l.formatter, err = FormatterByName(cfg.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Key.HMACFile != "" {
+		key, err := LoadHMACKey(cfg.Key.HMACFile)
+		if err != nil {
+			return nil, err
+		}
+		WithHMACChaining(key)(l)
+	}
+
+	WithMinLevel(cfg.MinLevel)(l)
+
+	if cfg.WORM {
+		WithWORM()(l)
+	}
+
+	if cfg.Lease {
+		WithLease()(l)
+	}
+
+	if cfg.Verify == VerifyCheckpoint {
+		WithSignedCheckpoints(DefaultSignedCheckpointInterval)(l)
+	}
+
+	if cfg.Verify == VerifyBackground {
+		WithBackgroundVerification(nil)(l)
+	}
+
+	if cfg.TrustedHead != "" {
+		head, err := LoadVerifiedHead(cfg.TrustedHead)
+		if err == nil {
+			WithTrustedHead(head)(l)
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if len(cfg.Actors) > 0 {
+		l.registerActors(cfg.Actors)
+	}
+
+	if cfg.ActorPattern != "" {
+		WithActorPattern(regexp.MustCompile(cfg.ActorPattern))(l)
+	}
+
+	var rules []*Rule
+	for i := range cfg.Rules {
+		r, err := cfg.Rules[i].rule()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+
+	if len(rules) > 0 {
+		WithRules(rules...)(l)
+	}
+
+	if len(cfg.Sinks) > 0 {
+		l.stdout = nil
+		l.stderr = nil
+		for _, sc := range cfg.Sinks {
+			s, err := openSink(sc)
+			if err != nil {
+				l.closeSinks()
+				return nil, err
+			}
+			l.sinks = append(l.sinks, s)
+		}
+	}
+
+	policy := FailurePolicy{Mode: failureModes[cfg.OnFailure]}
+	if policy.Mode == FailSpill {
+		l.spill, err = openSink(SinkConfig{Type: "file", Path: cfg.SpillFile})
+		if err != nil {
+			l.closeSinks()
+			return nil, err
+		}
+		policy.Spill = l.spill
+	}
+	WithFailurePolicy(policy)(l)
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	store, err := cfg.Store()
+	if err != nil {
+		l.closeSinks()
+		return nil, err
+	}
+
+	err = l.init(store, cfg.Verify != VerifyNone)
+	if err != nil {
+		store.Close()
+		l.closeSinks()
+		return nil, err
+	}
+	return l, nil
+}
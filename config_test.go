@@ -0,0 +1,116 @@
+package auditlog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	expected := &Config{
+		Backend: "postgres",
+		DB: DBConnDetails{
+			Name: "auditlog",
+			User: "auditor",
+			Host: "localhost",
+			Port: "5432",
+			SSL:  true,
+		},
+		Key:       KeyConfig{File: "/etc/auditlog/signer.pem"},
+		QueueSize: 64,
+		Verify:    VerifyFull,
+		Sinks: []SinkConfig{
+			{
+				Type:   "stderr",
+				Levels: []string{"warning", "error", "critical"},
+			},
+		},
+		Rules: []RuleConfig{
+			{
+				Name:      "repeated login failures",
+				Event:     "login failure",
+				GroupBy:   "user",
+				Threshold: 5,
+				Window:    "1m",
+				Notify: []NotifierConfig{
+					{Type: "webhook", URL: "https://alerts.example.net/audit"},
+				},
+			},
+		},
+	}
+
+	for _, path := range []string{"testdata/config.yaml", "testdata/config.toml"} {
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		if !reflect.DeepEqual(cfg, expected) {
+			t.Fatalf("%s: expected %+v, have %+v", path, expected, cfg)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	bad := []Config{
+		{Backend: "oracle"},
+		{Backend: "sqlite"},
+		{DB: DBConnDetails{Backend: "oracle"}},
+		{Verify: "sometimes"},
+		{QueueSize: -1},
+		{Overflow: "spill"},
+		{OnFailure: "spill"},
+		{Serials: "random"},
+		{Durability: "eventual"},
+		{Sinks: []SinkConfig{{Type: "file"}}},
+		{Sinks: []SinkConfig{{Type: "stdout", Levels: []string{"loud"}}}},
+		{Rules: []RuleConfig{{Name: "r", Window: "soon"}}},
+		{Rules: []RuleConfig{{Name: "r", Notify: []NotifierConfig{{Type: "pager"}}}}},
+	}
+
+	for i := range bad {
+		if err := bad[i].Validate(); err == nil {
+			t.Fatalf("expected configuration %d to be rejected", i)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv(EnvDBName, "auditlog")
+	t.Setenv(EnvDBUser, "auditor")
+	t.Setenv(EnvDBPassword, "hunter2")
+	t.Setenv(EnvDBHost, "db")
+	t.Setenv(EnvDBPort, "5433")
+	t.Setenv(EnvDBSSL, "false")
+	t.Setenv(EnvKeyFile, "/run/secrets/signer.pem")
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	expected := DBConnDetails{
+		Name:     "auditlog",
+		User:     "auditor",
+		Password: "hunter2",
+		Host:     "db",
+		Port:     "5433",
+	}
+	if cfg.DB != expected {
+		t.Fatalf("expected %+v, have %+v", expected, cfg.DB)
+	}
+
+	if cfg.Key.File != "/run/secrets/signer.pem" {
+		t.Fatalf("bad key file %s", cfg.Key.File)
+	}
+
+	t.Setenv(EnvDBSSL, "maybe")
+	if _, err = ConfigFromEnv(); err == nil {
+		t.Fatal("expected invalid AUDITLOG_DB_SSL to be rejected")
+	}
+
+	t.Setenv(EnvDBSSL, "false")
+	t.Setenv(EnvDBBackend, "oracle")
+	if cfg, err = ConfigFromEnv(); err == nil || cfg != nil {
+		t.Fatal("expected an invalid configuration to be rejected")
+	}
+}
@@ -0,0 +1,210 @@
+package auditlog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrInconsistent is returned when a later certification isn't an
+// append-only extension of an earlier one: the chain has been
+// truncated and regrown, or otherwise rewritten, between them.
+var ErrInconsistent = errors.New("auditlog: certifications are inconsistent")
+
+// A ConsistencyProof shows that a newer certification extends an
+// older one. Old and New are the serial numbers of the two heads, and
+// Events links them: the events following the older head up to the
+// first event of the newer certification, which is where the newer
+// chain picks up. If the newer certification already holds the older
+// head, no events are needed.
+type ConsistencyProof struct {
+	Old    uint64   `json:"old"`
+	New    uint64   `json:"new"`
+	Events []*Event `json:"events"`
+}
+
+// certificationHeads decodes two certifications, returning them
+// without verifying them; each must hold at least one event.
+func certificationHeads(older, newer []byte) (*Certification, *Certification, error) {
+	var co, cn Certification
+	if err := json.Unmarshal(older, &co); err != nil {
+		return nil, nil, err
+	}
+
+	if err := json.Unmarshal(newer, &cn); err != nil {
+		return nil, nil, err
+	}
+
+	for _, cl := range []*Certification{&co, &cn} {
+		if len(cl.Chain) == 0 {
+			return nil, nil, errors.New("auditlog: certification holds no events")
+		}
+
+		for _, ev := range cl.Chain {
+			if ev == nil {
+				return nil, nil, errors.New("auditlog: certification holds a null event")
+			}
+		}
+	}
+
+	if cn.head().Serial < co.head().Serial {
+		return nil, nil, errors.New("auditlog: the newer certification ends before the older one")
+	}
+	return &co, &cn, nil
+}
+
+// head returns the last event in the certification.
+func (cl *Certification) head() *Event {
+	return cl.Chain[len(cl.Chain)-1]
+}
+
+// ProveConsistency returns a JSON-encoded consistency proof that the
+// newer certification extends the older one, both having been
+// produced by the logger; see VerifyConsistency. The older head must
+// not have been pruned. If the chain no longer holds either head as
+// certified, it has been rewritten since, and the error wraps
+// ErrInconsistent.
+func (l *Logger) ProveConsistency(older, newer []byte) ([]byte, error) {
+	co, cn, err := certificationHeads(older, newer)
+	if err != nil {
+		return nil, err
+	}
+
+	l.pruneLock.Lock()
+	defer l.pruneLock.Unlock()
+
+	l.lock.Lock()
+	start, _, err := l.chainStart()
+	counter := l.counter
+	l.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	oldHead, first := co.head(), cn.Chain[0]
+	if oldHead.Serial < start {
+		return nil, fmt.Errorf("auditlog: event %d has been pruned", oldHead.Serial)
+	}
+
+	if cn.head().Serial >= counter {
+		return nil, fmt.Errorf("%w: event %d is missing", ErrInconsistent, cn.head().Serial)
+	}
+
+	for _, certified := range []*Event{oldHead, cn.head()} {
+		ev, err := l.store.Event(certified.Serial)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(ev.Signature, certified.Signature) {
+			return nil, fmt.Errorf("%w: event %d differs", ErrInconsistent, certified.Serial)
+		}
+	}
+
+	proof := ConsistencyProof{Old: oldHead.Serial, New: cn.head().Serial}
+	for serial := oldHead.Serial + 1; serial <= first.Serial; serial += backupBatch {
+		last := serial + backupBatch - 1
+		if last > first.Serial {
+			last = first.Serial
+		}
+
+		events, err := l.store.Events(serial, last)
+		if err != nil {
+			return nil, err
+		}
+		proof.Events = append(proof.Events, events...)
+	}
+
+	if n := len(proof.Events); n > 0 && !bytes.Equal(proof.Events[n-1].Signature, first.Signature) {
+		return nil, fmt.Errorf("%w: event %d differs", ErrInconsistent, first.Serial)
+	}
+	return json.Marshal(proof)
+}
+
+// VerifyConsistency verifies two certifications as
+// VerifyCertification does, and checks the consistency proof that the
+// newer one is an append-only extension of the older: the newer chain
+// must pass through the older head unchanged, either holding it
+// itself or linked to it by the proof's events. A chain truncated and
+// regrown between the two certifications can't be linked without
+// forging signatures. A contradiction wraps ErrInconsistent.
+func VerifyConsistency(older, newer, proof []byte, signer *ecdsa.PublicKey, opts ...VerifyOption) error {
+	co, ok := VerifyCertification(older, signer, opts...)
+	if !ok {
+		return errors.New("auditlog: older certification failed to verify")
+	}
+
+	cn, ok := VerifyCertification(newer, signer, opts...)
+	if !ok {
+		return errors.New("auditlog: newer certification failed to verify")
+	}
+
+	if len(co.Chain) == 0 || len(cn.Chain) == 0 {
+		return errors.New("auditlog: certification holds no events")
+	}
+
+	var cp ConsistencyProof
+	if err := json.Unmarshal(proof, &cp); err != nil {
+		return err
+	}
+
+	oldHead, first := co.head(), cn.Chain[0]
+	if cp.Old != oldHead.Serial || cp.New != cn.head().Serial {
+		return errors.New("auditlog: the proof is for different certifications")
+	}
+
+	if cp.New < cp.Old {
+		return fmt.Errorf("%w: the newer chain ends before event %d", ErrInconsistent, cp.Old)
+	}
+
+	// The newer certification holds the older head.
+	if first.Serial <= oldHead.Serial {
+		if len(cp.Events) > 0 {
+			return errors.New("auditlog: the proof holds unexpected events")
+		}
+
+		for _, ev := range cn.Chain {
+			if ev.Serial == oldHead.Serial {
+				if !bytes.Equal(ev.Signature, oldHead.Signature) {
+					return fmt.Errorf("%w: event %d differs", ErrInconsistent, ev.Serial)
+				}
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: event %d is missing", ErrInconsistent, oldHead.Serial)
+	}
+
+	// Otherwise, the proof links the older head to the start of the
+	// newer chain.
+	if uint64(len(cp.Events)) != first.Serial-oldHead.Serial {
+		return fmt.Errorf("%w: the proof doesn't reach event %d", ErrInconsistent, first.Serial)
+	}
+
+	for i, ev := range cp.Events {
+		if ev == nil || ev.Serial != oldHead.Serial+1+uint64(i) {
+			return errors.New("auditlog: the proof's events are out of order")
+		}
+	}
+
+	var vc verifyConfig
+	for _, opt := range opts {
+		opt(&vc)
+	}
+
+	if i := verifyEvents(vc.manifest(signer), oldHead.Signature, cp.Events, vc.workers); i >= 0 {
+		return fmt.Errorf("%w: event %d doesn't follow on from the older head", ErrInconsistent, cp.Events[i].Serial)
+	}
+
+	// The newer certification closes the batch the proof ends in, if
+	// there is one.
+	if !sealed(cp.Events, true) {
+		return fmt.Errorf("%w: a batch in the proof doesn't match its root", ErrInconsistent)
+	}
+
+	if !bytes.Equal(cp.Events[len(cp.Events)-1].Signature, first.Signature) {
+		return fmt.Errorf("%w: event %d differs", ErrInconsistent, first.Serial)
+	}
+	return nil
+}
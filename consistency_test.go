@@ -0,0 +1,119 @@
+package auditlog
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConsistencyProof(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	modes := map[string][]Option{
+		"signed":  nil,
+		"batched": {WithBatchSigning(BatchPolicy{MaxEvents: 4, Interval: time.Hour})},
+	}
+
+	for name, opts := range modes {
+		l, err := NewWithStore(NewMemoryStore(), signer, append(opts, WithoutEcho())...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		l.Start()
+
+		for i := 0; i < 5; i++ {
+			l.InfoSync("consistency_test", "event", nil)
+		}
+
+		older, err := l.Certify(0, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		for i := 0; i < 20; i++ {
+			l.InfoSync("consistency_test", "event", nil)
+		}
+
+		// One newer certification holds the older head, and the other
+		// begins well after it.
+		whole, err := l.Certify(0, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		recent, err := l.Certify(15, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		for _, newer := range [][]byte{whole, recent} {
+			proof, err := l.ProveConsistency(older, newer)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			if err = VerifyConsistency(older, newer, proof, &signer.PublicKey); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+
+		if _, err = l.ProveConsistency(recent, older); err == nil {
+			t.Fatalf("%s: proved an older certification extends a newer one", name)
+		}
+
+		// The chain is truncated and regrown with the same key: the
+		// regrown chain can't be shown to extend the older
+		// certification.
+		forged, err := NewWithStore(NewMemoryStore(), signer, append(opts, WithoutEcho())...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		forged.Start()
+
+		for i := 0; i < 30; i++ {
+			forged.InfoSync("consistency_test", "forged", nil)
+		}
+
+		regrown, err := forged.Certify(15, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if _, err = l.ProveConsistency(older, regrown); !errors.Is(err, ErrInconsistent) {
+			t.Fatalf("%s: expected an inconsistency, have %v", name, err)
+		}
+
+		if _, err = forged.ProveConsistency(older, regrown); !errors.Is(err, ErrInconsistent) {
+			t.Fatalf("%s: expected an inconsistency, have %v", name, err)
+		}
+
+		// A proof built from the regrown chain doesn't link it to
+		// the older head.
+		var oc, rc Certification
+		if err = json.Unmarshal(older, &oc); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if err = json.Unmarshal(regrown, &rc); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		events, err := forged.store.Events(oc.head().Serial+1, rc.Chain[0].Serial)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		proof, err := json.Marshal(ConsistencyProof{Old: oc.head().Serial, New: rc.head().Serial, Events: events})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if err = VerifyConsistency(older, regrown, proof, &signer.PublicKey); !errors.Is(err, ErrInconsistent) {
+			t.Fatalf("%s: expected an inconsistency, have %v", name, err)
+		}
+
+		forged.Stop()
+		l.Stop()
+	}
+}
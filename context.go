@@ -0,0 +1,153 @@
+package auditlog
+
+import (
+	"context"
+)
+
+type traceKey struct{}
+
+type traceIDs struct {
+	trace, span string
+}
+
+// ContextWithTrace returns a context carrying the trace and span IDs
+// of the request it belongs to. Events logged with the Ctx methods
+// under it are given "trace_id" and "span_id" attributes, either of
+// which is left out if it is empty.
+func ContextWithTrace(ctx context.Context, traceID, spanID string) context.Context {
+	return context.WithValue(ctx, traceKey{}, traceIDs{traceID, spanID})
+}
+
+// TraceFromContext returns the trace and span IDs attached to ctx with
+// ContextWithTrace.
+func TraceFromContext(ctx context.Context) (traceID, spanID string) {
+	ids, _ := ctx.Value(traceKey{}).(traceIDs)
+	return ids.trace, ids.span
+}
+
+// WithContextAttributes adds attributes taken from the context to the
+// events logged with the Ctx methods, after those from
+// ContextWithTrace. It is the place to adapt a tracing library that
+// keeps its span in the context, such as OpenTelemetry. It may be
+// given more than once; the functions are called in order.
+func WithContextAttributes(f func(ctx context.Context) []Attribute) Option {
+	return func(l *Logger) {
+		if f != nil {
+			l.contextAttrs = append(l.contextAttrs, f)
+		}
+	}
+}
+
+// withContext returns the attributes with those taken from ctx
+// appended. The caller's slice is left alone.
+func (l *Logger) withContext(ctx context.Context, attributes []Attribute) []Attribute {
+	var extra []Attribute
+	traceID, spanID := TraceFromContext(ctx)
+	if traceID != "" {
+		extra = append(extra, Attribute{"trace_id", traceID})
+	}
+	if spanID != "" {
+		extra = append(extra, Attribute{"span_id", spanID})
+	}
+
+	for _, f := range l.contextAttrs {
+		extra = append(extra, f(ctx)...)
+	}
+
+	if len(extra) == 0 {
+		return attributes
+	}
+
+	attrs := make([]Attribute, 0, len(attributes)+len(extra))
+	attrs = append(attrs, attributes...)
+	return append(attrs, extra...)
+}
+
+// logCtx queues an event with the attributes taken from ctx, without
+// waiting for it to be recorded.
+func (l *Logger) logCtx(ctx context.Context, level int, actor, event string, attributes []Attribute) {
+	if !l.accept(level) {
+		return
+	}
+
+	l.logEvent(l.now(), level, actor, event, l.withContext(ctx, attributes), nil)
+}
+
+// logSyncCtx queues an event with the attributes taken from ctx, and
+// waits for it to be recorded until ctx is done, returning the error
+// that kept it from being stored, as logE does. The event is queued
+// in the background, so that a full queue doesn't hold the caller
+// past its deadline either.
+func (l *Logger) logSyncCtx(ctx context.Context, level int, actor, event string, attributes []Attribute) error {
+	if ok, err := l.admit(level); !ok {
+		return err
+	}
+
+	var err error
+	wait := make(chan struct{}, 0)
+	go l.logDurableEvent(l.now(), level, actor, event, l.withContext(ctx, attributes), DurabilityDefault, wait, &err)
+
+	select {
+	case <-wait:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DebugCtx performs the same function as Debug, adding the attributes
+// taken from ctx.
+func (l *Logger) DebugCtx(ctx context.Context, actor, event string, attributes []Attribute) {
+	l.logCtx(ctx, levelDebug, actor, event, attributes)
+}
+
+// InfoCtx performs the same function as Info, adding the attributes
+// taken from ctx.
+func (l *Logger) InfoCtx(ctx context.Context, actor, event string, attributes []Attribute) {
+	l.logCtx(ctx, levelInfo, actor, event, attributes)
+}
+
+// InfoSyncCtx performs the same function as InfoSync, adding the
+// attributes taken from ctx, except that it stops waiting when ctx is
+// done and returns its error. The event is still recorded. Otherwise,
+// it returns an error if the event wasn't stored, as InfoE does.
+func (l *Logger) InfoSyncCtx(ctx context.Context, actor, event string, attributes []Attribute) error {
+	return l.logSyncCtx(ctx, levelInfo, actor, event, attributes)
+}
+
+// WarningCtx performs the same function as Warning, adding the
+// attributes taken from ctx.
+func (l *Logger) WarningCtx(ctx context.Context, actor, event string, attributes []Attribute) {
+	l.logCtx(ctx, levelWarning, actor, event, attributes)
+}
+
+// WarningSyncCtx performs the same function as WarningSync, adding the
+// attributes taken from ctx, except that it stops waiting when ctx is
+// done and returns its error. The event is still recorded. Otherwise,
+// it returns an error if the event wasn't stored, as InfoE does.
+func (l *Logger) WarningSyncCtx(ctx context.Context, actor, event string, attributes []Attribute) error {
+	return l.logSyncCtx(ctx, levelWarning, actor, event, attributes)
+}
+
+// ErrorCtx performs the same function as Error, adding the attributes
+// taken from ctx.
+func (l *Logger) ErrorCtx(ctx context.Context, actor, event string, attributes []Attribute) {
+	l.logCtx(ctx, levelError, actor, event, attributes)
+}
+
+// ErrorSyncCtx performs the same function as ErrorSync, adding the
+// attributes taken from ctx, except that it stops waiting when ctx is
+// done and returns its error. The event is still recorded. Otherwise,
+// it returns an error if the event wasn't stored, as InfoE does.
+func (l *Logger) ErrorSyncCtx(ctx context.Context, actor, event string, attributes []Attribute) error {
+	return l.logSyncCtx(ctx, levelError, actor, event, attributes)
+}
+
+// CriticalSyncCtx performs the same function as CriticalSync, adding
+// the attributes taken from ctx, except that it stops waiting when ctx
+// is done and returns its error. The event is still recorded.
+// Otherwise, it returns an error if the event wasn't stored, as InfoE
+// does.
+func (l *Logger) CriticalSyncCtx(ctx context.Context, actor, event string, attributes []Attribute) error {
+	return l.logSyncCtx(ctx, levelCritical, actor, event, attributes)
+}
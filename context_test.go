@@ -0,0 +1,104 @@
+package auditlog
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// stallingStore blocks storing events until it is released.
+type stallingStore struct {
+	*MemoryStore
+	release chan struct{}
+}
+
+func (ss *stallingStore) StoreEvent(ev *Event) error {
+	<-ss.release
+	return ss.MemoryStore.StoreEvent(ev)
+}
+
+type tenantKey struct{}
+
+func TestContextLogging(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	tenant := func(ctx context.Context) []Attribute {
+		if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+			return []Attribute{{"tenant", tenant}}
+		}
+		return nil
+	}
+
+	store := &stallingStore{NewMemoryStore(), make(chan struct{})}
+	close(store.release)
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithContextAttributes(tenant))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+
+	ctx := ContextWithTrace(context.Background(), "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7")
+	ctx = context.WithValue(ctx, tenantKey{}, "acme")
+
+	attrs := []Attribute{{"user", "jqp"}}
+	if err = l.InfoSyncCtx(ctx, "context_test", "login", attrs); err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	ev := findEvent(t, store.MemoryStore, "login")
+	expected := []Attribute{
+		{"user", "jqp"},
+		{"trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"span_id", "00f067aa0ba902b7"},
+		{"tenant", "acme"},
+	}
+	if !reflect.DeepEqual(ev.Attributes, expected) {
+		t.Fatalf("unexpected attributes %v", ev.Attributes)
+	}
+
+	// A sync call gives up waiting at the context's deadline, but the
+	// event is still recorded.
+	l, err = NewWithStore(store, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	store.release = make(chan struct{})
+	l.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err = l.ErrorSyncCtx(ctx, "context_test", "timeout", nil); err != context.DeadlineExceeded {
+		t.Fatalf("expected the deadline to be exceeded, have %v", err)
+	}
+
+	close(store.release)
+	l.Stop()
+
+	if ev = findEvent(t, store.MemoryStore, "timeout"); len(ev.Attributes) != 0 {
+		t.Fatalf("unexpected attributes %v", ev.Attributes)
+	}
+}
+
+// findEvent returns the last event in the store with the given event
+// text.
+func findEvent(t *testing.T, store *MemoryStore, event string) *Event {
+	count, err := store.Count()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	events, err := store.Events(0, count-1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		if events[i].Event == event {
+			return events[i]
+		}
+	}
+	t.Fatalf("no %q event was recorded", event)
+	return nil
+}
@@ -0,0 +1,120 @@
+package auditlog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Events recorded in the chain of custody of certifications and
+// other evidence bundles.
+const (
+	EventCertify         = "certify"
+	EventReport          = "report"
+	EventCustodyTransfer = "custody transfer"
+)
+
+// custodyAttributes returns the attributes of an event recording that
+// custodian handled the bundle with the given SHA-256 digest.
+func custodyAttributes(custodian string, digest []byte, attributes []Attribute) []Attribute {
+	return append(attributes,
+		Attribute{"custodian", custodian},
+		Attribute{"digest", hex.EncodeToString(digest)},
+	)
+}
+
+// ReportAs generates a report as Report does, recording a signed
+// "report" event naming the custodian that requested it along with
+// the digest of the report's JSON encoding. The report is returned
+// along with its JSON encoding, which is the bundle whose custody is
+// tracked. An error is returned if the "report" event isn't stored.
+func (l *Logger) ReportAs(custodian string, start, end time.Time) (*Report, []byte, error) {
+	if l.requireAccessor && custodian == "" {
+		return nil, nil, ErrNoAccessor
+	}
+
+	r, err := l.report(start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, err := r.JSON()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	digest := sha256.Sum256(out)
+	err = l.logInternalE(levelInfo, EventReport, custodyAttributes(custodian, digest[:], []Attribute{
+		{"first_serial", fmt.Sprintf("%d", r.FirstSerial)},
+		{"last_serial", fmt.Sprintf("%d", r.LastSerial)},
+	}))
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, out, nil
+}
+
+// TransferCustody records a signed "custody transfer" event noting
+// that custodian took custody of a bundle previously produced by
+// CertifyAs or ReportAs; action describes the transfer, e.g.
+// "delivered to external auditor". An error is returned if the event
+// isn't stored, in which case the transfer hasn't been recorded.
+func (l *Logger) TransferCustody(custodian, action string, bundle []byte) error {
+	digest := sha256.Sum256(bundle)
+	return l.logInternalE(levelInfo, EventCustodyTransfer, custodyAttributes(custodian, digest[:], []Attribute{
+		{"action", action},
+	}))
+}
+
+// CustodyTrail returns the custody events for a bundle: when it was
+// generated, and every recorded transfer since, in order.
+func (l *Logger) CustodyTrail(bundle []byte) ([]*Event, error) {
+	digest := sha256.Sum256(bundle)
+	want := hex.EncodeToString(digest[:])
+
+	start, _, err := l.chainStart()
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := l.store.Count()
+	if err != nil || count <= start {
+		return nil, err
+	}
+
+	events, err := l.store.Events(start, count-1)
+	if err != nil {
+		return nil, err
+	}
+
+	var trail []*Event
+	for _, ev := range events {
+		if ev.Actor != internalActor {
+			continue
+		}
+
+		switch ev.Event {
+		case EventCertify, EventReport, EventCustodyTransfer:
+		default:
+			continue
+		}
+
+		if digest, _ := ev.attr("digest"); digest == want {
+			trail = append(trail, ev)
+		}
+	}
+	return trail, nil
+}
+
+// WriteCustodyTrail renders a custody trail, one event per line.
+func WriteCustodyTrail(w io.Writer, trail []*Event) error {
+	for _, ev := range trail {
+		_, err := fmt.Fprintf(w, "%d %s\n", ev.Serial, ev)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package auditlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCustodyTrail(t *testing.T) {
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, _ := newTestLogger(t,
+		WithClock(NewFixedClock(start, time.Minute)))
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 4; i++ {
+		l.InfoSync("custody_test", "tick", nil)
+	}
+
+	cert, err := l.CertifyAs("alice", 0, 3)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	_, report, err := l.ReportAs("bob", start, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	err = l.TransferCustody("carol", "delivered to external auditor", cert)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	trail, err := l.CustodyTrail(cert)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(trail) != 2 || trail[0].Event != EventCertify || trail[1].Event != EventCustodyTransfer {
+		t.Fatalf("wrong custody trail for the certification: %v", trail)
+	}
+
+	if custodian, _ := trail[0].attr("custodian"); custodian != "alice" {
+		t.Fatalf("expected alice to have certified the chain, have %q", custodian)
+	}
+
+	trail, err = l.CustodyTrail(report)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(trail) != 1 || trail[0].Event != EventReport {
+		t.Fatalf("wrong custody trail for the report: %v", trail)
+	}
+
+	var buf bytes.Buffer
+	err = WriteCustodyTrail(&buf, trail)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !strings.Contains(buf.String(), "custodian=bob") {
+		t.Fatalf("rendered trail is missing the custodian: %s", buf.String())
+	}
+
+	// A transfer that can't be recorded is reported.
+	l.Stop()
+	if err = l.TransferCustody("dave", "lost", cert); err != ErrNotRunning {
+		t.Fatalf("expected ErrNotRunning, have %v", err)
+	}
+}
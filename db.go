@@ -1,16 +1,23 @@
 package auditlog
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // DBConnDetails contains the connection parameters for the database.
+// Backend selects the database: "postgres", the default, "mysql" for
+// MySQL or MariaDB, "sqlite", or "file" for an append-only log file;
+// for the last two, Name is the path to the file and the other
+// parameters are unused.
 type DBConnDetails struct {
+	Backend                          string
 	Name, User, Password, Host, Port string
 	SSL                              bool
 }
@@ -47,39 +54,526 @@ func (cd DBConnDetails) String() string {
 	return strings.Join(params, " ")
 }
 
-func (l *Logger) setupDB(cd *DBConnDetails) (err error) {
-	l.db, err = sql.Open("postgres", cd.String())
+// A pgStore keeps the audit chain in a Postgres database using the
+// schema in auditlog.sql.
+type pgStore struct {
+	db    *sql.DB
+	conn  string
+	stmts *stmtCache
+
+	// lease is the connection holding the lease, if it is held;
+	// see AcquireLease.
+	lease *sql.Conn
+
+	// versioned is set if the events table has the digest_version
+	// column, which databases created before digests were
+	// versioned lack.
+	versioned bool
+}
+
+// NewStore opens the database described by cd, with the backend it
+// names.
+func NewStore(cd *DBConnDetails) (Store, error) {
+	switch cd.Backend {
+	case "", "postgres":
+		return NewPostgresStore(cd)
+	case "sqlite":
+		return NewSQLiteStore(cd.Name)
+	case "mysql":
+		return NewMySQLStore(cd)
+	case "file":
+		return NewFileStore(cd.Name)
+	default:
+		return nil, fmt.Errorf("auditlog: unsupported backend %q", cd.Backend)
+	}
+}
+
+// NewPostgresStore connects to the Postgres database described by cd.
+func NewPostgresStore(cd *DBConnDetails) (Store, error) {
+	return openPostgresStore(cd.String())
+}
+
+// openPostgresStore connects to the Postgres database named by a
+// connection URL or string, as accepted by lib/pq.
+func openPostgresStore(conn string) (Store, error) {
+	s := &pgStore{conn: conn}
+	err := s.Reopen()
 	if err != nil {
-		return
+		return nil, err
 	}
+	return s, nil
+}
 
-	if l.db == nil {
-		err = errors.New("auditlog: failed to open database")
-		return
+// Reopen connects to the database, applying any schema migrations it
+// hasn't had.
+func (s *pgStore) Reopen() error {
+	db, err := sql.Open("postgres", s.conn)
+	if err != nil {
+		return err
+	}
+
+	if db == nil {
+		return errors.New("auditlog: failed to open database")
 	}
 
-	err = l.db.Ping()
+	err = db.Ping()
 	if err != nil {
-		return
+		db.Close()
+		return err
 	}
-	return nil
+
+	if _, _, err = migrateSchema(db); err != nil {
+		db.Close()
+		return err
+	}
+
+	s.db = db
+	s.stmts = newStmtCache(db, nil)
+	return s.checkVersioned()
 }
 
-func storeEvent(tx *sql.Tx, ev *Event) error {
-	_, err := tx.Exec(`INSERT INTO events
-		(id, timestamp, received, level, actor, event, signature)
-		values ($1, $2, $3, $4, $5, $6, $7)`,
-		ev.Serial, ev.When, ev.Received, ev.Level, ev.Actor, ev.Event, ev.Signature)
+// checkVersioned notes whether the events table records digest
+// versions.
+func (s *pgStore) checkVersioned() error {
+	return s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'events'
+		AND column_name = 'digest_version')`).Scan(&s.versioned)
+}
+
+// RecordsDigests reports whether the database records digest versions;
+// it does once it has the schema's digest_version column, which Repair
+// adds to older databases.
+func (s *pgStore) RecordsDigests() bool {
+	return s.versioned
+}
+
+// withTx runs f in a transaction, committing if f succeeds and
+// rolling back otherwise.
+func (s *pgStore) withTx(f func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = f(tx)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
+	return tx.Commit()
+}
+
+func (s *pgStore) StoreEvent(ev *Event) error {
+	return duplicateSerial(s.withTx(func(tx *sql.Tx) error {
+		if err := setDurability(tx, ev); err != nil {
+			return err
+		}
+		return storeEvent(s.stmts.bind(tx), s.versioned, ev)
+	}))
+}
+
+// StoreEvents records a run of signed events in one transaction. The
+// rows are sent with COPY, rather than an INSERT per row, as the
+// round trips would otherwise dominate at high event rates.
+func (s *pgStore) StoreEvents(events []*Event) error {
+	return duplicateSerial(s.withTx(func(tx *sql.Tx) error {
+		if err := setDurability(tx, events...); err != nil {
+			return err
+		}
+
+		if len(events) == 1 {
+			return storeEvent(s.stmts.bind(tx), s.versioned, events[0])
+		}
+		return copyEvents(tx, s.versioned, events)
+	}))
+}
+
+// copyEvents stores events, and then their attributes, with COPY.
+func copyEvents(tx *sql.Tx, versioned bool, events []*Event) error {
+	columns := []string{"id", "timestamp", "received", "level", "actor", "event", "signature"}
+	if versioned {
+		columns = append(columns, "digest_version")
+	} else if err := checkDigests(events...); err != nil {
+		return err
+	}
+
+	err := copyRows(tx, pq.CopyIn("events", columns...), func(stmt *sql.Stmt) error {
+		for _, ev := range events {
+			args := []interface{}{ev.Serial, ev.When, ev.Received, ev.Level,
+				ev.Actor, ev.Event, ev.Signature}
+			if versioned {
+				args = append(args, int(ev.Digest))
+			}
+
+			if _, err := stmt.Exec(args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return copyRows(tx, pq.CopyIn("attributes", "name", "value", "event",
+		"position"), func(stmt *sql.Stmt) error {
+		for _, ev := range events {
+			for i, attr := range ev.Attributes {
+				_, err := stmt.Exec(attr.Name, attr.Value, ev.Serial, i)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// copyRows runs a COPY statement, with add sending its rows.
+func copyRows(tx *sql.Tx, query string, add func(stmt *sql.Stmt) error) error {
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+
+	err = add(stmt)
+	if err == nil {
+		_, err = stmt.Exec()
+	}
+
+	cerr := stmt.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (s *pgStore) StoreError(ev *ErrorEvent) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		return storeError(tx, ev)
+	})
+}
+
+// StoreKey records a key in the signing_keys table, unless a key has
+// already been recorded for its first serial number.
+func (s *pgStore) StoreKey(rec KeyRecord) error {
+	_, err := s.db.Exec(`INSERT INTO signing_keys (first_serial, public_key) VALUES ($1, $2)
+		ON CONFLICT (first_serial) DO NOTHING`, rec.First, rec.PublicKey)
+	return err
+}
+
+func (s *pgStore) Keys() ([]KeyRecord, error) {
+	return loadKeyRecords(s.db)
+}
+
+// StoreCheckpoint records a signed checkpoint in the checkpoints table,
+// unless its event has already been checkpointed.
+func (s *pgStore) StoreCheckpoint(sc SignedCheckpoint) error {
+	_, err := s.db.Exec(`INSERT INTO checkpoints (serial, taken, head, signature) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (serial) DO NOTHING`, sc.Serial, sc.When, sc.Head, sc.Signature)
+	return err
+}
+
+func (s *pgStore) LatestCheckpoint() (*SignedCheckpoint, error) {
+	return loadLatestCheckpoint(s.db)
+}
 
-	for i, attr := range ev.Attributes {
-		_, err = tx.Exec(`INSERT INTO attributes (name, value, event, position) values ($1, $2, $3, $4)`,
-			attr.Name, attr.Value, ev.Serial, i)
+// StoreCosignature records a witness's cosignature of a checkpoint in
+// the cosignatures table, unless the witness has already cosigned it.
+func (s *pgStore) StoreCosignature(cs Cosignature) error {
+	_, err := s.db.Exec(`INSERT INTO cosignatures (serial, witness, signature) VALUES ($1, $2, $3)
+		ON CONFLICT (serial, witness) DO NOTHING`, cs.Serial, cs.Witness, cs.Signature)
+	return err
+}
+
+func (s *pgStore) Cosignatures(serial uint64) ([]Cosignature, error) {
+	return loadCosignatures(s.db, serial)
+}
+
+func (s *pgStore) Count() (uint64, error) {
+	return countEvents(s.db)
+}
+
+func (s *pgStore) Event(serial uint64) (ev *Event, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		ev, err = loadEvent(s.stmts.bind(tx), s.versioned, serial)
+		if err == sql.ErrNoRows {
+			err = ErrNoEvent
+		}
+		return err
+	})
+	return
+}
+
+func (s *pgStore) Events(start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		events, err = loadEvents(s.stmts.bind(tx), s.versioned, start, end)
+		return err
+	})
+	return
+}
+
+// EventsByActor loads the events recorded by actor with serial numbers
+// in the range [start, end].
+func (s *pgStore) EventsByActor(actor string, start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		events, err = loadActorEvents(s.stmts.bind(tx), s.versioned, actor, start, end)
+		return err
+	})
+	return
+}
+
+// EventsByLevel loads the events at any of levels with serial numbers
+// in the range [start, end].
+func (s *pgStore) EventsByLevel(levels []string, start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		events, err = loadLevelEvents(s.stmts.bind(tx), s.versioned, levels, start, end)
+		return err
+	})
+	return
+}
+
+// EventsByAttribute loads the events with serial numbers in the range
+// [start, end] that carry attr, along with any compressed events.
+func (s *pgStore) EventsByAttribute(attr Attribute, start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		events, err = loadAttributeEvents(s.stmts.bind(tx), s.versioned, attr, start, end)
+		return err
+	})
+	return
+}
+
+func (s *pgStore) Errors(start, end uint64) (events []*ErrorEvent, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		events, err = loadErrors(tx, start, end)
+		return err
+	})
+	return
+}
+
+func (s *pgStore) Prune(end uint64) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		sig, err := getSignature(tx, end)
 		if err != nil {
 			return err
 		}
+
+		_, err = tx.Exec(`DELETE FROM attributes WHERE event <= $1`, end)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM events WHERE id <= $1`, end)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO pruned (id, end_serial, signature)
+			VALUES (0, $1, $2) ON CONFLICT (id)
+			DO UPDATE SET end_serial = $1, signature = $2`, end, sig)
+		return err
+	})
+}
+
+// Compress moves the attributes of the events up to and including
+// end into a compressed payload on the event row.
+func (s *pgStore) Compress(end uint64) (n int, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		n = 0
+		rows, err := tx.Query(`SELECT DISTINCT event FROM attributes
+			WHERE event <= $1 ORDER BY event`, end)
+		if err != nil {
+			return err
+		}
+
+		var serials []uint64
+		for rows.Next() {
+			var serial uint64
+			err = rows.Scan(&serial)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			serials = append(serials, serial)
+		}
+		rows.Close()
+
+		for _, serial := range serials {
+			ev := &Event{Serial: serial}
+			err = loadAttributes(tx, ev)
+			if err != nil {
+				return err
+			}
+
+			packed, err := packAttributes(ev.Attributes)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`UPDATE events SET payload = $1 WHERE id = $2`,
+				packed, serial)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`DELETE FROM attributes WHERE event = $1`, serial)
+			if err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return
+}
+
+func (s *pgStore) Pruned() (end uint64, signature []byte, ok bool, err error) {
+	err = s.db.QueryRow(`SELECT end_serial, signature FROM pruned WHERE id = 0`).Scan(&end, &signature)
+	if err == sql.ErrNoRows {
+		return 0, nil, false, nil
+	} else if err != nil {
+		return 0, nil, false, err
+	}
+	return end, signature, true, nil
+}
+
+// Size returns the space taken by the audit tables, including their
+// indexes.
+func (s *pgStore) Size() (int64, error) {
+	var size int64
+	for _, table := range auditTables {
+		var n int64
+		err := s.db.QueryRow(`SELECT pg_total_relation_size($1)`, table).Scan(&n)
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, nil
+}
+
+// Snapshot begins a read-only, repeatable-read transaction, so that
+// events and errors are read as they stood when it began.
+func (s *pgStore) Snapshot() (Snapshot, error) {
+	tx, err := s.db.BeginTx(context.Background(), &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The snapshot is taken by the transaction's first query,
+	// rather than when it begins.
+	if _, err = tx.Exec(`SELECT 1`); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &pgSnapshot{tx: tx, versioned: s.versioned}, nil
+}
+
+// A pgSnapshot reads the chain in a repeatable-read transaction.
+type pgSnapshot struct {
+	tx        *sql.Tx
+	versioned bool
+}
+
+func (ps *pgSnapshot) Events(start, end uint64) ([]*Event, error) {
+	return loadEvents(ps.tx, ps.versioned, start, end)
+}
+
+func (ps *pgSnapshot) Errors(start, end uint64) ([]*ErrorEvent, error) {
+	return loadErrors(ps.tx, start, end)
+}
+
+func (ps *pgSnapshot) Close() error {
+	return ps.tx.Rollback()
+}
+
+func getSignature(tx *sql.Tx, serial uint64) ([]byte, error) {
+	var sig []byte
+	err := tx.QueryRow(`SELECT signature FROM events WHERE id=$1`,
+		serial).Scan(&sig)
+	if err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+func (s *pgStore) Close() error {
+	s.ReleaseLease()
+	s.stmts.close()
+	return s.db.Close()
+}
+
+// A sqlTx runs the queries shared by the SQL stores, which number
+// their placeholders as Postgres does ($1, $2, ...), in order. A
+// *sql.Tx is one; a preparedTx runs them with prepared statements, and
+// adapts them to MySQL's placeholders.
+type sqlTx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+const (
+	insertEventQuery = `INSERT INTO events
+		(id, timestamp, received, level, actor, event, signature, digest_version)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`
+	insertLegacyEventQuery = `INSERT INTO events
+		(id, timestamp, received, level, actor, event, signature)
+		values ($1, $2, $3, $4, $5, $6, $7)`
+	insertAttributeQuery  = `INSERT INTO attributes (name, value, event, position) values ($1, $2, $3, $4)`
+	selectAttributesQuery = `SELECT name, value FROM attributes WHERE event = $1 ORDER BY position`
+)
+
+func storeEvent(tx sqlTx, versioned bool, ev *Event) error {
+	var err error
+	if versioned {
+		_, err = tx.Exec(insertEventQuery,
+			ev.Serial, ev.When, ev.Received, ev.Level, ev.Actor, ev.Event, ev.Signature,
+			int(ev.Digest))
+	} else if err = checkDigests(ev); err == nil {
+		_, err = tx.Exec(insertLegacyEventQuery,
+			ev.Serial, ev.When, ev.Received, ev.Level, ev.Actor, ev.Event, ev.Signature)
+	}
+	if err != nil {
+		return err
+	}
+
+	return insertAttributes(tx, "attributes", ev.Serial, ev.Attributes)
+}
+
+// maxAttributeRows is the most attributes inserted by one statement,
+// which keeps its placeholders within every database's limit.
+const maxAttributeRows = 100
+
+// insertAttributes stores an event's attributes in table, keyed by
+// the event's serial number or row ID, with as few statements as the
+// placeholder limit allows: each is a round trip to the database. A
+// single attribute is stored with the prepared insertAttributeQuery.
+func insertAttributes(tx sqlTx, table string, event uint64, attrs []Attribute) error {
+	for start := 0; start < len(attrs); start += maxAttributeRows {
+		end := start + maxAttributeRows
+		if end > len(attrs) {
+			end = len(attrs)
+		}
+
+		var query strings.Builder
+		args := make([]interface{}, 0, 4*(end-start))
+		query.WriteString("INSERT INTO " + table + " (name, value, event, position) values ")
+		for i := start; i < end; i++ {
+			if i > start {
+				query.WriteString(", ")
+			}
+			n := len(args)
+			fmt.Fprintf(&query, "($%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4)
+			args = append(args, attrs[i].Name, attrs[i].Value, event, i)
+		}
+
+		if _, err := tx.Exec(query.String(), args...); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -90,7 +584,7 @@ func storeError(tx *sql.Tx, ev *ErrorEvent) error {
 	log.Println("store error")
 	err := tx.QueryRow(`INSERT INTO error_events
 		(serial, timestamp, received, level, actor, event)
-		values ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		values ($1, $2, $3, $4, $5, $6) RETURNING id`,
 		ev.Event.Serial, ev.Event.When, ev.Event.Received,
 		ev.Event.Level, ev.Event.Actor, ev.Event.Event).Scan(&eventID)
 	if err != nil {
@@ -104,47 +598,150 @@ func storeError(tx *sql.Tx, ev *ErrorEvent) error {
 		return err
 	}
 
-	for i, attr := range ev.Event.Attributes {
-		_, err = tx.Exec(`INSERT INTO error_attributes (name, value, event, position) values ($1, $2, $3, $4)`,
-			attr.Name, attr.Value, eventID, i)
-		if err != nil {
-			return err
-		}
+	return insertAttributes(tx, "error_attributes", uint64(eventID), ev.Event.Attributes)
+}
+
+func loadEvents(tx sqlTx, versioned bool, start, end uint64) ([]*Event, error) {
+	return queryEvents(tx, selectEventsQuery(versioned), start, end)
+}
+
+// loadActorEvents loads the events recorded by actor with serial
+// numbers in the range [start, end], through the events_actor index.
+func loadActorEvents(tx sqlTx, versioned bool, actor string, start, end uint64) ([]*Event, error) {
+	return queryEvents(tx, selectActorEventsQuery(versioned), actor, start, end)
+}
+
+// loadLevelEvents loads the events at any of levels with serial
+// numbers in the range [start, end], through the events_level index.
+func loadLevelEvents(tx sqlTx, versioned bool, levels []string, start, end uint64) ([]*Event, error) {
+	if len(levels) == 0 {
+		return nil, nil
 	}
-	return nil
+
+	placeholders := make([]string, len(levels))
+	args := []interface{}{start, end}
+	for i, level := range levels {
+		placeholders[i] = fmt.Sprintf("$%d", i+3)
+		args = append(args, level)
+	}
+
+	query := `SELECT ` + eventColumns(versioned) + ` FROM events
+		WHERE id >= $1 AND id <= $2 AND level IN (` + strings.Join(placeholders, ", ") + `) ORDER BY id`
+	return queryEvents(tx, query, args...)
 }
 
-func loadEvents(tx *sql.Tx, start, end uint64) (events []*Event, err error) {
-	rows, err := tx.Query(`SELECT * FROM events WHERE id >= $1 AND id <= $2`,
-		start, end)
+// loadAttributeEvents loads the events with serial numbers in the
+// range [start, end] that carry attr, through the
+// attributes_name_value index, along with the compressed events in
+// the range, whose attributes can't be searched.
+func loadAttributeEvents(tx sqlTx, versioned bool, attr Attribute, start, end uint64) ([]*Event, error) {
+	return queryEvents(tx, selectAttributeEventsQuery(versioned),
+		start, end, attr.Name, attr.Value, attr.Value, start, end)
+}
+
+// queryEvents loads the events selected by query, which selects the
+// columns given by eventColumns, along with their attributes.
+func queryEvents(tx sqlTx, query string, args ...interface{}) (events []*Event, err error) {
+	rows, err := tx.Query(query, args...)
 	if err != nil {
 		return
 	}
 
 	defer rows.Close()
 
+	var payloads [][]byte
 	for rows.Next() {
 		var ev Event
+		var payload []byte
 		err = rows.Scan(&ev.Serial, &ev.When, &ev.Received, &ev.Level,
-			&ev.Actor, &ev.Event, &ev.Signature)
+			&ev.Actor, &ev.Event, &ev.Signature, &payload, &ev.Digest)
 		if err != nil {
 			return
 		}
 
 		events = append(events, &ev)
+		payloads = append(payloads, payload)
 	}
+	rows.Close()
 
 	for i := range events {
-		err = loadAttributes(tx, events[i])
+		err = restoreAttributes(tx, events[i], payloads[i])
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return
 }
 
-func loadAttributes(tx *sql.Tx, ev *Event) error {
-	rows, err := tx.Query(`SELECT name, value FROM attributes
-			      WHERE event = $1 ORDER BY position`,
-		ev.Serial)
+// eventColumns lists the columns of the events table, in the order
+// they are scanned. Databases that don't record digest versions only
+// hold legacy events.
+func eventColumns(versioned bool) string {
+	if versioned {
+		return `id, timestamp, received, level, actor, event, signature, payload, digest_version`
+	}
+	return `id, timestamp, received, level, actor, event, signature, payload, 0`
+}
+
+// selectEventQuery returns the query loading an event.
+func selectEventQuery(versioned bool) string {
+	return `SELECT ` + eventColumns(versioned) + ` FROM events WHERE id = $1`
+}
+
+// selectEventsQuery returns the query loading a range of events.
+func selectEventsQuery(versioned bool) string {
+	return `SELECT ` + eventColumns(versioned) + ` FROM events
+		WHERE id >= $1 AND id <= $2 ORDER BY id`
+}
+
+// selectAttributeEventsQuery returns the query loading a range of the
+// events carrying an attribute. Values are indexed by their first 200
+// characters, as whole values can be too long for an index entry.
+func selectAttributeEventsQuery(versioned bool) string {
+	return `SELECT ` + eventColumns(versioned) + ` FROM events
+		WHERE id >= $1 AND id <= $2 AND (id IN (SELECT event FROM attributes
+			WHERE name = $3 AND substr(value, 1, 200) = substr($4, 1, 200) AND value = $5
+			AND event >= $6 AND event <= $7) OR payload IS NOT NULL)
+		ORDER BY id`
+}
+
+// selectActorEventsQuery returns the query loading a range of the
+// events recorded by an actor.
+func selectActorEventsQuery(versioned bool) string {
+	return `SELECT ` + eventColumns(versioned) + ` FROM events
+		WHERE actor = $1 AND id >= $2 AND id <= $3 ORDER BY id`
+}
+
+// errDigestUnrecorded is returned when an event with a digest version
+// other than DigestLegacy is stored in a database that can't record it.
+var errDigestUnrecorded = errors.New("auditlog: the database can't record digest versions; its schema needs repair")
+
+// checkDigests checks that events can be stored in a database that
+// doesn't record digest versions.
+func checkDigests(events ...*Event) error {
+	for _, ev := range events {
+		if ev.Digest != DigestLegacy {
+			return errDigestUnrecorded
+		}
+	}
+	return nil
+}
+
+// restoreAttributes loads an event's attributes, either from its
+// compressed payload or, if it hasn't been compressed, from the
+// attributes table.
+func restoreAttributes(tx sqlTx, ev *Event, payload []byte) (err error) {
+	if payload == nil {
+		return loadAttributes(tx, ev)
+	}
+
+	ev.Attributes, err = unpackAttributes(payload)
+	return err
+}
+
+func loadAttributes(tx sqlTx, ev *Event) error {
+	rows, err := tx.Query(selectAttributesQuery, ev.Serial)
 	if err != nil {
 		return err
 	}
@@ -163,35 +760,31 @@ func loadAttributes(tx *sql.Tx, ev *Event) error {
 	return nil
 }
 
+// countEvents returns the number of events in the chain, including
+// any that have been pruned: one past the highest serial number. It
+// isn't derived from the number of rows, which falls short if there
+// is a gap, and would have the next event collide with the last one
+// stored.
 func countEvents(db *sql.DB) (uint64, error) {
 	var count uint64
-	err := db.QueryRow(`SELECT count(*) FROM events`).Scan(&count)
+	err := db.QueryRow(`SELECT GREATEST(
+		(SELECT COALESCE(MAX(id) + 1, 0) FROM events),
+		(SELECT COALESCE(MAX(end_serial) + 1, 0) FROM pruned))`).Scan(&count)
 	return count, err
 }
 
-var errAuditFailure = errors.New("auditlog: failed to verify audit chain")
-
-func getSignature(tx *sql.Tx, serial uint64) ([]byte, error) {
-	var sig []byte
-	err := tx.QueryRow(`SELECT signature FROM events WHERE id=$1`,
-		serial).Scan(&sig)
-	if err != nil {
-		return nil, err
-	}
-	return sig, nil
-}
-
-func loadEvent(tx *sql.Tx, serial uint64) (*Event, error) {
+func loadEvent(tx sqlTx, versioned bool, serial uint64) (*Event, error) {
 	var ev Event
+	var payload []byte
 
-	row := tx.QueryRow(`SELECT * FROM events WHERE id=$1`, serial)
+	row := tx.QueryRow(selectEventQuery(versioned), serial)
 	err := row.Scan(&ev.Serial, &ev.When, &ev.Received, &ev.Level,
-		&ev.Actor, &ev.Event, &ev.Signature)
+		&ev.Actor, &ev.Event, &ev.Signature, &payload, &ev.Digest)
 	if err != nil {
 		return nil, err
 	}
 
-	err = loadAttributes(tx, &ev)
+	err = restoreAttributes(tx, &ev, payload)
 	if err != nil {
 		return nil, err
 	}
@@ -199,72 +792,13 @@ func loadEvent(tx *sql.Tx, serial uint64) (*Event, error) {
 	return &ev, nil
 }
 
-func (l *Logger) verifyEvent(tx *sql.Tx, serial uint64) error {
-	var prev []byte
-	tx, err := l.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
-		}
-	}()
-
-	if serial > 0 {
-		prev, err = getSignature(tx, serial-1)
-		if err != nil {
-			return err
-		}
-	}
-
-	ev, err := loadEvent(tx, serial)
-	if err != nil {
-		return err
-	}
-
-	if !ev.Verify(&l.signer.PublicKey, prev) {
-		err = errAuditFailure
-		return err
-	}
-
-	return nil
-}
-
-func (l *Logger) verifyAuditChain() error {
-	tx, err := l.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	defer func() {
-		if err != nil {
-			tx.Rollback()
-		} else {
-			tx.Commit()
-		}
-	}()
-
-	for i := uint64(0); i < l.counter; i++ {
-		err = l.verifyEvent(tx, i)
-		if err != nil {
-			log.Println("Signature failure on event", i)
-			return err
-		}
-	}
-
-	l.lastSignature, err = getSignature(tx, l.counter-1)
-
-	return nil
-}
-
-func loadErrorAttributes(tx *sql.Tx, ev *Event) error {
+// loadErrorAttributes loads the attributes of the error event with the
+// given row ID; they are keyed by the row, as the serial number of an
+// event that failed may be reused.
+func loadErrorAttributes(tx sqlTx, eventID uint64, ev *Event) error {
 	rows, err := tx.Query(`SELECT name, value FROM error_attributes
 			      WHERE event = $1 ORDER BY position`,
-		ev.Serial)
+		eventID)
 	if err != nil {
 		return err
 	}
@@ -283,7 +817,7 @@ func loadErrorAttributes(tx *sql.Tx, ev *Event) error {
 	return nil
 }
 
-func loadErrors(tx *sql.Tx, start, end uint64) (events []*ErrorEvent, err error) {
+func loadErrors(tx sqlTx, start, end uint64) (events []*ErrorEvent, err error) {
 	rows, err := tx.Query(`SELECT * FROM error_events WHERE serial >= $1 AND serial <= $2`, start, end)
 	if err != nil {
 		return
@@ -302,7 +836,7 @@ func loadErrors(tx *sql.Tx, start, end uint64) (events []*ErrorEvent, err error)
 			return
 		}
 
-		err = loadErrorAttributes(tx, &ev)
+		err = loadErrorAttributes(tx, eventID, &ev)
 		if err != nil {
 			events = nil
 			return
@@ -320,3 +854,58 @@ func loadErrors(tx *sql.Tx, start, end uint64) (events []*ErrorEvent, err error)
 
 	return
 }
+
+// loadKeyRecords reads the signing_keys table, in order of first
+// serial number.
+func loadKeyRecords(tx sqlTx) ([]KeyRecord, error) {
+	rows, err := tx.Query(`SELECT first_serial, public_key FROM signing_keys ORDER BY first_serial`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recs []KeyRecord
+	for rows.Next() {
+		var rec KeyRecord
+		if err = rows.Scan(&rec.First, &rec.PublicKey); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+// loadLatestCheckpoint reads the checkpoint of the latest event from
+// the checkpoints table, returning nil if there is none.
+func loadLatestCheckpoint(tx sqlTx) (*SignedCheckpoint, error) {
+	var sc SignedCheckpoint
+	err := tx.QueryRow(`SELECT serial, taken, head, signature FROM checkpoints
+		ORDER BY serial DESC LIMIT 1`).Scan(&sc.Serial, &sc.When, &sc.Head, &sc.Signature)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// loadCosignatures reads the cosignatures of the checkpoint of the
+// given event from the cosignatures table.
+func loadCosignatures(tx sqlTx, serial uint64) ([]Cosignature, error) {
+	rows, err := tx.Query(`SELECT witness, signature FROM cosignatures
+		WHERE serial = $1 ORDER BY witness`, serial)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sigs []Cosignature
+	for rows.Next() {
+		cs := Cosignature{Serial: serial}
+		if err = rows.Scan(&cs.Witness, &cs.Signature); err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, cs)
+	}
+	return sigs, rows.Err()
+}
@@ -0,0 +1,224 @@
+package auditlog
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// EventDatabaseRecovered is recorded once the events buffered during
+// a database outage have all been stored.
+const EventDatabaseRecovered = "database recovered"
+
+// ErrBuffered is returned when an event couldn't be stored and is
+// held in memory in degraded mode instead, to be stored later.
+var ErrBuffered = errors.New("auditlog: event buffered")
+
+// A DegradedPolicy keeps the logger running through database
+// outages. Events that can't be stored are still signed and chained,
+// and are held in memory, in order, until they can be; every Interval
+// the logger tries to store them. At most MaxEvents are held: once
+// the buffer is full, the logger stops processing events until the
+// database recovers, so that the queue fills and callers block
+// rather than events being dropped.
+//
+// If the logger is stopped while events are buffered and a spool is
+// configured (see WithSpool), they are spooled and replayed once the
+// logger is restarted; otherwise, they are written to standard error
+// and counted as lost.
+type DegradedPolicy struct {
+	MaxEvents int
+	Interval  time.Duration
+}
+
+// DegradedStats describes a logger's operation in degraded mode.
+// Degraded is set, and Since records when the outage began, while
+// events are buffered. Buffered is the number of events currently
+// held, and Peak the most ever held at once. Flushed counts the
+// buffered events that have been stored, Outages the number of times
+// the logger entered degraded mode, Blocked the total time spent
+// waiting for room in a full buffer, and Lost the events that were
+// discarded when the logger stopped.
+type DegradedStats struct {
+	Degraded bool
+	Since    time.Time
+	Buffered int
+	Peak     int
+	Flushed  uint64
+	Outages  uint64
+	Blocked  time.Duration
+	Lost     uint64
+}
+
+type degraded struct {
+	policy DegradedPolicy
+	buffer []*Event
+
+	// prevSignature is the signature preceding the first buffered
+	// event, used to unwind the chain if the buffered events have
+	// to be spooled.
+	prevSignature []byte
+	stats         DegradedStats
+}
+
+// WithDegradedMode keeps the logger running through database outages,
+// as described by the policy.
+func WithDegradedMode(policy DegradedPolicy) Option {
+	return func(l *Logger) {
+		if policy.MaxEvents <= 0 || policy.Interval <= 0 {
+			return
+		}
+
+		l.degraded = &degraded{policy: policy}
+		l.addTask(every(policy.Interval, false, func(l *Logger) {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+
+			if !l.closed {
+				l.flushDegraded()
+			}
+		}))
+	}
+}
+
+// DegradedStats returns the degraded mode statistics for the logger.
+func (l *Logger) DegradedStats() DegradedStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.degraded == nil {
+		return DegradedStats{}
+	}
+
+	stats := l.degraded.stats
+	stats.Buffered = len(l.degraded.buffer)
+	return stats
+}
+
+// buffering reports whether events are being buffered; the caller
+// must hold the logger's lock.
+func (l *Logger) buffering() bool {
+	return l.degraded != nil && len(l.degraded.buffer) > 0
+}
+
+// bufferEvent holds a signed event until it can be stored; the caller
+// must hold the logger's lock.
+func (l *Logger) bufferEvent(ev *Event, cause error) {
+	d := l.degraded
+	if len(d.buffer) == 0 {
+		d.prevSignature = l.lastSignature
+		d.stats.Degraded = true
+		d.stats.Since = time.Unix(0, l.now())
+		d.stats.Outages++
+
+		if l.stderr != nil {
+			l.stderr.Write([]byte("logger failure: buffering events: " + cause.Error() + "\n"))
+		}
+	}
+
+	ev.retained = true
+	ev.err = ErrBuffered
+	d.buffer = append(d.buffer, ev)
+	if len(d.buffer) > d.stats.Peak {
+		d.stats.Peak = len(d.buffer)
+	}
+}
+
+// waitDegraded blocks while the buffer is full, trying to store the
+// buffered events every interval; the caller must hold the logger's
+// lock.
+func (l *Logger) waitDegraded() {
+	d := l.degraded
+	if len(d.buffer) < d.policy.MaxEvents {
+		return
+	}
+
+	start := time.Now()
+	for len(d.buffer) >= d.policy.MaxEvents {
+		time.Sleep(d.policy.Interval)
+		l.flushDegraded()
+	}
+	d.stats.Blocked += time.Since(start)
+}
+
+// flushDegraded stores the buffered events, in order, stopping at the
+// first that can't be stored. Once the buffer has been emptied, a
+// "database recovered" event is recorded. The caller must hold the
+// logger's lock.
+func (l *Logger) flushDegraded() {
+	d := l.degraded
+	if len(d.buffer) == 0 {
+		return
+	}
+
+	if reopener, ok := l.store.(Reopener); ok {
+		if _, err := l.store.Count(); err != nil {
+			reopener.Reopen()
+		}
+	}
+
+	for i, ev := range d.buffer {
+		if err := l.store.StoreEvent(ev); err != nil {
+			d.buffer = append([]*Event(nil), d.buffer[i:]...)
+			return
+		}
+		d.stats.Flushed++
+		l.publishFlushed(ev)
+	}
+
+	events := len(d.buffer)
+	since := d.stats.Since
+	d.buffer = nil
+	d.prevSignature = nil
+	d.stats.Degraded = false
+	d.stats.Since = time.Time{}
+
+	l.record(&Event{
+		When:  l.now(),
+		Level: levelStrings[levelWarning],
+		Actor: internalActor,
+		Event: EventDatabaseRecovered,
+		Attributes: []Attribute{
+			{"events", strconv.Itoa(events)},
+			{"since", since.UTC().Format(time.RFC3339Nano)},
+		},
+	})
+}
+
+// drainDegraded makes a final attempt to store the buffered events
+// when the logger stops. Any that remain are spooled if a spool is
+// configured, after unwinding the chain to the first of them, and
+// are otherwise written to standard error and counted as lost. The
+// caller must hold the logger's lock.
+func (l *Logger) drainDegraded() {
+	if !l.buffering() {
+		return
+	}
+
+	l.flushDegraded()
+	d := l.degraded
+	if len(d.buffer) == 0 {
+		return
+	}
+
+	buffer := d.buffer
+	d.buffer = nil
+	d.stats.Degraded = false
+
+	if l.spool != nil {
+		l.counter = buffer[0].Serial
+		l.lastSignature = d.prevSignature
+		cause := errors.New("database unavailable at shutdown")
+		for _, ev := range buffer {
+			l.spoolEvent(ev, cause)
+		}
+		return
+	}
+
+	for _, ev := range buffer {
+		if l.stderr != nil {
+			l.stderr.Write([]byte("logger failure: event lost: " + ev.String() + "\n"))
+		}
+		d.stats.Lost++
+	}
+}
@@ -0,0 +1,105 @@
+package auditlog
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedFailingStore is a memory store whose writes fail while fail
+// is set; it may be changed while the logger is blocked on it.
+type lockedFailingStore struct {
+	*MemoryStore
+	lock sync.Mutex
+	fail bool
+}
+
+func (fs *lockedFailingStore) setFail(fail bool) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	fs.fail = fail
+}
+
+func (fs *lockedFailingStore) StoreEvent(ev *Event) error {
+	fs.lock.Lock()
+	fail := fs.fail
+	fs.lock.Unlock()
+
+	if fail {
+		return errors.New("database unavailable")
+	}
+	return fs.MemoryStore.StoreEvent(ev)
+}
+
+func TestDegradedMode(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	store := &lockedFailingStore{MemoryStore: NewMemoryStore()}
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithDegradedMode(DegradedPolicy{
+		MaxEvents: 3,
+		Interval:  10 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("degraded_test", "stored", nil)
+
+	store.setFail(true)
+	l.InfoSync("degraded_test", "buffered", nil)
+	l.InfoSync("degraded_test", "buffered", nil)
+	l.InfoSync("degraded_test", "buffered", nil)
+
+	stats := l.DegradedStats()
+	if !stats.Degraded || stats.Buffered != 3 || stats.Outages != 1 {
+		t.Fatalf("expected 3 buffered events in one outage, have %+v", stats)
+	}
+
+	// The buffer is full, so the next event waits for the
+	// database to recover.
+	done := make(chan struct{})
+	go func() {
+		l.InfoSync("degraded_test", "blocked", nil)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("expected the logger to block while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	store.setFail(false)
+	<-done
+
+	stats = l.DegradedStats()
+	if stats.Degraded || stats.Buffered != 0 || stats.Flushed != 3 || stats.Blocked == 0 {
+		t.Fatalf("expected the buffered events to be flushed, have %+v", stats)
+	}
+
+	// stored, three buffered, database recovered, blocked
+	count, err := store.Count()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if count != 6 || l.Count() != 6 {
+		t.Fatalf("expected 6 stored events, have %d", count)
+	}
+
+	ev, err := store.Event(4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if ev.Event != EventDatabaseRecovered {
+		t.Fatalf("expected a %q event, have %s", EventDatabaseRecovered, ev)
+	}
+
+	if err = l.verifyAuditChain(); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
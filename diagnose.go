@@ -0,0 +1,485 @@
+package auditlog
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The checks made by Diagnose, as named in the problems it reports.
+const (
+	CheckSchema     = "schema"
+	CheckCounter    = "counter"
+	CheckGaps       = "gaps"
+	CheckOrphans    = "orphans"
+	CheckSignatures = "signatures"
+	CheckClock      = "clock"
+)
+
+// diagnoseLimit caps the number of serial numbers listed in a single
+// finding; the message still gives the full count.
+const diagnoseLimit = 100
+
+// clockTolerance is how far in the future an event may have been
+// received before Diagnose reports it.
+const clockTolerance = time.Minute
+
+// A Problem is reported by Diagnose at Level, which is "WARNING" or
+// "ERROR". Serials lists the events affected, if the problem lies
+// with particular events. Fixable is set if Repair can fix the
+// problem without touching the chain.
+type Problem struct {
+	Check   string   `json:"check"`
+	Level   string   `json:"level"`
+	Message string   `json:"message"`
+	Serials []uint64 `json:"serials,omitempty"`
+	Fixable bool     `json:"fixable,omitempty"`
+}
+
+// A Diagnosis reports the health of a store. Count is the number of
+// events in the chain, including pruned ones, and Start the serial
+// number of the first event that is still held; Checked lists the
+// checks that were made.
+type Diagnosis struct {
+	Count    uint64    `json:"count"`
+	Start    uint64    `json:"start"`
+	Checked  []string  `json:"checked"`
+	Problems []Problem `json:"problems"`
+}
+
+// Healthy reports whether the diagnosis found no problems.
+func (d *Diagnosis) Healthy() bool {
+	return len(d.Problems) == 0
+}
+
+// Fixable reports whether any of the problems found can be fixed by
+// Repair.
+func (d *Diagnosis) Fixable() bool {
+	for _, f := range d.Problems {
+		if f.Fixable {
+			return true
+		}
+	}
+	return false
+}
+
+// An Inspector is a Store that can check its own consistency beyond
+// what is visible through the Store interface, such as its schema and
+// the records underlying each event.
+type Inspector interface {
+	// Inspect checks the store, returning the problems found.
+	Inspect() ([]Problem, error)
+
+	// Repair fixes the problems found by Inspect that can be fixed
+	// without modifying the chain, returning a description of each
+	// change made.
+	Repair() ([]string, error)
+}
+
+func newProblem(check, level string, serials []uint64, format string, args ...interface{}) Problem {
+	if len(serials) > diagnoseLimit {
+		serials = serials[:diagnoseLimit]
+	}
+	return Problem{
+		Check:   check,
+		Level:   level,
+		Message: fmt.Sprintf(format, args...),
+		Serials: serials,
+	}
+}
+
+// Diagnose checks a store for problems without going through a
+// logger, so that a store a logger refuses to start on can still be
+// examined. Every event held is read, and checked for gaps in the
+// serial numbers, signatures that don't verify with pub, and receipt
+// times that run backwards or lie in the future; if the store records
+// a key history ending with pub, signatures are checked against that.
+// If pub is nil, the signatures aren't checked. Stores that are Inspectors are also
+// asked to check themselves.
+//
+// Diagnose doesn't modify the store; an error is only returned if the
+// store couldn't be read.
+func Diagnose(store Store, pub *ecdsa.PublicKey) (*Diagnosis, error) {
+	d := &Diagnosis{}
+
+	if in, ok := store.(Inspector); ok {
+		problems, err := in.Inspect()
+		if err != nil {
+			return nil, err
+		}
+		d.Checked = append(d.Checked, CheckSchema, CheckCounter, CheckOrphans)
+		d.Problems = append(d.Problems, problems...)
+	}
+
+	count, err := store.Count()
+	if err != nil {
+		return nil, err
+	}
+	d.Count = count
+
+	var prev []byte
+	if pr, ok := store.(Pruner); ok {
+		end, sig, ok, err := pr.Pruned()
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			d.Start, prev = end+1, sig
+		}
+	}
+
+	d.Checked = append(d.Checked, CheckGaps, CheckClock)
+	var keys KeyManifest
+	if pub != nil {
+		d.Checked = append(d.Checked, CheckSignatures)
+		keys = diagnosisKeys(store, pub)
+	}
+
+	var gaps, bad, backwards, future []uint64
+	var lastReceived int64
+	var unsigned int
+	limit := time.Now().Add(clockTolerance).UnixNano()
+
+	// After a gap the chain can't be followed, so the signature of
+	// the next event isn't checked, and the batch it belongs to can't
+	// be checked against its seal.
+	linked := true
+	next := d.Start
+	seals := newSealCheck(d.Start)
+	for serial := d.Start; serial < count; serial += backupBatch {
+		last := serial + backupBatch - 1
+		if last >= count {
+			last = count - 1
+		}
+
+		events, err := store.Events(serial, last)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(events, func(i, j int) bool {
+			return events[i].Serial < events[j].Serial
+		})
+
+		for _, ev := range events {
+			for ; next < ev.Serial; next++ {
+				gaps = append(gaps, next)
+				linked = false
+			}
+
+			if !linked {
+				seals = newSealCheck(ev.Serial)
+			}
+			if keys != nil {
+				ok := !linked || keys.verify(ev, prev)
+				if !seals.add(ev) || !ok {
+					bad = append(bad, ev.Serial)
+				}
+			}
+			prev, linked = ev.Signature, true
+
+			if ev.Signed() {
+				unsigned = 0
+			} else {
+				unsigned++
+			}
+
+			if ev.Received < lastReceived {
+				backwards = append(backwards, ev.Serial)
+			}
+			if ev.Received > limit {
+				future = append(future, ev.Serial)
+			}
+			lastReceived = ev.Received
+			next = ev.Serial + 1
+		}
+
+		for ; next <= last; next++ {
+			gaps = append(gaps, next)
+			linked = false
+		}
+	}
+
+	if len(gaps) > 0 {
+		d.Problems = append(d.Problems, newProblem(CheckGaps, levelStrings[levelError], gaps,
+			"%d events are missing from the chain", len(gaps)))
+	}
+
+	if len(bad) > 0 {
+		d.Problems = append(d.Problems, newProblem(CheckSignatures, levelStrings[levelError], bad,
+			"%d events fail signature verification", len(bad)))
+	}
+
+	if pub != nil && unsigned > 0 {
+		d.Problems = append(d.Problems, newProblem(CheckSignatures, levelStrings[levelWarning], nil,
+			"the last %d events are hash-linked but not yet covered by a batch signature", unsigned))
+	}
+
+	if len(backwards) > 0 {
+		d.Problems = append(d.Problems, newProblem(CheckClock, levelStrings[levelWarning], backwards,
+			"%d events were received before the event preceding them", len(backwards)))
+	}
+
+	if len(future) > 0 {
+		d.Problems = append(d.Problems, newProblem(CheckClock, levelStrings[levelWarning], future,
+			"%d events were received in the future", len(future)))
+	}
+	return d, nil
+}
+
+// Repair applies the fixes for a store's problems that are safe to
+// make, returning a description of each change. Nothing that is part
+// of the chain is changed: events that are missing or fail to verify
+// can't be repaired, only restored from a backup. Stores that aren't
+// Inspectors have nothing to repair.
+func Repair(store Store) ([]string, error) {
+	in, ok := store.(Inspector)
+	if !ok {
+		return nil, nil
+	}
+	return in.Repair()
+}
+
+// diagnosisKeys returns the keys to check signatures with: the key
+// history recorded in the store, if it ends with pub, or else pub
+// alone.
+func diagnosisKeys(store Store, pub *ecdsa.PublicKey) KeyManifest {
+	if kr, ok := store.(KeyRecorder); ok {
+		recs, err := kr.Keys()
+		if err == nil && len(recs) > 0 {
+			keys, err := manifestFrom(recs)
+			if err == nil && keys[len(keys)-1].Public.Equal(pub) {
+				return keys
+			}
+		}
+	}
+	return singleKey(pub)
+}
+
+// schemaColumns lists the columns of each table in auditlog.sql.
+var schemaColumns = map[string][]string{
+	"events":           {"id", "timestamp", "received", "level", "actor", "event", "signature", "payload"},
+	"attributes":       {"id", "name", "value", "event", "position"},
+	"error_events":     {"id", "serial", "timestamp", "received", "level", "actor", "event"},
+	"error_attributes": {"id", "name", "value", "event", "position"},
+	"errors":           {"id", "timestamp", "message", "event"},
+	"pruned":           {"id", "end_serial", "signature"},
+	"signing_keys":     {"first_serial", "public_key"},
+	"checkpoints":      {"serial", "taken", "head", "signature"},
+	"cosignatures":     {"serial", "witness", "signature"},
+}
+
+// schemaAddedColumns lists the columns added to auditlog.sql after it
+// was first published, with their definitions; older databases may
+// lack them.
+var schemaAddedColumns = []struct{ table, column, definition string }{
+	{"events", "digest_version", "INT2 NOT NULL DEFAULT 0"},
+}
+
+// schemaIndexes maps the indexes in auditlog.sql to their
+// definitions. They were added to the schema after it was first
+// published, so older databases may lack them.
+var schemaIndexes = map[string]string{
+	"attributes_event":       "attributes (event, position)",
+	"error_events_serial":    "error_events (serial)",
+	"error_attributes_event": "error_attributes (event, position)",
+	"events_actor":           "events (actor, id)",
+	"events_level":           "events (level, id)",
+	"attributes_name_value":  "attributes (name, substr(value, 1, 200))",
+}
+
+// Inspect checks the database against the schema in auditlog.sql,
+// checks that the events table holds every serial number up to the
+// highest one, and looks for attributes that don't belong to any
+// event.
+func (s *pgStore) Inspect() ([]Problem, error) {
+	var problems []Problem
+
+	found := map[string]bool{}
+	rows, err := s.db.Query(`SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema()`)
+	if err != nil {
+		return nil, err
+	}
+
+	for rows.Next() {
+		var table, column string
+		if err = rows.Scan(&table, &column); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found[table+"."+column] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, table := range auditTables {
+		for _, column := range schemaColumns[table] {
+			if !found[table+"."+column] {
+				missing = append(missing, table+"."+column)
+			}
+		}
+	}
+
+	// The remaining checks need the tables themselves.
+	if len(missing) > 0 {
+		return []Problem{newProblem(CheckSchema, levelStrings[levelError], nil,
+			"missing columns: %s", strings.Join(missing, ", "))}, nil
+	}
+
+	missing = nil
+	for _, added := range schemaAddedColumns {
+		if !found[added.table+"."+added.column] {
+			missing = append(missing, added.table+"."+added.column)
+		}
+	}
+
+	if len(missing) > 0 {
+		f := newProblem(CheckSchema, levelStrings[levelWarning], nil,
+			"missing columns: %s", strings.Join(missing, ", "))
+		f.Fixable = true
+		problems = append(problems, f)
+	}
+
+	missing = nil
+	for _, name := range sortedKeys(schemaIndexes) {
+		var present bool
+		err = s.db.QueryRow(`SELECT to_regclass($1) IS NOT NULL`, name).Scan(&present)
+		if err != nil {
+			return nil, err
+		}
+
+		if !present {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		f := newProblem(CheckSchema, levelStrings[levelWarning], nil,
+			"missing indexes: %s", strings.Join(missing, ", "))
+		f.Fixable = true
+		problems = append(problems, f)
+	}
+
+	var rowCount, maxID, minID int64
+	err = s.db.QueryRow(`SELECT count(*), COALESCE(MAX(id), -1), COALESCE(MIN(id), 0)
+		FROM events`).Scan(&rowCount, &maxID, &minID)
+	if err != nil {
+		return nil, err
+	}
+
+	end, _, pruned, err := s.Pruned()
+	if err != nil {
+		return nil, err
+	}
+
+	var first int64
+	if pruned {
+		first = int64(end) + 1
+	}
+
+	switch {
+	case rowCount > 0 && minID < first:
+		problems = append(problems, newProblem(CheckCounter, levelStrings[levelError], nil,
+			"events table holds event %d, which was pruned", minID))
+	case rowCount > 0 && maxID-first+1 != rowCount:
+		problems = append(problems, newProblem(CheckCounter, levelStrings[levelError], nil,
+			"events table holds %d events, but the highest serial number is %d", rowCount, maxID))
+	}
+
+	for _, check := range []struct{ table, parent string }{
+		{"attributes", "events"},
+		{"error_attributes", "error_events"},
+	} {
+		var orphans []uint64
+		rows, err := s.db.Query(`SELECT DISTINCT a.event FROM ` + check.table + ` a
+			WHERE NOT EXISTS (SELECT 1 FROM ` + check.parent + ` p WHERE p.id = a.event)
+			ORDER BY a.event`)
+		if err != nil {
+			return nil, err
+		}
+
+		for rows.Next() {
+			var serial uint64
+			if err = rows.Scan(&serial); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			orphans = append(orphans, serial)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+
+		// Orphaned attributes are kept as evidence: they may be
+		// all that remains of a deleted event.
+		if len(orphans) > 0 {
+			problems = append(problems, newProblem(CheckOrphans, levelStrings[levelWarning], orphans,
+				"%s holds attributes for %d missing %s", check.table, len(orphans), check.parent))
+		}
+	}
+
+	return problems, nil
+}
+
+// Repair applies any pending schema migrations, adds any missing
+// columns and indexes, rebuilds the indexes on the audit tables, and
+// refreshes the planner's statistics for them. It needs to connect as
+// the owner of the tables.
+func (s *pgStore) Repair() ([]string, error) {
+	var done []string
+	if _, _, err := migrateSchema(s.db); err != nil {
+		return done, err
+	}
+	done = append(done, "applied schema migrations")
+
+	for _, added := range schemaAddedColumns {
+		_, err := s.db.Exec(`ALTER TABLE ` + added.table + ` ADD COLUMN IF NOT EXISTS ` +
+			added.column + ` ` + added.definition)
+		if err != nil {
+			return done, err
+		}
+	}
+	done = append(done, "added missing columns")
+
+	if err := s.checkVersioned(); err != nil {
+		return done, err
+	}
+
+	for _, name := range sortedKeys(schemaIndexes) {
+		_, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS ` + name + ` ON ` + schemaIndexes[name])
+		if err != nil {
+			return done, err
+		}
+	}
+	done = append(done, "created missing indexes")
+
+	for _, table := range auditTables {
+		_, err := s.db.Exec(`REINDEX TABLE ` + table)
+		if err != nil {
+			return done, err
+		}
+
+		_, err = s.db.Exec(`ANALYZE ` + table)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, "rebuilt indexes on "+table)
+	}
+	return done, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
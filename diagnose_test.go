@@ -0,0 +1,78 @@
+package auditlog
+
+import "testing"
+
+// damagedStore hides one event and alters another, as a damaged
+// database would.
+type damagedStore struct {
+	*MemoryStore
+	missing, altered uint64
+}
+
+func (ds *damagedStore) Events(start, end uint64) ([]*Event, error) {
+	events, err := ds.MemoryStore.Events(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var kept []*Event
+	for _, ev := range events {
+		switch ev.Serial {
+		case ds.missing:
+			continue
+		case ds.altered:
+			ev.Actor = "intruder"
+			ev.Received = 0
+		}
+		kept = append(kept, ev)
+	}
+	return kept, nil
+}
+
+func TestDiagnose(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, store := newTestLogger(t)
+	l.Start()
+
+	for i := 0; i < 10; i++ {
+		l.InfoSync("diagnose_test", "event", nil)
+	}
+	l.Stop()
+
+	d, err := Diagnose(store, &signer.PublicKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !d.Healthy() || d.Count != 10 {
+		t.Fatalf("expected a healthy chain of 10 events, have %+v", d)
+	}
+
+	d, err = Diagnose(&damagedStore{MemoryStore: store, missing: 3, altered: 7}, &signer.PublicKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	found := map[string][]uint64{}
+	for _, f := range d.Problems {
+		found[f.Check] = append(found[f.Check], f.Serials...)
+	}
+
+	// Event 4 follows the gap, so its signature can't be checked.
+	if len(found[CheckGaps]) != 1 || found[CheckGaps][0] != 3 {
+		t.Fatalf("expected event 3 to be missing, have %v", found[CheckGaps])
+	}
+
+	if len(found[CheckSignatures]) != 1 || found[CheckSignatures][0] != 7 {
+		t.Fatalf("expected event 7 to fail verification, have %v", found[CheckSignatures])
+	}
+
+	if len(found[CheckClock]) != 1 || found[CheckClock][0] != 7 {
+		t.Fatalf("expected a clock anomaly at event 7, have %v", found[CheckClock])
+	}
+
+	if d.Fixable() {
+		t.Fatal("damage to the chain shouldn't be fixable")
+	}
+}
@@ -0,0 +1,184 @@
+package auditlog
+
+import "encoding/binary"
+
+// A DigestVersion identifies the encoding of an event from which its
+// digest, and so its signature, is computed.
+type DigestVersion uint8
+
+const (
+	// DigestLegacy is the original encoding: the serial number and
+	// timestamps as big-endian 64-bit integers, followed by the
+	// level, actor, event, and attribute names and values, and the
+	// previous event's signature, concatenated without separators.
+	// Events recorded before digests were versioned use it.
+	DigestLegacy DigestVersion = iota
+
+	// DigestCBOR is the deterministic CBOR encoding (RFC 8949,
+	// section 4.2.1) of a map with the keys
+	//
+	//	0: the digest version, as an unsigned integer
+	//	1: the serial number, as an unsigned integer
+	//	2: the time the event was logged, as an integer
+	//	3: the time the event was received, as an integer
+	//	4: the level, as a text string
+	//	5: the actor, as a text string
+	//	6: the event, as a text string
+	//	7: the attributes, as an array of [name, value] arrays
+	//	   of text strings
+	//	8: the previous event's signature, as a byte string
+	//
+	// Unlike the legacy encoding, it is unambiguous, can be
+	// reproduced with any CBOR library, and leaves room for fields
+	// to be added under new keys.
+	DigestCBOR
+
+	// DigestEncrypted is DigestCBOR, except that an event text or
+	// attribute value encrypted by WithEncryption is encoded as a
+	// byte string holding its commitment to the plaintext, rather
+	// than as a text string, so that the signature doesn't cover
+	// the ciphertext.
+	DigestEncrypted
+)
+
+// A DigestRecorder is a Store that records the digest version of each
+// event (see Event.Digest). Loggers only record events with DigestCBOR
+// on stores that report that they can; on other stores, events would
+// lose their version, and so could no longer be verified, so they are
+// recorded with DigestLegacy.
+type DigestRecorder interface {
+	RecordsDigests() bool
+}
+
+// RecordsDigests reports that MemoryStores record digest versions.
+func (ms *MemoryStore) RecordsDigests() bool {
+	return true
+}
+
+// WithLegacyDigests records new events with DigestLegacy, rather than
+// DigestCBOR, for verifiers that only understand the legacy encoding.
+// Events are verified with their own digest version either way.
+func WithLegacyDigests() Option {
+	return func(l *Logger) {
+		l.legacyDigests = true
+	}
+}
+
+// digestVersion returns the digest version with which the logger
+// records events.
+func (l *Logger) digestVersion() DigestVersion {
+	if l.legacyDigests {
+		return DigestLegacy
+	}
+
+	if dr, ok := l.store.(DigestRecorder); ok && dr.RecordsDigests() {
+		if l.encryption != nil {
+			return DigestEncrypted
+		}
+		return DigestCBOR
+	}
+	return DigestLegacy
+}
+
+// CBOR major types.
+const (
+	cborUnsigned = 0 << 5
+	cborNegative = 1 << 5
+	cborBytes    = 2 << 5
+	cborText     = 3 << 5
+	cborArray    = 4 << 5
+	cborMap      = 5 << 5
+)
+
+// appendCBORHead appends the head of a CBOR data item, with the
+// argument in its shortest form.
+func appendCBORHead(buf []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(buf, major|byte(n))
+	case n <= 0xff:
+		return append(buf, major|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(buf, major|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(buf, major|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(buf, major|27), n)
+	}
+}
+
+func appendCBORInt(buf []byte, n int64) []byte {
+	if n < 0 {
+		return appendCBORHead(buf, cborNegative, uint64(-1-n))
+	}
+	return appendCBORHead(buf, cborUnsigned, uint64(n))
+}
+
+func appendCBORText(buf []byte, s string) []byte {
+	buf = appendCBORHead(buf, cborText, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// appendCBOR appends the DigestCBOR encoding of the event chained to
+// prev.
+func (ev *Event) appendCBOR(buf []byte, prev []byte) []byte {
+	buf = appendCBORHead(buf, cborMap, 9)
+	buf = appendCBORHead(buf, cborUnsigned, 0)
+	buf = appendCBORHead(buf, cborUnsigned, uint64(ev.Digest))
+	buf = appendCBORHead(buf, cborUnsigned, 1)
+	buf = appendCBORHead(buf, cborUnsigned, ev.Serial)
+	buf = appendCBORHead(buf, cborUnsigned, 2)
+	buf = appendCBORInt(buf, ev.When)
+	buf = appendCBORHead(buf, cborUnsigned, 3)
+	buf = appendCBORInt(buf, ev.Received)
+	buf = appendCBORHead(buf, cborUnsigned, 4)
+	buf = appendCBORText(buf, ev.Level)
+	buf = appendCBORHead(buf, cborUnsigned, 5)
+	buf = appendCBORText(buf, ev.Actor)
+	buf = appendCBORHead(buf, cborUnsigned, 6)
+	buf = ev.appendCBORValue(buf, ev.Event)
+	buf = appendCBORHead(buf, cborUnsigned, 7)
+	buf = appendCBORHead(buf, cborArray, uint64(len(ev.Attributes)))
+	for i := range ev.Attributes {
+		buf = appendCBORHead(buf, cborArray, 2)
+		buf = appendCBORText(buf, ev.Attributes[i].Name)
+		buf = ev.appendCBORValue(buf, ev.Attributes[i].Value)
+	}
+	buf = appendCBORHead(buf, cborUnsigned, 8)
+	buf = appendCBORHead(buf, cborBytes, uint64(len(prev)))
+	return append(buf, prev...)
+}
+
+// appendCBORValue appends an event text or attribute value: under
+// DigestEncrypted, an encrypted value is replaced by its commitment.
+func (ev *Event) appendCBORValue(buf []byte, s string) []byte {
+	if ev.Digest == DigestEncrypted {
+		if commitment, ok := encryptedCommitment(s); ok {
+			buf = appendCBORHead(buf, cborBytes, uint64(len(commitment)))
+			return append(buf, commitment...)
+		}
+	}
+	return appendCBORText(buf, s)
+}
+
+// appendLegacy appends the DigestLegacy encoding of the event chained
+// to prev.
+func (ev *Event) appendLegacy(buf []byte, prev []byte) []byte {
+	buf = binary.BigEndian.AppendUint64(buf, ev.Serial)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(ev.When))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(ev.Received))
+	buf = append(buf, ev.Level...)
+	buf = append(buf, ev.Actor...)
+	buf = append(buf, ev.Event...)
+	for i := range ev.Attributes {
+		buf = append(buf, ev.Attributes[i].Name...)
+		buf = append(buf, ev.Attributes[i].Value...)
+	}
+	return append(buf, prev...)
+}
+
+// knownDigest reports whether the event's digest version is one this
+// package can compute.
+func (ev *Event) knownDigest() bool {
+	return ev.Digest <= DigestEncrypted
+}
@@ -0,0 +1,116 @@
+package auditlog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestDigestCBOR(t *testing.T) {
+	ev := &Event{
+		Serial:     42,
+		When:       1000,
+		Received:   -1,
+		Level:      "INFO",
+		Actor:      "a",
+		Event:      "e",
+		Attributes: []Attribute{{"k", "v"}},
+		Digest:     DigestCBOR,
+	}
+	prev := []byte("pp")
+
+	encoding, err := hex.DecodeString("a9" +
+		"0001" + // 0: version 1
+		"01182a" + // 1: serial 42
+		"021903e8" + // 2: when 1000
+		"0320" + // 3: received -1
+		"0464494e464f" + // 4: "INFO"
+		"056161" + // 5: "a"
+		"066165" + // 6: "e"
+		"078182616b6176" + // 7: [["k", "v"]]
+		"08427070") // 8: h'7070'
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	want := sha256.Sum256(encoding)
+	if digest := ev.digest(prev); !bytes.Equal(digest[:], want[:]) {
+		t.Fatalf("digest doesn't match the canonical encoding: %x", digest)
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { ev.digest(prev) }); allocs != 0 {
+		t.Fatalf("expected computing a digest not to allocate, have %v allocations", allocs)
+	}
+
+	signer := testKey(t, "signer")
+
+	if err = ev.Sign(signer, prev, rand.Reader); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !ev.Verify(&signer.PublicKey, prev) {
+		t.Fatal("event should verify")
+	}
+
+	// The version is covered by the digest, so an event can't be
+	// passed off under another version.
+	ev.Digest = DigestLegacy
+	if ev.Verify(&signer.PublicKey, prev) {
+		t.Fatal("event should not verify with another digest version")
+	}
+
+	ev.Digest = DigestEncrypted + 1
+	if ev.Verify(&signer.PublicKey, prev) {
+		t.Fatal("event with an unknown digest version should not verify")
+	}
+
+	if err = ev.Sign(signer, prev, rand.Reader); err == nil {
+		t.Fatal("signing an event with an unknown digest version should fail")
+	}
+}
+
+// legacyStore hides the MemoryStore's DigestRecorder method.
+type legacyStore struct {
+	Store
+}
+
+func TestDigestVersions(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	store := NewMemoryStore()
+	for _, step := range []struct {
+		store   Store
+		opts    []Option
+		version DigestVersion
+	}{
+		{store, []Option{WithLegacyDigests()}, DigestLegacy},
+		{store, nil, DigestCBOR},
+		{legacyStore{store}, nil, DigestLegacy},
+		{store, nil, DigestCBOR},
+	} {
+		// Each logger verifies the chain, with its mix of digest
+		// versions, as it starts.
+		l, err := NewWithStore(step.store, signer, append(step.opts, WithoutEcho())...)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		l.Start()
+		l.InfoSync("digest_test", "event", []Attribute{{"version", "any"}})
+		l.Stop()
+
+		ev, err := store.Event(l.counter - 1)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if ev.Digest != step.version {
+			t.Fatalf("expected digest version %d, have %d", step.version, ev.Digest)
+		}
+
+		if err = l.verifyAuditChain(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package auditlog
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// A Durability sets how far an event must be committed before it is
+// considered recorded, trading the latency of each commit against the
+// events that could be lost if the database server crashes.
+type Durability int
+
+const (
+	// DurabilityDefault uses the logger's durability, or, for a
+	// logger, DurabilityFull.
+	DurabilityDefault Durability = iota
+
+	// DurabilityAsync doesn't wait for events to reach disk: a
+	// crash may lose the events committed in the moments before
+	// it, though the chain is never left inconsistent. For
+	// Postgres, synchronous_commit is off, and the journal isn't
+	// synced to disk as events are added to it.
+	DurabilityAsync
+
+	// DurabilityLocal waits for events to reach the database
+	// server's own disk, but not its replicas; for Postgres,
+	// synchronous_commit is local.
+	DurabilityLocal
+
+	// DurabilityFull waits for events to be committed as durably
+	// as the database is configured to commit; for Postgres,
+	// synchronous_commit is on, so synchronous replicas must
+	// confirm them.
+	DurabilityFull
+)
+
+// durabilities maps the names used in configuration files to
+// durabilities.
+var durabilities = map[string]Durability{
+	"":      DurabilityDefault,
+	"async": DurabilityAsync,
+	"local": DurabilityLocal,
+	"full":  DurabilityFull,
+}
+
+// WithDurability sets the durability of the events the logger
+// records. CRITICAL events are always recorded with DurabilityFull,
+// and LogDurable overrides it for a single event.
+func WithDurability(d Durability) Option {
+	return func(l *Logger) {
+		l.durability = d
+	}
+}
+
+// durabilityOf returns the durability with which ev is to be
+// recorded.
+func (l *Logger) durabilityOf(ev *Event) Durability {
+	switch {
+	case ev.Level == levelStrings[levelCritical]:
+		return DurabilityFull
+	case ev.durability != DurabilityDefault:
+		return ev.durability
+	default:
+		return l.durability
+	}
+}
+
+// LogDurable records an event with the given durability, regardless
+// of the logger's, and waits for it to be recorded. The level is one
+// of "DEBUG", "INFO", "WARNING", "ERROR", or "CRITICAL". As with InfoE,
+// an error is returned if the event wasn't stored.
+func (l *Logger) LogDurable(d Durability, level, actor, event string, attributes []Attribute) error {
+	lvl := levelFromString(level)
+	if lvl == levelUnknown {
+		return errors.New("auditlog: unknown level " + level)
+	}
+
+	if ok, err := l.admit(lvl); !ok {
+		return err
+	}
+
+	var err error
+	wait := make(chan struct{}, 0)
+	l.logDurableEvent(l.now(), lvl, actor, event, attributes, d, wait, &err)
+	<-wait
+	return err
+}
+
+// synchronousCommit returns the setting of synchronous_commit that
+// gives durability d, or the empty string if the server's setting is
+// to be left alone.
+func synchronousCommit(d Durability) string {
+	switch d {
+	case DurabilityAsync:
+		return "off"
+	case DurabilityLocal:
+		return "local"
+	case DurabilityFull:
+		return "on"
+	}
+	return ""
+}
+
+// setDurability sets synchronous_commit for the rest of a transaction
+// storing events, to the strongest durability they ask for.
+func setDurability(tx *sql.Tx, events ...*Event) error {
+	d := DurabilityDefault
+	for _, ev := range events {
+		if ev.durability > d {
+			d = ev.durability
+		}
+	}
+
+	setting := synchronousCommit(d)
+	if setting == "" {
+		return nil
+	}
+
+	_, err := tx.Exec(`SET LOCAL synchronous_commit TO ` + setting)
+	return err
+}
@@ -0,0 +1,64 @@
+package auditlog
+
+import (
+	"sync"
+	"testing"
+)
+
+// durabilityStore is a memory store that records the durability each
+// event is stored with.
+type durabilityStore struct {
+	*MemoryStore
+	lock sync.Mutex
+	seen map[string]Durability
+}
+
+func (ds *durabilityStore) StoreEvent(ev *Event) error {
+	ds.lock.Lock()
+	ds.seen[ev.Event] = ev.durability
+	ds.lock.Unlock()
+	return ds.MemoryStore.StoreEvent(ev)
+}
+
+func TestDurability(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	store := &durabilityStore{MemoryStore: NewMemoryStore(), seen: map[string]Durability{}}
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithDurability(DurabilityAsync))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+
+	l.InfoSync("durability_test", "default", nil)
+	l.CriticalSync("durability_test", "critical", nil)
+	if err = l.LogDurable(DurabilityLocal, "WARNING", "durability_test", "override", nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = l.LogDurable(DurabilityFull, "LOUD", "durability_test", "unknown", nil); err == nil {
+		t.Fatal("expected an unknown level to be rejected")
+	}
+	l.Stop()
+
+	for event, want := range map[string]Durability{
+		"default":  DurabilityAsync,
+		"critical": DurabilityFull,
+		"override": DurabilityLocal,
+	} {
+		if have := store.seen[event]; have != want {
+			t.Fatalf("expected %q to be stored with durability %d, have %d", event, want, have)
+		}
+	}
+
+	for d, want := range map[Durability]string{
+		DurabilityDefault: "",
+		DurabilityAsync:   "off",
+		DurabilityLocal:   "local",
+		DurabilityFull:    "on",
+	} {
+		if have := synchronousCommit(d); have != want {
+			t.Fatalf("expected synchronous_commit %q for durability %d, have %q", want, d, have)
+		}
+	}
+}
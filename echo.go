@@ -0,0 +1,190 @@
+package auditlog
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// By default, a logger echoes every recorded event: DEBUG and INFO
+// events are written to standard output, and everything else to
+// standard error. The options in this file change where, and whether,
+// events are echoed; the signed chain in the store is unaffected.
+
+// WithoutEcho disables echoing recorded events, including the
+// reports of events that could not be recorded.
+func WithoutEcho() Option {
+	return func(l *Logger) {
+		l.stdout = nil
+		l.stderr = nil
+		l.sinks = nil
+	}
+}
+
+// WithOutput sets the writers used for the default echo: DEBUG and
+// INFO events are written to stdout, and other events and failures
+// to record events are written to stderr. Either may be nil to
+// disable that half of the echo.
+func WithOutput(stdout, stderr io.Writer) Option {
+	return func(l *Logger) {
+		l.stdout = stdout
+		l.stderr = stderr
+	}
+}
+
+// WithEcho echoes events at the listed levels (e.g. "WARNING") to w,
+// in addition to the default echo. If no levels are listed, every
+// event is echoed to w. Combine this with WithOutput(nil, nil) to
+// choose exactly which levels are echoed where.
+func WithEcho(w io.Writer, levels ...string) Option {
+	return func(l *Logger) {
+		l.sinks = append(l.sinks, newSink(w, levels))
+	}
+}
+
+// format renders an event with the logger's formatter.
+func (l *Logger) format(ev *Event) string {
+	if l.formatter == nil {
+		return PlainFormatter.Format(ev)
+	}
+	return l.formatter.Format(ev)
+}
+
+// committed passes an event that has been recorded to the logger's
+// outputs, tees, and subscribers; the caller must hold the logger's
+// lock.
+func (l *Logger) committed(ev *Event) {
+	l.echo(ev)
+	l.tee(ev)
+	l.publish(ev)
+}
+
+// echo writes a recorded event to the logger's outputs.
+func (l *Logger) echo(ev *Event) {
+	var line string
+	if l.stdout != nil || l.stderr != nil || len(l.sinks) > 0 {
+		line = l.format(ev)
+	}
+
+	if ev.Level == "DEBUG" || ev.Level == "INFO" {
+		if l.stdout != nil {
+			fmt.Fprintf(l.stdout, "%s\n", line)
+		}
+	} else {
+		if l.stderr != nil {
+			fmt.Fprintf(l.stderr, "%s\n", line)
+		}
+	}
+
+	for _, s := range l.sinks {
+		if !s.wants(ev.Level) {
+			continue
+		}
+
+		if s.formatter != nil {
+			fmt.Fprintf(s.w, "%s\n", s.formatter.Format(ev))
+		} else {
+			fmt.Fprintf(s.w, "%s\n", line)
+		}
+	}
+}
+
+// A sink receives a copy of events at the levels it is interested
+// in.
+type sink struct {
+	w      io.Writer
+	levels map[string]bool
+
+	// path is set for file sinks, which are closed when the
+	// logger is stopped and reopened when it is restarted.
+	path string
+
+	// formatter, if set, overrides the logger's formatter.
+	formatter Formatter
+}
+
+// Write writes p to the sink, so that a file sink can be a spill
+// writer that is closed and reopened with the logger.
+func (s *sink) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
+
+func (s *sink) wants(level string) bool {
+	return len(s.levels) == 0 || s.levels[level]
+}
+
+func newSink(w io.Writer, levels []string) *sink {
+	s := &sink{w: w}
+	if len(levels) > 0 {
+		s.levels = map[string]bool{}
+		for _, level := range levels {
+			s.levels[levelStrings[levelFromString(level)]] = true
+		}
+	}
+	return s
+}
+
+func openSink(sc SinkConfig) (*sink, error) {
+	s := newSink(nil, sc.Levels)
+	if sc.Format != "" {
+		var err error
+		s.formatter, err = FormatterByName(sc.Format)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch sc.Type {
+	case "stdout":
+		s.w = os.Stdout
+	case "stderr":
+		s.w = os.Stderr
+	case "file":
+		s.path = sc.Path
+		err := s.open()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *sink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	s.w = f
+	return nil
+}
+
+// fileSinks returns the logger's sinks, and its spill file if it has
+// one.
+func (l *Logger) fileSinks() []*sink {
+	if l.spill == nil {
+		return l.sinks
+	}
+	return append(l.sinks[:len(l.sinks):len(l.sinks)], l.spill)
+}
+
+// openSinks reopens any file sinks closed by closeSinks.
+func (l *Logger) openSinks() error {
+	for _, s := range l.fileSinks() {
+		if s.path != "" && s.w == nil {
+			err := s.open()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *Logger) closeSinks() {
+	for _, s := range l.fileSinks() {
+		if s.path != "" && s.w != nil {
+			s.w.(*os.File).Close()
+			s.w = nil
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package auditlog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+)
+
+// encryptionPrefix marks a value encrypted under an encryption policy.
+// It is followed by the key ID, the base64-encoded commitment to the
+// plaintext, and the base64-encoded nonce and ciphertext, separated by
+// colons.
+const encryptionPrefix = "encrypted:v1:"
+
+// encryptionSaltSize is the size of the secret salt in a commitment.
+const encryptionSaltSize = 16
+
+// An EncryptionPolicy encrypts the event text and attribute values of
+// recorded events at rest with AES-GCM, under the key Keys returns for
+// KeyName; a KeyStore backed by a key management service would return
+// a data key unwrapped by the service.
+type EncryptionPolicy struct {
+	Keys    KeyStore
+	KeyName string
+}
+
+// WithEncryption encrypts the event text and attribute values of each
+// event before it is stored, as described by the policy. The logger's
+// own events, which verifiers read, are recorded in the clear, as are
+// the level, actor, and attribute names.
+//
+// Each encrypted value carries a commitment to its plaintext, the
+// SHA-256 digest of the plaintext and a random salt that is encrypted
+// with it. Events are recorded with DigestEncrypted, under which the
+// signature covers the commitments rather than the ciphertext, so the
+// chain can be verified without the key, and a decrypted value can be
+// shown to be the one that was signed. Decrypt recovers the plaintext,
+// checking it against the commitments.
+//
+// Encryption requires a store that records digest versions (see
+// DigestRecorder), and can't be combined with WithLegacyDigests. Events
+// held in the write-ahead journal or spool before they are recorded
+// aren't encrypted. A value that can't be encrypted is withheld from
+// the event, and the error is noted in an "encryption_error"
+// attribute.
+func WithEncryption(policy EncryptionPolicy) Option {
+	return func(l *Logger) {
+		if policy.Keys == nil {
+			return
+		}
+
+		l.encryption = &policy
+	}
+}
+
+// checkEncryption reports whether events can be recorded with
+// DigestEncrypted, as the encryption policy requires.
+func (l *Logger) checkEncryption() error {
+	if l.encryption != nil && l.digestVersion() != DigestEncrypted {
+		return errors.New("auditlog: encryption requires a store that records digest versions")
+	}
+	return nil
+}
+
+// encrypt encrypts the event text and attribute values of an event
+// under the encryption policy. The logger's own events, and events
+// that have already been encrypted, are left alone; a caller's value
+// that merely looks encrypted is encrypted like any other.
+func (l *Logger) encrypt(ev *Event) {
+	if l.encryption == nil || ev.internal || ev.encrypted {
+		return
+	}
+	ev.encrypted = true
+
+	id, key, err := l.encryption.Keys.SubjectKey(l.encryption.KeyName)
+	seal := func(name, value string) string {
+		if err == nil {
+			var sealed string
+			sealed, err = encryptCommitted(id, key, name, value)
+			if err == nil {
+				return sealed
+			}
+		}
+		return ErasedValue
+	}
+
+	ev.Event = seal("", ev.Event)
+
+	// The attributes belong to the caller, so they're copied before
+	// being modified.
+	attrs := make([]Attribute, len(ev.Attributes))
+	for i, attr := range ev.Attributes {
+		attrs[i] = Attribute{attr.Name, seal(attr.Name, attr.Value)}
+	}
+
+	if err != nil {
+		attrs = append(attrs, Attribute{"encryption_error", err.Error()})
+	}
+	ev.Attributes = attrs
+}
+
+// commit returns the commitment to a plaintext value.
+func commit(salt []byte, value string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	io.WriteString(h, value)
+	return h.Sum(nil)
+}
+
+// encryptCommitted encrypts a value along with a new salt, and
+// prefixes the ciphertext with the commitment to the value. The
+// ciphertext is bound to the commitment and the attribute's name, or
+// to the empty name for the event text, so that it can't be moved
+// between values.
+func encryptCommitted(id string, key []byte, name, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize()+encryptionSaltSize)
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	nonce, salt := nonce[:aead.NonceSize()], nonce[aead.NonceSize():]
+
+	commitment := commit(salt, value)
+	plaintext := append(append([]byte{}, salt...), value...)
+	out := aead.Seal(nonce, nonce, plaintext, encryptionAAD(commitment, name))
+	return encryptionPrefix + id + ":" + base64.StdEncoding.EncodeToString(commitment) + ":" +
+		base64.StdEncoding.EncodeToString(out), nil
+}
+
+// encryptionAAD returns the data a ciphertext is bound to.
+func encryptionAAD(commitment []byte, name string) []byte {
+	return append(append([]byte{}, commitment...), name...)
+}
+
+// splitEncrypted splits an encrypted value into its key ID, its
+// commitment, and its sealed ciphertext, still base64-encoded,
+// reporting whether it is one.
+func splitEncrypted(value string) (id, commitment, sealed string, ok bool) {
+	if !strings.HasPrefix(value, encryptionPrefix) {
+		return "", "", "", false
+	}
+	rest := strings.TrimPrefix(value, encryptionPrefix)
+
+	// Key IDs are opaque, so the fields are found from the end.
+	i := strings.LastIndexByte(rest, ':')
+	if i < 0 {
+		return "", "", "", false
+	}
+
+	j := strings.LastIndexByte(rest[:i], ':')
+	if j < 0 {
+		return "", "", "", false
+	}
+	return rest[:j], rest[j+1 : i], rest[i+1:], true
+}
+
+// encryptedCommitment returns the commitment in an encrypted value,
+// reporting whether the value is one.
+func encryptedCommitment(value string) ([]byte, bool) {
+	_, encoded, _, ok := splitEncrypted(value)
+	if !ok {
+		return nil, false
+	}
+
+	commitment, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(commitment) != sha256.Size {
+		return nil, false
+	}
+	return commitment, true
+}
+
+// decryptCommitted decrypts a value produced by encryptCommitted and
+// checks it against its commitment. Other values are returned
+// unchanged.
+func decryptCommitted(keys KeyStore, name, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptionPrefix) {
+		return value, nil
+	}
+
+	commitment, ok := encryptedCommitment(value)
+	id, _, encoded, _ := splitEncrypted(value)
+	if !ok {
+		return "", errors.New("auditlog: malformed encrypted value")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := keys.Key(id)
+	if err == ErrKeyDestroyed {
+		return ErasedValue, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("auditlog: malformed encrypted value")
+	}
+
+	nonce := sealed[:aead.NonceSize()]
+	out, err := aead.Open(nil, nonce, sealed[aead.NonceSize():], encryptionAAD(commitment, name))
+	if err != nil {
+		return "", err
+	}
+
+	if len(out) < encryptionSaltSize {
+		return "", errors.New("auditlog: malformed encrypted value")
+	}
+
+	salt, plaintext := out[:encryptionSaltSize], string(out[encryptionSaltSize:])
+	if !bytes.Equal(commit(salt, plaintext), commitment) {
+		return "", errors.New("auditlog: encrypted value doesn't match its commitment")
+	}
+	return plaintext, nil
+}
+
+// Encrypted reports whether an event holds values encrypted under an
+// encryption policy, which must be decrypted with Decrypt to be read.
+func Encrypted(ev *Event) bool {
+	if strings.HasPrefix(ev.Event, encryptionPrefix) {
+		return true
+	}
+
+	for _, attr := range ev.Attributes {
+		if strings.HasPrefix(attr.Value, encryptionPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Decrypt returns a copy of an event recorded under an encryption
+// policy with its event text and attribute values decrypted using
+// keys. Values whose key has been destroyed are replaced with
+// ErasedValue. The copy's signature won't verify; the original event
+// should be verified instead.
+func Decrypt(ev *Event, keys KeyStore) (*Event, error) {
+	plain := copyEvent(ev)
+
+	var err error
+	plain.Event, err = decryptCommitted(keys, "", plain.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range plain.Attributes {
+		attr := &plain.Attributes[i]
+		attr.Value, err = decryptCommitted(keys, attr.Name, attr.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return plain, nil
+}
@@ -0,0 +1,139 @@
+package auditlog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	keys := NewMemoryKeyStore()
+	store := NewMemoryStore()
+	policy := EncryptionPolicy{Keys: keys, KeyName: "audit"}
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithEncryption(policy))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+
+	attrs := []Attribute{
+		{"user", "jqp"},
+		{"ip", "192.0.2.1"},
+	}
+	l.InfoSync("encryption_test", "login", attrs)
+	l.InfoSync("encryption_test", "logout", nil)
+
+	// A value that looks encrypted is encrypted all the same.
+	lookalike := encryptionPrefix + "audit:AAAA:AAAA"
+	l.InfoSync("encryption_test", lookalike, []Attribute{{"user", lookalike}})
+
+	if attrs[0].Value != "jqp" {
+		t.Fatal("caller's attributes were modified")
+	}
+
+	cert, err := l.Certify(0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	forged, err := store.Event(2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if forged.Event == lookalike || forged.Attributes[0].Value == lookalike {
+		t.Fatalf("a value that looks encrypted was recorded as given: %+v", forged)
+	}
+
+	forged, err = Decrypt(forged, keys)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if forged.Event != lookalike || forged.Attributes[0].Value != lookalike {
+		t.Fatalf("unexpected decrypted event %+v", forged)
+	}
+
+	ev, err := store.Event(0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	out, err := json.Marshal(ev)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, plain := range []string{"login", "jqp", "192.0.2.1"} {
+		if strings.Contains(string(out), plain) {
+			t.Fatalf("%q was recorded in the clear", plain)
+		}
+	}
+
+	if ev.Digest != DigestEncrypted || ev.Attributes[0].Name != "user" {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	if !Encrypted(ev) {
+		t.Fatal("event should be reported as encrypted")
+	}
+
+	// The chain verifies without the key, from the store and from a
+	// certification.
+	l, err = NewWithStore(store, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	if _, ok := VerifyCertification(cert, &signer.PublicKey); !ok {
+		t.Fatal("certification didn't verify")
+	}
+
+	plain, err := Decrypt(ev, keys)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if plain.Event != "login" || plain.Attributes[0].Value != "jqp" || plain.Attributes[1].Value != "192.0.2.1" {
+		t.Fatalf("unexpected decrypted event %+v", plain)
+	}
+
+	if Encrypted(plain) {
+		t.Fatal("decrypted event reported as encrypted")
+	}
+
+	// Values can't be moved between attributes, and their
+	// commitments are signed.
+	swapped := copyEvent(ev)
+	swapped.Attributes[0].Value, swapped.Attributes[1].Value = ev.Attributes[1].Value, ev.Attributes[0].Value
+	if _, err = Decrypt(swapped, keys); err == nil {
+		t.Fatal("decrypted a value moved to another attribute")
+	}
+
+	if swapped.Verify(&signer.PublicKey, nil) {
+		t.Fatal("event with swapped values verified")
+	}
+
+	// Destroying the key erases the values.
+	if _, err = keys.Destroy("audit"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	plain, err = Decrypt(ev, keys)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if plain.Event != ErasedValue || plain.Attributes[0].Value != ErasedValue {
+		t.Fatalf("expected erased values, have %+v", plain)
+	}
+
+	// The store must record the digest version.
+	if _, err = NewWithStore(struct{ Store }{NewMemoryStore()}, signer, WithEncryption(policy)); err == nil {
+		t.Fatal("logger started with encryption on a store that can't record digest versions")
+	}
+}
@@ -0,0 +1,70 @@
+package auditlog
+
+import (
+	"os"
+	"strconv"
+)
+
+// Environment variables read by ConfigFromEnv.
+const (
+	EnvDBBackend  = "AUDITLOG_DB_BACKEND"
+	EnvDBName     = "AUDITLOG_DB_NAME"
+	EnvDBUser     = "AUDITLOG_DB_USER"
+	EnvDBPassword = "AUDITLOG_DB_PASSWORD"
+	EnvDBHost     = "AUDITLOG_DB_HOST"
+	EnvDBPort     = "AUDITLOG_DB_PORT"
+	EnvDBSSL      = "AUDITLOG_DB_SSL"
+	EnvKeyFile    = "AUDITLOG_KEY_FILE"
+
+	EnvKeyPassphraseFile = "AUDITLOG_KEY_PASSPHRASE_FILE"
+	EnvKeyHMACFile       = "AUDITLOG_KEY_HMAC_FILE"
+)
+
+// ConfigFromEnv builds a configuration from the AUDITLOG_DB_*
+// environment variables, AUDITLOG_KEY_FILE,
+// AUDITLOG_KEY_PASSPHRASE_FILE, and AUDITLOG_KEY_HMAC_FILE. The
+// AUDITLOG_DB_SSL variable is parsed as a boolean; SSL is enabled if
+// it is unset. If AUDITLOG_DB_BACKEND is "sqlite" or "file",
+// AUDITLOG_DB_NAME is the path to the database or log file.
+func ConfigFromEnv() (*Config, error) {
+	cfg := &Config{
+		DB: DBConnDetails{
+			Backend:  os.Getenv(EnvDBBackend),
+			Name:     os.Getenv(EnvDBName),
+			User:     os.Getenv(EnvDBUser),
+			Password: os.Getenv(EnvDBPassword),
+			Host:     os.Getenv(EnvDBHost),
+			Port:     os.Getenv(EnvDBPort),
+			SSL:      true,
+		},
+		Key: KeyConfig{
+			File:           os.Getenv(EnvKeyFile),
+			PassphraseFile: os.Getenv(EnvKeyPassphraseFile),
+			HMACFile:       os.Getenv(EnvKeyHMACFile),
+		},
+	}
+
+	if ssl := os.Getenv(EnvDBSSL); ssl != "" {
+		var err error
+		cfg.DB.SSL, err = strconv.ParseBool(ssl)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// NewFromEnv builds a logger configured from the environment, as
+// described in ConfigFromEnv.
+func NewFromEnv(opts ...Option) (*Logger, error) {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFromConfig(cfg, opts...)
+}
@@ -1,11 +1,16 @@
 package auditlog
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/asn1"
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -40,6 +45,18 @@ var levelStrings = map[int]string{
 	levelCritical: "CRITICAL",
 }
 
+// levelFromString returns the level named by s, ignoring case, or
+// levelUnknown if s doesn't name a level.
+func levelFromString(s string) int {
+	s = strings.ToUpper(s)
+	for level, name := range levelStrings {
+		if name == s {
+			return level
+		}
+	}
+	return levelUnknown
+}
+
 // An Event captures information about an event.
 type Event struct {
 	// Serial is the event's position in the audit chain.
@@ -74,28 +91,78 @@ type Event struct {
 	// of all the other fields in the event and the previous event
 	// in the chain's signature.
 	Signature []byte
-	wait      chan struct{}
+
+	// Digest is the version of the encoding from which the
+	// event's digest is computed; see DigestVersion.
+	Digest DigestVersion `json:",omitempty"`
+
+	wait chan struct{}
+
+	// err is the error, if any, that kept the event from being
+	// stored in the chain; it is copied to result, if set, before
+	// the waiting caller is released.
+	err    error
+	result *error
+
+	// journalID identifies the event's entry in the write-ahead
+	// journal, if one is in use.
+	journalID uint64
+
+	// sign requests an ECDSA signature on the event when the
+	// logger is in batch-signing mode.
+	sign bool
+
+	// internal is set on events generated by the logger itself,
+	// which alone may be recorded as the internal actor.
+	internal bool
+
+	// encrypted is set once the event's values have been encrypted
+	// under the logger's encryption policy.
+	encrypted bool
+
+	// durability is the durability with which the event is to be
+	// stored.
+	durability Durability
+	// pooled is set on events drawn from the event pool, which are
+	// returned to it once recorded unless retained is set; attrs is
+	// the pooled slice holding their attributes, if any.
+	pooled   bool
+	retained bool
+	attrs    *[]Attribute
 }
 
-// Digest computes the SHA-256 digest of the event.
-func (ev *Event) digest() []byte {
-	h := sha256.New()
-	binary.Write(h, binary.BigEndian, int64(ev.Serial))
-	binary.Write(h, binary.BigEndian, int64(ev.When))
-	binary.Write(h, binary.BigEndian, int64(ev.Received))
-	h.Write([]byte(ev.Level))
-	h.Write([]byte(ev.Actor))
-	h.Write([]byte(ev.Event))
-	for i := range ev.Attributes {
-		h.Write([]byte(ev.Attributes[i].Name))
-		h.Write([]byte(ev.Attributes[i].Value))
-	}
+// maxDigestBuffer is the largest buffer kept for reuse; buffers grown
+// for unusually large events are left to the garbage collector.
+const maxDigestBuffer = 64 << 10
 
-	if len(ev.Signature) != 0 {
-		h.Write(ev.Signature)
+// digestBuffers holds the buffers in which events are encoded to be
+// digested, so that signing and verifying events doesn't allocate.
+var digestBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 512)
+		return &buf
+	},
+}
+
+// digest computes the SHA-256 digest of the encoding of the event
+// given by its digest version, chained to prev, the previous event's
+// signature. The event's own signature isn't covered.
+func (ev *Event) digest(prev []byte) [sha256.Size]byte {
+	bufp := digestBuffers.Get().(*[]byte)
+	buf := (*bufp)[:0]
+
+	if ev.Digest == DigestLegacy {
+		buf = ev.appendLegacy(buf, prev)
+	} else {
+		buf = ev.appendCBOR(buf, prev)
 	}
 
-	return h.Sum(nil)
+	digest := sha256.Sum256(buf)
+	if cap(buf) <= maxDigestBuffer {
+		*bufp = buf
+		digestBuffers.Put(bufp)
+	}
+	return digest
 }
 
 // String returns a string for the event. The timestamp is formatted
@@ -111,11 +178,17 @@ func (ev *Event) String() string {
 }
 
 // Verify checks the signature on the event. The prev argument should be the previous event's signature.
+// An event that is only hash-linked (see Signed) carries no signature,
+// and doesn't verify; it is authenticated by the "batch signed" event
+// that follows it, which VerifyBatch checks. An event tagged by
+// WithHMACChaining is checked with VerifyHMAC.
 func (ev *Event) Verify(signer *ecdsa.PublicKey, prev []byte) bool {
+	if !ev.knownDigest() || !ev.Signed() {
+		return false
+	}
+
 	sig := ev.Signature
-	ev.Signature = prev
-	digest := ev.digest()
-	ev.Signature = sig
+	digest := ev.digest(prev)
 
 	var signature ECDSASignature
 	remaining, err := asn1.Unmarshal(sig, &signature)
@@ -123,7 +196,95 @@ func (ev *Event) Verify(signer *ecdsa.PublicKey, prev []byte) bool {
 		return false
 	}
 
-	return ecdsa.Verify(signer, digest, signature.R, signature.S)
+	return ecdsa.Verify(signer, digest[:], signature.R, signature.S)
+}
+
+// errUnknownDigest is returned when signing an event whose digest
+// version isn't known.
+var errUnknownDigest = errors.New("auditlog: unknown digest version")
+
+// hashLinkSize is the length of a hash link: a zero tag byte followed
+// by a SHA-256 digest. ECDSA signatures are DER-encoded, so they never
+// begin with a zero byte.
+const hashLinkSize = 1 + sha256.Size
+
+// Signed reports whether the event carries a signature, rather than
+// only a hash link to the previous event as events recorded in
+// batch-signing mode do (see WithBatchSigning). An HMAC tag (see
+// WithHMACChaining) authenticates its event as a signature does, and
+// counts as one.
+func (ev *Event) Signed() bool {
+	return len(ev.Signature) != hashLinkSize || ev.Signature[0] != 0
+}
+
+// link chains the event to prev, the previous event's signature or
+// link, by its digest alone.
+func (ev *Event) link(prev []byte) {
+	digest := ev.digest(prev)
+	ev.Signature = append([]byte{0}, digest[:]...)
+}
+
+// linked reports whether the event is hash-linked to prev. The link
+// only shows that the event follows prev; the batch signature that
+// follows it must be checked to authenticate it.
+func (ev *Event) linked(prev []byte) bool {
+	if !ev.knownDigest() || ev.Signed() {
+		return false
+	}
+
+	digest := ev.digest(prev)
+	return bytes.Equal(ev.Signature[1:], digest[:])
+}
+
+// Sign computes the signature on the event, chaining it to prev, the
+// previous event's signature. If rand is nil, the signature is
+// computed deterministically as described in RFC 6979; this is
+// useful for producing reproducible test chains.
+func (ev *Event) Sign(signer *ecdsa.PrivateKey, prev []byte, rand io.Reader) error {
+	return ev.signWith(signer, prev, rand)
+}
+
+// signWith computes the signature on the event as Sign does, with any
+// signer; signers other than an *ecdsa.PrivateKey are passed rand as
+// it is, and need not be deterministic when it is nil.
+func (ev *Event) signWith(signer crypto.Signer, prev []byte, rand io.Reader) error {
+	if !ev.knownDigest() {
+		return errUnknownDigest
+	}
+
+	digest := ev.digest(prev)
+	ev.Signature = nil
+
+	if rand == nil {
+		sig, err := signer.Sign(nil, digest[:], crypto.SHA256)
+		if err != nil {
+			return err
+		}
+		ev.Signature = sig
+		return nil
+	}
+
+	key, ok := signer.(*ecdsa.PrivateKey)
+	if !ok {
+		sig, err := signer.Sign(rand, digest[:], crypto.SHA256)
+		if err != nil {
+			return err
+		}
+		ev.Signature = sig
+		return nil
+	}
+
+	r, s, err := ecdsa.Sign(rand, key, digest[:])
+	if err != nil {
+		return err
+	}
+
+	sig, err := asn1.Marshal(ECDSASignature{R: r, S: s})
+	if err != nil {
+		return err
+	}
+	ev.Signature = sig
+	return nil
 }
 
 // An ErrorEvent is stored in the error log; these are used to record
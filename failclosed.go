@@ -0,0 +1,50 @@
+package auditlog
+
+import "errors"
+
+// ErrNotRunning is returned by the error-returning logging methods
+// when the logger isn't running, and so can't accept the event.
+var ErrNotRunning = errors.New("auditlog: logger is not running")
+
+// logE queues an event, waits for it to be recorded, and returns the
+// error, if any, that kept it from being stored.
+func (l *Logger) logE(level int, actor, event string, attributes []Attribute) error {
+	if ok, err := l.admit(level); !ok {
+		return err
+	}
+
+	var err error
+	wait := make(chan struct{}, 0)
+	l.logDurableEvent(l.now(), level, actor, event, attributes, DurabilityDefault, wait, &err)
+	<-wait
+	return err
+}
+
+// InfoE performs the same function as InfoSync, except that it
+// reports whether the event was signed and stored, so that a caller
+// can fail closed. It returns ErrNotRunning if the logger isn't
+// running; ErrSpooled or ErrBuffered if the event couldn't be stored
+// and was set aside to be recorded later; or the error that kept the
+// event from being signed. An event the logger is configured to leave
+// out, being below the minimum level or sampled away, isn't an error.
+func (l *Logger) InfoE(actor, event string, attributes []Attribute) error {
+	return l.logE(levelInfo, actor, event, attributes)
+}
+
+// WarningE performs the same function as WarningSync, except that it
+// returns an error if the event wasn't stored, as InfoE does.
+func (l *Logger) WarningE(actor, event string, attributes []Attribute) error {
+	return l.logE(levelWarning, actor, event, attributes)
+}
+
+// ErrorE performs the same function as ErrorSync, except that it
+// returns an error if the event wasn't stored, as InfoE does.
+func (l *Logger) ErrorE(actor, event string, attributes []Attribute) error {
+	return l.logE(levelError, actor, event, attributes)
+}
+
+// CriticalE performs the same function as CriticalSync, except that
+// it returns an error if the event wasn't stored, as InfoE does.
+func (l *Logger) CriticalE(actor, event string, attributes []Attribute) error {
+	return l.logE(levelCritical, actor, event, attributes)
+}
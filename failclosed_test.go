@@ -0,0 +1,73 @@
+package auditlog
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFailClosed(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, _ := newTestLogger(t, WithMinLevel("WARNING"))
+
+	if err := l.ErrorE("failclosed_test", "early", nil); err != ErrNotRunning {
+		t.Fatalf("expected ErrNotRunning, have %v", err)
+	}
+
+	l.Start()
+	if err := l.ErrorE("failclosed_test", "stored", nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Events filtered out by the logger's configuration aren't
+	// errors.
+	if err := l.InfoE("failclosed_test", "filtered", nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	if err := l.CriticalE("failclosed_test", "late", nil); err != ErrNotRunning {
+		t.Fatalf("expected ErrNotRunning, have %v", err)
+	}
+
+	// Events set aside to be stored later are reported.
+	store := &lockedFailingStore{MemoryStore: NewMemoryStore()}
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithDegradedMode(DegradedPolicy{
+		MaxEvents: 3,
+		Interval:  time.Hour,
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+
+	store.setFail(true)
+	if err = l.WarningE("failclosed_test", "buffered", nil); err != ErrBuffered {
+		t.Fatalf("expected ErrBuffered, have %v", err)
+	}
+	store.setFail(false)
+	l.Stop()
+
+	spooling := &failingStore{MemoryStore: NewMemoryStore()}
+	l, err = NewWithStore(spooling, signer, WithoutEcho(), WithSpool(SpoolPolicy{
+		Path:     filepath.Join(t.TempDir(), "auditlog.spool"),
+		Key:      make([]byte, 32),
+		Interval: time.Hour,
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	spooling.fail = true
+	if err = l.InfoE("failclosed_test", "spooled", nil); err != ErrSpooled {
+		t.Fatalf("expected ErrSpooled, have %v", err)
+	}
+
+	if err = l.LogDurable(DurabilityFull, "INFO", "failclosed_test", "spooled", nil); err != ErrSpooled {
+		t.Fatalf("expected ErrSpooled, have %v", err)
+	}
+	spooling.fail = false
+}
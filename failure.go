@@ -0,0 +1,176 @@
+package auditlog
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"strconv"
+	"time"
+)
+
+// EventsDiscarded is recorded once events can be stored again after a
+// failure policy has discarded events that couldn't be, noting how
+// many were discarded and the error that caused the first of them.
+const EventsDiscarded = "events discarded"
+
+// DefaultFailureInterval is how often a logger blocked by FailBlock
+// tries to store an event again, if the policy doesn't say.
+const DefaultFailureInterval = time.Second
+
+// A FailureMode selects what the logger does when it can't store an
+// event, and neither degraded mode nor the spool (see WithDegradedMode
+// and WithSpool) can hold it.
+type FailureMode int
+
+const (
+	// FailPanic closes the store and panics, taking the process
+	// down with it. This is the default.
+	FailPanic FailureMode = iota
+
+	// FailBlock fails closed: the logger stops recording events,
+	// trying to store the event again every interval until it can,
+	// so that the queue fills and callers block.
+	FailBlock
+
+	// FailSpill fails open: the event is written to the policy's
+	// spill writer as a line of JSON and left out of the chain, and
+	// the logger goes on.
+	FailSpill
+
+	// FailCallback fails open as FailSpill does, handing the event
+	// to the policy's callback instead.
+	FailCallback
+)
+
+var failureModes = map[string]FailureMode{
+	"":      FailPanic,
+	"panic": FailPanic,
+	"block": FailBlock,
+	"spill": FailSpill,
+}
+
+// A FailurePolicy says what the logger does when it can't store an
+// event. Interval is the retry interval for FailBlock, Spill the
+// writer for FailSpill, which must be given, and Callback the function
+// for FailCallback. Spilled events are written as they are, outside
+// the store, so they aren't encrypted or spooled; Spill should be as
+// well protected as the store.
+//
+// The callback is called with the logger's lock held, so it must not
+// call the logger. The event is on loan, as it is to a store, and is
+// signed and chained as it would have been, but its serial number
+// will be given to the next event recorded.
+type FailurePolicy struct {
+	Mode     FailureMode
+	Interval time.Duration
+	Spill    io.Writer
+	Callback func(ev *Event, err error)
+}
+
+// WithFailurePolicy sets the logger's failure policy.
+func WithFailurePolicy(policy FailurePolicy) Option {
+	return func(l *Logger) {
+		if policy.Interval <= 0 {
+			policy.Interval = DefaultFailureInterval
+		}
+
+		if policy.Mode == FailSpill && policy.Spill == nil {
+			l.setOptErr(errors.New("auditlog: FailSpill requires a spill writer"))
+			return
+		}
+
+		if policy.Mode == FailCallback && policy.Callback == nil {
+			policy.Mode = FailPanic
+		}
+		l.failure = policy
+	}
+}
+
+// Err returns the error that kept the logger from storing its most
+// recent event, or nil if the last event was stored. A logger that
+// fails open, buffers events in degraded mode, or spools them keeps
+// running through a database outage; Err is how its health is
+// checked. It doesn't block while the logger does.
+func (l *Logger) Err() error {
+	l.failLock.Lock()
+	defer l.failLock.Unlock()
+
+	return l.failErr
+}
+
+// setFailure records err as the logger's most recent failure; the
+// caller must hold the logger's lock. Once events can be stored again,
+// the number of events discarded in the meantime is recorded.
+func (l *Logger) setFailure(err error) {
+	if err == nil && !l.failing {
+		return
+	}
+
+	l.failing = err != nil
+	l.failLock.Lock()
+	l.failErr = err
+	l.failLock.Unlock()
+
+	if err != nil || l.discarded == 0 {
+		return
+	}
+
+	discarded, cause := l.discarded, l.discardCause
+	l.discarded, l.discardCause = 0, nil
+	l.record(&Event{
+		When:  l.now(),
+		Level: levelStrings[levelWarning],
+		Actor: internalActor,
+		Event: EventsDiscarded,
+		Attributes: []Attribute{
+			{"events", strconv.FormatUint(discarded, 10)},
+			{"error", cause.Error()},
+		},
+	})
+}
+
+// fail applies the failure policy to events that couldn't be stored
+// because of err; retry tries to store them again. The caller must
+// hold the logger's lock. Under FailBlock, fail returns once retry
+// succeeds, or fails with ErrDuplicateSerial. Otherwise, it returns
+// err, having discarded the events.
+func (l *Logger) fail(events []*Event, err error, retry func() error) error {
+	l.setFailure(err)
+
+	switch l.failure.Mode {
+	case FailBlock:
+		for err != nil && err != ErrDuplicateSerial {
+			time.Sleep(l.failure.Interval)
+			if reopener, ok := l.store.(Reopener); ok {
+				if _, cerr := l.store.Count(); cerr != nil {
+					reopener.Reopen()
+				}
+			}
+
+			if err = retry(); err != nil && err != ErrDuplicateSerial {
+				l.setFailure(err)
+			}
+		}
+		return err
+	case FailSpill, FailCallback:
+		if l.discarded == 0 {
+			l.discardCause = err
+		}
+
+		for _, ev := range events {
+			ev.err = err
+			l.discarded++
+			if l.failure.Mode == FailCallback {
+				l.failure.Callback(ev, err)
+			} else if out, merr := json.Marshal(ev); merr == nil {
+				l.failure.Spill.Write(append(out, '\n'))
+			}
+		}
+		return err
+	default:
+		log.Printf("database error: %v", err)
+		l.store.Close()
+		panic(err.Error())
+	}
+}
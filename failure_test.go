@@ -0,0 +1,127 @@
+package auditlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFailurePolicy(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	// Events are never spilled anywhere the caller didn't choose.
+	_, err := NewWithStore(NewMemoryStore(), signer, WithoutEcho(),
+		WithFailurePolicy(FailurePolicy{Mode: FailSpill}))
+	if err == nil {
+		t.Fatal("expected FailSpill without a spill writer to be rejected")
+	}
+
+	// Spilled events are left out of the chain, which notes how many
+	// were discarded once it can be written again.
+	spill := &bytes.Buffer{}
+	store := &lockedFailingStore{MemoryStore: NewMemoryStore()}
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithFailurePolicy(FailurePolicy{
+		Mode:  FailSpill,
+		Spill: spill,
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+
+	l.InfoSync("failure_test", "stored", nil)
+	store.setFail(true)
+	if err = l.InfoE("failure_test", "spilled", nil); err == nil {
+		t.Fatal("expected the spilled event to be reported")
+	}
+	l.InfoSync("failure_test", "spilled", nil)
+
+	if l.Err() == nil {
+		t.Fatal("logger should report the failure")
+	}
+
+	store.setFail(false)
+	l.InfoSync("failure_test", "recovered", nil)
+	if err = l.Err(); err != nil {
+		t.Fatalf("logger should have recovered, but has error %v", err)
+	}
+	l.Stop()
+
+	dec := json.NewDecoder(spill)
+	for i := 0; i < 2; i++ {
+		var ev Event
+		if err = dec.Decode(&ev); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if ev.Event != "spilled" {
+			t.Fatalf("unexpected spilled event %+v", ev)
+		}
+	}
+
+	ev := findEvent(t, store.MemoryStore, EventsDiscarded)
+	if events, _ := ev.attr("events"); events != "2" {
+		t.Fatalf("expected 2 discarded events, have %v", ev.Attributes)
+	}
+
+	// The chain still verifies.
+	if _, err = NewWithStore(store, signer, WithoutEcho()); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// The callback is handed each event.
+	var failed []string
+	store = &lockedFailingStore{MemoryStore: NewMemoryStore(), fail: true}
+	l, err = NewWithStore(store, signer, WithoutEcho(), WithFailurePolicy(FailurePolicy{
+		Mode:     FailCallback,
+		Callback: func(ev *Event, err error) { failed = append(failed, ev.Event) },
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	l.ErrorSync("failure_test", "failed", nil)
+	l.Stop()
+
+	if len(failed) != 1 || failed[0] != "failed" {
+		t.Fatalf("unexpected events handed to the callback: %v", failed)
+	}
+
+	// Blocking holds the caller until the event is stored.
+	store = &lockedFailingStore{MemoryStore: NewMemoryStore()}
+	l, err = NewWithStore(store, signer, WithoutEcho(), WithFailurePolicy(FailurePolicy{
+		Mode:     FailBlock,
+		Interval: time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	store.setFail(true)
+	done := make(chan error)
+	go func() {
+		done <- l.InfoE("failure_test", "blocked", nil)
+	}()
+
+	for l.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case err = <-done:
+		t.Fatalf("caller wasn't blocked: %v", err)
+	default:
+	}
+
+	store.setFail(false)
+	if err = <-done; err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if l.Err() != nil {
+		t.Fatalf("logger should have recovered, but has error %v", l.Err())
+	}
+}
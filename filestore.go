@@ -0,0 +1,731 @@
+package auditlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+)
+
+// A log file, as written by the file store, begins with logMagic and
+// holds a record for each event: a four-byte big-endian length, the
+// CRC-32C of the body, and the body, which is the JSON encoding of
+// the signed event. Records are only ever appended. The index file
+// alongside it holds the eight-byte big-endian offset of each event's
+// record, by serial number, and error events are kept in a third file
+// of records in the same format.
+const logMagic = "AUDITLOG\x00\x01\x00\x00"
+
+// maxRecordSize bounds the records read from a log file, so that a
+// corrupt length can't exhaust memory.
+const maxRecordSize = 64 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errCorruptLog is returned when a log file's records don't check out.
+var errCorruptLog = errors.New("auditlog: log file is corrupt")
+
+// A fileStore keeps the audit chain in an append-only log file, for
+// appliances that can't run a database server. The index makes
+// reading any event a single seek; the log can be verified on its own
+// by streaming it through VerifyLogFile.
+type fileStore struct {
+	lock sync.Mutex
+	path string
+
+	log          *os.File
+	index        *os.File
+	errors       *os.File
+	keys         *os.File
+	checkpoints  *os.File
+	cosignatures *os.File
+
+	// count is the number of events in the log, and end the offset
+	// at which the next record is written.
+	count uint64
+	end   int64
+}
+
+// NewFileStore opens the log file at path, creating it if it doesn't
+// exist, along with its index (path.idx), error log (path.errors), key
+// history (path.keys), signed checkpoints (path.checkpoints), and
+// witnesses' cosignatures of them (path.cosignatures).
+// A record left incomplete by a crash is discarded, and any events
+// missing from the index are indexed again.
+func NewFileStore(path string) (Store, error) {
+	s := &fileStore{path: path}
+	if err := s.Reopen(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Reopen opens the files and recovers the log's state.
+func (s *fileStore) Reopen() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var err error
+	s.log, err = openLogFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.errors, err = openLogFile(s.path + ".errors")
+	if err == nil {
+		s.keys, err = openLogFile(s.path + ".keys")
+	}
+	if err == nil {
+		s.checkpoints, err = openLogFile(s.path + ".checkpoints")
+	}
+	if err == nil {
+		s.cosignatures, err = openLogFile(s.path + ".cosignatures")
+	}
+	if err == nil {
+		s.index, err = os.OpenFile(s.path+".idx", os.O_RDWR|os.O_CREATE, 0600)
+	}
+	if err == nil {
+		err = s.recover()
+	}
+	if err != nil {
+		s.closeFiles()
+		return err
+	}
+	return nil
+}
+
+// openLogFile opens a log file, writing its header if it is new.
+func openLogFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if fi.Size() == 0 {
+		_, err = f.Write([]byte(logMagic))
+		if err == nil {
+			err = f.Sync()
+		}
+	} else {
+		header := make([]byte, len(logMagic))
+		_, err = f.ReadAt(header, 0)
+		if err == nil && string(header) != logMagic {
+			err = fmt.Errorf("auditlog: %s is not an audit log file", path)
+		}
+	}
+
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// recover finds the end of the log, checks the index against it, and
+// indexes any events written after the index was last updated. The
+// caller must hold the lock.
+func (s *fileStore) recover() error {
+	fi, err := s.index.Stat()
+	if err != nil {
+		return err
+	}
+
+	// A partial entry at the end of the index is dropped, and
+	// written again below.
+	s.count = uint64(fi.Size() / 8)
+	offset := int64(len(logMagic))
+	if s.count > 0 {
+		last, err := s.offset(s.count - 1)
+		if err != nil {
+			return err
+		}
+
+		ev, size, err := readRecord(s.log, last)
+		if err != nil || ev.Serial != s.count-1 {
+			// The index doesn't match the log, so it is built
+			// again from the start.
+			s.count = 0
+		} else {
+			offset = last + size
+		}
+	}
+
+	if err = s.index.Truncate(int64(s.count) * 8); err != nil {
+		return err
+	}
+
+	logInfo, err := s.log.Stat()
+	if err != nil {
+		return err
+	}
+
+	for offset < logInfo.Size() {
+		ev, size, err := readRecord(s.log, offset)
+		if err == io.ErrUnexpectedEOF {
+			// The last record was never completely written;
+			// nothing after it can have been acknowledged.
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if ev.Serial != s.count {
+			return fmt.Errorf("%w: event %d found where event %d was expected", errCorruptLog, ev.Serial, s.count)
+		}
+
+		if err = s.indexEvent(offset); err != nil {
+			return err
+		}
+		offset += size
+	}
+
+	s.end = offset
+	return s.log.Truncate(s.end)
+}
+
+// offset returns the offset of an event's record in the log; the
+// caller must hold the lock.
+func (s *fileStore) offset(serial uint64) (int64, error) {
+	var entry [8]byte
+	if _, err := s.index.ReadAt(entry[:], int64(serial)*8); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(entry[:])), nil
+}
+
+// indexEvent records the offset of the next event's record; the
+// caller must hold the lock.
+func (s *fileStore) indexEvent(offset int64) error {
+	var entry [8]byte
+	binary.BigEndian.PutUint64(entry[:], uint64(offset))
+	if _, err := s.index.WriteAt(entry[:], int64(s.count)*8); err != nil {
+		return err
+	}
+	s.count++
+	return nil
+}
+
+// appendRecord appends the record holding v to buf.
+func appendRecord(buf *bytes.Buffer, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(body)))
+	binary.BigEndian.PutUint32(header[4:], crc32.Checksum(body, crcTable))
+	buf.Write(header[:])
+	buf.Write(body)
+	return nil
+}
+
+// readRecord reads the event whose record is at offset, returning it
+// along with the size of the record. It returns io.ErrUnexpectedEOF if
+// the record runs past the end of the file.
+func readRecord(r io.ReaderAt, offset int64) (*Event, int64, error) {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], offset); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+
+	n := binary.BigEndian.Uint32(header[:4])
+	if n > maxRecordSize {
+		return nil, 0, fmt.Errorf("%w: record at offset %d is too long", errCorruptLog, offset)
+	}
+
+	body := make([]byte, n)
+	if _, err := r.ReadAt(body, offset+8); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+
+	ev, err := decodeRecord(header[4:], body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w at offset %d", err, offset)
+	}
+	return ev, 8 + int64(n), nil
+}
+
+// decodeRecord checks a record's body against its checksum, and
+// decodes the event it holds.
+func decodeRecord(sum, body []byte) (*Event, error) {
+	if crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(sum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", errCorruptLog)
+	}
+
+	var ev Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return nil, fmt.Errorf("%w: %v", errCorruptLog, err)
+	}
+	return &ev, nil
+}
+
+// RecordsDigests reports that log files record digest versions.
+func (s *fileStore) RecordsDigests() bool {
+	return true
+}
+
+// StoreEvent appends a signed event to the log.
+func (s *fileStore) StoreEvent(ev *Event) error {
+	return s.StoreEvents([]*Event{ev})
+}
+
+// StoreEvents appends a run of signed events to the log in a single
+// write, which is synced to disk unless every event was recorded with
+// DurabilityAsync. The index is updated afterwards; if it is lost, it
+// is rebuilt from the log.
+func (s *fileStore) StoreEvents(events []*Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var buf bytes.Buffer
+	offsets := make([]int64, len(events))
+	sync := false
+	for i, ev := range events {
+		switch next := s.count + uint64(i); {
+		case ev.Serial < next:
+			return ErrDuplicateSerial
+		case ev.Serial > next:
+			return ErrNoEvent
+		}
+
+		offsets[i] = s.end + int64(buf.Len())
+		if err := appendRecord(&buf, ev); err != nil {
+			return err
+		}
+		sync = sync || ev.durability != DurabilityAsync
+	}
+
+	if _, err := s.log.WriteAt(buf.Bytes(), s.end); err != nil {
+		// Whatever part of the write landed is cut off again.
+		s.log.Truncate(s.end)
+		return err
+	}
+
+	if sync {
+		if err := s.log.Sync(); err != nil {
+			s.log.Truncate(s.end)
+			return err
+		}
+	}
+
+	s.end += int64(buf.Len())
+	for _, offset := range offsets {
+		if err := s.indexEvent(offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreError appends an error event to the error log.
+func (s *fileStore) StoreError(ev *ErrorEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	fi, err := s.errors.Stat()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = appendRecord(&buf, ev); err != nil {
+		return err
+	}
+
+	if _, err = s.errors.WriteAt(buf.Bytes(), fi.Size()); err != nil {
+		return err
+	}
+	return s.errors.Sync()
+}
+
+// Count returns the number of events in the log.
+func (s *fileStore) Count() (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.count, nil
+}
+
+// Event reads the event with the given serial number.
+func (s *fileStore) Event(serial uint64) (*Event, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if serial >= s.count {
+		return nil, ErrNoEvent
+	}
+
+	offset, err := s.offset(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	ev, _, err := readRecord(s.log, offset)
+	return ev, err
+}
+
+// Events reads the events whose serial numbers fall in the range
+// [start, end], streaming them from the first one's record.
+func (s *fileStore) Events(start, end uint64) ([]*Event, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if end >= s.count {
+		end = s.count - 1
+	}
+	if s.count == 0 || start > end {
+		return nil, nil
+	}
+
+	offset, err := s.offset(start)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*Event
+	for serial := start; serial <= end; serial++ {
+		ev, size, err := readRecord(s.log, offset)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+		offset += size
+	}
+	return events, nil
+}
+
+// Errors reads the error events whose serial numbers fall in the
+// range [start, end]. The error log isn't indexed; error events are
+// rare enough for it to be read in full.
+func (s *fileStore) Errors(start, end uint64) ([]*ErrorEvent, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	fi, err := s.errors.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []*ErrorEvent
+	r := bufio.NewReader(io.NewSectionReader(s.errors, int64(len(logMagic)), fi.Size()-int64(len(logMagic))))
+	for {
+		body, sum, err := nextRecord(r)
+		if err == io.EOF {
+			return errs, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if crc32.Checksum(body, crcTable) != sum {
+			return nil, fmt.Errorf("%w: checksum mismatch in error log", errCorruptLog)
+		}
+
+		var errEv ErrorEvent
+		if err = json.Unmarshal(body, &errEv); err != nil {
+			return nil, fmt.Errorf("%w: %v", errCorruptLog, err)
+		}
+
+		if errEv.Event != nil && errEv.Event.Serial >= start && errEv.Event.Serial <= end {
+			errs = append(errs, &errEv)
+		}
+	}
+}
+
+// StoreKey appends a key to the key history, unless a key has already
+// been recorded for its first serial number.
+func (s *fileStore) StoreKey(rec KeyRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	recs, err := s.readKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, kr := range recs {
+		if kr.First == rec.First {
+			return nil
+		}
+	}
+	return appendSideRecord(s.keys, rec)
+}
+
+// Keys reads the key history, which is kept in order of first serial
+// number, as keys are only ever added after the last.
+func (s *fileStore) Keys() ([]KeyRecord, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.readKeys()
+}
+
+// readKeys reads the key history in full; the caller must hold the
+// lock.
+func (s *fileStore) readKeys() ([]KeyRecord, error) {
+	var recs []KeyRecord
+	err := readSideRecords(s.keys, "key history", func(body []byte) error {
+		var rec KeyRecord
+		if err := json.Unmarshal(body, &rec); err != nil {
+			return err
+		}
+		recs = append(recs, rec)
+		return nil
+	})
+	return recs, err
+}
+
+// StoreCheckpoint appends a signed checkpoint to the checkpoint file if
+// it is later than the latest one.
+func (s *fileStore) StoreCheckpoint(sc SignedCheckpoint) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	latest, err := s.latestCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	if latest != nil && sc.Serial <= latest.Serial {
+		return nil
+	}
+	return appendSideRecord(s.checkpoints, sc)
+}
+
+// LatestCheckpoint returns the last checkpoint in the checkpoint file.
+func (s *fileStore) LatestCheckpoint() (*SignedCheckpoint, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.latestCheckpoint()
+}
+
+// latestCheckpoint reads the checkpoint file, returning the last
+// checkpoint; the caller must hold the lock.
+func (s *fileStore) latestCheckpoint() (*SignedCheckpoint, error) {
+	var latest *SignedCheckpoint
+	err := readSideRecords(s.checkpoints, "checkpoints", func(body []byte) error {
+		latest = &SignedCheckpoint{}
+		return json.Unmarshal(body, latest)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// StoreCosignature appends a witness's cosignature of a checkpoint to
+// the cosignature file, unless the witness has already cosigned it.
+func (s *fileStore) StoreCosignature(cs Cosignature) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	have, err := s.readCosignatures(cs.Serial)
+	if err != nil {
+		return err
+	}
+
+	for _, other := range have {
+		if other.Witness == cs.Witness {
+			return nil
+		}
+	}
+	return appendSideRecord(s.cosignatures, cs)
+}
+
+// Cosignatures reads the cosignatures of the checkpoint of the given
+// event from the cosignature file.
+func (s *fileStore) Cosignatures(serial uint64) ([]Cosignature, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.readCosignatures(serial)
+}
+
+// readCosignatures reads the cosignatures of the checkpoint of the
+// given event; the caller must hold the lock.
+func (s *fileStore) readCosignatures(serial uint64) ([]Cosignature, error) {
+	var sigs []Cosignature
+	err := readSideRecords(s.cosignatures, "cosignatures", func(body []byte) error {
+		var cs Cosignature
+		if err := json.Unmarshal(body, &cs); err != nil {
+			return err
+		}
+
+		if cs.Serial == serial {
+			sigs = append(sigs, cs)
+		}
+		return nil
+	})
+	return sigs, err
+}
+
+// appendSideRecord appends a record to one of the files kept alongside
+// the log, such as the key history, and syncs it.
+func appendSideRecord(f *os.File, v interface{}) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = appendRecord(&buf, v); err != nil {
+		return err
+	}
+
+	if _, err = f.WriteAt(buf.Bytes(), fi.Size()); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// readSideRecords reads each record in one of the files kept alongside
+// the log, passing its body to decode; what names the file in errors.
+func readSideRecords(f *os.File, what string, decode func(body []byte) error) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, int64(len(logMagic)), fi.Size()-int64(len(logMagic))))
+	for {
+		body, sum, err := nextRecord(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if crc32.Checksum(body, crcTable) != sum {
+			return fmt.Errorf("%w: checksum mismatch in %s", errCorruptLog, what)
+		}
+
+		if err = decode(body); err != nil {
+			return fmt.Errorf("%w: %v", errCorruptLog, err)
+		}
+	}
+}
+
+// nextRecord reads the next record from a stream, returning its body
+// and checksum. It returns io.EOF at the end of the stream, and
+// io.ErrUnexpectedEOF if the stream ends partway through a record.
+func nextRecord(r io.Reader) ([]byte, uint32, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, 0, err
+	}
+
+	n := binary.BigEndian.Uint32(header[:4])
+	if n > maxRecordSize {
+		return nil, 0, fmt.Errorf("%w: record is too long", errCorruptLog)
+	}
+
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	return body, binary.BigEndian.Uint32(header[4:]), nil
+}
+
+func (s *fileStore) closeFiles() error {
+	var err error
+	for _, f := range []*os.File{s.log, s.index, s.errors, s.keys, s.checkpoints, s.cosignatures} {
+		if f == nil {
+			continue
+		}
+
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.log, s.index, s.errors, s.keys, s.checkpoints, s.cosignatures = nil, nil, nil, nil, nil, nil
+	return err
+}
+
+// Close syncs the index and closes the files.
+func (s *fileStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.index != nil {
+		s.index.Sync()
+	}
+	return s.closeFiles()
+}
+
+// VerifyLogFile verifies the chain in a log file written by the file
+// store, streaming it from r so that neither the index nor the whole
+// chain needs to be held: each event must follow the one before it,
+// and verify with pub. As with VerifyCertification, the chain must end
+// with a signed event. It returns the number of events verified; a
+// record cut short at the end of the file, as a crash can leave, is
+// ignored, as the file store discards it when it is next opened. Of
+// the options, only VerifyKeys applies.
+func VerifyLogFile(r io.Reader, pub *ecdsa.PublicKey, opts ...VerifyOption) (uint64, error) {
+	var vc verifyConfig
+	for _, opt := range opts {
+		opt(&vc)
+	}
+	keys := vc.manifest(pub)
+
+	br := bufio.NewReader(r)
+	header := make([]byte, len(logMagic))
+	if _, err := io.ReadFull(br, header); err != nil || string(header) != logMagic {
+		return 0, errors.New("auditlog: not an audit log file")
+	}
+
+	var count uint64
+	var prev []byte
+	seals := newSealCheck(0)
+	for {
+		body, sum, err := nextRecord(br)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return count, err
+		}
+
+		ev, err := decodeRecord(binary.BigEndian.AppendUint32(nil, sum), body)
+		if err != nil {
+			return count, err
+		}
+
+		if ev.Serial != count {
+			return count, fmt.Errorf("%w: event %d found where event %d was expected", ErrNoEvent, ev.Serial, count)
+		}
+
+		if !keys.verify(ev, prev) || !seals.add(ev) {
+			return count, fmt.Errorf("%w: event %d", errAuditFailure, ev.Serial)
+		}
+
+		prev = ev.Signature
+		count++
+	}
+
+	if seals.open() {
+		return count, fmt.Errorf("%w: the chain doesn't end with a signed event", errAuditFailure)
+	}
+	return count, nil
+}
@@ -0,0 +1,169 @@
+package auditlog
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	cd := &DBConnDetails{Backend: "file", Name: path}
+
+	l, err := New(cd, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	for i := 0; i < 10; i++ {
+		l.Info("file_test", "event", []Attribute{{"user", "root"}, {"host", "db1"}})
+	}
+	l.InfoSync("file_test", "event", nil)
+	l.Stop()
+
+	// Losing the index, or finding a record cut short by a crash,
+	// doesn't lose the events that were acknowledged.
+	if err = os.Remove(path + ".idx"); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	f.Close()
+
+	l, err = New(cd, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	l.InfoSync("file_test", "reopened", nil)
+
+	if err = l.verifyAuditChain(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ev, err := l.store.Event(0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(ev.Attributes) != 2 || ev.Attributes[1] != (Attribute{"host", "db1"}) {
+		t.Fatalf("attributes weren't restored: %v", ev.Attributes)
+	}
+
+	if _, err = l.store.Event(l.counter); err != ErrNoEvent {
+		t.Fatalf("expected ErrNoEvent, have %v", err)
+	}
+
+	if err = l.store.StoreEvent(ev); err != ErrDuplicateSerial {
+		t.Fatalf("expected ErrDuplicateSerial, have %v", err)
+	}
+
+	errEv := &ErrorEvent{When: l.now(), Message: "test", Event: &Event{
+		Serial: l.counter,
+		Level:  "ERROR",
+		Actor:  "file_test",
+		Event:  "failure",
+	}}
+	if err = l.store.StoreError(errEv); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	errs, err := l.store.Errors(0, l.counter)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(errs) != 1 || errs[0].Message != "test" {
+		t.Fatalf("expected the stored error event, have %v", errs)
+	}
+	count := l.Count()
+	l.Stop()
+
+	f, err = os.Open(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer f.Close()
+
+	n, err := VerifyLogFile(f, &signer.PublicKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if n != count {
+		t.Fatalf("expected %d events to be verified, have %d", count, n)
+	}
+}
+
+func TestVerifyLogFileTampered(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	l, err := NewWithStore(store, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	l.InfoSync("file_test", "event", []Attribute{{"user", "root"}})
+	l.Stop()
+
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Rewriting an attribute, and fixing up the record's checksum,
+	// still breaks the chain's signatures.
+	ev, size, err := readRecord(bytes.NewReader(log), int64(len(logMagic)))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ev.Attributes = []Attribute{{"user", "rOOt"}}
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	if err = appendRecord(&buf, ev); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if int64(buf.Len()) != size {
+		t.Fatalf("expected the rewritten record to be %d bytes, have %d", size, buf.Len())
+	}
+	f.WriteAt(buf.Bytes(), int64(len(logMagic)))
+
+	r, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer r.Close()
+
+	if _, err = VerifyLogFile(r, &signer.PublicKey); !errors.Is(err, errAuditFailure) {
+		t.Fatalf("expected an audit failure, have %v", err)
+	}
+
+	// Flipping a byte without fixing the checksum is caught before
+	// the signature is checked.
+	f.WriteAt([]byte{'X'}, int64(len(logMagic))+int64(size)-2)
+	r.Seek(0, 0)
+	if _, err = VerifyLogFile(r, &signer.PublicKey); !errors.Is(err, errCorruptLog) {
+		t.Fatalf("expected a corrupt log, have %v", err)
+	}
+}
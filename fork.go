@@ -0,0 +1,131 @@
+package auditlog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+)
+
+// A Fork describes the point at which two chains signed by the same
+// key diverge. Two chains that both verify but differ mean the key
+// has signed two histories; typically a copy of the chain, such as
+// one restored from a backup, has been used to record events that
+// never happened in the original.
+type Fork struct {
+	// Serial is the serial number of the first event at which the
+	// chains differ, and A and B are the two versions of it.
+	Serial uint64
+	A, B   *Event
+}
+
+// FindFork compares two chains event by event, aligned by serial
+// number, and returns the first point at which they diverge. Only
+// the serial numbers present in both chains are compared, so nil is
+// returned if one chain is a prefix of the other.
+func FindFork(a, b []*Event) *Fork {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i].Serial < b[j].Serial:
+			i++
+		case a[i].Serial > b[j].Serial:
+			j++
+		default:
+			if !bytes.Equal(a[i].Signature, b[j].Signature) {
+				return &Fork{Serial: a[i].Serial, A: a[i], B: b[j]}
+			}
+			i++
+			j++
+		}
+	}
+	return nil
+}
+
+// forkBatch is the number of events compared at a time by
+// CompareStores.
+const forkBatch = 1024
+
+// storeStart returns the serial number of the first event held by
+// a store.
+func storeStart(s Store) (uint64, error) {
+	pruner, ok := s.(Pruner)
+	if !ok {
+		return 0, nil
+	}
+
+	end, _, ok, err := pruner.Pruned()
+	if err != nil || !ok {
+		return 0, err
+	}
+	return end + 1, nil
+}
+
+// CompareStores compares the chains held in two stores, as FindFork
+// does. The events aren't verified; callers comparing untrusted
+// stores should verify each chain first.
+func CompareStores(a, b Store) (*Fork, error) {
+	start, err := storeStart(a)
+	if err != nil {
+		return nil, err
+	}
+
+	startB, err := storeStart(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if startB > start {
+		start = startB
+	}
+
+	end, err := a.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	endB, err := b.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	if endB < end {
+		end = endB
+	}
+
+	for ; start < end; start += forkBatch {
+		last := start + forkBatch - 1
+		if last >= end {
+			last = end - 1
+		}
+
+		ea, err := a.Events(start, last)
+		if err != nil {
+			return nil, err
+		}
+
+		eb, err := b.Events(start, last)
+		if err != nil {
+			return nil, err
+		}
+
+		if fork := FindFork(ea, eb); fork != nil {
+			return fork, nil
+		}
+	}
+	return nil, nil
+}
+
+// CompareCertifications verifies two certifications against the
+// signer's public key and compares their chains, as FindFork does.
+func CompareCertifications(a, b []byte, signer *ecdsa.PublicKey) (*Fork, error) {
+	ca, ok := VerifyCertification(a, signer)
+	if !ok {
+		return nil, errors.New("auditlog: first certification failed to verify")
+	}
+
+	cb, ok := VerifyCertification(b, signer)
+	if !ok {
+		return nil, errors.New("auditlog: second certification failed to verify")
+	}
+	return FindFork(ca.Chain, cb.Chain), nil
+}
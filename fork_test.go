@@ -0,0 +1,62 @@
+package auditlog
+
+import "testing"
+
+func TestCompareStores(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	original := NewMemoryStore()
+	l, err := NewWithStore(original, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+
+	for i := 0; i < 5; i++ {
+		l.InfoSync("fork_test", "tick", nil)
+	}
+	l.Stop()
+
+	// Clone the chain, as if restoring a backup, and record
+	// different events in each copy.
+	clone := NewMemoryStore()
+	events, err := original.Events(0, 4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, ev := range events {
+		clone.StoreEvent(ev)
+	}
+
+	fork, err := CompareStores(original, clone)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if fork != nil {
+		t.Fatalf("identical chains forked at %d", fork.Serial)
+	}
+
+	l.Start()
+	l.InfoSync("fork_test", "genuine", nil)
+	l.InfoSync("fork_test", "genuine", nil)
+	l.Stop()
+
+	forger, err := NewWithStore(clone, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	forger.Start()
+	forger.InfoSync("fork_test", "forged", nil)
+	forger.Stop()
+
+	fork, err = CompareStores(original, clone)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if fork == nil || fork.Serial != 5 || fork.B.Event != "forged" {
+		t.Fatalf("expected a fork at event 5, have %+v", fork)
+	}
+}
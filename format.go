@@ -0,0 +1,155 @@
+package auditlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Formatter renders an event as a single line of text for echoing.
+// The returned line should not include a trailing newline, and the
+// event must not be kept once Format returns.
+type Formatter interface {
+	Format(ev *Event) string
+}
+
+// The built-in formatters.
+var (
+	// PlainFormatter uses the event's String method; this is the
+	// default.
+	PlainFormatter Formatter = plainFormatter{}
+
+	// LogfmtFormatter renders events as logfmt key=value pairs.
+	LogfmtFormatter Formatter = logfmtFormatter{}
+
+	// JSONFormatter renders each event as a JSON object.
+	JSONFormatter Formatter = jsonFormatter{}
+
+	// ConsoleFormatter renders events like PlainFormatter, with
+	// the level colored using ANSI escape codes.
+	ConsoleFormatter Formatter = consoleFormatter{}
+
+	// CEFFormatter renders events in ArcSight's Common Event
+	// Format, for ingestion by a SIEM; see CEFExporter.
+	CEFFormatter Formatter = CEFExporter{}
+
+	// OCSFFormatter renders events as OCSF events in JSON, for
+	// security data lakes; see OCSFExporter.
+	OCSFFormatter Formatter = OCSFExporter{}
+)
+
+// FormatterByName returns the built-in formatter with the given name:
+// "plain", "logfmt", "json", "console", "cef", or "ocsf".
+func FormatterByName(name string) (Formatter, error) {
+	switch name {
+	case "", "plain":
+		return PlainFormatter, nil
+	case "logfmt":
+		return LogfmtFormatter, nil
+	case "json":
+		return JSONFormatter, nil
+	case "console":
+		return ConsoleFormatter, nil
+	case "cef":
+		return CEFFormatter, nil
+	case "ocsf":
+		return OCSFFormatter, nil
+	default:
+		return nil, fmt.Errorf("auditlog: unknown format %q", name)
+	}
+}
+
+// WithFormatter sets the formatter used to echo events.
+func WithFormatter(f Formatter) Option {
+	return func(l *Logger) {
+		l.formatter = f
+	}
+}
+
+type plainFormatter struct{}
+
+func (plainFormatter) Format(ev *Event) string {
+	return ev.String()
+}
+
+type logfmtFormatter struct{}
+
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (logfmtFormatter) Format(ev *Event) string {
+	fields := []string{
+		"time=" + time.Unix(0, ev.When).UTC().Format(time.RFC3339Nano),
+		"serial=" + strconv.FormatUint(ev.Serial, 10),
+		"level=" + logfmtValue(ev.Level),
+		"actor=" + logfmtValue(ev.Actor),
+		"event=" + logfmtValue(ev.Event),
+	}
+
+	for _, attr := range ev.Attributes {
+		fields = append(fields, logfmtValue(attr.Name)+"="+logfmtValue(attr.Value))
+	}
+	return strings.Join(fields, " ")
+}
+
+type jsonFormatter struct{}
+
+type jsonEvent struct {
+	Time       string            `json:"time"`
+	Serial     uint64            `json:"serial"`
+	Level      string            `json:"level"`
+	Actor      string            `json:"actor"`
+	Event      string            `json:"event"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+func (jsonFormatter) Format(ev *Event) string {
+	je := jsonEvent{
+		Time:   time.Unix(0, ev.When).UTC().Format(time.RFC3339Nano),
+		Serial: ev.Serial,
+		Level:  ev.Level,
+		Actor:  ev.Actor,
+		Event:  ev.Event,
+	}
+
+	if len(ev.Attributes) > 0 {
+		je.Attributes = map[string]string{}
+		for _, attr := range ev.Attributes {
+			je.Attributes[attr.Name] = attr.Value
+		}
+	}
+
+	// A struct of strings and maps of strings always marshals.
+	out, _ := json.Marshal(je)
+	return string(out)
+}
+
+type consoleFormatter struct{}
+
+var levelColors = map[string]string{
+	"DEBUG":    "\x1b[90m",
+	"INFO":     "\x1b[32m",
+	"WARNING":  "\x1b[33m",
+	"ERROR":    "\x1b[31m",
+	"CRITICAL": "\x1b[1;31m",
+}
+
+func (consoleFormatter) Format(ev *Event) string {
+	level := ev.Level
+	if color, ok := levelColors[level]; ok {
+		level = color + level + "\x1b[0m"
+	}
+
+	s := fmt.Sprintf("%s [%s] %s:%s", time.Unix(0, ev.When).Format(time.RFC3339),
+		level, ev.Actor, ev.Event)
+	for _, attr := range ev.Attributes {
+		s += " " + attr.Name + "=" + attr.Value
+	}
+	return s
+}
@@ -0,0 +1,44 @@
+package auditlog
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatters(t *testing.T) {
+	ev := &Event{
+		Serial: 7,
+		When:   time.Date(2014, time.October, 6, 12, 0, 0, 0, time.UTC).UnixNano(),
+		Level:  "WARNING",
+		Actor:  "auth",
+		Event:  "login failure",
+		Attributes: []Attribute{
+			{"user", "jqp"},
+			{"reason", `bad "password"`},
+		},
+	}
+
+	expected := `time=2014-10-06T12:00:00Z serial=7 level=WARNING actor=auth event="login failure" user=jqp reason="bad \"password\""`
+	if line := LogfmtFormatter.Format(ev); line != expected {
+		t.Fatalf("expected %s, have %s", expected, line)
+	}
+
+	expected = `{"time":"2014-10-06T12:00:00Z","serial":7,"level":"WARNING","actor":"auth","event":"login failure","attributes":{"reason":"bad \"password\"","user":"jqp"}}`
+	if line := JSONFormatter.Format(ev); line != expected {
+		t.Fatalf("expected %s, have %s", expected, line)
+	}
+
+	if line := ConsoleFormatter.Format(ev); !strings.Contains(line, "\x1b[33mWARNING\x1b[0m") {
+		t.Fatalf("expected a colored level, have %q", line)
+	}
+
+	expected = `CEF:0|auditlog|auditlog|1|login failure|login failure|6|externalId=7 rt=1412596800000 dproc=auth cs1Label=user cs1=jqp cs2Label=reason cs2=bad "password" msg=user\=jqp reason\=bad "password"`
+	if line := CEFFormatter.Format(ev); line != expected {
+		t.Fatalf("expected %s, have %s", expected, line)
+	}
+
+	if _, err := FormatterByName("xml"); err == nil {
+		t.Fatal("expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,70 @@
+package auditlog_test
+
+import (
+	"crypto/ecdsa"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/kisom/auditlog"
+	"github.com/kisom/auditlog/auditlogtest"
+)
+
+// The fuzz targets in this file cover the functions that consume
+// untrusted input: certifications handed to verifiers and the
+// signatures carried in events. Run one with, e.g.,
+//
+//	go test -run '^$' -fuzz FuzzVerifyCertification
+//
+// Parsers for imported chains should add their own targets here.
+
+var goldenDir = filepath.Join("auditlogtest", "testdata")
+
+func goldenSigner(f *testing.F) *ecdsa.PrivateKey {
+	signer, err := auditlog.LoadSigner(filepath.Join(goldenDir, "golden_signer.pem"))
+	if err != nil {
+		f.Fatalf("%v", err)
+	}
+	return signer
+}
+
+func FuzzVerifyCertification(f *testing.F) {
+	signer := goldenSigner(f)
+
+	cert, err := ioutil.ReadFile(filepath.Join(goldenDir, "certified.json"))
+	if err != nil {
+		f.Fatalf("%v", err)
+	}
+
+	f.Add(cert)
+	f.Add([]byte(`{"when":0,"chain":[],"errors":[]}`))
+	f.Add([]byte(`{"chain":[{"Serial":0,"Signature":"MAYCAQECAQE="}]}`))
+	f.Add([]byte(`{"chain":[null]}`))
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		cl, ok := auditlog.VerifyCertification(in, &signer.PublicKey)
+		if ok && cl == nil {
+			t.Fatal("verified certification is nil")
+		}
+	})
+}
+
+func FuzzEventVerify(f *testing.F) {
+	signer := goldenSigner(f)
+	chain, err := auditlogtest.GoldenChain(signer, 2)
+	if err != nil {
+		f.Fatalf("%v", err)
+	}
+
+	f.Add(chain[1].Signature, chain[0].Signature)
+	f.Add([]byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x01}, []byte(nil))
+	f.Add([]byte{0x30, 0x80}, []byte{})
+
+	f.Fuzz(func(t *testing.T, sig, prev []byte) {
+		ev := *chain[1]
+		ev.Signature = sig
+		if ev.Verify(&signer.PublicKey, prev) && string(sig) != string(chain[1].Signature) {
+			t.Fatal("forged signature verified")
+		}
+	})
+}
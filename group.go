@@ -0,0 +1,145 @@
+package auditlog
+
+// A Batcher is a Store that can store several events in a single
+// transaction. The logger commits the events waiting in its queue
+// together when its store is a Batcher, which raises throughput under
+// load; each event is still signed in order.
+type Batcher interface {
+	// StoreEvents records a run of signed events, in order. If
+	// any of them can't be stored, none of them are. As with
+	// StoreEvent, the events may be reused once it returns.
+	StoreEvents(events []*Event) error
+}
+
+// processGroup records a group of events taken from the queue. If
+// the store is a Batcher, the events, and any the logger records
+// along with them, are committed in one transaction, and their
+// callers are released once it commits.
+func (l *Logger) processGroup(events []*Event) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.closed {
+		return
+	}
+
+	if _, ok := l.store.(Batcher); !ok {
+		for _, ev := range events {
+			l.handle(ev)
+			l.acknowledge(ev)
+			releaseEvent(ev)
+		}
+		l.recordDropped()
+		return
+	}
+
+	l.grouping = true
+	for _, ev := range events {
+		l.handle(ev)
+	}
+	l.recordDropped()
+	stored := l.commitGroup()
+	l.grouping = false
+
+	if stored && !l.buffering() {
+		l.setFailure(nil)
+	}
+
+	for _, ev := range events {
+		l.acknowledge(ev)
+		releaseEvent(ev)
+	}
+}
+
+// commitGroup stores the events collected while grouping in a single
+// transaction, and echoes them, reporting whether they were all
+// stored; the caller must hold the lock.
+func (l *Logger) commitGroup() bool {
+	group := l.group
+	l.group = nil
+	if len(group) == 0 {
+		return false
+	}
+
+	err := l.store.(Batcher).StoreEvents(group)
+	if err == nil {
+		for _, ev := range group {
+			l.committed(ev)
+		}
+		return true
+	}
+
+	// Nothing in the group was stored, so the events are stored one
+	// at a time, as they would have been without grouping, until
+	// one fails.
+	prev := l.groupPrev
+	for i, ev := range group {
+		err = l.store.StoreEvent(ev)
+		if err == ErrDuplicateSerial && !l.replaying {
+			// Another logger has advanced the chain.
+			l.rerecord(group[:i], group[i:], prev)
+			return false
+		}
+
+		if err != nil {
+			l.groupFailed(group[:i], group[i:], prev, err)
+			return false
+		}
+
+		l.committed(ev)
+		prev = ev.Signature
+	}
+	return true
+}
+
+// groupFailed handles the failure to store rest, the remainder of a
+// group whose events up to it were stored, as record handles the
+// failure to store an event: the events are buffered in degraded
+// mode, spooled to be recorded again later, or handed to the failure
+// policy. prev is the signature of the event preceding rest.
+func (l *Logger) groupFailed(stored, rest []*Event, prev []byte, err error) {
+	l.setFailure(err)
+	if l.degraded != nil && !l.replaying {
+		last := l.lastSignature
+		l.lastSignature = prev
+		l.bufferEvent(rest[0], err)
+		l.lastSignature = last
+
+		for _, ev := range rest[1:] {
+			l.bufferEvent(ev, nil)
+		}
+
+		for _, ev := range rest {
+			l.committed(ev)
+		}
+		return
+	}
+
+	if l.spool != nil {
+		// The spooled events are signed again when they are
+		// recorded, so the chain is unwound to the last one
+		// stored.
+		l.unwind(stored, rest[0].Serial, prev)
+
+		for _, ev := range rest {
+			l.spoolEvent(ev, err)
+		}
+		return
+	}
+
+	if l.failure.Mode == FailPanic {
+		l.fail(rest, err, nil)
+	}
+
+	// Otherwise, the chain is unwound, and the events are recorded
+	// again one at a time, so that the policy is applied to each
+	// event that can't be stored.
+	l.unwind(stored, rest[0].Serial, prev)
+	grouping := l.grouping
+	l.grouping = false
+	defer func() { l.grouping = grouping }()
+
+	for _, ev := range rest {
+		l.record(ev)
+	}
+}
@@ -0,0 +1,93 @@
+package auditlog
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchingStore is a memory store that records the size of each
+// group committed, and can be made to fail group commits.
+type batchingStore struct {
+	*MemoryStore
+	lock   sync.Mutex
+	groups []int
+	fail   bool
+}
+
+func (bs *batchingStore) StoreEvents(events []*Event) error {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	bs.groups = append(bs.groups, len(events))
+	if bs.fail {
+		return errors.New("transaction failed")
+	}
+
+	for _, ev := range events {
+		if err := bs.MemoryStore.StoreEvent(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bs *batchingStore) largestGroup() int {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	largest := 0
+	for _, n := range bs.groups {
+		if n > largest {
+			largest = n
+		}
+	}
+	return largest
+}
+
+// queueWhileBlocked logs events while the logger is blocked, so that
+// they are waiting in the queue together when it resumes.
+func queueWhileBlocked(l *Logger, n int) {
+	l.lock.Lock()
+	for i := 0; i < n; i++ {
+		l.Info("group_test", "event", nil)
+	}
+	l.lock.Unlock()
+
+	for l.Count() < uint64(n) {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGroupCommit(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	for _, fail := range []bool{false, true} {
+		store := &batchingStore{MemoryStore: NewMemoryStore(), fail: fail}
+		l, err := NewWithStore(store, signer, WithoutEcho())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		l.Start()
+
+		queueWhileBlocked(l, 10)
+		l.InfoSync("group_test", "sync", nil)
+		l.Stop()
+
+		if largest := store.largestGroup(); largest < 5 {
+			t.Fatalf("expected the queued events to be grouped, have a largest group of %d", largest)
+		}
+
+		// Whether the group commit succeeded, or the events were
+		// stored one at a time after it failed, the chain is
+		// intact.
+		if count, _ := store.Count(); count != 11 {
+			t.Fatalf("expected 11 events, have %d", count)
+		}
+
+		if _, err = NewWithStore(store, signer, WithoutEcho()); err != nil {
+			t.Fatalf("chain failed to verify: %v", err)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Package grpcaudit records gRPC calls as audit events, with server
+// interceptors:
+//
+//	server := grpc.NewServer(
+//		grpc.UnaryInterceptor(grpcaudit.UnaryServerInterceptor(logger, opts)),
+//		grpc.StreamInterceptor(grpcaudit.StreamServerInterceptor(logger, opts)))
+//
+// Each call is recorded, once its handler returns, as an event whose
+// actor is the authenticated principal, with the method, peer, status
+// code, and selected metadata as attributes.
+package grpcaudit
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kisom/auditlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// EventCall is the event recorded for a call.
+const EventCall = "grpc call"
+
+// Anonymous is the actor recorded for calls without a principal.
+const Anonymous = "anonymous"
+
+// Options control which calls are recorded and how.
+type Options struct {
+	// Methods is the allowlist of the calls to record, as full
+	// method names, such as "/admin.Users/Delete", or as services
+	// ending in a slash, such as "/admin.Users/", for every method
+	// of the service. If empty, every call is recorded.
+	Methods []string
+
+	// Principal returns the authenticated principal making a call,
+	// or the empty string if there is none. If nil, the common name
+	// of the peer's verified TLS client certificate is used.
+	Principal func(ctx context.Context) string
+
+	// Metadata names the metadata keys, such as "x-user-id", whose
+	// values are recorded, as attributes prefixed with "md.".
+	// Credentials, such as the authorization key, shouldn't be
+	// named here.
+	Metadata []string
+
+	// Event names the events recorded, and defaults to EventCall.
+	Event string
+}
+
+// audited reports whether calls to method are recorded.
+func (opts *Options) audited(method string) bool {
+	if len(opts.Methods) == 0 {
+		return true
+	}
+
+	for _, allowed := range opts.Methods {
+		if method == allowed || (strings.HasSuffix(allowed, "/") && strings.HasPrefix(method, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// tlsPrincipal returns the common name of the peer's verified TLS
+// client certificate.
+func tlsPrincipal(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return info.State.VerifiedChains[0][0].Subject.CommonName
+}
+
+// UnaryServerInterceptor returns an interceptor recording the unary
+// calls selected by opts in the chain kept by l. Calls are recorded as
+// INFO events, unless they are refused, with Unauthenticated or
+// PermissionDenied, which is a WARNING, or fail with a server error,
+// which is an ERROR. Events are recorded without waiting for them to
+// be stored.
+func UnaryServerInterceptor(l *auditlog.Logger, opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !opts.audited(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		resp, err := handler(ctx, req)
+		record(ctx, l, &opts, info.FullMethod, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor recording the
+// streaming calls selected by opts, as UnaryServerInterceptor does
+// unary calls. A stream is recorded when it ends.
+func StreamServerInterceptor(l *auditlog.Logger, opts Options) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !opts.audited(info.FullMethod) {
+			return handler(srv, ss)
+		}
+
+		err := handler(srv, ss)
+		record(ss.Context(), l, &opts, info.FullMethod, err)
+		return err
+	}
+}
+
+// record records a call to method that returned err.
+func record(ctx context.Context, l *auditlog.Logger, opts *Options, method string, err error) {
+	principal := opts.Principal
+	if principal == nil {
+		principal = tlsPrincipal
+	}
+
+	actor := principal(ctx)
+	if actor == "" {
+		actor = Anonymous
+	}
+
+	event := opts.Event
+	if event == "" {
+		event = EventCall
+	}
+
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+
+	code := status.Code(err)
+	attrs := []auditlog.Attribute{
+		{Name: "method", Value: method},
+		{Name: "peer", Value: addr},
+		{Name: "status", Value: code.String()},
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, key := range opts.Metadata {
+		if values := md.Get(key); len(values) > 0 {
+			attrs = append(attrs, auditlog.Attribute{Name: "md." + key, Value: strings.Join(values, ",")})
+		}
+	}
+
+	switch code {
+	case codes.Unknown, codes.Internal, codes.DataLoss, codes.Unavailable:
+		l.Error(actor, event, attrs)
+	case codes.Unauthenticated, codes.PermissionDenied:
+		l.Warning(actor, event, attrs)
+	default:
+		l.Info(actor, event, attrs)
+	}
+}
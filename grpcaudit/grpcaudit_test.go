@@ -0,0 +1,88 @@
+package grpcaudit
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/kisom/auditlog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// A testStream is a server stream carrying only a context.
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (ts *testStream) Context() context.Context {
+	return ts.ctx
+}
+
+func TestInterceptors(t *testing.T) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	audit, err := auditlog.NewWithStore(auditlog.NewMemoryStore(), signer, auditlog.WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	audit.Start()
+	defer audit.Stop()
+
+	opts := Options{
+		Methods:   []string{"/admin.Users/"},
+		Principal: func(ctx context.Context) string { return "alice" },
+		Metadata:  []string{"x-request-id"},
+	}
+	unary := UnaryServerInterceptor(audit, opts)
+	stream := StreamServerInterceptor(audit, opts)
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234},
+	})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-request-id", "42", "authorization", "secret"))
+
+	ok := func(ctx context.Context, req interface{}) (interface{}, error) { return req, nil }
+	unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/public.Status/Get"}, ok)
+	unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/admin.Users/Delete"}, ok)
+	stream(nil, &testStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/admin.Users/Watch"},
+		func(srv interface{}, ss grpc.ServerStream) error {
+			return status.Error(codes.PermissionDenied, "denied")
+		})
+
+	// Calls are recorded in the background; a synchronous event
+	// waits for them.
+	audit.InfoSync("grpcaudit_test", "served", nil)
+	events, err := audit.Query("grpcaudit_test", auditlog.Query{Event: EventCall})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 calls to be recorded, have %d", len(events))
+	}
+
+	want := []auditlog.Attribute{
+		{Name: "method", Value: "/admin.Users/Delete"},
+		{Name: "peer", Value: "192.0.2.1:1234"},
+		{Name: "status", Value: "OK"},
+		{Name: "md.x-request-id", Value: "42"},
+	}
+	if ev := events[0]; ev.Actor != "alice" || ev.Level != "INFO" || !reflect.DeepEqual(ev.Attributes, want) {
+		t.Fatalf("expected the unary call, have %s", ev)
+	}
+
+	if ev := events[1]; ev.Level != "WARNING" || ev.Attributes[2].Value != "PermissionDenied" {
+		t.Fatalf("expected the refused stream, have %s", ev)
+	}
+}
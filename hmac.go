@@ -0,0 +1,139 @@
+package auditlog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+)
+
+// MinHMACKeySize is the shortest key accepted for HMAC chaining.
+const MinHMACKeySize = 32
+
+// hmacTag is the byte that begins an event's HMAC tag, which is
+// otherwise laid out as a hash link is: hash links begin with zero,
+// and DER-encoded signatures with 0x30.
+const hmacTag = 1
+
+// WithHMACChaining authenticates each event with an HMAC-SHA256 tag
+// under key, chaining it to the previous event as a signature does,
+// in place of an ECDSA signature. A tag costs a small fraction of a
+// signature to compute and to verify, but anyone holding the key can
+// forge the chain, so it suits internal deployments that need tamper
+// evidence rather than proof a third party can check. The key must be
+// at least MinHMACKeySize bytes, and kept apart from the store.
+//
+// The signer still signs what the logger publishes, such as signed
+// checkpoints, reports, and backups, and the events that must be
+// signed, such as "key rotated" events. Verifying the chain, or a
+// certification of it, needs the key; see VerifyHMAC. Diagnose and
+// Migrate, which are only given the public key, can't authenticate
+// HMAC-tagged events. HMAC chaining can't be combined with
+// WithBatchSigning.
+func WithHMACChaining(key []byte) Option {
+	return func(l *Logger) {
+		l.hmacKey = append([]byte{}, key...)
+	}
+}
+
+// VerifyHMAC supplies the key a chain recorded with WithHMACChaining
+// was tagged under, so that its events can be verified.
+func VerifyHMAC(key []byte) VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.hmacKey = key
+	}
+}
+
+// checkHMAC reports whether the logger's HMAC chaining options are
+// usable.
+func (l *Logger) checkHMAC() error {
+	if l.hmacKey == nil {
+		return nil
+	}
+
+	if len(l.hmacKey) < MinHMACKeySize {
+		return errors.New("auditlog: the HMAC key is too short")
+	}
+
+	if l.batch != nil {
+		return errors.New("auditlog: HMAC chaining can't be combined with batch signing")
+	}
+	return nil
+}
+
+// authenticate tags the event with an HMAC of its digest under key,
+// chaining it to prev, the previous event's signature or tag.
+func (ev *Event) authenticate(key, prev []byte) error {
+	if !ev.knownDigest() {
+		return errUnknownDigest
+	}
+
+	digest := ev.digest(prev)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(digest[:])
+	ev.Signature = mac.Sum([]byte{hmacTag})
+	return nil
+}
+
+// hmacTagged reports whether the event carries an HMAC tag rather than
+// a signature or hash link.
+func (ev *Event) hmacTagged() bool {
+	return len(ev.Signature) == hashLinkSize && ev.Signature[0] == hmacTag
+}
+
+// VerifyHMAC checks the HMAC tag on an event recorded with
+// WithHMACChaining under key, where prev is the previous event's
+// signature or tag.
+func (ev *Event) VerifyHMAC(key, prev []byte) bool {
+	if !ev.hmacTagged() || !ev.knownDigest() {
+		return false
+	}
+
+	digest := ev.digest(prev)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(digest[:])
+	return hmac.Equal(ev.Signature[1:], mac.Sum(nil))
+}
+
+// withHMAC returns a copy of the manifest that verifies HMAC-tagged
+// events under key, or the manifest itself if key is nil.
+func (m KeyManifest) withHMAC(key []byte) KeyManifest {
+	if key == nil {
+		return m
+	}
+
+	keys := make(KeyManifest, len(m))
+	for i, kr := range m {
+		kr.hmacKey = key
+		keys[i] = kr
+	}
+	return keys
+}
+
+// hmacPEMType is the type of the PEM block holding an HMAC key.
+const hmacPEMType = "AUDITLOG HMAC KEY"
+
+// MarshalHMACKey encodes an HMAC chaining key as a PEM block, the
+// format read by LoadHMACKey.
+func MarshalHMACKey(key []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: hmacPEMType, Bytes: key})
+}
+
+// LoadHMACKey reads an HMAC chaining key written by MarshalHMACKey.
+func LoadHMACKey(path string) ([]byte, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, _ := pem.Decode(in)
+	if p == nil || p.Type != hmacPEMType {
+		return nil, errors.New("auditlog: no HMAC key found in " + path)
+	}
+
+	if len(p.Bytes) < MinHMACKeySize {
+		return nil, errors.New("auditlog: the HMAC key is too short")
+	}
+	return p.Bytes, nil
+}
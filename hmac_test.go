@@ -0,0 +1,91 @@
+package auditlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHMACChaining(t *testing.T) {
+	signer := testKey(t, "signer")
+	next := testKey(t, "next")
+
+	key := make([]byte, MinHMACKeySize)
+	other := make([]byte, MinHMACKeySize)
+	other[0] = 1
+
+	l, store := newTestLogger(t, WithHMACChaining(key))
+	l.Start()
+
+	for i := 0; i < 5; i++ {
+		l.InfoSync("hmac_test", "event", nil)
+	}
+
+	// A key rotation is still signed with the outgoing key.
+	if err := l.RotateKey(next); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		l.InfoSync("hmac_test", "event", nil)
+	}
+
+	cert, err := l.Certify(0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	keys := l.KeyHistory()
+	l.Stop()
+
+	events, err := store.Events(0, 10)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, ev := range events {
+		if ev.hmacTagged() == (ev.Event == EventKeyRotated) {
+			t.Fatalf("unexpected signature on event %d", ev.Serial)
+		}
+	}
+
+	if !events[0].VerifyHMAC(key, nil) || events[0].VerifyHMAC(other, nil) {
+		t.Fatal("the first event's tag doesn't verify under its key alone")
+	}
+
+	// The chain verifies when the logger starts again with the same
+	// key, and not with another.
+	if l, err = NewWithStore(store, next, WithoutEcho(), WithHMACChaining(key)); err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	if _, err = NewWithStore(store, next, WithoutEcho(), WithHMACChaining(other)); err == nil {
+		t.Fatal("chain verified under the wrong HMAC key")
+	}
+
+	if _, err = NewWithStore(store, next, WithoutEcho()); err == nil {
+		t.Fatal("chain verified without its HMAC key")
+	}
+
+	// Certifications need the key too.
+	if _, ok := VerifyCertification(cert, nil, VerifyKeys(keys), VerifyHMAC(key)); !ok {
+		t.Fatal("certification didn't verify with the HMAC key")
+	}
+
+	if _, ok := VerifyCertification(cert, nil, VerifyKeys(keys), VerifyHMAC(other)); ok {
+		t.Fatal("certification verified under the wrong HMAC key")
+	}
+
+	if _, ok := VerifyCertification(cert, nil, VerifyKeys(keys)); ok {
+		t.Fatal("certification verified without its HMAC key")
+	}
+
+	// Short keys and batch signing are refused.
+	if _, err = NewWithStore(NewMemoryStore(), signer, WithHMACChaining(key[:16])); err == nil {
+		t.Fatal("logger started with a short HMAC key")
+	}
+
+	batch := WithBatchSigning(BatchPolicy{MaxEvents: 4, Interval: time.Hour})
+	if _, err = NewWithStore(NewMemoryStore(), signer, WithHMACChaining(key), batch); err == nil {
+		t.Fatal("logger started with HMAC chaining and batch signing")
+	}
+}
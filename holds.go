@@ -0,0 +1,290 @@
+package auditlog
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Events recording the placement and release of legal holds.
+const (
+	EventHoldPlaced   = "legal hold placed"
+	EventHoldReleased = "legal hold released"
+)
+
+// A LegalHold protects a range of events from pruning. A hold covers
+// either the events with serial numbers from Start through End, or,
+// if ByTime is set, the events logged at or after From and before
+// Until. Serial is the serial number of the event recording the hold,
+// which is protected along with the range.
+type LegalHold struct {
+	ID     string
+	Reason string
+	Serial uint64
+
+	ByTime      bool
+	Start, End  uint64
+	From, Until time.Time
+}
+
+// covers reports whether the hold protects an event.
+func (h *LegalHold) covers(ev *Event) bool {
+	if ev.Serial == h.Serial {
+		return true
+	}
+
+	if h.ByTime {
+		return ev.When >= h.From.UnixNano() && ev.When < h.Until.UnixNano()
+	}
+	return ev.Serial >= h.Start && ev.Serial <= h.End
+}
+
+// ErrLegalHold is returned when pruning would remove events under a
+// legal hold.
+var ErrLegalHold = errors.New("auditlog: events are under a legal hold")
+
+// HoldSerials places a legal hold, identified by id, on the events
+// with serial numbers from start through end, recording a signed
+// "legal hold placed" event. The events can't be pruned until the
+// hold is released. The logger must be running.
+func (l *Logger) HoldSerials(id, reason string, start, end uint64) error {
+	if end < start {
+		return errors.New("auditlog: invalid legal hold range")
+	}
+
+	return l.placeHold(id, []Attribute{
+		{"id", id},
+		{"reason", reason},
+		{"start", strconv.FormatUint(start, 10)},
+		{"end", strconv.FormatUint(end, 10)},
+	})
+}
+
+// HoldTimes places a legal hold, identified by id, on the events
+// logged at or after from and before until, as HoldSerials does. The
+// period may extend into the future.
+func (l *Logger) HoldTimes(id, reason string, from, until time.Time) error {
+	if !until.After(from) {
+		return errors.New("auditlog: invalid legal hold period")
+	}
+
+	return l.placeHold(id, []Attribute{
+		{"id", id},
+		{"reason", reason},
+		{"from", strconv.FormatInt(from.UnixNano(), 10)},
+		{"until", strconv.FormatInt(until.UnixNano(), 10)},
+	})
+}
+
+// placeHold records a legal hold. Holds are placed and released under
+// the prune lock, so that a hold can't be placed on events while they
+// are being pruned.
+func (l *Logger) placeHold(id string, attributes []Attribute) error {
+	l.pruneLock.Lock()
+	defer l.pruneLock.Unlock()
+
+	holds, err := l.Holds()
+	if err != nil {
+		return err
+	}
+
+	for _, h := range holds {
+		if h.ID == id {
+			return errors.New("auditlog: legal hold " + id + " is already in place")
+		}
+	}
+
+	if !l.accept(levelInternal) {
+		return errors.New("auditlog: logger is not running")
+	}
+
+	wait := make(chan struct{}, 0)
+	l.logInternalEvent(levelInfo, EventHoldPlaced, attributes, wait, nil)
+	<-wait
+	return nil
+}
+
+// ReleaseHold releases the legal hold identified by id, recording a
+// signed "legal hold released" event. The logger must be running.
+func (l *Logger) ReleaseHold(id, reason string) error {
+	l.pruneLock.Lock()
+	defer l.pruneLock.Unlock()
+
+	holds, err := l.Holds()
+	if err != nil {
+		return err
+	}
+
+	var found bool
+	for _, h := range holds {
+		found = found || h.ID == id
+	}
+
+	if !found {
+		return errors.New("auditlog: no legal hold " + id)
+	}
+
+	if !l.accept(levelInternal) {
+		return errors.New("auditlog: logger is not running")
+	}
+
+	wait := make(chan struct{}, 0)
+	l.logInternalEvent(levelInfo, EventHoldReleased, []Attribute{
+		{"id", id},
+		{"reason", reason},
+	}, wait, nil)
+	<-wait
+	return nil
+}
+
+// parseHold reads a legal hold from the event that placed it.
+func parseHold(ev *Event) (*LegalHold, error) {
+	h := &LegalHold{Serial: ev.Serial}
+	h.ID, _ = ev.attr("id")
+	h.Reason, _ = ev.attr("reason")
+
+	if start, ok := ev.attr("start"); ok {
+		end, _ := ev.attr("end")
+		var err error
+		if h.Start, err = strconv.ParseUint(start, 10, 64); err != nil {
+			return nil, err
+		}
+		if h.End, err = strconv.ParseUint(end, 10, 64); err != nil {
+			return nil, err
+		}
+		return h, nil
+	}
+
+	from, _ := ev.attr("from")
+	until, _ := ev.attr("until")
+	fromNS, err := strconv.ParseInt(from, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	untilNS, err := strconv.ParseInt(until, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	h.ByTime = true
+	h.From, h.Until = time.Unix(0, fromNS), time.Unix(0, untilNS)
+	return h, nil
+}
+
+// A holdIndex follows the legal holds recorded in the chain, so that
+// each look at the holds only reads the events recorded since the
+// last.
+type holdIndex struct {
+	lock  sync.Mutex
+	next  uint64
+	holds []*LegalHold
+}
+
+// Holds returns the legal holds currently in place, as recorded in
+// the chain.
+func (l *Logger) Holds() ([]*LegalHold, error) {
+	idx := &l.holds
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	start, _, err := l.chainStart()
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := l.store.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	if idx.next < start {
+		idx.next = start
+	}
+
+	searcher, _ := l.store.(ActorSearcher)
+	for idx.next < count {
+		last := idx.next + backupBatch - 1
+		if last >= count {
+			last = count - 1
+		}
+
+		var events []*Event
+		if searcher != nil {
+			events, err = searcher.EventsByActor(internalActor, idx.next, last)
+		} else {
+			events, err = l.store.Events(idx.next, last)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		holds, err := applyHolds(idx.holds, events)
+		if err != nil {
+			return nil, err
+		}
+		idx.holds, idx.next = holds, last+1
+	}
+
+	return append([]*LegalHold(nil), idx.holds...), nil
+}
+
+// applyHolds returns the legal holds in place after events, given
+// those in place before them. holds isn't modified.
+func applyHolds(holds []*LegalHold, events []*Event) ([]*LegalHold, error) {
+	holds = append([]*LegalHold(nil), holds...)
+	for _, ev := range events {
+		if ev.Actor != internalActor {
+			continue
+		}
+
+		switch ev.Event {
+		case EventHoldPlaced:
+			h, err := parseHold(ev)
+			if err != nil {
+				return nil, err
+			}
+			holds = append(holds, h)
+		case EventHoldReleased:
+			id, _ := ev.attr("id")
+			for i := range holds {
+				if holds[i].ID == id {
+					holds = append(holds[:i], holds[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return holds, nil
+}
+
+// firstHeld returns the serial number of the first event from start
+// through end that is under a legal hold; ok is false if none are.
+func (l *Logger) firstHeld(start, end uint64) (serial uint64, ok bool, err error) {
+	holds, err := l.Holds()
+	if err != nil || len(holds) == 0 {
+		return 0, false, err
+	}
+
+	for ; start <= end; start += backupBatch {
+		last := end
+		if end-start >= backupBatch {
+			last = start + backupBatch - 1
+		}
+
+		events, err := l.store.Events(start, last)
+		if err != nil {
+			return 0, false, err
+		}
+
+		for _, ev := range events {
+			for _, h := range holds {
+				if h.covers(ev) {
+					return ev.Serial, true, nil
+				}
+			}
+		}
+	}
+	return 0, false, nil
+}
@@ -0,0 +1,106 @@
+package auditlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLegalHold(t *testing.T) {
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, store := newTestLogger(t,
+		WithClock(NewFixedClock(start, time.Minute)))
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 10; i++ {
+		l.InfoSync("holds_test", "tick", nil)
+	}
+
+	err := l.HoldSerials("case-1", "litigation", 3, 4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = l.HoldSerials("case-1", "litigation", 5, 6); err == nil {
+		t.Fatal("placed a duplicate legal hold")
+	}
+
+	dir := DirArchiver(t.TempDir())
+	if err = l.Prune(5, dir); err != ErrLegalHold {
+		t.Fatalf("expected ErrLegalHold, have %v", err)
+	}
+
+	// PruneBefore stops short of the held events.
+	err = l.PruneBefore(start.Add(time.Hour), dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = store.Event(2); err != ErrNoEvent {
+		t.Fatalf("expected event 2 to be pruned, have %v", err)
+	}
+
+	if _, err = store.Event(3); err != nil {
+		t.Fatalf("held event 3 was pruned: %v", err)
+	}
+
+	// Callers can't release a hold by logging as the logger.
+	l.InfoSync(internalActor, EventHoldReleased, []Attribute{{"id", "case-1"}})
+	if err = l.Prune(5, dir); err != ErrLegalHold {
+		t.Fatalf("expected ErrLegalHold after a forged release, have %v", err)
+	}
+
+	forged, err := store.Event(l.Count() - 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if forged.Event != EventReservedActor {
+		t.Fatalf("expected the forged release to be recorded as %q, have %q", EventReservedActor, forged.Event)
+	}
+
+	err = l.ReleaseHold("case-1", "settled")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	holds, err := l.Holds()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(holds) != 0 {
+		t.Fatalf("expected no legal holds, have %d", len(holds))
+	}
+
+	err = l.Prune(5, dir)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestLegalHoldByTime(t *testing.T) {
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, _ := newTestLogger(t,
+		WithClock(NewFixedClock(start, time.Minute)))
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 10; i++ {
+		l.InfoSync("holds_test", "tick", nil)
+	}
+
+	// Event 1 was logged at minute 2.
+	err := l.HoldTimes("case-2", "investigation", start.Add(2*time.Minute), start.Add(3*time.Minute))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = l.Prune(1, DirArchiver(t.TempDir())); err != ErrLegalHold {
+		t.Fatalf("expected ErrLegalHold, have %v", err)
+	}
+
+	if err = l.Prune(0, DirArchiver(t.TempDir())); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
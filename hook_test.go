@@ -0,0 +1,72 @@
+package auditlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddHook(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	store := &lockedFailingStore{MemoryStore: NewMemoryStore()}
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithDegradedMode(DegradedPolicy{
+		MaxEvents: 10,
+		Interval:  10 * time.Millisecond,
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	hooked := make(chan *Event, 10)
+	l.AddHook(func(ev *Event) { hooked <- ev })
+
+	// A hook that panics doesn't affect the chain or the other hooks.
+	l.AddHook(func(ev *Event) { panic("hook failure") })
+
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("hook_test", "stored", nil)
+	if ev := <-hooked; ev.Event != "stored" || len(ev.Signature) == 0 {
+		t.Fatalf("expected the signed event, have %s", ev)
+	}
+
+	// An event buffered while the database is down only reaches the
+	// hooks once it has been stored.
+	store.setFail(true)
+	l.InfoSync("hook_test", "buffered", nil)
+
+	select {
+	case ev := <-hooked:
+		t.Fatalf("expected no event before the buffer is flushed, have %s", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	store.setFail(false)
+	select {
+	case ev := <-hooked:
+		if ev.Event != "buffered" {
+			t.Fatalf("expected the buffered event, have %s", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the buffered event once it was stored")
+	}
+
+	if _, err = store.Event(1); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// A removed hook sees no more events.
+	remove := l.AddHook(func(ev *Event) { hooked <- ev })
+	remove()
+
+	l.InfoSync("hook_test", "removed", nil)
+	for ev := <-hooked; ev.Event != "removed"; ev = <-hooked {
+	}
+
+	select {
+	case ev := <-hooked:
+		t.Fatalf("removed hook called with %s", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,155 @@
+// Package httpaudit records HTTP requests as audit events, so that
+// every call to an administrative API, say, is in the audit chain:
+//
+//	mux.Handle("/admin/", httpaudit.Middleware(logger, httpaudit.Options{
+//		Principal: currentUser,
+//	})(adminHandler))
+//
+// Each request is recorded, once its handler returns, as an event
+// whose actor is the authenticated principal, with the method, path,
+// status, and remote address as attributes.
+package httpaudit
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kisom/auditlog"
+)
+
+// EventRequest is the event recorded for a request.
+const EventRequest = "http request"
+
+// Anonymous is the actor recorded for requests without a principal.
+const Anonymous = "anonymous"
+
+// Options control which requests are recorded and how.
+type Options struct {
+	// Match selects the requests to record; if nil, every request
+	// is recorded.
+	Match func(r *http.Request) bool
+
+	// Principal returns the authenticated principal making a
+	// request, or the empty string if there is none. If nil, the
+	// user named in the request's basic authentication is used.
+	Principal func(r *http.Request) string
+
+	// Event names the events recorded, and defaults to
+	// EventRequest.
+	Event string
+}
+
+// PathPrefix returns a Match function selecting the requests whose
+// paths start with one of prefixes.
+func PathPrefix(prefixes ...string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// basicAuthUser returns the user named in a request's basic
+// authentication.
+func basicAuthUser(r *http.Request) string {
+	user, _, _ := r.BasicAuth()
+	return user
+}
+
+// A statusWriter keeps the status of the response written through it.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Middleware returns middleware recording the requests selected by
+// opts in the chain kept by l. Requests are recorded as INFO events,
+// unless they are refused, with 401 or 403, which is a WARNING, or
+// fail, with a 5xx status, which is an ERROR. A handler that panics
+// is recorded with a 500 status before the panic continues. Events
+// are recorded without waiting for them to be stored.
+func Middleware(l *auditlog.Logger, opts Options) func(http.Handler) http.Handler {
+	principal := opts.Principal
+	if principal == nil {
+		principal = basicAuthUser
+	}
+
+	event := opts.Event
+	if event == "" {
+		event = EventRequest
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if opts.Match != nil && !opts.Match(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				status := sw.status
+				if status == 0 {
+					status = http.StatusOK
+				}
+
+				p := recover()
+				if p != nil {
+					status = http.StatusInternalServerError
+				}
+
+				record(l, event, principal(r), r, status)
+				if p != nil {
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
+
+// record records a request that was answered with status.
+func record(l *auditlog.Logger, event, actor string, r *http.Request, status int) {
+	if actor == "" {
+		actor = Anonymous
+	}
+
+	attrs := []auditlog.Attribute{
+		{Name: "method", Value: r.Method},
+		{Name: "path", Value: r.URL.Path},
+		{Name: "status", Value: strconv.Itoa(status)},
+		{Name: "remote_addr", Value: r.RemoteAddr},
+	}
+
+	switch {
+	case status >= 500:
+		l.Error(actor, event, attrs)
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		l.Warning(actor, event, attrs)
+	default:
+		l.Info(actor, event, attrs)
+	}
+}
@@ -0,0 +1,72 @@
+package httpaudit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/kisom/auditlog"
+)
+
+func TestMiddleware(t *testing.T) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	audit, err := auditlog.NewWithStore(auditlog.NewMemoryStore(), signer, auditlog.WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	audit.Start()
+	defer audit.Stop()
+
+	handler := Middleware(audit, Options{Match: PathPrefix("/admin/")})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/admin/denied" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+
+	serve := func(path string, user string) {
+		r := httptest.NewRequest("POST", path, nil)
+		if user != "" {
+			r.SetBasicAuth(user, "password")
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	serve("/public", "alice")
+	serve("/admin/users", "alice")
+	serve("/admin/denied", "")
+
+	// Requests are recorded in the background; a synchronous event
+	// waits for them.
+	audit.InfoSync("httpaudit_test", "served", nil)
+	events, err := audit.Query("httpaudit_test", auditlog.Query{Event: EventRequest})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 requests to be recorded, have %d", len(events))
+	}
+
+	want := []auditlog.Attribute{
+		{Name: "method", Value: "POST"},
+		{Name: "path", Value: "/admin/users"},
+		{Name: "status", Value: "200"},
+		{Name: "remote_addr", Value: "192.0.2.1:1234"},
+	}
+	if ev := events[0]; ev.Actor != "alice" || ev.Level != "INFO" || !reflect.DeepEqual(ev.Attributes, want) {
+		t.Fatalf("expected alice's request, have %s", ev)
+	}
+
+	if ev := events[1]; ev.Actor != Anonymous || ev.Level != "WARNING" {
+		t.Fatalf("expected the refused request, have %s", ev)
+	}
+}
@@ -0,0 +1,87 @@
+// Package testkeys provides the deterministic keys and failing signer
+// shared by the auditlog tests and the auditlogtest package, which the
+// auditlog package's own tests can't import.
+package testkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ECDSAKey derives a P-256 signing key from seed; see
+// auditlogtest.ECDSAKey.
+func ECDSAKey(seed string) *ecdsa.PrivateKey {
+	for i := uint32(0); ; i++ {
+		h := sha256.New()
+		h.Write([]byte("auditlogtest ECDSA key"))
+		binary.Write(h, binary.BigEndian, i)
+		h.Write([]byte(seed))
+
+		// Nearly every digest is a valid scalar; the counter
+		// handles the rare digest that is zero or too large.
+		key, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), h.Sum(nil))
+		if err == nil {
+			return key
+		}
+	}
+}
+
+// Ed25519Key derives an Ed25519 signing key from seed; see
+// auditlogtest.Ed25519Key.
+func Ed25519Key(seed string) ed25519.PrivateKey {
+	h := sha256.New()
+	h.Write([]byte("auditlogtest Ed25519 key"))
+	h.Write([]byte(seed))
+	return ed25519.NewKeyFromSeed(h.Sum(nil))
+}
+
+// ErrSignatureFailed is returned by the signatures a FailingSigner
+// fails.
+var ErrSignatureFailed = errors.New("auditlogtest: signature failed")
+
+// A FailingSigner signs with the signer it wraps, except that it
+// fails the signatures it has been told to fail.
+type FailingSigner struct {
+	crypto.Signer
+
+	lock     sync.Mutex
+	failures int
+}
+
+// NewFailingSigner returns a signer that fails the next n signatures,
+// or every signature if n is negative, and otherwise signs with
+// signer.
+func NewFailingSigner(signer crypto.Signer, n int) *FailingSigner {
+	return &FailingSigner{Signer: signer, failures: n}
+}
+
+// Fail makes the signer fail the next n signatures, or every
+// signature if n is negative.
+func (fs *FailingSigner) Fail(n int) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	fs.failures = n
+}
+
+// Sign returns ErrSignatureFailed if the signature is to fail, and
+// otherwise signs digest with the wrapped signer.
+func (fs *FailingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	fs.lock.Lock()
+	fail := fs.failures != 0
+	if fs.failures > 0 {
+		fs.failures--
+	}
+	fs.lock.Unlock()
+
+	if fail {
+		return nil, ErrSignatureFailed
+	}
+	return fs.Signer.Sign(rand, digest, opts)
+}
@@ -0,0 +1,87 @@
+package auditlog
+
+// An EventIter walks a range of the chain in serial order, loading
+// the events from the store a batch at a time, so that a chain of any
+// length can be walked in bounded memory:
+//
+//	it, err := l.Events(0, 0)
+//	if err != nil {
+//		return err
+//	}
+//
+//	for it.Next() {
+//		ev := it.Event()
+//		...
+//	}
+//	return it.Err()
+type EventIter struct {
+	store     Store
+	next, end uint64
+	done      bool
+
+	batch []*Event
+	ev    *Event
+	err   error
+}
+
+// Events returns an iterator over the events with serial numbers in
+// the range [start, end]; if end is zero, it runs to the end of the
+// chain as it stands when Events is called. Like EventsByActor, the
+// read is recorded in the chain as a query without an accessor, and
+// events that have been pruned are skipped. Events recorded while
+// the iterator is in use aren't affected by it, and don't affect it.
+func (l *Logger) Events(start, end uint64) (*EventIter, error) {
+	if l.requireAccessor {
+		return nil, ErrNoAccessor
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	start, end, empty, err := l.recordQuery("", Query{Start: start, End: end})
+	if err != nil {
+		return nil, err
+	}
+
+	return &EventIter{
+		store: l.store,
+		next:  start,
+		end:   end,
+		done:  empty,
+	}, nil
+}
+
+// Next advances the iterator to the next event, loading another batch
+// from the store when it needs one. It returns false once the range
+// has been walked, or an event couldn't be loaded; Err distinguishes
+// the two.
+func (it *EventIter) Next() bool {
+	for len(it.batch) == 0 {
+		if it.done || it.err != nil {
+			it.ev = nil
+			return false
+		}
+
+		last := it.next + backupBatch - 1
+		if last >= it.end || last < it.next {
+			last = it.end
+			it.done = true
+		}
+
+		it.batch, it.err = it.store.Events(it.next, last)
+		it.next = last + 1
+	}
+
+	it.ev, it.batch = it.batch[0], it.batch[1:]
+	return true
+}
+
+// Event returns the event Next advanced to.
+func (it *EventIter) Event() *Event {
+	return it.ev
+}
+
+// Err returns the error that stopped the iterator, if any.
+func (it *EventIter) Err() error {
+	return it.err
+}
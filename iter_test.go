@@ -0,0 +1,62 @@
+package auditlog
+
+import "testing"
+
+func TestEventIter(t *testing.T) {
+	l, _ := newTestLogger(t)
+	l.Start()
+	defer l.Stop()
+
+	const logged = 2*backupBatch + 5
+	for i := 0; i < logged-1; i++ {
+		l.Info("iter_test", "event", nil)
+	}
+	l.InfoSync("iter_test", "event", nil)
+
+	// The walk spans several batches, and doesn't include the query
+	// recording it.
+	it, err := l.Events(0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var walked uint64
+	for it.Next() {
+		if ev := it.Event(); ev.Serial != walked || ev.Actor != "iter_test" {
+			t.Fatalf("expected event %d, have %s", walked, ev)
+		}
+		walked++
+	}
+
+	if err = it.Err(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if walked != logged {
+		t.Fatalf("expected %d events, have %d", logged, walked)
+	}
+
+	it, err = l.Events(10, 12)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	walked = 0
+	for it.Next() {
+		walked++
+	}
+
+	if walked != 3 || it.Err() != nil {
+		t.Fatalf("expected 3 events, have %d: %v", walked, it.Err())
+	}
+
+	// A range past the end of the chain is empty.
+	it, err = l.Events(l.Count()+10, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if it.Next() {
+		t.Fatalf("expected no events, have %s", it.Event())
+	}
+}
@@ -0,0 +1,265 @@
+package auditlog
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// WithJournal writes each event to a write-ahead journal at path
+// before it is queued, so that events accepted by the logger survive
+// a crash before they are recorded. Entries left unrecorded by a
+// previous process are queued again, with their original timestamps,
+// when the logger is started. If the journal can't be read, creating
+// the logger fails.
+//
+// The journal holds events before they are signed, shredded, sealed,
+// or encrypted, so it is itself encrypted with key, a 256-bit AES key,
+// as the spool is. An event that can't be written to the journal is
+// handled by the logger's failure policy, as though it couldn't be
+// stored.
+func WithJournal(path string, key []byte) Option {
+	return func(l *Logger) {
+		aead, err := newAEAD(key)
+		if err != nil {
+			l.setOptErr(err)
+			return
+		}
+
+		j, err := openJournal(path, aead)
+		if err != nil {
+			l.setOptErr(err)
+			return
+		}
+		l.journal = j
+	}
+}
+
+// A journalEntry is a line in the journal: either an event, or the
+// acknowledgement that an event has been processed. Internal is set
+// on events generated by the logger itself.
+type journalEntry struct {
+	ID       uint64 `json:"id"`
+	Ack      bool   `json:"ack,omitempty"`
+	Event    *Event `json:"event,omitempty"`
+	Internal bool   `json:"internal,omitempty"`
+}
+
+type journal struct {
+	lock        sync.Mutex
+	path        string
+	aead        cipher.AEAD
+	next        uint64
+	outstanding map[uint64]bool
+	replay      []*Event
+}
+
+// openJournal reads the journal at path, collecting the events that
+// were never acknowledged. Each line of the journal holds the
+// base64-encoded nonce and sealed JSON encoding of an entry.
+func openJournal(path string, aead cipher.AEAD) (*journal, error) {
+	j := &journal{
+		path:        path,
+		aead:        aead,
+		next:        1,
+		outstanding: map[uint64]bool{},
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	events := map[uint64]*Event{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		err = j.open(scanner.Text(), &entry)
+		if err != nil {
+			// A crash may have left a partial line at
+			// the end of the journal.
+			break
+		}
+
+		if entry.ID >= j.next {
+			j.next = entry.ID + 1
+		}
+
+		if entry.Ack {
+			delete(events, entry.ID)
+		} else if entry.Event != nil {
+			entry.Event.journalID = entry.ID
+			entry.Event.internal = entry.Internal
+			events[entry.ID] = entry.Event
+		}
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for id, ev := range events {
+		j.outstanding[id] = true
+		j.replay = append(j.replay, ev)
+	}
+
+	sort.Slice(j.replay, func(a, b int) bool {
+		return j.replay[a].journalID < j.replay[b].journalID
+	})
+	return j, nil
+}
+
+// write appends an entry to the journal and, unless the event it
+// holds is recorded with DurabilityAsync, syncs it to disk; the
+// caller must hold the journal's lock.
+func (j *journal) write(entry *journalEntry) error {
+	line, err := j.seal(entry)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if err == nil && (entry.Event == nil || entry.Event.durability != DurabilityAsync) {
+		err = f.Sync()
+	}
+
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// seal encrypts an entry as a line of the journal.
+func (j *journal) seal(entry *journalEntry) ([]byte, error) {
+	in, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, j.aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	out := j.aead.Seal(nonce, nonce, in, []byte(j.path))
+	return []byte(base64.StdEncoding.EncodeToString(out)), nil
+}
+
+// open decrypts a line of the journal into entry.
+func (j *journal) open(line string, entry *journalEntry) error {
+	sealed, err := base64.StdEncoding.DecodeString(line)
+	if err != nil {
+		return err
+	}
+
+	n := j.aead.NonceSize()
+	if len(sealed) < n {
+		return errors.New("auditlog: corrupt journal")
+	}
+
+	in, err := j.aead.Open(nil, sealed[:n], sealed[n:], []byte(j.path))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(in, entry)
+}
+
+// append writes an event to the journal, returning its ID.
+func (j *journal) append(ev *Event) (uint64, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	id := j.next
+	err := j.write(&journalEntry{ID: id, Event: ev, Internal: ev.internal})
+	if err != nil {
+		return 0, err
+	}
+
+	j.next++
+	j.outstanding[id] = true
+	return id, nil
+}
+
+// ack records that an event has been processed. Once no events are
+// outstanding, the journal is emptied.
+func (j *journal) ack(id uint64) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	delete(j.outstanding, id)
+	if len(j.outstanding) == 0 {
+		os.Truncate(j.path, 0)
+		return
+	}
+	j.write(&journalEntry{ID: id, Ack: true})
+}
+
+// journalEvent writes an event to the journal before it is queued. An
+// event that can't be written is handed to the failure policy, as an
+// event that can't be stored would be; journalEvent returns false if
+// the policy discarded it, in which case the caller has been released
+// and the event must not be queued.
+func (l *Logger) journalEvent(ev *Event) bool {
+	id, err := l.journal.append(ev)
+	if err == nil {
+		ev.journalID = id
+		return true
+	}
+
+	if l.stderr != nil {
+		l.stderr.Write([]byte("logger failure: journal: " + err.Error() + "\n"))
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	err = l.fail([]*Event{ev}, err, func() error {
+		id, err := l.journal.append(ev)
+		ev.journalID = id
+		return err
+	})
+	if err == nil {
+		return true
+	}
+
+	l.acknowledge(ev)
+	l.pending.Done()
+	releaseEvent(ev)
+	return false
+}
+
+// replayJournal records the events left in the journal by a previous
+// process. It is called by the queue's listener before it receives any
+// new events, so the replayed events keep their place in the chain.
+func (l *Logger) replayJournal() {
+	if l.journal == nil {
+		return
+	}
+
+	l.journal.lock.Lock()
+	replay := l.journal.replay
+	l.journal.replay = nil
+	l.journal.lock.Unlock()
+
+	for _, ev := range replay {
+		l.processEvent(ev)
+	}
+}
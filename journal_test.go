@@ -0,0 +1,129 @@
+package auditlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auditlog.journal")
+	key := make([]byte, 32)
+	aead, err := newAEAD(key)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Simulate a process that queued three events and crashed
+	// after recording only the first.
+	j, err := openJournal(path, aead)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, name := range []string{"first", "second", "third"} {
+		_, err = j.append(&Event{
+			When:       int64(len(name)),
+			Level:      levelStrings[levelInfo],
+			Actor:      "journal_test",
+			Event:      name,
+			Attributes: []Attribute{{"user", "jqp"}},
+		})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	j.write(&journalEntry{ID: 1, Ack: true})
+
+	journaled, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if strings.Contains(string(journaled), "jqp") {
+		t.Fatal("journal is not encrypted")
+	}
+
+	l, store := newTestLogger(t, WithJournal(path, key))
+	l.Start()
+	l.InfoSync("journal_test", "fourth", nil)
+	l.Stop()
+
+	if l.Count() != 3 {
+		t.Fatalf("expected 3 stored events, have %d", l.Count())
+	}
+
+	for i, name := range []string{"second", "third", "fourth"} {
+		ev, err := store.Event(uint64(i))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if ev.Event != name {
+			t.Fatalf("expected event %d to be %q, have %s", i, name, ev)
+		}
+	}
+
+	ev, _ := store.Event(0)
+	if ev.When != int64(len("second")) {
+		t.Fatalf("expected the replayed event to keep its timestamp, have %d", ev.When)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if fi.Size() != 0 {
+		t.Fatalf("expected an empty journal, have %d bytes", fi.Size())
+	}
+
+	j, err = openJournal(path, aead)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(j.replay) != 0 {
+		t.Fatalf("expected no events to replay, have %d", len(j.replay))
+	}
+}
+
+func TestJournalFailure(t *testing.T) {
+	// The journal's directory is removed once the logger has been
+	// created, so that no event can be written to it.
+	dir := filepath.Join(t.TempDir(), "journal")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var failed []string
+	l, store := newTestLogger(t,
+		WithJournal(filepath.Join(dir, "auditlog.journal"), make([]byte, 32)),
+		WithFailurePolicy(FailurePolicy{
+			Mode: FailCallback,
+			Callback: func(ev *Event, err error) {
+				failed = append(failed, ev.Event)
+			},
+		}))
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	l.Start()
+	defer l.Stop()
+
+	if err := l.InfoE("journal_test", "unjournaled", nil); err == nil {
+		t.Fatal("expected the unjournaled event to be reported")
+	}
+
+	if len(failed) != 1 || failed[0] != "unjournaled" {
+		t.Fatalf("expected the unjournaled event to go to the failure policy, have %v", failed)
+	}
+
+	if count, _ := store.Count(); count != 0 {
+		t.Fatalf("expected no stored events, have %d", count)
+	}
+}
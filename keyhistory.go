@@ -0,0 +1,426 @@
+package auditlog
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+// EventKeyRotated is recorded, signed with the outgoing key, when the
+// logger begins signing with a new key; see RotateKey.
+const EventKeyRotated = "key rotated"
+
+// A KeyRange is one entry in a chain's key history: a public key and
+// the serial numbers of the first and last events it signed. The
+// current key has no last event, as it goes on signing; Last is zero
+// and Current is set.
+type KeyRange struct {
+	Public  *ecdsa.PublicKey
+	First   uint64
+	Last    uint64
+	Current bool
+
+	// hmacKey verifies HMAC-tagged events; see WithHMACChaining.
+	// It is never marshaled.
+	hmacKey []byte
+}
+
+type keyRangeJSON struct {
+	PublicKey   []byte `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+	First       uint64 `json:"first"`
+	Last        uint64 `json:"last,omitempty"`
+	Current     bool   `json:"current,omitempty"`
+}
+
+// MarshalJSON encodes the range with its public key in DER-encoded
+// PKIX format, along with the key's fingerprint.
+func (kr KeyRange) MarshalJSON() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(kr.Public)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(keyRangeJSON{
+		PublicKey:   der,
+		Fingerprint: hex.EncodeToString(publicFingerprint(kr.Public)),
+		First:       kr.First,
+		Last:        kr.Last,
+		Current:     kr.Current,
+	})
+}
+
+// UnmarshalJSON decodes a range encoded by MarshalJSON. The
+// fingerprint is only there for people reading the manifest, and is
+// ignored.
+func (kr *KeyRange) UnmarshalJSON(in []byte) error {
+	var kj keyRangeJSON
+	if err := json.Unmarshal(in, &kj); err != nil {
+		return err
+	}
+
+	pub, err := ParsePublicKey(kj.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	*kr = KeyRange{Public: pub, First: kj.First, Last: kj.Last, Current: kj.Current}
+	return nil
+}
+
+// A KeyManifest is the history of the keys that have signed a chain,
+// oldest first, as returned by KeyHistory. It can be handed to a
+// verifier in place of a single public key; see VerifyKeys.
+type KeyManifest []KeyRange
+
+// Key returns the key that signed the event with the given serial
+// number, or nil if no key in the manifest covers it.
+func (m KeyManifest) Key(serial uint64) *ecdsa.PublicKey {
+	for _, kr := range m {
+		if serial >= kr.First && (kr.Current || serial <= kr.Last) {
+			return kr.Public
+		}
+	}
+	return nil
+}
+
+// startingAt returns the key whose range begins at serial, or nil if
+// no range after the first does.
+func (m KeyManifest) startingAt(serial uint64) *ecdsa.PublicKey {
+	for i, kr := range m {
+		if i > 0 && kr.First == serial {
+			return kr.Public
+		}
+	}
+	return nil
+}
+
+// verify verifies an event with the key that signed it, where prev is
+// the signature of the event before it. The last event signed by each
+// key but the current one must be the signed "key rotated" event
+// announcing its successor, and no other event may announce one. A
+// hash-linked event is only checked against prev: the caller must also
+// check, with a sealCheck, that the batch signature covering it follows.
+func (m KeyManifest) verify(ev *Event, prev []byte) bool {
+	pub := m.Key(ev.Serial)
+	if pub == nil {
+		return false
+	}
+
+	if ev.hmacTagged() {
+		if len(m[0].hmacKey) == 0 || !ev.VerifyHMAC(m[0].hmacKey, prev) {
+			return false
+		}
+	} else if !ev.Signed() {
+		if !ev.linked(prev) {
+			return false
+		}
+	} else if !ev.Verify(pub, prev) {
+		return false
+	}
+
+	next := m.startingAt(ev.Serial + 1)
+	if ev.Actor != internalActor || ev.Event != EventKeyRotated {
+		return next == nil
+	}
+
+	if next == nil || !ev.Signed() || ev.hmacTagged() {
+		return false
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(next)
+	if err != nil {
+		return false
+	}
+
+	announced, _ := ev.attr("public_key")
+	return announced == base64.StdEncoding.EncodeToString(der)
+}
+
+// check reports whether the manifest is well formed: it must begin
+// with the first event, its ranges must follow on from one another,
+// and only the last may be current.
+func (m KeyManifest) check() error {
+	if len(m) == 0 {
+		return errors.New("auditlog: the key manifest is empty")
+	}
+
+	for i, kr := range m {
+		if kr.Public == nil {
+			return errors.New("auditlog: the key manifest is missing a key")
+		}
+
+		switch {
+		case i == 0 && kr.First != 0:
+			return errors.New("auditlog: the key manifest doesn't begin with the first event")
+		case i > 0 && kr.First <= m[i-1].First:
+			return errors.New("auditlog: the key manifest is out of order")
+		case i > 0 && kr.First != m[i-1].Last+1:
+			return fmt.Errorf("auditlog: the key manifest has a gap before event %d", kr.First)
+		case kr.Current != (i == len(m)-1):
+			return errors.New("auditlog: only the last key in the manifest may be current")
+		case !kr.Current && kr.Last < kr.First:
+			return fmt.Errorf("auditlog: the key manifest has an empty range at event %d", kr.First)
+		}
+	}
+	return nil
+}
+
+// LoadKeyManifest reads a key manifest written as JSON, as by the
+// auditlog keys command.
+func LoadKeyManifest(path string) (KeyManifest, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m KeyManifest
+	if err = json.Unmarshal(in, &m); err != nil {
+		return nil, err
+	}
+
+	if err = m.check(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// singleKey returns the manifest of a chain that has only been signed
+// by pub.
+func singleKey(pub *ecdsa.PublicKey) KeyManifest {
+	return KeyManifest{{Public: pub, Current: true}}
+}
+
+// A KeyRecord is a key history entry as a store keeps it: the serial
+// number of the first event signed with the key, and the key in
+// DER-encoded PKIX format.
+type KeyRecord struct {
+	First     uint64 `json:"first"`
+	PublicKey []byte `json:"public_key"`
+}
+
+// A KeyRecorder is a Store that keeps the history of the keys that
+// have signed its chain, so that the chain can still be verified
+// after the signing key is rotated.
+type KeyRecorder interface {
+	// StoreKey records a key. Recording a key whose first serial
+	// number has already been recorded has no effect, so that
+	// loggers sharing a store may each record the same key.
+	StoreKey(rec KeyRecord) error
+
+	// Keys returns the recorded keys, in order of their first
+	// serial numbers.
+	Keys() ([]KeyRecord, error)
+}
+
+// manifestFrom builds the manifest described by the key records.
+func manifestFrom(recs []KeyRecord) (KeyManifest, error) {
+	var m KeyManifest
+	for i, rec := range recs {
+		pub, err := ParsePublicKey(rec.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			m[i-1].Current = false
+			m[i-1].Last = rec.First - 1
+		}
+		m = append(m, KeyRange{Public: pub, First: rec.First, Current: true})
+	}
+
+	if err := m.check(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// records returns the key records describing the manifest.
+func (m KeyManifest) records() ([]KeyRecord, error) {
+	recs := make([]KeyRecord, 0, len(m))
+	for _, kr := range m {
+		der, err := x509.MarshalPKIXPublicKey(kr.Public)
+		if err != nil {
+			return nil, err
+		}
+		recs = append(recs, KeyRecord{First: kr.First, PublicKey: der})
+	}
+	return recs, nil
+}
+
+// loadKeys loads the chain's key history from the store; the last key
+// must be the signer's. A store that doesn't keep a history, or
+// hasn't recorded one yet, holds a chain signed only by the signer's
+// key; the key is recorded when the logger starts, so that Restore
+// can first replace it with the history of the chain it restores.
+func (l *Logger) loadKeys() error {
+	l.keys, l.keysPending = singleKey(l.public), false
+
+	kr, ok := l.store.(KeyRecorder)
+	if !ok {
+		return nil
+	}
+
+	recs, err := kr.Keys()
+	if err != nil {
+		return err
+	}
+
+	if len(recs) == 0 {
+		l.keysPending = true
+		return nil
+	}
+
+	keys, err := manifestFrom(recs)
+	if err != nil {
+		return err
+	}
+
+	if !keys[len(keys)-1].Public.Equal(l.public) {
+		return errors.New("auditlog: the chain's current signing key isn't the signer's; see RotateKey")
+	}
+	l.keys = keys
+	return nil
+}
+
+// storeKeys records the key history in a store that hasn't recorded
+// one yet; the caller must hold the logger's lock.
+func (l *Logger) storeKeys() error {
+	kr, ok := l.store.(KeyRecorder)
+	if !l.keysPending || !ok {
+		return nil
+	}
+
+	recs, err := l.keys.records()
+	if err != nil {
+		return err
+	}
+
+	for _, rec := range recs {
+		if err = kr.StoreKey(rec); err != nil {
+			return err
+		}
+	}
+	l.keysPending = false
+	return nil
+}
+
+// signingKeys returns the signer, its public key, and the key history
+// as they stand; RotateKey changes them under the lock.
+func (l *Logger) signingKeys() (crypto.Signer, *ecdsa.PublicKey, KeyManifest) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.signer, l.public, l.keys.withHMAC(l.hmacKey)
+}
+
+// KeyHistory returns the keys that have signed the chain, oldest
+// first, with the serial numbers of the events each one signed. It
+// can be written out as JSON and handed to verifiers in place of the
+// public key; see VerifyKeys and LoadKeyManifest.
+func (l *Logger) KeyHistory() KeyManifest {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	keys := make(KeyManifest, len(l.keys))
+	copy(keys, l.keys)
+	return keys
+}
+
+// RotateKey begins signing the chain with signer, which must hold a
+// different ECDSA key. A signed "key rotated" event carrying the new
+// public key is recorded with the outgoing key, so that the change is
+// covered by the chain, and the new key is added to the store's key
+// history; every later event is signed with the new key. Unlike
+// Rotate, the chain carries on in the same store.
+//
+// If the new key can't be recorded in the store, the logger still
+// signs with it, as the chain has already announced it, and the error
+// is returned: the chain can't be verified from the store alone until
+// the key is recorded.
+func (l *Logger) RotateKey(signer crypto.Signer) error {
+	pub, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("auditlog: the signer doesn't hold an ECDSA key")
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.closed {
+		return errors.New("auditlog: logger has been stopped")
+	}
+
+	// Without a history, the chain couldn't be verified once the
+	// logger restarts with the new key.
+	kr, ok := l.store.(KeyRecorder)
+	if !ok {
+		return errors.New("auditlog: the store cannot record a key history")
+	}
+
+	if pub.Equal(l.public) {
+		return errors.New("auditlog: the chain is already signed with this key")
+	}
+
+	if l.buffering() {
+		return errors.New("auditlog: cannot rotate the signing key while events are buffered")
+	}
+
+	// Events waiting to be committed are signed with the outgoing
+	// key, and the rotation itself isn't grouped.
+	l.commitGroup()
+	grouping := l.grouping
+	l.grouping = false
+	defer func() { l.grouping = grouping }()
+
+	// The outgoing key signs its last batch, so that no batch
+	// spans two keys.
+	l.sealBatch()
+	ev := &Event{
+		When:  l.now(),
+		Level: levelStrings[levelInfo],
+		Actor: internalActor,
+		Event: EventKeyRotated,
+		Attributes: []Attribute{
+			{"public_key", base64.StdEncoding.EncodeToString(der)},
+			{"fingerprint", hex.EncodeToString(publicFingerprint(pub))},
+		},
+		sign: true,
+	}
+
+	if err = l.record(ev); err != nil {
+		return err
+	}
+
+	// The manifest is replaced rather than extended, as KeyHistory
+	// may have handed out the old one.
+	keys := make(KeyManifest, len(l.keys), len(l.keys)+1)
+	copy(keys, l.keys)
+	keys[len(keys)-1].Current = false
+	keys[len(keys)-1].Last = ev.Serial
+	l.keys = append(keys, KeyRange{Public: pub, First: ev.Serial + 1, Current: true})
+	l.signer, l.public = signer, pub
+
+	// A history that hasn't been recorded yet is recorded in full
+	// when the logger starts.
+	if l.keysPending {
+		return nil
+	}
+
+	err = kr.StoreKey(KeyRecord{First: ev.Serial + 1, PublicKey: der})
+	if err != nil {
+		return fmt.Errorf("auditlog: key rotated at event %d, but not recorded: %w", ev.Serial, err)
+	}
+	return nil
+}
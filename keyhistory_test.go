@@ -0,0 +1,201 @@
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateKey(t *testing.T) {
+	signers := []*ecdsa.PrivateKey{testKey(t, "first"), testKey(t, "second"), testKey(t, "third")}
+
+	stores := map[string]func() Store{
+		"memory": func() Store { return NewMemoryStore() },
+		"file": func() Store {
+			s, err := NewFileStore(filepath.Join(t.TempDir(), "audit.log"))
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			return s
+		},
+		"sqlite": func() Store {
+			s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "audit.db"))
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		store := newStore()
+		l, err := NewWithStore(store, signers[0], WithoutEcho())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		l.Start()
+
+		for _, next := range signers[1:] {
+			l.InfoSync("keyhistory_test", "event", nil)
+			if err = l.RotateKey(next); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		l.InfoSync("keyhistory_test", "event", nil)
+
+		if err = l.RotateKey(signers[2]); err == nil {
+			t.Fatalf("%s: rotated to the key already in use", name)
+		}
+
+		keys := l.KeyHistory()
+		if len(keys) != 3 || keys[0].First != 0 || keys[0].Last != 1 || keys[1].First != 2 ||
+			keys[1].Last != 3 || keys[2].First != 4 || !keys[2].Current {
+			t.Fatalf("%s: unexpected key history %+v", name, keys)
+		}
+
+		for serial, key := range []int{0, 0, 1, 1, 2} {
+			if !keys.Key(uint64(serial)).Equal(&signers[key].PublicKey) {
+				t.Fatalf("%s: event %d should have been signed with key %d", name, serial, key)
+			}
+		}
+
+		cert, err := l.Certify(0, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		l.Stop()
+
+		// The manifest survives being written out and read back.
+		out, err := json.Marshal(keys)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		var manifest KeyManifest
+		if err = json.Unmarshal(out, &manifest); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if _, ok := VerifyCertification(cert, nil, VerifyKeys(manifest)); !ok {
+			t.Fatalf("%s: rotated chain failed to verify with its key history", name)
+		}
+
+		if _, ok := VerifyCertification(cert, &signers[2].PublicKey); ok {
+			t.Fatalf("%s: rotated chain verified with only the current key", name)
+		}
+
+		// A manifest that hides a rotation doesn't verify.
+		hidden := KeyManifest{manifest[0], manifest[2]}
+		hidden[0].Last = manifest[1].Last
+		if _, ok := VerifyCertification(cert, nil, VerifyKeys(hidden)); ok {
+			t.Fatalf("%s: chain verified with a manifest missing a key", name)
+		}
+
+		// The history is kept by the store, so a logger restarted
+		// with the current key verifies the whole chain, and one
+		// restarted with an old key is refused.
+		if ro, ok := store.(Reopener); ok {
+			ro.Reopen()
+		}
+
+		if _, err = NewWithStore(store, signers[1], WithoutEcho()); err == nil {
+			t.Fatalf("%s: logger started with a retired key", name)
+		}
+
+		l, err = NewWithStore(store, signers[2], WithoutEcho())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if history := l.KeyHistory(); len(history) != 3 {
+			t.Fatalf("%s: expected 3 keys in the reloaded history, have %d", name, len(history))
+		}
+		l.Stop()
+	}
+}
+
+func TestRotateKeyBatched(t *testing.T) {
+	old := testKey(t, "old")
+	next := testKey(t, "next")
+
+	store := NewMemoryStore()
+	l, err := NewWithStore(store, old, WithoutEcho(),
+		WithBatchSigning(BatchPolicy{MaxEvents: 100, Interval: time.Hour}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+
+	for i := 0; i < 5; i++ {
+		l.InfoSync("keyhistory_test", "event", nil)
+	}
+
+	if err = l.RotateKey(next); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		l.InfoSync("keyhistory_test", "event", nil)
+	}
+	l.Stop()
+
+	// The outgoing key's last batch is signed before the rotation.
+	keys := l.KeyHistory()
+	last, err := store.Event(keys[0].Last - 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !last.Signed() {
+		t.Fatal("the outgoing key's last batch wasn't signed")
+	}
+
+	if _, err = NewWithStore(store, next, WithoutEcho()); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+func TestRestoreRotatedKey(t *testing.T) {
+	old := testKey(t, "old")
+	next := testKey(t, "next")
+
+	l, err := NewWithStore(NewMemoryStore(), old, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("keyhistory_test", "event", nil)
+	if err = l.RotateKey(next); err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.InfoSync("keyhistory_test", "event", nil)
+
+	var snapshot bytes.Buffer
+	if err = l.Backup(context.Background(), &snapshot); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	store := NewMemoryStore()
+	r, err := NewWithStore(store, next, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = r.Restore(context.Background(), &snapshot); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if keys, _ := store.Keys(); len(keys) != 2 {
+		t.Fatalf("expected the restored store to record 2 keys, have %d", len(keys))
+	}
+
+	if _, err = NewWithStore(store, next, WithoutEcho()); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package auditlog
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Object identifiers for PKCS#8 encryption with PBES2 (RFC 8018),
+// using PBKDF2 with HMAC-SHA256 and AES-256-CBC, as OpenSSL does by
+// default.
+var (
+	oidPBES2      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC  = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// pbkdf2Iterations is the PBKDF2 work factor for encrypted keys.
+const pbkdf2Iterations = 600000
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Data      []byte
+}
+
+type pbes2Params struct {
+	KDF    pkix.AlgorithmIdentifier
+	Cipher pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier
+}
+
+// ErrKeyEncrypted is returned by LoadSigner when the key is encrypted
+// and must be loaded with LoadEncryptedSigner.
+var ErrKeyEncrypted = errors.New("auditlog: signing key is encrypted")
+
+// pbkdf2 derives a key from a passphrase as described in RFC 8018,
+// using HMAC-SHA256.
+func pbkdf2(passphrase, salt []byte, iterations, length int) []byte {
+	prf := hmac.New(sha256.New, passphrase)
+	var key []byte
+	for block := uint32(1); len(key) < length; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:length]
+}
+
+// MarshalSigner encodes a signing key as a PEM-encoded PKCS#8 "PRIVATE
+// KEY" block. If passphrase isn't empty, the key is encrypted with it
+// and encoded as an "ENCRYPTED PRIVATE KEY" block, which OpenSSL can
+// also read.
+func MarshalSigner(signer *ecdsa.PrivateKey, passphrase []byte) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passphrase) == 0 {
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+	}
+
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	if _, err = io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2(passphrase, salt, pbkdf2Iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(der, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	kdf, err := asn1.Marshal(pbkdf2Params{
+		Salt:       salt,
+		Iterations: pbkdf2Iterations,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := asn1.Marshal(pbes2Params{
+		KDF:    pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdf}},
+		Cipher: pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	der, err = asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: params}},
+		Data:      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: der}), nil
+}
+
+// decryptPKCS8 decrypts an encrypted PKCS#8 key, returning the DER
+// encoding of the key. Only PBES2 with PBKDF2, HMAC-SHA256, and
+// AES-256-CBC is supported.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	unsupported := errors.New("auditlog: unsupported key encryption")
+
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+
+	var params pbes2Params
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, unsupported
+	}
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+
+	var kdf pbkdf2Params
+	if !params.KDF.Algorithm.Equal(oidPBKDF2) || !params.Cipher.Algorithm.Equal(oidAES256CBC) {
+		return nil, unsupported
+	}
+	if _, err := asn1.Unmarshal(params.KDF.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+
+	if !kdf.PRF.Algorithm.Equal(oidHMACSHA256) || (kdf.KeyLength != 0 && kdf.KeyLength != 32) {
+		return nil, unsupported
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.Cipher.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	data := info.Data
+	if len(iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, unsupported
+	}
+
+	block, err := aes.NewCipher(pbkdf2(passphrase, kdf.Salt, kdf.Iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	// A wrong passphrase almost always leaves invalid padding.
+	wrong := errors.New("auditlog: incorrect passphrase for signing key")
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, wrong
+	}
+	for _, b := range out[len(out)-pad:] {
+		if int(b) != pad {
+			return nil, wrong
+		}
+	}
+	return out[:len(out)-pad], nil
+}
+
+// LoadEncryptedSigner reads a PEM-encoded ECDSA private key from a
+// file as LoadSigner does, decrypting it with passphrase if it is an
+// encrypted PKCS#8 key.
+func LoadEncryptedSigner(path string, passphrase []byte) (*ecdsa.PrivateKey, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, _ := pem.Decode(in)
+	if p == nil || p.Type != "ENCRYPTED PRIVATE KEY" {
+		return LoadSigner(path)
+	}
+
+	der, err := decryptPKCS8(p.Bytes, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, errors.New("auditlog: incorrect passphrase for signing key")
+	}
+
+	signer, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("auditlog: signing key is not an ECDSA key")
+	}
+	return signer, nil
+}
+
+// loadPassphrase reads a passphrase from a file, dropping the
+// trailing newline.
+func loadPassphrase(path string) ([]byte, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(string(in), "\r\n")), nil
+}
+
+// MarshalPublicKey encodes a logger's public key as a PEM-encoded
+// "EC PUBLIC KEY" block, the format read by LoadPublicKey.
+func MarshalPublicKey(pub *ecdsa.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PUBLIC KEY", Bytes: der}), nil
+}
@@ -0,0 +1,57 @@
+package auditlog
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptedSigner(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	dir := t.TempDir()
+	for _, passphrase := range []string{"", "correct horse battery staple"} {
+		out, err := MarshalSigner(signer, []byte(passphrase))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		path := filepath.Join(dir, "signer.pem")
+		if err = ioutil.WriteFile(path, out, 0600); err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if passphrase != "" {
+			if _, err = LoadSigner(path); err != ErrKeyEncrypted {
+				t.Fatalf("expected LoadSigner to refuse an encrypted key, have %v", err)
+			}
+
+			if _, err = LoadEncryptedSigner(path, []byte("wrong")); err == nil {
+				t.Fatal("expected a wrong passphrase to be rejected")
+			}
+		}
+
+		loaded, err := LoadEncryptedSigner(path, []byte(passphrase))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if !loaded.Equal(signer) {
+			t.Fatal("loaded key doesn't match the generated key")
+		}
+	}
+
+	pub, err := MarshalPublicKey(&signer.PublicKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	parsed, err := ParsePublicKey(pub)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !parsed.Equal(&signer.PublicKey) {
+		t.Fatal("parsed public key doesn't match")
+	}
+}
@@ -0,0 +1,69 @@
+// Package awskms signs the audit chain with an asymmetric key held by
+// AWS KMS. The key must have the ECC_NIST_P256 key spec and the
+// SIGN_VERIFY usage.
+package awskms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"errors"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+
+	auditkms "github.com/kisom/auditlog/kms"
+)
+
+// Service names AWS KMS in errors.
+const Service = "AWS KMS"
+
+// Client is the part of the AWS KMS API the signer uses; *kms.Client
+// implements it.
+type Client interface {
+	GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+	Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+// New fetches the public key for keyID, which may be a key ID, a key
+// ARN, or an alias, and returns a signer for it.
+func New(ctx context.Context, client Client, keyID string, opts auditkms.Options) (*auditkms.Signer, error) {
+	out, err := client.GetPublicKey(ctx, &kms.GetPublicKeyInput{KeyId: aws.String(keyID)})
+	if err != nil {
+		return nil, &auditkms.Error{Service: Service, Key: keyID, Err: err}
+	}
+
+	switch {
+	case out.KeySpec != types.KeySpecEccNistP256:
+		err = errors.New("key spec is " + string(out.KeySpec) + ", not ECC_NIST_P256")
+	case out.KeyUsage != types.KeyUsageTypeSignVerify:
+		err = errors.New("key usage is " + string(out.KeyUsage) + ", not SIGN_VERIFY")
+	case !slices.Contains(out.SigningAlgorithms, types.SigningAlgorithmSpecEcdsaSha256):
+		err = errors.New("key can't sign with ECDSA_SHA_256")
+	}
+	if err != nil {
+		return nil, &auditkms.Error{Service: Service, Key: keyID, Err: err}
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(out.PublicKey)
+	if err != nil {
+		return nil, &auditkms.Error{Service: Service, Key: keyID, Err: err}
+	}
+
+	public, _ := pub.(*ecdsa.PublicKey)
+	sign := func(ctx context.Context, digest []byte) ([]byte, error) {
+		out, err := client.Sign(ctx, &kms.SignInput{
+			KeyId:            aws.String(keyID),
+			Message:          digest,
+			MessageType:      types.MessageTypeDigest,
+			SigningAlgorithm: types.SigningAlgorithmSpecEcdsaSha256,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return out.Signature, nil
+	}
+	return auditkms.NewSigner(Service, keyID, public, sign, opts)
+}
@@ -0,0 +1,74 @@
+package awskms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+
+	auditkms "github.com/kisom/auditlog/kms"
+)
+
+// fakeClient signs with a key in memory, as AWS KMS would.
+type fakeClient struct {
+	key  *ecdsa.PrivateKey
+	spec types.KeySpec
+}
+
+func (fc *fakeClient) GetPublicKey(ctx context.Context, params *kms.GetPublicKeyInput, optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error) {
+	der, err := x509.MarshalPKIXPublicKey(&fc.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kms.GetPublicKeyOutput{
+		KeyId:             params.KeyId,
+		KeySpec:           fc.spec,
+		KeyUsage:          types.KeyUsageTypeSignVerify,
+		PublicKey:         der,
+		SigningAlgorithms: []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecEcdsaSha256},
+	}, nil
+}
+
+func (fc *fakeClient) Sign(ctx context.Context, params *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error) {
+	sig, err := ecdsa.SignASN1(rand.Reader, fc.key, params.Message)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.SignOutput{KeyId: params.KeyId, Signature: sig, SigningAlgorithm: params.SigningAlgorithm}, nil
+}
+
+func TestSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	fc := &fakeClient{key: key, spec: types.KeySpecEccNistP256}
+	s, err := New(context.Background(), fc, "alias/audit", auditkms.Options{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	digest := sha256.Sum256([]byte("event"))
+	sig, err := s.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		t.Fatal("signature failed to verify")
+	}
+
+	fc.spec = types.KeySpecEccNistP384
+	if _, err = New(context.Background(), fc, "alias/audit", auditkms.Options{}); err == nil {
+		t.Fatal("expected a P-384 key to be refused")
+	}
+}
@@ -0,0 +1,91 @@
+// Package azurekv signs the audit chain with a key held by Azure Key
+// Vault or Managed HSM. The key must be an EC or EC-HSM key on P-256.
+package azurekv
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+
+	auditkms "github.com/kisom/auditlog/kms"
+)
+
+// Service names Key Vault in errors.
+const Service = "Key Vault"
+
+// Client is the part of the Key Vault API the signer uses;
+// *azkeys.Client implements it.
+type Client interface {
+	GetKey(ctx context.Context, name string, version string, options *azkeys.GetKeyOptions) (azkeys.GetKeyResponse, error)
+	Sign(ctx context.Context, name string, version string, parameters azkeys.SignParameters, options *azkeys.SignOptions) (azkeys.SignResponse, error)
+}
+
+// New fetches the public key for the named key and returns a signer
+// for it. If version is empty, the key's current version is used, and
+// kept: the signer goes on signing with that version if the key is
+// rotated.
+func New(ctx context.Context, client Client, name, version string, opts auditkms.Options) (*auditkms.Signer, error) {
+	resp, err := client.GetKey(ctx, name, version, nil)
+	if err != nil {
+		return nil, &auditkms.Error{Service: Service, Key: name, Err: err}
+	}
+
+	key := resp.Key
+	switch {
+	case key == nil || key.Kty == nil || key.Crv == nil:
+		err = errors.New("key has no type or curve")
+	case *key.Kty != azkeys.KeyTypeEC && *key.Kty != azkeys.KeyTypeECHSM:
+		err = errors.New("key type is " + string(*key.Kty) + ", not EC")
+	case *key.Crv != azkeys.CurveNameP256:
+		err = errors.New("key curve is " + string(*key.Crv) + ", not P-256")
+	}
+	if err != nil {
+		return nil, &auditkms.Error{Service: Service, Key: name, Err: err}
+	}
+
+	if version == "" && key.KID != nil {
+		version = key.KID.Version()
+	}
+
+	point := append([]byte{4}, key.X...)
+	public, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(point, key.Y...))
+	if err != nil {
+		return nil, &auditkms.Error{Service: Service, Key: name, Err: err}
+	}
+
+	alg := azkeys.SignatureAlgorithmES256
+	sign := func(ctx context.Context, digest []byte) ([]byte, error) {
+		resp, err := client.Sign(ctx, name, version, azkeys.SignParameters{
+			Algorithm: &alg,
+			Value:     digest,
+		}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return rawToDER(resp.Result)
+	}
+
+	id := name
+	if version != "" {
+		id += "/" + version
+	}
+	return auditkms.NewSigner(Service, id, public, sign, opts)
+}
+
+// rawToDER converts a JWS signature, the concatenated R and S, to the
+// ASN.1 DER encoding crypto/ecdsa uses.
+func rawToDER(raw []byte) ([]byte, error) {
+	if len(raw) != 64 {
+		return nil, errors.New("signature isn't 64 bytes")
+	}
+
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(raw[:32]),
+		S: new(big.Int).SetBytes(raw[32:]),
+	})
+}
@@ -0,0 +1,75 @@
+package azurekv
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
+
+	auditkms "github.com/kisom/auditlog/kms"
+)
+
+// fakeClient signs with a key in memory, as Key Vault would,
+// recording the version each signature was asked of.
+type fakeClient struct {
+	key     *ecdsa.PrivateKey
+	version string
+}
+
+func (fc *fakeClient) GetKey(ctx context.Context, name string, version string, options *azkeys.GetKeyOptions) (azkeys.GetKeyResponse, error) {
+	kty, crv := azkeys.KeyTypeECHSM, azkeys.CurveNameP256
+	kid := azkeys.ID("https://vault.vault.azure.net/keys/" + name + "/0123456789abcdef")
+	point, err := fc.key.PublicKey.Bytes()
+	if err != nil {
+		return azkeys.GetKeyResponse{}, err
+	}
+
+	var resp azkeys.GetKeyResponse
+	resp.Key = &azkeys.JSONWebKey{KID: &kid, Kty: &kty, Crv: &crv, X: point[1:33], Y: point[33:]}
+	return resp, nil
+}
+
+func (fc *fakeClient) Sign(ctx context.Context, name string, version string, parameters azkeys.SignParameters, options *azkeys.SignOptions) (azkeys.SignResponse, error) {
+	fc.version = version
+	r, s, err := ecdsa.Sign(rand.Reader, fc.key, parameters.Value)
+	if err != nil {
+		return azkeys.SignResponse{}, err
+	}
+
+	var resp azkeys.SignResponse
+	resp.Result = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return resp, nil
+}
+
+func TestSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	fc := &fakeClient{key: key}
+	s, err := New(context.Background(), fc, "audit", "", auditkms.Options{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	digest := sha256.Sum256([]byte("event"))
+	sig, err := s.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		t.Fatal("signature failed to verify")
+	}
+
+	// The key's current version is pinned when the signer is built.
+	if fc.version != "0123456789abcdef" {
+		t.Fatalf("expected the signature to use the key's current version, have %q", fc.version)
+	}
+}
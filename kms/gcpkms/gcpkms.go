@@ -0,0 +1,89 @@
+// Package gcpkms signs the audit chain with an asymmetric key version
+// held by Google Cloud KMS. The key version must use the
+// EC_SIGN_P256_SHA256 algorithm.
+package gcpkms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"hash/crc32"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	auditkms "github.com/kisom/auditlog/kms"
+)
+
+// Service names Cloud KMS in errors.
+const Service = "Cloud KMS"
+
+// Client is the part of the Cloud KMS API the signer uses;
+// *kms.KeyManagementClient implements it.
+type Client interface {
+	GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest, opts ...gax.CallOption) (*kmspb.PublicKey, error)
+	AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest, opts ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error)
+}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func checksum(b []byte) int64 {
+	return int64(crc32.Checksum(b, crcTable))
+}
+
+// errCorrupted is returned when a response's checksum doesn't match,
+// as Cloud KMS asks clients to check.
+var errCorrupted = errors.New("response was corrupted in transit")
+
+// New fetches the public key for keyVersion, the full resource name of
+// a key version (projects/.../cryptoKeyVersions/N), and returns a
+// signer for it. A key version, rather than a key, is named so that
+// rotating the key doesn't change the key signing the chain.
+func New(ctx context.Context, client Client, keyVersion string, opts auditkms.Options) (*auditkms.Signer, error) {
+	pk, err := client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: keyVersion})
+	if err != nil {
+		return nil, &auditkms.Error{Service: Service, Key: keyVersion, Err: err}
+	}
+
+	if pk.PemCrc32C != nil && checksum([]byte(pk.Pem)) != pk.PemCrc32C.Value {
+		return nil, &auditkms.Error{Service: Service, Key: keyVersion, Err: errCorrupted}
+	}
+
+	if pk.Algorithm != kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256 {
+		err = errors.New("key algorithm is " + pk.Algorithm.String() + ", not EC_SIGN_P256_SHA256")
+		return nil, &auditkms.Error{Service: Service, Key: keyVersion, Err: err}
+	}
+
+	block, _ := pem.Decode([]byte(pk.Pem))
+	if block == nil {
+		err = errors.New("public key isn't PEM-encoded")
+		return nil, &auditkms.Error{Service: Service, Key: keyVersion, Err: err}
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, &auditkms.Error{Service: Service, Key: keyVersion, Err: err}
+	}
+
+	public, _ := pub.(*ecdsa.PublicKey)
+	sign := func(ctx context.Context, digest []byte) ([]byte, error) {
+		resp, err := client.AsymmetricSign(ctx, &kmspb.AsymmetricSignRequest{
+			Name:         keyVersion,
+			Digest:       &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest}},
+			DigestCrc32C: wrapperspb.Int64(checksum(digest)),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if !resp.VerifiedDigestCrc32C || resp.Name != keyVersion ||
+			resp.SignatureCrc32C == nil || checksum(resp.Signature) != resp.SignatureCrc32C.Value {
+			return nil, errCorrupted
+		}
+		return resp.Signature, nil
+	}
+	return auditkms.NewSigner(Service, keyVersion, public, sign, opts)
+}
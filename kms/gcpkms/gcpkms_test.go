@@ -0,0 +1,91 @@
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	auditkms "github.com/kisom/auditlog/kms"
+)
+
+const keyVersion = "projects/p/locations/global/keyRings/r/cryptoKeys/audit/cryptoKeyVersions/1"
+
+// fakeClient signs with a key in memory, as Cloud KMS would; corrupt
+// flips a bit in each signature after its checksum is computed.
+type fakeClient struct {
+	key     *ecdsa.PrivateKey
+	corrupt bool
+}
+
+func (fc *fakeClient) GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest, opts ...gax.CallOption) (*kmspb.PublicKey, error) {
+	der, err := x509.MarshalPKIXPublicKey(&fc.key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	return &kmspb.PublicKey{
+		Name:      req.Name,
+		Pem:       pub,
+		PemCrc32C: wrapperspb.Int64(checksum([]byte(pub))),
+		Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+	}, nil
+}
+
+func (fc *fakeClient) AsymmetricSign(ctx context.Context, req *kmspb.AsymmetricSignRequest, opts ...gax.CallOption) (*kmspb.AsymmetricSignResponse, error) {
+	digest := req.Digest.GetSha256()
+	sig, err := ecdsa.SignASN1(rand.Reader, fc.key, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &kmspb.AsymmetricSignResponse{
+		Name:                 req.Name,
+		Signature:            sig,
+		SignatureCrc32C:      wrapperspb.Int64(checksum(sig)),
+		VerifiedDigestCrc32C: req.DigestCrc32C.GetValue() == checksum(digest),
+	}
+
+	if fc.corrupt {
+		resp.Signature[len(sig)-1] ^= 1
+	}
+	return resp, nil
+}
+
+func TestSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	fc := &fakeClient{key: key}
+	s, err := New(context.Background(), fc, keyVersion, auditkms.Options{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	digest := sha256.Sum256([]byte("event"))
+	sig, err := s.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		t.Fatal("signature failed to verify")
+	}
+
+	fc.corrupt = true
+	if _, err = s.Sign(nil, digest[:], crypto.SHA256); err == nil {
+		t.Fatal("expected a corrupted signature to be refused")
+	}
+}
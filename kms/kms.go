@@ -0,0 +1,127 @@
+// Package kms adapts signing keys held by cloud key management
+// services to crypto.Signer, so that the audit chain can be signed by
+// a managed key passed to auditlog.NewWithSigner. The adapters for
+// each service are in its subpackage: awskms for AWS KMS, gcpkms for
+// Google Cloud KMS, and azurekv for Azure Key Vault.
+//
+// Every event the logger records is signed as it is recorded, so a
+// request to the KMS for each one puts its round trip on the logging
+// path. Loggers signing with a KMS should use auditlog.WithBatchSigning,
+// which only signs checkpoints and hash-links the events between
+// them. A signature that fails, or times out, is returned as an
+// *Error, which the logger records as an ErrorEvent.
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DefaultTimeout bounds each signature request when Options.Timeout is
+// zero.
+const DefaultTimeout = 10 * time.Second
+
+// Options tune the requests made to the KMS. Retries are left to the
+// service's SDK, whose client carries its own retry policy.
+type Options struct {
+	// Timeout bounds each signature request, including the SDK's
+	// retries. If it is zero, DefaultTimeout is used.
+	Timeout time.Duration
+}
+
+// An Error is returned when the KMS fails to sign, naming the service
+// and the key so that the ErrorEvent the logger records identifies
+// them.
+type Error struct {
+	Service string
+	Key     string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("auditlog: %s key %s: %v", e.Service, e.Key, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// A SignFunc asks the KMS to sign a SHA-256 digest, returning an
+// ASN.1 DER-encoded ECDSA signature.
+type SignFunc func(ctx context.Context, digest []byte) ([]byte, error)
+
+// A Signer signs with a P-256 key held by a KMS. It is built by the
+// service adapters, but can be built with NewSigner for other
+// services.
+type Signer struct {
+	service string
+	key     string
+	public  *ecdsa.PublicKey
+	sign    SignFunc
+	timeout time.Duration
+}
+
+// errCurve is returned for keys the logger can't use.
+var errCurve = errors.New("auditlog: KMS signing keys must be ECDSA keys on P-256")
+
+// NewSigner builds a Signer for the named key in a KMS, whose public
+// key has already been fetched, signing with sign. The key must be on
+// P-256, as the chain's digests are SHA-256.
+func NewSigner(service, key string, public *ecdsa.PublicKey, sign SignFunc, opts Options) (*Signer, error) {
+	if public == nil || public.Curve != elliptic.P256() {
+		return nil, &Error{Service: service, Key: key, Err: errCurve}
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	return &Signer{
+		service: service,
+		key:     key,
+		public:  public,
+		sign:    sign,
+		timeout: opts.Timeout,
+	}, nil
+}
+
+// Public returns the key's public half, as fetched when the Signer was
+// built.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// Key returns the name of the key in the KMS.
+func (s *Signer) Key() string {
+	return s.key
+}
+
+// Sign asks the KMS to sign digest, which must be a SHA-256 digest.
+// The signature is checked against the public key before it is
+// returned, so that a misconfigured or replaced key is caught at the
+// event it would have signed. The KMS draws its own randomness, so
+// rand is ignored.
+func (s *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts != nil && opts.HashFunc() != crypto.SHA256 || len(digest) != crypto.SHA256.Size() {
+		return nil, &Error{Service: s.service, Key: s.key, Err: errors.New("only SHA-256 digests can be signed")}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	sig, err := s.sign(ctx, digest)
+	if err != nil {
+		return nil, &Error{Service: s.service, Key: s.key, Err: err}
+	}
+
+	if !ecdsa.VerifyASN1(s.public, digest, sig) {
+		return nil, &Error{Service: s.service, Key: s.key, Err: errors.New("signature doesn't match the public key")}
+	}
+	return sig, nil
+}
@@ -0,0 +1,120 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kisom/auditlog"
+)
+
+func softwareSign(key *ecdsa.PrivateKey) SignFunc {
+	return func(ctx context.Context, digest []byte) ([]byte, error) {
+		return ecdsa.SignASN1(rand.Reader, key, digest)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	s, err := NewSigner("test KMS", "key-1", &key.PublicKey, softwareSign(key), Options{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	store := auditlog.NewMemoryStore()
+	l, err := auditlog.NewWithSigner(store, s, auditlog.WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	l.InfoSync("kms_test", "event", nil)
+
+	cert, err := l.Certify(0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, ok := auditlog.VerifyCertification(cert, &key.PublicKey); !ok {
+		t.Fatal("certification failed to verify")
+	}
+
+	// A failed signature is recorded as an error event naming the
+	// key.
+	s.sign = func(ctx context.Context, digest []byte) ([]byte, error) {
+		return nil, errors.New("throttled")
+	}
+	l.InfoSync("kms_test", "throttled", nil)
+	l.Stop()
+
+	errs, err := store.Errors(0, 10)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(errs) != 1 || !strings.Contains(errs[0].Message, "test KMS key key-1: throttled") {
+		t.Fatalf("expected the KMS failure to be recorded, have %v", errs)
+	}
+}
+
+func TestSignerFailures(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = NewSigner("test KMS", "key-1", &p384.PublicKey, softwareSign(p384), Options{}); err == nil {
+		t.Fatal("expected a P-384 key to be refused")
+	}
+
+	digest := sha256.Sum256([]byte("event"))
+
+	// A key other than the one whose public key was fetched.
+	s, err := NewSigner("test KMS", "key-1", &key.PublicKey, softwareSign(other), Options{})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var kerr *Error
+	if _, err = s.Sign(nil, digest[:], crypto.SHA256); !errors.As(err, &kerr) {
+		t.Fatalf("expected a KMS error, have %v", err)
+	}
+
+	// A request that outlives the timeout.
+	hang := func(ctx context.Context, digest []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	s, err = NewSigner("test KMS", "key-1", &key.PublicKey, hang, Options{Timeout: time.Millisecond})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = s.Sign(nil, digest[:], crypto.SHA256); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the request to time out, have %v", err)
+	}
+
+	if _, err = s.Sign(nil, digest[:16], crypto.SHA256); err == nil {
+		t.Fatal("expected a short digest to be refused")
+	}
+}
@@ -0,0 +1,233 @@
+package auditlog
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/lib/pq"
+)
+
+// ErrLeaseHeld is returned by Start when the logger requires a lease
+// on the chain (see WithLease) and another logger holds it.
+var ErrLeaseHeld = errors.New("auditlog: another logger holds the lease on the chain")
+
+// A Leaser is a Store that can grant one logger at a time the right
+// to write the chain, so that loggers can be run as an active logger
+// with passive standbys.
+type Leaser interface {
+	// AcquireLease takes the lease, returning ErrLeaseHeld if
+	// another logger holds it.
+	AcquireLease() error
+
+	// ReleaseLease gives up the lease, if it is held.
+	ReleaseLease() error
+}
+
+// WithLease requires the logger to hold the store's lease while it
+// runs: Start takes the lease, failing with ErrLeaseHeld if another
+// logger has it, and Stop releases it. A standby can call Start until
+// it succeeds; once it does, it catches up with the events written by
+// the logger it replaces before it records any of its own. The store
+// must be a Leaser.
+//
+// Whether or not a lease is held, a logger that finds another has
+// advanced the chain under it, because the serial number of the event
+// it is storing is already taken, verifies the events written since
+// its own last event and records its event after them. If they don't
+// follow from its last event, the logger fails, as it would on a
+// database error.
+func WithLease() Option {
+	return func(l *Logger) {
+		l.lease = true
+	}
+}
+
+// acquireLease takes the store's lease, if the logger requires one,
+// and catches up with the events written while it didn't hold it.
+func (l *Logger) acquireLease() error {
+	if !l.lease {
+		return nil
+	}
+
+	leaser, ok := l.store.(Leaser)
+	if !ok {
+		return errors.New("auditlog: store doesn't support leases")
+	}
+
+	err := leaser.AcquireLease()
+	if err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	err = l.resync()
+	if err != nil {
+		leaser.ReleaseLease()
+	}
+	return err
+}
+
+// releaseLease gives up the store's lease, if the logger holds one;
+// the caller must hold the lock.
+func (l *Logger) releaseLease() {
+	if leaser, ok := l.store.(Leaser); ok && l.lease {
+		if err := leaser.ReleaseLease(); err != nil {
+			log.Printf("auditlog: failed to release lease: %v", err)
+		}
+	}
+}
+
+// resync brings the logger up to date with events written to the
+// chain by another logger, verifying that they follow from the last
+// event this logger knows of; the caller must hold the lock.
+func (l *Logger) resync() error {
+	count, err := l.store.Count()
+	if err != nil || count == l.counter {
+		return err
+	}
+
+	if count > l.counter {
+		log.Printf("auditlog: chain advanced by another logger from %d to %d events", l.counter, count)
+	}
+
+	if err = l.verifyTail(); err != nil {
+		return err
+	}
+
+	last, err := l.store.Event(l.counter - 1)
+	if err == nil && last.Received > l.lastReceived {
+		l.lastReceived = last.Received
+	} else if err != nil && err != ErrNoEvent {
+		return err
+	}
+	return l.recoverBatch()
+}
+
+// rerecord records events again after storing the first of them
+// failed because another logger had taken its serial number; prev is
+// the signature of the event preceding them, and stored lists the
+// events of the current group stored before them. The caller must
+// hold the lock.
+func (l *Logger) rerecord(stored, rest []*Event, prev []byte) error {
+	l.unwind(stored, rest[0].Serial, prev)
+	follow := func() error {
+		err := l.resync()
+		if err == nil && l.counter <= rest[0].Serial {
+			err = errors.New("auditlog: serial number taken, but the chain hasn't advanced")
+		}
+		return err
+	}
+
+	if err := follow(); err != nil {
+		log.Printf("auditlog: failed to follow the chain written by another logger: %v", err)
+		if err = l.fail(rest, err, follow); err != nil {
+			return err
+		}
+	}
+
+	grouping := l.grouping
+	l.grouping = false
+	defer func() { l.grouping = grouping }()
+
+	for _, ev := range rest {
+		if err := l.record(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unwind returns the chain to the state it was in before the event
+// with the given serial number was recorded; prev is the signature of
+// the event preceding it, and stored the events of the current group
+// stored before it, if any.
+func (l *Logger) unwind(stored []*Event, serial uint64, prev []byte) {
+	l.counter, l.lastSignature = serial, prev
+	if l.batch != nil && l.grouping {
+		*l.batch = l.groupBatch
+		for _, ev := range stored {
+			l.batch.add(ev)
+		}
+	}
+}
+
+// AcquireLease takes the lease.
+func (ms *MemoryStore) AcquireLease() error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.leased {
+		return ErrLeaseHeld
+	}
+	ms.leased = true
+	return nil
+}
+
+// ReleaseLease gives up the lease.
+func (ms *MemoryStore) ReleaseLease() error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	ms.leased = false
+	return nil
+}
+
+// leaseKey is the key of the advisory lock that serves as the lease on
+// a Postgres chain.
+const leaseKey = 0x6175646974 // "audit"
+
+// AcquireLease takes an advisory lock on a connection set aside for
+// it, so that the lease is released if the logger holding it loses
+// its connection to the database.
+func (s *pgStore) AcquireLease() error {
+	if s.lease != nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, leaseKey).Scan(&ok)
+	if err == nil && !ok {
+		err = ErrLeaseHeld
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	s.lease = conn
+	return nil
+}
+
+// ReleaseLease releases the advisory lock.
+func (s *pgStore) ReleaseLease() error {
+	if s.lease == nil {
+		return nil
+	}
+
+	_, err := s.lease.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, leaseKey)
+	cerr := s.lease.Close()
+	s.lease = nil
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// duplicateSerial returns ErrDuplicateSerial if err reports that an
+// event's serial number is already taken, and err otherwise.
+func duplicateSerial(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "events_pkey" {
+		return ErrDuplicateSerial
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package auditlog
+
+import "testing"
+
+func TestConcurrentWriters(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	// With a Batcher, the conflict is found when a group commits.
+	for _, store := range []Store{
+		NewMemoryStore(),
+		&batchingStore{MemoryStore: NewMemoryStore()},
+	} {
+		a, err := NewWithStore(store, signer, WithoutEcho())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		a.Start()
+
+		for i := 0; i < 3; i++ {
+			a.InfoSync("lease_test", "a", nil)
+		}
+
+		b, err := NewWithStore(store, signer, WithoutEcho())
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		b.Start()
+
+		// a advances the chain under b, which must follow it
+		// rather than write a conflicting event.
+		a.InfoSync("lease_test", "a", nil)
+		a.InfoSync("lease_test", "a", nil)
+		b.InfoSync("lease_test", "b", nil)
+		a.InfoSync("lease_test", "a", nil)
+		b.InfoSync("lease_test", "b", nil)
+		a.Stop()
+		b.Stop()
+
+		count, err := store.Count()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if count != 8 {
+			t.Fatalf("expected 8 events in the chain, have %d", count)
+		}
+
+		if _, err = NewWithStore(store, signer, WithoutEcho()); err != nil {
+			t.Fatalf("chain written by two loggers failed to verify: %v", err)
+		}
+	}
+}
+
+func TestLease(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	active, store := newTestLogger(t, WithLease())
+
+	standby, err := NewWithStore(store, signer, WithoutEcho(), WithLease())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = active.Start(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = standby.Start(); err != ErrLeaseHeld {
+		t.Fatalf("expected the standby to find the lease held, have %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		active.InfoSync("lease_test", "active", nil)
+	}
+	active.Stop()
+
+	// The standby takes over, and catches up before recording.
+	if err = standby.Start(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if standby.Count() != 3 {
+		t.Fatalf("expected the standby to catch up to 3 events, have %d", standby.Count())
+	}
+
+	standby.InfoSync("lease_test", "standby", nil)
+	standby.Stop()
+
+	if _, err = NewWithStore(store, signer, WithoutEcho()); err != nil {
+		t.Fatalf("chain failed to verify after failover: %v", err)
+	}
+}
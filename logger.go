@@ -1,38 +1,186 @@
 package auditlog
 
 import (
+	"bytes"
+	"context"
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/rand"
 	"crypto/x509"
-	"database/sql"
-	"encoding/asn1"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math/big"
 	"os"
+	"regexp"
 	"sync"
 	"time"
 )
 
-var prng = rand.Reader
-
 // A Logger is responsible for recording security events.
 type Logger struct {
-	signer        *ecdsa.PrivateKey
+	signer        crypto.Signer
+	public        *ecdsa.PublicKey
+	keys          KeyManifest
+	keysPending   bool
 	stdout        io.Writer
 	stderr        io.Writer
 	lock          sync.Mutex
 	listener      chan *Event
 	lastSignature []byte
 	counter       uint64
-	db            *sql.DB
+	store         Store
+	queueSize     int
+	overflow      OverflowPolicy
+	dropped       dropCount
+	expanded      expansion
+	sinks         []*sink
+	spill         *sink
+	formatter     Formatter
+
+	actors         map[string]bool
+	actorPattern   *regexp.Regexp
+	actorPolicy    ActorPolicy
+	actorPolicySet bool
+	clock          Clock
+
+	// state guards running; the queue may only be sent to by
+	// callers that saw running set and registered with pending.
+	state    sync.RWMutex
+	running  bool
+	stopping bool
+	minLevel int
+	pending  sync.WaitGroup
+	done     chan struct{}
+
+	// closed is set when Stop has closed the store and sinks.
+	closed bool
+
+	sampler    *sampler
+	pruneLock  sync.Mutex
+	holds      holdIndex
+	tees       []func(*Event)
+	shredding  *ShreddingPolicy
+	sensitive  *SensitivePolicy
+	encryption *EncryptionPolicy
+
+	requireWORM     bool
+	requireAccessor bool
+
+	analyzers []Analyzer
+	alertHook func(*Event)
+
+	// subscribers receive each recorded event; see Subscribe.
+	subLock     sync.Mutex
+	subscribers map[*subscriber]bool
+
+	// contextAttrs take attributes from the context given to the
+	// Ctx methods; see WithContextAttributes.
+	contextAttrs []func(context.Context) []Attribute
+
+	// lastReceived is the Received timestamp of the last event,
+	// and lastReceivedTime the clock reading it was taken from.
+	lastReceived     int64
+	lastReceivedTime time.Time
+
+	spool     *spool
+	replaying bool
+	journal   *journal
+	degraded  *degraded
+	batch     *batch
+
+	serials        SerialPolicy
+	lease          bool
+	durability     Durability
+	legacyDigests  bool
+	verifyWorkers  int
+	verifyProgress func(VerifyProgress)
+
+	// fromCheckpoint starts verification at the latest signed
+	// checkpoint in the store; see WithSignedCheckpoints.
+	fromCheckpoint bool
+
+	// trustedHead starts verification after a previously verified
+	// head; see WithTrustedHead.
+	trustedHead *VerifiedHead
+
+	// background verifies the chain once the logger has started,
+	// rather than when it is created; see
+	// WithBackgroundVerification.
+	background *backgroundVerification
+
+	// witnesses cosign each signed checkpoint; see WithWitnesses.
+	witnesses []Witness
+
+	// hmacKey tags events in place of signatures; see
+	// WithHMACChaining.
+	hmacKey []byte
+
+	// failure is the failure policy. failing is set, and failErr,
+	// which is guarded by failLock, holds the error, while events
+	// can't be stored; discarded counts the events the policy has
+	// discarded since they last could be, and discardCause the
+	// error that discarded the first.
+	failure      FailurePolicy
+	failing      bool
+	failLock     sync.Mutex
+	failErr      error
+	discarded    uint64
+	discardCause error
+
+	// While grouping, recorded events are collected in group and
+	// stored in a single transaction; see processGroup.
+	// groupPrev and groupBatch hold the chain's state before the
+	// group, should it have to be unwound.
+	grouping   bool
+	group      []*Event
+	groupPrev  []byte
+	groupBatch batch
+
+	// optErr records the first error from an option that couldn't
+	// be applied; it is returned when the logger is created.
+	optErr error
+
+	skew          SkewStats
+	skewTotal     int64
+	skewLimit     time.Duration
+	skewCompanion bool
+
+	// segment is the segmentation policy; segmentEvents and
+	// segmentBytes measure the current chain against it.
+	segment       *SegmentPolicy
+	segmentEvents uint64
+	segmentBytes  int64
+
+	tasks     []task
+	taskStop  chan struct{}
+	taskGroup sync.WaitGroup
+}
+
+// An Option configures optional behaviour of a Logger.
+type Option func(*Logger)
+
+// setOptErr records an error from an option, keeping the first.
+func (l *Logger) setOptErr(err error) {
+	if l.optErr == nil {
+		l.optErr = err
+	}
+}
+
+// WithClock sets the clock used to timestamp events. By default, the
+// system clock is used.
+func WithClock(clock Clock) Option {
+	return func(l *Logger) {
+		l.clock = clock
+	}
 }
 
 // Public returns the public signature key packed as in DER-encoded
-// PKIX format.
+// PKIX format. Once the key has been rotated, this is the new key; see
+// KeyHistory for the keys that signed the rest of the chain.
 func (l *Logger) Public() ([]byte, error) {
-	return x509.MarshalPKIXPublicKey(&l.signer.PublicKey)
+	_, pub, _ := l.signingKeys()
+	return x509.MarshalPKIXPublicKey(pub)
 }
 
 // Count returns the number of recorded events.
@@ -43,64 +191,110 @@ func (l *Logger) Count() uint64 {
 	return l.counter
 }
 
-func (l *Logger) ready() bool {
-	return l.listener != nil
+// accept reports whether the logger is accepting events at the given
+// level. If it is, the caller must hand exactly one event to
+// logEvent, which marks it as no longer pending once it is queued, or
+// dropped under OverflowDrop;
+// Stop waits for pending events before closing the queue. Events
+// generated by the logger itself pass levelInternal to bypass the
+// minimum level.
+func (l *Logger) accept(level int) bool {
+	ok, _ := l.admit(level)
+	return ok
+}
+
+// admit performs the same function as accept, except that it returns
+// ErrNotRunning if the event was turned away because the logger isn't
+// running, rather than filtered out by level.
+func (l *Logger) admit(level int) (bool, error) {
+	l.state.RLock()
+	defer l.state.RUnlock()
+
+	if !l.running {
+		return false, ErrNotRunning
+	}
+
+	if level != levelInternal && level < l.minLevel {
+		return false, nil
+	}
+
+	l.pending.Add(1)
+	return true, nil
 }
 
 func (l *Logger) logEvent(when int64, level int, actor, event string, attributes []Attribute, wait chan struct{}) {
+	l.logDurableEvent(when, level, actor, event, attributes, DurabilityDefault, wait, nil)
+}
+
+// logDurableEvent queues an event as logEvent does, to be recorded
+// with durability d. If result is set, the error that kept the event
+// from being stored, if any, is written to it before wait is closed.
+func (l *Logger) logDurableEvent(when int64, level int, actor, event string, attributes []Attribute, d Durability, wait chan struct{}, result *error) {
+	l.queueEvent(when, level, actor, event, attributes, false, d, wait, result)
+}
+
+// logInternalEvent queues an event generated by the logger itself,
+// recorded as the internal actor, as logDurableEvent does.
+func (l *Logger) logInternalEvent(level int, event string, attributes []Attribute, wait chan struct{}, result *error) {
+	l.queueEvent(l.now(), level, internalActor, event, attributes, true, DurabilityDefault, wait, result)
+}
+
+// queueEvent builds an event and queues it to be recorded; internal is
+// set if the logger generated the event.
+func (l *Logger) queueEvent(when int64, level int, actor, event string, attributes []Attribute, internal bool, d Durability, wait chan struct{}, result *error) {
 	if _, ok := levelStrings[level]; !ok {
 		level = levelUnknown
 	}
 
-	ev := &Event{
-		When:       time.Now().UnixNano(),
-		Level:      levelStrings[level],
-		Actor:      actor,
-		Event:      event,
-		Attributes: attributes,
-		wait:       wait,
+	ev := newEvent(attributes)
+	ev.When = when
+	ev.Level = levelStrings[level]
+	ev.Actor = actor
+	ev.Event = event
+	ev.internal = internal
+	ev.wait = wait
+	ev.result = result
+	ev.durability = d
+	ev.durability = l.durabilityOf(ev)
+
+	if l.journal != nil && !l.journalEvent(ev) {
+		return
 	}
 
-	if l.ready() {
-		l.listener <- ev
-	} else {
-		if wait != nil {
-			close(wait)
-		}
-	}
+	l.enqueue(ev)
 }
 
 // Debug records a debug event. In practice, this should not be used;
 // it is intended only for debugging the audit logger. This does not
 // wait for the audit logger to finish recording the event.
 func (l *Logger) Debug(actor, event string, attributes []Attribute) {
-	if !l.ready() {
+	if !l.accept(levelDebug) {
 		return
 	}
 
-	go l.logEvent(time.Now().UnixNano(), levelDebug, actor, event, attributes, nil)
+	l.logEvent(l.now(), levelDebug, actor, event, attributes, nil)
 }
 
 // Info records an informational event. This probably includes events
 // that are expected normally. This does not wait for the audit logger
 // to finish recording the event.
 func (l *Logger) Info(actor, event string, attributes []Attribute) {
-	if !l.ready() {
+	if !l.accept(levelInfo) {
 		return
 	}
 
-	go l.logEvent(time.Now().UnixNano(), levelInfo, actor, event, attributes, nil)
+	l.logEvent(l.now(), levelInfo, actor, event, attributes, nil)
 }
 
 // InfoSync performs the same function as Info, except it waits for
 // the event to be recorded.
 func (l *Logger) InfoSync(actor, event string, attributes []Attribute) {
-	if !l.ready() {
+	if !l.accept(levelInfo) {
 		return
 	}
 
 	wait := make(chan struct{}, 0)
-	go l.logEvent(time.Now().UnixNano(), levelInfo, actor, event, attributes, wait)
+	l.logEvent(l.now(), levelInfo, actor, event, attributes, wait)
 	<-wait
 }
 
@@ -109,22 +303,22 @@ func (l *Logger) InfoSync(actor, event string, attributes []Attribute) {
 // deprecated cipher. This does not wait for the audit logger to
 // finish recording the event.
 func (l *Logger) Warning(actor, event string, attributes []Attribute) {
-	if !l.ready() {
+	if !l.accept(levelWarning) {
 		return
 	}
 
-	go l.logEvent(time.Now().UnixNano(), levelWarning, actor, event, attributes, nil)
+	l.logEvent(l.now(), levelWarning, actor, event, attributes, nil)
 }
 
 // WarningSync performs the same function as Warning, except it waits
 // for the event to be recorded.
 func (l *Logger) WarningSync(actor, event string, attributes []Attribute) {
-	if !l.ready() {
+	if !l.accept(levelWarning) {
 		return
 	}
 
 	wait := make(chan struct{}, 0)
-	go l.logEvent(time.Now().UnixNano(), levelWarning, actor, event, attributes, wait)
+	l.logEvent(l.now(), levelWarning, actor, event, attributes, wait)
 	<-wait
 }
 
@@ -132,22 +326,22 @@ func (l *Logger) WarningSync(actor, event string, attributes []Attribute) {
 // failure. This does not wait for the audit logger to finish
 // recording the event.
 func (l *Logger) Error(actor, event string, attributes []Attribute) {
-	if !l.ready() {
+	if !l.accept(levelError) {
 		return
 	}
 
-	go l.logEvent(time.Now().UnixNano(), levelError, actor, event, attributes, nil)
+	l.logEvent(l.now(), levelError, actor, event, attributes, nil)
 }
 
 // ErrorSync performs the same function as error, except it waits for
 // the event to be recorded.
 func (l *Logger) ErrorSync(actor, event string, attributes []Attribute) {
-	if !l.ready() {
+	if !l.accept(levelError) {
 		return
 	}
 
 	wait := make(chan struct{}, 0)
-	go l.logEvent(time.Now().UnixNano(), levelError, actor, event, attributes, wait)
+	l.logEvent(l.now(), levelError, actor, event, attributes, wait)
 	<-wait
 }
 
@@ -156,12 +350,12 @@ func (l *Logger) ErrorSync(actor, event string, attributes []Attribute) {
 // synchronous version that waits for the event to be recorded is
 // provided.
 func (l *Logger) CriticalSync(actor, event string, attributes []Attribute) {
-	if !l.ready() {
+	if !l.accept(levelCritical) {
 		return
 	}
 
 	wait := make(chan struct{}, 0)
-	go l.logEvent(time.Now().UnixNano(), levelCritical, actor, event, attributes, wait)
+	l.logEvent(l.now(), levelCritical, actor, event, attributes, wait)
 	<-wait
 }
 
@@ -176,163 +370,651 @@ func (l *Logger) processEvent(ev *Event) {
 	defer l.lock.Unlock()
 
 	// After acquiring the lock, Stop may have been called.
-	if l.db == nil {
+	if l.closed {
 		return
 	}
-	ev.Received = time.Now().UnixNano()
 
-	tx, err := l.db.Begin()
-	if err != nil {
-		// This is a fatal error --- can't proceed with database.
-		panic(err.Error())
-	}
+	defer l.acknowledge(ev)
+	l.handle(ev)
+}
 
+// acknowledge releases the caller waiting on ev, and removes it from
+// the journal, once it has been committed.
+func (l *Logger) acknowledge(ev *Event) {
 	if ev.wait != nil {
-		defer close(ev.wait)
+		if ev.result != nil {
+			*ev.result = ev.err
+		}
+		close(ev.wait)
 	}
 
-	ev.Serial = l.counter
-	l.counter++
-	ev.Signature = l.lastSignature
-	digest := ev.digest()
+	if ev.journalID != 0 {
+		l.journal.ack(ev.journalID)
+	}
+}
 
-	r, s, err := ecdsa.Sign(prng, l.signer, digest)
-	ev.Signature = nil
+// handle records an event taken from the queue, along with any
+// events that follow from it; the caller must hold the lock.
+func (l *Logger) handle(ev *Event) {
+	ev.Received = l.received()
+	l.checkActor(ev)
+	skewed := l.checkSkew(ev)
 
-	if err != nil {
-		errEv := &ErrorEvent{
-			When:    time.Now().UnixNano(),
-			Message: "signature: " + err.Error(),
-			Event:   ev,
-		}
+	if l.sampler != nil && !l.sampler.keep(ev) {
+		return
+	}
 
-		err = storeError(tx, errEv)
-		if err != nil {
-			tx.Rollback()
-			l.db.Close()
-			panic(err.Error())
-		}
-		tx.Commit()
+	l.shred(ev)
+	l.seal(ev)
 
-		if l.stderr != nil {
-			fmt.Fprintf(l.stderr, "logger failure:\n%v\n", *errEv)
+	// Analyzers see the event as it was logged.
+	plain := ev
+	if l.encryption != nil && len(l.analyzers) > 0 {
+		plain = copyEvent(ev)
+	}
+	l.encrypt(ev)
+
+	if l.record(ev) == nil {
+		l.segmentRecorded(ev)
+		l.analyze(plain)
+		if skewed {
+			l.recordSkew(ev)
 		}
+	}
+}
 
-		l.counter--
-		return
+// record signs and stores an event at the end of the chain; the
+// caller must hold the logger's lock. If the event can't be signed,
+// an error event is stored instead and the error is returned.
+func (l *Logger) record(ev *Event) error {
+	if ev.Received == 0 {
+		ev.Received = l.received()
+	}
+
+	// While events are spooled, new events join them, so the
+	// chain keeps its order.
+	if l.spool != nil && !l.replaying && l.spool.pending > 0 {
+		return l.spoolEvent(ev, errors.New("earlier events are spooled"))
+	}
+
+	if l.buffering() {
+		l.waitDegraded()
 	}
 
-	sig := ECDSASignature{R: r, S: s}
-	ev.Signature, err = asn1.Marshal(sig)
+	ev.durability = l.durabilityOf(ev)
+	ev.Digest = l.digestVersion()
+	ev.Serial = l.counter
+	l.counter++
+
+	var err error
+	if l.hmacKey != nil && !ev.sign {
+		err = ev.authenticate(l.hmacKey, l.lastSignature)
+	} else if l.batch != nil && !ev.sign {
+		ev.link(l.lastSignature)
+	} else {
+		err = ev.signWith(l.signer, l.lastSignature, prng)
+	}
 	if err != nil {
+		ev.err = err
 		errEv := &ErrorEvent{
-			When:    time.Now().UnixNano(),
-			Message: "marshal signature: " + err.Error(),
+			When:    l.now(),
+			Message: "signature: " + err.Error(),
 			Event:   ev,
 		}
 
-		err = storeError(tx, errEv)
-		if err != nil {
-			tx.Rollback()
-			l.db.Close()
-			panic(err.Error())
+		if serr := l.store.StoreError(errEv); serr != nil {
+			l.fail([]*Event{ev}, serr, func() error { return l.store.StoreError(errEv) })
+			ev.err = err
 		}
-		tx.Commit()
 
 		if l.stderr != nil {
 			fmt.Fprintf(l.stderr, "logger failure:\n%v\n", *errEv)
 		}
 
 		l.counter--
-		return
+		return err
 	}
 
-	err = storeEvent(tx, ev)
-	if err != nil {
-		log.Printf("database error: %v", err)
-		tx.Rollback()
-		l.db.Close()
-		panic(err.Error())
+	// While events are buffered, new events join them, so the
+	// chain keeps its order.
+	if l.buffering() {
+		l.bufferEvent(ev, nil)
+	} else if l.grouping {
+		if len(l.group) == 0 {
+			l.groupPrev = l.lastSignature
+			if l.batch != nil {
+				l.groupBatch = *l.batch
+			}
+		}
+		l.group = append(l.group, ev)
+	} else if err = l.store.StoreEvent(ev); err == ErrDuplicateSerial && !l.replaying {
+		// Another logger has advanced the chain.
+		return l.rerecord(nil, []*Event{ev}, l.lastSignature)
+	} else if err != nil && l.degraded != nil && !l.replaying {
+		l.setFailure(err)
+		l.bufferEvent(ev, err)
+		err = nil
+	}
+
+	if err != nil && l.spool != nil {
+		l.setFailure(err)
+		l.counter--
+		if l.replaying {
+			return err
+		}
+		return l.spoolEvent(ev, err)
 	}
-	err = tx.Commit()
+
 	if err != nil {
-		panic(err.Error())
+		err = l.fail([]*Event{ev}, err, func() error { return l.store.StoreEvent(ev) })
+		if err == ErrDuplicateSerial && !l.replaying {
+			return l.rerecord(nil, []*Event{ev}, l.lastSignature)
+		} else if err != nil {
+			l.counter--
+			return err
+		}
 	}
 
+	// Grouped events are echoed once they are committed.
 	l.lastSignature = ev.Signature
-	if ev.Level == "DEBUG" || ev.Level == "INFO" {
-		if l.stdout != nil {
-			fmt.Fprintf(l.stdout, "%s\n", ev)
-		}
-	} else {
-		if l.stderr != nil {
-			fmt.Fprintf(l.stderr, "%s\n", ev)
+	if !l.grouping {
+		l.committed(ev)
+	}
+
+	if l.batch != nil {
+		l.batch.add(ev)
+		if l.batch.full() && !l.replaying {
+			l.sealBatch()
 		}
 	}
+
+	if l.failing && !l.grouping && !l.buffering() {
+		l.setFailure(nil)
+	}
+	return nil
 }
 
-func (l *Logger) processIncoming() {
-	for {
-		ev, ok := <-l.listener
-		if !ok {
-			return
+func (l *Logger) processIncoming(listener chan *Event, done chan struct{}) {
+	defer close(done)
+
+	l.replayJournal()
+	for ev := range listener {
+		// Whatever else is waiting in the queue is committed
+		// along with the event.
+		group := []*Event{ev}
+	drain:
+		for len(group) < cap(listener) {
+			select {
+			case ev, ok := <-listener:
+				if !ok {
+					break drain
+				}
+				group = append(group, ev)
+			default:
+				break drain
+			}
 		}
-
-		l.processEvent(ev)
+		l.processGroup(group)
 	}
 }
 
 // Start starts up the audit logger. This must be called prior to
-// logging events.
+// logging events. A stopped logger may be started again if its store
+// implements Reopener; the end of the chain is checked against the
+// last event the logger recorded, and any events added while it was
+// stopped are verified before it resumes. A minimum level set with
+// WithMinLevel or SetMinLevel is recorded in the chain once the logger
+// has started.
 func (l *Logger) Start() error {
-	l.listener = make(chan *Event, 16)
-	go l.processIncoming()
+	err := l.start()
+	if err != nil {
+		return err
+	}
 
+	l.recordMinLevel()
 	return nil
 }
 
-// Stop halts the logger and cleanly shuts down the database connection.
-func (l *Logger) Stop() {
-	for {
-		if len(l.listener) == 0 {
-			break
+func (l *Logger) start() error {
+	l.state.Lock()
+	defer l.state.Unlock()
+
+	if l.running {
+		return errors.New("auditlog: logger is already running")
+	}
+
+	if l.closed {
+		err := l.reopen()
+		if err != nil {
+			return err
 		}
-		log.Printf("waiting on %d elements", len(l.listener))
-		<-time.After(1 * time.Nanosecond)
+	}
+
+	if l.queueSize == 0 {
+		l.queueSize = DefaultQueueSize
+	}
+	l.lock.Lock()
+	err := l.storeKeys()
+	l.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = l.acquireLease()
+	if err != nil {
+		return err
+	}
+
+	l.listener = make(chan *Event, l.queueSize)
+	l.done = make(chan struct{})
+	go l.processIncoming(l.listener, l.done)
+
+	l.running = true
+	l.startTasks()
+	return nil
+}
+
+// Stop halts the logger and cleanly shuts down the database
+// connection. Events that were accepted before Stop was called are
+// recorded before it returns; events logged afterwards are dropped.
+// It is safe to call Stop concurrently with the logging methods.
+func (l *Logger) Stop() {
+	l.state.Lock()
+	if l.stopping {
+		// Another call to Stop is already shutting down.
+		l.state.Unlock()
+		return
+	}
+	running := l.running
+	l.stopping = running
+	l.state.Unlock()
+
+	// Background tasks may record final events, so they are
+	// stopped while the logger is still accepting events.
+	if running {
+		l.stopTasks()
+	}
+
+	l.state.Lock()
+	l.running = false
+	l.state.Unlock()
+
+	if running {
+		// No new events can be accepted, so once the pending
+		// events are queued nothing else will send on the queue.
+		l.pending.Wait()
+		close(l.listener)
+		<-l.done
 	}
 
 	l.lock.Lock()
-	close(l.listener)
 	l.listener = nil
-	l.db.Close()
-	l.db = nil
+	if !l.closed {
+		l.sealBatch()
+		if l.degraded != nil {
+			l.drainDegraded()
+		}
+		l.releaseLease()
+		l.store.Close()
+		l.closeSinks()
+		l.closed = true
+	}
 	l.lock.Unlock()
+
+	l.state.Lock()
+	l.stopping = false
+	l.state.Unlock()
+}
+
+// reopen prepares a stopped logger to be started again: the store and
+// sinks are reopened, and any events added to the chain while the
+// logger was stopped are verified.
+func (l *Logger) reopen() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	ro, ok := l.store.(Reopener)
+	if !ok {
+		return errors.New("auditlog: store cannot be reopened")
+	}
+
+	err := ro.Reopen()
+	if err != nil {
+		return err
+	}
+
+	err = l.loadKeys()
+	if err == nil {
+		err = l.verifyTail()
+	}
+	if err == nil {
+		err = l.recoverBatch()
+	}
+	if err != nil {
+		l.store.Close()
+		return err
+	}
+
+	err = l.openSinks()
+	if err != nil {
+		l.store.Close()
+		l.closeSinks()
+		return err
+	}
+
+	l.closed = false
+	return nil
 }
 
 // New sets up a new logger, using the signer for signatures and
-// backed by the database at the specified file. If the database
-// exists, the audit chain will be verified.
-func New(cd *DBConnDetails, signer *ecdsa.PrivateKey) (*Logger, error) {
+// backed by the database described by cd: Postgres, or the backend
+// named by cd.Backend. If the database contains events, the audit
+// chain will be verified.
+func New(cd *DBConnDetails, signer *ecdsa.PrivateKey, opts ...Option) (*Logger, error) {
+	store, err := NewStore(cd)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWithStore(store, signer, opts...)
+}
+
+// NewWithStore sets up a new logger, using the signer for signatures
+// and recording events in store. If the store contains events, the
+// audit chain will be verified.
+func NewWithStore(store Store, signer *ecdsa.PrivateKey, opts ...Option) (*Logger, error) {
+	return NewWithSigner(store, signer, opts...)
+}
+
+// NewWithSigner is like NewWithStore, but signs with any
+// crypto.Signer holding an ECDSA key, so that the key can stay in an
+// HSM, a TPM, or a cloud KMS rather than in the process's memory. The
+// signer is asked for SHA-256 signatures, which must be ASN.1
+// DER-encoded as crypto/ecdsa encodes them. Each event is signed as
+// it is recorded; a slow signer can be offset with WithBatchSigning.
+func NewWithSigner(store Store, signer crypto.Signer, opts ...Option) (*Logger, error) {
 	l := &Logger{
 		signer: signer,
 		stdout: os.Stdout,
 		stderr: os.Stderr,
 	}
 
-	err := l.setupDB(cd)
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	err := l.init(store, true)
 	if err != nil {
 		return nil, err
 	}
 
-	l.counter, err = countEvents(l.db)
+	return l, nil
+}
+
+// init loads the state of the audit chain from the store, verifying
+// it if requested.
+func (l *Logger) init(store Store, verify bool) error {
+	var err error
+
+	if l.optErr != nil {
+		return l.optErr
+	}
+
+	if l.signer == nil {
+		return errors.New("auditlog: no signer")
+	}
+
+	pub, ok := l.signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return errors.New("auditlog: the signer doesn't hold an ECDSA key")
+	}
+	l.public = pub
+
+	err = l.checkWORM(store)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	if err = l.checkHMAC(); err != nil {
+		return err
 	}
 
-	err = l.verifyAuditChain()
+	if _, ok := store.(CheckpointRecorder); l.fromCheckpoint && !ok {
+		return errors.New("auditlog: the store cannot record signed checkpoints")
+	}
+
+	if len(l.witnesses) > 0 {
+		if !l.fromCheckpoint {
+			return errors.New("auditlog: witnesses require signed checkpoints")
+		}
+
+		if _, ok := store.(CosignatureRecorder); !ok {
+			return errors.New("auditlog: the store cannot record cosignatures")
+		}
+	}
+
+	l.store = store
+	if err = l.checkEncryption(); err != nil {
+		return err
+	}
+
+	l.counter, err = store.Count()
 	if err != nil {
-		return nil, err
+		return err
 	}
+	l.segmentEvents = l.counter
 
-	return l, nil
+	if err = l.loadKeys(); err != nil {
+		return err
+	}
+
+	var last *Event
+	if l.counter > 0 {
+		last, err = store.Event(l.counter - 1)
+		if err != nil && err != ErrNoEvent {
+			return err
+		}
+	}
+
+	// Received timestamps continue from the chain's last event.
+	if last != nil {
+		l.lastReceived = last.Received
+	}
+
+	if verify && l.background == nil {
+		err = l.verifyAuditChain()
+	} else if last == nil && l.counter > 0 {
+		// Every event has been pruned.
+		_, l.lastSignature, err = l.chainStart()
+	} else if last != nil {
+		l.lastSignature = last.Signature
+	}
+	if err == nil && verify && l.background != nil {
+		err = l.deferVerification()
+	}
+	if err != nil {
+		return err
+	}
+	return l.recoverBatch()
+}
+
+var errAuditFailure = errors.New("auditlog: failed to verify audit chain")
+
+func (l *Logger) verifyAuditChain() error {
+	start, prev, err := l.verifyStart()
+	if err != nil {
+		return err
+	}
+	return l.verifyFrom(start, prev)
+}
+
+// verifyStart returns where verification of the chain begins, and the
+// signature of the event preceding it: the beginning of the chain, or
+// after the trusted head or the latest signed checkpoint.
+func (l *Logger) verifyStart() (uint64, []byte, error) {
+	start, prev, err := l.chainStart()
+	if err == nil && prev != nil {
+		err = l.checkPruned(start-1, prev)
+	}
+	if err == nil && l.trustedHead != nil && l.trustedHead.Serial+1 >= start {
+		start, prev, err = l.resumeFromHead(l.trustedHead, start, prev)
+	}
+	if err == nil && l.fromCheckpoint {
+		start, prev, err = l.resumeFromCheckpoint(start, prev)
+	}
+	return start, prev, err
+}
+
+// chainStart returns the serial number of the first event in the
+// store, and the signature of the event that precedes it.
+func (l *Logger) chainStart() (uint64, []byte, error) {
+	pruner, ok := l.store.(Pruner)
+	if !ok {
+		return 0, nil, nil
+	}
+
+	end, sig, ok, err := pruner.Pruned()
+	if err != nil || !ok {
+		return 0, nil, err
+	}
+	return end + 1, sig, nil
+}
+
+// verifyFrom verifies the events from serial start through the end of
+// the chain, where prev is the signature of the event preceding
+// start.
+func (l *Logger) verifyFrom(start uint64, prev []byte) error {
+	var total uint64
+	if start < l.counter {
+		total = l.counter - start
+	}
+	meter := newProgressMeter(l.verifyProgress, total)
+
+	seals := newSealCheck(start)
+	prev, err := l.verifyRange(l.store, l.keys.withHMAC(l.hmacKey), start, l.counter, prev, seals, meter)
+	if err != nil {
+		return err
+	}
+
+	if err = l.checkUnsealed(seals); err != nil {
+		return err
+	}
+
+	l.lastSignature = prev
+	return nil
+}
+
+// verifyRange verifies the events in store from serial start up to
+// end with keys, where prev is the signature of the event preceding
+// start, and returns the signature of the last event verified. The
+// events are passed on to seals, which must close every batch of
+// hash-linked events. It doesn't use the logger's chain state, so that
+// it can run without the logger's lock.
+func (l *Logger) verifyRange(store Store, keys KeyManifest, start, end uint64, prev []byte, seals *sealCheck, meter *progressMeter) ([]byte, error) {
+	for serial := start; serial < end; serial += backupBatch {
+		last := serial + backupBatch - 1
+		if last >= end {
+			last = end - 1
+		}
+
+		events, err := store.Events(serial, last)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = l.checkSerials(events, serial, last); err != nil {
+			return nil, err
+		}
+
+		if len(events) == 0 {
+			continue
+		}
+
+		if i := verifyEvents(keys, prev, events, l.verifyWorkers); i >= 0 {
+			log.Println("Signature failure on event", events[i].Serial)
+			return nil, errAuditFailure
+		}
+
+		for _, ev := range events {
+			if !seals.add(ev) {
+				log.Println("Unsealed batch before event", ev.Serial)
+				return nil, errAuditFailure
+			}
+		}
+		prev = events[len(events)-1].Signature
+		meter.add(len(events))
+	}
+	return prev, nil
+}
+
+// checkUnsealed reports a chain that ends with hash-linked events no
+// batch signature covers, unless the logger is in batch-signing mode
+// and will recover them into its next batch.
+func (l *Logger) checkUnsealed(seals *sealCheck) error {
+	if seals.open() && l.batch == nil {
+		log.Println("Unsealed batch at the end of the chain")
+		return errAuditFailure
+	}
+	return nil
+}
+
+// checkSerials checks the serial numbers of the events loaded for the
+// range [first, last] under the serial policy.
+func (l *Logger) checkSerials(events []*Event, first, last uint64) error {
+	if l.serials == SerialGapped {
+		for i, ev := range events {
+			if ev.Serial < first || ev.Serial > last || (i > 0 && ev.Serial <= events[i-1].Serial) {
+				return errAuditFailure
+			}
+		}
+		return nil
+	}
+
+	for i, ev := range events {
+		if ev.Serial != first+uint64(i) {
+			return ErrNoEvent
+		}
+	}
+
+	if uint64(len(events)) != last-first+1 {
+		return ErrNoEvent
+	}
+	return nil
+}
+
+// verifyTail checks that the chain still ends with the event this
+// logger last recorded, and verifies any events that were appended
+// to the chain since.
+func (l *Logger) verifyTail() error {
+	count, err := l.store.Count()
+	if err != nil {
+		return err
+	}
+
+	if count < l.counter {
+		log.Printf("audit chain has shrunk from %d to %d events", l.counter, count)
+		return errAuditFailure
+	}
+
+	start := l.counter
+	if start > 0 {
+		var sig []byte
+		ev, err := l.store.Event(start - 1)
+		if err == ErrNoEvent {
+			_, sig, err = l.chainStart()
+		} else if err == nil {
+			sig = ev.Signature
+		}
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(sig, l.lastSignature) {
+			log.Println("Signature mismatch on event", start-1)
+			return errAuditFailure
+		}
+	}
+
+	l.counter = count
+	return l.verifyFrom(start, l.lastSignature)
 }
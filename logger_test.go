@@ -2,36 +2,41 @@ package auditlog
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/ecdsa"
-	"crypto/elliptic"
+	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
-)
 
-var testlog *Logger
+	"github.com/kisom/auditlog/internal/testkeys"
+)
 
-const dbFile = "testdata/audit.db"
+var (
+	testlog   *Logger
+	testStore = NewMemoryStore()
+)
 
 func TestLogger(t *testing.T) {
-	os.Remove(dbFile)
-
-	signer, err := ecdsa.GenerateKey(elliptic.P256(), prng)
-	if err != nil {
-		t.Fatalf("%v", err)
-	}
+	signer := testKey(t, "signer")
 
-	testlog, err = New(dbFile, signer)
+	var err error
+	testlog, err = NewWithStore(testStore, signer, WithOutput(nil, os.Stderr))
 	if err != nil {
 		t.Fatalf("%v", err)
 	}
 
 	testlog.Start()
-	testlog.stdout = nil
 }
 
 func testActor(actorID, count int, wg *sync.WaitGroup) {
@@ -55,9 +60,29 @@ func TestLogs(t *testing.T) {
 }
 
 func TestError(t *testing.T) {
-	prng = &bytes.Buffer{}
-	testlog.InfoSync("auditlog_test", "PRNG failure", nil)
-	prng = rand.Reader
+	store := NewMemoryStore()
+	signer := testkeys.NewFailingSigner(testKey(t, "signer"), -1)
+	l, err := NewWithSigner(store, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("auditlog_test", "signature failure", nil)
+
+	if l.Count() != 0 {
+		t.Fatalf("expected the failed event to be discarded, but %d events were recorded", l.Count())
+	}
+
+	errors, err := store.Errors(0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error event, have %d", len(errors))
+	}
 }
 
 func TestMultipleActors(t *testing.T) {
@@ -75,7 +100,7 @@ func TestLoad(t *testing.T) {
 	signer := testlog.signer
 
 	var err error
-	testlog, err = New(dbFile, signer)
+	testlog, err = NewWithSigner(testStore, signer)
 	if err != nil {
 		t.Fatalf("%v", err)
 	}
@@ -88,15 +113,16 @@ func TestCertification(t *testing.T) {
 	if err != nil {
 		t.Fatalf("%v", err)
 	}
-	ioutil.WriteFile("logger.pub", pub, 0644)
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "logger.pub"), pub, 0644)
 
 	cl, err := testlog.Certify(0, 0)
 	if err != nil {
 		t.Fatalf("%v", err)
 	}
-	ioutil.WriteFile("certified.json", cl, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "certified.json"), cl, 0644)
 
-	_, ok := VerifyCertification(cl, &testlog.signer.PublicKey)
+	_, ok := VerifyCertification(cl, testlog.public)
 	if !ok {
 		t.Fatal("failed to verified certification")
 	}
@@ -136,5 +162,407 @@ func BenchmarkCertifyLogs(b *testing.B) {
 	if err != nil {
 		b.Fatalf("%v", err)
 	}
-	ioutil.WriteFile("certified_bench.json", cl, 0644)
+	ioutil.WriteFile(filepath.Join(b.TempDir(), "certified_bench.json"), cl, 0644)
+}
+
+func TestClock(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	clock := NewFixedClock(start, time.Second)
+	store := NewMemoryStore()
+	l, err := NewWithStore(store, signer, WithClock(clock), WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("logger_test", "tick", nil)
+	l.InfoSync("logger_test", "tock", nil)
+
+	for i := uint64(0); i < 2; i++ {
+		ev, err := store.Event(i)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		when := start.Add(time.Duration(2*i) * time.Second).UnixNano()
+		if ev.When != when || ev.Received != when+int64(time.Second) {
+			t.Fatalf("event %d: bad timestamps %d, %d", i, ev.When, ev.Received)
+		}
+	}
+}
+
+func TestReceivedRange(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	// Event i is received 2i+1 seconds after start.
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, err := NewWithStore(NewMemoryStore(), signer, WithClock(NewFixedClock(start, time.Second)), WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 5; i++ {
+		l.InfoSync("logger_test", "tick", nil)
+	}
+
+	first, last, ok, err := l.ReceivedRange(start.Add(3*time.Second), start.Add(8*time.Second))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !ok || first != 1 || last != 3 {
+		t.Fatalf("expected events 1 to 3, have %d to %d (%v)", first, last, ok)
+	}
+
+	_, _, ok, err = l.ReceivedRange(start.Add(time.Minute), start.Add(time.Hour))
+	if err != nil || ok {
+		t.Fatalf("expected no events, have %v (%v)", ok, err)
+	}
+}
+
+func TestConcurrentStop(t *testing.T) {
+	for round := 0; round < 4; round++ {
+		l, _ := newTestLogger(t)
+		l.Start()
+
+		wg := new(sync.WaitGroup)
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(actor int) {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					l.Info(fmt.Sprintf("actor%d", actor), "ping", nil)
+					l.WarningSync(fmt.Sprintf("actor%d", actor), "pong", nil)
+				}
+			}(i)
+		}
+
+		<-time.After(time.Millisecond)
+		l.Stop()
+		wg.Wait()
+
+		// Logging after Stop must be a harmless no-op.
+		l.Info("logger_test", "stopped", nil)
+		l.CriticalSync("logger_test", "stopped", nil)
+		l.Stop()
+	}
+}
+
+func TestRestart(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, store := newTestLogger(t)
+
+	for i := 0; i < 3; i++ {
+		err := l.Start()
+		if err != nil {
+			t.Fatalf("restart %d: %v", i, err)
+		}
+
+		l.InfoSync("logger_test", "ping", nil)
+		l.Stop()
+	}
+
+	// Events appended by another logger while this one is stopped
+	// are verified when it restarts.
+	other, err := NewWithStore(store, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	other.Start()
+	other.InfoSync("logger_test", "interloper", nil)
+	other.Stop()
+
+	err = l.Start()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.InfoSync("logger_test", "ping", nil)
+	l.Stop()
+
+	if l.Count() != 5 {
+		t.Fatalf("expected 5 events, have %d", l.Count())
+	}
+
+	// A chain extended with a different key must not verify.
+	forger := testKey(t, "forger")
+
+	ev := &Event{Serial: 5, Level: "INFO", Actor: "forger", Event: "forgery"}
+	ev.Sign(forger, l.lastSignature, nil)
+	store.StoreEvent(ev)
+
+	if err = l.Start(); err == nil {
+		l.Stop()
+		t.Fatal("logger restarted on a forged chain")
+	}
+}
+
+func TestEcho(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	stdout := &bytes.Buffer{}
+	alerts := &bytes.Buffer{}
+	l, err := NewWithStore(NewMemoryStore(), signer,
+		WithOutput(stdout, nil),
+		WithEcho(alerts, "error", "critical"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+
+	l.InfoSync("logger_test", "info", nil)
+	l.WarningSync("logger_test", "warning", nil)
+	l.ErrorSync("logger_test", "error", nil)
+	l.Stop()
+
+	if lines := strings.Count(stdout.String(), "\n"); lines != 1 {
+		t.Fatalf("expected 1 line on stdout, have %d", lines)
+	}
+
+	if !strings.Contains(alerts.String(), "logger_test:error") || strings.Contains(alerts.String(), "warning") {
+		t.Fatalf("bad echo to the alert writer: %q", alerts.String())
+	}
+}
+
+// steppedClock is a clock that can be stepped backwards.
+type steppedClock struct {
+	t time.Time
+}
+
+func (c *steppedClock) Now() time.Time {
+	c.t = c.t.Add(time.Second)
+	return c.t
+}
+
+func TestClockRegression(t *testing.T) {
+	clock := &steppedClock{t: time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)}
+	l, store := newTestLogger(t, WithClock(clock))
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("logger_test", "before", nil)
+	clock.t = clock.t.Add(-time.Hour)
+	l.InfoSync("logger_test", "after", nil)
+
+	events, err := store.Events(0, 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(events) != 3 || events[1].Event != EventClockRegression {
+		t.Fatalf("expected a clock regression event, have %v", events)
+	}
+
+	for i := 1; i < len(events); i++ {
+		if events[i].Received <= events[i-1].Received {
+			t.Fatalf("received timestamp went backwards at event %d", i)
+		}
+	}
+}
+
+func TestEventDigest(t *testing.T) {
+	ev := &Event{
+		Serial:   42,
+		When:     time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).UnixNano(),
+		Received: time.Date(2024, 3, 1, 12, 0, 1, 0, time.UTC).UnixNano(),
+		Level:    "INFO",
+		Actor:    "logger_test",
+		Event:    "digest",
+		Attributes: []Attribute{
+			{"user", "root"},
+			{"host", "db1"},
+		},
+	}
+	prev := []byte("previous signature")
+
+	// The encoding must not change, or existing chains would no
+	// longer verify.
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, int64(ev.Serial))
+	binary.Write(h, binary.BigEndian, ev.When)
+	binary.Write(h, binary.BigEndian, ev.Received)
+	h.Write([]byte("INFOlogger_testdigestuserroothostdb1"))
+	h.Write(prev)
+
+	digest := ev.digest(prev)
+	if !bytes.Equal(digest[:], h.Sum(nil)) {
+		t.Fatalf("digest doesn't match the chain's encoding: %x", digest)
+	}
+
+	if allocs := testing.AllocsPerRun(100, func() { ev.digest(prev) }); allocs != 0 {
+		t.Fatalf("expected computing a digest not to allocate, have %v allocations", allocs)
+	}
+}
+
+func TestCertifyTo(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, _ := newTestLogger(t)
+	l.Start()
+	defer l.Stop()
+
+	// The certification spans more than one batch read from the
+	// store.
+	for i := 0; i < backupBatch+10; i++ {
+		l.Info("logger_test", "certify", []Attribute{{"n", fmt.Sprint(i)}})
+	}
+	l.InfoSync("logger_test", "certify", nil)
+
+	count := l.Count()
+	var buf bytes.Buffer
+	if err := l.CertifyTo(&buf, "alice", 0, 0); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cert, ok := VerifyCertification(buf.Bytes(), &signer.PublicKey)
+	if !ok {
+		t.Fatal("streamed certification failed to verify")
+	}
+
+	if uint64(len(cert.Chain)) != count {
+		t.Fatalf("expected %d events in the certification, have %d", count, len(cert.Chain))
+	}
+
+	// The stream is encoded exactly as a Certification would be.
+	out, err := json.Marshal(cert)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !bytes.Equal(out, buf.Bytes()) {
+		t.Fatal("streamed certification differs from its JSON encoding")
+	}
+
+	trail, err := l.CustodyTrail(buf.Bytes())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(trail) != 1 || trail[0].Event != EventCertify {
+		t.Fatalf("expected the certification to be in the custody trail, have %v", trail)
+	}
+}
+
+// stallingWriter blocks its first write until it is released.
+type stallingWriter struct {
+	bytes.Buffer
+	started, release chan struct{}
+}
+
+func (sw *stallingWriter) Write(p []byte) (int, error) {
+	if sw.started != nil {
+		close(sw.started)
+		sw.started = nil
+		<-sw.release
+	}
+	return sw.Buffer.Write(p)
+}
+
+func TestCertifyConcurrentWrites(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, _ := newTestLogger(t)
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 5; i++ {
+		l.InfoSync("logger_test", "before", nil)
+	}
+
+	started := make(chan struct{})
+	w := &stallingWriter{started: started, release: make(chan struct{})}
+	done := make(chan error)
+	go func() {
+		done <- l.CertifyTo(w, "alice", 0, 0)
+	}()
+
+	// Events are recorded while the certification is written, but
+	// aren't part of it.
+	<-started
+	l.InfoSync("logger_test", "during", nil)
+	close(w.release)
+
+	if err := <-done; err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cert, ok := VerifyCertification(w.Bytes(), &signer.PublicKey)
+	if !ok {
+		t.Fatal("certification failed to verify")
+	}
+
+	for _, ev := range cert.Chain {
+		if ev.Event == "during" {
+			t.Fatal("certification includes an event recorded while it was written")
+		}
+	}
+
+	if len(cert.Chain) != 5 {
+		t.Fatalf("expected 5 events in the certification, have %d", len(cert.Chain))
+	}
+}
+
+// opaqueSigner hides its key behind crypto.Signer, as a key held in an
+// HSM would be, and counts the signatures it makes.
+type opaqueSigner struct {
+	key   *ecdsa.PrivateKey
+	count int
+}
+
+func (s *opaqueSigner) Public() crypto.PublicKey {
+	return s.key.Public()
+}
+
+func (s *opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.count++
+	return s.key.Sign(rand, digest, opts)
+}
+
+func TestNewWithSigner(t *testing.T) {
+	key := testKey(t, "key")
+
+	signer := &opaqueSigner{key: key}
+	store := NewMemoryStore()
+	l, err := NewWithSigner(store, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	for i := 0; i < 5; i++ {
+		l.InfoSync("logger_test", "event", nil)
+	}
+
+	if signer.count != 5 {
+		t.Fatalf("expected the signer to sign 5 events, have %d", signer.count)
+	}
+
+	cl, err := l.Certify(0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	if _, ok := VerifyCertification(cl, &key.PublicKey); !ok {
+		t.Fatal("certification failed to verify")
+	}
+
+	// A chain signed through the signer is verified when it is
+	// reopened with the key itself.
+	if _, err = NewWithStore(store, key, WithoutEcho()); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = NewWithSigner(NewMemoryStore(), edKey, WithoutEcho()); err == nil {
+		t.Fatal("expected a signer without an ECDSA key to be refused")
+	}
 }
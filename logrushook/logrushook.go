@@ -0,0 +1,98 @@
+// Package logrushook forwards logrus entries into an audit chain, so
+// that a service already logging with logrus gets a tamper-evident
+// audit trail by adding a hook:
+//
+//	log.AddHook(logrushook.New(audit, logrus.WarnLevel, logrus.ErrorLevel))
+//
+// Each entry is recorded as an event named by its message, at the
+// matching level, with its fields as attributes.
+package logrushook
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kisom/auditlog"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultActor is the actor recorded for entries without an actor
+// field.
+const DefaultActor = "logrus"
+
+// A Hook records the logrus entries at its levels in an audit chain.
+type Hook struct {
+	Logger *auditlog.Logger
+
+	// Actor is the actor recorded for entries that don't have the
+	// ActorField field.
+	Actor string
+
+	// ActorField names the field, if any, holding the actor; it is
+	// recorded as the event's actor rather than as an attribute.
+	ActorField string
+
+	levels []logrus.Level
+}
+
+// New returns a hook recording the entries at levels, or at every
+// level if none are given, in the chain kept by l. Entries are
+// recorded with DefaultActor, unless they have an "actor" field.
+func New(l *auditlog.Logger, levels ...logrus.Level) *Hook {
+	if len(levels) == 0 {
+		levels = logrus.AllLevels
+	}
+
+	return &Hook{
+		Logger:     l,
+		Actor:      DefaultActor,
+		ActorField: "actor",
+		levels:     levels,
+	}
+}
+
+// Levels returns the levels whose entries the hook records.
+func (h *Hook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// auditLevel returns the audit level for a logrus level; the panic and
+// fatal levels are recorded as CRITICAL, and trace as DEBUG.
+func auditLevel(level logrus.Level) string {
+	switch level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return "CRITICAL"
+	case logrus.ErrorLevel:
+		return "ERROR"
+	case logrus.WarnLevel:
+		return "WARNING"
+	case logrus.InfoLevel:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
+
+// Fire records an entry, waiting for it to be stored; logrus reports
+// an error from the logger.
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	actor := h.Actor
+	names := make([]string, 0, len(entry.Data))
+	for name, value := range entry.Data {
+		if h.ActorField != "" && name == h.ActorField {
+			actor = fmt.Sprint(value)
+			continue
+		}
+		names = append(names, name)
+	}
+
+	// Fields are kept in a map, so they are recorded in order of
+	// name for the event to be reproducible.
+	sort.Strings(names)
+	attrs := make([]auditlog.Attribute, 0, len(names))
+	for _, name := range names {
+		attrs = append(attrs, auditlog.Attribute{Name: name, Value: fmt.Sprint(entry.Data[name])})
+	}
+
+	return h.Logger.LogDurable(auditlog.DurabilityDefault, auditLevel(entry.Level), actor, entry.Message, attrs)
+}
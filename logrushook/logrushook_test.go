@@ -0,0 +1,64 @@
+package logrushook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/kisom/auditlog"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHook(t *testing.T) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	audit, err := auditlog.NewWithStore(auditlog.NewMemoryStore(), signer, auditlog.WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	audit.Start()
+	defer audit.Stop()
+
+	log := logrus.New()
+	log.Out = ioutil.Discard
+	log.AddHook(New(audit, logrus.WarnLevel, logrus.ErrorLevel))
+
+	log.WithField("user", "alice").Info("login")
+	log.WithFields(logrus.Fields{"user": "alice", "ip": "10.0.0.1"}).Warn("login failed")
+	log.WithField("actor", "billing").WithError(errors.New("card declined")).Error("payment failed")
+
+	events, err := audit.Query("logrushook_test", auditlog.Query{Actor: DefaultActor})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one event from %s, have %d", DefaultActor, len(events))
+	}
+
+	ev := events[0]
+	want := []auditlog.Attribute{{Name: "ip", Value: "10.0.0.1"}, {Name: "user", Value: "alice"}}
+	if ev.Event != "login failed" || ev.Level != "WARNING" || !reflect.DeepEqual(ev.Attributes, want) {
+		t.Fatalf("expected the warning, have %s", ev)
+	}
+
+	events, err = audit.Query("logrushook_test", auditlog.Query{Actor: "billing"})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one event from billing, have %d", len(events))
+	}
+
+	ev = events[0]
+	want = []auditlog.Attribute{{Name: "error", Value: "card declined"}}
+	if ev.Event != "payment failed" || ev.Level != "ERROR" || !reflect.DeepEqual(ev.Attributes, want) {
+		t.Fatalf("expected the error, have %s", ev)
+	}
+}
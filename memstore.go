@@ -0,0 +1,354 @@
+package auditlog
+
+import (
+	"sort"
+	"sync"
+)
+
+// A MemoryStore keeps an audit chain in memory. It is intended for
+// tests and for applications that only need a transient chain.
+// Closing a MemoryStore does not discard its contents, so a new
+// logger may be started on the same store.
+type MemoryStore struct {
+	lock   sync.Mutex
+	events []*Event
+	errors []*ErrorEvent
+
+	// base is the serial number of events[0]; it is only non-zero
+	// once events have been pruned.
+	base      uint64
+	prunedSig []byte
+
+	// packed holds the compressed attributes of events, by serial
+	// number, whose attributes have been compressed.
+	packed map[uint64][]byte
+
+	// keys is the chain's key history, in order of first serial.
+	keys []KeyRecord
+
+	// checkpoint is the latest signed checkpoint.
+	checkpoint *SignedCheckpoint
+
+	// cosignatures holds witnesses' cosignatures of checkpoints, by
+	// serial.
+	cosignatures map[uint64][]Cosignature
+
+	leased bool
+}
+
+// NewMemoryStore returns an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func copyEvent(ev *Event) *Event {
+	c := *ev
+	c.wait = nil
+	c.result = nil
+	if ev.Attributes != nil {
+		c.Attributes = make([]Attribute, len(ev.Attributes))
+		copy(c.Attributes, ev.Attributes)
+	}
+	if ev.Signature != nil {
+		c.Signature = make([]byte, len(ev.Signature))
+		copy(c.Signature, ev.Signature)
+	}
+	return &c
+}
+
+// load returns a copy of the event with the given serial number,
+// restoring its attributes if they have been compressed; the caller
+// must hold the lock and ensure the event exists.
+func (ms *MemoryStore) load(serial uint64) (*Event, error) {
+	ev := copyEvent(ms.events[serial-ms.base])
+	if packed, ok := ms.packed[serial]; ok {
+		attrs, err := unpackAttributes(packed)
+		if err != nil {
+			return nil, err
+		}
+		ev.Attributes = attrs
+	}
+	return ev, nil
+}
+
+// StoreEvent records a signed event.
+func (ms *MemoryStore) StoreEvent(ev *Event) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	next := ms.base + uint64(len(ms.events))
+	if ev.Serial < next {
+		return ErrDuplicateSerial
+	}
+
+	// Serial numbers are allocated by the logger; a gap can only
+	// appear if events are stored out of order.
+	if ev.Serial > next {
+		return ErrNoEvent
+	}
+
+	ms.events = append(ms.events, copyEvent(ev))
+	return nil
+}
+
+// StoreError records an error event.
+func (ms *MemoryStore) StoreError(ev *ErrorEvent) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	ms.errors = append(ms.errors, &ErrorEvent{
+		When:    ev.When,
+		Message: ev.Message,
+		Event:   copyEvent(ev.Event),
+	})
+	return nil
+}
+
+// Count returns the number of events in the chain.
+func (ms *MemoryStore) Count() (uint64, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	return ms.base + uint64(len(ms.events)), nil
+}
+
+// Event loads the event with the given serial number.
+func (ms *MemoryStore) Event(serial uint64) (*Event, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if serial < ms.base || serial-ms.base >= uint64(len(ms.events)) {
+		return nil, ErrNoEvent
+	}
+	return ms.load(serial)
+}
+
+// Events loads the events whose serial numbers fall in the range
+// [start, end].
+func (ms *MemoryStore) Events(start, end uint64) ([]*Event, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if start < ms.base {
+		start = ms.base
+	}
+
+	var events []*Event
+	for i := start; i <= end && i-ms.base < uint64(len(ms.events)); i++ {
+		ev, err := ms.load(i)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// EventsByActor loads the events recorded by actor whose serial
+// numbers fall in the range [start, end].
+func (ms *MemoryStore) EventsByActor(actor string, start, end uint64) ([]*Event, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if start < ms.base {
+		start = ms.base
+	}
+
+	var events []*Event
+	for i := start; i <= end && i-ms.base < uint64(len(ms.events)); i++ {
+		if ms.events[i-ms.base].Actor != actor {
+			continue
+		}
+
+		ev, err := ms.load(i)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// Errors loads the error events whose serial numbers fall in the
+// range [start, end].
+func (ms *MemoryStore) Errors(start, end uint64) ([]*ErrorEvent, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	var events []*ErrorEvent
+	for _, ev := range ms.errors {
+		if ev.Event.Serial >= start && ev.Event.Serial <= end {
+			events = append(events, &ErrorEvent{
+				When:    ev.When,
+				Message: ev.Message,
+				Event:   copyEvent(ev.Event),
+			})
+		}
+	}
+	return events, nil
+}
+
+// Close is a no-op; the contents of the store are retained.
+func (ms *MemoryStore) Close() error {
+	return nil
+}
+
+// Reopen is a no-op, as closing the store doesn't discard it.
+func (ms *MemoryStore) Reopen() error {
+	return nil
+}
+
+// Prune discards the events with serial numbers up to and including
+// end.
+func (ms *MemoryStore) Prune(end uint64) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if end < ms.base {
+		return nil
+	}
+
+	n := end - ms.base + 1
+	if n > uint64(len(ms.events)) {
+		return ErrNoEvent
+	}
+
+	ms.prunedSig = ms.events[n-1].Signature
+	ms.events = ms.events[n:]
+	for serial := range ms.packed {
+		if serial <= end {
+			delete(ms.packed, serial)
+		}
+	}
+	ms.base = end + 1
+	return nil
+}
+
+// Pruned returns the serial number and signature of the last pruned
+// event.
+func (ms *MemoryStore) Pruned() (end uint64, signature []byte, ok bool, err error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.base == 0 {
+		return 0, nil, false, nil
+	}
+	return ms.base - 1, ms.prunedSig, true, nil
+}
+
+// Compress compresses the attributes of the events with serial
+// numbers up to and including end.
+func (ms *MemoryStore) Compress(end uint64) (int, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.packed == nil {
+		ms.packed = map[uint64][]byte{}
+	}
+
+	var n int
+	for i := range ms.events {
+		ev := ms.events[i]
+		if ev.Serial > end {
+			break
+		}
+
+		if len(ev.Attributes) == 0 {
+			continue
+		}
+
+		packed, err := packAttributes(ev.Attributes)
+		if err != nil {
+			return n, err
+		}
+
+		ms.packed[ev.Serial] = packed
+		ev.Attributes = nil
+		n++
+	}
+	return n, nil
+}
+
+// StoreKey records a key in the chain's key history, unless a key
+// has already been recorded for its first serial number.
+func (ms *MemoryStore) StoreKey(rec KeyRecord) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	for _, kr := range ms.keys {
+		if kr.First == rec.First {
+			return nil
+		}
+	}
+
+	rec.PublicKey = append([]byte(nil), rec.PublicKey...)
+	ms.keys = append(ms.keys, rec)
+	sort.Slice(ms.keys, func(i, j int) bool { return ms.keys[i].First < ms.keys[j].First })
+	return nil
+}
+
+// Keys returns the chain's key history.
+func (ms *MemoryStore) Keys() ([]KeyRecord, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	keys := make([]KeyRecord, len(ms.keys))
+	copy(keys, ms.keys)
+	return keys, nil
+}
+
+// StoreCheckpoint keeps a signed checkpoint if it is later than the
+// latest one.
+func (ms *MemoryStore) StoreCheckpoint(sc SignedCheckpoint) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.checkpoint != nil && sc.Serial <= ms.checkpoint.Serial {
+		return nil
+	}
+
+	sc.Signature = append([]byte(nil), sc.Signature...)
+	ms.checkpoint = &sc
+	return nil
+}
+
+// LatestCheckpoint returns the latest signed checkpoint.
+func (ms *MemoryStore) LatestCheckpoint() (*SignedCheckpoint, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	if ms.checkpoint == nil {
+		return nil, nil
+	}
+
+	sc := *ms.checkpoint
+	return &sc, nil
+}
+
+// StoreCosignature keeps a witness's cosignature of a checkpoint.
+func (ms *MemoryStore) StoreCosignature(cs Cosignature) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	for _, have := range ms.cosignatures[cs.Serial] {
+		if have.Witness == cs.Witness {
+			return nil
+		}
+	}
+
+	if ms.cosignatures == nil {
+		ms.cosignatures = make(map[uint64][]Cosignature)
+	}
+	cs.Signature = append([]byte(nil), cs.Signature...)
+	ms.cosignatures[cs.Serial] = append(ms.cosignatures[cs.Serial], cs)
+	return nil
+}
+
+// Cosignatures returns the cosignatures of the checkpoint of the given
+// event.
+func (ms *MemoryStore) Cosignatures(serial uint64) ([]Cosignature, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+
+	return append([]Cosignature(nil), ms.cosignatures[serial]...), nil
+}
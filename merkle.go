@@ -0,0 +1,41 @@
+package auditlog
+
+import "crypto/sha256"
+
+// merkleLeaf returns the hash of a leaf in a Merkle tree, using the
+// domain separation described in RFC 6962.
+func merkleLeaf(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func merkleNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// merkleRoot returns the root of the Merkle tree over the given leaf
+// hashes, as described in RFC 6962. The root of an empty tree is the
+// hash of the empty string.
+func merkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	case 1:
+		return leaves[0]
+	}
+
+	// Split at the largest power of two smaller than the number
+	// of leaves.
+	k := 1
+	for k*2 < len(leaves) {
+		k *= 2
+	}
+	return merkleNode(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
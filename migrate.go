@@ -0,0 +1,273 @@
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrMigrationMismatch is returned by Migrate when the copied chain
+// doesn't match the original.
+var ErrMigrationMismatch = errors.New("auditlog: migrated chain does not match the original")
+
+// A schemaCreator is a Store that can create its own schema.
+type schemaCreator interface {
+	createSchema() (bool, error)
+}
+
+// OpenStore opens the store named by dsn, which may be a Postgres
+// connection URL (postgres://user@host/dbname) or connection string
+// ("dbname=auditlog user=auditor"), a MySQL driver data source name
+// prefixed with "mysql:" (mysql:auditor@tcp(host:3306)/auditlog), or
+// the path to a SQLite database prefixed with "sqlite:"
+// (sqlite:/var/lib/audit.db), or the path to a log file prefixed with
+// "file:" (file:/var/log/audit.log). It is meant for
+// tools, such as Migrate, that work with more than one store; loggers
+// are normally built from a Config.
+func OpenStore(dsn string) (Store, error) {
+	switch {
+	case strings.HasPrefix(dsn, "mysql:"):
+		return openMySQLStore(strings.TrimPrefix(strings.TrimPrefix(dsn, "mysql:"), "//"))
+	case strings.HasPrefix(dsn, "sqlite:"):
+		return NewSQLiteStore(strings.TrimPrefix(strings.TrimPrefix(dsn, "sqlite:"), "//"))
+	case strings.HasPrefix(dsn, "file:"):
+		return NewFileStore(strings.TrimPrefix(strings.TrimPrefix(dsn, "file:"), "//"))
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"),
+		strings.Contains(dsn, "="):
+		return openPostgresStore(dsn)
+	default:
+		return nil, fmt.Errorf("auditlog: no store backend for %q", dsn)
+	}
+}
+
+// Migrate copies the chain in src to dst, which must be empty, so
+// that a chain can be moved between backends. Every event is verified
+// with pub before it is copied; error events are copied after the
+// chain. If src records a key history, the events are verified with
+// it instead, pub must be its current key, and it is copied to dst. Once copied, the chain is read back from dst, verified
+// again, and compared with the original event by event, returning
+// ErrMigrationMismatch if they differ. If dst can create its own
+// schema, it is created first.
+//
+// Migrate doesn't go through a logger, so no logger should be running
+// on either store. If progress isn't nil, it is called after each
+// batch of events is copied, and again as they are compared, with the
+// number of events done and the length of the chain. Pruned chains
+// can't be migrated, as dst would have to begin partway through the
+// chain.
+func Migrate(ctx context.Context, dst, src Store, pub *ecdsa.PublicKey, progress func(done, total uint64)) error {
+	if pr, ok := src.(Pruner); ok {
+		_, _, pruned, err := pr.Pruned()
+		if err != nil {
+			return err
+		}
+
+		if pruned {
+			return errors.New("auditlog: cannot migrate a pruned chain")
+		}
+	}
+
+	if sc, ok := dst.(schemaCreator); ok {
+		if _, err := sc.createSchema(); err != nil {
+			return err
+		}
+	}
+
+	existing, err := dst.Count()
+	if err != nil {
+		return err
+	}
+
+	if existing != 0 {
+		return errors.New("auditlog: cannot migrate into a store that already holds events")
+	}
+
+	count, err := src.Count()
+	if err != nil {
+		return err
+	}
+
+	keys, err := migrateKeys(dst, src, pub)
+	if err != nil {
+		return err
+	}
+
+	// A batch left open at the end of the chain is recovered by the
+	// next logger in batch-signing mode, and refused by any other.
+	var prev []byte
+	seals := newSealCheck(0)
+	err = migrateBatches(ctx, src, count, progress, func(events []*Event) error {
+		for _, ev := range events {
+			if !keys.verify(ev, prev) || !seals.add(ev) {
+				return fmt.Errorf("%w: event %d", errAuditFailure, ev.Serial)
+			}
+			prev = ev.Signature
+
+			if err := dst.StoreEvent(ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []*ErrorEvent
+	if count > 0 {
+		errs, err = src.Errors(0, count-1)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, errEv := range errs {
+		if err = dst.StoreError(errEv); err != nil {
+			return err
+		}
+	}
+
+	// Cross-verify: the copy must verify on its own, and match the
+	// original exactly.
+	copied, err := dst.Count()
+	if err != nil {
+		return err
+	}
+
+	if copied != count {
+		return fmt.Errorf("%w: %d of %d events copied", ErrMigrationMismatch, copied, count)
+	}
+
+	prev = nil
+	err = migrateBatches(ctx, dst, count, progress, func(events []*Event) error {
+		orig, err := src.Events(events[0].Serial, events[len(events)-1].Serial)
+		if err != nil {
+			return err
+		}
+
+		for i, ev := range events {
+			if i >= len(orig) || !keys.verify(ev, prev) || !sameEvent(ev, orig[i]) {
+				return fmt.Errorf("%w: event %d differs", ErrMigrationMismatch, ev.Serial)
+			}
+			prev = ev.Signature
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		copiedErrs, err := dst.Errors(0, count-1)
+		if err != nil {
+			return err
+		}
+
+		if len(copiedErrs) != len(errs) {
+			return fmt.Errorf("%w: %d of %d error events copied", ErrMigrationMismatch,
+				len(copiedErrs), len(errs))
+		}
+	}
+	return nil
+}
+
+// migrateKeys copies the key history recorded in src to dst, returning
+// the keys to verify the chain with.
+func migrateKeys(dst, src Store, pub *ecdsa.PublicKey) (KeyManifest, error) {
+	var recs []KeyRecord
+	if kr, ok := src.(KeyRecorder); ok {
+		var err error
+		recs, err = kr.Keys()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(recs) == 0 {
+		return singleKey(pub), nil
+	}
+
+	keys, err := manifestFrom(recs)
+	if err != nil {
+		return nil, err
+	}
+
+	if !keys[len(keys)-1].Public.Equal(pub) {
+		return nil, errors.New("auditlog: the chain's current signing key isn't the one given")
+	}
+
+	kr, ok := dst.(KeyRecorder)
+	if !ok {
+		if len(keys) > 1 {
+			return nil, errors.New("auditlog: the destination store cannot record a key history")
+		}
+		return keys, nil
+	}
+
+	for _, rec := range recs {
+		if err = kr.StoreKey(rec); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// migrateBatches reads the events in store in batches, calling f on
+// each batch in order. Missing events are an error.
+func migrateBatches(ctx context.Context, store Store, count uint64, progress func(done, total uint64), f func(events []*Event) error) error {
+	next := uint64(0)
+	for serial := uint64(0); serial < count; serial += backupBatch {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		last := serial + backupBatch - 1
+		if last >= count {
+			last = count - 1
+		}
+
+		events, err := store.Events(serial, last)
+		if err != nil {
+			return err
+		}
+
+		for _, ev := range events {
+			if ev.Serial != next {
+				break
+			}
+			next++
+		}
+
+		if next != last+1 {
+			return fmt.Errorf("%w: event %d", ErrNoEvent, next)
+		}
+
+		if err = f(events); err != nil {
+			return err
+		}
+
+		if progress != nil {
+			progress(next, count)
+		}
+	}
+	return nil
+}
+
+// sameEvent reports whether two copies of an event are identical.
+func sameEvent(a, b *Event) bool {
+	if a.Serial != b.Serial || a.When != b.When || a.Received != b.Received ||
+		a.Level != b.Level || a.Actor != b.Actor || a.Event != b.Event || a.Digest != b.Digest ||
+		len(a.Attributes) != len(b.Attributes) || !bytes.Equal(a.Signature, b.Signature) {
+		return false
+	}
+
+	for i := range a.Attributes {
+		if a.Attributes[i] != b.Attributes[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package auditlog
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	src := NewMemoryStore()
+	l, err := NewWithStore(src, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+
+	for i := 0; i < backupBatch+10; i++ {
+		l.InfoSync("migrate_test", "event", []Attribute{{"n", "v"}})
+	}
+	l.Stop()
+
+	count, err := src.Count()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var calls int
+	var done uint64
+	dst := NewMemoryStore()
+	err = Migrate(context.Background(), dst, src, &signer.PublicKey, func(n, total uint64) {
+		calls++
+		done = n
+		if total != count {
+			t.Errorf("expected a total of %d events, have %d", count, total)
+		}
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Two batches are copied, and then cross-verified.
+	if calls != 4 || done != count {
+		t.Fatalf("expected 4 progress reports ending at %d, have %d ending at %d", count, calls, done)
+	}
+
+	// A logger can pick up the migrated chain.
+	l, err = NewWithStore(dst, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	l.InfoSync("migrate_test", "after migration", nil)
+	l.Stop()
+
+	if err = Migrate(context.Background(), dst, src, &signer.PublicKey, nil); err == nil {
+		t.Fatal("expected migration into a non-empty store to fail")
+	}
+
+	// A damaged chain isn't copied.
+	damaged := &damagedStore{MemoryStore: src, missing: count, altered: 5}
+	err = Migrate(context.Background(), NewMemoryStore(), damaged, &signer.PublicKey, nil)
+	if !errors.Is(err, errAuditFailure) {
+		t.Fatalf("expected a verification failure, have %v", err)
+	}
+
+	damaged = &damagedStore{MemoryStore: src, missing: 5, altered: count}
+	err = Migrate(context.Background(), NewMemoryStore(), damaged, &signer.PublicKey, nil)
+	if !errors.Is(err, ErrNoEvent) {
+		t.Fatalf("expected a missing event, have %v", err)
+	}
+}
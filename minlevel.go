@@ -0,0 +1,87 @@
+package auditlog
+
+import "errors"
+
+// EventMinLevel is the event recorded as the logger starts, giving the
+// minimum level of the events it will record.
+const EventMinLevel = "minimum level"
+
+// levelInternal is passed to accept for events generated by the
+// logger itself, which are recorded regardless of the minimum level.
+const levelInternal = -1
+
+// WithMinLevel sets the minimum level of events that are recorded;
+// events below it (e.g. DEBUG events when the minimum is "INFO") are
+// discarded without being signed or stored. Unknown level names are
+// ignored.
+func WithMinLevel(level string) Option {
+	return func(l *Logger) {
+		if lvl := levelFromString(level); lvl != levelUnknown {
+			l.minLevel = lvl
+		}
+	}
+}
+
+// MinLevel returns the minimum level of events that are recorded.
+func (l *Logger) MinLevel() string {
+	l.state.RLock()
+	defer l.state.RUnlock()
+
+	if l.minLevel == levelUnknown {
+		return levelStrings[levelDebug]
+	}
+	return levelStrings[l.minLevel]
+}
+
+// SetMinLevel changes the minimum level of events that are recorded.
+// The change is itself recorded in the chain as a WARNING event, so
+// that gaps in lower-level events can be accounted for; SetMinLevel
+// waits for that event to be recorded. A change made while the logger
+// is stopped can't be recorded then, and is instead recorded when the
+// logger is next started.
+func (l *Logger) SetMinLevel(level string) error {
+	lvl := levelFromString(level)
+	if lvl == levelUnknown {
+		return errors.New("auditlog: unknown level " + level)
+	}
+
+	old := l.MinLevel()
+
+	l.state.Lock()
+	l.minLevel = lvl
+	running := l.running
+	l.state.Unlock()
+
+	if !running {
+		return nil
+	}
+
+	l.logInternal(levelWarning, "minimum level change", []Attribute{
+		{"old", old},
+		{"new", levelStrings[lvl]},
+	})
+	return nil
+}
+
+// recordMinLevel records the minimum level in effect as the logger
+// starts, so that the chain accounts for the lower-level events that
+// were never recorded. Nothing is recorded if no minimum was set.
+func (l *Logger) recordMinLevel() {
+	l.state.RLock()
+	lvl := l.minLevel
+	l.state.RUnlock()
+
+	if lvl == levelUnknown {
+		return
+	}
+
+	l.logInternal(levelInfo, EventMinLevel, []Attribute{
+		{"level", levelStrings[lvl]},
+	})
+}
+
+// LevelAtLeast reports whether level (e.g. "ERROR") is at or above
+// min, ignoring case. Unknown levels are below every known level.
+func LevelAtLeast(level, min string) bool {
+	return levelFromString(level) >= levelFromString(min)
+}
@@ -0,0 +1,41 @@
+package auditlog
+
+import "testing"
+
+func TestMinLevelRecorded(t *testing.T) {
+	l, store := newTestLogger(t, WithMinLevel("WARNING"))
+	if err := l.Start(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	// A change made while the logger is stopped is recorded when it
+	// starts again.
+	if err := l.SetMinLevel("ERROR"); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if err := l.Start(); err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.InfoSync("minlevel_test", "filtered", nil)
+	l.Stop()
+
+	events, err := store.Events(0, 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	var levels []string
+	for _, ev := range events {
+		if ev.Event == "filtered" {
+			t.Fatal("expected the INFO event to be filtered out")
+		}
+		if ev.Actor == internalActor && ev.Event == EventMinLevel {
+			levels = append(levels, ev.Attributes[0].Value)
+		}
+	}
+
+	if len(levels) != 2 || levels[0] != "WARNING" || levels[1] != "ERROR" {
+		t.Fatalf("expected the minimum levels WARNING and ERROR to be recorded, have %v", levels)
+	}
+}
@@ -0,0 +1,383 @@
+package auditlog
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlSchema is the MySQL schema for the audit chain; it matches
+// auditlog.sql, with MySQL's types.
+//
+//go:embed auditlog_mysql.sql
+var mysqlSchema string
+
+// A mysqlStore keeps the audit chain in a MySQL or MariaDB database.
+// It uses the same tables as the Postgres store, and the same queries,
+// with MySQL's placeholders. Pruning, compression, leases, and
+// write-once roles are only supported by Postgres.
+type mysqlStore struct {
+	db    *sql.DB
+	dsn   string
+	stmts *stmtCache
+}
+
+// mysqlDSN returns the MySQL driver's data source name for cd. The
+// port defaults to 3306; SSL verifies the server's certificate.
+func mysqlDSN(cd *DBConnDetails) string {
+	cfg := mysql.NewConfig()
+	cfg.User = cd.User
+	cfg.Passwd = cd.Password
+	cfg.DBName = cd.Name
+	cfg.Net = "tcp"
+
+	host, port := cd.Host, cd.Port
+	if host == "" {
+		host = "localhost"
+	}
+	if port == "" {
+		port = "3306"
+	}
+	cfg.Addr = net.JoinHostPort(host, port)
+
+	if cd.SSL {
+		cfg.TLSConfig = "true"
+	}
+	return cfg.FormatDSN()
+}
+
+// NewMySQLStore connects to the MySQL or MariaDB database described by
+// cd, creating the audit tables if they aren't present.
+func NewMySQLStore(cd *DBConnDetails) (Store, error) {
+	return openMySQLStore(mysqlDSN(cd))
+}
+
+// openMySQLStore connects to the database named by a MySQL driver data
+// source name (user:password@tcp(host:3306)/dbname).
+func openMySQLStore(dsn string) (Store, error) {
+	s := &mysqlStore{dsn: dsn}
+	err := s.Reopen()
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.createSchema()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	// The statements couldn't be prepared before their tables
+	// existed.
+	if created {
+		s.stmts.close()
+		s.stmts = newStmtCache(s.db, rebind)
+	}
+	return s, nil
+}
+
+// Reopen connects to the database.
+func (s *mysqlStore) Reopen() error {
+	db, err := sql.Open("mysql", s.dsn)
+	if err != nil {
+		return err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	s.db = db
+	s.stmts = newStmtCache(db, rebind)
+	return nil
+}
+
+// mysqlAddedTables creates the tables added to the schema since it
+// was first published, in databases created before them.
+var mysqlAddedTables = []string{
+	`CREATE TABLE IF NOT EXISTS signing_keys (
+    first_serial BIGINT PRIMARY KEY,
+    public_key   BLOB NOT NULL
+)`,
+	`CREATE TABLE IF NOT EXISTS checkpoints (
+    serial      BIGINT PRIMARY KEY,
+    taken       BIGINT NOT NULL,
+    head        VARCHAR(64) NOT NULL,
+    signature   BLOB NOT NULL
+)`,
+	`CREATE TABLE IF NOT EXISTS cosignatures (
+    serial      BIGINT NOT NULL,
+    witness     VARCHAR(255) NOT NULL,
+    signature   BLOB NOT NULL,
+    PRIMARY KEY (serial, witness)
+)`,
+}
+
+// mysqlAddedIndexes are the indexes added to the schema since it was
+// first published, by name.
+var mysqlAddedIndexes = map[string]string{
+	"events_actor":          "events (actor(191), id)",
+	"events_level":          "events (level(16), id)",
+	"attributes_name_value": "attributes (name(64), value(191))",
+}
+
+// addIndexes creates the mysqlAddedIndexes missing from a database
+// created before them. MySQL, unlike MariaDB, has no CREATE INDEX IF
+// NOT EXISTS.
+func (s *mysqlStore) addIndexes() error {
+	for name, definition := range mysqlAddedIndexes {
+		var present bool
+		err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM information_schema.statistics
+			WHERE table_schema = DATABASE() AND index_name = ?)`, name).Scan(&present)
+		if err != nil {
+			return err
+		}
+
+		if !present {
+			if _, err = s.db.Exec(`CREATE INDEX ` + name + ` ON ` + definition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// createSchema creates the audit tables if they aren't present. MySQL
+// commits each CREATE as it runs, so a failure can leave the schema
+// partly created.
+func (s *mysqlStore) createSchema() (bool, error) {
+	var present bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_name = 'events')`).Scan(&present)
+	if err != nil {
+		return false, err
+	} else if present {
+		for _, stmt := range mysqlAddedTables {
+			if _, err = s.db.Exec(stmt); err != nil {
+				return false, err
+			}
+		}
+		return false, s.addIndexes()
+	}
+
+	// The driver runs one statement at a time.
+	for _, stmt := range strings.Split(mysqlSchema, ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+
+		if _, err = s.db.Exec(stmt); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// RecordsDigests reports that MySQL databases record digest versions.
+func (s *mysqlStore) RecordsDigests() bool {
+	return true
+}
+
+// placeholder matches a numbered placeholder.
+var placeholder = regexp.MustCompile(`\$[0-9]+`)
+
+// rebind rewrites a query's numbered placeholders for MySQL, which
+// only understands ?; the placeholders must appear in order, each
+// once. The shared queries are run in a MySQL transaction through a
+// preparedTx, which rebinds them.
+func rebind(query string) string {
+	return placeholder.ReplaceAllLiteralString(query, "?")
+}
+
+// withTx runs f in a transaction, committing if f succeeds and
+// rolling back otherwise.
+func (s *mysqlStore) withTx(f func(tx preparedTx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = f(s.stmts.bind(tx))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *mysqlStore) StoreEvent(ev *Event) error {
+	return mysqlDuplicateSerial(s.withTx(func(tx preparedTx) error {
+		return storeEvent(tx, true, ev)
+	}))
+}
+
+// StoreEvents records a run of signed events in one transaction.
+func (s *mysqlStore) StoreEvents(events []*Event) error {
+	return mysqlDuplicateSerial(s.withTx(func(tx preparedTx) error {
+		for _, ev := range events {
+			if err := storeEvent(tx, true, ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// StoreError records an error event. MySQL has no RETURNING clause, so
+// the error event's row ID is taken from the insert's result.
+func (s *mysqlStore) StoreError(ev *ErrorEvent) error {
+	return s.withTx(func(tx preparedTx) error {
+		res, err := tx.Exec(`INSERT INTO error_events
+			(serial, timestamp, received, level, actor, event)
+			values ($1, $2, $3, $4, $5, $6)`,
+			ev.Event.Serial, ev.Event.When, ev.Event.Received,
+			ev.Event.Level, ev.Event.Actor, ev.Event.Event)
+		if err != nil {
+			return err
+		}
+
+		eventID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO errors (timestamp, event, message)
+			values ($1, $2, $3)`,
+			ev.When, eventID, ev.Message)
+		if err != nil {
+			return err
+		}
+
+		return insertAttributes(tx, "error_attributes", uint64(eventID), ev.Event.Attributes)
+	})
+}
+
+// StoreKey records a key in the signing_keys table, unless a key has
+// already been recorded for its first serial number.
+func (s *mysqlStore) StoreKey(rec KeyRecord) error {
+	_, err := s.db.Exec(`INSERT IGNORE INTO signing_keys (first_serial, public_key) VALUES (?, ?)`,
+		rec.First, rec.PublicKey)
+	return err
+}
+
+func (s *mysqlStore) Keys() ([]KeyRecord, error) {
+	return loadKeyRecords(s.db)
+}
+
+// StoreCheckpoint records a signed checkpoint in the checkpoints table,
+// unless its event has already been checkpointed.
+func (s *mysqlStore) StoreCheckpoint(sc SignedCheckpoint) error {
+	_, err := s.db.Exec(`INSERT IGNORE INTO checkpoints (serial, taken, head, signature) VALUES (?, ?, ?, ?)`,
+		sc.Serial, sc.When, sc.Head, sc.Signature)
+	return err
+}
+
+func (s *mysqlStore) LatestCheckpoint() (*SignedCheckpoint, error) {
+	return loadLatestCheckpoint(s.db)
+}
+
+// StoreCosignature records a witness's cosignature of a checkpoint in
+// the cosignatures table, unless the witness has already cosigned it.
+func (s *mysqlStore) StoreCosignature(cs Cosignature) error {
+	_, err := s.db.Exec(`INSERT IGNORE INTO cosignatures (serial, witness, signature) VALUES (?, ?, ?)`,
+		cs.Serial, cs.Witness, cs.Signature)
+	return err
+}
+
+func (s *mysqlStore) Cosignatures(serial uint64) (sigs []Cosignature, err error) {
+	err = s.withTx(func(tx preparedTx) error {
+		sigs, err = loadCosignatures(tx, serial)
+		return err
+	})
+	return
+}
+
+func (s *mysqlStore) Count() (uint64, error) {
+	var count uint64
+	err := s.db.QueryRow(`SELECT COALESCE(MAX(id) + 1, 0) FROM events`).Scan(&count)
+	return count, err
+}
+
+func (s *mysqlStore) Event(serial uint64) (ev *Event, err error) {
+	err = s.withTx(func(tx preparedTx) error {
+		ev, err = loadEvent(tx, true, serial)
+		if err == sql.ErrNoRows {
+			err = ErrNoEvent
+		}
+		return err
+	})
+	return
+}
+
+func (s *mysqlStore) Events(start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx preparedTx) error {
+		events, err = loadEvents(tx, true, start, end)
+		return err
+	})
+	return
+}
+
+// EventsByActor loads the events recorded by actor with serial numbers
+// in the range [start, end].
+func (s *mysqlStore) EventsByActor(actor string, start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx preparedTx) error {
+		events, err = loadActorEvents(tx, true, actor, start, end)
+		return err
+	})
+	return
+}
+
+// EventsByLevel loads the events at any of levels with serial numbers
+// in the range [start, end].
+func (s *mysqlStore) EventsByLevel(levels []string, start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx preparedTx) error {
+		events, err = loadLevelEvents(tx, true, levels, start, end)
+		return err
+	})
+	return
+}
+
+// EventsByAttribute loads the events with serial numbers in the range
+// [start, end] that carry attr, along with any compressed events.
+func (s *mysqlStore) EventsByAttribute(attr Attribute, start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx preparedTx) error {
+		events, err = loadAttributeEvents(tx, true, attr, start, end)
+		return err
+	})
+	return
+}
+
+func (s *mysqlStore) Errors(start, end uint64) (events []*ErrorEvent, err error) {
+	err = s.withTx(func(tx preparedTx) error {
+		events, err = loadErrors(tx, start, end)
+		return err
+	})
+	return
+}
+
+func (s *mysqlStore) Close() error {
+	s.stmts.close()
+	return s.db.Close()
+}
+
+// erDupEntry is MySQL's error number for a duplicate key.
+const erDupEntry = 1062
+
+// mysqlDuplicateSerial maps the duplicate key error raised when an
+// event's serial number is already taken to ErrDuplicateSerial. Only
+// the events table's primary key is set by the logger, so a duplicate
+// primary key can only be a serial number.
+func mysqlDuplicateSerial(err error) error {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) && myErr.Number == erDupEntry && strings.Contains(myErr.Message, "PRIMARY") {
+		return ErrDuplicateSerial
+	}
+	return err
+}
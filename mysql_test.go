@@ -0,0 +1,22 @@
+package auditlog
+
+import "testing"
+
+func TestMySQLQueries(t *testing.T) {
+	query := rebind(`INSERT INTO attributes (name, value, event, position) values ($1, $2, $3, $4)`)
+	if query != `INSERT INTO attributes (name, value, event, position) values (?, ?, ?, ?)` {
+		t.Fatalf("placeholders weren't rewritten: %s", query)
+	}
+
+	dsn := mysqlDSN(&DBConnDetails{
+		Backend:  "mysql",
+		Name:     "auditlog",
+		User:     "auditor",
+		Password: "secret",
+		Host:     "db1",
+		SSL:      true,
+	})
+	if dsn != "auditor:secret@tcp(db1:3306)/auditlog?tls=true" {
+		t.Fatalf("unexpected data source name %s", dsn)
+	}
+}
@@ -0,0 +1,177 @@
+package auditlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// OCSFVersion is the version of the Open Cybersecurity Schema
+// Framework that OCSFExporter produces.
+const OCSFVersion = "1.1.0"
+
+// An OCSFClass is the OCSF event class an event is exported as, with
+// the activity it records.
+type OCSFClass struct {
+	ClassUID    int
+	CategoryUID int
+	ActivityID  int
+}
+
+// Common OCSF classes for audit events. Each records an activity of
+// zero, unknown; set ActivityID to name the activity.
+var (
+	// OCSFBaseEvent is the class of events with no other class.
+	OCSFBaseEvent = OCSFClass{ClassUID: 0, CategoryUID: 0}
+
+	// OCSFAccountChange records changes to accounts.
+	OCSFAccountChange = OCSFClass{ClassUID: 3001, CategoryUID: 3}
+
+	// OCSFAuthentication records logons and logoffs.
+	OCSFAuthentication = OCSFClass{ClassUID: 3002, CategoryUID: 3}
+
+	// OCSFAPIActivity records calls to APIs.
+	OCSFAPIActivity = OCSFClass{ClassUID: 6003, CategoryUID: 6}
+)
+
+// An OCSFExporter renders events as OCSF events in JSON, so that the
+// chain can be loaded into security data lakes. The product's vendor,
+// name, and version default to "auditlog", "auditlog", and "1".
+// Events are exported as the class their event name maps to in
+// Classes, or else as OCSFBaseEvent, and are mapped as follows:
+//
+//	class_uid, category_uid  the class
+//	activity_id, type_uid    the class's activity
+//	severity_id, severity    DEBUG and INFO 1 (Informational),
+//	                         WARNING 3 (Medium), ERROR 4 (High),
+//	                         CRITICAL 5 (Critical)
+//	time                     the time logged, in milliseconds since
+//	                         the epoch
+//	message                  the event
+//	actor.user.name          the actor
+//	metadata.uid             the serial number
+//	metadata.sequence        the serial number
+//	unmapped                 the attributes, by name
+type OCSFExporter struct {
+	Vendor  string
+	Product string
+	Version string
+	Classes map[string]OCSFClass
+}
+
+// ocsfSeverities maps levels to OCSF severity IDs and captions.
+var ocsfSeverities = map[string]struct {
+	id      int
+	caption string
+}{
+	"DEBUG":    {1, "Informational"},
+	"INFO":     {1, "Informational"},
+	"WARNING":  {3, "Medium"},
+	"ERROR":    {4, "High"},
+	"CRITICAL": {5, "Critical"},
+}
+
+type ocsfProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+	Version    string `json:"version"`
+}
+
+type ocsfMetadata struct {
+	Version  string      `json:"version"`
+	Product  ocsfProduct `json:"product"`
+	UID      string      `json:"uid"`
+	Sequence uint64      `json:"sequence"`
+}
+
+type ocsfUser struct {
+	Name string `json:"name"`
+}
+
+type ocsfActor struct {
+	User ocsfUser `json:"user"`
+}
+
+type ocsfEvent struct {
+	ClassUID    int               `json:"class_uid"`
+	CategoryUID int               `json:"category_uid"`
+	ActivityID  int               `json:"activity_id"`
+	TypeUID     int               `json:"type_uid"`
+	SeverityID  int               `json:"severity_id"`
+	Severity    string            `json:"severity"`
+	Time        int64             `json:"time"`
+	Message     string            `json:"message"`
+	Actor       ocsfActor         `json:"actor"`
+	Metadata    ocsfMetadata      `json:"metadata"`
+	Unmapped    map[string]string `json:"unmapped,omitempty"`
+}
+
+// event returns the OCSF event for ev.
+func (x OCSFExporter) event(ev *Event) ocsfEvent {
+	product := ocsfProduct{Name: x.Product, VendorName: x.Vendor, Version: x.Version}
+	if product.Name == "" {
+		product.Name = "auditlog"
+	}
+	if product.VendorName == "" {
+		product.VendorName = "auditlog"
+	}
+	if product.Version == "" {
+		product.Version = "1"
+	}
+
+	class, ok := x.Classes[ev.Event]
+	if !ok {
+		class = OCSFBaseEvent
+	}
+
+	severity, ok := ocsfSeverities[ev.Level]
+	if !ok {
+		severity.caption = "Unknown"
+	}
+
+	oe := ocsfEvent{
+		ClassUID:    class.ClassUID,
+		CategoryUID: class.CategoryUID,
+		ActivityID:  class.ActivityID,
+		TypeUID:     class.ClassUID*100 + class.ActivityID,
+		SeverityID:  severity.id,
+		Severity:    severity.caption,
+		Time:        ev.When / int64(time.Millisecond),
+		Message:     ev.Event,
+		Actor:       ocsfActor{User: ocsfUser{Name: ev.Actor}},
+		Metadata: ocsfMetadata{
+			Version:  OCSFVersion,
+			Product:  product,
+			UID:      strconv.FormatUint(ev.Serial, 10),
+			Sequence: ev.Serial,
+		},
+	}
+
+	if len(ev.Attributes) > 0 {
+		oe.Unmapped = map[string]string{}
+		for _, attr := range ev.Attributes {
+			oe.Unmapped[attr.Name] = attr.Value
+		}
+	}
+	return oe
+}
+
+// Format renders an event as an OCSF event, in a single line of JSON.
+func (x OCSFExporter) Format(ev *Event) string {
+	// A struct of strings, numbers, and maps of strings always
+	// marshals.
+	out, _ := json.Marshal(x.event(ev))
+	return string(out)
+}
+
+// Export writes events to w as OCSF events, one JSON object per line.
+func (x OCSFExporter) Export(w io.Writer, events []*Event) error {
+	bw := bufio.NewWriter(w)
+	for _, ev := range events {
+		bw.WriteString(x.Format(ev))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
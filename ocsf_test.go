@@ -0,0 +1,42 @@
+package auditlog
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOCSFExporter(t *testing.T) {
+	ev := &Event{
+		Serial:     7,
+		When:       time.Date(2014, time.October, 6, 12, 0, 0, 0, time.UTC).UnixNano(),
+		Level:      "WARNING",
+		Actor:      "jqp",
+		Event:      "login",
+		Attributes: []Attribute{{"method", "password"}},
+	}
+
+	authentication := OCSFAuthentication
+	authentication.ActivityID = 1
+	x := OCSFExporter{Classes: map[string]OCSFClass{"login": authentication}}
+
+	expected := `{"class_uid":3002,"category_uid":3,"activity_id":1,"type_uid":300201,"severity_id":3,"severity":"Medium","time":1412596800000,"message":"login","actor":{"user":{"name":"jqp"}},"metadata":{"version":"1.1.0","product":{"name":"auditlog","vendor_name":"auditlog","version":"1"},"uid":"7","sequence":7},"unmapped":{"method":"password"}}`
+	if line := x.Format(ev); line != expected {
+		t.Fatalf("expected %s, have %s", expected, line)
+	}
+
+	// Events without a class are base events.
+	ev.Event = "logout"
+	var oe map[string]interface{}
+	if err := json.Unmarshal([]byte(x.Format(ev)), &oe); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	want := map[string]interface{}{"class_uid": 0.0, "category_uid": 0.0, "type_uid": 0.0}
+	for name, value := range want {
+		if !reflect.DeepEqual(oe[name], value) {
+			t.Fatalf("expected %s to be %v, have %v", name, value, oe[name])
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package auditlog
+
+import (
+	"strconv"
+	"sync"
+)
+
+// EventDropped is recorded, as a WARNING, after events were dropped
+// because the queue was full; its "count" attribute gives the number
+// of events lost.
+const EventDropped = "events dropped"
+
+// An OverflowPolicy decides what becomes of an event logged by one of
+// the methods that don't wait for it to be recorded, such as Info,
+// when the queue is full. Events logged by methods that wait, such as
+// InfoSync, always wait for room in the queue.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes the caller wait until there is room in
+	// the queue. This is the default: no event is lost, but a
+	// caller logging faster than events can be recorded is slowed
+	// to the rate at which they are.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDrop discards the event, so that callers never wait.
+	// The number of events dropped is recorded in the chain as an
+	// "events dropped" event once the queue has room again.
+	OverflowDrop
+
+	// OverflowExpand holds the event in memory beyond the queue's
+	// capacity, so that callers never wait and no event is lost,
+	// at the cost of memory that grows without bound while events
+	// are logged faster than they can be recorded. While events
+	// are held, those logged by the methods that wait join them,
+	// so that each caller's events are recorded in order.
+	OverflowExpand
+)
+
+// overflowPolicies maps the names used in configuration files to
+// overflow policies.
+var overflowPolicies = map[string]OverflowPolicy{
+	"":       OverflowBlock,
+	"block":  OverflowBlock,
+	"drop":   OverflowDrop,
+	"expand": OverflowExpand,
+}
+
+// WithQueueSize sets the depth of the queue of events waiting to be
+// recorded. If size isn't positive, DefaultQueueSize is used.
+func WithQueueSize(size int) Option {
+	return func(l *Logger) {
+		if size > 0 {
+			l.queueSize = size
+		}
+	}
+}
+
+// WithOverflowPolicy sets what happens to events that don't wait to
+// be recorded when the queue is full.
+//
+// With OverflowBlock, callbacks run while events are recorded, such
+// as tees and alert hooks, must not log to the same logger: if the
+// queue is full, they would wait on themselves.
+func WithOverflowPolicy(policy OverflowPolicy) Option {
+	return func(l *Logger) {
+		l.overflow = policy
+	}
+}
+
+// QueueStats describes the queue of events waiting to be recorded.
+// Queued is the number of events in the queue, and Capacity its depth.
+// Expanded is the number of events held beyond the queue's capacity
+// under OverflowExpand, and PeakExpanded the most ever held. Dropped
+// is the number of events dropped under OverflowDrop since the logger
+// was created.
+type QueueStats struct {
+	Queued       int
+	Capacity     int
+	Expanded     int
+	PeakExpanded int
+	Dropped      uint64
+}
+
+// QueueStats returns the statistics for the logger's queue.
+func (l *Logger) QueueStats() QueueStats {
+	var stats QueueStats
+	l.state.RLock()
+	if l.running {
+		stats.Queued = len(l.listener)
+		stats.Capacity = cap(l.listener)
+	}
+	l.state.RUnlock()
+
+	l.expanded.lock.Lock()
+	stats.Expanded = len(l.expanded.events)
+	stats.PeakExpanded = l.expanded.peak
+	l.expanded.lock.Unlock()
+
+	l.dropped.lock.Lock()
+	stats.Dropped = l.dropped.total
+	l.dropped.lock.Unlock()
+	return stats
+}
+
+// A dropCount counts the events dropped since they were last
+// reported, and in total.
+type dropCount struct {
+	lock  sync.Mutex
+	count uint64
+	total uint64
+}
+
+func (d *dropCount) add() {
+	d.lock.Lock()
+	d.count++
+	d.total++
+	d.lock.Unlock()
+}
+
+// take returns the number of events dropped, and resets it.
+func (d *dropCount) take() uint64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	count := d.count
+	d.count = 0
+	return count
+}
+
+// An expansion holds the events waiting beyond the queue's capacity
+// under OverflowExpand, in the order they were logged.
+type expansion struct {
+	lock   sync.Mutex
+	events []*Event
+	peak   int
+}
+
+// enqueue sends an event to the queue, applying the overflow policy
+// if the caller isn't waiting for it, and marks it as no longer
+// pending once it has been queued or dropped.
+func (l *Logger) enqueue(ev *Event) {
+	if l.overflow == OverflowExpand {
+		l.expand(ev)
+		return
+	}
+	defer l.pending.Done()
+
+	if ev.wait != nil || l.overflow != OverflowDrop {
+		l.listener <- ev
+		return
+	}
+
+	select {
+	case l.listener <- ev:
+	default:
+		if ev.journalID != 0 {
+			l.journal.ack(ev.journalID)
+		}
+		l.dropped.add()
+		releaseEvent(ev)
+	}
+}
+
+// expand sends an event to the queue if there is room and no events
+// are held beyond it; otherwise, the event is held, and a pump sends
+// the held events on in order. Held events remain pending until they
+// are queued, so that Stop waits for them.
+func (l *Logger) expand(ev *Event) {
+	x := &l.expanded
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if len(x.events) == 0 {
+		select {
+		case l.listener <- ev:
+			l.pending.Done()
+			return
+		default:
+		}
+
+		// The pump can't take the lock until the event has
+		// been added.
+		go l.pump()
+	}
+
+	x.events = append(x.events, ev)
+	if len(x.events) > x.peak {
+		x.peak = len(x.events)
+	}
+}
+
+// pump sends the events held by expand to the queue, returning once
+// there are none left. An event is only removed once it has been
+// queued, so that an event logged meanwhile can't overtake it.
+func (l *Logger) pump() {
+	x := &l.expanded
+	x.lock.Lock()
+	for len(x.events) > 0 {
+		ev := x.events[0]
+		x.lock.Unlock()
+		l.listener <- ev
+		l.pending.Done()
+
+		x.lock.Lock()
+		x.events[0] = nil
+		x.events = x.events[1:]
+	}
+	x.lock.Unlock()
+}
+
+// recordDropped records the number of events dropped since it was
+// last called, if any were; the caller must hold the lock. An event
+// can only be dropped while the queue is full, so the processor
+// always takes another event from the queue, and reports the drop,
+// afterwards.
+func (l *Logger) recordDropped() {
+	count := l.dropped.take()
+	if count == 0 {
+		return
+	}
+
+	l.record(&Event{
+		When:  l.now(),
+		Level: levelStrings[levelWarning],
+		Actor: internalActor,
+		Event: EventDropped,
+		Attributes: []Attribute{
+			{"count", strconv.FormatUint(count, 10)},
+		},
+	})
+}
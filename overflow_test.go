@@ -0,0 +1,82 @@
+package auditlog
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestOverflowPolicy(t *testing.T) {
+	const logged = 50
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDrop, OverflowExpand} {
+		l, store := newTestLogger(t, WithQueueSize(1), WithOverflowPolicy(policy))
+		l.Start()
+
+		// While the logger is blocked, callers either wait for the
+		// queue, drop their events, or have them held.
+		done := make(chan struct{})
+		l.lock.Lock()
+		go func() {
+			for i := 0; i < logged; i++ {
+				l.Info("overflow_test", "event", []Attribute{{"i", strconv.Itoa(i)}})
+			}
+			close(done)
+		}()
+
+		if policy != OverflowBlock {
+			<-done
+		}
+		l.lock.Unlock()
+		<-done
+		l.Stop()
+		stats := l.QueueStats()
+
+		count, err := store.Count()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		events, err := store.Events(0, count-1)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		var recorded, dropped int
+		for _, ev := range events {
+			switch {
+			case ev.Actor == "overflow_test":
+				if i, _ := ev.attr("i"); policy != OverflowDrop && i != strconv.Itoa(recorded) {
+					t.Fatalf("event %s was recorded out of order", i)
+				}
+				recorded++
+			case ev.Event == EventDropped:
+				value, _ := ev.attr("count")
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					t.Fatalf("%v", err)
+				}
+				dropped += n
+			}
+		}
+
+		if recorded+dropped != logged {
+			t.Fatalf("expected %d events to be recorded or dropped, have %d recorded and %d dropped",
+				logged, recorded, dropped)
+		}
+
+		if policy != OverflowDrop && dropped != 0 {
+			t.Fatalf("expected no events to be dropped, have %d", dropped)
+		}
+
+		if policy == OverflowDrop && dropped == 0 {
+			t.Fatal("expected events to be dropped")
+		}
+
+		if stats.Dropped != uint64(dropped) {
+			t.Fatalf("expected %d dropped events in the queue statistics, have %d", dropped, stats.Dropped)
+		}
+
+		if (policy == OverflowExpand) != (stats.PeakExpanded > 0) || stats.Expanded != 0 {
+			t.Fatalf("unexpected queue statistics %+v", stats)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+// Package pkcs11 signs the audit chain with an ECDSA key held in a
+// PKCS#11 token, such as an HSM, so that the chain's key never leaves
+// the token. A Signer is a crypto.Signer, to be passed to
+// auditlog.NewWithSigner.
+//
+// Tokens can be reset while the logger runs: an HSM may be rebooted
+// or fail over, or a USB token may be pulled and reinserted. When a
+// signature fails because the session or the token has gone away, the
+// Signer reconnects, logging in and finding the key again, and retries
+// the signature.
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+
+	p11 "github.com/miekg/pkcs11"
+)
+
+// DefaultRetries is the number of times a signature is retried after
+// a token reset when Config.Retries is zero.
+const DefaultRetries = 3
+
+// DefaultRetryDelay is the time waited before reconnecting to a reset
+// token when Config.RetryDelay is zero.
+const DefaultRetryDelay = time.Second
+
+// Config describes the token and the key to sign with.
+type Config struct {
+	// Module is the path to the token's PKCS#11 library.
+	Module string `yaml:"module" toml:"module"`
+
+	// TokenLabel selects the slot holding the token with this
+	// label. If it is empty, Slot is used.
+	TokenLabel string `yaml:"token_label" toml:"token_label"`
+
+	// Slot is the ID of the slot holding the token.
+	Slot uint `yaml:"slot" toml:"slot"`
+
+	// PIN is the user PIN for the token.
+	PIN string `yaml:"pin" toml:"pin"`
+
+	// KeyLabel is the label of the signing key. The token must
+	// hold both the private key and the public key under it.
+	KeyLabel string `yaml:"key_label" toml:"key_label"`
+
+	// Retries is the number of times a signature is retried,
+	// reconnecting each time, after the token is reset. If it is
+	// zero, DefaultRetries is used; if it is negative, signatures
+	// aren't retried.
+	Retries int `yaml:"retries" toml:"retries"`
+
+	// RetryDelay is the time waited before each reconnection. If
+	// it is zero, DefaultRetryDelay is used.
+	RetryDelay time.Duration `yaml:"retry_delay" toml:"retry_delay"`
+}
+
+// module is the part of the PKCS#11 API the Signer uses; *p11.Ctx
+// implements it.
+type module interface {
+	Initialize() error
+	Finalize() error
+	GetSlotList(tokenPresent bool) ([]uint, error)
+	GetTokenInfo(slotID uint) (p11.TokenInfo, error)
+	OpenSession(slotID uint, flags uint) (p11.SessionHandle, error)
+	CloseSession(sh p11.SessionHandle) error
+	Login(sh p11.SessionHandle, userType uint, pin string) error
+	FindObjectsInit(sh p11.SessionHandle, temp []*p11.Attribute) error
+	FindObjects(sh p11.SessionHandle, max int) ([]p11.ObjectHandle, bool, error)
+	FindObjectsFinal(sh p11.SessionHandle) error
+	GetAttributeValue(sh p11.SessionHandle, o p11.ObjectHandle, a []*p11.Attribute) ([]*p11.Attribute, error)
+	SignInit(sh p11.SessionHandle, m []*p11.Mechanism, o p11.ObjectHandle) error
+	Sign(sh p11.SessionHandle, message []byte) ([]byte, error)
+}
+
+// A Signer signs with an ECDSA key held in a PKCS#11 token. A PKCS#11
+// session can only carry one operation at a time, so signatures are
+// made one at a time.
+type Signer struct {
+	lock sync.Mutex
+	cfg  Config
+	mod  module
+	ctx  *p11.Ctx
+
+	public *ecdsa.PublicKey
+
+	// connected is set while session is open and logged in, and
+	// key is the handle of the private key in it.
+	connected bool
+	session   p11.SessionHandle
+	key       p11.ObjectHandle
+
+	// sleep waits between reconnections; tests replace it.
+	sleep func(time.Duration)
+}
+
+// New loads the PKCS#11 library named by cfg.Module, logs in to the
+// token, and finds the signing key.
+func New(cfg Config) (*Signer, error) {
+	ctx := p11.New(cfg.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("auditlog: failed to load PKCS#11 module %s", cfg.Module)
+	}
+
+	s, err := newSigner(ctx, cfg)
+	if err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+	s.ctx = ctx
+	return s, nil
+}
+
+func newSigner(mod module, cfg Config) (*Signer, error) {
+	if cfg.Retries == 0 {
+		cfg.Retries = DefaultRetries
+	}
+
+	if cfg.RetryDelay == 0 {
+		cfg.RetryDelay = DefaultRetryDelay
+	}
+
+	s := &Signer{cfg: cfg, mod: mod, sleep: time.Sleep}
+	if err := initialize(mod); err != nil {
+		return nil, err
+	}
+
+	if err := s.connect(); err != nil {
+		mod.Finalize()
+		return nil, err
+	}
+	return s, nil
+}
+
+// initialize initializes the library, which another part of the
+// process may already have done.
+func initialize(mod module) error {
+	err := mod.Initialize()
+	if err == p11.Error(p11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		err = nil
+	}
+	return err
+}
+
+// connect opens a session with the token, logs in, and finds the
+// key. The key's public half is loaded the first time; once it is
+// known, the key found on reconnecting must match it, so that a
+// token swapped for another can't go on signing the chain. The caller
+// must hold the lock.
+func (s *Signer) connect() error {
+	slot, err := s.findSlot()
+	if err != nil {
+		return err
+	}
+
+	session, err := s.mod.OpenSession(slot, p11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return err
+	}
+
+	err = s.mod.Login(session, p11.CKU_USER, s.cfg.PIN)
+	if err == p11.Error(p11.CKR_USER_ALREADY_LOGGED_IN) {
+		err = nil
+	}
+
+	var key, pubKey p11.ObjectHandle
+	if err == nil {
+		key, err = s.findObject(session, p11.CKO_PRIVATE_KEY)
+	}
+
+	if err == nil {
+		pubKey, err = s.findObject(session, p11.CKO_PUBLIC_KEY)
+	}
+
+	var public *ecdsa.PublicKey
+	if err == nil {
+		public, err = s.loadPublic(session, pubKey)
+	}
+
+	if err == nil && s.public != nil && !s.public.Equal(public) {
+		err = fmt.Errorf("auditlog: key %q on the token has changed", s.cfg.KeyLabel)
+	}
+
+	if err != nil {
+		s.mod.CloseSession(session)
+		return err
+	}
+
+	s.public = public
+	s.session, s.key, s.connected = session, key, true
+	return nil
+}
+
+// findSlot returns the slot holding the configured token.
+func (s *Signer) findSlot() (uint, error) {
+	if s.cfg.TokenLabel == "" {
+		return s.cfg.Slot, nil
+	}
+
+	slots, err := s.mod.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, slot := range slots {
+		info, err := s.mod.GetTokenInfo(slot)
+		if err != nil {
+			return 0, err
+		}
+
+		if info.Label == s.cfg.TokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("auditlog: no PKCS#11 token labelled %q", s.cfg.TokenLabel)
+}
+
+// findObject finds the only key of the given class with the
+// configured label.
+func (s *Signer) findObject(session p11.SessionHandle, class uint) (p11.ObjectHandle, error) {
+	err := s.mod.FindObjectsInit(session, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, class),
+		p11.NewAttribute(p11.CKA_KEY_TYPE, p11.CKK_EC),
+		p11.NewAttribute(p11.CKA_LABEL, s.cfg.KeyLabel),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	objects, _, err := s.mod.FindObjects(session, 2)
+	if ferr := s.mod.FindObjectsFinal(session); err == nil {
+		err = ferr
+	}
+
+	switch {
+	case err != nil:
+		return 0, err
+	case len(objects) == 0:
+		return 0, fmt.Errorf("auditlog: no EC key labelled %q on the token", s.cfg.KeyLabel)
+	case len(objects) > 1:
+		return 0, fmt.Errorf("auditlog: more than one EC key labelled %q on the token", s.cfg.KeyLabel)
+	}
+	return objects[0], nil
+}
+
+// curves maps the OIDs naming the supported curves, as they appear in
+// CKA_EC_PARAMS, to the curves.
+var curves = map[string]elliptic.Curve{
+	"1.2.840.10045.3.1.7": elliptic.P256(),
+	"1.3.132.0.34":        elliptic.P384(),
+	"1.3.132.0.35":        elliptic.P521(),
+}
+
+// loadPublic reads the public key from its object on the token.
+func (s *Signer) loadPublic(session p11.SessionHandle, pubKey p11.ObjectHandle) (*ecdsa.PublicKey, error) {
+	attrs, err := s.mod.GetAttributeValue(session, pubKey, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_EC_PARAMS, nil),
+		p11.NewAttribute(p11.CKA_EC_POINT, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var params, point []byte
+	for _, attr := range attrs {
+		switch attr.Type {
+		case p11.CKA_EC_PARAMS:
+			params = attr.Value
+		case p11.CKA_EC_POINT:
+			point = attr.Value
+		}
+	}
+
+	var oid asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(params, &oid); err != nil || len(rest) > 0 {
+		return nil, errors.New("auditlog: the key's curve isn't a named curve")
+	}
+
+	curve, ok := curves[oid.String()]
+	if !ok {
+		return nil, fmt.Errorf("auditlog: unsupported curve %s", oid)
+	}
+
+	// The point should be wrapped in a DER octet string, but some
+	// tokens return it bare.
+	var raw []byte
+	if rest, err := asn1.Unmarshal(point, &raw); err == nil && len(rest) == 0 {
+		point = raw
+	}
+	return ecdsa.ParseUncompressedPublicKey(curve, point)
+}
+
+// Public returns the public key.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.public
+}
+
+// resetErrors are the errors returned when the session, the login, or
+// the token itself has been lost, after which reconnecting may
+// succeed.
+var resetErrors = map[p11.Error]bool{
+	p11.CKR_SESSION_HANDLE_INVALID:   true,
+	p11.CKR_SESSION_CLOSED:           true,
+	p11.CKR_USER_NOT_LOGGED_IN:       true,
+	p11.CKR_KEY_HANDLE_INVALID:       true,
+	p11.CKR_OBJECT_HANDLE_INVALID:    true,
+	p11.CKR_DEVICE_ERROR:             true,
+	p11.CKR_DEVICE_REMOVED:           true,
+	p11.CKR_TOKEN_NOT_PRESENT:        true,
+	p11.CKR_TOKEN_NOT_RECOGNIZED:     true,
+	p11.CKR_CRYPTOKI_NOT_INITIALIZED: true,
+	p11.CKR_SLOT_ID_INVALID:          true,
+	p11.CKR_FUNCTION_FAILED:          true,
+	p11.CKR_GENERAL_ERROR:            true,
+}
+
+func isReset(err error) bool {
+	var perr p11.Error
+	return errors.As(err, &perr) && resetErrors[perr]
+}
+
+// Sign signs digest, which must be the hash given by opts, with the
+// key on the token, returning an ASN.1 DER-encoded signature as
+// crypto/ecdsa does. The token draws its own randomness, so rand is
+// ignored. If the token has been reset, the Signer reconnects and
+// tries again, up to the configured number of retries.
+func (s *Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts != nil && opts.HashFunc() != 0 && len(digest) != opts.HashFunc().Size() {
+		return nil, errors.New("auditlog: digest length doesn't match its hash")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		var sig []byte
+		err := s.reconnect()
+		if err == nil {
+			sig, err = s.sign(digest)
+		}
+
+		if err == nil {
+			return sig, nil
+		}
+
+		if !isReset(err) || attempt >= s.cfg.Retries {
+			return nil, err
+		}
+
+		s.disconnect(err)
+		s.sleep(s.cfg.RetryDelay)
+	}
+}
+
+// reconnect connects to the token if the last connection was lost.
+// The caller must hold the lock.
+func (s *Signer) reconnect() error {
+	if s.connected {
+		return nil
+	}
+
+	if err := initialize(s.mod); err != nil {
+		return err
+	}
+	return s.connect()
+}
+
+// disconnect drops the session after a reset. The library is shut
+// down as well, as some modules need to be initialized again to see a
+// token that was reinserted. The caller must hold the lock.
+func (s *Signer) disconnect(cause error) {
+	if s.connected {
+		s.mod.CloseSession(s.session)
+		s.connected = false
+	}
+
+	if cause != p11.Error(p11.CKR_CRYPTOKI_NOT_INITIALIZED) {
+		s.mod.Finalize()
+	}
+}
+
+// sign makes a single signature in the current session, converting
+// it from the raw form PKCS#11 returns.
+func (s *Signer) sign(digest []byte) ([]byte, error) {
+	err := s.mod.SignInit(s.session, []*p11.Mechanism{p11.NewMechanism(p11.CKM_ECDSA, nil)}, s.key)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := s.mod.Sign(s.session, digest)
+	if err != nil {
+		return nil, err
+	}
+
+	size := (s.public.Curve.Params().BitSize + 7) / 8
+	if len(raw) != 2*size {
+		return nil, fmt.Errorf("auditlog: the token returned a %d-byte signature", len(raw))
+	}
+
+	return asn1.Marshal(struct{ R, S *big.Int }{
+		R: new(big.Int).SetBytes(raw[:size]),
+		S: new(big.Int).SetBytes(raw[size:]),
+	})
+}
+
+// Close closes the session with the token and unloads the library.
+func (s *Signer) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var err error
+	if s.connected {
+		err = s.mod.CloseSession(s.session)
+		s.connected = false
+	}
+
+	if ferr := s.mod.Finalize(); err == nil {
+		err = ferr
+	}
+
+	if s.ctx != nil {
+		s.ctx.Destroy()
+		s.ctx = nil
+	}
+	return err
+}
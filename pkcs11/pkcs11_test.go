@@ -0,0 +1,264 @@
+package pkcs11
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"github.com/kisom/auditlog"
+	p11 "github.com/miekg/pkcs11"
+)
+
+// fakeToken is a PKCS#11 module holding a single P-256 key in
+// software. Finalizing it, as a token reset does, closes every
+// session.
+type fakeToken struct {
+	key         *ecdsa.PrivateKey
+	label       string
+	initialized bool
+	sessions    map[p11.SessionHandle]bool
+	next        p11.SessionHandle
+	opened      int
+	class       []byte
+
+	// failSigns is the number of signatures to fail as though the
+	// token had been removed.
+	failSigns int
+}
+
+func newFakeToken(t *testing.T) *fakeToken {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return &fakeToken{key: key, label: "audit", sessions: map[p11.SessionHandle]bool{}}
+}
+
+func (ft *fakeToken) Initialize() error {
+	if ft.initialized {
+		return p11.Error(p11.CKR_CRYPTOKI_ALREADY_INITIALIZED)
+	}
+	ft.initialized = true
+	return nil
+}
+
+func (ft *fakeToken) Finalize() error {
+	if !ft.initialized {
+		return p11.Error(p11.CKR_CRYPTOKI_NOT_INITIALIZED)
+	}
+	ft.initialized = false
+	ft.sessions = map[p11.SessionHandle]bool{}
+	return nil
+}
+
+func (ft *fakeToken) GetSlotList(bool) ([]uint, error) {
+	return []uint{0, 3}, nil
+}
+
+func (ft *fakeToken) GetTokenInfo(slot uint) (p11.TokenInfo, error) {
+	if slot == 3 {
+		return p11.TokenInfo{Label: "hsm"}, nil
+	}
+	return p11.TokenInfo{Label: "other"}, nil
+}
+
+func (ft *fakeToken) OpenSession(slot uint, flags uint) (p11.SessionHandle, error) {
+	if !ft.initialized {
+		return 0, p11.Error(p11.CKR_CRYPTOKI_NOT_INITIALIZED)
+	}
+
+	if slot != 3 {
+		return 0, p11.Error(p11.CKR_TOKEN_NOT_PRESENT)
+	}
+
+	ft.next++
+	ft.opened++
+	ft.sessions[ft.next] = true
+	return ft.next, nil
+}
+
+func (ft *fakeToken) CloseSession(sh p11.SessionHandle) error {
+	if !ft.sessions[sh] {
+		return p11.Error(p11.CKR_SESSION_HANDLE_INVALID)
+	}
+	delete(ft.sessions, sh)
+	return nil
+}
+
+func (ft *fakeToken) Login(sh p11.SessionHandle, userType uint, pin string) error {
+	if pin != "1234" {
+		return p11.Error(p11.CKR_PIN_INCORRECT)
+	}
+	return nil
+}
+
+func (ft *fakeToken) FindObjectsInit(sh p11.SessionHandle, temp []*p11.Attribute) error {
+	ft.class = nil
+	var class []byte
+	for _, attr := range temp {
+		if attr.Type == p11.CKA_LABEL && string(attr.Value) != ft.label {
+			return nil
+		}
+
+		if attr.Type == p11.CKA_CLASS {
+			class = attr.Value
+		}
+	}
+	ft.class = class
+	return nil
+}
+
+func (ft *fakeToken) FindObjects(sh p11.SessionHandle, max int) ([]p11.ObjectHandle, bool, error) {
+	switch {
+	case ft.class == nil:
+		return nil, false, nil
+	case bytes.Equal(ft.class, p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PRIVATE_KEY).Value):
+		return []p11.ObjectHandle{1}, false, nil
+	default:
+		return []p11.ObjectHandle{2}, false, nil
+	}
+}
+
+func (ft *fakeToken) FindObjectsFinal(sh p11.SessionHandle) error {
+	return nil
+}
+
+func (ft *fakeToken) GetAttributeValue(sh p11.SessionHandle, o p11.ObjectHandle, a []*p11.Attribute) ([]*p11.Attribute, error) {
+	params, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7})
+	point, _ := ft.key.PublicKey.Bytes()
+	point, _ = asn1.Marshal(point)
+	return []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_EC_PARAMS, params),
+		p11.NewAttribute(p11.CKA_EC_POINT, point),
+	}, nil
+}
+
+func (ft *fakeToken) SignInit(sh p11.SessionHandle, m []*p11.Mechanism, o p11.ObjectHandle) error {
+	if !ft.sessions[sh] {
+		return p11.Error(p11.CKR_SESSION_HANDLE_INVALID)
+	}
+	return nil
+}
+
+func (ft *fakeToken) Sign(sh p11.SessionHandle, message []byte) ([]byte, error) {
+	if ft.failSigns > 0 {
+		ft.failSigns--
+		return nil, p11.Error(p11.CKR_DEVICE_REMOVED)
+	}
+
+	r, s, err := ecdsa.Sign(rand.Reader, ft.key, message)
+	if err != nil {
+		return nil, err
+	}
+	return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...), nil
+}
+
+func testSigner(t *testing.T, ft *fakeToken, cfg Config) *Signer {
+	s, err := newSigner(ft, cfg)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	s.sleep = func(time.Duration) {}
+	return s
+}
+
+var testConfig = Config{TokenLabel: "hsm", PIN: "1234", KeyLabel: "audit"}
+
+func TestSigner(t *testing.T) {
+	ft := newFakeToken(t)
+	s := testSigner(t, ft, testConfig)
+	defer s.Close()
+
+	if !ft.key.PublicKey.Equal(s.Public()) {
+		t.Fatal("public key wasn't loaded from the token")
+	}
+
+	l, err := auditlog.NewWithSigner(auditlog.NewMemoryStore(), s, auditlog.WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	for i := 0; i < 5; i++ {
+		l.InfoSync("pkcs11_test", "event", nil)
+	}
+
+	cert, err := l.Certify(0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	if _, ok := auditlog.VerifyCertification(cert, &ft.key.PublicKey); !ok {
+		t.Fatal("certification failed to verify")
+	}
+}
+
+func TestSignerReset(t *testing.T) {
+	ft := newFakeToken(t)
+	s := testSigner(t, ft, testConfig)
+	defer s.Close()
+
+	digest := sha256.Sum256([]byte("event"))
+
+	// The token is reset twice; the signer reconnects each time.
+	ft.failSigns = 2
+	sig, err := s.Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !ecdsa.VerifyASN1(&ft.key.PublicKey, digest[:], sig) {
+		t.Fatal("signature failed to verify")
+	}
+
+	if ft.opened != 3 {
+		t.Fatalf("expected 3 sessions to have been opened, have %d", ft.opened)
+	}
+
+	// Once the retries are exhausted, the error is returned, but the
+	// signer recovers once the token does.
+	ft.failSigns = DefaultRetries + 1
+	if _, err = s.Sign(nil, digest[:], crypto.SHA256); err != p11.Error(p11.CKR_DEVICE_REMOVED) {
+		t.Fatalf("expected CKR_DEVICE_REMOVED, have %v", err)
+	}
+
+	if _, err = s.Sign(nil, digest[:], crypto.SHA256); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// A token that comes back with a different key under the label
+	// can't sign.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	ft.key = key
+	ft.failSigns = 1
+	if _, err = s.Sign(nil, digest[:], crypto.SHA256); err == nil {
+		t.Fatal("expected a changed key to be refused")
+	}
+}
+
+func TestSignerConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{TokenLabel: "missing", PIN: "1234", KeyLabel: "audit"},
+		{Slot: 0, PIN: "1234", KeyLabel: "audit"},
+		{TokenLabel: "hsm", PIN: "0000", KeyLabel: "audit"},
+		{TokenLabel: "hsm", PIN: "1234", KeyLabel: "other"},
+	} {
+		if _, err := newSigner(newFakeToken(t), cfg); err == nil {
+			t.Fatalf("expected %+v to fail", cfg)
+		}
+	}
+
+	// A slot can be given by number.
+	if _, err := newSigner(newFakeToken(t), Config{Slot: 3, PIN: "1234", KeyLabel: "audit"}); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
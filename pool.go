@@ -0,0 +1,76 @@
+package auditlog
+
+import "sync"
+
+// Events logged through the logging methods are drawn from a pool, and
+// returned to it once they have been recorded, so that a busy logger
+// doesn't leave a trail of garbage behind every event. The attributes
+// passed to a logging method are copied into a pooled slice, so the
+// caller may reuse its slice as soon as the method returns.
+//
+// The logger owns a pooled event from the moment it is queued until it
+// is acknowledged, after which it may be reused for another event at
+// any time. Stores, analyzers, formatters, and tees are handed events
+// on loan: they must not keep the event or its attributes once they
+// return, and must copy whatever they need, as MemoryStore does. An
+// event the logger must keep, such as one buffered in degraded mode,
+// is marked as retained and left to the garbage collector instead.
+
+// maxPooledAttributes is the capacity of the largest attribute slice
+// kept for reuse.
+const maxPooledAttributes = 64
+
+var eventPool = sync.Pool{
+	New: func() interface{} {
+		return new(Event)
+	},
+}
+
+var attributePool = sync.Pool{
+	New: func() interface{} {
+		attrs := make([]Attribute, 0, 8)
+		return &attrs
+	},
+}
+
+// newEvent takes an event from the pool, with a copy of attributes.
+func newEvent(attributes []Attribute) *Event {
+	ev := eventPool.Get().(*Event)
+	ev.pooled = true
+
+	// An empty slice is kept as it is, so that it is still
+	// distinguished from a nil one.
+	if len(attributes) == 0 {
+		ev.Attributes = attributes
+		return ev
+	}
+
+	buf := attributePool.Get().(*[]Attribute)
+	*buf = append((*buf)[:0], attributes...)
+	ev.Attributes = *buf
+	ev.attrs = buf
+	return ev
+}
+
+// releaseEvent returns a pooled event, and its attributes, to the pool
+// once it has been acknowledged. Events that aren't pooled, or that
+// have been retained, are left alone.
+func releaseEvent(ev *Event) {
+	if !ev.pooled || ev.retained {
+		return
+	}
+
+	if buf := ev.attrs; buf != nil && cap(*buf) <= maxPooledAttributes {
+		// The attributes are cleared so that the pool doesn't
+		// keep their values alive.
+		attrs := (*buf)[:cap(*buf)]
+		for i := range attrs {
+			attrs[i] = Attribute{}
+		}
+		*buf = attrs[:0]
+		attributePool.Put(buf)
+	}
+
+	*ev = Event{}
+	eventPool.Put(ev)
+}
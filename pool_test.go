@@ -0,0 +1,58 @@
+package auditlog
+
+import "testing"
+
+func TestEventPool(t *testing.T) {
+	l, store := newTestLogger(t)
+	l.Start()
+
+	// The caller's attributes are copied when the event is logged,
+	// so the slice can be reused straight away.
+	attrs := []Attribute{{"user", "alice"}}
+	for _, user := range []string{"bob", "carol", "dave"} {
+		l.Info("pool_test", "login", attrs)
+		attrs[0].Value = user
+	}
+	l.InfoSync("pool_test", "login", attrs)
+	l.InfoSync("pool_test", "logout", []Attribute{})
+	l.Stop()
+
+	if err := l.verifyAuditChain(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	events, err := store.Events(0, 4)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for i, user := range []string{"alice", "bob", "carol", "dave"} {
+		if value, _ := events[i].attr("user"); value != user {
+			t.Fatalf("event %d: expected user %s, have %s", i, user, value)
+		}
+	}
+
+	if events[4].Attributes == nil {
+		t.Fatal("an empty attribute list should not become nil")
+	}
+
+	// A released event comes back from the pool empty.
+	ev := newEvent([]Attribute{{"key", "value"}})
+	ev.Actor = "pool_test"
+	releaseEvent(ev)
+	for i := 0; i < 8; i++ {
+		ev = newEvent(nil)
+		if ev.Actor != "" || ev.Attributes != nil || ev.attrs != nil || !ev.pooled {
+			t.Fatalf("pooled event was not reset: %+v", ev)
+		}
+		releaseEvent(ev)
+	}
+
+	// Retained events aren't returned to the pool.
+	ev = newEvent([]Attribute{{"key", "value"}})
+	ev.retained = true
+	releaseEvent(ev)
+	if ev.Attributes[0].Value != "value" {
+		t.Fatal("a retained event should not be reset")
+	}
+}
@@ -0,0 +1,77 @@
+package auditlog
+
+import "time"
+
+// VerifyProgress reports how far a long verification has got: the
+// number of events verified so far, out of Total, and the time spent
+// on them.
+type VerifyProgress struct {
+	Verified uint64
+	Total    uint64
+	Elapsed  time.Duration
+}
+
+// Rate returns the number of events verified per second.
+func (p VerifyProgress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.Verified) / p.Elapsed.Seconds()
+}
+
+// Remaining estimates the time left to verify the rest of the events
+// at the rate seen so far; it is zero until the first are verified.
+func (p VerifyProgress) Remaining() time.Duration {
+	rate := p.Rate()
+	if rate == 0 || p.Verified >= p.Total {
+		return 0
+	}
+	return time.Duration(float64(p.Total-p.Verified) / rate * float64(time.Second))
+}
+
+// WithVerifyProgress sets a function that is called as the chain is
+// verified, when the logger is created or restarted and by
+// VerifyChain, after each batch of events. It is called with the
+// logger's lock held, so it must not use the logger; under
+// WithBackgroundVerification, it is called from the verifying
+// goroutine instead.
+func WithVerifyProgress(progress func(VerifyProgress)) Option {
+	return func(l *Logger) {
+		l.verifyProgress = progress
+	}
+}
+
+// VerifyProgressFunc sets a function that is called as a
+// certification is verified, after each batch of events.
+func VerifyProgressFunc(progress func(VerifyProgress)) VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.progress = progress
+	}
+}
+
+// A progressMeter tracks a verification, reporting its progress to
+// report, which may be nil.
+type progressMeter struct {
+	report func(VerifyProgress)
+	start  time.Time
+	p      VerifyProgress
+}
+
+func newProgressMeter(report func(VerifyProgress), total uint64) *progressMeter {
+	return &progressMeter{
+		report: report,
+		start:  time.Now(),
+		p:      VerifyProgress{Total: total},
+	}
+}
+
+// add notes that n more events have been verified.
+func (m *progressMeter) add(n int) {
+	if m.report == nil {
+		return
+	}
+
+	m.p.Verified += uint64(n)
+	m.p.Elapsed = time.Since(m.start)
+	m.report(m.p)
+}
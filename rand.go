@@ -0,0 +1,52 @@
+package auditlog
+
+import (
+	"crypto/rand"
+	"io"
+	"sync"
+)
+
+// randSource holds the source of randomness set with SetRand.
+var randSource = struct {
+	sync.RWMutex
+	r io.Reader
+}{r: rand.Reader}
+
+// prng is the source of randomness for signatures. It reads from the
+// source set with SetRand, crypto/rand by default; keys, salts, and
+// nonces always come from crypto/rand.
+var prng io.Reader = swappableRand{}
+
+type swappableRand struct{}
+
+func (swappableRand) Read(p []byte) (int, error) {
+	randSource.RLock()
+	defer randSource.RUnlock()
+
+	return randSource.r.Read(p)
+}
+
+// SetRand replaces the source of randomness used for signatures by
+// every logger in the process, returning a function that restores the
+// source it replaced. It is safe to call while loggers are running:
+// the source is swapped between reads, never during one. It is meant
+// for tests, which should restore the source when they finish and not
+// run in parallel with tests that depend on it.
+//
+// Since Go 1.26, crypto/ecdsa ignores the source unless the program
+// runs with GODEBUG=cryptocustomrand=1, and Ed25519 signatures never
+// use it, so a failing source doesn't make signing fail. Tests of
+// signature failures should sign with a failing crypto.Signer, such
+// as auditlogtest.FailingSigner, instead.
+func SetRand(r io.Reader) (restore func()) {
+	randSource.Lock()
+	defer randSource.Unlock()
+
+	prev := randSource.r
+	randSource.r = r
+	return func() {
+		randSource.Lock()
+		randSource.r = prev
+		randSource.Unlock()
+	}
+}
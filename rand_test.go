@@ -0,0 +1,29 @@
+package auditlog
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSetRand(t *testing.T) {
+	restore := SetRand(bytes.NewReader([]byte{1, 2, 3, 4}))
+
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(prng, buf); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !bytes.Equal(buf, []byte{1, 2, 3, 4}) {
+		t.Fatalf("expected the swapped source to be read, have %x", buf)
+	}
+
+	if _, err := io.ReadFull(prng, buf); err == nil {
+		t.Fatal("expected the exhausted source to fail")
+	}
+
+	restore()
+	if _, err := io.ReadFull(prng, buf); err != nil {
+		t.Fatalf("the restored source failed: %v", err)
+	}
+}
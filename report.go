@@ -0,0 +1,260 @@
+package auditlog
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"strconv"
+	"time"
+)
+
+// A Report summarises the audit chain over a period, in a form
+// suited to compliance evidence requests such as those made for SOC 2
+// or ISO 27001 audits. Reports are signed with the logger's key, and
+// may be rendered as JSON or HTML.
+type Report struct {
+	// Start and End bound the period covered by the report, in
+	// nanoseconds since the epoch; events logged at or after Start
+	// and before End are included.
+	Start     int64 `json:"start"`
+	End       int64 `json:"end"`
+	Generated int64 `json:"generated"`
+
+	// FirstSerial and LastSerial are the serial numbers of the
+	// first and last events in the period; they are only
+	// meaningful if Events is non-zero.
+	FirstSerial uint64         `json:"first_serial"`
+	LastSerial  uint64         `json:"last_serial"`
+	Events      int            `json:"events"`
+	Levels      map[string]int `json:"levels"`
+	Actors      map[string]int `json:"actors"`
+	Errors      int            `json:"errors"`
+
+	// Days counts the period's events by the UTC date on which
+	// they were logged, in the form 2006-01-02.
+	Days map[string]int `json:"days,omitempty"`
+
+	// Certifications lists the serial numbers of the "certify"
+	// events recorded in the period, and CertificationDigest is
+	// the hex-encoded SHA-256 digest of a certification of the
+	// period's events.
+	Certifications      []uint64 `json:"certifications"`
+	CertificationDigest string   `json:"certification_digest"`
+
+	// Verified is true if the entire chain verified when the
+	// report was generated; otherwise, VerificationError explains
+	// why it didn't.
+	Verified          bool   `json:"verified"`
+	VerificationError string `json:"verification_error,omitempty"`
+
+	// KeyFingerprint is the hex-encoded fingerprint of the
+	// logger's public key.
+	KeyFingerprint string `json:"key_fingerprint"`
+
+	Signature []byte `json:"signature"`
+}
+
+// digest returns the digest of the report's JSON encoding without
+// its signature.
+func (r *Report) digest() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	out, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256(out)
+	return digest[:], nil
+}
+
+// Report generates a signed report on the events logged in the
+// period [start, end). If an accessor identity is required (see
+// WithAccessorRequired), ReportAs must be used instead.
+func (l *Logger) Report(start, end time.Time) (*Report, error) {
+	if l.requireAccessor {
+		return nil, ErrNoAccessor
+	}
+	return l.report(start, end)
+}
+
+// report generates a report for Report and ReportAs.
+func (l *Logger) report(start, end time.Time) (*Report, error) {
+	if !end.After(start) {
+		return nil, errors.New("auditlog: report period is empty")
+	}
+
+	signer, public, keys := l.signingKeys()
+	r := &Report{
+		Start:          start.UnixNano(),
+		End:            end.UnixNano(),
+		Generated:      l.now(),
+		Levels:         map[string]int{},
+		Actors:         map[string]int{},
+		Days:           map[string]int{},
+		KeyFingerprint: hex.EncodeToString(publicFingerprint(public)),
+	}
+
+	first, prev, err := l.chainStart()
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := l.store.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*Event
+	if count > first {
+		events, err = l.store.Events(first, count-1)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.Verified = true
+	seals := newSealCheck(first)
+	for _, ev := range events {
+		if r.Verified && !keys.verify(ev, prev) {
+			r.Verified = false
+			r.VerificationError = "signature failure on event " + strconv.FormatUint(ev.Serial, 10)
+		} else if r.Verified && !seals.add(ev) {
+			r.Verified = false
+			r.VerificationError = "unsealed batch before event " + strconv.FormatUint(ev.Serial, 10)
+		}
+		prev = ev.Signature
+
+		if ev.When < r.Start || ev.When >= r.End {
+			continue
+		}
+
+		if r.Events == 0 {
+			r.FirstSerial = ev.Serial
+		}
+		r.LastSerial = ev.Serial
+		r.Events++
+		r.Levels[ev.Level]++
+		r.Actors[ev.Actor]++
+		r.Days[time.Unix(0, ev.When).UTC().Format("2006-01-02")]++
+
+		if ev.Actor == internalActor && ev.Event == EventCertify {
+			r.Certifications = append(r.Certifications, ev.Serial)
+		}
+	}
+
+	if r.Events > 0 {
+		errEvents, err := l.store.Errors(r.FirstSerial, r.LastSerial)
+		if err != nil {
+			return nil, err
+		}
+		r.Errors = len(errEvents)
+
+		h := sha256.New()
+		err = writeCertification(h, l.store, l.now(), r.FirstSerial, r.LastSerial)
+		if err != nil {
+			return nil, err
+		}
+		r.CertificationDigest = hex.EncodeToString(h.Sum(nil))
+	}
+
+	digest, err := r.digest()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Signature, err = signer.Sign(prng, digest, crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// StoreSize returns the space taken by the logger's store, in bytes;
+// ok is false if the store can't report its size.
+func (l *Logger) StoreSize() (size int64, ok bool, err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	sizer, ok := l.store.(Sizer)
+	if !ok {
+		return 0, false, nil
+	}
+
+	size, err = sizer.Size()
+	return size, err == nil, err
+}
+
+// JSON returns the report's JSON encoding.
+func (r *Report) JSON() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// VerifyReport parses a JSON-encoded report and verifies its
+// signature against the logger's public key.
+func VerifyReport(in []byte, signer *ecdsa.PublicKey) (*Report, bool) {
+	var r Report
+	err := json.Unmarshal(in, &r)
+	if err != nil {
+		return nil, false
+	}
+
+	digest, err := r.digest()
+	if err != nil {
+		return nil, false
+	}
+
+	if !ecdsa.VerifyASN1(signer, digest, r.Signature) {
+		return nil, false
+	}
+	return &r, true
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": func(ns int64) string {
+		return time.Unix(0, ns).UTC().Format(time.RFC3339)
+	},
+	"hex": hex.EncodeToString,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Audit log report</title></head>
+<body>
+<h1>Audit log report</h1>
+<table>
+<tr><th>Period</th><td>{{time .Start}} to {{time .End}}</td></tr>
+<tr><th>Generated</th><td>{{time .Generated}}</td></tr>
+<tr><th>Events</th><td>{{.Events}}{{if .Events}} (serials {{.FirstSerial}} to {{.LastSerial}}){{end}}</td></tr>
+<tr><th>Error events</th><td>{{.Errors}}</td></tr>
+<tr><th>Chain verified</th><td>{{if .Verified}}yes{{else}}no: {{.VerificationError}}{{end}}</td></tr>
+<tr><th>Certification digest</th><td><code>{{.CertificationDigest}}</code></td></tr>
+<tr><th>Key fingerprint</th><td><code>{{.KeyFingerprint}}</code></td></tr>
+<tr><th>Signature</th><td><code>{{hex .Signature}}</code></td></tr>
+</table>
+<h2>Events by level</h2>
+<table>{{range $level, $n := .Levels}}
+<tr><th>{{$level}}</th><td>{{$n}}</td></tr>{{end}}
+</table>
+<h2>Events by actor</h2>
+<table>{{range $actor, $n := .Actors}}
+<tr><th>{{$actor}}</th><td>{{$n}}</td></tr>{{end}}
+</table>
+<h2>Certifications</h2>
+<ul>{{range .Certifications}}
+<li>event {{.}}</li>{{else}}
+<li>none</li>{{end}}
+</ul>
+</body>
+</html>
+`))
+
+// HTML renders the report as an HTML document. The signature covers
+// the JSON encoding, which should accompany the HTML as evidence;
+// PDF output can be produced by printing the HTML.
+func (r *Report) HTML(w io.Writer) error {
+	return reportTemplate.Execute(w, r)
+}
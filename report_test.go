@@ -0,0 +1,70 @@
+package auditlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, _ := newTestLogger(t,
+		WithClock(NewFixedClock(start, time.Minute)))
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 10; i++ {
+		l.InfoSync("report_test", "tick", nil)
+	}
+	l.WarningSync("report_test", "tock", nil)
+
+	// Events 5 through 10 were logged from minute 10 onwards.
+	r, err := l.Report(start.Add(10*time.Minute), start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if r.Events != 6 || r.FirstSerial != 5 || r.LastSerial != 10 {
+		t.Fatalf("expected events 5 through 10, have %d events from %d to %d",
+			r.Events, r.FirstSerial, r.LastSerial)
+	}
+
+	if r.Levels["WARNING"] != 1 || r.Actors["report_test"] != 6 {
+		t.Fatalf("wrong summary: %v %v", r.Levels, r.Actors)
+	}
+
+	if len(r.Days) != 1 || r.Days["2014-10-06"] != 6 {
+		t.Fatalf("wrong daily counts: %v", r.Days)
+	}
+
+	if !r.Verified {
+		t.Fatalf("chain failed to verify: %s", r.VerificationError)
+	}
+
+	out, err := r.JSON()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, ok := VerifyReport(out, &signer.PublicKey); !ok {
+		t.Fatal("report failed to verify")
+	}
+
+	tampered := bytes.Replace(out, []byte(`"events":6`), []byte(`"events":7`), 1)
+	if _, ok := VerifyReport(tampered, &signer.PublicKey); ok {
+		t.Fatal("tampered report verified")
+	}
+
+	var buf bytes.Buffer
+	err = r.HTML(&buf)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !strings.Contains(buf.String(), r.KeyFingerprint) {
+		t.Fatal("HTML report is missing the key fingerprint")
+	}
+}
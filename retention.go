@@ -0,0 +1,280 @@
+package auditlog
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// An Archiver stores certifications of events before they are pruned
+// from the chain. Archive stores data under name and returns a
+// location from which it can be retrieved later, such as a path or
+// URL. Object stores like S3 can be supported by implementing
+// Archiver around the relevant client.
+type Archiver interface {
+	Archive(name string, data []byte) (location string, err error)
+}
+
+// A DirArchiver archives certifications as files in a directory.
+type DirArchiver string
+
+// Archive writes data to a file named name in the directory.
+func (dir DirArchiver) Archive(name string, data []byte) (string, error) {
+	path := filepath.Join(string(dir), name)
+	err := ioutil.WriteFile(path, data, 0444)
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// A RetentionPolicy prunes events older than MaxAge, archiving a
+// certification of them with Archiver first. The policy is applied
+// every Interval while the logger is running.
+type RetentionPolicy struct {
+	MaxAge   time.Duration
+	Interval time.Duration
+	Archiver Archiver
+}
+
+// WithRetention applies a retention policy. The logger's store must
+// implement Pruner.
+func WithRetention(policy RetentionPolicy) Option {
+	return func(l *Logger) {
+		if policy.MaxAge <= 0 || policy.Interval <= 0 || policy.Archiver == nil {
+			return
+		}
+
+		l.addTask(every(policy.Interval, false, func(l *Logger) {
+			err := l.PruneBefore(time.Unix(0, l.now()).Add(-policy.MaxAge), policy.Archiver)
+			if err != nil {
+				l.logInternal(levelError, "retention failure", []Attribute{
+					{"error", err.Error()},
+				})
+			}
+		}))
+	}
+}
+
+// ErrNotPrunable is returned when pruning is requested on a store
+// that doesn't implement Pruner.
+var ErrNotPrunable = errors.New("auditlog: store does not support pruning")
+
+// PruneBefore prunes the events logged before cutoff, as described in
+// Prune. The most recent event is never pruned.
+func (l *Logger) PruneBefore(cutoff time.Time, archiver Archiver) error {
+	pruner, ok := l.store.(Pruner)
+	if !ok {
+		return ErrNotPrunable
+	}
+
+	// The events to prune are chosen under the prune lock, so that
+	// a hold can't be placed on them before they are pruned.
+	l.pruneLock.Lock()
+	defer l.pruneLock.Unlock()
+
+	start, _, err := l.chainStart()
+	if err != nil {
+		return err
+	}
+
+	head := l.Count()
+	end := start
+	for ; end+1 < head; end++ {
+		ev, err := l.store.Event(end)
+		if err != nil {
+			return err
+		}
+
+		if ev.When >= cutoff.UnixNano() {
+			break
+		}
+	}
+
+	if end == start {
+		return nil
+	}
+
+	// Events under a legal hold, and those after them, are kept.
+	held, ok, err := l.firstHeld(start, end-1)
+	if err != nil {
+		return err
+	} else if ok {
+		end = held
+	}
+
+	if end == start {
+		return nil
+	}
+	return l.prune(pruner, end-1, archiver)
+}
+
+// Prune removes the events from the start of the chain through end.
+// A certification of the events is first stored with the archiver,
+// and then a signed "pruned range" event is recorded in the chain,
+// carrying the archive's location and SHA-256 digest along with the
+// signature of the last pruned event. The chain remaining in the
+// store can still be verified from the first retained event, and the
+// archived certification can be checked against the digest. Events
+// under a legal hold can't be pruned. The logger must be running.
+func (l *Logger) Prune(end uint64, archiver Archiver) error {
+	pruner, ok := l.store.(Pruner)
+	if !ok {
+		return ErrNotPrunable
+	}
+
+	l.pruneLock.Lock()
+	defer l.pruneLock.Unlock()
+
+	return l.prune(pruner, end, archiver)
+}
+
+// prune prunes the events through end, as Prune does; the caller must
+// hold the prune lock.
+func (l *Logger) prune(pruner Pruner, end uint64, archiver Archiver) error {
+	start, _, err := l.chainStart()
+	if err != nil {
+		return err
+	}
+
+	if end < start {
+		return nil
+	}
+
+	if end+1 >= l.Count() {
+		return errors.New("auditlog: the most recent event cannot be pruned")
+	}
+
+	if _, held, err := l.firstHeld(start, end); err != nil {
+		return err
+	} else if held {
+		return ErrLegalHold
+	}
+
+	last, err := l.store.Event(end)
+	if err != nil {
+		return err
+	}
+
+	cert, err := l.certification(start, end)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("auditlog-%020d-%020d.json", start, end)
+	location, err := archiver.Archive(name, cert)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(cert)
+	if !l.accept(levelInternal) {
+		return errors.New("auditlog: logger is not running")
+	}
+
+	wait := make(chan struct{}, 0)
+	l.logInternalEvent(levelInfo, "pruned range", []Attribute{
+		{"start", strconv.FormatUint(start, 10)},
+		{"end", strconv.FormatUint(end, 10)},
+		{"location", location},
+		{"digest", hex.EncodeToString(digest[:])},
+		{"last_signature", base64.StdEncoding.EncodeToString(last.Signature)},
+	}, wait, nil)
+	<-wait
+
+	return pruner.Prune(end)
+}
+
+// checkPruned checks that the chain was pruned through serial number
+// end by the logger: the store's record of the last pruned event, which
+// isn't signed, must match the "pruned range" event recorded in the
+// chain when it was pruned. The event is verified along with the rest
+// of the chain.
+func (l *Logger) checkPruned(end uint64, signature []byte) error {
+	want := []Attribute{
+		{"end", strconv.FormatUint(end, 10)},
+		{"last_signature", base64.StdEncoding.EncodeToString(signature)},
+	}
+
+	searcher, _ := l.store.(AttributeSearcher)
+	for start := end + 1; start < l.counter; start += backupBatch {
+		last := start + backupBatch - 1
+		if last >= l.counter {
+			last = l.counter - 1
+		}
+
+		var events []*Event
+		var err error
+		if searcher != nil {
+			events, err = searcher.EventsByAttribute(want[0], start, last)
+		} else {
+			events, err = l.store.Events(start, last)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, ev := range events {
+			if ev.Actor != internalActor || ev.Event != "pruned range" {
+				continue
+			}
+
+			end, _ := ev.attr(want[0].Name)
+			sig, _ := ev.attr(want[1].Name)
+			if end == want[0].Value && sig == want[1].Value {
+				return nil
+			}
+		}
+	}
+	return errPrunedMismatch
+}
+
+var errPrunedMismatch = errors.New("auditlog: the pruned events don't match a recorded pruned range")
+
+// attr returns the value of the named attribute of an event.
+func (ev *Event) attr(name string) (string, bool) {
+	for _, attr := range ev.Attributes {
+		if attr.Name == name {
+			return attr.Value, true
+		}
+	}
+	return "", false
+}
+
+// VerifyArchive checks an archived certification against the signed
+// "pruned range" event recorded when it was pruned: the archive must
+// match the recorded digest, its chain must verify against the
+// signer's public key, and it must end with the recorded last event.
+// The options are passed on to VerifyCertification.
+func VerifyArchive(marker *Event, archive []byte, signer *ecdsa.PublicKey, opts ...VerifyOption) (*Certification, bool) {
+	if marker.Actor != internalActor || marker.Event != "pruned range" {
+		return nil, false
+	}
+
+	digest := sha256.Sum256(archive)
+	if expected, _ := marker.attr("digest"); expected != hex.EncodeToString(digest[:]) {
+		return nil, false
+	}
+
+	cl, ok := VerifyCertification(archive, signer, opts...)
+	if !ok || len(cl.Chain) == 0 {
+		return nil, false
+	}
+
+	last := cl.Chain[len(cl.Chain)-1]
+	end, _ := marker.attr("end")
+	sig, _ := marker.attr("last_signature")
+	if strconv.FormatUint(last.Serial, 10) != end ||
+		base64.StdEncoding.EncodeToString(last.Signature) != sig {
+		return nil, false
+	}
+
+	return cl, true
+}
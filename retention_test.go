@@ -0,0 +1,88 @@
+package auditlog
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestPruneBefore(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, store := newTestLogger(t,
+		WithClock(NewFixedClock(start, time.Minute)))
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 10; i++ {
+		l.InfoSync("retention_test", "tick", nil)
+	}
+
+	// Each event consumes two clock readings (logged and
+	// received), so events 0 through 4 were logged before the
+	// cutoff.
+	dir := t.TempDir()
+	err := l.PruneBefore(start.Add(9*time.Minute), DirArchiver(dir))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = store.Event(4); err != ErrNoEvent {
+		t.Fatalf("expected event 4 to be pruned, have %v", err)
+	}
+
+	if l.Count() != 11 {
+		t.Fatalf("expected 11 events, have %d", l.Count())
+	}
+
+	marker, err := store.Event(10)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	location, _ := marker.attr("location")
+	archive, err := ioutil.ReadFile(location)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cl, ok := VerifyArchive(marker, archive, &signer.PublicKey)
+	if !ok {
+		t.Fatal("failed to verify archive")
+	}
+
+	if len(cl.Chain) != 5 {
+		t.Fatalf("expected 5 archived events, have %d", len(cl.Chain))
+	}
+
+	if _, ok = VerifyArchive(marker, append(archive, ' '), &signer.PublicKey); ok {
+		t.Fatal("tampered archive verified")
+	}
+
+	// The remaining chain must still verify from the first
+	// retained event.
+	l.Stop()
+	l, err = NewWithStore(store, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("retention_test", "tock", nil)
+	if l.Count() != 12 {
+		t.Fatalf("expected 12 events, have %d", l.Count())
+	}
+
+	// Events removed from the store without the logger pruning them
+	// are caught, even though the rest of the chain verifies.
+	l.Stop()
+	if err = store.Prune(6); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = NewWithStore(store, signer, WithoutEcho()); err == nil {
+		t.Fatal("expected events pruned outside the logger to be caught")
+	}
+}
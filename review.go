@@ -0,0 +1,107 @@
+package auditlog
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EventErrorReviewed is recorded when an error event is reviewed.
+const EventErrorReviewed = "error reviewed"
+
+// ID identifies an error event by the serial number of the event that
+// failed and the time the error occurred.
+func (ev *ErrorEvent) ID() string {
+	return fmt.Sprintf("%d/%d", ev.Event.Serial, ev.When)
+}
+
+// ReviewError records the disposition of an error event as a signed
+// "error reviewed" event, naming the reviewer and carrying their
+// note. Reviewed errors are no longer returned by UnreviewedErrors.
+// The logger must be running.
+func (l *Logger) ReviewError(id, reviewer, note string) error {
+	if reviewer == "" {
+		return errors.New("auditlog: a review must name the reviewer")
+	}
+
+	errEvents, err := l.allErrors()
+	if err != nil {
+		return err
+	}
+
+	var found bool
+	for _, ev := range errEvents {
+		found = found || ev.ID() == id
+	}
+
+	if !found {
+		return errors.New("auditlog: no error event " + id)
+	}
+
+	if !l.accept(levelInternal) {
+		return errors.New("auditlog: logger is not running")
+	}
+
+	wait := make(chan struct{}, 0)
+	l.logInternalEvent(levelInfo, EventErrorReviewed, []Attribute{
+		{"error", id},
+		{"reviewer", reviewer},
+		{"note", note},
+	}, wait, nil)
+	<-wait
+	return nil
+}
+
+// allErrors returns every error event in the store.
+func (l *Logger) allErrors() ([]*ErrorEvent, error) {
+	count, err := l.store.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	// An error event carries the serial number its event would
+	// have been given, which may be one past the last stored
+	// event.
+	return l.store.Errors(0, count)
+}
+
+// UnreviewedErrors returns the error events that haven't been
+// reviewed with ReviewError.
+func (l *Logger) UnreviewedErrors() ([]*ErrorEvent, error) {
+	errEvents, err := l.allErrors()
+	if err != nil || len(errEvents) == 0 {
+		return nil, err
+	}
+
+	start, _, err := l.chainStart()
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := l.store.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	reviewed := map[string]bool{}
+	if count > start {
+		events, err := l.store.Events(start, count-1)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ev := range events {
+			if ev.Actor == internalActor && ev.Event == EventErrorReviewed {
+				id, _ := ev.attr("error")
+				reviewed[id] = true
+			}
+		}
+	}
+
+	var unreviewed []*ErrorEvent
+	for _, ev := range errEvents {
+		if !reviewed[ev.ID()] {
+			unreviewed = append(unreviewed, ev)
+		}
+	}
+	return unreviewed, nil
+}
@@ -0,0 +1,48 @@
+package auditlog
+
+import (
+	"testing"
+
+	"github.com/kisom/auditlog/internal/testkeys"
+)
+
+func TestReviewError(t *testing.T) {
+	// The first event's signature fails, leaving an error event.
+	signer := testkeys.NewFailingSigner(testKey(t, "signer"), 1)
+	l, err := NewWithSigner(NewMemoryStore(), signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("review_test", "signature failure", nil)
+	l.InfoSync("review_test", "tick", nil)
+
+	unreviewed, err := l.UnreviewedErrors()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(unreviewed) != 1 {
+		t.Fatalf("expected 1 unreviewed error, have %d", len(unreviewed))
+	}
+
+	if err = l.ReviewError("12/34", "jqp", "no such error"); err == nil {
+		t.Fatal("reviewed a nonexistent error")
+	}
+
+	err = l.ReviewError(unreviewed[0].ID(), "jqp", "transient signer failure")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	unreviewed, err = l.UnreviewedErrors()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(unreviewed) != 0 {
+		t.Fatalf("expected no unreviewed errors, have %d", len(unreviewed))
+	}
+}
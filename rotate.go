@@ -0,0 +1,174 @@
+package auditlog
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+)
+
+// Events marking the ends of linked chains.
+const (
+	EventChainSealed  = "chain sealed"
+	EventChainGenesis = "chain genesis"
+)
+
+// chainLink returns the value linking a new chain to the seal event
+// of its predecessor: the hex-encoded SHA-256 digest of the seal's
+// signature, which covers the entire previous chain.
+func chainLink(seal *Event) string {
+	digest := sha256.Sum256(seal.Signature)
+	return hex.EncodeToString(digest[:])
+}
+
+// Rotate seals the current chain and starts a new one in next, which
+// must be empty. A final "chain sealed" event is recorded in the
+// current chain, and the new chain begins with a "chain genesis"
+// event carrying the digest of the seal's signature, so the sequence
+// of chains can be verified with VerifyLinkedCertifications. The
+// current store is closed once the new chain has begun.
+func (l *Logger) Rotate(next Store) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.closed {
+		return errors.New("auditlog: logger has been stopped")
+	}
+	return l.rotate(next)
+}
+
+// rotate performs a rotation; the caller must hold the logger's lock.
+func (l *Logger) rotate(next Store) error {
+	if l.buffering() {
+		return errors.New("auditlog: cannot rotate while events are buffered")
+	}
+
+	if l.verifying() {
+		return errors.New("auditlog: cannot rotate while the chain is being verified")
+	}
+
+	count, err := next.Count()
+	if err != nil {
+		return err
+	}
+
+	if count != 0 {
+		return errors.New("auditlog: cannot rotate into a store that already holds events")
+	}
+
+	if _, ok := next.(CheckpointRecorder); l.fromCheckpoint && !ok {
+		return errors.New("auditlog: the store cannot record signed checkpoints")
+	}
+
+	if dr, ok := next.(DigestRecorder); l.encryption != nil && !(ok && dr.RecordsDigests()) {
+		return errors.New("auditlog: encryption requires a store that records digest versions")
+	}
+
+	if _, ok := next.(CosignatureRecorder); len(l.witnesses) > 0 && !ok {
+		return errors.New("auditlog: the store cannot record cosignatures")
+	}
+
+	// Events waiting to be committed belong to the old chain, and
+	// the rotation itself isn't grouped.
+	l.commitGroup()
+	grouping := l.grouping
+	l.grouping = false
+	defer func() { l.grouping = grouping }()
+
+	// The chain's last batch is signed before it is sealed, and
+	// the seal and genesis events are always signed, so that each
+	// chain is complete on its own.
+	l.sealBatch()
+	seal := &Event{
+		When:  l.now(),
+		Level: levelStrings[levelInfo],
+		Actor: internalActor,
+		Event: EventChainSealed,
+		Attributes: []Attribute{
+			{"events", strconv.FormatUint(l.counter+1, 10)},
+		},
+		sign: true,
+	}
+
+	err = l.record(seal)
+	if err != nil {
+		return err
+	}
+
+	prev, prevCounter, prevSignature := l.store, l.counter, l.lastSignature
+	prevKeys, prevPending := l.keys, l.keysPending
+	l.store, l.counter, l.lastSignature = next, 0, nil
+
+	// The new chain is signed only by the current key.
+	l.keys, l.keysPending = singleKey(l.public), true
+	err = l.storeKeys()
+
+	genesis := &Event{
+		When:  l.now(),
+		Level: levelStrings[levelInfo],
+		Actor: internalActor,
+		Event: EventChainGenesis,
+		Attributes: []Attribute{
+			{"previous_seal", chainLink(seal)},
+			{"previous_serial", strconv.FormatUint(seal.Serial, 10)},
+		},
+		sign: true,
+	}
+
+	if err == nil {
+		err = l.record(genesis)
+	}
+	if err != nil {
+		// The old chain carries on; its seal is no longer final,
+		// so it won't link to any later chain.
+		l.store, l.counter, l.lastSignature = prev, prevCounter, prevSignature
+		l.keys, l.keysPending = prevKeys, prevPending
+		return err
+	}
+
+	prev.Close()
+	l.segmentEvents, l.segmentBytes = 1, genesis.size()
+	return nil
+}
+
+// VerifyChainLink reports whether genesis, the first event of a
+// chain, links to seal, the final event of the chain before it. The
+// signatures on both events must be verified separately.
+func VerifyChainLink(seal, genesis *Event) bool {
+	if seal.Actor != internalActor || seal.Event != EventChainSealed {
+		return false
+	}
+
+	if genesis.Serial != 0 || genesis.Actor != internalActor || genesis.Event != EventChainGenesis {
+		return false
+	}
+
+	link, _ := genesis.attr("previous_seal")
+	serial, _ := genesis.attr("previous_serial")
+	return link == chainLink(seal) && serial == strconv.FormatUint(seal.Serial, 10)
+}
+
+// VerifyLinkedCertifications verifies a sequence of certifications of
+// consecutive chains. Each certification must verify on its own, and
+// every certification after the first must begin with its chain's
+// genesis event, linked to the seal event that ends the preceding
+// certification.
+func VerifyLinkedCertifications(certs [][]byte, signer *ecdsa.PublicKey) ([]*Certification, bool) {
+	var verified []*Certification
+	for i, cert := range certs {
+		cl, ok := VerifyCertification(cert, signer)
+		if !ok || len(cl.Chain) == 0 {
+			return nil, false
+		}
+
+		if i > 0 {
+			prev := verified[i-1].Chain
+			if !VerifyChainLink(prev[len(prev)-1], cl.Chain[0]) {
+				return nil, false
+			}
+		}
+		verified = append(verified, cl)
+	}
+	return verified, true
+}
@@ -0,0 +1,109 @@
+package auditlog
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRotate(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	stores := []*MemoryStore{NewMemoryStore(), NewMemoryStore(), NewMemoryStore()}
+	l, err := NewWithStore(stores[0], signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	for _, next := range stores[1:] {
+		l.InfoSync("rotate_test", "ping", nil)
+		l.InfoSync("rotate_test", "pong", nil)
+
+		err = l.Rotate(next)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	l.InfoSync("rotate_test", "ping", nil)
+
+	if err = l.Rotate(stores[0]); err == nil {
+		t.Fatal("rotated into a store with events")
+	}
+
+	var certs [][]byte
+	for _, store := range stores {
+		n, _ := store.Count()
+		chain, err := store.Events(0, n-1)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		cert, err := json.Marshal(Certification{Chain: chain})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if _, ok := VerifyLinkedCertifications(certs, &signer.PublicKey); !ok {
+		t.Fatal("linked chains failed to verify")
+	}
+
+	certs[0], certs[1] = certs[1], certs[0]
+	if _, ok := VerifyLinkedCertifications(certs, &signer.PublicKey); ok {
+		t.Fatal("out-of-order chains verified")
+	}
+}
+
+func TestSegmentation(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	stores := []*MemoryStore{NewMemoryStore()}
+	l, err := NewWithStore(stores[0], signer, WithoutEcho(),
+		WithSegmentation(SegmentPolicy{
+			MaxEvents: 5,
+			Next: func() (Store, error) {
+				stores = append(stores, NewMemoryStore())
+				return stores[len(stores)-1], nil
+			},
+		}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 12; i++ {
+		l.InfoSync("rotate_test", "tick", nil)
+	}
+
+	// Each chain holds four events and its seal; every chain
+	// after the first begins with its genesis event.
+	if len(stores) != 4 {
+		t.Fatalf("expected 4 chains, have %d", len(stores))
+	}
+
+	var certs [][]byte
+	for _, store := range stores {
+		n, _ := store.Count()
+		if n > 5 {
+			t.Fatalf("chain holds %d events", n)
+		}
+
+		chain, err := store.Events(0, n-1)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		cert, err := json.Marshal(Certification{Chain: chain})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if _, ok := VerifyLinkedCertifications(certs, &signer.PublicKey); !ok {
+		t.Fatal("segmented chains failed to verify")
+	}
+}
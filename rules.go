@@ -0,0 +1,519 @@
+package auditlog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventAlertsDropped is recorded, as a WARNING, after a rule engine
+// dropped alerts because its notification queue was full; its "count"
+// attribute gives the number of alerts lost.
+const EventAlertsDropped = "alerts dropped"
+
+// DefaultWebhookTimeout bounds a webhook notification sent by a
+// WebhookNotifier without a client of its own.
+const DefaultWebhookTimeout = 10 * time.Second
+
+// DefaultNotifyQueueSize is the number of alerts a rule engine holds
+// for delivery; alerts raised while the queue is full are dropped.
+const DefaultNotifyQueueSize = 64
+
+var webhookClient = &http.Client{Timeout: DefaultWebhookTimeout}
+
+// DefaultEmailTimeout bounds the delivery of an email notification by
+// an EmailNotifier without a timeout of its own.
+const DefaultEmailTimeout = 30 * time.Second
+
+// An Alert is sent to a rule's notifiers when the rule matches. Event
+// is the event that completed the match, Count is the number of
+// matching events within the rule's window, and Group is the value
+// of the rule's grouping attribute, if it has one.
+type Alert struct {
+	Rule  string `json:"rule"`
+	Event *Event `json:"event"`
+	Count int    `json:"count"`
+	Group string `json:"group,omitempty"`
+}
+
+// A Notifier delivers alerts, e.g. to a webhook or by email.
+type Notifier interface {
+	Notify(a *Alert) error
+}
+
+// A NotifierFunc is a function used as a Notifier.
+type NotifierFunc func(a *Alert) error
+
+// Notify calls f.
+func (f NotifierFunc) Notify(a *Alert) error {
+	return f(a)
+}
+
+// A WebhookNotifier posts alerts as JSON to a URL. If Client is nil,
+// a client that gives up after DefaultWebhookTimeout is used.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts the alert.
+func (wn *WebhookNotifier) Notify(a *Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	client := wn.Client
+	if client == nil {
+		client = webhookClient
+	}
+
+	resp, err := client.Post(wn.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("auditlog: webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// An EmailNotifier sends alerts by email through an SMTP server. If
+// Username is set, the server is authenticated to with PLAIN
+// authentication. Delivery, from connecting to the server to the end
+// of the message, must finish within Timeout, or DefaultEmailTimeout
+// if it is zero.
+type EmailNotifier struct {
+	Addr     string
+	From     string
+	To       []string
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// Notify mails the alert.
+func (en *EmailNotifier) Notify(a *Alert) error {
+	host := en.Addr
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+
+	var auth smtp.Auth
+	if en.Username != "" {
+		auth = smtp.PlainAuth("", en.Username, en.Password, host)
+	}
+
+	timeout := en.Timeout
+	if timeout == 0 {
+		timeout = DefaultEmailTimeout
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: audit alert: %s\r\n\r\n%d matching events\r\n%s\r\n",
+		en.From, strings.Join(en.To, ", "), a.Rule, a.Count, a.Event)
+	return sendMail(en.Addr, host, timeout, auth, en.From, en.To, []byte(msg))
+}
+
+// sendMail sends a message as smtp.SendMail does, giving up once
+// timeout has passed.
+func sendMail(addr, host string, timeout time.Duration, auth smtp.Auth, from string, to []string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err = c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("auditlog: SMTP server doesn't support AUTH")
+		}
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err = c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// A Rule matches events by actor, event name, minimum level, and
+// attribute values; empty fields match any event. Once Threshold
+// matching events (one, if Threshold is zero) have been recorded
+// within Window, the rule fires: a "rule matched" event is recorded
+// at Severity ("WARNING" if empty), and the alert is sent to each of
+// the rule's notifiers. If GroupBy names an attribute, matches are
+// counted separately for each of its values, so that a rule can fire
+// on, say, five failed logins for one user within a minute.
+type Rule struct {
+	Name       string
+	Actor      string
+	Event      string
+	Level      string
+	Attributes map[string]string
+	GroupBy    string
+	Threshold  int
+	Window     time.Duration
+	Severity   string
+	Notifiers  []Notifier
+}
+
+// matches reports whether an event matches the rule.
+func (r *Rule) matches(ev *Event) bool {
+	if r.Actor != "" && r.Actor != ev.Actor {
+		return false
+	}
+
+	if r.Event != "" && r.Event != ev.Event {
+		return false
+	}
+
+	if r.Level != "" && levelFromString(ev.Level) < levelFromString(r.Level) {
+		return false
+	}
+
+	for name, value := range r.Attributes {
+		if v, ok := ev.attr(name); !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// A RuleEngine is an Analyzer that evaluates rules against the event
+// stream. Alerts are queued for delivery, one at a time, in the
+// background; failures to deliver them are recorded as "alert
+// failure" events, and alerts dropped because the queue was full as
+// an "alerts dropped" event. An engine added with WithRules delivers
+// alerts while the logger is running; any other engine starts
+// delivering with its first alert, and goes on for as long as the
+// process does.
+type RuleEngine struct {
+	lock    sync.Mutex
+	rules   []*Rule
+	windows map[string]*ruleWindow
+	expiry  int
+	logger  *Logger
+
+	queue   chan notification
+	dropped dropCount
+	start   sync.Once
+}
+
+// A ruleWindow counts the events matching a rule, for one value of
+// its grouping attribute, within the rule's window.
+type ruleWindow struct {
+	slidingWindow
+	length time.Duration
+}
+
+// minExpiry is the fewest windows a rule engine holds before it looks
+// for windows to expire.
+const minExpiry = 64
+
+// A notification is an alert waiting to be delivered by a notifier.
+type notification struct {
+	notifier Notifier
+	alert    *Alert
+}
+
+// NewRuleEngine returns a rule engine for the rules.
+func NewRuleEngine(rules ...*Rule) *RuleEngine {
+	return &RuleEngine{
+		rules:   rules,
+		windows: map[string]*ruleWindow{},
+		expiry:  minExpiry,
+		queue:   make(chan notification, DefaultNotifyQueueSize),
+	}
+}
+
+// WithRules evaluates the rules against recorded events, as
+// described in Rule.
+func WithRules(rules ...*Rule) Option {
+	return func(l *Logger) {
+		engine := NewRuleEngine(rules...)
+		engine.logger = l
+		// The logger's task delivers the engine's alerts.
+		engine.start.Do(func() {})
+		l.analyzers = append(l.analyzers, engine)
+		l.addTask(func(_ *Logger, stop <-chan struct{}) {
+			engine.deliver(stop)
+		})
+	}
+}
+
+// Dropped returns the number of alerts the engine has dropped because
+// its queue was full.
+func (re *RuleEngine) Dropped() uint64 {
+	re.dropped.lock.Lock()
+	defer re.dropped.lock.Unlock()
+
+	return re.dropped.total
+}
+
+// Analyze evaluates the rules against an event.
+func (re *RuleEngine) Analyze(ev *Event) []Finding {
+	re.lock.Lock()
+	defer re.lock.Unlock()
+
+	var findings []Finding
+	for _, r := range re.rules {
+		if !r.matches(ev) {
+			continue
+		}
+
+		var group string
+		if r.GroupBy != "" {
+			var ok bool
+			group, ok = ev.attr(r.GroupBy)
+			if !ok {
+				continue
+			}
+		}
+
+		key := r.Name + "\x00" + group
+		w, ok := re.windows[key]
+		if !ok {
+			w = &ruleWindow{length: r.Window}
+			re.windows[key] = w
+		}
+
+		threshold := r.Threshold
+		if threshold < 1 {
+			threshold = 1
+		}
+
+		n := w.add(ev.When, r.Window)
+		if n < threshold {
+			continue
+		}
+		w.times = nil
+
+		severity := r.Severity
+		if severity == "" {
+			severity = "WARNING"
+		}
+
+		attributes := []Attribute{
+			{"rule", r.Name},
+			{"serial", strconv.FormatUint(ev.Serial, 10)},
+			{"count", strconv.Itoa(n)},
+		}
+		if r.GroupBy != "" {
+			attributes = append(attributes, Attribute{r.GroupBy, group})
+		}
+
+		findings = append(findings, Finding{
+			Level:      severity,
+			Event:      "rule matched",
+			Attributes: attributes,
+		})
+
+		alert := &Alert{Rule: r.Name, Event: copyEvent(ev), Count: n, Group: group}
+		for _, notifier := range r.Notifiers {
+			re.send(notification{notifier, alert})
+		}
+	}
+
+	if len(re.windows) >= re.expiry {
+		re.expire(ev.When)
+	}
+	return findings
+}
+
+// expire discards the windows holding no events within their rule's
+// window of now, which count nothing until another event matches. It
+// is run whenever the number of windows has doubled since it last
+// ran, so that each event pays for a constant share of the sweep;
+// the caller must hold the engine's lock.
+func (re *RuleEngine) expire(now int64) {
+	for key, w := range re.windows {
+		n := len(w.times)
+		if n == 0 || w.times[n-1] <= now-int64(w.length) {
+			delete(re.windows, key)
+		}
+	}
+
+	re.expiry = 2 * len(re.windows)
+	if re.expiry < minExpiry {
+		re.expiry = minExpiry
+	}
+}
+
+// send queues a notification for delivery, or drops it if the queue
+// is full.
+func (re *RuleEngine) send(n notification) {
+	re.start.Do(func() { go re.deliver(nil) })
+
+	select {
+	case re.queue <- n:
+	default:
+		re.dropped.add()
+	}
+}
+
+// deliver delivers queued notifications until stop is closed.
+func (re *RuleEngine) deliver(stop <-chan struct{}) {
+	for {
+		select {
+		case n := <-re.queue:
+			re.notify(n.notifier, n.alert)
+			re.recordDropped()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// recordDropped records the number of alerts dropped since it was
+// last called, if any were. An alert can only be dropped while the
+// queue is full, so another notification is always delivered, and
+// the drop reported, afterwards.
+func (re *RuleEngine) recordDropped() {
+	count := re.dropped.take()
+	if count == 0 || re.logger == nil {
+		return
+	}
+
+	re.logger.logInternal(levelWarning, EventAlertsDropped, []Attribute{
+		{"count", strconv.FormatUint(count, 10)},
+	})
+}
+
+// notify delivers an alert, recording any failure.
+func (re *RuleEngine) notify(notifier Notifier, alert *Alert) {
+	err := notifier.Notify(alert)
+	if err != nil && re.logger != nil {
+		re.logger.logInternal(levelError, "alert failure", []Attribute{
+			{"rule", alert.Rule},
+			{"error", err.Error()},
+		})
+	}
+}
+
+// A NotifierConfig describes a notifier. Type is one of "webhook",
+// which posts to URL, or "email", which sends through the SMTP server
+// at Addr.
+type NotifierConfig struct {
+	Type     string   `yaml:"type" toml:"type"`
+	URL      string   `yaml:"url" toml:"url"`
+	Addr     string   `yaml:"addr" toml:"addr"`
+	From     string   `yaml:"from" toml:"from"`
+	To       []string `yaml:"to" toml:"to"`
+	Username string   `yaml:"username" toml:"username"`
+	Password string   `yaml:"password" toml:"password"`
+}
+
+// A RuleConfig describes a Rule; Window is a duration such as "1m".
+type RuleConfig struct {
+	Name       string            `yaml:"name" toml:"name"`
+	Actor      string            `yaml:"actor" toml:"actor"`
+	Event      string            `yaml:"event" toml:"event"`
+	Level      string            `yaml:"level" toml:"level"`
+	Attributes map[string]string `yaml:"attributes" toml:"attributes"`
+	GroupBy    string            `yaml:"group_by" toml:"group_by"`
+	Threshold  int               `yaml:"threshold" toml:"threshold"`
+	Window     string            `yaml:"window" toml:"window"`
+	Severity   string            `yaml:"severity" toml:"severity"`
+	Notify     []NotifierConfig  `yaml:"notify" toml:"notify"`
+}
+
+// rule builds the rule described by the configuration.
+func (rc *RuleConfig) rule() (*Rule, error) {
+	if rc.Name == "" {
+		return nil, errors.New("auditlog: rule requires a name")
+	}
+
+	r := &Rule{
+		Name:       rc.Name,
+		Actor:      rc.Actor,
+		Event:      rc.Event,
+		Level:      rc.Level,
+		Attributes: rc.Attributes,
+		GroupBy:    rc.GroupBy,
+		Threshold:  rc.Threshold,
+		Severity:   rc.Severity,
+	}
+
+	for _, level := range []string{rc.Level, rc.Severity} {
+		if level != "" && levelFromString(level) == levelUnknown {
+			return nil, fmt.Errorf("auditlog: unknown level %q in rule %s", level, rc.Name)
+		}
+	}
+
+	if rc.Window != "" {
+		var err error
+		r.Window, err = time.ParseDuration(rc.Window)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, nc := range rc.Notify {
+		switch nc.Type {
+		case "webhook":
+			if nc.URL == "" {
+				return nil, errors.New("auditlog: webhook notifier requires a URL")
+			}
+			r.Notifiers = append(r.Notifiers, &WebhookNotifier{URL: nc.URL})
+		case "email":
+			if nc.Addr == "" || len(nc.To) == 0 {
+				return nil, errors.New("auditlog: email notifier requires a server and recipients")
+			}
+			r.Notifiers = append(r.Notifiers, &EmailNotifier{
+				Addr:     nc.Addr,
+				From:     nc.From,
+				To:       nc.To,
+				Username: nc.Username,
+				Password: nc.Password,
+			})
+		default:
+			return nil, fmt.Errorf("auditlog: unsupported notifier type %q", nc.Type)
+		}
+	}
+	return r, nil
+}
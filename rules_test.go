@@ -0,0 +1,166 @@
+package auditlog
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRules(t *testing.T) {
+	alerts := make(chan *Alert, 4)
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, store := newTestLogger(t,
+		WithClock(NewFixedClock(start, time.Second)),
+		WithRules(&Rule{
+			Name:      "repeated login failures",
+			Event:     EventLoginFailure,
+			GroupBy:   AttrUser,
+			Threshold: 5,
+			Window:    time.Minute,
+			Notifiers: []Notifier{NotifierFunc(func(a *Alert) error {
+				alerts <- a
+				return nil
+			})},
+		}))
+	l.Start()
+	defer l.Stop()
+
+	for i := 0; i < 4; i++ {
+		l.EmitSync(LoginFailure("auth", "jqp", "192.0.2.1", "bad password"))
+		l.EmitSync(LoginFailure("auth", "alice", "192.0.2.1", "bad password"))
+	}
+
+	select {
+	case a := <-alerts:
+		t.Fatalf("unexpected alert for %s", a.Group)
+	default:
+	}
+
+	l.EmitSync(LoginFailure("auth", "jqp", "192.0.2.1", "bad password"))
+
+	select {
+	case a := <-alerts:
+		if a.Group != "jqp" || a.Count != 5 {
+			t.Fatalf("wrong alert: %+v", a)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no alert was sent")
+	}
+
+	ev, err := store.Event(l.Count() - 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if ev.Event != "rule matched" || ev.Level != "WARNING" {
+		t.Fatalf("expected a rule matched event, have %s", ev)
+	}
+}
+
+func TestRulesDropAlerts(t *testing.T) {
+	release := make(chan struct{})
+	l, store := newTestLogger(t,
+		WithRules(&Rule{
+			Name:  "every tick",
+			Event: "tick",
+			Notifiers: []Notifier{NotifierFunc(func(a *Alert) error {
+				<-release
+				return nil
+			})},
+		}))
+	l.Start()
+	defer l.Stop()
+
+	// One alert is held by the blocked notifier, and the queue
+	// holds the next DefaultNotifyQueueSize; the rest are dropped.
+	for i := 0; i < DefaultNotifyQueueSize+5; i++ {
+		l.InfoSync("rules_test", "tick", nil)
+	}
+
+	var engine *RuleEngine
+	for _, a := range l.analyzers {
+		if re, ok := a.(*RuleEngine); ok {
+			engine = re
+		}
+	}
+
+	if dropped := engine.Dropped(); dropped < 4 {
+		t.Fatalf("expected at least 4 dropped alerts, have %d", dropped)
+	}
+
+	// The drops are recorded once the held alert is delivered,
+	// which Stop waits for.
+	close(release)
+	l.Stop()
+
+	ev := findEvent(t, store, EventAlertsDropped)
+	if count, _ := ev.attr("count"); count != strconv.FormatUint(engine.Dropped(), 10) {
+		t.Fatalf("expected %d dropped alerts, have %v", engine.Dropped(), ev.Attributes)
+	}
+}
+
+func TestRulesExpireWindows(t *testing.T) {
+	engine := NewRuleEngine(&Rule{
+		Name:      "repeated login failures",
+		Event:     EventLoginFailure,
+		GroupBy:   AttrUser,
+		Threshold: 5,
+		Window:    time.Minute,
+	})
+
+	// Each user fails once, a minute after the last, so every
+	// window but the newest has closed.
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 1000; i++ {
+		engine.Analyze(&Event{
+			When:       start.Add(time.Duration(i) * time.Minute).UnixNano(),
+			Event:      EventLoginFailure,
+			Attributes: []Attribute{{AttrUser, strconv.Itoa(i)}},
+		})
+	}
+
+	if len(engine.windows) > 2*minExpiry {
+		t.Fatalf("expected closed windows to expire, have %d windows", len(engine.windows))
+	}
+}
+
+func TestEmailNotifierTimeout(t *testing.T) {
+	// The server accepts connections, but never greets the client.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer ln.Close()
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	en := &EmailNotifier{
+		Addr:    ln.Addr().String(),
+		From:    "auditlog@example.com",
+		To:      []string{"security@example.com"},
+		Timeout: 50 * time.Millisecond,
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- en.Notify(&Alert{Rule: "test", Event: &Event{}})
+	}()
+
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Fatal("expected the notification to time out")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the notification didn't time out")
+	}
+}
@@ -0,0 +1,129 @@
+package auditlog
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A SamplingPolicy limits how many DEBUG and INFO events are recorded
+// for each combination of actor and event. In each interval, the
+// first First events are recorded, and after that only every
+// Thereafter'th event. At the end of each interval, the logger
+// records an INFO "sampling summary" event for every actor and event
+// that had events sampled away, so the chain remains honest about
+// what was omitted. Events at WARNING and above are never sampled.
+type SamplingPolicy struct {
+	Interval   time.Duration
+	First      int
+	Thereafter int
+}
+
+// WithSampling enables sampling of DEBUG and INFO events.
+func WithSampling(policy SamplingPolicy) Option {
+	return func(l *Logger) {
+		if policy.Interval <= 0 {
+			return
+		}
+
+		l.sampler = &sampler{
+			policy: policy,
+			counts: map[sampleKey]*sampleCount{},
+			start:  l.now(),
+		}
+		l.addTask(every(policy.Interval, true, (*Logger).logSamplingSummary))
+	}
+}
+
+type sampleKey struct {
+	actor, event string
+}
+
+type sampleCount struct {
+	seen, dropped uint64
+}
+
+type sampler struct {
+	lock   sync.Mutex
+	policy SamplingPolicy
+	counts map[sampleKey]*sampleCount
+	start  int64
+}
+
+// keep reports whether ev should be recorded.
+func (s *sampler) keep(ev *Event) bool {
+	if ev.Actor == internalActor || (ev.Level != "DEBUG" && ev.Level != "INFO") {
+		return true
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := sampleKey{ev.Actor, ev.Event}
+	count, ok := s.counts[key]
+	if !ok {
+		count = &sampleCount{}
+		s.counts[key] = count
+	}
+	count.seen++
+
+	if count.seen <= uint64(s.policy.First) {
+		return true
+	}
+
+	if s.policy.Thereafter > 0 && (count.seen-uint64(s.policy.First))%uint64(s.policy.Thereafter) == 0 {
+		return true
+	}
+
+	count.dropped++
+	return false
+}
+
+type sampleSummary struct {
+	key     sampleKey
+	dropped uint64
+}
+
+// reset starts a new interval, returning the number of events dropped
+// for each actor and event in the interval that just ended.
+func (s *sampler) reset(now int64) (start int64, summaries []sampleSummary) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for key, count := range s.counts {
+		if count.dropped > 0 {
+			summaries = append(summaries, sampleSummary{key, count.dropped})
+		}
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i].key, summaries[j].key
+		if a.actor != b.actor {
+			return strings.Compare(a.actor, b.actor) < 0
+		}
+		return strings.Compare(a.event, b.event) < 0
+	})
+
+	start = s.start
+	s.start = now
+	s.counts = map[sampleKey]*sampleCount{}
+	return start, summaries
+}
+
+// logSamplingSummary records how many events were sampled away since
+// the last summary.
+func (l *Logger) logSamplingSummary() {
+	now := l.now()
+	start, summaries := l.sampler.reset(now)
+	for _, summary := range summaries {
+		l.logInternal(levelInfo, "sampling summary", []Attribute{
+			{"actor", summary.key.actor},
+			{"event", summary.key.event},
+			{"dropped", strconv.FormatUint(summary.dropped, 10)},
+			{"start", strconv.FormatInt(start, 10)},
+			{"end", strconv.FormatInt(now, 10)},
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package auditlog
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// A schemaMigration is one step in the history of the Postgres
+// schema. Migrations are applied in order, each exactly once, and
+// recorded in the schema_version table. They are written so that
+// applying them to a database whose tables were created by hand from
+// an older auditlog.sql is harmless, which lets such databases be
+// brought under version control.
+type schemaMigration struct {
+	version     int
+	description string
+	sql         string
+}
+
+// migrationFiles holds the migrations, named NNNN_description.sql.
+//
+//go:embed schema/*.sql
+var migrationFiles embed.FS
+
+var schemaMigrations = loadMigrations()
+
+// loadMigrations reads the embedded migrations in order of version.
+func loadMigrations() []schemaMigration {
+	entries, err := migrationFiles.ReadDir("schema")
+	if err != nil {
+		panic(err)
+	}
+
+	var migrations []schemaMigration
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		prefix, description, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version != len(migrations)+1 {
+			panic("auditlog: misnumbered schema migration " + entry.Name())
+		}
+
+		body, err := migrationFiles.ReadFile(path.Join("schema", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+
+		migrations = append(migrations, schemaMigration{
+			version:     version,
+			description: strings.ReplaceAll(description, "_", " "),
+			sql:         string(body),
+		})
+	}
+	return migrations
+}
+
+// SchemaVersion returns the version of the Postgres schema this
+// package expects.
+func SchemaVersion() int {
+	return len(schemaMigrations)
+}
+
+// schemaLockKey is the advisory lock held while migrating, so that
+// loggers starting together don't apply a migration twice.
+const schemaLockKey = 0x61756469746c6f67 // "auditlog"
+
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+    version     INT4 PRIMARY KEY,
+    description TEXT NOT NULL,
+    applied     TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// currentSchemaVersion returns the newest migration recorded in the
+// database, or zero if none has been.
+func currentSchemaVersion(tx sqlTx) (int, error) {
+	var present bool
+	err := tx.QueryRow(`SELECT to_regclass('schema_version') IS NOT NULL`).Scan(&present)
+	if err != nil || !present {
+		return 0, err
+	}
+
+	var version int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// migrateSchema applies the migrations the database hasn't had,
+// returning the versions it was at before and after. A database that
+// is up to date is only read, so a logger connecting with a write-once
+// role can still start.
+func migrateSchema(db *sql.DB) (from, to int, err error) {
+	from, err = currentSchemaVersion(db)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	latest := SchemaVersion()
+	if from > latest {
+		return from, from, fmt.Errorf("auditlog: the database schema is at version %d, newer than version %d supported here", from, latest)
+	} else if from == latest {
+		return from, from, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return from, from, err
+	}
+
+	err = applyMigrations(tx, &from)
+	if err != nil {
+		tx.Rollback()
+		return from, from, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return from, from, err
+	}
+	return from, latest, nil
+}
+
+// applyMigrations applies the pending migrations in tx, once it holds
+// the migration lock; from is updated to the version the database was
+// at once the lock was taken, as another logger may have migrated it
+// first.
+func applyMigrations(tx *sql.Tx, from *int) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, int64(schemaLockKey))
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(schemaVersionTable); err != nil {
+		return err
+	}
+
+	*from, err = currentSchemaVersion(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range schemaMigrations[*from:] {
+		if _, err = tx.Exec(m.sql); err != nil {
+			return fmt.Errorf("auditlog: applying schema migration %d (%s): %w", m.version, m.description, err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO schema_version (version, description) VALUES ($1, $2)`,
+			m.version, m.description)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateSchema creates the audit tables in the Postgres database
+// described by cd, unless they are already present, and reports
+// whether they were created. An existing schema is brought up to date
+// as by MigrateSchema. The migrations are applied in a single
+// transaction.
+func CreateSchema(cd *DBConnDetails) (bool, error) {
+	db, err := sql.Open("postgres", cd.String())
+	if err != nil {
+		return false, err
+	}
+	defer db.Close()
+
+	return createSchema(db)
+}
+
+func createSchema(db *sql.DB) (bool, error) {
+	var present bool
+	err := db.QueryRow(`SELECT to_regclass('events') IS NOT NULL`).Scan(&present)
+	if err != nil {
+		return false, err
+	}
+
+	_, _, err = migrateSchema(db)
+	return !present && err == nil, err
+}
+
+// MigrateSchema applies any migrations the Postgres database described
+// by cd hasn't had, creating the audit tables if they are missing, and
+// returns the schema versions before and after. The logger does this
+// itself when it connects, so this is only needed to migrate ahead of
+// a deployment, or with credentials the logger doesn't have.
+func MigrateSchema(cd *DBConnDetails) (from, to int, err error) {
+	db, err := sql.Open("postgres", cd.String())
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	return migrateSchema(db)
+}
+
+// createSchema creates the audit tables if they aren't present.
+func (s *pgStore) createSchema() (bool, error) {
+	created, err := createSchema(s.db)
+	if err != nil {
+		return false, err
+	}
+	return created, s.checkVersioned()
+}
@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS events (
+    id          INT8 PRIMARY KEY,
+    timestamp   INT8 NOT NULL,
+    received    INT8 NOT NULL,
+    level       TEXT NOT NULL,
+    actor       TEXT NOT NULL,
+    event       TEXT NOT NULL,
+    signature   BYTEA NOT NULL,
+    payload     BYTEA
+);
+
+CREATE TABLE IF NOT EXISTS attributes (
+    id          SERIAL PRIMARY KEY,
+    name        TEXT NOT NULL,
+    value       TEXT NOT NULL,
+    event       INT8 NOT NULL,
+    position    INT8 NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS error_events (
+    id          SERIAL PRIMARY KEY,
+    serial      INT8 NOT NULL,
+    timestamp   INT8 NOT NULL,
+    received    INT8 NOT NULL,
+    level       TEXT NOT NULL,
+    actor       TEXT NOT NULL,
+    event       TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS error_attributes (
+    id          SERIAL PRIMARY KEY,
+    name        TEXT NOT NULL,
+    value       TEXT NOT NULL,
+    event       INT8 NOT NULL,
+    position    INT8 NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS errors (
+    id          SERIAL PRIMARY KEY,
+    timestamp   INT8 NOT NULL,
+    message     TEXT NOT NULL,
+    event       INT8
+);
+
+CREATE TABLE IF NOT EXISTS pruned (
+    id          INT8 PRIMARY KEY,
+    end_serial  INT8 NOT NULL,
+    signature   BYTEA NOT NULL
+);
@@ -0,0 +1,3 @@
+CREATE INDEX IF NOT EXISTS attributes_event ON attributes (event, position);
+CREATE INDEX IF NOT EXISTS error_events_serial ON error_events (serial);
+CREATE INDEX IF NOT EXISTS error_attributes_event ON error_attributes (event, position);
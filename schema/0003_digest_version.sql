@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN IF NOT EXISTS digest_version INT2 NOT NULL DEFAULT 0;
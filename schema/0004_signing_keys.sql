@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS signing_keys (
+    first_serial INT8 PRIMARY KEY,
+    public_key   BYTEA NOT NULL
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS checkpoints (
+    serial      INT8 PRIMARY KEY,
+    taken       INT8 NOT NULL,
+    head        TEXT NOT NULL,
+    signature   BYTEA NOT NULL
+);
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS cosignatures (
+    serial      INT8 NOT NULL,
+    witness     TEXT NOT NULL,
+    signature   BYTEA NOT NULL,
+    PRIMARY KEY (serial, witness)
+);
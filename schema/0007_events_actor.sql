@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS events_actor ON events (actor, id);
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS events_level ON events (level, id);
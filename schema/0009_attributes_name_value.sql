@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS attributes_name_value ON attributes (name, substr(value, 1, 200));
@@ -0,0 +1,46 @@
+package auditlog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSchemaMigrations(t *testing.T) {
+	if SchemaVersion() == 0 {
+		t.Fatal("expected schema migrations to be embedded")
+	}
+
+	// Every table and column in auditlog.sql is created by some
+	// migration, so a new database matches the published schema.
+	var all strings.Builder
+	for i, m := range schemaMigrations {
+		if m.version != i+1 {
+			t.Fatalf("expected migration %d, have %d", i+1, m.version)
+		}
+		all.WriteString(m.sql)
+	}
+
+	for table, columns := range schemaColumns {
+		if !strings.Contains(all.String(), "CREATE TABLE IF NOT EXISTS "+table+" (") {
+			t.Fatalf("no migration creates %s", table)
+		}
+
+		for _, column := range columns {
+			if !strings.Contains(all.String(), "    "+column+" ") {
+				t.Fatalf("no migration creates %s.%s", table, column)
+			}
+		}
+	}
+
+	for _, added := range schemaAddedColumns {
+		if !strings.Contains(all.String(), "ADD COLUMN IF NOT EXISTS "+added.column+" "+added.definition) {
+			t.Fatalf("no migration adds %s.%s", added.table, added.column)
+		}
+	}
+
+	for name, definition := range schemaIndexes {
+		if !strings.Contains(all.String(), "CREATE INDEX IF NOT EXISTS "+name+" ON "+definition) {
+			t.Fatalf("no migration creates index %s", name)
+		}
+	}
+}
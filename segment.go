@@ -0,0 +1,84 @@
+package auditlog
+
+import "strconv"
+
+// A SegmentPolicy rotates the chain automatically once it holds
+// MaxEvents events or MaxBytes bytes of event data, keeping the time
+// needed to verify or certify any one chain bounded. Either limit may
+// be zero to disable it. Next returns the empty store for each new
+// chain, as passed to Rotate.
+type SegmentPolicy struct {
+	MaxEvents uint64
+	MaxBytes  int64
+	Next      func() (Store, error)
+}
+
+// WithSegmentation rotates the chain as described by the policy.
+func WithSegmentation(policy SegmentPolicy) Option {
+	return func(l *Logger) {
+		if policy.Next == nil || (policy.MaxEvents == 0 && policy.MaxBytes <= 0) {
+			return
+		}
+
+		l.segment = &policy
+	}
+}
+
+// size estimates the number of bytes needed to store an event.
+func (ev *Event) size() int64 {
+	n := 24 + len(ev.Level) + len(ev.Actor) + len(ev.Event) + len(ev.Signature)
+	for _, attr := range ev.Attributes {
+		n += len(attr.Name) + len(attr.Value)
+	}
+	return int64(n)
+}
+
+// segmentFull reports whether the current chain has reached the
+// limits of the segmentation policy, allowing for its seal event.
+func (l *Logger) segmentFull() bool {
+	if l.segment.MaxEvents > 0 && l.segmentEvents+1 >= l.segment.MaxEvents {
+		return true
+	}
+	return l.segment.MaxBytes > 0 && l.segmentBytes >= l.segment.MaxBytes
+}
+
+// segmentRecorded accounts for a recorded event, rotating the chain
+// if the segmentation policy's limits have been reached; the caller
+// must hold the logger's lock. If the chain can't be rotated, an
+// error event is recorded and rotation is next attempted once
+// another full segment has been recorded.
+func (l *Logger) segmentRecorded(ev *Event) {
+	if l.segment == nil {
+		return
+	}
+
+	l.segmentEvents++
+	l.segmentBytes += ev.size()
+	// Rotation waits until buffered events have been stored in
+	// the current chain.
+	if !l.segmentFull() || l.buffering() {
+		return
+	}
+
+	next, err := l.segment.Next()
+	if err == nil {
+		err = l.rotate(next)
+		if err != nil {
+			next.Close()
+		}
+	}
+
+	if err != nil {
+		l.segmentEvents, l.segmentBytes = 0, 0
+		l.record(&Event{
+			When:  l.now(),
+			Level: levelStrings[levelError],
+			Actor: internalActor,
+			Event: "rotation failure",
+			Attributes: []Attribute{
+				{"error", err.Error()},
+				{"serial", strconv.FormatUint(l.counter, 10)},
+			},
+		})
+	}
+}
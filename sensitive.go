@@ -0,0 +1,139 @@
+package auditlog
+
+import (
+	"errors"
+	"strconv"
+)
+
+// sealedPrefix marks an attribute value encrypted under a sensitive
+// attribute policy.
+const sealedPrefix = "sealed:v1:"
+
+// A SensitivePolicy encrypts the values of the named attributes at
+// rest, so that reading the store directly doesn't reveal them. The
+// values are encrypted with the key Keys returns for KeyName; a
+// KeyStore backed by a key management service would return a data
+// key unwrapped by the service. Sensitive values are only decrypted
+// by ReadEvent, for readers that Authorize accepts.
+type SensitivePolicy struct {
+	Keys       KeyStore
+	KeyName    string
+	Attributes []string
+	Authorize  func(reader string) bool
+}
+
+// WithSensitiveAttributes encrypts sensitive attribute values as
+// described by the policy.
+func WithSensitiveAttributes(policy SensitivePolicy) Option {
+	return func(l *Logger) {
+		if policy.Keys == nil || len(policy.Attributes) == 0 {
+			return
+		}
+
+		l.sensitive = &policy
+	}
+}
+
+// ErrUnauthorized is returned by ReadEvent when the reader isn't
+// permitted to see sensitive attribute values.
+var ErrUnauthorized = errors.New("auditlog: reader is not authorized")
+
+// seal encrypts the sensitive attribute values in an event. If they
+// can't be encrypted, they are withheld from the event and the error
+// is noted in their place.
+func (l *Logger) seal(ev *Event) {
+	if l.sensitive == nil {
+		return
+	}
+
+	sensitive := map[string]bool{}
+	for _, name := range l.sensitive.Attributes {
+		sensitive[name] = true
+	}
+
+	var attrs []Attribute
+	var err error
+	for i := range ev.Attributes {
+		if !sensitive[ev.Attributes[i].Name] {
+			continue
+		}
+
+		// The attributes belong to the caller, so they're
+		// copied before being modified.
+		if attrs == nil {
+			attrs = make([]Attribute, len(ev.Attributes))
+			copy(attrs, ev.Attributes)
+		}
+
+		if err == nil {
+			var id string
+			var key []byte
+			id, key, err = l.sensitive.Keys.SubjectKey(l.sensitive.KeyName)
+			if err == nil {
+				attrs[i].Value, err = encryptValue(sealedPrefix, id, key, attrs[i].Name, attrs[i].Value)
+			}
+		}
+
+		if err != nil {
+			attrs[i].Value = ErasedValue
+		}
+	}
+
+	if attrs == nil {
+		return
+	}
+
+	ev.Attributes = attrs
+	if err != nil {
+		ev.Attributes = append(ev.Attributes, Attribute{"encryption_error", err.Error()})
+	}
+}
+
+// ReadEvent loads an event with its sensitive attribute values
+// decrypted, and with personal data revealed if a shredding policy
+// is in use. The reader must be accepted by the policy's Authorize
+// function, and each read is recorded as a signed "sensitive read"
+// event naming the reader. The returned event's signature won't
+// verify; the stored event should be verified instead. The logger
+// must be running.
+func (l *Logger) ReadEvent(reader string, serial uint64) (*Event, error) {
+	if l.sensitive == nil {
+		return nil, errors.New("auditlog: no sensitive attribute policy")
+	}
+
+	attributes := []Attribute{
+		{"reader", reader},
+		{"serial", strconv.FormatUint(serial, 10)},
+	}
+
+	if l.sensitive.Authorize == nil || !l.sensitive.Authorize(reader) {
+		l.logInternal(levelWarning, "unauthorized sensitive read", attributes)
+		return nil, ErrUnauthorized
+	}
+
+	if !l.accept(levelInternal) {
+		return nil, errors.New("auditlog: logger is not running")
+	}
+
+	wait := make(chan struct{}, 0)
+	l.logInternalEvent(levelInfo, "sensitive read", attributes, wait, nil)
+	<-wait
+
+	ev, err := l.store.Event(serial)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range ev.Attributes {
+		ev.Attributes[i].Value, err = decryptValue(sealedPrefix, l.sensitive.Keys,
+			ev.Attributes[i].Name, ev.Attributes[i].Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if l.shredding != nil {
+		return Reveal(ev, l.shredding.Keys)
+	}
+	return ev, nil
+}
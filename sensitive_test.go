@@ -0,0 +1,61 @@
+package auditlog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSensitiveAttributes(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	store := NewMemoryStore()
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithSensitiveAttributes(SensitivePolicy{
+		Keys:       NewMemoryKeyStore(),
+		KeyName:    "audit",
+		Attributes: []string{"token"},
+		Authorize: func(reader string) bool {
+			return reader == "auditor"
+		},
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("sensitive_test", "api key issued", []Attribute{
+		{"user", "jqp"},
+		{"token", "hunter2"},
+	})
+
+	ev, err := store.Event(0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if value, _ := ev.attr("token"); !strings.HasPrefix(value, sealedPrefix) {
+		t.Fatalf("sensitive value was not encrypted: %q", value)
+	}
+
+	if _, err = l.ReadEvent("dba", 0); err != ErrUnauthorized {
+		t.Fatalf("expected an unauthorized read to fail, have %v", err)
+	}
+
+	ev, err = l.ReadEvent("auditor", 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if value, _ := ev.attr("token"); value != "hunter2" {
+		t.Fatalf("expected token=hunter2, have %q", value)
+	}
+
+	// Both reads were recorded.
+	if l.Count() != 3 {
+		t.Fatalf("expected 3 events, have %d", l.Count())
+	}
+
+	if err = l.verifyAuditChain(); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package auditlog
+
+// A SerialPolicy decides how gaps in the serial numbers of a chain are
+// treated. Whatever the policy, the logger allocates serial numbers
+// itself, continuing from one past the highest serial number in the
+// store (see Store.Count), so a gap never leads it to reuse a serial
+// number.
+type SerialPolicy int
+
+const (
+	// SerialContiguous requires the serial numbers in the chain to
+	// run without gaps; a missing event fails verification with
+	// ErrNoEvent. This is the default.
+	SerialContiguous SerialPolicy = iota
+
+	// SerialGapped tolerates gaps, as left by an event whose serial
+	// number was allocated but which was never stored. Each event
+	// is verified against the event before it in the chain, so an
+	// event that was stored and then removed still fails
+	// verification: the event after it was signed over it.
+	SerialGapped
+)
+
+// serialPolicies maps the names used in configuration files to serial
+// policies.
+var serialPolicies = map[string]SerialPolicy{
+	"":           SerialContiguous,
+	"contiguous": SerialContiguous,
+	"gapped":     SerialGapped,
+}
+
+// WithSerialPolicy sets how gaps in the chain's serial numbers are
+// treated when it is verified.
+func WithSerialPolicy(policy SerialPolicy) Option {
+	return func(l *Logger) {
+		l.serials = policy
+	}
+}
@@ -0,0 +1,111 @@
+package auditlog
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// sparseStore is a store whose chain may skip serial numbers.
+type sparseStore struct {
+	lock   sync.Mutex
+	events []*Event
+}
+
+func (ss *sparseStore) StoreEvent(ev *Event) error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if n := len(ss.events); n > 0 && ev.Serial <= ss.events[n-1].Serial {
+		return ErrDuplicateSerial
+	}
+	ss.events = append(ss.events, copyEvent(ev))
+	return nil
+}
+
+func (ss *sparseStore) StoreError(ev *ErrorEvent) error { return nil }
+
+func (ss *sparseStore) Count() (uint64, error) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if len(ss.events) == 0 {
+		return 0, nil
+	}
+	return ss.events[len(ss.events)-1].Serial + 1, nil
+}
+
+func (ss *sparseStore) Event(serial uint64) (*Event, error) {
+	events, _ := ss.Events(serial, serial)
+	if len(events) == 0 {
+		return nil, ErrNoEvent
+	}
+	return events[0], nil
+}
+
+func (ss *sparseStore) Events(start, end uint64) ([]*Event, error) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	var events []*Event
+	for _, ev := range ss.events {
+		if ev.Serial >= start && ev.Serial <= end {
+			events = append(events, copyEvent(ev))
+		}
+	}
+	return events, nil
+}
+
+func (ss *sparseStore) Errors(start, end uint64) ([]*ErrorEvent, error) { return nil, nil }
+
+func (ss *sparseStore) Close() error { return nil }
+
+func TestSerialPolicy(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	// Serial numbers 3 and 4 were allocated but never stored.
+	store := &sparseStore{}
+	var prev []byte
+	for _, serial := range []uint64{0, 1, 2, 5, 6} {
+		ev := &Event{
+			Serial:   serial,
+			When:     time.Now().UnixNano(),
+			Received: time.Now().UnixNano(),
+			Level:    "INFO",
+			Actor:    "serial_test",
+			Event:    "event",
+		}
+		if err := ev.Sign(signer, prev, nil); err != nil {
+			t.Fatalf("%v", err)
+		}
+		prev = ev.Signature
+		store.StoreEvent(ev)
+	}
+
+	if _, err := NewWithStore(store, signer, WithoutEcho()); err != ErrNoEvent {
+		t.Fatalf("expected the gap to fail verification, have %v", err)
+	}
+
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithSerialPolicy(SerialGapped))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	l.InfoSync("serial_test", "after the gap", nil)
+	l.Stop()
+
+	last, err := store.Event(7)
+	if err != nil {
+		t.Fatalf("expected the next event to follow the highest serial number: %v", err)
+	}
+
+	if !last.Verify(&signer.PublicKey, prev) {
+		t.Fatal("event after the gap isn't chained to the last event stored")
+	}
+
+	// Removing an event that was stored still breaks the chain.
+	store.events = append(store.events[:1], store.events[2:]...)
+	if _, err = NewWithStore(store, signer, WithoutEcho(), WithSerialPolicy(SerialGapped)); err == nil {
+		t.Fatal("expected a removed event to fail verification")
+	}
+}
@@ -0,0 +1,339 @@
+// Package server serves an audit chain over HTTP, so that services
+// not written in Go can record events in the same chain as the
+// logger's own, and auditors can read it:
+//
+//	POST /events          records the JSON-encoded Submission in the
+//	                      body, returning No Content once it has been
+//	                      stored.
+//	GET  /events          returns the events selected by the query
+//	                      parameters start, end, level, min_level,
+//	                      actor, event, and attribute (name=value,
+//	                      which may be repeated), as a JSON array.
+//	                      At most MaxRange events are searched.
+//	GET  /head            returns the head of the chain as a JSON
+//	                      auditlog.VerifiedHead, or No Content if the
+//	                      chain is empty.
+//	GET  /certification   returns a certification of the events from
+//	                      start to end, at most MaxRange of them.
+//	GET  /public-key      returns the logger's public key, PEM-encoded.
+//
+// Every request must be authenticated, and authorized to read the
+// chain or, for POST /events, to write to it. The principal making it
+// is recorded as the submitter of the events it records, and as the
+// accessor or custodian of the events it reads.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kisom/auditlog"
+)
+
+// MaxSubmissionSize bounds the submissions a Server reads.
+const MaxSubmissionSize = 1 << 20
+
+// DefaultMaxRange is the number of events a request may read if the
+// Server doesn't set MaxRange.
+const DefaultMaxRange = 10000
+
+// AttrSubmitter is the attribute naming the principal that submitted
+// an event.
+const AttrSubmitter = "submitter"
+
+// A Permission is a set of the operations a principal may perform.
+type Permission int
+
+const (
+	// PermRead permits a principal to read the chain: its events,
+	// head, certifications, and public key.
+	PermRead Permission = 1 << iota
+
+	// PermWrite permits a principal to submit events.
+	PermWrite
+)
+
+// A Submission is an event submitted to the server. The level is one
+// of "DEBUG", "INFO", "WARNING", "ERROR", or "CRITICAL"; the actor
+// defaults to the principal submitting it, and may not be the
+// logger's own actor (see auditlog.ReservedActor). The submitter is
+// always recorded in the AttrSubmitter attribute, which the
+// submission may not set itself.
+type Submission struct {
+	Level      string
+	Actor      string
+	Event      string
+	Attributes []auditlog.Attribute
+}
+
+// A Server serves the chain kept by a logger.
+type Server struct {
+	Logger *auditlog.Logger
+
+	// Authenticate returns the principal making a request, or false
+	// if the request isn't authenticated. If it is nil, every
+	// request is refused.
+	Authenticate func(r *http.Request) (principal string, ok bool)
+
+	// Authorize returns the permissions granted to an
+	// authenticated principal. If it is nil, every principal may
+	// read and write.
+	Authorize func(principal string) Permission
+
+	// MaxRange bounds the number of events a request may read. A
+	// request that doesn't give an end reads at most MaxRange
+	// events from its start. If it is zero, DefaultMaxRange is
+	// used.
+	MaxRange uint64
+}
+
+// Grants returns an Authorize function granting each principal in the
+// map the permissions it maps to, and others none.
+func Grants(perms map[string]Permission) func(principal string) Permission {
+	return func(principal string) Permission {
+		return perms[principal]
+	}
+}
+
+// BearerTokens returns an Authenticate function accepting the bearer
+// tokens in the map's keys, each naming the principal it maps to.
+func BearerTokens(tokens map[string]string) func(r *http.Request) (string, bool) {
+	return func(r *http.Request) (string, bool) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			return "", false
+		}
+
+		var principal string
+		found := false
+		for candidate, name := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+				principal, found = name, true
+			}
+		}
+		return principal, found
+	}
+}
+
+// ServeHTTP serves the API.
+func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	var principal string
+	ok := false
+	if s.Authenticate != nil {
+		principal, ok = s.Authenticate(req)
+	}
+
+	if !ok {
+		rw.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(rw, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	need := PermRead
+	if req.Method == http.MethodPost {
+		need = PermWrite
+	}
+
+	if s.Authorize != nil && s.Authorize(principal)&need == 0 {
+		http.Error(rw, "permission denied", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case req.URL.Path == "/events" && req.Method == http.MethodPost:
+		s.submit(rw, req, principal)
+
+	case req.URL.Path == "/events" && req.Method == http.MethodGet:
+		q, err := parseQuery(req, s.maxRange())
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		events, err := s.Logger.Query(principal, q)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if events == nil {
+			events = []*auditlog.Event{}
+		}
+		writeJSON(rw, events)
+
+	case req.URL.Path == "/head" && req.Method == http.MethodGet:
+		head := s.Logger.Head()
+		if head == nil {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(rw, head)
+
+	case req.URL.Path == "/certification" && req.Method == http.MethodGet:
+		start, end, err := parseRange(req, s.maxRange())
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		cert, err := s.Logger.CertifyAs(principal, start, end)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(cert)
+
+	case req.URL.Path == "/public-key" && req.Method == http.MethodGet:
+		der, err := s.Logger.Public()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/x-pem-file")
+		rw.Write(pem.EncodeToMemory(&pem.Block{Type: "EC PUBLIC KEY", Bytes: der}))
+
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+// submit records the event submitted in a request.
+func (s *Server) submit(rw http.ResponseWriter, req *http.Request, principal string) {
+	var sub Submission
+	err := json.NewDecoder(io.LimitReader(req.Body, MaxSubmissionSize)).Decode(&sub)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if sub.Event == "" {
+		http.Error(rw, "no event given", http.StatusBadRequest)
+		return
+	}
+
+	if !auditlog.LevelAtLeast(sub.Level, "debug") {
+		http.Error(rw, "unknown level "+sub.Level, http.StatusBadRequest)
+		return
+	}
+
+	if sub.Actor == "" {
+		sub.Actor = principal
+	}
+
+	if auditlog.ReservedActor(sub.Actor) {
+		http.Error(rw, "reserved actor "+sub.Actor, http.StatusForbidden)
+		return
+	}
+
+	for _, attr := range sub.Attributes {
+		if attr.Name == AttrSubmitter {
+			http.Error(rw, "the "+AttrSubmitter+" attribute is set by the server", http.StatusBadRequest)
+			return
+		}
+	}
+
+	attrs := append(sub.Attributes, auditlog.Attribute{Name: AttrSubmitter, Value: principal})
+	err = s.Logger.LogDurable(auditlog.DurabilityDefault, sub.Level, sub.Actor, sub.Event, attrs)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// maxRange returns the number of events a request may read.
+func (s *Server) maxRange() uint64 {
+	if s.MaxRange == 0 {
+		return DefaultMaxRange
+	}
+	return s.MaxRange
+}
+
+// parseSerial returns the serial number in the named query parameter,
+// or zero if it isn't given.
+func parseSerial(req *http.Request, name string) (uint64, error) {
+	value := req.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+
+	serial, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid " + name + ": " + value)
+	}
+	return serial, nil
+}
+
+// parseRange returns the range of serial numbers given by a request's
+// start and end parameters, which may hold at most max events. If end
+// isn't given, or is zero, which the logger takes as the end of the
+// chain, the range holds the max events from start.
+func parseRange(req *http.Request, max uint64) (start, end uint64, err error) {
+	if start, err = parseSerial(req, "start"); err != nil {
+		return 0, 0, err
+	}
+
+	if end, err = parseSerial(req, "end"); err != nil {
+		return 0, 0, err
+	}
+
+	if end == 0 {
+		return start, boundedEnd(start, max), nil
+	}
+
+	if end < start {
+		return 0, 0, errors.New("end precedes start")
+	}
+
+	if end-start >= max {
+		return 0, 0, errors.New("the range exceeds " + strconv.FormatUint(max, 10) + " events")
+	}
+	return start, end, nil
+}
+
+// boundedEnd returns the end of the range holding max events from
+// start.
+func boundedEnd(start, max uint64) uint64 {
+	if start > math.MaxUint64-(max-1) {
+		return math.MaxUint64
+	}
+	return start + max - 1
+}
+
+// parseQuery returns the query described by a request's parameters,
+// reading at most max events.
+func parseQuery(req *http.Request, max uint64) (q auditlog.Query, err error) {
+	if q.Start, q.End, err = parseRange(req, max); err != nil {
+		return q, err
+	}
+
+	params := req.URL.Query()
+	q.Level = params.Get("level")
+	q.MinLevel = params.Get("min_level")
+	q.Actor = params.Get("actor")
+	q.Event = params.Get("event")
+	for _, attr := range params["attribute"] {
+		name, value, ok := strings.Cut(attr, "=")
+		if !ok {
+			return q, errors.New("invalid attribute: " + attr)
+		}
+		q.Attributes = append(q.Attributes, auditlog.Attribute{Name: name, Value: value})
+	}
+	return q, nil
+}
+
+// writeJSON writes v as the JSON response.
+func writeJSON(rw http.ResponseWriter, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(v)
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kisom/auditlog"
+)
+
+func TestServer(t *testing.T) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	audit, err := auditlog.NewWithStore(auditlog.NewMemoryStore(), signer, auditlog.WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	audit.Start()
+	defer audit.Stop()
+
+	srv := httptest.NewServer(&Server{
+		Logger:       audit,
+		Authenticate: BearerTokens(map[string]string{"s3cret": "billing", "r34d": "auditor"}),
+		Authorize:    Grants(map[string]Permission{"billing": PermRead | PermWrite, "auditor": PermRead}),
+		MaxRange:     100,
+	})
+	defer srv.Close()
+
+	do := func(method, path, token, body string) (int, []byte) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		defer resp.Body.Close()
+
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return resp.StatusCode, data
+	}
+
+	if status, _ := do("GET", "/head", "", ""); status != http.StatusUnauthorized {
+		t.Fatalf("expected an unauthenticated request to be refused, have %d", status)
+	}
+	if status, _ := do("GET", "/head", "wrong", ""); status != http.StatusUnauthorized {
+		t.Fatalf("expected an unknown token to be refused, have %d", status)
+	}
+
+	status, _ := do("POST", "/events", "s3cret",
+		`{"level": "warning", "event": "refund", "attributes": [{"name": "amount", "value": "10"}]}`)
+	if status != http.StatusNoContent {
+		t.Fatalf("expected the event to be recorded, have %d", status)
+	}
+
+	if status, _ = do("POST", "/events", "s3cret", `{"level": "loud", "event": "refund"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected an unknown level to be refused, have %d", status)
+	}
+
+	// The logger's own actor is reserved, and the submitter can't
+	// be forged.
+	if status, _ = do("POST", "/events", "s3cret", `{"level": "info", "actor": "auditlog", "event": "pruned range"}`); status != http.StatusForbidden {
+		t.Fatalf("expected the reserved actor to be refused, have %d", status)
+	}
+	status, _ = do("POST", "/events", "s3cret",
+		`{"level": "info", "event": "refund", "attributes": [{"name": "submitter", "value": "admin"}]}`)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected a forged submitter to be refused, have %d", status)
+	}
+
+	// A principal that may only read can't submit events.
+	if status, _ = do("POST", "/events", "r34d", `{"level": "info", "event": "refund"}`); status != http.StatusForbidden {
+		t.Fatalf("expected a read-only principal's submission to be refused, have %d", status)
+	}
+	if status, _ = do("GET", "/head", "r34d", ""); status != http.StatusOK {
+		t.Fatalf("expected a read-only principal to read the head, have %d", status)
+	}
+
+	// Reads are bounded.
+	if status, _ = do("GET", "/events?start=0&end=100", "s3cret", ""); status != http.StatusBadRequest {
+		t.Fatalf("expected a query over too many events to be refused, have %d", status)
+	}
+	if status, _ = do("GET", "/certification?start=0&end=1000", "s3cret", ""); status != http.StatusBadRequest {
+		t.Fatalf("expected a certification of too many events to be refused, have %d", status)
+	}
+
+	status, body := do("GET", "/events?event=refund&min_level=warning", "s3cret", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected the query to succeed, have %d: %s", status, body)
+	}
+
+	var events []*auditlog.Event
+	if err = json.Unmarshal(body, &events); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one event, have %d", len(events))
+	}
+
+	want := []auditlog.Attribute{{Name: "amount", Value: "10"}, {Name: AttrSubmitter, Value: "billing"}}
+	if ev := events[0]; ev.Actor != "billing" || ev.Level != "WARNING" || !reflect.DeepEqual(ev.Attributes, want) {
+		t.Fatalf("expected the submitted event, have %s", ev)
+	}
+
+	status, body = do("GET", "/head", "s3cret", "")
+	var head auditlog.VerifiedHead
+	if status != http.StatusOK || json.Unmarshal(body, &head) != nil || head.Serial == 0 {
+		t.Fatalf("expected the head, have %d: %s", status, body)
+	}
+
+	status, body = do("GET", "/certification?start=0&end=1", "s3cret", "")
+	if status != http.StatusOK {
+		t.Fatalf("expected a certification, have %d: %s", status, body)
+	}
+	if _, ok := auditlog.VerifyCertification(body, &signer.PublicKey); !ok {
+		t.Fatal("expected the certification to verify")
+	}
+
+	status, body = do("GET", "/public-key", "s3cret", "")
+	if block, _ := pem.Decode(body); status != http.StatusOK || block == nil || block.Type != "EC PUBLIC KEY" {
+		t.Fatalf("expected the public key, have %d: %s", status, body)
+	}
+}
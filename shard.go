@@ -0,0 +1,297 @@
+package auditlog
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventCrossCheckpoint is recorded in every shard of a ShardedLogger
+// at each cross-chain checkpoint. Its "shard" attribute names the
+// shard it was recorded in, and for each shard i, "head_i" holds the
+// serial number of that shard's last event and the hex-encoded
+// SHA-256 digest of its signature, separated by a colon; it is empty
+// if the shard held no events.
+const EventCrossCheckpoint = "cross-chain checkpoint"
+
+// A ShardPolicy decides which shard of a ShardedLogger records an
+// event.
+type ShardPolicy int
+
+const (
+	// ShardByActor sends every event from an actor to the same
+	// shard, chosen by a hash of the actor's name, so that each
+	// actor's events are ordered within one chain.
+	ShardByActor ShardPolicy = iota
+
+	// ShardRoundRobin spreads events evenly across the shards.
+	ShardRoundRobin
+)
+
+// A ShardedLogger partitions events across several loggers, each
+// writing its own chain to its own store, so that events are signed
+// and stored in parallel rather than one at a time behind a single
+// chain. The chains are tied together by cross-chain checkpoints: at
+// each one, the head of every chain is recorded in every chain, so
+// that no chain can be truncated or replaced without contradicting
+// the others.
+//
+// Events within a shard are ordered; events in different shards are
+// only ordered relative to the checkpoints between them.
+type ShardedLogger struct {
+	shards   []*Logger
+	policy   ShardPolicy
+	interval time.Duration
+
+	lock sync.Mutex
+	next int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewSharded sets up a sharded logger with one shard for each store,
+// all signing with signer. A cross-chain checkpoint is recorded every
+// interval while the logger runs, and when it stops; if interval is
+// zero, checkpoints are only recorded when the logger stops or
+// CrossCheckpoint is called. The options are applied to every shard,
+// so options naming a file, such as WithJournal, can't be used.
+func NewSharded(stores []Store, signer crypto.Signer, policy ShardPolicy, interval time.Duration, opts ...Option) (*ShardedLogger, error) {
+	if len(stores) == 0 {
+		return nil, errors.New("auditlog: a sharded logger needs at least one store")
+	}
+
+	s := &ShardedLogger{policy: policy, interval: interval}
+	for _, store := range stores {
+		l, err := NewWithSigner(store, signer, opts...)
+		if err != nil {
+			return nil, err
+		}
+		s.shards = append(s.shards, l)
+	}
+	return s, nil
+}
+
+// Shards returns the number of shards.
+func (s *ShardedLogger) Shards() int {
+	return len(s.shards)
+}
+
+// Shard returns the logger writing shard i, for reading or certifying
+// its chain.
+func (s *ShardedLogger) Shard(i int) *Logger {
+	return s.shards[i]
+}
+
+// shardFor returns the logger that records an event from actor.
+func (s *ShardedLogger) shardFor(actor string) *Logger {
+	if s.policy == ShardRoundRobin {
+		s.lock.Lock()
+		i := s.next
+		s.next = (s.next + 1) % len(s.shards)
+		s.lock.Unlock()
+		return s.shards[i]
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(actor))
+	return s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+// Start starts every shard.
+func (s *ShardedLogger) Start() error {
+	for i, l := range s.shards {
+		if err := l.Start(); err != nil {
+			for _, started := range s.shards[:i] {
+				started.Stop()
+			}
+			return err
+		}
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.checkpoints(s.stop, s.done)
+	return nil
+}
+
+// checkpoints records a cross-chain checkpoint every interval.
+func (s *ShardedLogger) checkpoints(stop, done chan struct{}) {
+	defer close(done)
+	if s.interval <= 0 {
+		<-stop
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.CrossCheckpoint()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Stop records a final cross-chain checkpoint and stops every shard.
+func (s *ShardedLogger) Stop() {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+		s.CrossCheckpoint()
+	}
+
+	for _, l := range s.shards {
+		l.Stop()
+	}
+}
+
+// CrossCheckpoint records the head of every shard in every shard, and
+// waits for the checkpoints to be recorded.
+func (s *ShardedLogger) CrossCheckpoint() {
+	attrs := make([]Attribute, 0, len(s.shards)+1)
+	attrs = append(attrs, Attribute{})
+	for i, l := range s.shards {
+		attrs = append(attrs, Attribute{"head_" + strconv.Itoa(i), l.shardHead()})
+	}
+
+	for i, l := range s.shards {
+		shardAttrs := make([]Attribute, len(attrs))
+		copy(shardAttrs, attrs)
+		shardAttrs[0] = Attribute{"shard", strconv.Itoa(i)}
+		l.logInternal(levelInfo, EventCrossCheckpoint, shardAttrs)
+	}
+}
+
+// shardHead describes the last event in the logger's chain for a
+// cross-chain checkpoint.
+func (l *Logger) shardHead() string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.counter == 0 || l.lastSignature == nil {
+		return ""
+	}
+	return formatShardHead(l.counter-1, l.lastSignature)
+}
+
+func formatShardHead(serial uint64, signature []byte) string {
+	digest := sha256.Sum256(signature)
+	return strconv.FormatUint(serial, 10) + ":" + hex.EncodeToString(digest[:])
+}
+
+// Debug records a debug event in the actor's shard.
+func (s *ShardedLogger) Debug(actor, event string, attributes []Attribute) {
+	s.shardFor(actor).Debug(actor, event, attributes)
+}
+
+// Info records an informational event in the actor's shard.
+func (s *ShardedLogger) Info(actor, event string, attributes []Attribute) {
+	s.shardFor(actor).Info(actor, event, attributes)
+}
+
+// InfoSync records an informational event in the actor's shard, and
+// waits for it to be recorded.
+func (s *ShardedLogger) InfoSync(actor, event string, attributes []Attribute) {
+	s.shardFor(actor).InfoSync(actor, event, attributes)
+}
+
+// Warning records a warning event in the actor's shard.
+func (s *ShardedLogger) Warning(actor, event string, attributes []Attribute) {
+	s.shardFor(actor).Warning(actor, event, attributes)
+}
+
+// WarningSync records a warning event in the actor's shard, and waits
+// for it to be recorded.
+func (s *ShardedLogger) WarningSync(actor, event string, attributes []Attribute) {
+	s.shardFor(actor).WarningSync(actor, event, attributes)
+}
+
+// Error records an error event in the actor's shard.
+func (s *ShardedLogger) Error(actor, event string, attributes []Attribute) {
+	s.shardFor(actor).Error(actor, event, attributes)
+}
+
+// ErrorSync records an error event in the actor's shard, and waits
+// for it to be recorded.
+func (s *ShardedLogger) ErrorSync(actor, event string, attributes []Attribute) {
+	s.shardFor(actor).ErrorSync(actor, event, attributes)
+}
+
+// CriticalSync records a critical event in the actor's shard, and
+// waits for it to be recorded.
+func (s *ShardedLogger) CriticalSync(actor, event string, attributes []Attribute) {
+	s.shardFor(actor).CriticalSync(actor, event, attributes)
+}
+
+// VerifyCrossCheckpoints checks the cross-chain checkpoints in the
+// chains of a sharded logger, given in shard order: every head a
+// checkpoint records must match the event with that serial number in
+// its shard's chain, wherever the chain holds it. The chains
+// themselves must be verified separately, such as by
+// VerifyCertification.
+func VerifyCrossCheckpoints(chains [][]*Event) bool {
+	bySerial := make([]map[uint64]*Event, len(chains))
+	for i, chain := range chains {
+		bySerial[i] = map[uint64]*Event{}
+		for _, ev := range chain {
+			bySerial[i][ev.Serial] = ev
+		}
+	}
+
+	for i, chain := range chains {
+		for _, ev := range chain {
+			if ev.Actor != internalActor || ev.Event != EventCrossCheckpoint {
+				continue
+			}
+
+			if shard, _ := ev.attr("shard"); shard != strconv.Itoa(i) {
+				return false
+			}
+
+			for j := range chains {
+				head, ok := ev.attr("head_" + strconv.Itoa(j))
+				if !ok {
+					return false
+				}
+
+				if !checkShardHead(head, bySerial[j], chains[j]) {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// checkShardHead checks a head recorded by a checkpoint against the
+// shard's chain.
+func checkShardHead(head string, events map[uint64]*Event, chain []*Event) bool {
+	if head == "" {
+		return true
+	}
+
+	fields := strings.SplitN(head, ":", 2)
+	serial, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil || len(fields) != 2 {
+		return false
+	}
+
+	ev, ok := events[serial]
+	if !ok {
+		// The head must lie outside the chain given, not in a gap
+		// within it, or past its end.
+		return len(chain) > 0 && serial < chain[0].Serial
+	}
+	return formatShardHead(serial, ev.Signature) == head
+}
@@ -0,0 +1,102 @@
+package auditlog
+
+import (
+	"crypto/rand"
+	"strconv"
+	"testing"
+)
+
+func TestShardedLogger(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	stores := []Store{NewMemoryStore(), NewMemoryStore(), NewMemoryStore()}
+	s, err := NewSharded(stores, signer, ShardRoundRobin, 0, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = s.Start(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for i := 0; i < 6; i++ {
+		s.InfoSync("shard_test", "event "+strconv.Itoa(i), nil)
+	}
+	s.CrossCheckpoint()
+	for i := 0; i < 3; i++ {
+		s.InfoSync("shard_test", "event", nil)
+	}
+	s.Stop()
+
+	chains := make([][]*Event, len(stores))
+	for i, store := range stores {
+		count, err := store.Count()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		// Round robin gives each shard three events and two
+		// checkpoints.
+		if count != 5 {
+			t.Fatalf("shard %d holds %d events, want 5", i, count)
+		}
+
+		chains[i], err = store.Events(0, count-1)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		var prev []byte
+		for _, ev := range chains[i] {
+			if !ev.Verify(&signer.PublicKey, prev) {
+				t.Fatalf("shard %d: event %d fails verification", i, ev.Serial)
+			}
+			prev = ev.Signature
+		}
+	}
+
+	if !VerifyCrossCheckpoints(chains) {
+		t.Fatal("cross-chain checkpoints should verify")
+	}
+
+	// Dropping the last event of a shard, along with the checkpoints
+	// recorded after it, is caught by the checkpoints in the others.
+	truncated := append([][]*Event{}, chains...)
+	truncated[1] = chains[1][:2]
+	if VerifyCrossCheckpoints(truncated) {
+		t.Fatal("a truncated shard should fail cross-chain verification")
+	}
+
+	// A shard replaced by a chain signed elsewhere is caught too.
+	other := testKey(t, "other")
+	replaced := append([][]*Event{}, chains...)
+	replaced[2] = append([]*Event{}, chains[2]...)
+	forged := *replaced[2][1]
+	if err = forged.Sign(other, replaced[2][0].Signature, rand.Reader); err != nil {
+		t.Fatalf("%v", err)
+	}
+	replaced[2][1] = &forged
+	if VerifyCrossCheckpoints(replaced) {
+		t.Fatal("a replaced shard should fail cross-chain verification")
+	}
+}
+
+func TestShardByActor(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	stores := []Store{NewMemoryStore(), NewMemoryStore()}
+	s, err := NewSharded(stores, signer, ShardByActor, 0, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	for _, actor := range []string{"alice", "bob", "carol"} {
+		if s.shardFor(actor) != s.shardFor(actor) {
+			t.Fatalf("events from %s should always go to the same shard", actor)
+		}
+	}
+
+	if _, err = NewSharded(nil, signer, ShardByActor, 0); err == nil {
+		t.Fatal("a sharded logger with no stores should fail")
+	}
+}
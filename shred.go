@@ -0,0 +1,293 @@
+package auditlog
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// A KeyStore holds the data keys used to encrypt personal data in
+// attribute values, with one 256-bit key per data subject. Keys are
+// identified by an opaque ID, which is recorded alongside the
+// encrypted values in place of the subject. Deployments will usually
+// implement KeyStore around a key management service.
+type KeyStore interface {
+	// SubjectKey returns the ID and key for a subject, creating
+	// a new key if the subject has none.
+	SubjectKey(subject string) (id string, key []byte, err error)
+
+	// Key returns the key with the given ID. If the key has been
+	// destroyed, ErrKeyDestroyed is returned.
+	Key(id string) ([]byte, error)
+
+	// Destroy destroys the subject's key and returns its ID.
+	Destroy(subject string) (id string, err error)
+}
+
+// ErrKeyDestroyed is returned by a KeyStore when a data key has been
+// destroyed.
+var ErrKeyDestroyed = errors.New("auditlog: data key destroyed")
+
+// A MemoryKeyStore keeps data keys in memory. It is intended for
+// tests; every key is lost when the process exits.
+type MemoryKeyStore struct {
+	lock     sync.Mutex
+	subjects map[string]string
+	keys     map[string][]byte
+}
+
+// NewMemoryKeyStore returns an empty in-memory key store.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{
+		subjects: map[string]string{},
+		keys:     map[string][]byte{},
+	}
+}
+
+// SubjectKey returns the ID and key for a subject, creating a new key
+// if the subject has none.
+func (ks *MemoryKeyStore) SubjectKey(subject string) (string, []byte, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	if id, ok := ks.subjects[subject]; ok {
+		return id, ks.keys[id], nil
+	}
+
+	var buf [48]byte
+	_, err := io.ReadFull(rand.Reader, buf[:])
+	if err != nil {
+		return "", nil, err
+	}
+
+	id := hex.EncodeToString(buf[32:])
+	ks.subjects[subject] = id
+	ks.keys[id] = buf[:32]
+	return id, ks.keys[id], nil
+}
+
+// Key returns the key with the given ID.
+func (ks *MemoryKeyStore) Key(id string) ([]byte, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	key, ok := ks.keys[id]
+	if !ok {
+		return nil, ErrKeyDestroyed
+	}
+	return key, nil
+}
+
+// Destroy discards the subject's key.
+func (ks *MemoryKeyStore) Destroy(subject string) (string, error) {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+
+	id, ok := ks.subjects[subject]
+	if !ok {
+		return "", errors.New("auditlog: no data key for subject")
+	}
+
+	delete(ks.subjects, subject)
+	delete(ks.keys, id)
+	return id, nil
+}
+
+// encryptedPrefix marks an attribute value encrypted with a data
+// key; it is followed by the key ID and the base64-encoded nonce and
+// ciphertext, separated by colons.
+const encryptedPrefix = "enc:v1:"
+
+// ErasedValue replaces attribute values whose data key has been
+// destroyed when events are revealed.
+const ErasedValue = "[erased]"
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptValue encrypts an attribute value, binding it to the
+// attribute's name so that encrypted values can't be moved between
+// attributes. The prefix identifies the kind of key used.
+func encryptValue(prefix, id string, key []byte, name, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	out := aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	return prefix + id + ":" + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// decryptValue decrypts an attribute value produced by encryptValue
+// with the same prefix. Other values are returned unchanged.
+func decryptValue(prefix string, keys KeyStore, name, value string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+
+	fields := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+	if len(fields) != 2 {
+		return "", errors.New("auditlog: malformed encrypted value")
+	}
+
+	key, err := keys.Key(fields[0])
+	if err == ErrKeyDestroyed {
+		return ErasedValue, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	in, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return "", err
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(in) < aead.NonceSize() {
+		return "", errors.New("auditlog: malformed encrypted value")
+	}
+
+	out, err := aead.Open(nil, in[:aead.NonceSize()], in[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// A ShreddingPolicy encrypts personal data in attribute values with a
+// per-subject data key, so that it can be erased by destroying the
+// key. Subject names the attribute identifying the data subject, and
+// Attributes names the attributes holding their personal data; the
+// subject attribute itself is always encrypted. Events without the
+// subject attribute are recorded unchanged.
+//
+// The encrypted values are signed, so the chain still verifies once
+// a key has been destroyed.
+type ShreddingPolicy struct {
+	Keys       KeyStore
+	Subject    string
+	Attributes []string
+}
+
+// WithShredding encrypts personal data in recorded events as
+// described by the policy.
+func WithShredding(policy ShreddingPolicy) Option {
+	return func(l *Logger) {
+		if policy.Keys == nil || policy.Subject == "" {
+			return
+		}
+
+		l.shredding = &policy
+	}
+}
+
+// shred encrypts the personal data in an event under the shredding
+// policy. If the data can't be encrypted, it is withheld from the
+// event and the error is noted in its place.
+func (l *Logger) shred(ev *Event) {
+	if l.shredding == nil {
+		return
+	}
+
+	subject, ok := ev.attr(l.shredding.Subject)
+	if !ok {
+		return
+	}
+
+	personal := map[string]bool{l.shredding.Subject: true}
+	for _, name := range l.shredding.Attributes {
+		personal[name] = true
+	}
+
+	// The attributes belong to the caller, so they're copied
+	// before being modified.
+	attrs := make([]Attribute, len(ev.Attributes))
+	copy(attrs, ev.Attributes)
+	ev.Attributes = attrs
+
+	id, key, err := l.shredding.Keys.SubjectKey(subject)
+	for i := range attrs {
+		if !personal[attrs[i].Name] {
+			continue
+		}
+
+		if err == nil {
+			attrs[i].Value, err = encryptValue(encryptedPrefix, id, key, attrs[i].Name, attrs[i].Value)
+		}
+
+		if err != nil {
+			attrs[i].Value = ErasedValue
+		}
+	}
+
+	if err != nil {
+		ev.Attributes = append(ev.Attributes, Attribute{"encryption_error", err.Error()})
+	}
+}
+
+// Reveal returns a copy of the event with its encrypted attribute
+// values decrypted using keys. Values whose data key has been
+// destroyed are replaced with ErasedValue. The copy's signature
+// won't verify; the original event should be verified instead.
+func Reveal(ev *Event, keys KeyStore) (*Event, error) {
+	revealed := copyEvent(ev)
+	for i := range revealed.Attributes {
+		value, err := decryptValue(encryptedPrefix, keys, revealed.Attributes[i].Name, revealed.Attributes[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		revealed.Attributes[i].Value = value
+	}
+	return revealed, nil
+}
+
+// Erase destroys the data key of a subject under the shredding
+// policy, rendering their personal data in the chain unreadable, and
+// records a signed "subject erased" event carrying the key's ID. The
+// logger must be running.
+func (l *Logger) Erase(subject string) error {
+	if l.shredding == nil {
+		return errors.New("auditlog: no shredding policy")
+	}
+
+	if !l.accept(levelInternal) {
+		return errors.New("auditlog: logger is not running")
+	}
+
+	wait := make(chan struct{}, 0)
+	id, err := l.shredding.Keys.Destroy(subject)
+	if err != nil {
+		l.logInternalEvent(levelError, "erasure failure", []Attribute{
+			{"error", err.Error()},
+		}, wait, nil)
+		<-wait
+		return err
+	}
+
+	l.logInternalEvent(levelInfo, "subject erased", []Attribute{
+		{"key_id", id},
+	}, wait, nil)
+	<-wait
+	return nil
+}
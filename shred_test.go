@@ -0,0 +1,95 @@
+package auditlog
+
+import "testing"
+
+func TestShredding(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	keys := NewMemoryKeyStore()
+	store := NewMemoryStore()
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithShredding(ShreddingPolicy{
+		Keys:       keys,
+		Subject:    "user",
+		Attributes: []string{"email"},
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	attrs := []Attribute{
+		{"user", "jqp"},
+		{"email", "jqp@example.net"},
+		{"method", "password"},
+	}
+	l.InfoSync("shred_test", "login", attrs)
+	l.InfoSync("shred_test", "login", []Attribute{{"user", "alice"}})
+
+	if attrs[0].Value != "jqp" {
+		t.Fatal("caller's attributes were modified")
+	}
+
+	ev, err := store.Event(0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if value, _ := ev.attr("email"); value == "jqp@example.net" {
+		t.Fatal("personal data was recorded in the clear")
+	}
+
+	if value, _ := ev.attr("method"); value != "password" {
+		t.Fatalf("expected method=password, have %q", value)
+	}
+
+	revealed, err := Reveal(ev, keys)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if value, _ := revealed.attr("email"); value != "jqp@example.net" {
+		t.Fatalf("expected the email to be revealed, have %q", value)
+	}
+
+	err = l.Erase("jqp")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	revealed, err = Reveal(ev, keys)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if value, _ := revealed.attr("user"); value != ErasedValue {
+		t.Fatalf("expected the user to be erased, have %q", value)
+	}
+
+	other, err := store.Event(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	revealed, err = Reveal(other, keys)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if value, _ := revealed.attr("user"); value != "alice" {
+		t.Fatalf("expected user=alice, have %q", value)
+	}
+
+	marker, err := store.Event(2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if marker.Event != "subject erased" {
+		t.Fatalf("expected an erasure event, have %q", marker.Event)
+	}
+
+	if err = l.verifyAuditChain(); err != nil {
+		t.Fatalf("chain failed to verify after erasure: %v", err)
+	}
+}
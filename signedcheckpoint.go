@@ -0,0 +1,156 @@
+package auditlog
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"log"
+	"strconv"
+	"time"
+)
+
+// A SignedCheckpoint is a checkpoint signed with the logger's key, as
+// recorded in the store by WithSignedCheckpoints. The signature is over
+// the SHA-256 digest of the checkpoint's text form.
+type SignedCheckpoint struct {
+	Checkpoint
+	Signature []byte
+}
+
+// digest returns the digest of the checkpoint that is signed.
+func (cp Checkpoint) digest() []byte {
+	digest := sha256.Sum256([]byte(cp.String()))
+	return digest[:]
+}
+
+// Verify reports whether the checkpoint was signed with pub.
+func (sc *SignedCheckpoint) Verify(pub *ecdsa.PublicKey) bool {
+	return ecdsa.VerifyASN1(pub, sc.digest(), sc.Signature)
+}
+
+// verifyCheckpoint reports whether the checkpoint was signed with the
+// key that signed its event, or, if that event rotated the key, with
+// the key it announced, which was signing by the time the checkpoint
+// was taken.
+func (m KeyManifest) verifyCheckpoint(sc *SignedCheckpoint) bool {
+	for _, pub := range []*ecdsa.PublicKey{m.Key(sc.Serial), m.startingAt(sc.Serial + 1)} {
+		if pub != nil && sc.Verify(pub) {
+			return true
+		}
+	}
+	return false
+}
+
+// A CheckpointRecorder is a Store that keeps signed checkpoints of its
+// chain, so that a logger can verify the chain from the latest one
+// rather than from the beginning.
+type CheckpointRecorder interface {
+	// StoreCheckpoint records a signed checkpoint. Recording a
+	// checkpoint of an event that has already been checkpointed has
+	// no effect.
+	StoreCheckpoint(sc SignedCheckpoint) error
+
+	// LatestCheckpoint returns the checkpoint of the latest event,
+	// or nil if none has been recorded.
+	LatestCheckpoint() (*SignedCheckpoint, error)
+}
+
+// WithSignedCheckpoints records a signed checkpoint of the head of the
+// chain in the store every interval, if events have been recorded
+// since the last one, and once more when the logger stops. When the
+// logger is created, the chain is only verified from the latest
+// checkpoint on: its signature is checked, and the checkpointed event
+// must still be in the chain unchanged, but the events before it are
+// trusted. Startup of a long chain then takes time in proportion to
+// the events recorded since the last checkpoint; VerifyChain and the
+// auditlog verify command still verify the whole chain.
+//
+// The store must be a CheckpointRecorder. A checkpoint that can't be
+// recorded is reported in an ERROR "checkpoint failure" event.
+func WithSignedCheckpoints(interval time.Duration) Option {
+	return func(l *Logger) {
+		if interval <= 0 {
+			return
+		}
+		l.fromCheckpoint = true
+
+		var last Checkpoint
+		l.addTask(every(interval, true, func(l *Logger) {
+			sc, err := l.signCheckpoint(last)
+			if err != nil {
+				l.logInternal(levelError, EventCheckpointFailure, []Attribute{
+					{"serial", strconv.FormatUint(sc.Serial, 10)},
+					{"error", err.Error()},
+				})
+				return
+			}
+
+			if sc.Serial == last.Serial && sc.Head == last.Head {
+				return
+			}
+			last = sc.Checkpoint
+			l.witnessCheckpoint(sc)
+		}))
+	}
+}
+
+// signCheckpoint signs a checkpoint of the head of the chain and
+// records it in the store, unless the head is still that of last.
+func (l *Logger) signCheckpoint(last Checkpoint) (*SignedCheckpoint, error) {
+	// The checkpoint is signed with the key that was signing when it
+	// was taken, and recorded in the store holding its chain, as
+	// events are.
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	cp, ok := l.checkpoint()
+	if !ok || l.closed || cp.Serial == last.Serial && cp.Head == last.Head {
+		return &SignedCheckpoint{Checkpoint: last}, nil
+	}
+
+	sc := &SignedCheckpoint{Checkpoint: cp}
+	sig, err := l.signer.Sign(prng, cp.digest(), crypto.SHA256)
+	if err != nil {
+		return sc, err
+	}
+	sc.Signature = sig
+
+	return sc, l.store.(CheckpointRecorder).StoreCheckpoint(*sc)
+}
+
+// resumeFromCheckpoint returns where verification of the chain
+// begins, and the signature of the event preceding it: just after the
+// latest signed checkpoint, once its signature and event have been
+// checked, or else start and prev, if there is no checkpoint or its
+// event has been pruned.
+func (l *Logger) resumeFromCheckpoint(start uint64, prev []byte) (uint64, []byte, error) {
+	sc, err := l.store.(CheckpointRecorder).LatestCheckpoint()
+	if err != nil || sc == nil {
+		return start, prev, err
+	}
+
+	if !l.keys.verifyCheckpoint(sc) {
+		log.Println("Signature failure on checkpoint of event", sc.Serial)
+		return 0, nil, errAuditFailure
+	}
+
+	if sc.Serial >= l.counter {
+		log.Printf("audit chain has shrunk to %d events, below the checkpoint of event %d", l.counter, sc.Serial)
+		return 0, nil, errAuditFailure
+	}
+
+	if sc.Serial < start {
+		return start, prev, nil
+	}
+
+	ev, err := l.store.Event(sc.Serial)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if chainLink(ev) != sc.Head {
+		log.Println("Checkpoint mismatch on event", sc.Serial)
+		return 0, nil, errAuditFailure
+	}
+	return sc.Serial + 1, ev.Signature, nil
+}
@@ -0,0 +1,127 @@
+package auditlog
+
+import (
+	"crypto"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignedCheckpoints(t *testing.T) {
+	signer := testKey(t, "signer")
+	other := testKey(t, "other")
+
+	stores := map[string]func() Store{
+		"memory": func() Store { return NewMemoryStore() },
+		"file": func() Store {
+			s, err := NewFileStore(filepath.Join(t.TempDir(), "audit.log"))
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			return s
+		},
+		"sqlite": func() Store {
+			s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "audit.db"))
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		store := newStore()
+		reopen := func() {
+			if ro, ok := store.(Reopener); ok {
+				ro.Reopen()
+			}
+		}
+
+		l, err := NewWithStore(store, signer, WithoutEcho(), WithSignedCheckpoints(time.Hour))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		l.Start()
+		for i := 0; i < 10; i++ {
+			l.InfoSync("signedcheckpoint_test", "event", nil)
+		}
+		l.Stop()
+
+		// A checkpoint of the head is recorded as the logger stops.
+		reopen()
+		cr := store.(CheckpointRecorder)
+		sc, err := cr.LatestCheckpoint()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if sc == nil || sc.Serial != 9 || !sc.Verify(&signer.PublicKey) {
+			t.Fatalf("%s: unexpected checkpoint %+v", name, sc)
+		}
+
+		// Events recorded without checkpoints are the only ones
+		// verified when the logger next starts.
+		l, err = NewWithStore(store, signer, WithoutEcho())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		l.Start()
+		for i := 0; i < 5; i++ {
+			l.InfoSync("signedcheckpoint_test", "event", nil)
+		}
+		l.Stop()
+
+		reopen()
+		var total uint64
+		progress := func(p VerifyProgress) { total = p.Total }
+		l, err = NewWithStore(store, signer, WithoutEcho(), WithSignedCheckpoints(time.Hour),
+			WithVerifyProgress(progress))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		l.Stop()
+
+		if total != 5 {
+			t.Fatalf("%s: expected 5 events to be verified, have %d", name, total)
+		}
+
+		// A checkpoint that isn't signed with the logger's key, or
+		// that lies beyond the end of the chain, is refused.
+		reopen()
+		bad := SignedCheckpoint{Checkpoint: Checkpoint{Serial: 20, When: sc.When, Head: sc.Head}}
+		bad.Signature, err = other.Sign(rand.Reader, bad.digest(), crypto.SHA256)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if err = cr.StoreCheckpoint(bad); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if _, err = NewWithStore(store, signer, WithoutEcho(), WithSignedCheckpoints(time.Hour)); err == nil {
+			t.Fatalf("%s: logger started from a forged checkpoint", name)
+		}
+
+		reopen()
+		bad.Serial = 21
+		bad.Signature, err = signer.Sign(rand.Reader, bad.digest(), crypto.SHA256)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if err = cr.StoreCheckpoint(bad); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if _, err = NewWithStore(store, signer, WithoutEcho(), WithSignedCheckpoints(time.Hour)); err == nil {
+			t.Fatalf("%s: logger started on a chain shorter than its checkpoint", name)
+		}
+		store.Close()
+	}
+
+	// The store must be able to record checkpoints.
+	if _, err := NewWithStore(struct{ Store }{NewMemoryStore()}, signer, WithSignedCheckpoints(time.Hour)); err == nil {
+		t.Fatal("logger started with checkpoints on a store that can't record them")
+	}
+}
@@ -0,0 +1,127 @@
+package auditlog
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// AttrClockSkew is added to events whose timestamp differs from the
+// time they were received by more than the skew limit; its value is
+// the difference, received minus logged, as a duration.
+const AttrClockSkew = "clock_skew"
+
+// EventClockSkew is the WARNING event recorded after an event whose
+// clock skew exceeded the limit, when companion events are enabled.
+const EventClockSkew = "clock skew"
+
+// WithSkewLimit flags events whose timestamp (When) differs from the
+// time the logger received them (Received) by more than limit, in
+// either direction: an AttrClockSkew attribute is added to the event,
+// and if companion is true, a WARNING "clock skew" event naming the
+// flagged event's serial number is recorded after it. Backdated
+// events are a common way of tampering with an audit trail.
+func WithSkewLimit(limit time.Duration, companion bool) Option {
+	return func(l *Logger) {
+		if limit <= 0 {
+			return
+		}
+
+		l.skewLimit = limit
+		l.skewCompanion = companion
+	}
+}
+
+// SkewStats summarises the clock skew of the events received by a
+// logger. Skew is measured as Received minus When, so a positive
+// skew is an event logged in the past and a negative skew one logged
+// in the future.
+type SkewStats struct {
+	Events  uint64
+	Flagged uint64
+	Min     time.Duration
+	Max     time.Duration
+	Mean    time.Duration
+}
+
+// SkewStats returns the clock skew statistics for the events
+// received since the logger was created.
+func (l *Logger) SkewStats() SkewStats {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	stats := l.skew
+	if stats.Events > 0 {
+		stats.Mean = time.Duration(l.skewTotal / int64(stats.Events))
+	}
+	return stats
+}
+
+// checkSkew updates the skew statistics for a received event, and
+// flags it if its skew exceeds the limit; the caller must hold the
+// logger's lock. It reports whether the event was flagged.
+func (l *Logger) checkSkew(ev *Event) bool {
+	skew := time.Duration(ev.Received - ev.When)
+	if l.skew.Events == 0 || skew < l.skew.Min {
+		l.skew.Min = skew
+	}
+	if l.skew.Events == 0 || skew > l.skew.Max {
+		l.skew.Max = skew
+	}
+	l.skew.Events++
+	l.skewTotal += int64(skew)
+
+	if l.skewLimit == 0 || (skew <= l.skewLimit && skew >= -l.skewLimit) {
+		return false
+	}
+	l.skew.Flagged++
+
+	// The attributes belong to the caller, so they're copied
+	// before being extended.
+	attrs := make([]Attribute, len(ev.Attributes), len(ev.Attributes)+1)
+	copy(attrs, ev.Attributes)
+	ev.Attributes = append(attrs, Attribute{AttrClockSkew, skew.String()})
+	return true
+}
+
+// recordSkew records the companion event for a flagged event if
+// companion events are enabled; the caller must hold the logger's
+// lock.
+func (l *Logger) recordSkew(ev *Event) {
+	if !l.skewCompanion {
+		return
+	}
+
+	skew, _ := ev.attr(AttrClockSkew)
+	l.record(&Event{
+		When:  l.now(),
+		Level: levelStrings[levelWarning],
+		Actor: internalActor,
+		Event: EventClockSkew,
+		Attributes: []Attribute{
+			{"serial", strconv.FormatUint(ev.Serial, 10)},
+			{"actor", ev.Actor},
+			{AttrClockSkew, skew},
+		},
+	})
+}
+
+// LogAt records an event timestamped by the caller's clock rather
+// than the logger's, such as an event forwarded from another host,
+// and waits for it to be recorded. The level is one of "DEBUG",
+// "INFO", "WARNING", "ERROR", or "CRITICAL".
+func (l *Logger) LogAt(when time.Time, level, actor, event string, attributes []Attribute) error {
+	lvl := levelFromString(level)
+	if lvl == levelUnknown {
+		return errors.New("auditlog: unknown level " + level)
+	}
+
+	if !l.accept(lvl) {
+		return nil
+	}
+
+	wait := make(chan struct{}, 0)
+	l.logEvent(when.UnixNano(), lvl, actor, event, attributes, wait)
+	<-wait
+	return nil
+}
@@ -0,0 +1,54 @@
+package auditlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSkewLimit(t *testing.T) {
+	start := time.Date(2014, time.October, 6, 0, 0, 0, 0, time.UTC)
+	l, store := newTestLogger(t,
+		WithClock(NewFixedClock(start, time.Second)),
+		WithSkewLimit(time.Minute, true))
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("skew_test", "tick", nil)
+
+	attrs := []Attribute{{"user", "jqp"}}
+	err := l.LogAt(start.Add(-time.Hour), "INFO", "skew_test", "backdated", attrs)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(attrs) != 1 {
+		t.Fatal("caller's attributes were modified")
+	}
+
+	ev, err := store.Event(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, ok := ev.attr(AttrClockSkew); !ok {
+		t.Fatal("backdated event was not flagged")
+	}
+
+	companion, err := store.Event(2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if companion.Event != EventClockSkew || companion.Level != "WARNING" {
+		t.Fatalf("expected a clock skew event, have %s", companion)
+	}
+
+	stats := l.SkewStats()
+	if stats.Events != 2 || stats.Flagged != 1 || stats.Max < time.Hour {
+		t.Fatalf("wrong skew statistics: %+v", stats)
+	}
+
+	if err = l.LogAt(start, "LOUD", "skew_test", "tick", nil); err == nil {
+		t.Fatal("logged an event with an unknown level")
+	}
+}
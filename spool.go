@@ -0,0 +1,297 @@
+package auditlog
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// AttrSpooled is added to events replayed from the spool; its value
+// is the time the event was replayed into the chain. The event keeps
+// its original When and Received timestamps.
+const AttrSpooled = "spooled"
+
+// ErrSpooled is returned when an event couldn't be stored and has
+// been written to the spool instead, to be recorded later.
+var ErrSpooled = errors.New("auditlog: event spooled")
+
+// A SpoolPolicy keeps events that can't be stored in an encrypted
+// local file at Path, rather than stopping the logger. Key is a
+// 256-bit AES key used to encrypt the spool. Every Interval, the
+// spooled events are replayed into the chain; until the spool has
+// been emptied, new events are spooled behind them so that the order
+// of the chain is preserved.
+type SpoolPolicy struct {
+	Path     string
+	Key      []byte
+	Interval time.Duration
+}
+
+// WithSpool spools events that can't be stored, as described by the
+// policy. If the spool can't be opened, creating the logger fails.
+func WithSpool(policy SpoolPolicy) Option {
+	return func(l *Logger) {
+		if policy.Path == "" || policy.Interval <= 0 {
+			return
+		}
+
+		aead, err := newAEAD(policy.Key)
+		if err != nil {
+			l.setOptErr(err)
+			return
+		}
+
+		s := &spool{path: policy.Path, aead: aead}
+		events, err := s.load()
+		if err != nil {
+			l.setOptErr(err)
+			return
+		}
+		s.pending = len(events)
+		l.spool = s
+
+		l.addTask(every(policy.Interval, false, func(l *Logger) {
+			l.lock.Lock()
+			defer l.lock.Unlock()
+
+			if !l.closed {
+				l.replaySpool()
+			}
+		}))
+	}
+}
+
+// A spool is an append-only file of encrypted events; each line holds
+// the base64-encoded nonce and sealed JSON encoding of one event.
+type spool struct {
+	path    string
+	aead    cipher.AEAD
+	pending int
+
+	// replayed is the number of events at the start of the spool
+	// file that have been recorded, but were left there because the
+	// file couldn't be rewritten without them.
+	replayed int
+}
+
+// encode seals events as the lines of a spool file.
+func (s *spool) encode(events []*Event) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, ev := range events {
+		in, err := json.Marshal(ev)
+		if err != nil {
+			return nil, err
+		}
+
+		nonce := make([]byte, s.aead.NonceSize())
+		_, err = io.ReadFull(rand.Reader, nonce)
+		if err != nil {
+			return nil, err
+		}
+
+		out := s.aead.Seal(nonce, nonce, in, []byte(s.path))
+		buf.WriteString(base64.StdEncoding.EncodeToString(out))
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// write appends events to the spool file.
+func (s *spool) write(events []*Event) error {
+	out, err := s.encode(events)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(out)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		s.pending += len(events)
+	}
+	return err
+}
+
+// load reads the events in the spool file.
+func (s *spool) load() ([]*Event, error) {
+	in, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var events []*Event
+	scanner := bufio.NewScanner(bytes.NewReader(in))
+	scanner.Buffer(nil, len(in)+1)
+	for scanner.Scan() {
+		sealed, err := base64.StdEncoding.DecodeString(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+
+		if len(sealed) < s.aead.NonceSize() {
+			return nil, errors.New("auditlog: corrupt spool")
+		}
+
+		n := s.aead.NonceSize()
+		out, err := s.aead.Open(nil, sealed[:n], sealed[n:], []byte(s.path))
+		if err != nil {
+			return nil, err
+		}
+
+		var ev Event
+		err = json.Unmarshal(out, &ev)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &ev)
+	}
+	return events, scanner.Err()
+}
+
+// reset replaces the contents of the spool file with events. The new
+// contents are written to a temporary file that is renamed over the
+// spool, so that if reset fails the spool is left as it was.
+func (s *spool) reset(events []*Event) error {
+	if len(events) == 0 {
+		err := os.Remove(s.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.pending, s.replayed = 0, 0
+		return nil
+	}
+
+	out, err := s.encode(events)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(out)
+	if err == nil {
+		err = f.Sync()
+	}
+
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	s.pending, s.replayed = len(events), 0
+	return nil
+}
+
+// spoolEvent writes an event that hasn't been stored to the spool;
+// the caller must hold the logger's lock, and must have released the
+// event's serial number. If the event can't be spooled, the store is
+// closed and the logger panics, as it would without a spool.
+func (l *Logger) spoolEvent(ev *Event, cause error) error {
+	ev.Serial = 0
+	ev.Signature = nil
+
+	if err := l.spool.write([]*Event{ev}); err != nil {
+		err = l.fail([]*Event{ev}, cause, func() error { return l.spool.write([]*Event{ev}) })
+		if err != nil {
+			return err
+		}
+	}
+
+	if l.stderr != nil {
+		l.stderr.Write([]byte("logger failure: event spooled: " + cause.Error() + "\n"))
+	}
+	ev.err = ErrSpooled
+	return ErrSpooled
+}
+
+// replaySpool records the spooled events in the chain, stopping at the
+// first that can't be stored; the caller must hold the logger's lock.
+func (l *Logger) replaySpool() {
+	if l.spool == nil || l.spool.pending == 0 {
+		return
+	}
+
+	events, err := l.spool.load()
+	if err != nil {
+		l.spoolFailed(err)
+		return
+	}
+	events = events[l.spool.replayed:]
+
+	if reopener, ok := l.store.(Reopener); ok {
+		if _, err = l.store.Count(); err != nil {
+			reopener.Reopen()
+		}
+	}
+
+	l.replaying = true
+	defer func() { l.replaying = false }()
+
+	replayed := time.Unix(0, l.now()).UTC().Format(time.RFC3339Nano)
+	for i, ev := range events {
+		ev.Attributes = append(ev.Attributes, Attribute{AttrSpooled, replayed})
+		err = l.record(ev)
+		if err != nil {
+			ev.Attributes = ev.Attributes[:len(ev.Attributes)-1]
+			l.resetSpool(events[i:], i)
+			return
+		}
+	}
+	l.resetSpool(nil, len(events))
+}
+
+// resetSpool leaves the events not yet recorded in the spool, once
+// replayed have been. If the spool can't be rewritten, the recorded
+// events are skipped when it is next replayed, so that they aren't
+// recorded twice. The caller must hold the logger's lock.
+func (l *Logger) resetSpool(events []*Event, replayed int) {
+	err := l.spool.reset(events)
+	if err != nil {
+		l.spool.replayed += replayed
+		l.spool.pending -= replayed
+		l.spoolFailed(err)
+	}
+}
+
+// spoolFailed reports an error reading or rewriting the spool; the
+// caller must hold the logger's lock.
+func (l *Logger) spoolFailed(err error) {
+	l.setFailure(err)
+	if l.stderr != nil {
+		l.stderr.Write([]byte("logger failure: spool: " + err.Error() + "\n"))
+	}
+}
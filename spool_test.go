@@ -0,0 +1,154 @@
+package auditlog
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingStore is a memory store whose writes fail while fail is set.
+type failingStore struct {
+	*MemoryStore
+	fail bool
+}
+
+func (fs *failingStore) StoreEvent(ev *Event) error {
+	if fs.fail {
+		return errors.New("database unavailable")
+	}
+	return fs.MemoryStore.StoreEvent(ev)
+}
+
+func TestSpool(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	path := filepath.Join(t.TempDir(), "auditlog.spool")
+	store := &failingStore{MemoryStore: NewMemoryStore()}
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithSpool(SpoolPolicy{
+		Path:     path,
+		Key:      make([]byte, 32),
+		Interval: time.Hour,
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	l.InfoSync("spool_test", "stored", nil)
+
+	store.fail = true
+	l.InfoSync("spool_test", "spooled", []Attribute{{"user", "jqp"}})
+	store.fail = false
+	l.InfoSync("spool_test", "queued", nil)
+
+	if l.Count() != 1 {
+		t.Fatalf("expected 1 stored event, have %d", l.Count())
+	}
+
+	spooled, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if strings.Contains(string(spooled), "jqp") {
+		t.Fatal("spool is not encrypted")
+	}
+
+	l.lock.Lock()
+	l.replaySpool()
+	l.lock.Unlock()
+
+	if l.Count() != 3 {
+		t.Fatalf("expected 3 stored events, have %d", l.Count())
+	}
+
+	ev, err := store.Event(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, ok := ev.attr(AttrSpooled); !ok || ev.Event != "spooled" {
+		t.Fatalf("expected the spooled event to be replayed, have %s", ev)
+	}
+
+	if err = l.verifyAuditChain(); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
+
+// limitedStore is a memory store that fails writes once limit more
+// events have been stored, while limit isn't negative.
+type limitedStore struct {
+	*MemoryStore
+	limit int
+}
+
+func (ls *limitedStore) StoreEvent(ev *Event) error {
+	if ls.limit == 0 {
+		return errors.New("database unavailable")
+	}
+	if ls.limit > 0 {
+		ls.limit--
+	}
+	return ls.MemoryStore.StoreEvent(ev)
+}
+
+func TestSpoolResetFailure(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	path := filepath.Join(t.TempDir(), "auditlog.spool")
+	store := &limitedStore{MemoryStore: NewMemoryStore(), limit: -1}
+	l, err := NewWithStore(store, signer, WithoutEcho(), WithSpool(SpoolPolicy{
+		Path:     path,
+		Key:      make([]byte, 32),
+		Interval: time.Hour,
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	defer l.Stop()
+
+	store.limit = 0
+	l.InfoSync("spool_test", "first", nil)
+	l.InfoSync("spool_test", "second", nil)
+
+	// Only the first spooled event can be stored, and the spool
+	// can't be rewritten without it.
+	if err = os.MkdirAll(filepath.Join(path+".tmp", "blocked"), 0700); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	store.limit = 1
+	l.lock.Lock()
+	l.replaySpool()
+	l.lock.Unlock()
+
+	if l.Count() != 1 || l.Err() == nil {
+		t.Fatalf("expected 1 stored event and a spool failure, have %d events and %v", l.Count(), l.Err())
+	}
+
+	// The first event isn't recorded again.
+	store.limit = -1
+	l.lock.Lock()
+	l.replaySpool()
+	l.lock.Unlock()
+
+	if l.Count() != 2 {
+		t.Fatalf("expected 2 stored events, have %d", l.Count())
+	}
+
+	ev, err := store.Event(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if ev.Event != "second" {
+		t.Fatalf("expected the second spooled event to be replayed, have %s", ev)
+	}
+}
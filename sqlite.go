@@ -0,0 +1,288 @@
+package auditlog
+
+import (
+	"database/sql"
+	_ "embed"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema is the SQLite schema for the audit chain; it matches
+// auditlog.sql, with SQLite's types.
+//
+//go:embed auditlog_sqlite.sql
+var sqliteSchema string
+
+// A sqliteStore keeps the audit chain in a SQLite database, for
+// embedded and single-binary deployments. It uses the same tables as
+// the Postgres store, and the same queries where SQLite accepts them.
+//
+// SQLite only allows one writer at a time, so the store holds a single
+// connection. Pruning, compression, leases, and write-once roles are
+// only supported by Postgres.
+type sqliteStore struct {
+	db    *sql.DB
+	path  string
+	stmts *stmtCache
+}
+
+// NewSQLiteStore opens the SQLite database at path, creating it and
+// the audit tables if they aren't present. A path of ":memory:" keeps
+// the chain in memory until the store is closed.
+func NewSQLiteStore(path string) (Store, error) {
+	s := &sqliteStore{path: path}
+	err := s.Reopen()
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := s.createSchema()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	// The statements couldn't be prepared before their tables
+	// existed.
+	if created {
+		s.stmts.close()
+		s.stmts = newStmtCache(s.db, nil)
+	}
+	return s, nil
+}
+
+// Reopen opens the database.
+func (s *sqliteStore) Reopen() error {
+	dsn := s.path + "?_busy_timeout=5000"
+	if s.path != ":memory:" {
+		dsn += "&_journal_mode=WAL&_synchronous=FULL"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+
+	// An in-memory database only lives as long as its connection,
+	// and with a single connection, writers never contend.
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
+	err = db.Ping()
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	s.db = db
+	s.stmts = newStmtCache(db, nil)
+	return nil
+}
+
+// sqliteAddedTables creates the tables and indexes added to the schema
+// since it was first published, in databases created before them.
+var sqliteAddedTables = []string{
+	`CREATE TABLE IF NOT EXISTS signing_keys (
+    first_serial INTEGER PRIMARY KEY,
+    public_key   BLOB NOT NULL
+)`,
+	`CREATE TABLE IF NOT EXISTS checkpoints (
+    serial      INTEGER PRIMARY KEY,
+    taken       INTEGER NOT NULL,
+    head        TEXT NOT NULL,
+    signature   BLOB NOT NULL
+)`,
+	`CREATE TABLE IF NOT EXISTS cosignatures (
+    serial      INTEGER NOT NULL,
+    witness     TEXT NOT NULL,
+    signature   BLOB NOT NULL,
+    PRIMARY KEY (serial, witness)
+)`,
+	`CREATE INDEX IF NOT EXISTS events_actor ON events (actor, id)`,
+	`CREATE INDEX IF NOT EXISTS events_level ON events (level, id)`,
+	`CREATE INDEX IF NOT EXISTS attributes_name_value ON attributes (name, substr(value, 1, 200))`,
+}
+
+// createSchema creates the audit tables if they aren't present.
+func (s *sqliteStore) createSchema() (bool, error) {
+	var present bool
+	err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM sqlite_master
+		WHERE type = 'table' AND name = 'events')`).Scan(&present)
+	if err != nil {
+		return false, err
+	} else if present {
+		for _, stmt := range sqliteAddedTables {
+			if _, err = s.db.Exec(stmt); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	err = s.withTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(sqliteSchema)
+		return err
+	})
+	return err == nil, err
+}
+
+// RecordsDigests reports that SQLite databases record digest versions.
+func (s *sqliteStore) RecordsDigests() bool {
+	return true
+}
+
+// withTx runs f in a transaction, committing if f succeeds and
+// rolling back otherwise.
+func (s *sqliteStore) withTx(f func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = f(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) StoreEvent(ev *Event) error {
+	return sqliteDuplicateSerial(s.withTx(func(tx *sql.Tx) error {
+		return storeEvent(s.stmts.bind(tx), true, ev)
+	}))
+}
+
+// StoreEvents records a run of signed events in one transaction.
+func (s *sqliteStore) StoreEvents(events []*Event) error {
+	return sqliteDuplicateSerial(s.withTx(func(tx *sql.Tx) error {
+		for _, ev := range events {
+			if err := storeEvent(s.stmts.bind(tx), true, ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func (s *sqliteStore) StoreError(ev *ErrorEvent) error {
+	return s.withTx(func(tx *sql.Tx) error {
+		return storeError(tx, ev)
+	})
+}
+
+// StoreKey records a key in the signing_keys table, unless a key has
+// already been recorded for its first serial number.
+func (s *sqliteStore) StoreKey(rec KeyRecord) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO signing_keys (first_serial, public_key) VALUES ($1, $2)`,
+		rec.First, rec.PublicKey)
+	return err
+}
+
+func (s *sqliteStore) Keys() ([]KeyRecord, error) {
+	return loadKeyRecords(s.db)
+}
+
+// StoreCheckpoint records a signed checkpoint in the checkpoints table,
+// unless its event has already been checkpointed.
+func (s *sqliteStore) StoreCheckpoint(sc SignedCheckpoint) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO checkpoints (serial, taken, head, signature) VALUES ($1, $2, $3, $4)`,
+		sc.Serial, sc.When, sc.Head, sc.Signature)
+	return err
+}
+
+func (s *sqliteStore) LatestCheckpoint() (*SignedCheckpoint, error) {
+	return loadLatestCheckpoint(s.db)
+}
+
+// StoreCosignature records a witness's cosignature of a checkpoint in
+// the cosignatures table, unless the witness has already cosigned it.
+func (s *sqliteStore) StoreCosignature(cs Cosignature) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO cosignatures (serial, witness, signature) VALUES ($1, $2, $3)`,
+		cs.Serial, cs.Witness, cs.Signature)
+	return err
+}
+
+func (s *sqliteStore) Cosignatures(serial uint64) ([]Cosignature, error) {
+	return loadCosignatures(s.db, serial)
+}
+
+func (s *sqliteStore) Count() (uint64, error) {
+	var count uint64
+	err := s.db.QueryRow(`SELECT COALESCE(MAX(id) + 1, 0) FROM events`).Scan(&count)
+	return count, err
+}
+
+func (s *sqliteStore) Event(serial uint64) (ev *Event, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		ev, err = loadEvent(s.stmts.bind(tx), true, serial)
+		if err == sql.ErrNoRows {
+			err = ErrNoEvent
+		}
+		return err
+	})
+	return
+}
+
+func (s *sqliteStore) Events(start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		events, err = loadEvents(s.stmts.bind(tx), true, start, end)
+		return err
+	})
+	return
+}
+
+// EventsByActor loads the events recorded by actor with serial numbers
+// in the range [start, end].
+func (s *sqliteStore) EventsByActor(actor string, start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		events, err = loadActorEvents(s.stmts.bind(tx), true, actor, start, end)
+		return err
+	})
+	return
+}
+
+// EventsByLevel loads the events at any of levels with serial numbers
+// in the range [start, end].
+func (s *sqliteStore) EventsByLevel(levels []string, start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		events, err = loadLevelEvents(s.stmts.bind(tx), true, levels, start, end)
+		return err
+	})
+	return
+}
+
+// EventsByAttribute loads the events with serial numbers in the range
+// [start, end] that carry attr, along with any compressed events.
+func (s *sqliteStore) EventsByAttribute(attr Attribute, start, end uint64) (events []*Event, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		events, err = loadAttributeEvents(s.stmts.bind(tx), true, attr, start, end)
+		return err
+	})
+	return
+}
+
+func (s *sqliteStore) Errors(start, end uint64) (events []*ErrorEvent, err error) {
+	err = s.withTx(func(tx *sql.Tx) error {
+		events, err = loadErrors(tx, start, end)
+		return err
+	})
+	return
+}
+
+func (s *sqliteStore) Close() error {
+	s.stmts.close()
+	return s.db.Close()
+}
+
+// sqliteDuplicateSerial maps the primary key violation raised when an
+// event's serial number is already taken to ErrDuplicateSerial.
+func sqliteDuplicateSerial(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+		return ErrDuplicateSerial
+	}
+	return err
+}
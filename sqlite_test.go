@@ -0,0 +1,172 @@
+package auditlog
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	cd := &DBConnDetails{
+		Backend: "sqlite",
+		Name:    filepath.Join(t.TempDir(), "audit.db"),
+	}
+
+	l, err := New(cd, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// The statements for each event are prepared once the schema
+	// has been created.
+	if stmts := l.store.(*sqliteStore).stmts.stmts; len(stmts) != len(preparedQueries) {
+		t.Fatalf("expected %d prepared statements, have %d", len(preparedQueries), len(stmts))
+	}
+
+	l.Start()
+	for i := 0; i < 10; i++ {
+		l.Info("sqlite_test", "event", []Attribute{{"user", "root"}, {"host", "db1"}})
+	}
+	l.InfoSync("sqlite_test", "event", nil)
+	l.Stop()
+
+	// A logger reopening the database finds the chain, and the
+	// schema isn't created again.
+	l, err = New(cd, signer, WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	l.InfoSync("sqlite_test", "reopened", nil)
+
+	// An event's attributes are stored in statements of up to
+	// maxAttributeRows, and restored in order.
+	many := make([]Attribute, 2*maxAttributeRows+1)
+	for i := range many {
+		many[i] = Attribute{"i", strconv.Itoa(i)}
+	}
+	l.InfoSync("sqlite_test", "attributes", many)
+
+	if err = l.verifyAuditChain(); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ev, err := l.store.Event(0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(ev.Attributes) != 2 || ev.Attributes[1] != (Attribute{"host", "db1"}) {
+		t.Fatalf("attributes weren't restored: %v", ev.Attributes)
+	}
+
+	ev, err = l.store.Event(l.counter - 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !reflect.DeepEqual(ev.Attributes, many) {
+		t.Fatalf("attributes weren't restored in order: have %d", len(ev.Attributes))
+	}
+
+	events, err := l.store.(ActorSearcher).EventsByActor("sqlite_test", 0, 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(events) != 3 || events[2].Serial != 2 || events[2].Attributes[0] != (Attribute{"user", "root"}) {
+		t.Fatalf("events weren't found by actor: %v", events)
+	}
+
+	events, err = l.store.(AttributeSearcher).EventsByAttribute(Attribute{"host", "db1"}, 3, 5)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(events) != 3 || events[0].Serial != 3 {
+		t.Fatalf("events weren't found by attribute: %v", events)
+	}
+
+	// Long values are only indexed by their beginning, but must
+	// match in full.
+	long := strings.Repeat("x", 300)
+	l.InfoSync("sqlite_test", "long", []Attribute{{"path", long}})
+	for _, value := range []string{long, long[:299] + "y"} {
+		events, err = l.store.(AttributeSearcher).EventsByAttribute(Attribute{"path", value}, 0, l.counter)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if (value == long) != (len(events) == 1) || len(events) > 1 {
+			t.Fatalf("unexpected events found by a long attribute: %v", events)
+		}
+	}
+
+	events, err = l.store.(LevelSearcher).EventsByLevel([]string{"INFO"}, 1, 2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(events) != 2 || events[0].Serial != 1 || len(events[1].Attributes) != 2 {
+		t.Fatalf("events weren't found by level: %v", events)
+	}
+
+	if ev.Digest != DigestCBOR {
+		t.Fatalf("expected digest version %d, have %d", DigestCBOR, ev.Digest)
+	}
+
+	if _, err = l.store.Event(l.counter); err != ErrNoEvent {
+		t.Fatalf("expected ErrNoEvent, have %v", err)
+	}
+
+	if err = l.store.StoreEvent(ev); err != ErrDuplicateSerial {
+		t.Fatalf("expected ErrDuplicateSerial, have %v", err)
+	}
+
+	errEv := &ErrorEvent{When: l.now(), Message: "test", Event: &Event{
+		Serial:     l.counter,
+		Level:      "ERROR",
+		Actor:      "sqlite_test",
+		Event:      "failure",
+		Attributes: []Attribute{{"cause", "test"}},
+	}}
+	if err = l.store.StoreError(errEv); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	errs, err := l.store.Errors(0, l.counter)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(errs) != 1 || errs[0].Message != "test" || len(errs[0].Event.Attributes) != 1 {
+		t.Fatalf("error event wasn't restored: %+v", errs)
+	}
+	l.Stop()
+
+	// A chain can be moved in and out of SQLite.
+	dst, err := OpenStore("sqlite:" + filepath.Join(t.TempDir(), "copy.db"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer dst.Close()
+
+	src, err := NewStore(cd)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer src.Close()
+
+	if err = Migrate(context.Background(), dst, src, &signer.PublicKey, nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if err = Migrate(context.Background(), NewMemoryStore(), dst, &signer.PublicKey, nil); err != nil {
+		t.Fatalf("%v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package auditlog
+
+import "database/sql"
+
+// preparedQueries are the queries the SQL stores run for every event
+// stored or loaded. They are prepared when the store is opened, rather
+// than parsed by the server on every call.
+var preparedQueries = []string{
+	insertEventQuery,
+	insertLegacyEventQuery,
+	insertAttributeQuery,
+	selectAttributesQuery,
+	selectEventQuery(true),
+	selectEventQuery(false),
+	selectEventsQuery(true),
+	selectEventsQuery(false),
+	selectActorEventsQuery(true),
+	selectActorEventsQuery(false),
+	selectAttributeEventsQuery(true),
+	selectAttributeEventsQuery(false),
+}
+
+// A stmtCache holds the statements a store has prepared, by the query
+// as the shared code writes it. A statement is prepared on the
+// database, and bound to each transaction with Tx.Stmt, which reuses
+// it on every connection it has been prepared on, preparing it on
+// others as they are used. rewrite, if set, adapts a query to the
+// database before it is run, as MySQL's placeholders require.
+//
+// The statements are prepared up front, as a store holding a single
+// connection, such as SQLite's, can't prepare one while a transaction
+// holds the connection. A query that isn't prepared, or that couldn't
+// be, as when a column it names is missing from an older schema, is
+// run as it was given.
+type stmtCache struct {
+	rewrite func(query string) string
+	stmts   map[string]*sql.Stmt
+}
+
+// newStmtCache prepares the preparedQueries on db.
+func newStmtCache(db *sql.DB, rewrite func(query string) string) *stmtCache {
+	c := &stmtCache{
+		rewrite: rewrite,
+		stmts:   map[string]*sql.Stmt{},
+	}
+
+	for _, query := range preparedQueries {
+		if stmt, err := db.Prepare(c.adapt(query)); err == nil {
+			c.stmts[query] = stmt
+		}
+	}
+	return c
+}
+
+// adapt rewrites a query for the database.
+func (c *stmtCache) adapt(query string) string {
+	if c.rewrite == nil {
+		return query
+	}
+	return c.rewrite(query)
+}
+
+// bind returns a sqlTx running queries in tx with the cache's
+// statements.
+func (c *stmtCache) bind(tx *sql.Tx) preparedTx {
+	return preparedTx{tx, c}
+}
+
+// close closes the prepared statements.
+func (c *stmtCache) close() {
+	for _, stmt := range c.stmts {
+		stmt.Close()
+	}
+}
+
+// A preparedTx runs queries in a transaction, using the statements
+// prepared for them where there are any.
+type preparedTx struct {
+	tx    *sql.Tx
+	cache *stmtCache
+}
+
+func (ptx preparedTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if stmt, ok := ptx.cache.stmts[query]; ok {
+		return ptx.tx.Stmt(stmt).Exec(args...)
+	}
+	return ptx.tx.Exec(ptx.cache.adapt(query), args...)
+}
+
+func (ptx preparedTx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	if stmt, ok := ptx.cache.stmts[query]; ok {
+		return ptx.tx.Stmt(stmt).Query(args...)
+	}
+	return ptx.tx.Query(ptx.cache.adapt(query), args...)
+}
+
+func (ptx preparedTx) QueryRow(query string, args ...interface{}) *sql.Row {
+	if stmt, ok := ptx.cache.stmts[query]; ok {
+		return ptx.tx.Stmt(stmt).QueryRow(args...)
+	}
+	return ptx.tx.QueryRow(ptx.cache.adapt(query), args...)
+}
@@ -0,0 +1,124 @@
+package auditlog
+
+import "errors"
+
+// A Store persists an audit chain. Implementations must keep events
+// in serial order and must refuse to store two events with the same
+// serial number.
+type Store interface {
+	// StoreEvent records a signed event. The event is only lent to
+	// the store: it may be reused once StoreEvent returns, so the
+	// store must copy anything it keeps.
+	StoreEvent(ev *Event) error
+
+	// StoreError records an error event.
+	StoreError(ev *ErrorEvent) error
+
+	// Count returns the number of events in the chain: one past
+	// the highest serial number stored or pruned, which is the
+	// serial number the next event takes. If the chain has gaps,
+	// it is more than the number of events held.
+	Count() (uint64, error)
+
+	// Event loads the event with the given serial number.
+	Event(serial uint64) (*Event, error)
+
+	// Events loads the events whose serial numbers fall in the
+	// range [start, end].
+	Events(start, end uint64) ([]*Event, error)
+
+	// Errors loads the error events whose serial numbers fall in
+	// the range [start, end].
+	Errors(start, end uint64) ([]*ErrorEvent, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// A Reopener is a Store that can be reopened after it has been
+// closed, which allows a stopped logger to be started again.
+type Reopener interface {
+	Reopen() error
+}
+
+// A Pruner is a Store from which the oldest events can be removed.
+// Count must continue to include pruned events, so that serial
+// numbers are never reused.
+type Pruner interface {
+	// Prune removes the events with serial numbers up to and
+	// including end. The signature of the last removed event is
+	// retained, so that the remaining chain can still be verified.
+	Prune(end uint64) error
+
+	// Pruned returns the serial number and signature of the last
+	// pruned event; ok is false if no events have been pruned. The
+	// logger checks them against the "pruned range" event it
+	// recorded when it pruned the chain.
+	Pruned() (end uint64, signature []byte, ok bool, err error)
+}
+
+// A Compressor is a Store that can compress the attributes of older
+// events. Compressed events must be returned unchanged by Event and
+// Events, so that their signatures still verify.
+type Compressor interface {
+	// Compress compresses the attributes of the events with serial
+	// numbers up to and including end, returning the number of
+	// events newly compressed.
+	Compress(end uint64) (int, error)
+}
+
+// An ActorSearcher is a Store that can find the events recorded by an
+// actor without loading the rest, as through an index.
+type ActorSearcher interface {
+	// EventsByActor loads the events recorded by actor with serial
+	// numbers in the range [start, end], in serial order.
+	EventsByActor(actor string, start, end uint64) ([]*Event, error)
+}
+
+// A LevelSearcher is a Store that can find the events at some levels
+// without loading the rest, as through an index.
+type LevelSearcher interface {
+	// EventsByLevel loads the events at any of levels, given as
+	// recorded (e.g. "ERROR"), with serial numbers in the range
+	// [start, end], in serial order.
+	EventsByLevel(levels []string, start, end uint64) ([]*Event, error)
+}
+
+// An AttributeSearcher is a Store that can find the events carrying an
+// attribute without loading the rest, as through an index.
+type AttributeSearcher interface {
+	// EventsByAttribute loads the events with serial numbers in the
+	// range [start, end] that carry attr, in serial order. It may
+	// return other events in the range as well, such as those
+	// whose attributes are stored where they can't be searched.
+	EventsByAttribute(attr Attribute, start, end uint64) ([]*Event, error)
+}
+
+// A Sizer is a Store that can report the space it takes up.
+type Sizer interface {
+	// Size returns the size of the store in bytes.
+	Size() (int64, error)
+}
+
+// A Snapshotter is a Store that can give a consistent view of the
+// chain as it stood when the view was taken, while events go on being
+// written to it.
+type Snapshotter interface {
+	Snapshot() (Snapshot, error)
+}
+
+// A Snapshot is a read-only view of a chain, which must be closed
+// once it is no longer needed.
+type Snapshot interface {
+	Events(start, end uint64) ([]*Event, error)
+	Errors(start, end uint64) ([]*ErrorEvent, error)
+	Close() error
+}
+
+// ErrNoEvent is returned by a Store when the requested event doesn't
+// exist.
+var ErrNoEvent = errors.New("auditlog: no such event")
+
+// ErrDuplicateSerial is returned by a Store when an event is stored
+// with a serial number that is already in use.
+var ErrDuplicateSerial = errors.New("auditlog: duplicate event serial")
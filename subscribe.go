@@ -0,0 +1,139 @@
+package auditlog
+
+import "log"
+
+// SubscriberBuffer is the number of events a subscriber may fall
+// behind before events are dropped for it.
+const SubscriberBuffer = 256
+
+// A subscriber receives the recorded events its filter selects. A
+// subscriber feeding a hook only receives events once they have been
+// stored, so an event buffered in degraded mode reaches it when the
+// buffer is flushed.
+type subscriber struct {
+	events chan *Event
+	filter func(ev *Event) bool
+	stored bool
+}
+
+// Subscribe returns a channel receiving a copy of each event the
+// logger records from now on that filter selects, or of every event
+// if filter is nil, once the event has been signed and committed,
+// including the events recorded by the logger itself. Calling cancel
+// ends the subscription and closes the channel; the subscription
+// otherwise lasts across restarts of the logger.
+//
+// The logger doesn't wait for subscribers: an event that would block
+// a subscriber that has fallen SubscriberBuffer events behind is
+// dropped for it, which shows as a gap in the serial numbers it
+// receives. The filter is called with the logger's lock held, so it
+// must not use the logger.
+func (l *Logger) Subscribe(filter func(ev *Event) bool) (events <-chan *Event, cancel func()) {
+	return l.subscribe(&subscriber{
+		events: make(chan *Event, SubscriberBuffer),
+		filter: filter,
+	})
+}
+
+// subscribe adds a subscriber, returning its channel and the function
+// cancelling it.
+func (l *Logger) subscribe(sub *subscriber) (events <-chan *Event, cancel func()) {
+	l.subLock.Lock()
+	if l.subscribers == nil {
+		l.subscribers = map[*subscriber]bool{}
+	}
+	l.subscribers[sub] = true
+	l.subLock.Unlock()
+
+	cancel = func() {
+		l.subLock.Lock()
+		defer l.subLock.Unlock()
+
+		if l.subscribers[sub] {
+			delete(l.subscribers, sub)
+			close(sub.events)
+		}
+	}
+	return sub.events, cancel
+}
+
+// publish sends a recorded event to its subscribers, leaving out the
+// hooks if the event has been buffered in degraded mode rather than
+// stored.
+func (l *Logger) publish(ev *Event) {
+	l.subLock.Lock()
+	defer l.subLock.Unlock()
+
+	for sub := range l.subscribers {
+		if !sub.stored || ev.err != ErrBuffered {
+			sub.send(ev)
+		}
+	}
+}
+
+// publishFlushed sends an event buffered in degraded mode to the hooks
+// once it has been stored.
+func (l *Logger) publishFlushed(ev *Event) {
+	l.subLock.Lock()
+	defer l.subLock.Unlock()
+
+	for sub := range l.subscribers {
+		if sub.stored {
+			sub.send(ev)
+		}
+	}
+}
+
+// send sends a copy of ev to the subscriber if its filter selects it
+// and it has room.
+func (sub *subscriber) send(ev *Event) {
+	if sub.filter != nil && !sub.filter(ev) {
+		return
+	}
+
+	select {
+	case sub.events <- copyEvent(ev):
+	default:
+	}
+}
+
+// HookBuffer is the number of events a hook may fall behind before
+// events are dropped for it.
+const HookBuffer = 4096
+
+// AddHook calls hook with each event the logger records from now on,
+// once it has been signed and stored, for forwarding to a SIEM,
+// metrics, or notifications. Events buffered in degraded mode reach
+// the hook when they are stored. The hook is called in order, on a
+// goroutine of its own, so it may take its time and may use the
+// logger; but an event that arrives while the hook is HookBuffer
+// events behind is dropped for it, leaving a gap in the serial
+// numbers it sees. A hook that panics has the panic logged and is
+// called with the next event; nothing it does affects the chain.
+//
+// A hook lasts across restarts of the logger until remove is called.
+// Events already queued for it are still delivered, after which its
+// goroutine exits; remove may be called from the hook itself.
+func (l *Logger) AddHook(hook func(ev *Event)) (remove func()) {
+	events, cancel := l.subscribe(&subscriber{
+		events: make(chan *Event, HookBuffer),
+		stored: true,
+	})
+
+	go func() {
+		for ev := range events {
+			runHook(hook, ev)
+		}
+	}()
+	return cancel
+}
+
+// runHook calls hook with ev, logging the hook's panic if it has one.
+func runHook(hook func(ev *Event), ev *Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("auditlog: hook panicked on event %d: %v", ev.Serial, r)
+		}
+	}()
+	hook(ev)
+}
@@ -0,0 +1,51 @@
+package auditlog
+
+import "testing"
+
+func TestSubscribe(t *testing.T) {
+	l, _ := newTestLogger(t)
+
+	all, cancelAll := l.Subscribe(nil)
+	failures, cancelFailures := l.Subscribe(func(ev *Event) bool {
+		return LevelAtLeast(ev.Level, "error")
+	})
+	defer cancelFailures()
+
+	l.Start()
+	l.InfoSync("subscribe_test", "login", []Attribute{{"user", "alice"}})
+	l.ErrorSync("subscribe_test", "denied", nil)
+
+	for i, want := range []string{"login", "denied"} {
+		ev := <-all
+		if ev.Serial != uint64(i) || ev.Event != want || len(ev.Signature) == 0 {
+			t.Fatalf("expected signed event %d (%s), have %s", i, want, ev)
+		}
+	}
+
+	if ev := <-failures; ev.Event != "denied" {
+		t.Fatalf("expected the ERROR event, have %s", ev)
+	}
+
+	// A cancelled subscription is closed, and a slow subscriber
+	// doesn't hold the logger up.
+	cancelAll()
+	if _, ok := <-all; ok {
+		t.Fatal("expected the subscription to be closed")
+	}
+
+	slow, cancelSlow := l.Subscribe(nil)
+	defer cancelSlow()
+	for i := 0; i < SubscriberBuffer+10; i++ {
+		l.Info("subscribe_test", "event", nil)
+	}
+	l.InfoSync("subscribe_test", "event", nil)
+	l.Stop()
+
+	if len(slow) != SubscriberBuffer {
+		t.Fatalf("expected %d events to be waiting, have %d", SubscriberBuffer, len(slow))
+	}
+
+	if len(failures) != 0 {
+		t.Fatalf("expected no more ERROR events, have %d", len(failures))
+	}
+}
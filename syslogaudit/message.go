@@ -0,0 +1,210 @@
+package syslogaudit
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kisom/auditlog"
+)
+
+// facilityNames names the syslog facilities, by number.
+var facilityNames = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// severityNames names the syslog severities, by number.
+var severityNames = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// severityLevels maps the syslog severities to audit levels; the
+// emergency, alert, and critical severities are all CRITICAL, and
+// notices are INFO.
+var severityLevels = []string{
+	"CRITICAL", "CRITICAL", "CRITICAL", "ERROR", "WARNING", "INFO", "INFO", "DEBUG",
+}
+
+// An SDElement is an element of a message's structured data.
+type SDElement struct {
+	ID     string
+	Params []auditlog.Attribute
+}
+
+// A Message is a syslog message in the format of RFC 5424. Fields
+// given as the nil value, "-", are empty, and Timestamp is zero.
+type Message struct {
+	Facility       int
+	Severity       int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData []SDElement
+	Message        string
+}
+
+var errMalformed = errors.New("syslogaudit: malformed message")
+
+// ParseMessage parses an RFC 5424 syslog message.
+func ParseMessage(s string) (*Message, error) {
+	if !strings.HasPrefix(s, "<") {
+		return nil, errMalformed
+	}
+
+	end := strings.IndexByte(s, '>')
+	if end < 2 || end > 4 {
+		return nil, errMalformed
+	}
+
+	pri, err := strconv.Atoi(s[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return nil, errMalformed
+	}
+
+	// The header is the version and six space-separated fields.
+	fields := strings.SplitN(s[end+1:], " ", 7)
+	if len(fields) < 7 || fields[0] != "1" {
+		return nil, errMalformed
+	}
+
+	msg := &Message{
+		Facility: pri / 8,
+		Severity: pri % 8,
+		Hostname: nilValue(fields[2]),
+		AppName:  nilValue(fields[3]),
+		ProcID:   nilValue(fields[4]),
+		MsgID:    nilValue(fields[5]),
+	}
+
+	if fields[1] != "-" {
+		msg.Timestamp, err = time.Parse(time.RFC3339Nano, fields[1])
+		if err != nil {
+			return nil, errMalformed
+		}
+	}
+
+	rest := fields[6]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		msg.StructuredData, rest, err = parseStructuredData(rest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if rest != "" {
+		if rest[0] != ' ' {
+			return nil, errMalformed
+		}
+		msg.Message = strings.TrimPrefix(rest[1:], "\ufeff")
+	}
+	return msg, nil
+}
+
+// nilValue returns a header field, or the empty string for the nil
+// value.
+func nilValue(field string) string {
+	if field == "-" {
+		return ""
+	}
+	return field
+}
+
+// parseStructuredData parses the structured data elements at the
+// start of s, returning them and the rest of s.
+func parseStructuredData(s string) ([]SDElement, string, error) {
+	var elements []SDElement
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 2 {
+			return nil, "", errMalformed
+		}
+
+		element := SDElement{ID: s[1:end]}
+		s = s[end:]
+		for strings.HasPrefix(s, " ") {
+			eq := strings.Index(s, `="`)
+			if eq < 2 {
+				return nil, "", errMalformed
+			}
+
+			name := s[1:eq]
+			value, rest, err := parseParamValue(s[eq+2:])
+			if err != nil {
+				return nil, "", err
+			}
+			element.Params = append(element.Params, auditlog.Attribute{Name: name, Value: value})
+			s = rest
+		}
+
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", errMalformed
+		}
+		s = s[1:]
+		elements = append(elements, element)
+	}
+
+	if elements == nil {
+		return nil, "", errMalformed
+	}
+	return elements, s, nil
+}
+
+// parseParamValue parses a parameter value, up to its closing quote,
+// returning the value, unescaped, and the rest of s.
+func parseParamValue(s string) (string, string, error) {
+	var value strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return value.String(), s[i+1:], nil
+		case '\\':
+			// Only ", \, and ] are escaped; any other
+			// backslash is kept.
+			if i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+				i++
+			}
+		}
+		value.WriteByte(s[i])
+	}
+	return "", "", errMalformed
+}
+
+// Level returns the audit level of the message's severity.
+func (msg *Message) Level() string {
+	return severityLevels[msg.Severity]
+}
+
+// Attributes returns the message's facility, severity, and header
+// fields as attributes, followed by its structured data parameters,
+// named by their element's ID and their own name, as in
+// "origin.ip".
+func (msg *Message) Attributes() []auditlog.Attribute {
+	attrs := []auditlog.Attribute{
+		{Name: "facility", Value: facilityNames[msg.Facility]},
+		{Name: "severity", Value: severityNames[msg.Severity]},
+	}
+
+	for _, field := range []auditlog.Attribute{
+		{Name: "hostname", Value: msg.Hostname},
+		{Name: "procid", Value: msg.ProcID},
+		{Name: "msgid", Value: msg.MsgID},
+	} {
+		if field.Value != "" {
+			attrs = append(attrs, field)
+		}
+	}
+
+	for _, element := range msg.StructuredData {
+		for _, param := range element.Params {
+			attrs = append(attrs, auditlog.Attribute{Name: element.ID + "." + param.Name, Value: param.Value})
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,173 @@
+// Package syslogaudit accepts syslog messages, in the format of RFC
+// 5424, over TCP or TLS, and records them in an audit chain, so that
+// network devices and daemons that only speak syslog can feed it:
+//
+//	go syslogaudit.ListenAndServe(logger, ":6514", tlsConfig)
+//
+// Messages may be framed by octet counting or by newlines, as
+// described by RFC 6587. Each message is recorded, timestamped by the
+// sender, as an event whose actor is its APP-NAME and whose event is
+// its MSG. The audit level follows the severity, and the facility,
+// severity, header fields, and structured data are attributes; see
+// Message.Attributes.
+package syslogaudit
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kisom/auditlog"
+)
+
+// MaxMessageSize bounds the messages a Listener reads; a connection
+// sending a longer message is closed.
+const MaxMessageSize = 64 << 10
+
+// DefaultActor is the actor recorded for messages without an
+// APP-NAME, and for malformed messages.
+const DefaultActor = "syslog"
+
+// EventMessage is the event recorded for a message with neither a
+// MSG nor a MSGID.
+const EventMessage = "syslog message"
+
+// EventMalformed is recorded, as a WARNING, for a message that can't
+// be parsed, with the message as its "message" attribute.
+const EventMalformed = "malformed syslog message"
+
+// A Listener records the syslog messages it receives in the chain
+// kept by its logger.
+type Listener struct {
+	Logger *auditlog.Logger
+}
+
+// ListenAndServe listens on the TCP address addr, with TLS if config
+// isn't nil, and records the messages it receives in the chain kept
+// by l.
+func ListenAndServe(l *auditlog.Logger, addr string, config *tls.Config) error {
+	var ln net.Listener
+	var err error
+	if config != nil {
+		ln, err = tls.Listen("tcp", addr, config)
+	} else {
+		ln, err = net.Listen("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	return (&Listener{Logger: l}).Serve(ln)
+}
+
+// Serve accepts connections on ln, reading messages from each, until
+// ln is closed; it returns the error that ended it.
+func (s *Listener) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn records the messages read from conn.
+func (s *Listener) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	addr := conn.RemoteAddr().String()
+	r := bufio.NewReaderSize(conn, MaxMessageSize)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("syslogaudit: %s: %v", addr, err)
+			}
+			return
+		}
+
+		if frame != "" {
+			s.record(frame, addr)
+		}
+	}
+}
+
+var errTooLong = errors.New("syslogaudit: message too long")
+
+// readFrame reads the next message, framed by octet counting if it
+// starts with a digit, or else by a newline.
+func readFrame(r *bufio.Reader) (string, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if first[0] >= '0' && first[0] <= '9' {
+		count, err := r.ReadString(' ')
+		if err != nil {
+			return "", err
+		}
+
+		n, err := strconv.Atoi(strings.TrimSuffix(count, " "))
+		if err != nil {
+			return "", errors.New("syslogaudit: invalid octet count")
+		} else if n > MaxMessageSize {
+			return "", errTooLong
+		}
+
+		frame := make([]byte, n)
+		if _, err = io.ReadFull(r, frame); err != nil {
+			return "", err
+		}
+		return string(frame), nil
+	}
+
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", errTooLong
+	} else if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	return strings.TrimRight(string(line), "\r\n"), err
+}
+
+// record records a message received from addr.
+func (s *Listener) record(frame, addr string) {
+	msg, err := ParseMessage(frame)
+	if err != nil {
+		s.Logger.LogAt(time.Now(), "WARNING", DefaultActor, EventMalformed, []auditlog.Attribute{
+			{Name: "message", Value: frame},
+			{Name: "remote_addr", Value: addr},
+		})
+		return
+	}
+
+	when := msg.Timestamp
+	if when.IsZero() {
+		when = time.Now()
+	}
+
+	actor := msg.AppName
+	if actor == "" {
+		actor = DefaultActor
+	}
+
+	event := msg.Message
+	if event == "" {
+		event = msg.MsgID
+	}
+	if event == "" {
+		event = EventMessage
+	}
+
+	attrs := append(msg.Attributes(), auditlog.Attribute{Name: "remote_addr", Value: addr})
+	s.Logger.LogAt(when, msg.Level(), actor, event, attrs)
+}
@@ -0,0 +1,138 @@
+package syslogaudit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kisom/auditlog"
+)
+
+func TestParseMessage(t *testing.T) {
+	msg, err := ParseMessage(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 ` +
+		`[exampleSDID@32473 iut="3" eventSource="Application"][origin ip="192.0.2.1" note="a \"quoted\" \] value"] ` +
+		"\ufeffAn application event log entry...")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	want := &Message{
+		Facility:  20,
+		Severity:  5,
+		Timestamp: time.Date(2003, 10, 11, 22, 14, 15, 3000000, time.UTC),
+		Hostname:  "mymachine.example.com",
+		AppName:   "evntslog",
+		MsgID:     "ID47",
+		StructuredData: []SDElement{
+			{ID: "exampleSDID@32473", Params: []auditlog.Attribute{{Name: "iut", Value: "3"}, {Name: "eventSource", Value: "Application"}}},
+			{ID: "origin", Params: []auditlog.Attribute{{Name: "ip", Value: "192.0.2.1"}, {Name: "note", Value: `a "quoted" ] value`}}},
+		},
+		Message: "An application event log entry...",
+	}
+	if !reflect.DeepEqual(msg, want) {
+		t.Fatalf("expected %+v, have %+v", want, msg)
+	}
+
+	if msg.Level() != "INFO" || msg.Attributes()[0].Value != "local4" {
+		t.Fatalf("expected a local4 INFO message, have %s %+v", msg.Level(), msg.Attributes())
+	}
+
+	msg, err = ParseMessage("<34>1 - - su - - -")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if msg.Level() != "CRITICAL" || msg.AppName != "su" || !msg.Timestamp.IsZero() || msg.Message != "" {
+		t.Fatalf("expected a CRITICAL message from su, have %+v", msg)
+	}
+
+	for _, bad := range []string{
+		"",
+		"<34>Oct 11 22:14:15 mymachine su: 'su root' failed",
+		"<192>1 - - - - - -",
+		"<34>1 - - - - - [unterminated",
+		"<34>1 - - - - - [id param=\"unterminated]",
+	} {
+		if _, err = ParseMessage(bad); err == nil {
+			t.Fatalf("expected %q to be malformed", bad)
+		}
+	}
+}
+
+func TestListener(t *testing.T) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	audit, err := auditlog.NewWithStore(auditlog.NewMemoryStore(), signer, auditlog.WithoutEcho())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	audit.Start()
+	defer audit.Stop()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer ln.Close()
+	go (&Listener{Logger: audit}).Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Octet counting and newlines may be mixed.
+	msg := "<86>1 - host sshd 42 - [auth user=\"alice\"] session opened"
+	fmt.Fprintf(conn, "%d %s", len(msg), msg)
+	io.WriteString(conn, "<83>1 - host sshd - - - authentication failure\r\n")
+	io.WriteString(conn, "not syslog\n")
+	conn.Close()
+
+	var events []*auditlog.Event
+	deadline := time.Now().Add(5 * time.Second)
+	for len(events) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		events, err = audit.Query("syslogaudit_test", auditlog.Query{Actor: "sshd"})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		malformed, err := audit.Query("syslogaudit_test", auditlog.Query{Event: EventMalformed})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		events = append(events, malformed...)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, have %d", len(events))
+	}
+
+	ev := events[0]
+	want := []auditlog.Attribute{
+		{Name: "facility", Value: "authpriv"},
+		{Name: "severity", Value: "info"},
+		{Name: "hostname", Value: "host"},
+		{Name: "procid", Value: "42"},
+		{Name: "auth.user", Value: "alice"},
+	}
+	if ev.Event != "session opened" || ev.Level != "INFO" || !reflect.DeepEqual(ev.Attributes[:len(want)], want) {
+		t.Fatalf("expected the session event, have %s", ev)
+	}
+
+	if ev = events[1]; ev.Event != "authentication failure" || ev.Level != "ERROR" {
+		t.Fatalf("expected the failure, have %s", ev)
+	}
+
+	if ev = events[2]; ev.Level != "WARNING" || ev.Attributes[0].Value != "not syslog" {
+		t.Fatalf("expected the malformed message, have %s", ev)
+	}
+}
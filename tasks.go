@@ -0,0 +1,80 @@
+package auditlog
+
+import "time"
+
+// A task is a background job run while the logger is running, such
+// as periodically recording a summary event. It must return promptly
+// once stop is closed; the logger is still accepting events at that
+// point, so a task may record a final event before it returns.
+type task func(l *Logger, stop <-chan struct{})
+
+// addTask registers a task to be run whenever the logger is running.
+func (l *Logger) addTask(t task) {
+	l.tasks = append(l.tasks, t)
+}
+
+// every returns a task that calls f every interval, and once more
+// when the logger is stopped if final is true.
+func every(interval time.Duration, final bool, f func(l *Logger)) task {
+	return func(l *Logger, stop <-chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				f(l)
+			case <-stop:
+				if final {
+					f(l)
+				}
+				return
+			}
+		}
+	}
+}
+
+// startTasks starts the background tasks; the caller must hold the
+// state lock.
+func (l *Logger) startTasks() {
+	l.taskStop = make(chan struct{})
+	for _, t := range l.tasks {
+		l.taskGroup.Add(1)
+		go func(t task) {
+			defer l.taskGroup.Done()
+			t(l, l.taskStop)
+		}(t)
+	}
+}
+
+// stopTasks stops the background tasks and waits for them to finish.
+func (l *Logger) stopTasks() {
+	close(l.taskStop)
+	l.taskGroup.Wait()
+}
+
+// logInternal records an event generated by the logger itself,
+// regardless of the minimum level, and waits for it to be recorded.
+func (l *Logger) logInternal(level int, event string, attributes []Attribute) {
+	if !l.accept(levelInternal) {
+		return
+	}
+
+	wait := make(chan struct{}, 0)
+	l.logInternalEvent(level, event, attributes, wait, nil)
+	<-wait
+}
+
+// logInternalE performs the same function as logInternal, except that
+// it returns an error if the event wasn't stored, as InfoE does.
+func (l *Logger) logInternalE(level int, event string, attributes []Attribute) error {
+	if ok, err := l.admit(levelInternal); !ok {
+		return err
+	}
+
+	var err error
+	wait := make(chan struct{}, 0)
+	l.logInternalEvent(level, event, attributes, wait, &err)
+	<-wait
+	return err
+}
@@ -0,0 +1,72 @@
+package auditlog
+
+import (
+	"context"
+	"log"
+	"log/slog"
+)
+
+// The tee options copy every recorded event to an application logger,
+// so that operational log pipelines see audit activity as it happens.
+// The copy is made after the event has been signed and stored; the
+// store remains the authoritative record. Other logging libraries can
+// be reached through slog handlers (e.g. zap's zapslog).
+
+// WithSlog copies every recorded event to logger.
+func WithSlog(logger *slog.Logger) Option {
+	return func(l *Logger) {
+		l.tees = append(l.tees, func(ev *Event) {
+			logSlog(logger, ev)
+		})
+	}
+}
+
+// WithStdLogger copies every recorded event to logger, formatted
+// with the logger's formatter.
+func WithStdLogger(logger *log.Logger) Option {
+	return func(l *Logger) {
+		l.tees = append(l.tees, func(ev *Event) {
+			logger.Print(l.format(ev))
+		})
+	}
+}
+
+// slogLevels maps audit levels to slog levels; CRITICAL events sit
+// above slog's ERROR level.
+var slogLevels = map[string]slog.Level{
+	"DEBUG":    slog.LevelDebug,
+	"INFO":     slog.LevelInfo,
+	"WARNING":  slog.LevelWarn,
+	"ERROR":    slog.LevelError,
+	"CRITICAL": slog.LevelError + 4,
+}
+
+func logSlog(logger *slog.Logger, ev *Event) {
+	level, ok := slogLevels[ev.Level]
+	if !ok {
+		level = slog.LevelInfo
+	}
+
+	attrs := []slog.Attr{
+		slog.Uint64("serial", ev.Serial),
+		slog.String("actor", ev.Actor),
+		slog.String("level", ev.Level),
+	}
+
+	if len(ev.Attributes) > 0 {
+		var group []any
+		for _, attr := range ev.Attributes {
+			group = append(group, slog.String(attr.Name, attr.Value))
+		}
+		attrs = append(attrs, slog.Group("attributes", group...))
+	}
+
+	logger.LogAttrs(context.Background(), level, ev.Event, attrs...)
+}
+
+// tee copies a recorded event to the application loggers.
+func (l *Logger) tee(ev *Event) {
+	for _, f := range l.tees {
+		f(ev)
+	}
+}
@@ -0,0 +1,29 @@
+package auditlog
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/kisom/auditlog/internal/testkeys"
+)
+
+// testKey returns a signing key derived from the test's name and
+// seed, as auditlogtest.ECDSAKey derives them, so that each test has
+// keys of its own, and the same key whenever it asks for it again.
+// These tests can't import auditlogtest, which imports this package.
+func testKey(t testing.TB, seed string) *ecdsa.PrivateKey {
+	return testkeys.ECDSAKey(t.Name() + "/" + seed)
+}
+
+// newTestLogger returns a logger, not yet started, on a new memory
+// store, signing with the test's "signer" key and not echoing events.
+func newTestLogger(t testing.TB, opts ...Option) (*Logger, *MemoryStore) {
+	t.Helper()
+
+	store := NewMemoryStore()
+	l, err := NewWithStore(store, testKey(t, "signer"), append([]Option{WithoutEcho()}, opts...)...)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return l, store
+}
@@ -0,0 +1,181 @@
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Events recording trusted timestamps of the chain's head.
+const (
+	EventTimestamp        = "chain timestamped"
+	EventTimestampFailure = "timestamp failure"
+)
+
+// DefaultTimestampTimeout bounds each request to the timestamping
+// authority when TimestampPolicy.Timeout is zero.
+const DefaultTimestampTimeout = 30 * time.Second
+
+// A Timestamper obtains a token from a trusted timestamping authority
+// proving that a SHA-256 digest existed at the time it returns. The
+// tsa package implements RFC 3161.
+type Timestamper interface {
+	Timestamp(ctx context.Context, digest []byte) (token []byte, when time.Time, err error)
+}
+
+// A TimestampPolicy timestamps the head of the chain every Interval,
+// if events have been recorded since the last timestamp, and once more
+// when the logger stops.
+type TimestampPolicy struct {
+	Interval    time.Duration
+	Timestamper Timestamper
+
+	// Timeout bounds each request to the authority. If it is zero,
+	// DefaultTimestampTimeout is used.
+	Timeout time.Duration
+}
+
+// WithTimestamps timestamps the head of the chain as described by the
+// policy, recording each token in a "chain timestamped" event. The
+// token covers the digest of the head event's signature, as a
+// Checkpoint does, and so the whole chain up to it: it proves the
+// events existed before the authority's time even if the signing key
+// is later compromised. A timestamp that can't be obtained is reported
+// in an ERROR "timestamp failure" event.
+func WithTimestamps(policy TimestampPolicy) Option {
+	return func(l *Logger) {
+		if policy.Interval <= 0 || policy.Timestamper == nil {
+			return
+		}
+
+		timeout := policy.Timeout
+		if timeout <= 0 {
+			timeout = DefaultTimestampTimeout
+		}
+
+		l.addTask(every(policy.Interval, true, func(l *Logger) {
+			cp, ok := l.Checkpoint()
+			if !ok || l.headTimestamped() {
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := l.timestamp(ctx, policy.Timestamper, cp)
+			cancel()
+			if err != nil {
+				l.logInternal(levelError, EventTimestampFailure, []Attribute{
+					{"serial", strconv.FormatUint(cp.Serial, 10)},
+					{"error", err.Error()},
+				})
+			}
+		}))
+	}
+}
+
+// headTimestamped reports whether the last event in the chain is a
+// timestamp, in which case there is nothing new to timestamp.
+func (l *Logger) headTimestamped() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.counter == 0 {
+		return false
+	}
+
+	ev, err := l.store.Event(l.counter - 1)
+	return err == nil && ev.Actor == internalActor && ev.Event == EventTimestamp
+}
+
+// Timestamp obtains a timestamp of the current head of the chain from
+// ts and records it, as WithTimestamps does periodically. The logger
+// must be running.
+func (l *Logger) Timestamp(ctx context.Context, ts Timestamper) error {
+	cp, ok := l.Checkpoint()
+	if !ok {
+		return errors.New("auditlog: the chain is empty")
+	}
+	return l.timestamp(ctx, ts, cp)
+}
+
+// timestamp obtains a timestamp of the checkpointed head and records
+// it in the chain.
+func (l *Logger) timestamp(ctx context.Context, ts Timestamper, cp Checkpoint) error {
+	digest, err := hex.DecodeString(cp.Head)
+	if err != nil {
+		return err
+	}
+
+	token, when, err := ts.Timestamp(ctx, digest)
+	if err != nil {
+		return err
+	}
+
+	if !l.accept(levelInternal) {
+		return errors.New("auditlog: logger is not running")
+	}
+
+	wait := make(chan struct{}, 0)
+	l.logInternalEvent(levelInfo, EventTimestamp, []Attribute{
+		{"serial", strconv.FormatUint(cp.Serial, 10)},
+		{"head", cp.Head},
+		{"time", when.UTC().Format(time.RFC3339Nano)},
+		{"token", base64.StdEncoding.EncodeToString(token)},
+	}, wait, nil)
+	<-wait
+	return nil
+}
+
+// A Timestamp is a trusted timestamp recorded in the chain: the
+// serial number of the head event it covers, the digest of that
+// event's signature, the time the authority gave, and its token. The
+// time is as the logger recorded it; only the token, checked with the
+// authority's certificates, proves it.
+type Timestamp struct {
+	Serial uint64
+	Head   []byte
+	When   time.Time
+	Token  []byte
+}
+
+// ParseTimestamp reads the timestamp recorded in a "chain
+// timestamped" event.
+func ParseTimestamp(ev *Event) (*Timestamp, error) {
+	if ev.Actor != internalActor || ev.Event != EventTimestamp {
+		return nil, errors.New("auditlog: not a timestamp event")
+	}
+
+	var ts Timestamp
+	var err error
+	serial, _ := ev.attr("serial")
+	if ts.Serial, err = strconv.ParseUint(serial, 10, 64); err != nil {
+		return nil, err
+	}
+
+	head, _ := ev.attr("head")
+	if ts.Head, err = hex.DecodeString(head); err != nil {
+		return nil, err
+	}
+
+	when, _ := ev.attr("time")
+	if ts.When, err = time.Parse(time.RFC3339Nano, when); err != nil {
+		return nil, err
+	}
+
+	token, _ := ev.attr("token")
+	if ts.Token, err = base64.StdEncoding.DecodeString(token); err != nil {
+		return nil, err
+	}
+	return &ts, nil
+}
+
+// Covers reports whether the timestamp covers head, which must be the
+// event with the timestamp's serial number.
+func (ts *Timestamp) Covers(head *Event) bool {
+	digest := sha256.Sum256(head.Signature)
+	return head.Serial == ts.Serial && bytes.Equal(digest[:], ts.Head)
+}
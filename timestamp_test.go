@@ -0,0 +1,100 @@
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeTimestamper returns the digest it was asked to timestamp as its
+// token.
+type fakeTimestamper struct {
+	when  time.Time
+	calls int
+	err   error
+}
+
+func (ft *fakeTimestamper) Timestamp(ctx context.Context, digest []byte) ([]byte, time.Time, error) {
+	ft.calls++
+	if ft.err != nil {
+		return nil, time.Time{}, ft.err
+	}
+	return append([]byte("token:"), digest...), ft.when, nil
+}
+
+func TestTimestamps(t *testing.T) {
+	ft := &fakeTimestamper{when: time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)}
+	l, store := newTestLogger(t,
+		WithTimestamps(TimestampPolicy{Interval: time.Hour, Timestamper: ft}))
+	l.Start()
+
+	for i := 0; i < 3; i++ {
+		l.InfoSync("timestamp_test", "event", nil)
+	}
+
+	// A timestamp taken on demand covers the head, and the final
+	// timestamp when the logger stops is skipped, as nothing has been
+	// recorded since.
+	if err := l.Timestamp(context.Background(), ft); err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	if ft.calls != 1 {
+		t.Fatalf("expected the head to be timestamped once, have %d", ft.calls)
+	}
+
+	ev, err := store.Event(3)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ts, err := ParseTimestamp(ev)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	head, err := store.Event(2)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	digest := sha256.Sum256(head.Signature)
+	if !ts.Covers(head) || !ts.When.Equal(ft.when) ||
+		!bytes.Equal(ts.Token, append([]byte("token:"), digest[:]...)) {
+		t.Fatalf("unexpected timestamp %+v", ts)
+	}
+
+	if ts.Covers(ev) {
+		t.Fatal("timestamp covers an event after its head")
+	}
+
+	if _, err = ParseTimestamp(head); err == nil {
+		t.Fatal("parsed a timestamp from an ordinary event")
+	}
+}
+
+func TestTimestampFailure(t *testing.T) {
+	ft := &fakeTimestamper{err: errors.New("authority unavailable")}
+	l, store := newTestLogger(t,
+		WithTimestamps(TimestampPolicy{Interval: time.Hour, Timestamper: ft}))
+	l.Start()
+	l.InfoSync("timestamp_test", "event", nil)
+	l.Stop()
+
+	ev, err := store.Event(1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if ev.Event != EventTimestampFailure || ev.Level != levelStrings[levelError] {
+		t.Fatalf("expected a timestamp failure, have %+v", ev)
+	}
+
+	if msg, _ := ev.attr("error"); msg != "authority unavailable" {
+		t.Fatalf("unexpected failure %q", msg)
+	}
+}
@@ -0,0 +1,458 @@
+// Package tsa obtains and verifies RFC 3161 timestamp tokens, so that
+// the head of an audit chain can be timestamped by a trusted
+// timestamping authority with auditlog.WithTimestamps. A token proves
+// that the chain up to the timestamped event existed at the
+// authority's time, independently of the logger's signing key.
+//
+// Tokens are verified as CMS SignedData (RFC 5652): the signature over
+// the signed attributes must verify with the certificate named by the
+// signer, the attributes' message digest must match the TSTInfo, and
+// the certificate must chain to a trusted root and be valid for
+// timestamping at the time in the token.
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// Object identifiers used in requests and tokens.
+var (
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	oidRSA             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSA           = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	ReqPolicy      asn1.ObjectIdentifier `asn1:"optional"`
+	Nonce          *big.Int              `asn1:"optional"`
+	CertReq        bool                  `asn1:"optional,default:false"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional,utf8"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status pkiStatusInfo
+	Token  asn1.RawValue `asn1:"optional"`
+}
+
+// contentInfo holds its content in an explicit [0] tag, which
+// encoding/asn1 leaves in place for a RawValue.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type accuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        time.Time     `asn1:"generalized"`
+	Accuracy       accuracy      `asn1:"optional"`
+	Ordering       bool          `asn1:"optional,default:false"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// An Info describes a verified timestamp token.
+type Info struct {
+	// Time is the time the authority gave the token.
+	Time time.Time
+
+	// Accuracy is the authority's stated accuracy, or zero if it
+	// didn't give one.
+	Accuracy time.Duration
+
+	// Policy is the authority's policy under which the token was
+	// issued.
+	Policy asn1.ObjectIdentifier
+
+	// SerialNumber is the token's serial number, unique to the
+	// authority.
+	SerialNumber *big.Int
+
+	// Signer is the certificate of the key that signed the token.
+	Signer *x509.Certificate
+
+	nonce *big.Int
+}
+
+// Verify checks that token is a timestamp of the SHA-256 digest,
+// signed by an authority whose certificate chains to roots and is
+// valid for timestamping at the time in the token. If roots is nil,
+// the system's roots are used. Intermediate certificates are taken
+// from the token, which carries them when the request asked for
+// certificates, as Client does.
+func Verify(token, digest []byte, roots *x509.CertPool) (*Info, error) {
+	var ci contentInfo
+	rest, err := asn1.Unmarshal(token, &ci)
+	if err != nil {
+		return nil, fmt.Errorf("tsa: malformed token: %w", err)
+	} else if len(rest) > 0 || !ci.ContentType.Equal(oidSignedData) ||
+		ci.Content.Class != asn1.ClassContextSpecific || ci.Content.Tag != 0 {
+		return nil, errors.New("tsa: the token isn't CMS signed data")
+	}
+
+	var sd signedData
+	if _, err = asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("tsa: malformed token: %w", err)
+	}
+
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) || len(sd.SignerInfos) != 1 {
+		return nil, errors.New("tsa: the token doesn't hold a single signed TSTInfo")
+	}
+
+	var info tstInfo
+	if _, err = asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, fmt.Errorf("tsa: malformed TSTInfo: %w", err)
+	}
+
+	if !info.MessageImprint.HashAlgorithm.Algorithm.Equal(oidSHA256) ||
+		!bytes.Equal(info.MessageImprint.HashedMessage, digest) {
+		return nil, errors.New("tsa: the token doesn't cover the digest")
+	}
+
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	si := sd.SignerInfos[0]
+	signer, err := findSigner(si.SID, certs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkSignature(signer, si, sd.EncapContentInfo.EContent); err != nil {
+		return nil, err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs {
+		intermediates.AddCert(cert)
+	}
+
+	_, err = signer.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   info.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("tsa: the authority's certificate isn't trusted: %w", err)
+	}
+
+	return &Info{
+		Time: info.GenTime,
+		Accuracy: time.Duration(info.Accuracy.Seconds)*time.Second +
+			time.Duration(info.Accuracy.Millis)*time.Millisecond +
+			time.Duration(info.Accuracy.Micros)*time.Microsecond,
+		Policy:       info.Policy,
+		SerialNumber: info.SerialNumber,
+		Signer:       signer,
+		nonce:        info.Nonce,
+	}, nil
+}
+
+// findSigner returns the certificate named by a signer identifier:
+// either the issuer and serial number, or, tagged [0], the subject key
+// identifier.
+func findSigner(sid asn1.RawValue, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, cert := range certs {
+			if bytes.Equal(cert.SubjectKeyId, sid.Bytes) {
+				return cert, nil
+			}
+		}
+		return nil, errors.New("tsa: the token doesn't carry the signer's certificate")
+	}
+
+	var ias issuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &ias); err != nil {
+		return nil, fmt.Errorf("tsa: malformed signer identifier: %w", err)
+	}
+
+	for _, cert := range certs {
+		if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.Serial) == 0 {
+			return cert, nil
+		}
+	}
+	return nil, errors.New("tsa: the token doesn't carry the signer's certificate")
+}
+
+// checkSignature verifies the signer's signature over the signed
+// attributes, which must name the TSTInfo's content type and carry its
+// digest.
+func checkSignature(signer *x509.Certificate, si signerInfo, content []byte) error {
+	if len(si.SignedAttrs.FullBytes) == 0 {
+		return errors.New("tsa: the token has no signed attributes")
+	}
+
+	hash, algo, err := signatureAlgorithm(si.DigestAlgorithm.Algorithm, si.SignatureAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	// The signed attributes are encoded as a SET for signing, rather
+	// than with the implicit tag they carry in the SignerInfo.
+	signed := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+
+	var attrs []attribute
+	if _, err = asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+		return fmt.Errorf("tsa: malformed signed attributes: %w", err)
+	}
+
+	h := hash.New()
+	h.Write(content)
+	var typeOK, digestOK bool
+	for _, attr := range attrs {
+		if len(attr.Values) != 1 {
+			continue
+		}
+
+		switch {
+		case attr.Type.Equal(oidContentType):
+			var ct asn1.ObjectIdentifier
+			_, err = asn1.Unmarshal(attr.Values[0].FullBytes, &ct)
+			typeOK = err == nil && ct.Equal(oidTSTInfo)
+		case attr.Type.Equal(oidMessageDigest):
+			var md []byte
+			_, err = asn1.Unmarshal(attr.Values[0].FullBytes, &md)
+			digestOK = err == nil && bytes.Equal(md, h.Sum(nil))
+		}
+	}
+
+	if !typeOK || !digestOK {
+		return errors.New("tsa: the signed attributes don't match the TSTInfo")
+	}
+
+	if err = signer.CheckSignature(algo, signed, si.Signature); err != nil {
+		return fmt.Errorf("tsa: bad signature on token: %w", err)
+	}
+	return nil
+}
+
+// signatureAlgorithm returns the digest and x509 signature algorithm
+// named by a SignerInfo, which may give the signature algorithm alone
+// (rsaEncryption, id-ecPublicKey) or combined with the digest.
+func signatureAlgorithm(digest, sig asn1.ObjectIdentifier) (crypto.Hash, x509.SignatureAlgorithm, error) {
+	var hash crypto.Hash
+	switch {
+	case digest.Equal(oidSHA256):
+		hash = crypto.SHA256
+	case digest.Equal(oidSHA384):
+		hash = crypto.SHA384
+	case digest.Equal(oidSHA512):
+		hash = crypto.SHA512
+	default:
+		return 0, 0, fmt.Errorf("tsa: unsupported digest algorithm %v", digest)
+	}
+
+	rsa := map[crypto.Hash]x509.SignatureAlgorithm{
+		crypto.SHA256: x509.SHA256WithRSA,
+		crypto.SHA384: x509.SHA384WithRSA,
+		crypto.SHA512: x509.SHA512WithRSA,
+	}
+	ecdsa := map[crypto.Hash]x509.SignatureAlgorithm{
+		crypto.SHA256: x509.ECDSAWithSHA256,
+		crypto.SHA384: x509.ECDSAWithSHA384,
+		crypto.SHA512: x509.ECDSAWithSHA512,
+	}
+
+	switch {
+	case sig.Equal(oidRSA):
+		return hash, rsa[hash], nil
+	case sig.Equal(oidECDSA):
+		return hash, ecdsa[hash], nil
+	case sig.Equal(oidSHA256WithRSA) && hash == crypto.SHA256,
+		sig.Equal(oidSHA384WithRSA) && hash == crypto.SHA384,
+		sig.Equal(oidSHA512WithRSA) && hash == crypto.SHA512:
+		return hash, rsa[hash], nil
+	case sig.Equal(oidECDSAWithSHA256) && hash == crypto.SHA256,
+		sig.Equal(oidECDSAWithSHA384) && hash == crypto.SHA384,
+		sig.Equal(oidECDSAWithSHA512) && hash == crypto.SHA512:
+		return hash, ecdsa[hash], nil
+	default:
+		return 0, 0, fmt.Errorf("tsa: unsupported signature algorithm %v", sig)
+	}
+}
+
+// maxResponseSize bounds the response read from an authority.
+const maxResponseSize = 1 << 20
+
+// A Client requests timestamps from an RFC 3161 authority over HTTP.
+// It implements auditlog.Timestamper.
+type Client struct {
+	// URL is the authority's timestamping endpoint.
+	URL string
+
+	// HTTPClient makes the requests. If it is nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Policy asks the authority to issue tokens under the given
+	// policy; if it is nil, the authority's default applies.
+	Policy asn1.ObjectIdentifier
+
+	// Roots are the certificates the authority's must chain to. If
+	// it is nil, the system's roots are used.
+	Roots *x509.CertPool
+}
+
+// Timestamp requests a timestamp of the SHA-256 digest, returning the
+// token once it has been verified, along with the authority's time.
+func (c *Client) Timestamp(ctx context.Context, digest []byte) ([]byte, time.Time, error) {
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	req, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		ReqPolicy: c.Policy,
+		Nonce:     nonce,
+		CertReq:   true,
+	})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	resp, err := c.post(ctx, req)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var tsr timeStampResp
+	if rest, err := asn1.Unmarshal(resp, &tsr); err != nil || len(rest) > 0 {
+		return nil, time.Time{}, errors.New("tsa: malformed response")
+	}
+
+	// Statuses 0 and 1 grant the request, the latter with
+	// modifications.
+	if tsr.Status.Status > 1 || len(tsr.Token.FullBytes) == 0 {
+		return nil, time.Time{}, fmt.Errorf("tsa: request refused with status %d %q",
+			tsr.Status.Status, tsr.Status.StatusString)
+	}
+
+	token := tsr.Token.FullBytes
+	info, err := Verify(token, digest, c.Roots)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	if info.nonce == nil || info.nonce.Cmp(nonce) != 0 {
+		return nil, time.Time{}, errors.New("tsa: the token doesn't answer the request")
+	}
+
+	if c.Policy != nil && !info.Policy.Equal(c.Policy) {
+		return nil, time.Time{}, errors.New("tsa: the token wasn't issued under the requested policy")
+	}
+	return token, info.Time, nil
+}
+
+// post sends a request to the authority, returning the response body.
+func (c *Client) post(ctx context.Context, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/timestamp-query")
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tsa: %s returned %s", c.URL, resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
@@ -0,0 +1,282 @@
+package tsa
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeAuthority is a timestamping authority whose certificate is
+// issued by a test root.
+type fakeAuthority struct {
+	root  *x509.Certificate
+	cert  *x509.Certificate
+	key   *ecdsa.PrivateKey
+	now   time.Time
+	nonce func(*big.Int) *big.Int
+}
+
+func newFakeAuthority(t *testing.T) *fakeAuthority {
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	der, err = x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "test authority"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}, root, &key.PublicKey, rootKey)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return &fakeAuthority{
+		root:  root,
+		cert:  cert,
+		key:   key,
+		now:   now,
+		nonce: func(n *big.Int) *big.Int { return n },
+	}
+}
+
+func (fa *fakeAuthority) roots() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(fa.root)
+	return pool
+}
+
+// token issues a token for the message imprint and nonce.
+func (fa *fakeAuthority) token(t *testing.T, imprint messageImprint, nonce *big.Int) []byte {
+	content, err := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+		MessageImprint: imprint,
+		SerialNumber:   big.NewInt(42),
+		GenTime:        fa.now,
+		Accuracy:       accuracy{Seconds: 1},
+		Nonce:          nonce,
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	contentDigest := sha256.Sum256(content)
+	attr := func(oid asn1.ObjectIdentifier, v interface{}) attribute {
+		val, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return attribute{Type: oid, Values: []asn1.RawValue{{FullBytes: val}}}
+	}
+
+	signed, err := asn1.MarshalWithParams([]attribute{
+		attr(oidContentType, oidTSTInfo),
+		attr(oidMessageDigest, contentDigest[:]),
+	}, "set")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	attrsDigest := sha256.Sum256(signed)
+	sig, err := fa.key.Sign(rand.Reader, attrsDigest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	sid, err := asn1.Marshal(issuerAndSerial{
+		Issuer: asn1.RawValue{FullBytes: fa.cert.RawIssuer},
+		Serial: fa.cert.SerialNumber,
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// In the SignerInfo, the attributes carry an implicit [0] tag.
+	signed[0] = 0xa0
+
+	var certs []byte
+	certs = append(certs, fa.cert.Raw...)
+	certs = append(certs, fa.root.Raw...)
+
+	sd, err := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: content},
+		Certificates: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      certs,
+		},
+		SignerInfos: []signerInfo{{
+			Version:            1,
+			SID:                asn1.RawValue{FullBytes: sid},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttrs:        asn1.RawValue{FullBytes: signed},
+			SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			Signature:          sig,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	token, err := asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        0,
+			IsCompound: true,
+			Bytes:      sd,
+		},
+	})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	return token
+}
+
+func (fa *fakeAuthority) serve(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil || r.Header.Get("Content-Type") != "application/timestamp-query" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		var req timeStampReq
+		if _, err = asn1.Unmarshal(body, &req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		resp, err := asn1.Marshal(timeStampResp{
+			Status: pkiStatusInfo{Status: 0},
+			Token:  asn1.RawValue{FullBytes: fa.token(t, req.MessageImprint, fa.nonce(req.Nonce))},
+		})
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(resp)
+	}))
+}
+
+func TestClient(t *testing.T) {
+	fa := newFakeAuthority(t)
+	srv := fa.serve(t)
+	defer srv.Close()
+
+	digest := sha256.Sum256([]byte("head"))
+	c := &Client{URL: srv.URL, Roots: fa.roots()}
+	token, when, err := c.Timestamp(context.Background(), digest[:])
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if !when.Equal(fa.now) {
+		t.Fatalf("expected the authority's time %v, have %v", fa.now, when)
+	}
+
+	info, err := Verify(token, digest[:], fa.roots())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if info.Accuracy != time.Second || info.SerialNumber.Int64() != 42 || !info.Signer.Equal(fa.cert) {
+		t.Fatalf("unexpected token info %+v", info)
+	}
+
+	// The token covers only its digest.
+	other := sha256.Sum256([]byte("other"))
+	if _, err = Verify(token, other[:], fa.roots()); err == nil {
+		t.Fatal("token verified for a different digest")
+	}
+
+	// An authority that doesn't chain to the roots isn't trusted.
+	if _, err = Verify(token, digest[:], newFakeAuthority(t).roots()); err == nil {
+		t.Fatal("token verified with the wrong roots")
+	}
+
+	// A token whose time or signature has been tampered with doesn't
+	// verify.
+	genTime := bytes.Index(token, []byte(fa.now.UTC().Format("20060102150405")))
+	for _, i := range []int{genTime + 3, len(token) - 1} {
+		tampered := append([]byte(nil), token...)
+		tampered[i] ^= 0x01
+		if _, err = Verify(tampered, digest[:], fa.roots()); err == nil {
+			t.Fatalf("token verified with byte %d changed", i)
+		}
+	}
+
+	// A token that doesn't answer the request is refused.
+	fa.nonce = func(*big.Int) *big.Int { return big.NewInt(1) }
+	if _, _, err = c.Timestamp(context.Background(), digest[:]); err == nil {
+		t.Fatal("token with the wrong nonce was accepted")
+	}
+}
+
+func TestClientRefused(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, _ := asn1.Marshal(timeStampResp{
+			Status: pkiStatusInfo{Status: 2, StatusString: []string{"bad algorithm"}},
+		})
+		w.Write(resp)
+	}))
+	defer srv.Close()
+
+	digest := sha256.Sum256([]byte("head"))
+	c := &Client{URL: srv.URL}
+	if _, _, err := c.Timestamp(context.Background(), digest[:]); err == nil {
+		t.Fatal("refused request returned a token")
+	}
+}
@@ -0,0 +1,277 @@
+package auditlog
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// ErrHeadMismatch is returned by VerifyChain when the event recorded
+// as the head of a previously verified chain is missing or has
+// changed, as happens when the chain is truncated or replaced.
+var ErrHeadMismatch = errors.New("auditlog: chain no longer matches the verified head")
+
+// A VerifiedHead records the last event of a verified chain, so that
+// later verification can resume from it.
+type VerifiedHead struct {
+	Serial    uint64 `json:"serial"`
+	Signature []byte `json:"signature"`
+}
+
+// VerifyChain verifies the events in the chain and returns its head,
+// or nil if the chain is empty. If since is nil, the whole chain is
+// verified; otherwise, only the events after since are, once the
+// event at since.Serial has been checked against the recorded
+// signature. If that event is missing or differs, ErrHeadMismatch is
+// returned and nothing more is verified.
+func (l *Logger) VerifyChain(since *VerifiedHead) (*VerifiedHead, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	start, prev, err := l.chainStart()
+	if err != nil {
+		return nil, err
+	}
+
+	if since != nil {
+		start, prev, err = l.resumeFromHead(since, start, prev)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = l.verifyFrom(start, prev); err != nil {
+		return nil, err
+	}
+	return l.head(), nil
+}
+
+// resumeFromHead returns where verification of the chain begins after
+// the verified head since, and the signature of its event, once that
+// event has been checked against the head; start and prev are the
+// beginning of the chain, as returned by chainStart.
+func (l *Logger) resumeFromHead(since *VerifiedHead, start uint64, prev []byte) (uint64, []byte, error) {
+	if since.Serial >= l.counter {
+		return 0, nil, ErrHeadMismatch
+	}
+
+	var sig []byte
+	switch {
+	case since.Serial+1 == start:
+		sig = prev
+	case since.Serial < start:
+		return 0, nil, errors.New("auditlog: the verified head has been pruned; event " +
+			strconv.FormatUint(since.Serial, 10))
+	default:
+		ev, err := l.store.Event(since.Serial)
+		if err == ErrNoEvent {
+			return 0, nil, ErrHeadMismatch
+		} else if err != nil {
+			return 0, nil, err
+		}
+		sig = ev.Signature
+	}
+
+	if !bytes.Equal(sig, since.Signature) {
+		return 0, nil, ErrHeadMismatch
+	}
+	return since.Serial + 1, sig, nil
+}
+
+// Head returns the head of the chain, or nil if the chain is empty. A
+// head taken from a logger whose chain was verified when it was
+// created can be given to WithTrustedHead to skip verifying the chain
+// up to it the next time.
+func (l *Logger) Head() *VerifiedHead {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	return l.head()
+}
+
+// head returns the head of the chain, as Head does; the caller must
+// hold the lock.
+func (l *Logger) head() *VerifiedHead {
+	if l.counter == 0 || l.lastSignature == nil {
+		return nil
+	}
+	return &VerifiedHead{Serial: l.counter - 1, Signature: l.lastSignature}
+}
+
+// WithTrustedHead verifies the chain only after head when the logger
+// is created, as VerifyChain does: the event at head.Serial must still
+// be in the chain with the head's signature, or creating the logger
+// fails with ErrHeadMismatch, but the events up to it are trusted. The
+// head should come from a chain verified in full, through Head or
+// VerifyChain, and be kept where the database's users can't change
+// it. With WithSignedCheckpoints, verification starts from whichever
+// is later. A head whose event has since been pruned is ignored, as
+// is a nil head.
+func WithTrustedHead(head *VerifiedHead) Option {
+	return func(l *Logger) {
+		l.trustedHead = head
+	}
+}
+
+// LoadVerifiedHead reads a verified head written by SaveVerifiedHead.
+func LoadVerifiedHead(path string) (*VerifiedHead, error) {
+	in, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	head := &VerifiedHead{}
+	if err = json.Unmarshal(in, head); err != nil {
+		return nil, err
+	}
+
+	if len(head.Signature) == 0 {
+		return nil, errors.New("auditlog: the verified head has no signature")
+	}
+	return head, nil
+}
+
+// SaveVerifiedHead writes head to path as JSON. The new head replaces
+// the old in a single rename, so an interrupted write leaves the
+// previous head in place.
+func SaveVerifiedHead(path string, head *VerifiedHead) error {
+	out, err := json.Marshal(head)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, out, 0600)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	return err
+}
+
+// WithVerifyWorkers sets the number of goroutines used to verify the
+// chain, which defaults to GOMAXPROCS. With one worker, the chain is
+// verified sequentially.
+func WithVerifyWorkers(n int) Option {
+	return func(l *Logger) {
+		l.verifyWorkers = n
+	}
+}
+
+// A VerifyOption changes how a certification is verified.
+type VerifyOption func(*verifyConfig)
+
+type verifyConfig struct {
+	workers  int
+	progress func(VerifyProgress)
+	keys     KeyManifest
+	hmacKey  []byte
+}
+
+// VerifyKeys verifies a certification against a chain's key history,
+// as returned by KeyHistory, rather than the single public key given,
+// so that a chain whose signing key has been rotated can be verified.
+// The public key given alongside it is ignored.
+func VerifyKeys(m KeyManifest) VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.keys = m
+	}
+}
+
+// manifest returns the keys to verify with: the key history given
+// with VerifyKeys, or else pub alone, along with the HMAC key given
+// with VerifyHMAC.
+func (vc *verifyConfig) manifest(pub *ecdsa.PublicKey) KeyManifest {
+	if vc.keys != nil {
+		return vc.keys.withHMAC(vc.hmacKey)
+	}
+	return singleKey(pub).withHMAC(vc.hmacKey)
+}
+
+// VerifyWorkers sets the number of goroutines used to verify a
+// certification, which defaults to GOMAXPROCS. With one worker, the
+// certification is verified sequentially.
+func VerifyWorkers(n int) VerifyOption {
+	return func(vc *verifyConfig) {
+		vc.workers = n
+	}
+}
+
+// verifyMinChunk is the fewest events worth handing to a worker;
+// shorter runs are verified sequentially.
+const verifyMinChunk = 64
+
+// verifyEvents verifies a run of consecutive events with the keys
+// that signed them, where prev is the signature of the event
+// preceding the first, splitting them among up to workers goroutines.
+// Each signature only depends on the one before it, so the run can be
+// checked in any order. It returns the index of the first event that
+// fails, or -1 if they all verify.
+func verifyEvents(keys KeyManifest, prev []byte, events []*Event, workers int) int {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	if max := len(events) / verifyMinChunk; workers > max {
+		workers = max
+	}
+
+	if workers <= 1 {
+		for i, ev := range events {
+			if !keys.verify(ev, prev) {
+				return i
+			}
+			prev = ev.Signature
+		}
+		return -1
+	}
+
+	// Each worker starts from the signature of the event before its
+	// run.
+	size := (len(events) + workers - 1) / workers
+	starts := make([][]byte, workers)
+	for w := range starts {
+		if w == 0 {
+			starts[w] = prev
+		} else {
+			starts[w] = events[w*size-1].Signature
+		}
+	}
+
+	failed := make([]int, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		failed[w] = -1
+		lo, hi := w*size, (w+1)*size
+		if hi > len(events) {
+			hi = len(events)
+		}
+
+		wg.Add(1)
+		go func(w, lo, hi int) {
+			defer wg.Done()
+
+			prev := starts[w]
+			for i := lo; i < hi; i++ {
+				if !keys.verify(events[i], prev) {
+					failed[w] = i
+					return
+				}
+				prev = events[i].Signature
+			}
+		}(w, lo, hi)
+	}
+	wg.Wait()
+
+	for _, i := range failed {
+		if i >= 0 {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,229 @@
+package auditlog
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyChain(t *testing.T) {
+	l, _ := newTestLogger(t)
+	l.Start()
+	defer l.Stop()
+
+	head, err := l.VerifyChain(nil)
+	if err != nil || head != nil {
+		t.Fatalf("expected an empty chain, have %+v, %v", head, err)
+	}
+
+	for i := 0; i < 3; i++ {
+		l.InfoSync("verify_test", "event", nil)
+	}
+
+	head, err = l.VerifyChain(nil)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if head.Serial != 2 {
+		t.Fatalf("expected the head to be event 2, have %d", head.Serial)
+	}
+
+	l.InfoSync("verify_test", "event", nil)
+	next, err := l.VerifyChain(head)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if next.Serial != 3 {
+		t.Fatalf("expected the head to be event 3, have %d", next.Serial)
+	}
+
+	// A replacement chain no longer matches the verified head.
+	forged, _ := newTestLogger(t)
+	forged.Start()
+	defer forged.Stop()
+
+	for i := 0; i < 5; i++ {
+		forged.InfoSync("verify_test", "forged", nil)
+	}
+
+	if _, err = forged.VerifyChain(next); err != ErrHeadMismatch {
+		t.Fatalf("expected a head mismatch, have %v", err)
+	}
+
+	// A chain shorter than the verified head has been truncated.
+	short, _ := newTestLogger(t)
+
+	if _, err = short.VerifyChain(next); err != ErrHeadMismatch {
+		t.Fatalf("expected a head mismatch, have %v", err)
+	}
+}
+
+func TestTrustedHead(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, store := newTestLogger(t)
+	l.Start()
+	for i := 0; i < 5; i++ {
+		l.InfoSync("verify_test", "event", nil)
+	}
+	l.Stop()
+
+	path := filepath.Join(t.TempDir(), "head.json")
+	if err := SaveVerifiedHead(path, l.Head()); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	head, err := LoadVerifiedHead(path)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if head.Serial != 4 {
+		t.Fatalf("expected the head to be event 4, have %d", head.Serial)
+	}
+
+	l, err = NewWithStore(store, signer, WithoutEcho(), WithTrustedHead(head))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	l.InfoSync("verify_test", "event", nil)
+	l.Stop()
+
+	// The events up to the head are trusted, so a change to one of
+	// them goes unnoticed until the whole chain is verified.
+	store.events[2].Actor = "forged"
+	if _, err = NewWithStore(store, signer, WithoutEcho(), WithTrustedHead(head)); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if _, err = NewWithStore(store, signer, WithoutEcho()); err != errAuditFailure {
+		t.Fatalf("expected an audit failure, have %v", err)
+	}
+
+	// The events after the head are verified.
+	store.events[2].Actor = "verify_test"
+	store.events[5].Actor = "forged"
+	if _, err = NewWithStore(store, signer, WithoutEcho(), WithTrustedHead(head)); err != errAuditFailure {
+		t.Fatalf("expected an audit failure, have %v", err)
+	}
+
+	// A chain that no longer holds the head fails.
+	store.events[5].Actor = "verify_test"
+	store.events[4] = copyEvent(store.events[3])
+	if _, err = NewWithStore(store, signer, WithoutEcho(), WithTrustedHead(head)); err != ErrHeadMismatch {
+		t.Fatalf("expected a head mismatch, have %v", err)
+	}
+}
+
+func TestVerifyEventsParallel(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, store := newTestLogger(t, WithVerifyWorkers(4))
+	l.Start()
+
+	for i := 0; i < 4*verifyMinChunk; i++ {
+		l.InfoSync("verify_test", "event", nil)
+	}
+
+	cl, err := l.Certify(0, l.counter-1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	for _, workers := range []int{0, 1, 4, 16} {
+		if _, ok := VerifyCertification(cl, &signer.PublicKey, VerifyWorkers(workers)); !ok {
+			t.Fatalf("certification failed to verify with %d workers", workers)
+		}
+	}
+
+	count, err := store.Count()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	events, err := store.Events(0, count-1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// Every worker must report the first failure, wherever it lies.
+	for _, bad := range []int{0, verifyMinChunk, len(events) / 2, len(events) - 1} {
+		actor := events[bad].Actor
+		events[bad].Actor = "forged"
+		for _, workers := range []int{1, 4} {
+			if i := verifyEvents(singleKey(&signer.PublicKey), nil, events, workers); i != bad {
+				t.Fatalf("with %d workers, expected event %d to fail, have %d", workers, bad, i)
+			}
+		}
+		events[bad].Actor = actor
+	}
+
+	// Reopening verifies the stored chain in batches.
+	l, err = NewWithStore(store, signer, WithoutEcho(), WithVerifyWorkers(4))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Start()
+	l.Stop()
+}
+
+func TestVerifyProgress(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, store := newTestLogger(t)
+	l.Start()
+
+	for i := 0; i < backupBatch+10; i++ {
+		l.Info("verify_test", "event", nil)
+	}
+	l.InfoSync("verify_test", "event", nil)
+
+	cl, err := l.Certify(0, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	l.Stop()
+
+	check := func(what string, reports []VerifyProgress, total uint64) {
+		if len(reports) < 2 {
+			t.Fatalf("%s: expected progress after each batch, have %d reports", what, len(reports))
+		}
+
+		for i, p := range reports {
+			if p.Total != total || (i > 0 && p.Verified <= reports[i-1].Verified) {
+				t.Fatalf("%s: bad progress report %d: %+v", what, i, p)
+			}
+		}
+
+		if last := reports[len(reports)-1]; last.Verified != total || last.Remaining() != 0 {
+			t.Fatalf("%s: expected the last report to cover every event, have %+v", what, last)
+		}
+	}
+
+	// Startup verification reports on the whole chain.
+	var reports []VerifyProgress
+	l, err = NewWithStore(store, signer, WithoutEcho(), WithVerifyProgress(func(p VerifyProgress) {
+		reports = append(reports, p)
+	}))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	count, err := store.Count()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	check("startup", reports, count)
+
+	reports = nil
+	cert, ok := VerifyCertification(cl, &signer.PublicKey, VerifyProgressFunc(func(p VerifyProgress) {
+		reports = append(reports, p)
+	}))
+	if !ok {
+		t.Fatal("certification failed to verify")
+	}
+	check("certification", reports, uint64(len(cert.Chain)))
+}
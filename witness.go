@@ -0,0 +1,242 @@
+package auditlog
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// EventWitnessFailure is the ERROR event recorded when a witness
+// couldn't cosign a checkpoint.
+const EventWitnessFailure = "witness failure"
+
+// DefaultWitnessTimeout bounds each exchange with a witness.
+const DefaultWitnessTimeout = 30 * time.Second
+
+// A Witness countersigns the logger's signed checkpoints. A witness is
+// run by another party, and remembers the latest checkpoint it has
+// cosigned; it only cosigns a checkpoint shown to extend that one, so
+// a logger whose key is compromised can't rewrite the history a
+// witness has seen. The witness package provides a server and an HTTP
+// client.
+type Witness interface {
+	// Name identifies the witness in recorded cosignatures.
+	Name() string
+
+	// PublicKey returns the key the witness signs with.
+	PublicKey() *ecdsa.PublicKey
+
+	// Latest returns the latest checkpoint the witness has
+	// cosigned for the chain, or nil if it hasn't cosigned any.
+	Latest(ctx context.Context) (*Checkpoint, error)
+
+	// Cosign submits a checkpoint, returning the witness's
+	// signature over it.
+	Cosign(ctx context.Context, sub *CheckpointSubmission) ([]byte, error)
+}
+
+// A CheckpointSubmission is a signed checkpoint submitted to a witness,
+// along with the events that link it to the latest checkpoint the
+// witness has cosigned: the event that checkpoint names through the
+// event the new one names. A witness that has yet to cosign a
+// checkpoint accepts the first it is given, with no events.
+type CheckpointSubmission struct {
+	Checkpoint SignedCheckpoint `json:"checkpoint"`
+	Events     []*Event         `json:"events,omitempty"`
+}
+
+// Verify checks a submission as a witness does before cosigning it:
+// the checkpoint must be signed with the chain's key, and, if the
+// witness has already cosigned latest, the submitted events must link
+// latest to the new checkpoint. A chain that doesn't extend latest is
+// reported with an error wrapping ErrInconsistent.
+func (sub *CheckpointSubmission) Verify(latest *Checkpoint, keys KeyManifest) error {
+	sc := &sub.Checkpoint
+	if !keys.verifyCheckpoint(sc) {
+		return errors.New("auditlog: bad signature on checkpoint")
+	}
+
+	if latest == nil {
+		return nil
+	}
+
+	if sc.Serial < latest.Serial {
+		return fmt.Errorf("%w: the checkpoint precedes event %d", ErrInconsistent, latest.Serial)
+	}
+
+	events := sub.Events
+	if uint64(len(events)) != sc.Serial-latest.Serial+1 {
+		return fmt.Errorf("auditlog: expected events %d through %d", latest.Serial, sc.Serial)
+	}
+
+	for i, ev := range events {
+		if ev == nil || ev.Serial != latest.Serial+uint64(i) {
+			return errors.New("auditlog: the submitted events are out of order")
+		}
+	}
+
+	// The first event is the one the latest checkpoint names, which
+	// vouches for it; every later one must follow on from it.
+	if chainLink(events[0]) != latest.Head {
+		return fmt.Errorf("%w: event %d differs", ErrInconsistent, latest.Serial)
+	}
+
+	if i := verifyEvents(keys, events[0].Signature, events[1:], 0); i >= 0 {
+		return fmt.Errorf("%w: event %d doesn't follow on from event %d", ErrInconsistent, events[i+1].Serial, latest.Serial)
+	}
+
+	if chainLink(events[len(events)-1]) != sc.Head {
+		return fmt.Errorf("%w: event %d differs", ErrInconsistent, sc.Serial)
+	}
+	return nil
+}
+
+// A Cosignature is a witness's signature over a signed checkpoint,
+// which, like the logger's, is over the SHA-256 digest of the
+// checkpoint's text form.
+type Cosignature struct {
+	Serial    uint64
+	Witness   string
+	Signature []byte
+}
+
+// Verify reports whether the cosignature is a signature over cp by the
+// witness holding pub.
+func (cs *Cosignature) Verify(cp Checkpoint, pub *ecdsa.PublicKey) bool {
+	return cs.Serial == cp.Serial && ecdsa.VerifyASN1(pub, cp.digest(), cs.Signature)
+}
+
+// A CosignatureRecorder is a Store that keeps the cosignatures
+// witnesses have made over its signed checkpoints.
+type CosignatureRecorder interface {
+	// StoreCosignature records a cosignature. Recording a second
+	// cosignature by the same witness of the same checkpoint has
+	// no effect.
+	StoreCosignature(cs Cosignature) error
+
+	// Cosignatures returns the cosignatures of the checkpoint of
+	// the given event.
+	Cosignatures(serial uint64) ([]Cosignature, error)
+}
+
+// WithWitnesses submits each signed checkpoint to the witnesses as it
+// is recorded, and records their cosignatures alongside it; it must be
+// used with WithSignedCheckpoints, and the store must be a
+// CosignatureRecorder. Each witness is sent the events since the
+// latest checkpoint it has cosigned, which must not have been pruned.
+// A witness that refuses or can't be reached is reported in an ERROR
+// "witness failure" event, and is tried again with the next
+// checkpoint.
+func WithWitnesses(witnesses ...Witness) Option {
+	return func(l *Logger) {
+		l.witnesses = append(l.witnesses, witnesses...)
+	}
+}
+
+// witnessCheckpoint submits a signed checkpoint to each witness,
+// recording the cosignatures.
+func (l *Logger) witnessCheckpoint(sc *SignedCheckpoint) {
+	for _, w := range l.witnesses {
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultWitnessTimeout)
+		err := l.submitCheckpoint(ctx, w, sc)
+		cancel()
+
+		if err != nil {
+			l.logInternal(levelError, EventWitnessFailure, []Attribute{
+				{"witness", w.Name()},
+				{"serial", strconv.FormatUint(sc.Serial, 10)},
+				{"error", err.Error()},
+			})
+		}
+	}
+}
+
+// submitCheckpoint submits a signed checkpoint to a witness, with the
+// events linking it to the latest the witness has cosigned, and
+// records the witness's cosignature.
+func (l *Logger) submitCheckpoint(ctx context.Context, w Witness, sc *SignedCheckpoint) error {
+	latest, err := w.Latest(ctx)
+	if err != nil {
+		return err
+	}
+
+	sub := &CheckpointSubmission{Checkpoint: *sc}
+	if latest != nil {
+		if latest.Serial > sc.Serial {
+			return fmt.Errorf("%w: the witness has cosigned event %d", ErrInconsistent, latest.Serial)
+		}
+
+		sub.Events, err = l.witnessEvents(latest.Serial, sc.Serial)
+		if err != nil {
+			return err
+		}
+	}
+
+	sig, err := w.Cosign(ctx, sub)
+	if err != nil {
+		return err
+	}
+
+	cs := Cosignature{Serial: sc.Serial, Witness: w.Name(), Signature: sig}
+	if !cs.Verify(sc.Checkpoint, w.PublicKey()) {
+		return errors.New("auditlog: bad cosignature from witness")
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	cr, ok := l.store.(CosignatureRecorder)
+	if !ok {
+		return errors.New("auditlog: the store cannot record cosignatures")
+	}
+	return cr.StoreCosignature(cs)
+}
+
+// witnessEvents reads the events in the range [start, end] to submit
+// to a witness.
+func (l *Logger) witnessEvents(start, end uint64) ([]*Event, error) {
+	l.pruneLock.Lock()
+	defer l.pruneLock.Unlock()
+
+	l.lock.Lock()
+	first, _, err := l.chainStart()
+	l.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if start < first {
+		return nil, fmt.Errorf("auditlog: event %d has been pruned", start)
+	}
+
+	var events []*Event
+	for serial := start; serial <= end; serial += backupBatch {
+		last := serial + backupBatch - 1
+		if last > end {
+			last = end
+		}
+
+		batch, err := l.store.Events(serial, last)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, batch...)
+	}
+	return events, nil
+}
+
+// Cosignatures returns the cosignatures witnesses have made over the
+// signed checkpoint of the given event.
+func (l *Logger) Cosignatures(serial uint64) ([]Cosignature, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	cr, ok := l.store.(CosignatureRecorder)
+	if !ok {
+		return nil, errors.New("auditlog: the store cannot record cosignatures")
+	}
+	return cr.Cosignatures(serial)
+}
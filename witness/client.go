@@ -0,0 +1,131 @@
+package witness
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/kisom/auditlog"
+)
+
+// maxResponseSize bounds the responses a Client reads.
+const maxResponseSize = 1 << 16
+
+// A Client submits checkpoints to a witness over HTTP, as an
+// auditlog.Witness.
+type Client struct {
+	// ID names the witness in the cosignatures the logger records.
+	ID string
+
+	// URL is the witness's base URL; the protocol's paths are
+	// appended to it.
+	URL string
+
+	// Key is the witness's public key.
+	Key *ecdsa.PublicKey
+
+	// HTTPClient makes the requests; if it is nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// Name returns the witness's ID.
+func (c *Client) Name() string {
+	return c.ID
+}
+
+// PublicKey returns the witness's public key.
+func (c *Client) PublicKey() *ecdsa.PublicKey {
+	return c.Key
+}
+
+// Latest asks the witness for the latest checkpoint it has cosigned.
+func (c *Client) Latest(ctx context.Context) (*auditlog.Checkpoint, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint("latest"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	status, body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusOK:
+		cp, err := auditlog.ParseCheckpoint(strings.TrimSpace(string(body)))
+		if err != nil {
+			return nil, fmt.Errorf("witness: malformed checkpoint from %s: %w", c.ID, err)
+		}
+		return &cp, nil
+	default:
+		return nil, c.refused(status, body)
+	}
+}
+
+// Cosign submits a checkpoint to the witness, returning its signature.
+// A witness that finds the chain doesn't extend its latest checkpoint
+// is reported with an error wrapping auditlog.ErrInconsistent.
+func (c *Client) Cosign(ctx context.Context, sub *auditlog.CheckpointSubmission) ([]byte, error) {
+	out, err := json.Marshal(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint("cosign"), bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	status, body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch status {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusConflict:
+		return nil, fmt.Errorf("witness: %s refused the checkpoint: %w: %s", c.ID,
+			auditlog.ErrInconsistent, strings.TrimSpace(string(body)))
+	default:
+		return nil, c.refused(status, body)
+	}
+}
+
+// endpoint returns the URL of one of the protocol's paths.
+func (c *Client) endpoint(path string) string {
+	return strings.TrimSuffix(c.URL, "/") + "/" + path
+}
+
+// do sends a request to the witness, returning the response's status
+// and body.
+func (c *Client) do(req *http.Request) (int, []byte, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	return resp.StatusCode, body, err
+}
+
+// refused returns the error for an unexpected response.
+func (c *Client) refused(status int, body []byte) error {
+	return fmt.Errorf("witness: %s returned %d: %s", c.ID, status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,171 @@
+// Package witness runs and talks to witnesses, which countersign an
+// audit chain's signed checkpoints; see auditlog.WithWitnesses. A
+// witness is run by a party other than the logger's operator, and
+// keeps the latest checkpoint it has cosigned. It only cosigns a new
+// checkpoint when shown the events that link the two, so once a
+// witness has seen a chain, even the holder of the logger's key can't
+// replace that chain with another and have it cosigned.
+//
+// A Witness serves the protocol over HTTP, and a Client submits to
+// one. GET on /latest returns the latest checkpoint the witness has
+// cosigned, in the text form of auditlog.Checkpoint, or No Content if
+// it hasn't cosigned any. POST on /cosign takes a JSON-encoded
+// auditlog.CheckpointSubmission and returns the witness's signature,
+// or Conflict if the chain doesn't extend the witness's latest
+// checkpoint. Cosignatures, like the logger's own, are ASN.1 ECDSA
+// signatures over the SHA-256 digest of the checkpoint's text form.
+package witness
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kisom/auditlog"
+)
+
+// MaxSubmissionSize bounds the submissions a Witness reads, which hold
+// every event since its latest checkpoint.
+const MaxSubmissionSize = 256 << 20
+
+// State keeps the latest checkpoint a witness has cosigned.
+type State interface {
+	// Load returns the latest checkpoint, or nil if none has been
+	// saved.
+	Load() (*auditlog.Checkpoint, error)
+
+	// Save replaces the latest checkpoint.
+	Save(cp auditlog.Checkpoint) error
+}
+
+// A FileState keeps the latest checkpoint in the named file, in its
+// text form. Each checkpoint replaces the last in a single rename.
+type FileState string
+
+// Load reads the checkpoint in the file, returning nil if the file
+// doesn't exist.
+func (path FileState) Load() (*auditlog.Checkpoint, error) {
+	data, err := ioutil.ReadFile(string(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	cp, err := auditlog.ParseCheckpoint(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// Save writes the checkpoint to the file.
+func (path FileState) Save(cp auditlog.Checkpoint) error {
+	tmp := string(path) + ".tmp"
+	err := ioutil.WriteFile(tmp, []byte(cp.String()+"\n"), 0600)
+	if err == nil {
+		err = os.Rename(tmp, string(path))
+	}
+	return err
+}
+
+// A Witness cosigns the checkpoints of a single chain.
+type Witness struct {
+	// Keys are the keys that sign the chain.
+	Keys auditlog.KeyManifest
+
+	// Signer is the witness's own key, which must be an ECDSA key.
+	Signer crypto.Signer
+
+	// State keeps the latest checkpoint the witness has cosigned.
+	State State
+
+	lock sync.Mutex
+}
+
+// Latest returns the latest checkpoint the witness has cosigned, or
+// nil if it hasn't cosigned any.
+func (w *Witness) Latest() (*auditlog.Checkpoint, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.State.Load()
+}
+
+// Cosign verifies a submission against the latest checkpoint the
+// witness has cosigned, and signs the submitted checkpoint, which
+// becomes the latest. A chain that doesn't extend the latest
+// checkpoint is reported with an error wrapping
+// auditlog.ErrInconsistent.
+func (w *Witness) Cosign(sub *auditlog.CheckpointSubmission) ([]byte, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	latest, err := w.State.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = sub.Verify(latest, w.Keys); err != nil {
+		return nil, err
+	}
+
+	cp := sub.Checkpoint.Checkpoint
+	digest := sha256.Sum256([]byte(cp.String()))
+	sig, err := w.Signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	if latest == nil || cp.Serial > latest.Serial {
+		if err = w.State.Save(cp); err != nil {
+			return nil, err
+		}
+	}
+	return sig, nil
+}
+
+// ServeHTTP serves the witness protocol.
+func (w *Witness) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.URL.Path == "/latest" && req.Method == http.MethodGet:
+		latest, err := w.Latest()
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+		} else if latest == nil {
+			rw.WriteHeader(http.StatusNoContent)
+		} else {
+			rw.Header().Set("Content-Type", "text/plain")
+			io.WriteString(rw, latest.String()+"\n")
+		}
+
+	case req.URL.Path == "/cosign" && req.Method == http.MethodPost:
+		var sub auditlog.CheckpointSubmission
+		err := json.NewDecoder(io.LimitReader(req.Body, MaxSubmissionSize)).Decode(&sub)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sig, err := w.Cosign(&sub)
+		if errors.Is(err, auditlog.ErrInconsistent) {
+			http.Error(rw, err.Error(), http.StatusConflict)
+		} else if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+		} else {
+			rw.Header().Set("Content-Type", "application/octet-stream")
+			rw.Write(sig)
+		}
+
+	default:
+		http.NotFound(rw, req)
+	}
+}
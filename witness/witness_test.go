@@ -0,0 +1,109 @@
+package witness
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kisom/auditlog"
+)
+
+func TestWitness(t *testing.T) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	w := &Witness{
+		Keys:   auditlog.KeyManifest{{Public: &signer.PublicKey, Current: true}},
+		Signer: key,
+		State:  FileState(filepath.Join(t.TempDir(), "witness.state")),
+	}
+	srv := httptest.NewServer(w)
+	defer srv.Close()
+
+	client := &Client{ID: "test witness", URL: srv.URL, Key: &key.PublicKey}
+	run := func(store auditlog.Store, events int) *auditlog.SignedCheckpoint {
+		l, err := auditlog.NewWithStore(store, signer, auditlog.WithoutEcho(),
+			auditlog.WithSignedCheckpoints(time.Hour), auditlog.WithWitnesses(client))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		l.Start()
+		for i := 0; i < events; i++ {
+			l.InfoSync("witness_test", "event", nil)
+		}
+		l.Stop()
+
+		sc, err := store.(auditlog.CheckpointRecorder).LatestCheckpoint()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return sc
+	}
+
+	// The first checkpoint is taken on trust, and each later one is
+	// cosigned along with the events since.
+	store := auditlog.NewMemoryStore()
+	for _, events := range []int{10, 5} {
+		sc := run(store, events)
+		sigs, err := store.Cosignatures(sc.Serial)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if len(sigs) != 1 || sigs[0].Witness != client.ID || !sigs[0].Verify(sc.Checkpoint, &key.PublicKey) {
+			t.Fatalf("unexpected cosignatures %+v of checkpoint %d", sigs, sc.Serial)
+		}
+
+		latest, err := w.Latest()
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+
+		if latest == nil || *latest != sc.Checkpoint {
+			t.Fatalf("witness has %v, expected %v", latest, sc.Checkpoint)
+		}
+	}
+	latest, _ := w.Latest()
+
+	// A chain regrown with the logger's key isn't cosigned, and the
+	// refusal is recorded in it.
+	forged := auditlog.NewMemoryStore()
+	sc := run(forged, 30)
+	sigs, err := forged.Cosignatures(sc.Serial)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if len(sigs) != 0 {
+		t.Fatalf("the forged chain was cosigned: %+v", sigs)
+	}
+
+	count, err := forged.Count()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	ev, err := forged.Event(count - 1)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	if ev.Event != auditlog.EventWitnessFailure {
+		t.Fatalf("expected a witness failure, have %q", ev.Event)
+	}
+
+	if now, _ := w.Latest(); *now != *latest {
+		t.Fatalf("the witness moved to %v", now)
+	}
+}
@@ -0,0 +1,93 @@
+package auditlog
+
+import (
+	"crypto"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckpointSubmission(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	l, _ := newTestLogger(t)
+	l.Start()
+	defer l.Stop()
+
+	signed := func() *SignedCheckpoint {
+		cp, ok := l.Checkpoint()
+		if !ok {
+			t.Fatal("no checkpoint")
+		}
+
+		sig, err := signer.Sign(rand.Reader, cp.digest(), crypto.SHA256)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		return &SignedCheckpoint{Checkpoint: cp, Signature: sig}
+	}
+
+	for i := 0; i < 5; i++ {
+		l.InfoSync("witness_test", "event", nil)
+	}
+	older := signed()
+
+	for i := 0; i < 5; i++ {
+		l.InfoSync("witness_test", "event", nil)
+	}
+	newer := signed()
+
+	keys := singleKey(&signer.PublicKey)
+	events, err := l.witnessEvents(older.Serial, newer.Serial)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	sub := &CheckpointSubmission{Checkpoint: *newer, Events: events}
+	if err = sub.Verify(&older.Checkpoint, keys); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// The first checkpoint a witness sees needs no events.
+	if err = (&CheckpointSubmission{Checkpoint: *older}).Verify(nil, keys); err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	// A checkpoint can't go back, or be linked by altered events.
+	back := &CheckpointSubmission{Checkpoint: *older}
+	if err = back.Verify(&newer.Checkpoint, keys); !errors.Is(err, ErrInconsistent) {
+		t.Fatalf("expected an inconsistency, have %v", err)
+	}
+
+	altered := *events[2]
+	altered.Event = "altered"
+	sub.Events = append(append(append([]*Event{}, events[:2]...), &altered), events[3:]...)
+	if err = sub.Verify(&older.Checkpoint, keys); !errors.Is(err, ErrInconsistent) {
+		t.Fatalf("expected an inconsistency, have %v", err)
+	}
+
+	sub.Events = events[1:]
+	if err = sub.Verify(&older.Checkpoint, keys); err == nil {
+		t.Fatal("verified a submission missing an event")
+	}
+
+	sub.Events = events
+	sub.Checkpoint.Serial++
+	if err = sub.Verify(&older.Checkpoint, keys); err == nil {
+		t.Fatal("verified a submission with a bad signature")
+	}
+
+	// Witnesses cosign signed checkpoints, which must be recorded.
+	if _, err = NewWithStore(NewMemoryStore(), signer, WithWitnesses(nil)); err == nil {
+		t.Fatal("logger started with witnesses but without signed checkpoints")
+	}
+
+	store := struct {
+		Store
+		CheckpointRecorder
+	}{NewMemoryStore(), NewMemoryStore()}
+	if _, err = NewWithStore(store, signer, WithSignedCheckpoints(time.Hour), WithWitnesses(nil)); err == nil {
+		t.Fatal("logger started with witnesses on a store that can't record cosignatures")
+	}
+}
@@ -0,0 +1,133 @@
+package auditlog
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// A WORMVerifier is a Store that can confirm that it is write-once:
+// records can be added through its connection, but existing records
+// can't be modified or deleted.
+type WORMVerifier interface {
+	VerifyWORM() error
+}
+
+// ErrNotWORM is returned when a write-once store is required and the
+// logger's store can't confirm that it is write-once.
+var ErrNotWORM = errors.New("auditlog: store is not write-once")
+
+// WithWORM requires the logger's store to be write-once, which is
+// checked when the logger is created. This is a defense in depth
+// beyond the signatures on the chain; note that a write-once store
+// can't be pruned or compressed.
+func WithWORM() Option {
+	return func(l *Logger) {
+		l.requireWORM = true
+	}
+}
+
+// checkWORM verifies that the store is write-once if that's required.
+func (l *Logger) checkWORM(store Store) error {
+	if !l.requireWORM {
+		return nil
+	}
+
+	verifier, ok := store.(WORMVerifier)
+	if !ok {
+		return ErrNotWORM
+	}
+	return verifier.VerifyWORM()
+}
+
+// auditTables lists the tables in auditlog.sql.
+var auditTables = []string{
+	"events", "attributes", "error_events", "error_attributes",
+	"errors", "pruned", "signing_keys", "checkpoints", "cosignatures",
+}
+
+// wormPrivileges returns the privileges a write-once role is granted
+// on an audit table. Only pruning adds rows to the pruned table, and a
+// write-once store can't be pruned, so the role can't add to it.
+func wormPrivileges(table string) string {
+	if table == "pruned" {
+		return "SELECT"
+	}
+	return "SELECT, INSERT"
+}
+
+// SetupWORMRole creates a database role that may only add and read
+// audit records, connecting with the administrative credentials in
+// admin. The schema is migrated first, as the role can't. The logger
+// should then connect as role, with the WORM option enabled.
+func SetupWORMRole(admin *DBConnDetails, role, password string) error {
+	db, err := sql.Open("postgres", admin.String())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, _, err = migrateSchema(db); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	name := pq.QuoteIdentifier(role)
+	statements := []string{
+		fmt.Sprintf("CREATE ROLE %s LOGIN PASSWORD %s", name, pq.QuoteLiteral(password)),
+	}
+
+	for _, table := range auditTables {
+		statements = append(statements,
+			fmt.Sprintf("REVOKE ALL ON %s FROM %s", table, name),
+			fmt.Sprintf("GRANT %s ON %s TO %s", wormPrivileges(table), table, name))
+	}
+
+	// The logger reads the schema version when it connects. The
+	// SERIAL columns draw from sequences, which the role must be able
+	// to advance.
+	statements = append(statements,
+		fmt.Sprintf("REVOKE ALL ON schema_version FROM %s", name),
+		fmt.Sprintf("GRANT SELECT ON schema_version TO %s", name),
+		fmt.Sprintf("GRANT USAGE ON ALL SEQUENCES IN SCHEMA public TO %s", name))
+
+	for _, stmt := range statements {
+		_, err = tx.Exec(stmt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// VerifyWORM checks that the connected role can't update, delete, or
+// truncate any of the audit tables, or mark events as pruned.
+func (s *pgStore) VerifyWORM() error {
+	for _, table := range auditTables {
+		privileges := []string{"UPDATE", "DELETE", "TRUNCATE"}
+		if table == "pruned" {
+			privileges = append(privileges, "INSERT")
+		}
+
+		for _, privilege := range privileges {
+			var granted bool
+			err := s.db.QueryRow(`SELECT has_table_privilege(current_user, $1, $2)`,
+				table, privilege).Scan(&granted)
+			if err != nil {
+				return err
+			}
+
+			if granted {
+				return fmt.Errorf("%w: %s privilege held on %s", ErrNotWORM, privilege, table)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package auditlog
+
+import "testing"
+
+// wormStore is a memory store that reports whether it is write-once.
+type wormStore struct {
+	*MemoryStore
+	err error
+}
+
+func (ws *wormStore) VerifyWORM() error {
+	return ws.err
+}
+
+func TestWORM(t *testing.T) {
+	signer := testKey(t, "signer")
+
+	_, err := NewWithStore(NewMemoryStore(), signer, WithoutEcho(), WithWORM())
+	if err != ErrNotWORM {
+		t.Fatalf("expected ErrNotWORM, have %v", err)
+	}
+
+	_, err = NewWithStore(&wormStore{NewMemoryStore(), ErrNotWORM}, signer, WithoutEcho(), WithWORM())
+	if err != ErrNotWORM {
+		t.Fatalf("expected ErrNotWORM, have %v", err)
+	}
+
+	_, err = NewWithStore(&wormStore{NewMemoryStore(), nil}, signer, WithoutEcho(), WithWORM())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+}